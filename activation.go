@@ -0,0 +1,124 @@
+package gardendocker
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets on.
+const listenFDsStart = 3
+
+// ActivationListeners returns the listening sockets systemd passed to the
+// process by socket activation, as described by the LISTEN_PID and
+// LISTEN_FDS environment variables, or none if it was started normally.
+// The variables are unset so that child processes do not inherit them.
+func ActivationListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n == 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: fd %d: %s", fd, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// ActivationProxy serves a socket-activated listener by forwarding each
+// connection to the garden server, which can only listen on an address of
+// its own. Since systemd holds the activated socket, clients connecting
+// while garden-docker restarts wait in its backlog rather than being refused.
+type ActivationProxy struct {
+	Listener net.Listener
+
+	// Network and Addr are where the garden server listens.
+	Network string
+	Addr    string
+
+	Logger lager.Logger
+
+	// Audit, if set, is shown every connection's traffic, to record the
+	// operations the clients ask for.
+	Audit *AuditLog
+}
+
+// Serve forwards connections until the listener is closed.
+func (p *ActivationProxy) Serve() error {
+	for {
+		conn, err := p.Listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go p.forward(conn)
+	}
+}
+
+func (p *ActivationProxy) forward(conn net.Conn) {
+	defer conn.Close()
+
+	server, err := net.Dial(p.Network, p.Addr)
+	if err != nil {
+		p.Logger.Error("dial-server-failed", err)
+		return
+	}
+	defer server.Close()
+
+	var fromClient, fromServer io.Reader = conn, server
+	if p.Audit != nil {
+		requests, responses := p.Audit.Watch(conn)
+		defer requests.Close()
+		defer responses.Close()
+
+		fromClient, fromServer = io.TeeReader(conn, requests), io.TeeReader(server, responses)
+	}
+
+	done := make(chan struct{}, 2)
+	go pipe(server, fromClient, done)
+	go pipe(conn, fromServer, done)
+
+	<-done
+	<-done
+}
+
+// pipe copies from src to dst until src is exhausted, then closes the write
+// half of dst (if it can) so that the other end sees EOF.
+func pipe(dst net.Conn, src io.Reader, done chan<- struct{}) {
+	io.Copy(dst, src)
+
+	if cw, ok := dst.(interface {
+		CloseWrite() error
+	}); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+
+	done <- struct{}{}
+}
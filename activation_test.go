@@ -0,0 +1,92 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/julz/garden-docker"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Socket activation", func() {
+	Describe("ActivationListeners", func() {
+		AfterEach(func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+		})
+
+		It("returns none when not socket-activated", func() {
+			Expect(ActivationListeners()).To(BeEmpty())
+		})
+
+		It("ignores sockets passed to another process", func() {
+			os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+			os.Setenv("LISTEN_FDS", "1")
+
+			Expect(ActivationListeners()).To(BeEmpty())
+			Expect(os.Getenv("LISTEN_FDS")).To(BeEmpty())
+		})
+	})
+
+	Describe("ActivationProxy", func() {
+		var dir string
+		var server, activated net.Listener
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "activation")
+			Expect(err).NotTo(HaveOccurred())
+
+			server, err = net.Listen("unix", filepath.Join(dir, "server.sock"))
+			Expect(err).NotTo(HaveOccurred())
+
+			activated, err = net.Listen("unix", filepath.Join(dir, "activated.sock"))
+			Expect(err).NotTo(HaveOccurred())
+
+			proxy := &ActivationProxy{
+				Listener: activated,
+				Network:  "unix",
+				Addr:     filepath.Join(dir, "server.sock"),
+				Logger:   lagertest.NewTestLogger("activation"),
+			}
+
+			go proxy.Serve()
+		})
+
+		AfterEach(func() {
+			activated.Close()
+			server.Close()
+			os.RemoveAll(dir)
+		})
+
+		It("forwards connections to the server in both directions", func() {
+			go func() {
+				defer GinkgoRecover()
+
+				conn, err := server.Accept()
+				Expect(err).NotTo(HaveOccurred())
+				defer conn.Close()
+
+				request, err := ioutil.ReadAll(conn)
+				Expect(err).NotTo(HaveOccurred())
+
+				conn.Write(append([]byte("echo: "), request...))
+			}()
+
+			client, err := net.Dial("unix", filepath.Join(dir, "activated.sock"))
+			Expect(err).NotTo(HaveOccurred())
+			defer client.Close()
+
+			client.Write([]byte("ping"))
+			client.(*net.UnixConn).CloseWrite()
+
+			Expect(ioutil.ReadAll(client)).To(Equal([]byte("echo: ping")))
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package gardendocker
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
+)
+
+//go:generate counterfeiter . ConnectionTracker
+type ConnectionTracker interface {
+	HasConnections(ip string) (bool, error)
+}
+
+// ActivityHandler tracks when a container was last used. A container counts
+// as active while it receives API calls, runs processes or has open network
+// connections; it is only reapable once it has been idle for its grace time.
+type ActivityHandler struct {
+	GraceTime   time.Duration
+	ContainerIP string
+
+	ProcessTracker process_tracker.ProcessTracker
+	Connections    ConnectionTracker
+
+	mu         sync.Mutex
+	lastActive time.Time
+}
+
+// SetGraceTime changes how long the container may be idle before it is
+// reaped. Zero means never.
+func (a *ActivityHandler) SetGraceTime(graceTime time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.GraceTime = graceTime
+}
+
+func (a *ActivityHandler) graceTime() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.GraceTime
+}
+
+func (a *ActivityHandler) Touch() {
+	a.touch(time.Now())
+}
+
+func (a *ActivityHandler) LastActive() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.lastActive
+}
+
+// Idle reports whether the container has been inactive for longer than its
+// grace time. Running processes and open connections count as activity, so
+// checking them also resets the idle timer.
+func (a *ActivityHandler) Idle(now time.Time) bool {
+	graceTime := a.graceTime()
+	if graceTime == 0 {
+		return false
+	}
+
+	if a.hasRunningProcesses() || a.hasConnections() {
+		a.touch(now)
+		return false
+	}
+
+	return now.Sub(a.LastActive()) >= graceTime
+}
+
+func (a *ActivityHandler) touch(t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t.After(a.lastActive) {
+		a.lastActive = t
+	}
+}
+
+func (a *ActivityHandler) hasRunningProcesses() bool {
+	if a.ProcessTracker == nil {
+		return false
+	}
+
+	return len(a.ProcessTracker.ActiveProcesses()) > 0
+}
+
+func (a *ActivityHandler) hasConnections() bool {
+	a.mu.Lock()
+	ip := a.ContainerIP
+	a.mu.Unlock()
+
+	if a.Connections == nil || ip == "" {
+		return false
+	}
+
+	active, err := a.Connections.HasConnections(ip)
+	return err == nil && active
+}
+
+func (a *ActivityHandler) setContainerIP(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.ContainerIP = ip
+}
+
+// ConntrackTable finds established connections to or from a container by
+// scanning the kernel's connection tracking table.
+type ConntrackTable struct {
+	Path string
+}
+
+func (t *ConntrackTable) HasConnections(ip string) (bool, error) {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	src, dst := "src="+ip+" ", "dst="+ip+" "
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "ESTABLISHED") {
+			continue
+		}
+
+		if strings.Contains(line, src) || strings.Contains(line, dst) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
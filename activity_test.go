@@ -0,0 +1,118 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/fake_process_tracker"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Activity", func() {
+	var activity *ActivityHandler
+	var fakeProcessTracker *fake_process_tracker.FakeProcessTracker
+	var fakeConnections *fakes.FakeConnectionTracker
+
+	BeforeEach(func() {
+		fakeProcessTracker = new(fake_process_tracker.FakeProcessTracker)
+		fakeConnections = new(fakes.FakeConnectionTracker)
+
+		activity = &ActivityHandler{
+			GraceTime:      time.Minute,
+			ContainerIP:    "1.2.3.4",
+			ProcessTracker: fakeProcessTracker,
+			Connections:    fakeConnections,
+		}
+
+		activity.Touch()
+	})
+
+	Describe("Idle", func() {
+		It("is not idle before the grace time has elapsed", func() {
+			Expect(activity.Idle(time.Now().Add(30 * time.Second))).To(BeFalse())
+		})
+
+		It("is idle once the grace time has elapsed", func() {
+			Expect(activity.Idle(time.Now().Add(2 * time.Minute))).To(BeTrue())
+		})
+
+		Context("when the grace time is zero", func() {
+			It("is never idle", func() {
+				activity.GraceTime = 0
+				Expect(activity.Idle(time.Now().Add(time.Hour))).To(BeFalse())
+			})
+		})
+
+		Context("when processes are running", func() {
+			BeforeEach(func() {
+				fakeProcessTracker.ActiveProcessesReturns([]garden.Process{nil})
+			})
+
+			It("is not idle, and the idle timer is reset", func() {
+				later := time.Now().Add(2 * time.Minute)
+				Expect(activity.Idle(later)).To(BeFalse())
+				Expect(activity.LastActive()).To(Equal(later))
+			})
+		})
+
+		Context("when the container has open connections", func() {
+			BeforeEach(func() {
+				fakeConnections.HasConnectionsReturns(true, nil)
+			})
+
+			It("is not idle", func() {
+				Expect(activity.Idle(time.Now().Add(2 * time.Minute))).To(BeFalse())
+				Expect(fakeConnections.HasConnectionsArgsForCall(0)).To(Equal("1.2.3.4"))
+			})
+		})
+
+		Context("when checking for connections fails", func() {
+			BeforeEach(func() {
+				fakeConnections.HasConnectionsReturns(true, errors.New("no conntrack"))
+			})
+
+			It("falls back to the last activity time", func() {
+				Expect(activity.Idle(time.Now().Add(2 * time.Minute))).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("ConntrackTable", func() {
+		var table *ConntrackTable
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "conntrack")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			f.WriteString("ipv4 2 tcp 6 431999 ESTABLISHED src=10.0.0.1 dst=172.17.0.5 sport=5555 dport=8080 src=172.17.0.5 dst=10.0.0.1 sport=8080 dport=5555 [ASSURED] mark=0 use=1\n")
+			f.WriteString("ipv4 2 tcp 6 119 TIME_WAIT src=10.0.0.1 dst=172.17.0.6 sport=5556 dport=8080 src=172.17.0.6 dst=10.0.0.1 sport=8080 dport=5556 [ASSURED] mark=0 use=1\n")
+
+			table = &ConntrackTable{Path: f.Name()}
+		})
+
+		AfterEach(func() {
+			os.Remove(table.Path)
+		})
+
+		It("finds established connections to the ip", func() {
+			Expect(table.HasConnections("172.17.0.5")).To(BeTrue())
+		})
+
+		It("ignores connections which are not established", func() {
+			Expect(table.HasConnections("172.17.0.6")).To(BeFalse())
+		})
+
+		It("does not match ip prefixes", func() {
+			Expect(table.HasConnections("172.17.0.50")).To(BeFalse())
+			Expect(table.HasConnections("10.0.0.")).To(BeFalse())
+		})
+	})
+})
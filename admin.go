@@ -0,0 +1,325 @@
+package gardendocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/pivotal-golang/lager"
+)
+
+// BulkDestroyProgress is reported once for each container destroyed (or
+// which failed to be destroyed) by BulkDestroy.
+type BulkDestroyProgress struct {
+	Handle string `json:"handle"`
+	Error  string `json:"error,omitempty"`
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+}
+
+type BulkDestroyReport struct {
+	Matched   int               `json:"matched"`
+	Destroyed []string          `json:"destroyed"`
+	Failed    map[string]string `json:"failed"`
+}
+
+// BulkDestroy destroys every container matching the given properties, using
+// up to concurrency destroys at a time. progress, if not nil, is called
+// (serially) as each container finishes.
+func (b *Backend) BulkDestroy(props garden.Properties, concurrency int, progress func(BulkDestroyProgress)) BulkDestroyReport {
+	containers := b.Repo.FindByProperties(props)
+
+	report := BulkDestroyReport{
+		Matched:   len(containers),
+		Destroyed: []string{},
+		Failed:    map[string]string{},
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	handles := make(chan string)
+	go func() {
+		for _, container := range containers {
+			handles <- container.Handle()
+		}
+		close(handles)
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for handle := range handles {
+				err := b.Destroy(handle)
+
+				mu.Lock()
+				p := BulkDestroyProgress{Handle: handle, Total: report.Matched}
+				if err != nil {
+					p.Error = err.Error()
+					report.Failed[handle] = err.Error()
+				} else {
+					report.Destroyed = append(report.Destroyed, handle)
+				}
+				p.Done = len(report.Destroyed) + len(report.Failed)
+
+				if progress != nil {
+					progress(p)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return report
+}
+
+//go:generate counterfeiter . ContainerLogs
+type ContainerLogs interface {
+	Logs(container *Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error
+}
+
+// AdminHandler serves operator-only operations which are not part of the
+// garden API. It should only be served on a private address.
+//
+//	POST /containers/destroy {"properties": {"tenant": "some-tenant"}}
+//
+// destroys every container matching the given properties. Progress is
+// streamed as one JSON object per line per container, followed by a final
+// line holding the BulkDestroyReport.
+//
+//	POST /containers/adopt {"docker_id": "some-id", "handle": "some-handle", "properties": {...}}
+//
+// adopts a running docker container created by other tooling, exposing it
+// through the garden API under the given handle (or its docker name).
+//
+//	GET /containers/<handle>/logs?follow=true&tail=100
+//
+// streams the stdout and stderr docker captured from the container's init
+// process, interleaved, and keeps streaming new output while follow is set
+// until the client goes away.
+//
+//	GET /events?handle=some-handle
+//
+// streams container events, such as containers being created, destroyed or
+// reaped and processes exiting, as server-sent events named by their kind,
+// until the client goes away. The handle, if given, picks out one
+// container's events.
+type AdminHandler struct {
+	Backend     *Backend
+	Concurrency int
+	Logs        ContainerLogs
+
+	Logger lager.Logger
+}
+
+type bulkDestroyRequest struct {
+	Properties garden.Properties `json:"properties"`
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/containers/destroy":
+		h.bulkDestroy(w, r)
+	case r.URL.Path == "/containers/adopt":
+		h.adopt(w, r)
+	case r.URL.Path == "/events":
+		h.events(w, r)
+	case strings.HasPrefix(r.URL.Path, "/containers/") && strings.HasSuffix(r.URL.Path, "/logs"):
+		h.logs(w, r, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/logs"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *AdminHandler) bulkDestroy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req bulkDestroyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Properties) == 0 {
+		http.Error(w, "invalid request: refusing to destroy every container, specify some properties", http.StatusBadRequest)
+		return
+	}
+
+	log := h.Logger.Session("bulk-destroy", lager.Data{"properties": req.Properties})
+	log.Info("started")
+
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	report := h.Backend.BulkDestroy(req.Properties, h.Concurrency, func(p BulkDestroyProgress) {
+		enc.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+
+	enc.Encode(report)
+	log.Info("finished", lager.Data{
+		"matched":   report.Matched,
+		"destroyed": len(report.Destroyed),
+		"failed":    len(report.Failed),
+	})
+}
+
+type adoptRequest struct {
+	DockerID   string            `json:"docker_id"`
+	Handle     string            `json:"handle"`
+	Properties garden.Properties `json:"properties"`
+}
+
+type adoptResponse struct {
+	Handle string `json:"handle"`
+}
+
+func (h *AdminHandler) adopt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.Backend.Adopter == nil {
+		http.Error(w, "adopting containers is not available", http.StatusNotImplemented)
+		return
+	}
+
+	var req adoptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.DockerID == "" {
+		http.Error(w, "invalid request: no docker_id given", http.StatusBadRequest)
+		return
+	}
+
+	log := h.Logger.Session("adopt", lager.Data{"docker-id": req.DockerID, "handle": req.Handle})
+
+	container, err := h.Backend.Adopt(req.DockerID, req.Handle, req.Properties)
+	if err != nil {
+		log.Error("failed", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("adopted", lager.Data{"handle": container.Handle()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adoptResponse{Handle: container.Handle()})
+}
+
+func (h *AdminHandler) logs(w http.ResponseWriter, r *http.Request, handle string) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.Logs == nil {
+		http.Error(w, "container logs are not available", http.StatusNotImplemented)
+		return
+	}
+
+	container, err := h.Backend.Repo.FindByHandle(handle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	follow := r.URL.Query().Get("follow") == "true"
+	tail := r.URL.Query().Get("tail")
+
+	log := h.Logger.Session("logs", lager.Data{"handle": handle, "follow": follow, "tail": tail})
+
+	w.Header().Set("Content-Type", "text/plain")
+	if err := h.Logs.Logs(container, follow, tail, &flushWriter{w: w}, r.Context().Done()); err != nil {
+		log.Error("failed", err)
+	}
+}
+
+func (h *AdminHandler) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.Backend.Events == nil {
+		http.Error(w, "container events are not available", http.StatusNotImplemented)
+		return
+	}
+
+	events, unsubscribe := h.Backend.Events.Subscribe()
+	defer unsubscribe()
+
+	handle := r.URL.Query().Get("handle")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if handle != "" && event.Handle != handle {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// flushWriter flushes every write through to the client, so that followed
+// logs arrive as they are produced.
+type flushWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return n, err
+}
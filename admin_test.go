@@ -0,0 +1,274 @@
+package gardendocker_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Bulk destroy", func() {
+	var backend *gardendocker.Backend
+	var repo gardendocker.Repo
+	var fakeDestroyer *fakes.FakeDestroyer
+
+	newTenantContainer := func(handle, tenant string) *gardendocker.Container {
+		return &gardendocker.Container{
+			InfoHandler: &gardendocker.InfoHandler{
+				Spec:         garden.ContainerSpec{Handle: handle},
+				PropsHandler: gardendocker.NewPropsHandler(garden.Properties{"tenant": tenant}),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		repo = gardendocker.NewRepo()
+		fakeDestroyer = new(fakes.FakeDestroyer)
+		backend = &gardendocker.Backend{
+			Repo:      repo,
+			Destroyer: fakeDestroyer,
+			Logger:    lagertest.NewTestLogger("backend"),
+		}
+
+		repo.Add(newTenantContainer("a1", "a"))
+		repo.Add(newTenantContainer("a2", "a"))
+		repo.Add(newTenantContainer("a3", "a"))
+		repo.Add(newTenantContainer("b1", "b"))
+	})
+
+	Describe("Backend.BulkDestroy", func() {
+		It("destroys every matching container", func() {
+			report := backend.BulkDestroy(garden.Properties{"tenant": "a"}, 2, nil)
+
+			Expect(report.Matched).To(Equal(3))
+			Expect(report.Destroyed).To(ConsistOf("a1", "a2", "a3"))
+			Expect(report.Failed).To(BeEmpty())
+
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(3))
+			Expect(repo.All()).To(HaveLen(1))
+			Expect(repo.FindByHandle("b1")).NotTo(BeNil())
+		})
+
+		It("reports progress for each container", func() {
+			var mu sync.Mutex
+			var progress []gardendocker.BulkDestroyProgress
+			backend.BulkDestroy(garden.Properties{"tenant": "a"}, 2, func(p gardendocker.BulkDestroyProgress) {
+				mu.Lock()
+				defer mu.Unlock()
+				progress = append(progress, p)
+			})
+
+			Expect(progress).To(HaveLen(3))
+			for i, p := range progress {
+				Expect(p.Done).To(Equal(i + 1))
+				Expect(p.Total).To(Equal(3))
+			}
+		})
+
+		Context("when destroying a container fails", func() {
+			BeforeEach(func() {
+				fakeDestroyer.DestroyStub = func(c *gardendocker.Container) error {
+					if c.Handle() == "a2" {
+						return errors.New("boom")
+					}
+
+					return nil
+				}
+			})
+
+			It("carries on with the others and reports the failure", func() {
+				report := backend.BulkDestroy(garden.Properties{"tenant": "a"}, 1, nil)
+
+				Expect(report.Destroyed).To(ConsistOf("a1", "a3"))
+				Expect(report.Failed).To(Equal(map[string]string{"a2": "boom"}))
+			})
+		})
+	})
+
+	Describe("AdminHandler", func() {
+		var server *httptest.Server
+		var logs *fakes.FakeContainerLogs
+
+		BeforeEach(func() {
+			logs = new(fakes.FakeContainerLogs)
+			server = httptest.NewServer(&gardendocker.AdminHandler{
+				Backend:     backend,
+				Concurrency: 2,
+				Logs:        logs,
+				Logger:      lagertest.NewTestLogger("admin"),
+			})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("streams progress followed by the final report", func() {
+			resp, err := http.Post(server.URL+"/containers/destroy", "application/json", strings.NewReader(`{"properties":{"tenant":"a"}}`))
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			dec := json.NewDecoder(resp.Body)
+			for i := 0; i < 3; i++ {
+				var p gardendocker.BulkDestroyProgress
+				Expect(dec.Decode(&p)).To(Succeed())
+				Expect(p.Total).To(Equal(3))
+			}
+
+			var report gardendocker.BulkDestroyReport
+			Expect(dec.Decode(&report)).To(Succeed())
+			Expect(report.Destroyed).To(ConsistOf("a1", "a2", "a3"))
+		})
+
+		It("refuses to destroy everything when no properties are given", func() {
+			resp, err := http.Post(server.URL+"/containers/destroy", "application/json", strings.NewReader(`{}`))
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+		})
+
+		It("only accepts POST", func() {
+			resp, err := http.Get(server.URL + "/containers/destroy")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		})
+
+		Describe("adopt", func() {
+			var adopter *fakes.FakeAdopter
+
+			BeforeEach(func() {
+				adopter = new(fakes.FakeAdopter)
+				adopter.AdoptStub = func(dockerID, handle string, props garden.Properties, _ func(dockerID, handle string) error) (*gardendocker.Container, error) {
+					container := newTenantContainer(handle, props["tenant"])
+					container.ActivityHandler = &gardendocker.ActivityHandler{}
+					return container, nil
+				}
+				backend.Adopter = adopter
+			})
+
+			It("adopts the docker container and returns its handle", func() {
+				resp, err := http.Post(server.URL+"/containers/adopt", "application/json", strings.NewReader(`{"docker_id":"some-id","handle":"adoptee","properties":{"tenant":"c"}}`))
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				var body map[string]string
+				Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(Equal(map[string]string{"handle": "adoptee"}))
+
+				dockerID, handle, props, _ := adopter.AdoptArgsForCall(0)
+				Expect(dockerID).To(Equal("some-id"))
+				Expect(handle).To(Equal("adoptee"))
+				Expect(props).To(Equal(garden.Properties{"tenant": "c"}))
+				Expect(repo.FindByHandle("adoptee")).NotTo(BeNil())
+			})
+
+			It("requires a docker id", func() {
+				resp, err := http.Post(server.URL+"/containers/adopt", "application/json", strings.NewReader(`{"handle":"adoptee"}`))
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+				Expect(adopter.AdoptCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("container logs", func() {
+			It("streams the container's logs", func() {
+				logs.LogsStub = func(container *gardendocker.Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error {
+					w.Write([]byte("some output\n"))
+					return nil
+				}
+
+				resp, err := http.Get(server.URL + "/containers/a1/logs?follow=true&tail=10")
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(ioutil.ReadAll(resp.Body)).To(Equal([]byte("some output\n")))
+
+				container, follow, tail, _, _ := logs.LogsArgsForCall(0)
+				Expect(container.Handle()).To(Equal("a1"))
+				Expect(follow).To(BeTrue())
+				Expect(tail).To(Equal("10"))
+			})
+
+			It("stops following when the client goes away", func() {
+				stopped := make(chan struct{})
+				logs.LogsStub = func(container *gardendocker.Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error {
+					w.Write([]byte("first line\n"))
+					<-stop
+					close(stopped)
+					return nil
+				}
+
+				resp, err := http.Get(server.URL + "/containers/a1/logs?follow=true")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(bufio.NewReader(resp.Body).ReadString('\n')).To(Equal("first line\n"))
+				resp.Body.Close()
+
+				Eventually(stopped).Should(BeClosed())
+			})
+
+			It("returns 404 for an unknown container", func() {
+				resp, err := http.Get(server.URL + "/containers/nope/logs")
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+				Expect(logs.LogsCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("events", func() {
+			It("streams the events of the given container as server-sent events", func() {
+				backend.Events = gardendocker.NewEventBus()
+
+				resp, err := http.Get(server.URL + "/events?handle=a1")
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+				Expect(backend.Destroy("b1")).To(Succeed())
+				Expect(backend.Destroy("a1")).To(Succeed())
+
+				reader := bufio.NewReader(resp.Body)
+				Expect(reader.ReadString('\n')).To(Equal("event: destroyed\n"))
+
+				data, err := reader.ReadString('\n')
+				Expect(err).NotTo(HaveOccurred())
+
+				var event gardendocker.Event
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &event)).To(Succeed())
+				Expect(event.Kind).To(Equal(gardendocker.EventDestroyed))
+				Expect(event.Handle).To(Equal("a1"))
+			})
+
+			It("is not available without an event bus", func() {
+				resp, err := http.Get(server.URL + "/events")
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusNotImplemented))
+			})
+		})
+	})
+})
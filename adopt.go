@@ -0,0 +1,281 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// AdoptedProperty is set to "true" on containers which were adopted from
+// docker rather than created by garden-docker.
+const AdoptedProperty = "garden-docker.adopted"
+
+// Where initd is copied to, and listens, inside an adopted container. The
+// container has no bind mount of the depot's run directory, so the host
+// reaches the socket through the container's root in /proc.
+const (
+	adoptedInitdPath = "/tmp/garden-initd"
+	adoptedInitdSock = "/tmp/garden-initd.sock"
+)
+
+//go:generate counterfeiter . Adopter
+type Adopter interface {
+	// Adopt calls claim with the docker container's full id and the handle
+	// it is to have before changing anything, and gives up if claim fails.
+	Adopt(dockerID, handle string, props garden.Properties, claim func(dockerID, handle string) error) (*Container, error)
+}
+
+// Adopt brings a running docker container which garden-docker did not create
+// under garden's management, so that it can be used through the garden API
+// like any other container. It is exposed under handle, or the docker
+// container's name if handle is empty. Destroying it removes the docker
+// container.
+//
+// Adopted containers count against MaxContainers, and none can be adopted
+// while draining. A docker container which is already a garden container,
+// or whose handle is taken, is refused, even if another adoption of it is
+// still in progress.
+func (b *Backend) Adopt(dockerID, handle string, props garden.Properties) (garden.Container, error) {
+	if b.isDraining() {
+		return nil, ErrDraining
+	}
+
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	defer b.admitted()
+
+	var claimedID, claimedHandle string
+	defer func() {
+		if claimedID != "" {
+			b.unclaim(claimedID, claimedHandle)
+		}
+	}()
+
+	container, err := b.Adopter.Adopt(dockerID, handle, props, func(dockerID, handle string) error {
+		if err := b.claim(dockerID, handle); err != nil {
+			return err
+		}
+
+		claimedID, claimedHandle = dockerID, handle
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	container.Touch()
+	b.Repo.Add(container)
+
+	return container, nil
+}
+
+// claim reserves a docker container and handle for an adoption until it is
+// in the repo, unless a container in the repo, or another adoption, already
+// has either.
+func (b *Backend) claim(dockerID, handle string) error {
+	b.admitMu.Lock()
+	defer b.admitMu.Unlock()
+
+	if _, err := b.Repo.FindByHandle(handle); err == nil || b.adoptingHandles[handle] {
+		return fmt.Errorf("adopt: handle already exists: %s", handle)
+	}
+
+	adopted := b.Repo.Query(func(c *Container) bool { return c.DockerID == dockerID })
+	if len(adopted) > 0 || b.adoptingIDs[dockerID] {
+		return fmt.Errorf("adopt: docker container %s already belongs to a garden container", dockerID)
+	}
+
+	if b.adoptingIDs == nil {
+		b.adoptingIDs = make(map[string]bool)
+		b.adoptingHandles = make(map[string]bool)
+	}
+
+	b.adoptingIDs[dockerID] = true
+	b.adoptingHandles[handle] = true
+	return nil
+}
+
+func (b *Backend) unclaim(dockerID, handle string) {
+	b.admitMu.Lock()
+	defer b.admitMu.Unlock()
+
+	delete(b.adoptingIDs, dockerID)
+	delete(b.adoptingHandles, handle)
+}
+
+// Adopt injects initd into a running docker container by copying it in and
+// starting it with docker exec, and returns a garden container for it. If it
+// fails part way, whatever it had set up by then is undone in reverse order,
+// leaving the docker container as it found it.
+func (c *DaemonContainerCreator) Adopt(dockerID, handle string, props garden.Properties, claim func(dockerID, handle string) error) (container *Container, err error) {
+	info, err := c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: dockerID})
+	if err != nil {
+		return nil, fmt.Errorf("adopt: inspect %s: %s", dockerID, err)
+	}
+
+	if !info.State.Running {
+		return nil, fmt.Errorf("adopt: docker container %s is not running", dockerID)
+	}
+
+	if handle == "" {
+		handle = strings.TrimPrefix(info.Name, "/")
+	}
+
+	if err := claim(info.ID, handle); err != nil {
+		return nil, err
+	}
+
+	dir, err := c.Depot.Create()
+	if err != nil {
+		return nil, fmt.Errorf("adopt: create depot dir: %s", err)
+	}
+
+	var undo []func()
+	defer func() {
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+
+	undo = append(undo, func() { c.Depot.Destroy(dir) })
+
+	// initd may be running even if waiting for it to listen failed
+	undo = append(undo, func() { stopInjectedInitd(info) })
+	if err := c.injectInitd(info, dir); err != nil {
+		return nil, fmt.Errorf("adopt: %s", err)
+	}
+
+	if c.Networker != nil {
+		undo = append(undo, func() {
+			c.Networker.Down(NetworkContainer{Handle: handle, DockerID: info.ID})
+		})
+	}
+
+	ip, err := c.networkUp(handle, info, c.dockerIP(info, ""))
+	if err != nil {
+		return nil, fmt.Errorf("adopt: %s", err)
+	}
+
+	if c.Firewall != nil {
+		if err := c.Firewall.Setup(info.ID, ip); err != nil {
+			return nil, fmt.Errorf("adopt: firewall: %s", err)
+		}
+
+		undo = append(undo, func() { c.Firewall.Teardown(info.ID, ip) })
+	}
+
+	ipv6 := info.GlobalIPv6Address(c.DockerNetwork)
+	if c.Firewall6 != nil && ipv6 != "" {
+		if err := c.Firewall6.Setup(info.ID, ipv6); err != nil {
+			return nil, fmt.Errorf("adopt: firewall: %s", err)
+		}
+
+		undo = append(undo, func() { c.Firewall6.Teardown(info.ID, ipv6) })
+	}
+
+	properties := garden.Properties{}
+	for k, v := range props {
+		properties[k] = v
+	}
+	properties[AdoptedProperty] = "true"
+
+	spec := garden.ContainerSpec{
+		Handle:     handle,
+		RootFSPath: DockerScheme + ":///" + info.Config.Image,
+		Env:        info.Config.Env,
+		Properties: properties,
+	}
+
+	container = c.newContainer(spec, dir, info.ID, ip, ipv6, DiskLimitScopeTotal, info.Config.Labels)
+	container.ImageID = info.Image
+	if err := container.SaveProperties(); err != nil {
+		return nil, fmt.Errorf("adopt: save properties: %s", err)
+	}
+
+	if err := container.SaveMetadata(); err != nil {
+		return nil, fmt.Errorf("adopt: %s", err)
+	}
+
+	// containers docker gave an address in the pool's subnet hold it until
+	// they are destroyed, like those garden-docker created
+	c.reserveIPs(container)
+	return container, nil
+}
+
+// injectInitd copies initd into an adopted container and starts it, then
+// links the socket it listens on into the depot directory, where dosh
+// expects it, and waits for it to listen.
+func (c *DaemonContainerCreator) injectInitd(info dockercli.ContainerJSON, dir string) error {
+	image, err := c.imageInfo(c.DockerRunner, info.Image)
+	if err != nil {
+		return err
+	}
+
+	initdPath, err := c.initdFor(image)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.DockerRunner.Cp(dockercli.CpCmd{
+		Src: initdPath,
+		Dst: info.ID + ":" + adoptedInitdPath,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := c.DockerRunner.Exec(dockercli.ExecCmd{
+		ContainerID: info.ID,
+		Detach:      true,
+		Program:     adoptedInitdPath,
+		ProgramArgs: []string{"-socketPath", adoptedInitdSock, "-daemonUID", strconv.Itoa(os.Getuid())},
+	}); err != nil {
+		return err
+	}
+
+	link := filepath.Join(dir, "run", "initd.sock")
+	os.Remove(link)
+
+	target := fmt.Sprintf("/proc/%d/root%s", info.State.Pid, adoptedInitdSock)
+	if err := os.Symlink(target, link); err != nil {
+		return fmt.Errorf("link initd socket: %s", err)
+	}
+
+	return waitForSocket(link, c.InitdTimeout)
+}
+
+// stopInjectedInitd kills the initd injectInitd started in an adopted
+// container, if it is running. It is found among the processes in the
+// container's pid namespace by the path it was started from.
+func stopInjectedInitd(info dockercli.ContainerJSON) {
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", info.State.Pid))
+	if err != nil {
+		return
+	}
+
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		if pidNS, err := os.Readlink(filepath.Join(dir, "ns", "pid")); err != nil || pidNS != ns {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || !bytes.HasPrefix(cmdline, []byte(adoptedInitdPath+"\x00")) {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(filepath.Base(dir)); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
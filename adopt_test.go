@@ -0,0 +1,338 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Adopting docker containers", func() {
+	Describe("DaemonContainerCreator.Adopt", func() {
+		var (
+			creator      *DaemonContainerCreator
+			dockerRunner *fakes.FakeDockerRunner
+			depot        *fakes.FakeDepot
+			depotDir     string
+			listener     net.Listener
+
+			claimed [][2]string
+			claim   func(dockerID, handle string) error
+		)
+
+		// with the pid of this process, /proc/<pid>/root is /, so initd's
+		// socket inside the "container" is at the same path on the host
+		const initdSock = "/tmp/garden-initd.sock"
+
+		BeforeEach(func() {
+			var err error
+			depotDir, err = ioutil.TempDir("", "adopt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(depotDir, "run"), 0700)).To(Succeed())
+
+			depot = new(fakes.FakeDepot)
+			depot.CreateReturns(depotDir, nil)
+
+			dockerRunner = new(fakes.FakeDockerRunner)
+			dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+				var info dockercli.ContainerJSON
+				info.ID = "full-docker-id"
+				info.Name = "/some-name"
+				info.State.Running = true
+				info.State.Pid = os.Getpid()
+				info.Config.Image = "some-image"
+				info.NetworkSettings.IPAddress = "1.2.3.4"
+				return info, nil
+			}
+
+			dockerRunner.ExecStub = func(cmd dockercli.ExecCmd) (string, error) {
+				os.Remove(initdSock)
+
+				var err error
+				listener, err = net.Listen("unix", initdSock)
+				return "", err
+			}
+
+			claimed = nil
+			claim = func(dockerID, handle string) error {
+				claimed = append(claimed, [2]string{dockerID, handle})
+				return nil
+			}
+
+			creator = &DaemonContainerCreator{
+				Depot:        depot,
+				InitdPath:    "/path/to/initd",
+				DockerRunner: dockerRunner,
+				InitdTimeout: time.Second,
+			}
+		})
+
+		AfterEach(func() {
+			if listener != nil {
+				listener.Close()
+				listener = nil
+			}
+
+			os.RemoveAll(depotDir)
+		})
+
+		It("copies initd into the container and starts it with docker exec", func() {
+			_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dockerRunner.CpArgsForCall(0)).To(Equal(dockercli.CpCmd{
+				Src: "/path/to/initd",
+				Dst: "full-docker-id:/tmp/garden-initd",
+			}))
+
+			Expect(dockerRunner.ExecArgsForCall(0)).To(Equal(dockercli.ExecCmd{
+				ContainerID: "full-docker-id",
+				Detach:      true,
+				Program:     "/tmp/garden-initd",
+				ProgramArgs: []string{"-socketPath", "/tmp/garden-initd.sock", "-daemonUID", strconv.Itoa(os.Getuid())},
+			}))
+		})
+
+		It("links initd's socket into the depot directory, through the container's root", func() {
+			_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.Readlink(filepath.Join(depotDir, "run", "initd.sock"))).To(Equal(
+				filepath.Join("/proc", strconv.Itoa(os.Getpid()), "root", initdSock),
+			))
+		})
+
+		It("returns a container for the docker container, marked as adopted", func() {
+			container, err := creator.Adopt("some-id", "some-handle", garden.Properties{"a": "b"}, claim)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(container.Handle()).To(Equal("some-handle"))
+			Expect(container.DockerID).To(Equal("full-docker-id"))
+			Expect(container.InfoHandler.ContainerIP).To(Equal("1.2.3.4"))
+			Expect(container.Adopted()).To(BeTrue())
+			Expect(container.GetProperty("a")).To(Equal("b"))
+			Expect(container.Spec.RootFSPath).To(Equal("docker:///some-image"))
+		})
+
+		It("takes the container's IP out of the subnet pool, if it is in it", func() {
+			var err error
+			creator.IPPool, err = NewIPPool("1.2.3.0/29")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = creator.Adopt("some-id", "some-handle", nil, claim)
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < 4; i++ {
+				Expect(creator.IPPool.Acquire()).NotTo(Equal("1.2.3.4"))
+			}
+		})
+
+		It("claims the docker container's full id and the handle before touching it", func() {
+			_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(claimed).To(Equal([][2]string{{"full-docker-id", "some-handle"}}))
+		})
+
+		Context("when the claim is refused", func() {
+			It("returns its error without touching the docker container", func() {
+				claim = func(string, string) error { return errors.New("adopt: handle already exists: some-handle") }
+
+				_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+				Expect(err).To(MatchError("adopt: handle already exists: some-handle"))
+				Expect(depot.CreateCallCount()).To(Equal(0))
+				Expect(dockerRunner.CpCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when setting up the firewall fails", func() {
+			var networker *fakes.FakeNetworker
+			var firewall, firewall6 *fakes.FakeFirewall
+
+			BeforeEach(func() {
+				networker = new(fakes.FakeNetworker)
+				firewall = new(fakes.FakeFirewall)
+				firewall6 = new(fakes.FakeFirewall)
+				firewall6.SetupReturns(errors.New("no chains left"))
+
+				creator.Networker = networker
+				creator.Firewall = firewall
+				creator.Firewall6 = firewall6
+
+				dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+					var info dockercli.ContainerJSON
+					info.ID = "full-docker-id"
+					info.State.Running = true
+					info.State.Pid = os.Getpid()
+					info.NetworkSettings.IPAddress = "1.2.3.4"
+					info.NetworkSettings.GlobalIPv6Address = "fd00::2"
+					return info, nil
+				}
+			})
+
+			It("undoes everything it had set up", func() {
+				_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+				Expect(err).To(MatchError("adopt: firewall: no chains left"))
+
+				Expect(firewall.TeardownCallCount()).To(Equal(1))
+				id, ip := firewall.TeardownArgsForCall(0)
+				Expect(id).To(Equal("full-docker-id"))
+				Expect(ip).To(Equal("1.2.3.4"))
+
+				Expect(networker.DownCallCount()).To(Equal(1))
+				Expect(networker.DownArgsForCall(0)).To(Equal(NetworkContainer{Handle: "some-handle", DockerID: "full-docker-id"}))
+
+				Expect(depot.DestroyArgsForCall(0)).To(Equal(depotDir))
+			})
+		})
+
+		Context("when no handle is given", func() {
+			It("uses the docker container's name", func() {
+				container, err := creator.Adopt("some-id", "", nil, claim)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(container.Handle()).To(Equal("some-name"))
+			})
+		})
+
+		Context("when the docker container is not running", func() {
+			It("returns an error without touching it", func() {
+				dockerRunner.InspectReturns(dockercli.ContainerJSON{}, nil)
+
+				_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+				Expect(err).To(MatchError("adopt: docker container some-id is not running"))
+				Expect(dockerRunner.CpCallCount()).To(Equal(0))
+				Expect(depot.CreateCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when starting initd fails", func() {
+			It("removes the depot directory and returns an error", func() {
+				dockerRunner.ExecStub = nil
+				dockerRunner.ExecReturns("", errors.New("exec: no such file"))
+
+				_, err := creator.Adopt("some-id", "some-handle", nil, claim)
+				Expect(err).To(MatchError("adopt: exec: no such file"))
+				Expect(depot.DestroyArgsForCall(0)).To(Equal(depotDir))
+			})
+		})
+	})
+
+	Describe("Backend.Adopt", func() {
+		var backend *Backend
+		var adopter *fakes.FakeAdopter
+
+		BeforeEach(func() {
+			adopter = new(fakes.FakeAdopter)
+			adopter.AdoptStub = func(dockerID, handle string, _ garden.Properties, claim func(dockerID, handle string) error) (*Container, error) {
+				if err := claim(dockerID, handle); err != nil {
+					return nil, err
+				}
+
+				return &Container{
+					InfoHandler: &InfoHandler{
+						Spec:         garden.ContainerSpec{Handle: handle},
+						DockerID:     dockerID,
+						PropsHandler: NewPropsHandler(nil),
+					},
+					ActivityHandler: &ActivityHandler{},
+				}, nil
+			}
+
+			backend = &Backend{
+				Repo:    NewRepo(),
+				Adopter: adopter,
+				Logger:  lagertest.NewTestLogger("backend"),
+			}
+		})
+
+		It("adds the adopted container to the repo", func() {
+			container, err := backend.Adopt("some-id", "adopted", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(container.Handle()).To(Equal("adopted"))
+
+			Expect(backend.Repo.FindByHandle("adopted")).To(Equal(container))
+		})
+
+		Context("when the handle is taken", func() {
+			It("returns an error", func() {
+				backend.Adopt("some-id", "adopted", nil)
+
+				_, err := backend.Adopt("other-id", "adopted", nil)
+				Expect(err).To(MatchError("adopt: handle already exists: adopted"))
+			})
+		})
+
+		Context("when the docker container has already been adopted", func() {
+			It("returns an error", func() {
+				backend.Adopt("some-id", "adopted", nil)
+
+				_, err := backend.Adopt("some-id", "again", nil)
+				Expect(err).To(MatchError("adopt: docker container some-id already belongs to a garden container"))
+				_, err = backend.Repo.FindByHandle("again")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the docker container is still being adopted", func() {
+			It("refuses to adopt it again", func() {
+				var second error
+				adopter.AdoptStub = func(dockerID, handle string, _ garden.Properties, claim func(dockerID, handle string) error) (*Container, error) {
+					if err := claim(dockerID, handle); err != nil {
+						return nil, err
+					}
+
+					_, second = backend.Adopt(dockerID, "again", nil)
+					return nil, errors.New("boom")
+				}
+
+				backend.Adopt("some-id", "adopted", nil)
+				Expect(second).To(MatchError("adopt: docker container some-id already belongs to a garden container"))
+			})
+
+			It("lets it be adopted once that has failed", func() {
+				adopt := adopter.AdoptStub
+				adopter.AdoptStub = func(dockerID, handle string, props garden.Properties, claim func(dockerID, handle string) error) (*Container, error) {
+					Expect(claim(dockerID, handle)).To(Succeed())
+					return nil, errors.New("boom")
+				}
+				backend.Adopt("some-id", "adopted", nil)
+
+				adopter.AdoptStub = adopt
+				_, err := backend.Adopt("some-id", "adopted", nil)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when at the maximum number of containers", func() {
+			It("returns an error without adopting", func() {
+				backend.MaxContainers = 1
+				backend.Adopt("some-id", "adopted", nil)
+
+				_, err := backend.Adopt("other-id", "other", nil)
+				Expect(err).To(BeAssignableToTypeOf(ServiceUnavailableError{}))
+				Expect(adopter.AdoptCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when draining", func() {
+			It("returns ErrDraining without adopting", func() {
+				backend.Drain(0)
+
+				_, err := backend.Adopt("some-id", "adopted", nil)
+				Expect(err).To(Equal(ErrDraining))
+				Expect(adopter.AdoptCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// DefaultAppArmorProfile names the AppArmor profile garden-docker loads
+// itself and confines unprivileged containers with, unless told to use
+// another.
+const DefaultAppArmorProfile = "garden-docker-default"
+
+// defaultAppArmorProfile is docker's own docker-default profile under
+// another name: containers may do most things with their own files, but not
+// mount, write to most of /proc and /sys, or read the kernel's memory.
+// Processes initd spawns are in the container, so they are confined by it
+// too.
+const defaultAppArmorProfile = `#include <tunables/global>
+
+profile garden-docker-default flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  network,
+  capability,
+  file,
+  umount,
+
+  signal (receive) peer=unconfined,
+  signal (send,receive) peer=garden-docker-default,
+
+  deny @{PROC}/* w,
+  deny @{PROC}/{[^1-9],[^1-9][^0-9],[^1-9s][^0-9y][^0-9s],[^1-9][^0-9][^0-9][^0-9]*}/** w,
+  deny @{PROC}/sys/[^k]** w,
+  deny @{PROC}/sys/kernel/{?,??,[^s][^h][^m]**} w,
+  deny @{PROC}/sysrq-trigger rwklx,
+  deny @{PROC}/kcore rwklx,
+
+  deny mount,
+
+  deny /sys/[^f]*/** wklx,
+  deny /sys/f[^s]*/** wklx,
+  deny /sys/fs/[^c]*/** wklx,
+  deny /sys/fs/c[^g]*/** wklx,
+  deny /sys/fs/cg[^r]*/** wklx,
+  deny /sys/firmware/** rwklx,
+  deny /sys/kernel/security/** rwklx,
+
+  ptrace (trace,read) peer=garden-docker-default,
+}
+`
+
+// AppArmor loads and checks for AppArmor profiles on the host.
+type AppArmor struct {
+	CommandRunner command_runner.CommandRunner
+
+	// SysPath defaults to /sys, where the kernel reports whether AppArmor
+	// is enabled and which profiles are loaded.
+	SysPath string
+}
+
+// Enabled reports whether the kernel has AppArmor enabled.
+func (a *AppArmor) Enabled() bool {
+	enabled, err := ioutil.ReadFile(a.sys("module/apparmor/parameters/enabled"))
+	return err == nil && strings.TrimSpace(string(enabled)) == "Y"
+}
+
+// LoadDefault loads, or replaces, the DefaultAppArmorProfile.
+func (a *AppArmor) LoadDefault() error {
+	var out bytes.Buffer
+	cmd := exec.Command("apparmor_parser", "--replace")
+	cmd.Stdin = strings.NewReader(defaultAppArmorProfile)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := a.CommandRunner.Run(cmd); err != nil {
+		return fmt.Errorf("load apparmor profile: %s: %s", err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+// Loaded reports whether a profile with the given name is loaded.
+func (a *AppArmor) Loaded(name string) (bool, error) {
+	profiles, err := ioutil.ReadFile(a.sys("kernel/security/apparmor/profiles"))
+	if err != nil {
+		return false, fmt.Errorf("list apparmor profiles: %s", err)
+	}
+
+	// each line is "name (mode)"
+	for _, line := range strings.Split(string(profiles), "\n") {
+		if i := strings.LastIndex(line, " ("); i >= 0 && line[:i] == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AppArmor) sys(path string) string {
+	sysPath := a.SysPath
+	if sysPath == "" {
+		sysPath = "/sys"
+	}
+
+	return sysPath + "/" + path
+}
@@ -0,0 +1,103 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppArmor", func() {
+	var commandRunner *fake_command_runner.FakeCommandRunner
+	var sysPath string
+	var apparmor *AppArmor
+
+	BeforeEach(func() {
+		var err error
+		sysPath, err = ioutil.TempDir("", "sys")
+		Expect(err).NotTo(HaveOccurred())
+
+		commandRunner = fake_command_runner.New()
+		apparmor = &AppArmor{CommandRunner: commandRunner, SysPath: sysPath}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(sysPath)
+	})
+
+	writeSys := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(sysPath, path)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(sysPath, path), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Enabled", func() {
+		It("is true when the kernel says apparmor is enabled", func() {
+			writeSys("module/apparmor/parameters/enabled", "Y\n")
+			Expect(apparmor.Enabled()).To(BeTrue())
+		})
+
+		It("is false when the kernel says it is not", func() {
+			writeSys("module/apparmor/parameters/enabled", "N\n")
+			Expect(apparmor.Enabled()).To(BeFalse())
+		})
+
+		It("is false when the kernel has no apparmor", func() {
+			Expect(apparmor.Enabled()).To(BeFalse())
+		})
+	})
+
+	Describe("LoadDefault", func() {
+		It("replaces the default profile with apparmor_parser", func() {
+			var profile []byte
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "apparmor_parser"}, func(cmd *exec.Cmd) error {
+				var err error
+				profile, err = ioutil.ReadAll(cmd.Stdin)
+				return err
+			})
+
+			Expect(apparmor.LoadDefault()).To(Succeed())
+			Expect(commandRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "apparmor_parser",
+				Args: []string{"--replace"},
+			}))
+			Expect(string(profile)).To(ContainSubstring("profile " + DefaultAppArmorProfile + " "))
+		})
+
+		It("returns apparmor_parser's output when it fails", func() {
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "apparmor_parser"}, func(cmd *exec.Cmd) error {
+				cmd.Stderr.Write([]byte("syntax error"))
+				return errors.New("exit status 1")
+			})
+
+			Expect(apparmor.LoadDefault()).To(MatchError(ContainSubstring("syntax error")))
+		})
+	})
+
+	Describe("Loaded", func() {
+		BeforeEach(func() {
+			writeSys("kernel/security/apparmor/profiles", "docker-default (enforce)\n/usr/sbin/tcpdump (enforce)\n")
+		})
+
+		It("is true for a loaded profile", func() {
+			Expect(apparmor.Loaded("docker-default")).To(BeTrue())
+		})
+
+		It("is false for any other", func() {
+			Expect(apparmor.Loaded("docker")).To(BeFalse())
+		})
+
+		It("fails when the profiles cannot be listed", func() {
+			os.RemoveAll(sysPath)
+			_, err := apparmor.Loaded("docker-default")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package gardendocker
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// LoadInitdArchPaths finds the initd binaries in dir which were built for
+// other architectures. They are named initd-<GOARCH>, e.g. initd-arm64.
+func LoadInitdArchPaths(dir string) (map[string]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "initd-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no initd-<arch> binaries in %s", dir)
+	}
+
+	paths := make(map[string]string)
+	for _, match := range matches {
+		paths[strings.TrimPrefix(filepath.Base(match), "initd-")] = match
+	}
+
+	return paths, nil
+}
+
+// imageInfo inspects an image, pulling it first if it has not been pulled
+// yet, as docker run would.
+func (c *DaemonContainerCreator) imageInfo(docker DockerRunner, image string) (dockercli.ImageJSON, error) {
+	info, err := docker.ImageInspect(dockercli.ImageInspectCmd{Image: image})
+	if err == nil {
+		return info, nil
+	}
+
+	if err := c.pull(docker, dockercli.PullCmd{Image: image}); err != nil {
+		return dockercli.ImageJSON{}, err
+	}
+
+	if info, err = docker.ImageInspect(dockercli.ImageInspectCmd{Image: image}); err != nil {
+		return dockercli.ImageJSON{}, fmt.Errorf("inspect image %s: %w", image, err)
+	}
+
+	return info, nil
+}
+
+// initdFor returns the initd binary to run in a container of the given
+// image: the one in InitdArchPaths for the image's architecture, or else
+// InitdPath, which is built for the host.
+func (c *DaemonContainerCreator) initdFor(info dockercli.ImageJSON) (string, error) {
+	if len(c.InitdArchPaths) == 0 {
+		return c.InitdPath, nil
+	}
+
+	if path, ok := c.InitdArchPaths[info.Architecture]; ok {
+		return path, nil
+	}
+
+	if info.Architecture == "" || info.Architecture == runtime.GOARCH {
+		return c.InitdPath, nil
+	}
+
+	return "", fmt.Errorf("no initd for %s images", info.Architecture)
+}
@@ -0,0 +1,146 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Initd architectures", func() {
+	Describe("LoadInitdArchPaths", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "initd-arch")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("finds the initd binary for each architecture", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "initd-arm64"), nil, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "initd-amd64"), nil, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "README"), nil, 0644)).To(Succeed())
+
+			Expect(LoadInitdArchPaths(dir)).To(Equal(map[string]string{
+				"arm64": filepath.Join(dir, "initd-arm64"),
+				"amd64": filepath.Join(dir, "initd-amd64"),
+			}))
+		})
+
+		It("fails if there are none", func() {
+			_, err := LoadInitdArchPaths(dir)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("creating a container", func() {
+		var creator *DaemonContainerCreator
+		var dockerRunner *fakes.FakeDockerRunner
+		var createError error
+		var depotDir string
+
+		BeforeEach(func() {
+			var err error
+			depotDir, err = ioutil.TempDir("", "depot")
+			Expect(err).NotTo(HaveOccurred())
+
+			dockerRunner = new(fakes.FakeDockerRunner)
+			depot := new(fakes.FakeDepot)
+			depot.CreateReturns(depotDir, nil)
+
+			creator = &DaemonContainerCreator{
+				Depot:          depot,
+				InitdPath:      "host/initd",
+				InitdArchPaths: map[string]string{"arm64": "arm/initd"},
+				DockerRunner:   dockerRunner,
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(depotDir)
+		})
+
+		JustBeforeEach(func() {
+			_, createError = creator.Create(garden.ContainerSpec{RootFSPath: "docker:///some-image"})
+		})
+
+		initdVolume := func() dockercli.Volume {
+			for _, v := range dockerRunner.RunArgsForCall(0).Volumes {
+				if v.ContainerPath == "/garden-bin/initd" {
+					return v
+				}
+			}
+
+			return dockercli.Volume{}
+		}
+
+		Context("when the image is for another architecture with an initd", func() {
+			BeforeEach(func() {
+				dockerRunner.ImageInspectReturns(dockercli.ImageJSON{Architecture: "arm64"}, nil)
+			})
+
+			It("mounts the initd for that architecture", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.ImageInspectArgsForCall(0)).To(Equal(dockercli.ImageInspectCmd{Image: "some-image"}))
+				Expect(initdVolume().HostPath).To(Equal("arm/initd"))
+			})
+		})
+
+		Context("when the image is for the host's architecture", func() {
+			BeforeEach(func() {
+				dockerRunner.ImageInspectReturns(dockercli.ImageJSON{Architecture: runtime.GOARCH}, nil)
+				creator.InitdArchPaths = map[string]string{"some-other-arch": "other/initd"}
+			})
+
+			It("mounts the host's initd", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(initdVolume().HostPath).To(Equal("host/initd"))
+			})
+		})
+
+		Context("when there is no initd for the image's architecture", func() {
+			BeforeEach(func() {
+				dockerRunner.ImageInspectReturns(dockercli.ImageJSON{Architecture: "s390x-ish"}, nil)
+			})
+
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError("create: no initd for s390x-ish images"))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the image has not been pulled yet", func() {
+			BeforeEach(func() {
+				calls := 0
+				dockerRunner.ImageInspectStub = func(dockercli.ImageInspectCmd) (dockercli.ImageJSON, error) {
+					calls++
+					if calls == 1 {
+						return dockercli.ImageJSON{}, errors.New("no such image")
+					}
+
+					return dockercli.ImageJSON{Architecture: "arm64"}, nil
+				}
+			})
+
+			It("pulls it to find its architecture", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.PullArgsForCall(0)).To(Equal(dockercli.PullCmd{Image: "some-image"}))
+				Expect(initdVolume().HostPath).To(Equal("arm/initd"))
+			})
+		})
+	})
+})
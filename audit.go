@@ -0,0 +1,263 @@
+package gardendocker
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/routes"
+	"github.com/tedsuo/rata"
+)
+
+// auditedOperations are the garden API routes recorded in the audit log.
+var auditedOperations = map[string]bool{
+	routes.Create:   true,
+	routes.Destroy:  true,
+	routes.Run:      true,
+	routes.NetIn:    true,
+	routes.StreamIn: true,
+}
+
+// Outcomes of an AuditRecord.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+
+	// AuditUnknown is the outcome of an operation whose client went away
+	// before the server answered it.
+	AuditUnknown = "unknown"
+)
+
+// AuditRecord is a line of the audit log: an operation a client asked the
+// garden API for, and how it turned out.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Handle    string    `json:"handle,omitempty"`
+	Peer      AuditPeer `json:"peer"`
+	Status    int       `json:"status,omitempty"`
+	Outcome   string    `json:"outcome"`
+}
+
+// AuditPeer is who asked for an operation: the address it connected from
+// and, when known, the credentials of a process connecting over a unix
+// socket or the common name of its TLS client certificate.
+type AuditPeer struct {
+	Network    string `json:"network"`
+	Addr       string `json:"addr,omitempty"`
+	PID        *int32 `json:"pid,omitempty"`
+	UID        *int32 `json:"uid,omitempty"`
+	GID        *int32 `json:"gid,omitempty"`
+	CommonName string `json:"common_name,omitempty"`
+}
+
+// AuditLog records garden API operations, one JSON AuditRecord per line,
+// separately from the debug logs. It sees operations by watching the
+// connections an ActivationProxy forwards to the garden server, since the
+// server does not tell the backend who it is serving.
+type AuditLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	router http.Handler
+}
+
+// OpenAuditLog appends to the audit log at path, creating it if need be.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuditLog(f), nil
+}
+
+func NewAuditLog(w io.Writer) *AuditLog {
+	handlers := rata.Handlers{}
+	for _, route := range routes.Routes {
+		name := route.Name
+		handlers[name] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := w.(*routeMatch)
+			match.name = name
+			match.handle = r.URL.Query().Get(":handle")
+		})
+	}
+
+	// the routes are garden's own, so always valid
+	router, _ := rata.NewRouter(routes.Routes, handlers)
+
+	return &AuditLog{w: w, router: router}
+}
+
+// Record writes a record to the log.
+func (a *AuditLog) Record(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.w.Write(append(line, '\n'))
+	return err
+}
+
+// Watch returns writers to copy what the client of conn sends to the garden
+// server, and what the server answers, to. Audited operations are recorded
+// as their answers are seen. Writing to them never fails or holds up the
+// connection for long, and the connection is no longer watched once it
+// becomes a process's stream or stops making sense as HTTP. They must be
+// closed when the connection is.
+func (a *AuditLog) Watch(conn net.Conn) (requests, responses io.WriteCloser) {
+	requestsR, requestsW := io.Pipe()
+	responsesR, responsesW := io.Pipe()
+
+	go func() {
+		defer requestsR.Close()
+		defer responsesR.Close()
+
+		a.watch(conn, bufio.NewReader(requestsR), bufio.NewReader(responsesR))
+	}()
+
+	return &auditTap{w: requestsW}, &auditTap{w: responsesW}
+}
+
+func (a *AuditLog) watch(conn net.Conn, requests, responses *bufio.Reader) {
+	for {
+		req, err := http.ReadRequest(requests)
+		if err != nil {
+			return
+		}
+
+		start := time.Now()
+		name, handle := a.route(req)
+
+		// the server may answer before it has read the whole request, so
+		// its body is drained alongside the response
+		drained := make(chan struct{})
+		go func() {
+			io.Copy(ioutil.Discard, req.Body)
+			close(drained)
+		}()
+
+		resp, err := http.ReadResponse(responses, req)
+		if err != nil {
+			if auditedOperations[name] {
+				a.Record(AuditRecord{Time: start, Operation: name, Handle: handle, Peer: auditPeer(conn), Outcome: AuditUnknown})
+			}
+
+			return
+		}
+
+		outcome := AuditSuccess
+		if resp.StatusCode >= 400 {
+			outcome = AuditFailure
+		}
+
+		if name == routes.Create && outcome == AuditSuccess {
+			var created struct{ Handle string }
+			json.NewDecoder(resp.Body).Decode(&created)
+			handle = created.Handle
+		}
+
+		if auditedOperations[name] {
+			a.Record(AuditRecord{Time: start, Operation: name, Handle: handle, Peer: auditPeer(conn), Status: resp.StatusCode, Outcome: outcome})
+		}
+
+		// a process's streams follow the answer to Run or Attach
+		if name == routes.Run || name == routes.Attach {
+			return
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		<-drained
+	}
+}
+
+// route returns the name of the garden API route a request is for, and the
+// container handle in its path, if any.
+func (a *AuditLog) route(req *http.Request) (string, string) {
+	match := &routeMatch{header: http.Header{}}
+
+	// the router adds the path's parameters to the query, so give it a
+	// copy of the URL
+	r := *req
+	u := *req.URL
+	r.URL = &u
+	a.router.ServeHTTP(match, &r)
+
+	return match.name, match.handle
+}
+
+// routeMatch is the http.ResponseWriter AuditLog.route's router is given, to
+// which the route's handler writes its name and handle.
+type routeMatch struct {
+	name   string
+	handle string
+	header http.Header
+}
+
+func (m *routeMatch) Header() http.Header         { return m.header }
+func (m *routeMatch) Write(p []byte) (int, error) { return len(p), nil }
+func (m *routeMatch) WriteHeader(int)             {}
+
+// auditTap is a writer which passes what it is given to an AuditLog until
+// the log stops reading it, and never fails.
+type auditTap struct {
+	w      *io.PipeWriter
+	broken bool
+}
+
+func (t *auditTap) Write(p []byte) (int, error) {
+	if !t.broken {
+		if _, err := t.w.Write(p); err != nil {
+			t.broken = true
+		}
+	}
+
+	return len(p), nil
+}
+
+func (t *auditTap) Close() error {
+	return t.w.Close()
+}
+
+// auditPeer describes the client of conn.
+func auditPeer(conn net.Conn) AuditPeer {
+	peer := AuditPeer{Network: conn.LocalAddr().Network()}
+
+	// an unnamed unix socket has no address at all
+	if addr := conn.RemoteAddr(); addr != nil {
+		peer.Addr = addr.String()
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			peer.CommonName = certs[0].Subject.CommonName
+		}
+
+		conn = tlsConn.NetConn()
+	}
+
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if raw, err := unixConn.SyscallConn(); err == nil {
+			raw.Control(func(fd uintptr) {
+				cred, err := syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+				if err == nil {
+					pid, uid, gid := cred.Pid, int32(cred.Uid), int32(cred.Gid)
+					peer.PID, peer.UID, peer.GID = &pid, &uid, &gid
+				}
+			})
+		}
+	}
+
+	return peer
+}
@@ -0,0 +1,163 @@
+package gardendocker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden/client"
+	"github.com/cloudfoundry-incubator/garden/client/connection"
+	gfakes "github.com/cloudfoundry-incubator/garden/fakes"
+	"github.com/cloudfoundry-incubator/garden/server"
+	. "github.com/julz/garden-docker"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// syncBuffer is a bytes.Buffer safe to write to from the audit log's
+// goroutines while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+var _ = Describe("AuditLog", func() {
+	var dir string
+	var backend *gfakes.FakeBackend
+	var container *gfakes.FakeContainer
+	var gardenServer *server.GardenServer
+	var listener net.Listener
+	var log *syncBuffer
+	var gardenClient garden.Client
+
+	records := func() []AuditRecord {
+		var records []AuditRecord
+		for _, line := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+			if line == "" {
+				continue
+			}
+
+			var record AuditRecord
+			Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+			records = append(records, record)
+		}
+
+		return records
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "audit")
+		Expect(err).NotTo(HaveOccurred())
+
+		container = new(gfakes.FakeContainer)
+		container.HandleReturns("some-handle")
+
+		backend = new(gfakes.FakeBackend)
+		backend.CreateReturns(container, nil)
+		backend.LookupReturns(container, nil)
+
+		gardenServer = server.New("unix", filepath.Join(dir, "server.sock"), 0, backend, lagertest.NewTestLogger("garden"))
+		Expect(gardenServer.Start()).To(Succeed())
+
+		listener, err = net.Listen("unix", filepath.Join(dir, "client.sock"))
+		Expect(err).NotTo(HaveOccurred())
+
+		log = new(syncBuffer)
+		proxy := &ActivationProxy{
+			Listener: listener,
+			Network:  "unix",
+			Addr:     filepath.Join(dir, "server.sock"),
+			Logger:   lagertest.NewTestLogger("activation"),
+			Audit:    NewAuditLog(log),
+		}
+
+		go proxy.Serve()
+
+		gardenClient = client.New(connection.New("unix", filepath.Join(dir, "client.sock")))
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		gardenServer.Stop()
+		os.RemoveAll(dir)
+	})
+
+	It("records a create with the handle it was given, and who asked for it", func() {
+		_, err := gardenClient.Create(garden.ContainerSpec{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(records).Should(HaveLen(1))
+		record := records()[0]
+		Expect(record.Operation).To(Equal("Create"))
+		Expect(record.Handle).To(Equal("some-handle"))
+		Expect(record.Outcome).To(Equal(AuditSuccess))
+		Expect(record.Time).NotTo(BeZero())
+
+		Expect(record.Peer.Network).To(Equal("unix"))
+		Expect(*record.Peer.PID).To(BeEquivalentTo(os.Getpid()))
+		Expect(*record.Peer.UID).To(BeEquivalentTo(os.Getuid()))
+	})
+
+	It("records failed operations", func() {
+		backend.DestroyReturns(errors.New("no such container"))
+
+		Expect(gardenClient.Destroy("missing-handle")).NotTo(Succeed())
+
+		Eventually(records).Should(HaveLen(1))
+		Expect(records()[0].Operation).To(Equal("Destroy"))
+		Expect(records()[0].Handle).To(Equal("missing-handle"))
+		Expect(records()[0].Outcome).To(Equal(AuditFailure))
+		Expect(records()[0].Status).To(BeNumerically(">=", 400))
+	})
+
+	It("records stream ins, net ins and runs, but not other operations", func() {
+		c, err := gardenClient.Create(garden.ContainerSpec{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = gardenClient.Containers(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.StreamIn("/some/path", strings.NewReader("some-tar"))).To(Succeed())
+
+		_, _, err = c.NetIn(8080, 80)
+		Expect(err).NotTo(HaveOccurred())
+
+		process := new(gfakes.FakeProcess)
+		container.RunReturns(process, nil)
+		_, err = c.Run(garden.ProcessSpec{Path: "ls"}, garden.ProcessIO{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(records).Should(HaveLen(4))
+
+		var operations []string
+		for _, record := range records() {
+			Expect(record.Handle).To(Equal("some-handle"))
+			Expect(record.Outcome).To(Equal(AuditSuccess))
+			operations = append(operations, record.Operation)
+		}
+
+		Expect(operations).To(Equal([]string{"Create", "StreamIn", "NetIn", "Run"}))
+	})
+})
@@ -1,10 +1,14 @@
 package gardendocker
 
 import (
+	"errors"
+	"fmt"
 	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/pivotal-golang/lager"
 )
 
 type dockerID string
@@ -14,102 +18,508 @@ type Creator interface {
 	Create(spec garden.ContainerSpec) (*Container, error)
 }
 
+//go:generate counterfeiter . Destroyer
+type Destroyer interface {
+	Destroy(container *Container) error
+}
+
+//go:generate counterfeiter . Stopper
+type Stopper interface {
+	Stop(container *Container) error
+}
+
 type Repo interface {
 	All() []*Container
 	Add(*Container)
 	FindByHandle(string) (*Container, error)
+	FindByIP(string) (*Container, error)
+	FindByProperties(garden.Properties) []*Container
 	Query(filter func(*Container) bool) []*Container
 	Delete(*Container)
 }
 
 type Backend struct {
-	Creator Creator
-	Repo    Repo
+	Creator   Creator
+	Destroyer Destroyer
+	Repo      Repo
+	Resources *ResourcePool
+
+	// Adopter, if set, allows docker containers created by other tools to
+	// be adopted (see Adopt).
+	Adopter Adopter
+
+	// Restorer, if set, is used by Start to restore the containers left
+	// behind by a previous garden-docker process.
+	Restorer Restorer
+
+	// Stopper, if set, is used by Cleanup to stop every container.
+	Stopper Stopper
+
+	// Leftovers, if set, is used by Cleanup, when it destroys containers, to
+	// also remove the garden-owned docker containers which are not in the
+	// repo, such as those which could not be restored.
+	Leftovers DockerContainers
+
+	// MaxContainers is the number of containers the host has room for, as
+	// reported by Capacity. Create refuses to make more than this many,
+	// counting those still being created. Zero means no limit.
+	MaxContainers uint64
+
+	// Metrics and Emitter, if set, record how many creates and destroys
+	// there are and how long they take.
+	Metrics *BackendMetrics
+	Emitter MetricEmitter
+
+	// Events, if set, is published an event for each container created,
+	// destroyed or reaped.
+	Events *EventBus
+
+	// BulkConcurrency is how many containers BulkInfo and BulkMetrics look
+	// at once. Zero or less means one at a time.
+	BulkConcurrency int
+
+	// ReapInterval is how often to check for containers which have been idle
+	// for longer than their grace time. Zero disables reaping.
+	ReapInterval time.Duration
+
+	// Reconciler, if set, is run every ReconcileInterval to repair drift
+	// between the repo and docker.
+	Reconciler        *Reconciler
+	ReconcileInterval time.Duration
+
+	// DepotGC, if set, is run once the repo has been restored and then every
+	// DepotGCInterval to remove orphaned depot directories.
+	DepotGC         *DepotGC
+	DepotGCInterval time.Duration
+
+	// Rules, if set, is swept once the repo has been restored, removing the
+	// forwarding rules of containers which no longer exist.
+	Rules RuleSweeper
+
+	// SelfTest, if set, makes Start run the SmokeTest in the background,
+	// retrying every SelfTestInterval until it passes. Ping fails until
+	// then.
+	SelfTest         bool
+	SelfTestInterval time.Duration
+
+	// PreloadImages are rootfs URIs whose images Start has the Puller pull,
+	// all at once and in the background.
+	PreloadImages []string
+	Puller        ImagePuller
+
+	Logger lager.Logger
+
+	stop chan struct{}
+
+	selfTestMu  sync.Mutex
+	selfTestErr error
+
+	drainMu  sync.Mutex
+	draining bool
+
+	// admitMu also guards the docker containers and handles being adopted,
+	// which are not in the repo yet.
+	admitMu         sync.Mutex
+	creating        uint64
+	adoptingIDs     map[string]bool
+	adoptingHandles map[string]bool
 }
 
-func (b *Backend) Create(spec garden.ContainerSpec) (garden.Container, error) {
-	var err error
+func (b *Backend) Create(spec garden.ContainerSpec) (_ garden.Container, err error) {
 	var container *Container
 
+	defer func(start time.Time) { b.observe("create", start, err) }(time.Now())
+
+	if b.isDraining() {
+		return nil, ErrDraining
+	}
+
+	if err = b.admit(); err != nil {
+		return nil, err
+	}
+	defer b.admitted()
+
 	if container, err = b.Creator.Create(spec); err != nil {
 		return nil, err
 	}
 
+	container.Touch()
 	b.Repo.Add(container)
+	b.Events.Publish(Event{Kind: EventCreated, Handle: container.Handle()})
 
 	return container, err
 }
 
-func (backend *Backend) Start() error {
+// admit reserves room for a container about to be created, or returns a
+// ServiceUnavailableError if there is none. Containers still being created
+// count against MaxContainers, so that concurrent creates cannot overshoot it.
+func (b *Backend) admit() error {
+	b.admitMu.Lock()
+	defer b.admitMu.Unlock()
+
+	if b.MaxContainers > 0 {
+		if count := uint64(len(b.Repo.All())) + b.creating; count >= b.MaxContainers {
+			return ServiceUnavailableError{
+				Message: fmt.Sprintf("already at the maximum of %d containers", b.MaxContainers),
+			}
+		}
+	}
+
+	b.creating++
+	return nil
+}
+
+// admitted gives up the room reserved by admit, once the container is in
+// the repo or has failed to be created.
+func (b *Backend) admitted() {
+	b.admitMu.Lock()
+	defer b.admitMu.Unlock()
+
+	b.creating--
+}
+
+func (b *Backend) Start() error {
 	exec.Command("wrapdocker").Start() // needed to make docker-in-docker work
+
+	// the repo is only known to hold every live container if the restore
+	// succeeded; otherwise sweeping would remove the rules of those it missed
+	if err := b.Restore(); err == nil && b.Rules != nil {
+		b.sweepRules()
+	}
+
+	b.stop = make(chan struct{})
+	if b.ReapInterval > 0 {
+		go b.every(b.ReapInterval, b.Reap)
+	}
+
+	if b.Reconciler != nil && b.ReconcileInterval > 0 {
+		go b.every(b.ReconcileInterval, b.Reconciler.Reconcile)
+	}
+
+	if b.DepotGC != nil {
+		b.DepotGC.Collect()
+
+		if b.DepotGCInterval > 0 {
+			go b.every(b.DepotGCInterval, b.DepotGC.Collect)
+		}
+	}
+
+	if b.SelfTest {
+		b.selfTestMu.Lock()
+		b.selfTestErr = ErrSelfTestPending
+		b.selfTestMu.Unlock()
+
+		go b.selfTestUntilPassed()
+	}
+
+	if len(b.PreloadImages) > 0 {
+		go b.preloadImages()
+	}
+
 	return nil
 }
 
-func (backend *Backend) Stop() {
+func (b *Backend) sweepRules() {
+	live := make(map[string]bool)
+	for _, container := range b.Repo.All() {
+		live[container.Handle()] = true
+	}
+
+	swept, err := b.Rules.Sweep(live)
+	if err != nil {
+		b.Logger.Error("sweep-rules-failed", err)
+	}
+
+	if swept > 0 {
+		b.Logger.Info("swept-rules", lager.Data{"rules": swept})
+	}
 }
 
-func (backend *Backend) GraceTime(garden.Container) time.Duration {
-	return 5 * time.Minute
+func (b *Backend) Stop() {
+	if b.stop != nil {
+		close(b.stop)
+	}
 }
 
-func (backend *Backend) Ping() error {
-	return nil
+// Cleanup stops every container, up to concurrency at a time. If destroy is
+// set, it then destroys them all and removes any Leftovers too. It is meant
+// for single-purpose hosts where no container should outlive garden-docker.
+// Failures are logged rather than returned so that one stuck container does
+// not keep the others around.
+func (b *Backend) Cleanup(destroy bool, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if b.Stopper != nil {
+		sem := make(chan struct{}, concurrency)
+
+		var wg sync.WaitGroup
+		for _, container := range b.Repo.All() {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(container *Container) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				if err := b.Stopper.Stop(container); err != nil {
+					b.Logger.Error("cleanup-stop-failed", err, lager.Data{"handle": container.Handle()})
+				}
+			}(container)
+		}
+
+		wg.Wait()
+	}
+
+	if !destroy {
+		return
+	}
+
+	report := b.BulkDestroy(nil, concurrency, nil)
+	for handle, err := range report.Failed {
+		b.Logger.Error("cleanup-destroy-failed", errors.New(err), lager.Data{"handle": handle})
+	}
+
+	if b.Leftovers != nil {
+		b.removeLeftovers()
+	}
+}
+
+func (b *Backend) removeLeftovers() {
+	owned, err := b.Leftovers.Owned()
+	if err != nil {
+		b.Logger.Error("cleanup-list-failed", err)
+		return
+	}
+
+	known := make(map[string]bool)
+	for _, container := range b.Repo.All() {
+		known[container.DockerID] = true
+	}
+
+	for _, id := range owned {
+		if known[id] {
+			continue
+		}
+
+		if err := b.Leftovers.Remove(id); err != nil {
+			b.Logger.Error("cleanup-remove-failed", err, lager.Data{"docker-id": id})
+		}
+	}
+}
+
+// GraceTime always returns zero so that the server never straps its own
+// timers to our containers: the server only knows about API calls, whereas
+// the backend also counts running processes and open connections as
+// activity, and so does its own reaping (see Reap).
+func (b *Backend) GraceTime(garden.Container) time.Duration {
+	return 0
+}
+
+// Reap destroys every container which has been idle for longer than its
+// grace time, unless it has been marked as exempt using the
+// GraceTimeExemptProperty.
+func (b *Backend) Reap() {
+	// idleness is judged outside the repo's lock, since it can mean looking
+	// at the container's connections and properties
+	now := time.Now()
+	idle := idleAt(now)
+	for _, container := range b.Repo.All() {
+		if !idle(container) {
+			continue
+		}
+
+		log := b.Logger.Session("reap", lager.Data{
+			"handle":      container.Handle(),
+			"grace-time":  container.graceTime().String(),
+			"last-active": container.LastActive(),
+		})
+
+		log.Info("reaping")
+		if err := b.Destroy(container.Handle()); err != nil {
+			log.Error("destroy-failed", err)
+			continue
+		}
+
+		b.Events.Publish(Event{
+			Kind:   EventReaped,
+			Handle: container.Handle(),
+			Data:   map[string]interface{}{"grace_time": container.graceTime().String()},
+		})
+	}
+}
+
+func (b *Backend) every(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-b.stop:
+			return
+		}
+	}
 }
 
-func (backend *Backend) Capacity() (garden.Capacity, error) {
-	// lies.
+// Ping fails while the self-test, if there is one, has not passed.
+func (b *Backend) Ping() error {
+	b.selfTestMu.Lock()
+	defer b.selfTestMu.Unlock()
+
+	return b.selfTestErr
+}
+
+// Capacity reports the host's memory and the disk space of the filesystem
+// holding the depot, less what is reserved for the host itself, and
+// MaxContainers.
+func (b *Backend) Capacity() (garden.Capacity, error) {
+	available, err := b.Resources.Available()
+	if err != nil {
+		return garden.Capacity{}, err
+	}
+
 	return garden.Capacity{
-		MemoryInBytes: 500000,
-		DiskInBytes:   500000,
-		MaxContainers: 1000,
+		MemoryInBytes: available.MemoryInBytes,
+		DiskInBytes:   available.DiskInBytes,
+		MaxContainers: b.MaxContainers,
 	}, nil
 }
 
-func (backend *Backend) Destroy(handle string) error {
+func (b *Backend) Destroy(handle string) (err error) {
+	defer func(start time.Time) { b.observe("destroy", start, err) }(time.Now())
+
+	container, err := b.Repo.FindByHandle(handle)
+	if err != nil {
+		return err
+	}
+
+	if err := b.destroy(container); err != nil {
+		return gardenError(handle, err)
+	}
+
 	return nil
 }
 
+// destroy destroys the container and removes it from the repo. A container
+// whose docker container has already gone is removed too, since the
+// Destroyer still releases the rest of its resources, but the error is
+// returned so that the caller can tell.
+func (b *Backend) destroy(container *Container) error {
+	err := b.Destroyer.Destroy(container)
+	if err != nil && !isNoSuchContainer(err) {
+		return err
+	}
+
+	b.Repo.Delete(container)
+	b.Events.Publish(Event{Kind: EventDestroyed, Handle: container.Handle()})
+	return err
+}
+
+// Containers returns the containers which match the given properties.
+// Stopped containers are returned as usual; those whose docker container
+// has been removed from under us are pruned by the Reconciler.
 func (b *Backend) Containers(props garden.Properties) ([]garden.Container, error) {
-	return toGardenContainers(b.Repo.Query(withProperties(props))), nil
+	return toGardenContainers(b.Repo.FindByProperties(props)), nil
 }
 
 func (b *Backend) Lookup(handle string) (garden.Container, error) {
-	return b.Repo.FindByHandle(handle)
+	container, err := b.Repo.FindByHandle(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	container.Touch()
+	return container, nil
 }
 
+// BulkInfo gathers the info of the containers with the given handles, up to
+// BulkConcurrency at a time. Unknown handles are left out.
 func (b *Backend) BulkInfo(handles []string) (map[string]garden.ContainerInfoEntry, error) {
-	containers := b.Repo.Query(withHandles(handles))
-
 	infos := make(map[string]garden.ContainerInfoEntry)
-	for _, container := range containers {
+
+	var mu sync.Mutex
+	b.forEach(b.Repo.Query(withHandles(handles)), func(container *Container) {
 		info, err := container.Info()
+
+		mu.Lock()
+		defer mu.Unlock()
+
 		infos[container.Handle()] = garden.ContainerInfoEntry{
 			Info: info,
 			Err:  err,
 		}
-	}
+	})
 
 	return infos, nil
 }
 
+// BulkMetrics gathers the metrics of the containers with the given handles,
+// up to BulkConcurrency at a time. Unknown handles are left out.
 func (b *Backend) BulkMetrics(handles []string) (map[string]garden.ContainerMetricsEntry, error) {
-	containers := b.Repo.Query(withHandles(handles))
-
 	metrics := make(map[string]garden.ContainerMetricsEntry)
-	for _, container := range containers {
+
+	var mu sync.Mutex
+	b.forEach(b.Repo.Query(withHandles(handles)), func(container *Container) {
 		metric, err := container.Metrics()
+
+		mu.Lock()
+		defer mu.Unlock()
+
 		metrics[container.Handle()] = garden.ContainerMetricsEntry{
 			Metrics: metric,
 			Err:     err,
 		}
-	}
+	})
 
 	return metrics, nil
 }
 
-func withProperties(properties garden.Properties) func(*Container) bool {
+// forEach calls fn for each container from a pool of BulkConcurrency
+// workers, and waits for them all to finish.
+func (b *Backend) forEach(containers []*Container, fn func(*Container)) {
+	workers := b.BulkConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > len(containers) {
+		workers = len(containers)
+	}
+
+	work := make(chan *Container)
+	go func() {
+		for _, container := range containers {
+			work <- container
+		}
+		close(work)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for container := range work {
+				fn(container)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func idleAt(now time.Time) func(*Container) bool {
 	return func(c *Container) bool {
-		return c.HasProperties(properties)
+		if c.GraceTimeExempt() {
+			return false
+		}
+
+		c.syncGraceTime()
+		return c.Idle(now)
 	}
 }
 
@@ -1,32 +1,44 @@
 package gardendocker_test
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
 	"github.com/julz/garden-docker/fakes"
+	"github.com/julz/garden-docker/metrics"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
 )
 
 var _ = Describe("Backend", func() {
 	var backend *gardendocker.Backend
 	var repo gardendocker.Repo
 	var fakeCreator *fakes.FakeCreator
+	var fakeDestroyer *fakes.FakeDestroyer
 
 	var createdContainer *gardendocker.Container
 
 	BeforeEach(func() {
 		fakeCreator = new(fakes.FakeCreator)
+		fakeDestroyer = new(fakes.FakeDestroyer)
 		repo = gardendocker.NewRepo()
 		backend = &gardendocker.Backend{
-			Creator: fakeCreator,
-			Repo:    repo,
+			Creator:   fakeCreator,
+			Destroyer: fakeDestroyer,
+			Repo:      repo,
+			Logger:    lagertest.NewTestLogger("backend"),
 		}
 
 		createdContainer = &gardendocker.Container{
 			InfoHandler: &gardendocker.InfoHandler{Spec: garden.ContainerSpec{
 				Handle: "was-created",
 			}},
+			ActivityHandler: &gardendocker.ActivityHandler{},
 		}
 
 		fakeCreator.CreateReturns(createdContainer, nil)
@@ -50,6 +62,399 @@ var _ = Describe("Backend", func() {
 			It("adds the container to the repository", func() {
 				Expect(repo.FindByHandle("was-created")).To(Equal(createdContainer))
 			})
+
+			It("marks the container as active", func() {
+				Expect(createdContainer.LastActive()).To(BeTemporally("~", time.Now(), time.Second))
+			})
+		})
+
+		It("records how long creates take, by result", func() {
+			backend.Metrics = gardendocker.NewBackendMetrics(metrics.NewRegistry())
+
+			backend.Create(garden.ContainerSpec{})
+			fakeCreator.CreateReturns(nil, errors.New("boom"))
+			backend.Create(garden.ContainerSpec{})
+
+			Expect(backend.Metrics.CreateDuration.Count("success")).To(BeEquivalentTo(1))
+			Expect(backend.Metrics.CreateDuration.Count("failure")).To(BeEquivalentTo(1))
+		})
+
+		It("emits a counter and the duration of each create", func() {
+			emitter := new(fakes.FakeMetricEmitter)
+			backend.Emitter = emitter
+
+			backend.Create(garden.ContainerSpec{})
+			fakeCreator.CreateReturns(nil, errors.New("boom"))
+			backend.Create(garden.ContainerSpec{})
+
+			Expect(emitter.IncrementCounterCallCount()).To(Equal(2))
+			Expect(emitter.IncrementCounterArgsForCall(0)).To(Equal("ContainerCreations"))
+			Expect(emitter.IncrementCounterArgsForCall(1)).To(Equal("ContainerCreationFailures"))
+
+			Expect(emitter.SendValueCallCount()).To(Equal(2))
+			name, _, unit := emitter.SendValueArgsForCall(0)
+			Expect(name).To(Equal("ContainerCreationDuration"))
+			Expect(unit).To(Equal("ms"))
+		})
+
+		It("publishes an event for the created container", func() {
+			backend.Events = gardendocker.NewEventBus()
+			events, _ := backend.Events.Subscribe()
+
+			backend.Create(garden.ContainerSpec{})
+
+			var event gardendocker.Event
+			Expect(events).To(Receive(&event))
+			Expect(event.Kind).To(Equal(gardendocker.EventCreated))
+			Expect(event.Handle).To(Equal("was-created"))
+		})
+
+		Context("when MaxContainers is set", func() {
+			BeforeEach(func() {
+				backend.MaxContainers = 1
+			})
+
+			It("refuses to create containers once the repo holds that many", func() {
+				_, err := backend.Create(garden.ContainerSpec{})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = backend.Create(garden.ContainerSpec{})
+				Expect(err).To(BeAssignableToTypeOf(gardendocker.ServiceUnavailableError{}))
+				Expect(err).To(MatchError(ContainSubstring("maximum of 1 containers")))
+				Expect(fakeCreator.CreateCallCount()).To(Equal(1))
+			})
+
+			It("does not count containers which failed to be created", func() {
+				fakeCreator.CreateReturns(nil, errors.New("boom"))
+				backend.Create(garden.ContainerSpec{})
+
+				fakeCreator.CreateReturns(createdContainer, nil)
+				_, err := backend.Create(garden.ContainerSpec{})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("BulkInfo and BulkMetrics", func() {
+		var stats *fakes.FakeContainerStats
+
+		newContainer := func(handle string) *gardendocker.Container {
+			return &gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: handle},
+					PropsHandler: gardendocker.NewPropsHandler(nil),
+				},
+				LimitsHandler: &gardendocker.LimitsHandler{Stats: stats},
+			}
+		}
+
+		BeforeEach(func() {
+			stats = new(fakes.FakeContainerStats)
+			backend.BulkConcurrency = 2
+
+			repo.Add(newContainer("a"))
+			repo.Add(newContainer("b"))
+			repo.Add(newContainer("c"))
+		})
+
+		It("returns the info of the containers asked for and leaves out unknown handles", func() {
+			infos, err := backend.BulkInfo([]string{"a", "c", "unknown"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(infos).To(HaveLen(2))
+			Expect(infos).To(HaveKey("a"))
+			Expect(infos).To(HaveKey("c"))
+			Expect(infos["a"].Err).NotTo(HaveOccurred())
+		})
+
+		It("returns each container's metrics, or its error", func() {
+			stats.MemoryReturns(garden.ContainerMemoryStat{Rss: 5}, nil)
+			stats.CPUReturns(garden.ContainerCPUStat{}, errors.New("boom"))
+
+			metrics, err := backend.BulkMetrics([]string{"a", "b"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metrics).To(HaveLen(2))
+			Expect(metrics["a"].Err).To(MatchError("cpu stats: boom"))
+		})
+
+		It("gathers metrics concurrently, up to BulkConcurrency at a time", func() {
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+			stats.MemoryStub = func() (garden.ContainerMemoryStat, error) {
+				started <- struct{}{}
+				<-release
+				return garden.ContainerMemoryStat{}, nil
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				backend.BulkMetrics([]string{"a", "b", "c"})
+			}()
+
+			Eventually(started).Should(HaveLen(2))
+			Consistently(started).Should(HaveLen(2))
+
+			close(release)
+			Eventually(done).Should(BeClosed())
+			Expect(stats.MemoryCallCount()).To(Equal(3))
+		})
+	})
+
+	Describe("Lookup", func() {
+		BeforeEach(func() {
+			repo.Add(createdContainer)
+		})
+
+		It("marks the container as active", func() {
+			_, err := backend.Lookup("was-created")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(createdContainer.LastActive()).To(BeTemporally("~", time.Now(), time.Second))
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns ContainerNotFoundError", func() {
+				_, err := backend.Lookup("not-a-handle")
+				Expect(err).To(MatchError(garden.ContainerNotFoundError{Handle: "not-a-handle"}))
+			})
+		})
+	})
+
+	Describe("Destroy", func() {
+		BeforeEach(func() {
+			repo.Add(createdContainer)
+		})
+
+		It("destroys the container using the destroyer", func() {
+			Expect(backend.Destroy("was-created")).To(Succeed())
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			Expect(fakeDestroyer.DestroyArgsForCall(0)).To(Equal(createdContainer))
+		})
+
+		It("removes the container from the repository", func() {
+			Expect(backend.Destroy("was-created")).To(Succeed())
+			_, err := repo.FindByHandle("was-created")
+			Expect(err).To(HaveOccurred())
+		})
+
+		Context("when destroying fails", func() {
+			BeforeEach(func() {
+				fakeDestroyer.DestroyReturns(errors.New("boom"))
+			})
+
+			It("returns the error and keeps the container", func() {
+				Expect(backend.Destroy("was-created")).To(MatchError("boom"))
+				Expect(repo.FindByHandle("was-created")).To(Equal(createdContainer))
+			})
+
+			It("records the destroy as a failure", func() {
+				backend.Metrics = gardendocker.NewBackendMetrics(metrics.NewRegistry())
+				backend.Destroy("was-created")
+
+				Expect(backend.Metrics.DestroyDuration.Count("failure")).To(BeEquivalentTo(1))
+				Expect(backend.Metrics.DestroyDuration.Count("success")).To(BeEquivalentTo(0))
+			})
+		})
+
+		Context("when docker no longer has the container", func() {
+			BeforeEach(func() {
+				fakeDestroyer.DestroyReturns(fmt.Errorf("destroy: %w", &dockercli.Error{
+					Command: "rm",
+					Reason:  "no_such_container",
+					Message: "exit status 1: Error: No such container: abc123",
+				}))
+			})
+
+			It("returns ContainerNotFoundError", func() {
+				Expect(backend.Destroy("was-created")).To(MatchError(garden.ContainerNotFoundError{Handle: "was-created"}))
+			})
+
+			It("removes the container from the repository", func() {
+				backend.Destroy("was-created")
+				_, err := repo.FindByHandle("was-created")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Cleanup", func() {
+		var fakeStopper *fakes.FakeStopper
+
+		BeforeEach(func() {
+			fakeStopper = new(fakes.FakeStopper)
+			backend.Stopper = fakeStopper
+
+			createdContainer.InfoHandler.PropsHandler = gardendocker.NewPropsHandler(nil)
+			repo.Add(createdContainer)
+		})
+
+		It("stops every container but keeps them", func() {
+			backend.Cleanup(false, 2)
+
+			Expect(fakeStopper.StopCallCount()).To(Equal(1))
+			Expect(fakeStopper.StopArgsForCall(0)).To(Equal(createdContainer))
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+			Expect(repo.All()).To(HaveLen(1))
+		})
+
+		Context("when asked to destroy them", func() {
+			It("destroys every container once it has been stopped", func() {
+				fakeStopper.StopReturns(errors.New("stuck"))
+				backend.Cleanup(true, 2)
+
+				Expect(fakeStopper.StopCallCount()).To(Equal(1))
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+				Expect(repo.All()).To(BeEmpty())
+			})
+
+			It("removes garden-owned docker containers which are not in the repo", func() {
+				leftovers := new(fakes.FakeDockerContainers)
+				leftovers.OwnedReturns([]string{"unrestored-id"}, nil)
+				backend.Leftovers = leftovers
+
+				backend.Cleanup(true, 2)
+
+				Expect(leftovers.RemoveCallCount()).To(Equal(1))
+				Expect(leftovers.RemoveArgsForCall(0)).To(Equal("unrestored-id"))
+			})
+		})
+	})
+
+	Describe("Reap", func() {
+		var idle, busy *gardendocker.Container
+
+		newContainer := func(handle string, graceTime time.Duration) *gardendocker.Container {
+			container := &gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: handle},
+					PropsHandler: gardendocker.NewPropsHandler(nil),
+				},
+				ActivityHandler: &gardendocker.ActivityHandler{GraceTime: graceTime},
+			}
+
+			container.Touch()
+			repo.Add(container)
+			return container
+		}
+
+		BeforeEach(func() {
+			idle = newContainer("idle", time.Millisecond)
+			busy = newContainer("busy", time.Hour)
+		})
+
+		It("destroys containers which have been idle for longer than their grace time", func() {
+			time.Sleep(2 * time.Millisecond)
+			backend.Reap()
+
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			Expect(fakeDestroyer.DestroyArgsForCall(0)).To(Equal(idle))
+			Expect(repo.FindByHandle("busy")).To(Equal(busy))
+		})
+
+		Context("when an idle container is marked as grace-time exempt", func() {
+			BeforeEach(func() {
+				idle.SetProperty(gardendocker.GraceTimeExemptProperty, "true")
+			})
+
+			It("is not destroyed", func() {
+				time.Sleep(2 * time.Millisecond)
+				backend.Reap()
+
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a container's grace time is changed", func() {
+			It("is reaped by its new grace time", func() {
+				Expect(idle.SetGraceTime(0)).To(Succeed())
+				Expect(busy.SetGraceTime(time.Millisecond)).To(Succeed())
+
+				time.Sleep(2 * time.Millisecond)
+				backend.Reap()
+
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+				Expect(fakeDestroyer.DestroyArgsForCall(0)).To(Equal(busy))
+				Expect(busy.GetProperty(gardendocker.GraceTimeProperty)).To(Equal("1ms"))
+			})
+
+			It("picks up a grace time a client sets as a property", func() {
+				idle.SetProperty(gardendocker.GraceTimeProperty, "0s")
+
+				time.Sleep(2 * time.Millisecond)
+				backend.Reap()
+
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Containers", func() {
+		It("returns the containers which match the given properties", func() {
+			matching := &gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: "matching"},
+					PropsHandler: gardendocker.NewPropsHandler(garden.Properties{"foo": "bar"}),
+				},
+			}
+			repo.Add(matching)
+			repo.Add(&gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: "other"},
+					PropsHandler: gardendocker.NewPropsHandler(garden.Properties{"foo": "baz"}),
+				},
+			})
+
+			containers, err := backend.Containers(garden.Properties{"foo": "bar"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).To(ConsistOf(matching))
+		})
+	})
+
+	Describe("Capacity", func() {
+		var fakeSystem *fakes.FakeSystemResources
+
+		BeforeEach(func() {
+			fakeSystem = new(fakes.FakeSystemResources)
+			fakeSystem.TotalReturns(gardendocker.Resources{
+				MemoryInBytes: 1000,
+				DiskInBytes:   2000,
+			}, nil)
+
+			backend.Resources = &gardendocker.ResourcePool{
+				System:   fakeSystem,
+				Reserved: gardendocker.Resources{MemoryInBytes: 100, DiskInBytes: 300},
+			}
+		})
+
+		It("reports the host's resources less the reserved resources", func() {
+			capacity, err := backend.Capacity()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capacity.MemoryInBytes).To(BeEquivalentTo(900))
+			Expect(capacity.DiskInBytes).To(BeEquivalentTo(1700))
+		})
+
+		It("reports the configured maximum number of containers", func() {
+			backend.MaxContainers = 250
+
+			capacity, err := backend.Capacity()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capacity.MaxContainers).To(BeEquivalentTo(250))
+		})
+
+		Context("when the host's resources cannot be read", func() {
+			BeforeEach(func() {
+				fakeSystem.TotalReturns(gardendocker.Resources{}, errors.New("no proc"))
+			})
+
+			It("returns the error", func() {
+				_, err := backend.Capacity()
+				Expect(err).To(MatchError("no proc"))
+			})
+		})
+	})
+
+	Describe("GraceTime", func() {
+		It("returns zero, as the backend reaps idle containers itself", func() {
+			Expect(backend.GraceTime(createdContainer)).To(BeZero())
 		})
 	})
 })
@@ -0,0 +1,171 @@
+package gardendocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+//go:generate counterfeiter . TrafficShaper
+type TrafficShaper interface {
+	// Shape limits the rate of the container's traffic, each way, to
+	// limits, or lifts the limit if its rate is zero.
+	Shape(limits garden.BandwidthLimits) error
+
+	// Limits returns the limits in force, or zero limits if there are
+	// none.
+	Limits() (garden.BandwidthLimits, error)
+}
+
+// TCShaper is a TrafficShaper which shapes a container's traffic with tc on
+// the host end of the veth pair of its IfName interface: an HTB class for
+// the traffic the host sends the container and an ingress policer, which
+// drops what is over the rate, for the traffic it receives from it. The
+// rules go when the container's network namespace, and so the veth pair,
+// does.
+type TCShaper struct {
+	DockerRunner  DockerRunner
+	CommandRunner command_runner.CommandRunner
+
+	DockerID string
+	IfName   string
+
+	// ProcPath is where proc is mounted, /proc if empty.
+	ProcPath string
+}
+
+func (s *TCShaper) Shape(limits garden.BandwidthLimits) error {
+	veth, err := s.hostVeth()
+	if err != nil {
+		return err
+	}
+
+	if veth == "" {
+		if limits.RateInBytesPerSecond == 0 {
+			return nil
+		}
+
+		return fmt.Errorf("container %s is not running", s.DockerID)
+	}
+
+	// either may not be there to delete
+	s.tc("qdisc", "del", "dev", veth, "root")
+	s.tc("qdisc", "del", "dev", veth, "ingress")
+
+	if limits.RateInBytesPerSecond == 0 {
+		return nil
+	}
+
+	rate := strconv.FormatUint(limits.RateInBytesPerSecond, 10) + "bps"
+	burst := strconv.FormatUint(limits.BurstRateInBytesPerSecond, 10)
+
+	for _, args := range [][]string{
+		{"qdisc", "add", "dev", veth, "root", "handle", "1:", "htb", "default", "1"},
+		{"class", "add", "dev", veth, "parent", "1:", "classid", "1:1", "htb", "rate", rate, "burst", burst},
+		{"qdisc", "add", "dev", veth, "handle", "ffff:", "ingress"},
+		{"filter", "add", "dev", veth, "parent", "ffff:", "protocol", "all", "prio", "1", "u32", "match", "u32", "0", "0",
+			"police", "rate", rate, "burst", burst, "drop", "flowid", ":1"},
+	} {
+		if _, err := s.tc(args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Limits reads the rate and burst back from the HTB class.
+func (s *TCShaper) Limits() (garden.BandwidthLimits, error) {
+	veth, err := s.hostVeth()
+	if err != nil || veth == "" {
+		return garden.BandwidthLimits{}, err
+	}
+
+	out, err := s.tc("-j", "class", "show", "dev", veth)
+	if err != nil {
+		return garden.BandwidthLimits{}, err
+	}
+
+	var classes []struct {
+		Class  string `json:"class"`
+		Handle string `json:"handle"`
+		Rate   uint64 `json:"rate"`
+		Burst  uint64 `json:"burst"`
+	}
+
+	if err := json.Unmarshal(out, &classes); err != nil {
+		return garden.BandwidthLimits{}, fmt.Errorf("parse tc classes: %s", err)
+	}
+
+	for _, class := range classes {
+		if class.Class == "htb" && class.Handle == "1:1" {
+			return garden.BandwidthLimits{RateInBytesPerSecond: class.Rate, BurstRateInBytesPerSecond: class.Burst}, nil
+		}
+	}
+
+	return garden.BandwidthLimits{}, nil
+}
+
+// hostVeth finds the host end of the container's veth pair, or returns "" if
+// the container is not running.
+func (s *TCShaper) hostVeth() (string, error) {
+	info, err := s.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: s.DockerID})
+	if err != nil {
+		return "", err
+	}
+
+	if !info.State.Running {
+		return "", nil
+	}
+
+	return hostVeth(s.ProcPath, info.State.Pid, s.IfName)
+}
+
+// hostVeth finds the host end of the veth pair whose other end is the
+// interface ifName of the process pid: the interface whose index is the
+// other end's iflink. proc is mounted at procPath, or /proc if empty.
+func hostVeth(procPath string, pid int, ifName string) (string, error) {
+	if procPath == "" {
+		procPath = "/proc"
+	}
+
+	iflink, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "root", "sys", "class", "net", ifName, "iflink"))
+	if err != nil {
+		return "", fmt.Errorf("find %s's veth: %s", ifName, err)
+	}
+
+	index, err := strconv.Atoi(strings.TrimSpace(string(iflink)))
+	if err != nil {
+		return "", fmt.Errorf("find %s's veth: %s", ifName, err)
+	}
+
+	veth, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return "", fmt.Errorf("find %s's veth: %s", ifName, err)
+	}
+
+	return veth.Name, nil
+}
+
+func (s *TCShaper) tc(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("tc", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := s.CommandRunner.Run(cmd); err != nil {
+		return nil, fmt.Errorf("tc %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,111 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCShaper", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var commandRunner *fake_command_runner.FakeCommandRunner
+	var shaper *TCShaper
+	var procPath string
+	var veth string
+
+	BeforeEach(func() {
+		var err error
+		procPath, err = ioutil.TempDir("", "proc")
+		Expect(err).NotTo(HaveOccurred())
+
+		// the loopback interface stands in for the host end of the veth
+		interfaces, err := net.Interfaces()
+		Expect(err).NotTo(HaveOccurred())
+		veth = interfaces[0].Name
+
+		netDir := filepath.Join(procPath, "1234", "root", "sys", "class", "net", "eth0")
+		Expect(os.MkdirAll(netDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(netDir, "iflink"), []byte(strconv.Itoa(interfaces[0].Index)+"\n"), 0644)).To(Succeed())
+
+		info := dockercli.ContainerJSON{}
+		info.State.Running = true
+		info.State.Pid = 1234
+
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.InspectReturns(info, nil)
+
+		commandRunner = fake_command_runner.New()
+		shaper = &TCShaper{
+			DockerRunner:  dockerRunner,
+			CommandRunner: commandRunner,
+			DockerID:      "some-docker-id",
+			IfName:        "eth0",
+			ProcPath:      procPath,
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(procPath)
+	})
+
+	It("replaces the host veth's qdiscs with an htb class and an ingress policer at the rate", func() {
+		Expect(shaper.Shape(garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 100})).To(Succeed())
+
+		var commands [][]string
+		for _, cmd := range commandRunner.ExecutedCommands() {
+			commands = append(commands, cmd.Args)
+		}
+
+		Expect(commands).To(Equal([][]string{
+			{"tc", "qdisc", "del", "dev", veth, "root"},
+			{"tc", "qdisc", "del", "dev", veth, "ingress"},
+			{"tc", "qdisc", "add", "dev", veth, "root", "handle", "1:", "htb", "default", "1"},
+			{"tc", "class", "add", "dev", veth, "parent", "1:", "classid", "1:1", "htb", "rate", "1000bps", "burst", "100"},
+			{"tc", "qdisc", "add", "dev", veth, "handle", "ffff:", "ingress"},
+			{"tc", "filter", "add", "dev", veth, "parent", "ffff:", "protocol", "all", "prio", "1", "u32", "match", "u32", "0", "0",
+				"police", "rate", "1000bps", "burst", "100", "drop", "flowid", ":1"},
+		}))
+	})
+
+	It("only removes the qdiscs for a zero rate", func() {
+		Expect(shaper.Shape(garden.BandwidthLimits{})).To(Succeed())
+		Expect(commandRunner.ExecutedCommands()).To(HaveLen(2))
+	})
+
+	It("reads the limits back from the htb class", func() {
+		commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "tc"}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(`[{"class":"htb","handle":"1:1","root":true,"rate":1000,"burst":99}]`))
+			return nil
+		})
+
+		Expect(shaper.Limits()).To(Equal(garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 99}))
+	})
+
+	Context("when the container is not running", func() {
+		BeforeEach(func() {
+			dockerRunner.InspectReturns(dockercli.ContainerJSON{}, nil)
+		})
+
+		It("has nothing to remove, and no limits", func() {
+			Expect(shaper.Shape(garden.BandwidthLimits{})).To(Succeed())
+			Expect(shaper.Limits()).To(Equal(garden.BandwidthLimits{}))
+			Expect(commandRunner.ExecutedCommands()).To(BeEmpty())
+		})
+
+		It("cannot be limited", func() {
+			Expect(shaper.Shape(garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 100})).NotTo(Succeed())
+		})
+	})
+})
@@ -2,13 +2,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/garden-linux/container_daemon"
 	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+	"github.com/julz/garden-docker/daemon"
+	"github.com/kr/pty"
 
 	_ "github.com/cloudfoundry-incubator/garden-linux/iodaemon"
 )
@@ -17,9 +24,26 @@ func main() {
 	socketPath := flag.String("socketPath", "./run/initd.sock", "socket initd is listening on")
 	dir := flag.String("dir", "", "working directory for spawned process")
 	user := flag.String("user", "", "user to run container as (defaults to current user)")
+	tty := flag.Bool("tty", false, "run the process in a terminal the size of dosh's own, following its resizes")
+	processID := flag.Uint("processID", 0, "id to name the spawned process by, so that it can be signalled (dosh forwards it the signals it receives)")
+
+	envFile := flag.String("envFile", "", "file holding a JSON array of environment variables (KEY=VALUE) to set for the spawned process, which is removed once read")
+
+	var env envFlags
+	flag.Var(&env, "env", "environment variable (KEY=VALUE) to set for the spawned process, may be given more than once")
 
 	flag.Parse()
 
+	if *envFile != "" {
+		fileEnv, err := readEnvFile(*envFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Reading environment: %s", err)
+			os.Exit(container_daemon.UnknownExitStatus)
+		}
+
+		env = append(env, fileEnv...)
+	}
+
 	extraArgs := flag.Args()
 	if len(extraArgs) == 0 {
 		fmt.Fprintf(os.Stderr, "Command name not provided.")
@@ -29,11 +53,18 @@ func main() {
 	processSpec := &garden.ProcessSpec{
 		Path: extraArgs[0],
 		Args: extraArgs[1:],
-		Env:  []string{"HELLO=1"},
+		Env:  env,
 		Dir:  *dir,
 		User: *user,
 	}
 
+	if *tty {
+		processSpec.TTY = &garden.TTYSpec{}
+		if rows, cols, err := pty.Getsize(os.Stdin); err == nil {
+			processSpec.TTY.WindowSize = &garden.WindowSize{Columns: cols, Rows: rows}
+		}
+	}
+
 	processIO := &garden.ProcessIO{
 		Stdin:  os.Stdin,
 		Stderr: os.Stderr,
@@ -44,12 +75,20 @@ func main() {
 		SocketPath: *socketPath,
 	}
 
-	proc, err := container_daemon.NewProcess(connector, processSpec, processIO)
+	proc, err := daemon.NewProcess(connector, uint32(*processID), processSpec, processIO)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Starting process: %s", err)
 		os.Exit(container_daemon.UnknownExitStatus)
 	}
 
+	if *tty {
+		go followWindowSize(proc)
+	}
+
+	if *processID != 0 {
+		go forwardSignals(&daemon.Signaller{SocketPath: *socketPath, ProcessID: uint32(*processID)})
+	}
+
 	exitCode, err := proc.Wait()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Waiting for process to complete: %s", err)
@@ -58,3 +97,58 @@ func main() {
 
 	os.Exit(exitCode)
 }
+
+// followWindowSize resizes the process's terminal whenever dosh's own
+// terminal is resized, as it is when garden's SetTTY is called.
+func followWindowSize(proc *daemon.Process) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+
+	for range winch {
+		if rows, cols, err := pty.Getsize(os.Stdin); err == nil {
+			proc.SetWindowSize(cols, rows)
+		}
+	}
+}
+
+// forwardSignals sends the signals which would otherwise terminate dosh on to
+// the process, so that dosh only exits once the process does.
+func forwardSignals(signaller *daemon.Signaller) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for sig := range signals {
+		if err := signaller.Signal(sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Forwarding %s: %s\n", sig, err)
+		}
+	}
+}
+
+// readEnvFile reads the environment garden-docker wrote for the process and
+// removes the file, so that it does not outlive the process starting.
+func readEnvFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	os.Remove(path)
+
+	var env []string
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+type envFlags []string
+
+func (e *envFlags) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *envFlags) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// embeddedInitd is a static initd binary built into garden-docker, by
+// `make garden-docker` (see initd_embed.go). It is nil in a plain go build,
+// which then needs -initdBin.
+var embeddedInitd []byte
+
+// embeddedDosh and embeddedIodaemon are the dosh and iodaemon binaries built
+// into garden-docker along with initd (see helpers_embed.go). They are nil in
+// a plain go build, which then needs -doshBin and -iodaemonBin.
+var embeddedDosh, embeddedIodaemon []byte
+
+// initdBinary returns the initd binary to mount into containers: initdBin if
+// it is given, or else the embedded initd, written into the depot so that it
+// stays at the same path across restarts for the containers which mount it.
+func initdBinary(initdBin, depotDir string) (string, error) {
+	return binary("initd", initdBin, embeddedInitd, depotDir)
+}
+
+// binary returns the named binary: bin if it is given, or else the embedded
+// one, written into the depot.
+func binary(name, bin string, embedded []byte, depotDir string) (string, error) {
+	if bin != "" {
+		if _, err := os.Stat(bin); err != nil {
+			return "", fmt.Errorf("%s: %s", name, err)
+		}
+
+		return bin, nil
+	}
+
+	if embedded == nil {
+		return "", fmt.Errorf("%s: garden-docker was built without an embedded %s, so give one with -%sBin", name, name, name)
+	}
+
+	path := filepath.Join(depotDir, name)
+
+	tmp, err := ioutil.TempFile(depotDir, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(embedded); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	// renamed into place, since containers which are running may have the
+	// old binary open
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	return path, nil
+}
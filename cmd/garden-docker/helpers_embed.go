@@ -0,0 +1,19 @@
+//go:build embedhelpers
+// +build embedhelpers
+
+package main
+
+import _ "embed"
+
+// dosh.bin and iodaemon.bin are built by `make helpers`.
+//
+//go:embed dosh.bin
+var doshBin []byte
+
+//go:embed iodaemon.bin
+var iodaemonBin []byte
+
+func init() {
+	embeddedDosh = doshBin
+	embeddedIodaemon = iodaemonBin
+}
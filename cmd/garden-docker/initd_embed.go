@@ -0,0 +1,15 @@
+//go:build embedinitd
+// +build embedinitd
+
+package main
+
+import _ "embed"
+
+// initd.bin is built by `make initd`.
+//
+//go:embed initd.bin
+var initdBin []byte
+
+func init() {
+	embeddedInitd = initdBin
+}
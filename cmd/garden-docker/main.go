@@ -1,10 +1,19 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cloudfoundry-incubator/cf-lager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
@@ -14,7 +23,8 @@ import (
 	"github.com/docker/docker/pkg/iptables"
 	"github.com/julz/garden-docker"
 	"github.com/julz/garden-docker/dockercli"
-	"github.com/onsi/gomega/gexec"
+	"github.com/julz/garden-docker/metrics"
+	"github.com/julz/garden-docker/metron"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -31,18 +41,109 @@ func main() {
 		"address to listen on",
 	)
 
+	listenSocketMode := flag.String(
+		"listenSocketMode",
+		"0777",
+		"file mode, in octal, of the socket listened on when -listenNetwork is unix",
+	)
+
+	listenSocketOwner := flag.String(
+		"listenSocketOwner",
+		"",
+		"user, by name or id, to own the socket listened on when -listenNetwork is unix (garden-docker's own if empty)",
+	)
+
+	listenSocketGroup := flag.String(
+		"listenSocketGroup",
+		"",
+		"group, by name or id, to own the socket listened on when -listenNetwork is unix (garden-docker's own if empty)",
+	)
+
+	listenCertFile := flag.String(
+		"listenCertFile",
+		"",
+		"PEM certificate for the garden server to present, which then only accepts mutually-authenticated TLS connections",
+	)
+
+	listenKeyFile := flag.String(
+		"listenKeyFile",
+		"",
+		"PEM key of -listenCertFile",
+	)
+
+	listenCACert := flag.String(
+		"listenCACert",
+		"",
+		"PEM CA certificate client certificates must be signed by",
+	)
+
+	auditLogPath := flag.String(
+		"auditLog",
+		"",
+		"file to append a record of every create, destroy, run, net in and stream in to, with the client which asked for it (disabled if empty)",
+	)
+
 	depotDir := flag.String(
 		"depotDir",
 		"/var/vcap/data/gardendocker/depot",
 		"depot directory to store containers in",
 	)
 
+	defaultRootFS := flag.String(
+		"defaultRootFS",
+		"docker:///busybox",
+		"rootfs to use for containers which do not specify one (pulled at startup)",
+	)
+
+	tenantRootFSConfig := flag.String(
+		"tenantRootFSConfig",
+		"",
+		"path to a JSON file mapping the value of a container property (e.g. a space guid) to the default rootfs for that tenant",
+	)
+
+	rootFSRewriteConfig := flag.String(
+		"rootFSRewriteConfig",
+		"",
+		"path to a JSON file of rootfs URI prefix rewrites (e.g. to redirect images to an internal mirror)",
+	)
+
+	registryCredentials := flag.String(
+		"registryCredentials",
+		"",
+		"path to a JSON file of usernames and passwords by registry host, for pulling images from private registries",
+	)
+
+	preloadImages := flag.String(
+		"preloadImages",
+		"",
+		"comma-separated rootfs URIs (e.g. docker:///busybox) whose images to pull in the background at startup",
+	)
+
+	var insecureDockerRegistries stringFlags
+	flag.Var(
+		&insecureDockerRegistries,
+		"insecureDockerRegistry",
+		"registry (host:port) to pull from over plain HTTP, which dockerd must also be configured to trust; may be given more than once",
+	)
+
+	dockerRegistryMirror := flag.String(
+		"dockerRegistryMirror",
+		"",
+		"host of a pull-through cache of docker hub to pull images from, falling back to docker hub",
+	)
+
 	containerGraceTime := flag.Duration(
 		"containerGraceTime",
 		0,
 		"time after which to destroy idle containers",
 	)
 
+	stopGracePeriod := flag.Duration(
+		"stopGracePeriod",
+		10*time.Second,
+		"time a container's processes are given to exit after SIGTERM when it is stopped, before they are killed",
+	)
+
 	portPoolStart := flag.Uint(
 		"portPoolStart",
 		61001,
@@ -55,55 +156,1133 @@ func main() {
 		"size of port pool used for mapped container ports",
 	)
 
+	enforceDiskLimits := flag.Bool(
+		"enforceDiskLimits",
+		false,
+		"enforce disk limits with XFS project quotas on each container's writable layer (needs overlay on XFS mounted with pquota)",
+	)
+
+	defaultCPUShares := flag.Uint64(
+		"defaultCPUShares",
+		0,
+		"cpu shares containers start with until their cpu limit is set (docker's default of 1024 if 0)",
+	)
+
+	reservedMemory := flag.Uint64(
+		"reservedMemory",
+		0,
+		"memory (in bytes) to reserve for the host, which containers may not use",
+	)
+
+	reservedDisk := flag.Uint64(
+		"reservedDisk",
+		0,
+		"disk space (in bytes) on the depot filesystem to reserve for the host, which containers may not use",
+	)
+
+	reservedCPUs := flag.Uint64(
+		"reservedCPUs",
+		0,
+		"number of CPUs to reserve for the host: containers are kept off the first this many CPUs",
+	)
+
+	scrubOnDestroy := flag.Bool(
+		"scrubOnDestroy",
+		false,
+		"overwrite each container's writable layer and depot directory with zeros when it is destroyed",
+	)
+
+	processOutputQuota := flag.Int64(
+		"processOutputQuota",
+		0,
+		"spool the output of each container's processes to its depot directory, keeping at most this many bytes per container (0 disables spooling)",
+	)
+
+	skipNetworkSetup := flag.Bool(
+		"skipNetworkSetup",
+		false,
+		"never touch iptables, leaving port forwarding to an external network manager",
+	)
+
+	dockerBridge := flag.String(
+		"dockerBridge",
+		"docker0",
+		"host bridge interface containers' docker network uses, which port forwarding rules apply to",
+	)
+
+	dockerNetwork := flag.String(
+		"dockerNetwork",
+		"",
+		"docker network to start containers on (docker's default bridge network if empty)",
+	)
+
+	subnetPool := flag.String(
+		"subnetPool",
+		"",
+		"CIDR to hand out container IPs from, which must be within the subnet of -dockerNetwork (docker chooses IPs if empty)",
+	)
+
+	externalIP := flag.String(
+		"externalIP",
+		"",
+		"host IP to forward ports from for NetIn, and to report as containers' external IP (found from -externalInterface, or the host's interfaces, if empty)",
+	)
+
+	externalInterface := flag.String(
+		"externalInterface",
+		"",
+		"host interface whose first IPv4 address is the external IP, if -externalIP is not set",
+	)
+
+	mtu := flag.Int(
+		"mtu",
+		0,
+		"MTU to set on containers' interfaces, the host ends of their veth pairs and -dockerBridge, e.g. 1450 under a VXLAN overlay (docker's if 0)",
+	)
+
+	enableIPv6 := flag.Bool(
+		"ipv6",
+		false,
+		"also forward ports to, and restrict the egress of, containers' IPv6 addresses, using ip6tables",
+	)
+
+	subnetPoolIPv6 := flag.String(
+		"subnetPoolIPv6",
+		"",
+		"IPv6 CIDR to hand out container IPv6 addresses from, which must be within the IPv6 subnet of -dockerNetwork (docker chooses them if empty)",
+	)
+
+	externalIPv6 := flag.String(
+		"externalIPv6",
+		"",
+		"host IPv6 address to forward ports from for NetIn (any of the host's addresses if empty)",
+	)
+
+	networkPlugin := flag.String(
+		"networkPlugin",
+		"",
+		"path to a plugin to run, with the container as JSON on stdin, to connect containers to the network (\"up\") and disconnect them (\"down\")",
+	)
+
+	cniConfigDir := flag.String(
+		"cniConfigDir",
+		"",
+		"directory of CNI network configurations; if set, containers are started without a docker network and connected to the first configured network by its CNI plugins",
+	)
+
+	cniPluginDirs := flag.String(
+		"cniPluginDir",
+		"/opt/cni/bin",
+		"comma-separated directories to find CNI plugins in",
+	)
+
+	cniInterface := flag.String(
+		"cniInterface",
+		"eth0",
+		"name of the interface CNI plugins create in each container",
+	)
+
+	denyInterContainerTraffic := flag.Bool(
+		"denyInterContainerTraffic",
+		false,
+		"reject traffic between containers on -dockerBridge unless the sender has a NetOut rule for the receiver's IP within -containerSubnet",
+	)
+
+	containerSubnet := flag.String(
+		"containerSubnet",
+		"",
+		"CIDR of the containers' docker network, for -denyInterContainerTraffic (-subnetPool if empty)",
+	)
+
+	var dnsServers stringFlags
+	flag.Var(
+		&dnsServers,
+		"dnsServer",
+		"IP of a name server to put in containers' resolv.conf in place of docker's; may be given more than once",
+	)
+
+	additionalHostEntries := flag.String(
+		"additionalHostEntries",
+		"",
+		"comma-separated entries (\"ip name [alias...]\") to put in containers' /etc/hosts in place of docker's",
+	)
+
+	denyNetworks := flag.String(
+		"denyNetworks",
+		"",
+		"comma-separated CIDRs containers may not send traffic to unless allowed by NetOut, e.g. 0.0.0.0/0 to deny all egress by default",
+	)
+
+	selfTest := flag.Bool(
+		"selfTest",
+		false,
+		"on startup, create a container, run a process and map a port in it and destroy it, failing pings until this passes",
+	)
+
+	initBinDir := flag.String(
+		"initBinDir",
+		"",
+		"directory of alternative init binaries which containers may ask for with the garden-docker.init property (disabled if empty)",
+	)
+
+	initdBin := flag.String(
+		"initdBin",
+		"",
+		"static initd binary to run in containers (the one built into garden-docker if empty)",
+	)
+
+	doshBin := flag.String(
+		"doshBin",
+		"",
+		"dosh binary which processes are run in containers through (the one built into garden-docker if empty)",
+	)
+
+	iodaemonBin := flag.String(
+		"iodaemonBin",
+		"",
+		"iodaemon binary which holds the stdio of processes run in containers (the one built into garden-docker if empty)",
+	)
+
+	initdArchDir := flag.String(
+		"initdArchDir",
+		"",
+		"directory of initd binaries built for other architectures, named initd-<GOARCH> (e.g. initd-arm64), to run in containers of images for those architectures",
+	)
+
+	maxScratchTmpfs := flag.Uint64(
+		"maxScratchTmpfs",
+		0,
+		"largest tmpfs scratch space, in bytes, a container may ask for (0 disables tmpfs scratch space)",
+	)
+
+	metricsAddr := flag.String(
+		"metricsAddr",
+		"",
+		"address to serve prometheus metrics on (disabled if empty)",
+	)
+
+	reconcileInterval := flag.Duration(
+		"reconcileInterval",
+		30*time.Second,
+		"how often to reconcile the containers garden knows about with those docker knows about (0 disables)",
+	)
+
+	depotGCInterval := flag.Duration(
+		"depotGCInterval",
+		10*time.Minute,
+		"how often, besides on startup, to remove depot directories which belong to no container (0 disables)",
+	)
+
+	depotGCDryRun := flag.Bool(
+		"depotGCDryRun",
+		false,
+		"only log the depot directories which would be removed as belonging to no container",
+	)
+
+	gcThreshold := flag.Float64(
+		"gcThreshold",
+		0,
+		"percentage of the disk docker keeps images on in use above which images no container uses are removed, least recently used first (0 disables)",
+	)
+
+	dockerDataRoot := flag.String(
+		"dockerDataRoot",
+		"/var/lib/docker",
+		"directory docker keeps its images in, whose disk -gcThreshold applies to",
+	)
+
+	dropsondeDestination := flag.String(
+		"dropsondeDestination",
+		"",
+		"address of the metron agent to emit dropsonde metrics to, e.g. localhost:3457 (disabled if empty)",
+	)
+
+	dropsondeOrigin := flag.String(
+		"dropsondeOrigin",
+		"garden-docker",
+		"origin of the dropsonde metrics emitted",
+	)
+
+	debugAddr := flag.String(
+		"debugAddr",
+		"",
+		"private address to serve pprof profiles and expvars on (disabled if empty)",
+	)
+
+	adminAddr := flag.String(
+		"adminAddr",
+		"",
+		"private address to serve operator-only endpoints such as bulk destroy and container logs on (disabled if empty)",
+	)
+
+	bulkDestroyConcurrency := flag.Int(
+		"bulkDestroyConcurrency",
+		10,
+		"maximum number of containers to destroy at once during a bulk destroy",
+	)
+
+	maxContainers := flag.Uint64(
+		"maxContainers",
+		1000,
+		"maximum number of containers; creates beyond this are refused (0 for no limit)",
+	)
+
+	bulkConcurrency := flag.Int(
+		"bulkConcurrency",
+		10,
+		"maximum number of containers to gather info or metrics for at once in a bulk info or bulk metrics call",
+	)
+
+	fdAlarmThreshold := flag.Int(
+		"fdAlarmThreshold",
+		0,
+		"log an error when garden-docker has more than this many file descriptors open (0 disables)",
+	)
+
+	cleanupOnExit := flag.String(
+		"cleanupOnExit",
+		"",
+		"on SIGTERM, 'stop' or 'destroy' every container before exiting, so that nothing outlives garden-docker (disabled if empty)",
+	)
+
+	drainTimeout := flag.Duration(
+		"drainTimeout",
+		0,
+		"on SIGTERM or SIGUSR1, how long to wait for the processes running in containers to exit before shutting down (0 does not wait)",
+	)
+
+	destroyContainersOnExit := flag.Bool(
+		"destroyContainersOnExit",
+		false,
+		"on SIGTERM, destroy every container, with its depot directory and iptables rules, and any other garden-owned docker container before exiting (the same as -cleanupOnExit=destroy)",
+	)
+
+	dockerAPIVersion := flag.String(
+		"dockerAPIVersion",
+		"",
+		"docker API version to use for every docker command, e.g. 1.24 (negotiated with the daemon if empty)",
+	)
+
+	dockerRetryInitialBackoff := flag.Duration(
+		"dockerRetryInitialBackoff",
+		500*time.Millisecond,
+		"wait before retrying a docker command which failed for a transient reason, doubling after each attempt",
+	)
+
+	dockerRetryMaxBackoff := flag.Duration(
+		"dockerRetryMaxBackoff",
+		10*time.Second,
+		"longest wait between attempts at a docker command",
+	)
+
+	dockerRetryDeadline := flag.Duration(
+		"dockerRetryDeadline",
+		2*time.Minute,
+		"total time to spend retrying a docker command, or all of a create's docker commands, including waits (0 disables retries)",
+	)
+
+	seccompProfile := flag.String(
+		"seccompProfile",
+		"",
+		"seccomp profile file to run unprivileged containers with (docker's default profile if empty)",
+	)
+
+	seccompProfileDir := flag.String(
+		"seccompProfileDir",
+		"",
+		"directory of alternative seccomp profiles which containers may ask for with the garden-docker.seccomp-profile property (disabled if empty)",
+	)
+
+	seccompPermissive := flag.Bool(
+		"seccompPermissive",
+		false,
+		"run containers without seccomp, for debugging",
+	)
+
+	allowedDevices := flag.String(
+		"allowedDevices",
+		strings.Join(gardendocker.DefaultAllowedDevices, ","),
+		"comma separated devices cgroup rules (e.g. \"c 1:3 rwm\") for the only device nodes unprivileged containers may use (docker's defaults if empty)",
+	)
+
+	apparmorProfile := flag.String(
+		"apparmorProfile",
+		gardendocker.DefaultAppArmorProfile,
+		"AppArmor profile to confine unprivileged containers with, on hosts with AppArmor; garden-docker loads its own default profile, others must already be loaded (docker's default profile if empty)",
+	)
+
+	userNamespaceRemap := flag.String(
+		"userNamespaceRemap",
+		"",
+		"the user dockerd's --userns-remap names (e.g. dockremap), so that unprivileged containers are left in its user namespace and privileged ones taken out of it (disabled if empty)",
+	)
+
+	dockerCLI := flag.Bool(
+		"dockerCLI",
+		false,
+		"run the docker cli for every docker command rather than talking to dockerd over its API",
+	)
+
+	dockerHost := flag.String(
+		"dockerHost",
+		dockercli.DefaultHost,
+		"address of the docker daemon to manage, as unix:///path/to/socket or tcp://host:port",
+	)
+
+	dockerTLSCert := flag.String(
+		"dockerTLSCert",
+		"",
+		"PEM client certificate to present to a docker daemon which requires TLS",
+	)
+
+	dockerTLSKey := flag.String(
+		"dockerTLSKey",
+		"",
+		"PEM key of -dockerTLSCert",
+	)
+
+	dockerCACert := flag.String(
+		"dockerCACert",
+		"",
+		"PEM CA certificate to verify the docker daemon against (the host's roots if empty)",
+	)
+
+	dockerPidFile := flag.String(
+		"dockerPidFile",
+		"/var/run/docker.pid",
+		"pid file of the docker daemon, to notice it restarting and recover containers (ignored for a tcp -dockerHost; empty disables)",
+	)
+
 	cf_lager.AddFlags(flag.CommandLine)
 	flag.Parse()
 
 	logger, _ := cf_lager.New("garden-docker")
+
+	if *cleanupOnExit != "" && *cleanupOnExit != "stop" && *cleanupOnExit != "destroy" {
+		logger.Fatal("invalid-cleanup-on-exit", fmt.Errorf("want 'stop' or 'destroy', got %q", *cleanupOnExit))
+	}
+
+	if *destroyContainersOnExit {
+		if *cleanupOnExit == "stop" {
+			logger.Fatal("invalid-cleanup-on-exit", fmt.Errorf("-destroyContainersOnExit conflicts with -cleanupOnExit=stop"))
+		}
+
+		*cleanupOnExit = "destroy"
+	}
+
+	activated, err := gardendocker.ActivationListeners()
+	if err != nil {
+		logger.Fatal("socket-activation-failed", err)
+	}
 	runner := &logging.Runner{
 		CommandRunner: linux_command_runner.New(),
 		Logger:        logger,
 	}
 
-	os.Setenv("CGO_ENABLED", "0")
-	initdPath, err := gexec.Build("github.com/julz/garden-docker/cmd/initd", "-a", "-installsuffix", "static")
+	registry := metrics.NewRegistry()
+	if *metricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*metricsAddr, registry); err != nil {
+				logger.Error("metrics-server-failed", err)
+			}
+		}()
+	}
+
+	if *debugAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*debugAddr, debugHandler()); err != nil {
+				logger.Error("debug-server-failed", err)
+			}
+		}()
+	}
+
+	fdAlarm := &gardendocker.FDAlarm{
+		Threshold: *fdAlarmThreshold,
+		Count:     gardendocker.OpenFDs,
+		Logger:    logger.Session("fds"),
+	}
+
+	registry.NewGaugeFunc("open_fds", "Number of file descriptors garden-docker has open.", func() float64 {
+		return float64(fdAlarm.Check())
+	})
+
+	if *fdAlarmThreshold > 0 {
+		go fdAlarm.CheckEvery(10 * time.Second)
+	}
+
+	initdPath, err := initdBinary(*initdBin, *depotDir)
 	if err != nil {
-		panic(err)
+		logger.Fatal("initd-failed", err)
 	}
 
-	backend := &gardendocker.Backend{
-		Repo: gardendocker.NewRepo(),
-		Creator: &gardendocker.DaemonContainerCreator{
-			DefaultRootfs: "docker:///busybox",
-			InitdPath:     initdPath,
-			Depot:         &gardendocker.ContainerDepot{Dir: *depotDir},
+	doshPath, err := binary("dosh", *doshBin, embeddedDosh, *depotDir)
+	if err != nil {
+		logger.Fatal("dosh-failed", err)
+	}
+
+	iodaemonPath, err := binary("iodaemon", *iodaemonBin, embeddedIodaemon, *depotDir)
+	if err != nil {
+		logger.Fatal("iodaemon-failed", err)
+	}
+
+	resources := &gardendocker.ResourcePool{
+		System: &gardendocker.HostResources{DepotDir: *depotDir},
+		Reserved: gardendocker.Resources{
+			MemoryInBytes: *reservedMemory,
+			DiskInBytes:   *reservedDisk,
+		},
+	}
+
+	containerCPUs, err := gardendocker.UnreservedCPUs(runtime.NumCPU(), int(*reservedCPUs))
+	if err != nil {
+		logger.Fatal("invalid-reserved-cpus", err)
+	}
+
+	dockerMetrics := dockercli.NewMetrics(registry)
+	var dockerRetry *dockercli.RetryPolicy
+	if *dockerRetryDeadline > 0 {
+		dockerRetry = &dockercli.RetryPolicy{
+			InitialBackoff: *dockerRetryInitialBackoff,
+			MaxBackoff:     *dockerRetryMaxBackoff,
+			Deadline:       *dockerRetryDeadline,
+		}
+	}
+
+	dockerTLS := dockercli.TLSFiles{Cert: *dockerTLSCert, Key: *dockerTLSKey, CACert: *dockerCACert}
+
+	var dockerTLSConfig *tls.Config
+	if dockerTLS.Enabled() {
+		if dockerTLSConfig, err = dockerTLS.Config(); err != nil {
+			logger.Fatal("invalid-docker-tls", err)
+		}
+	}
+
+	client := &dockercli.Client{
+		Host:      *dockerHost,
+		TLSConfig: dockerTLSConfig,
+		Logger:    logger.Session("docker"),
+		Metrics:   dockerMetrics,
+
+		APIVersion: *dockerAPIVersion,
+		Retry:      dockerRetry,
+	}
+
+	var dockerRunner dockerClient = client
+	dockerUntil := func(deadline time.Time) gardendocker.DockerRunner { return client.Until(deadline) }
+
+	if *dockerCLI {
+		cli := &dockercli.Runner{
+			Runner:  linux_command_runner.New(),
+			Logger:  logger.Session("docker"),
+			Metrics: dockerMetrics,
+
+			Host: *dockerHost,
+			TLS:  dockerTLS,
+
+			APIVersion: *dockerAPIVersion,
+			Retry:      dockerRetry,
+		}
+
+		dockerRunner = cli
+		dockerUntil = func(deadline time.Time) gardendocker.DockerRunner { return cli.Until(deadline) }
+	}
+
+	// the pid file and /proc only identify a dockerd on this host
+	var dockerDaemon gardendocker.DockerDaemon
+	if *dockerPidFile != "" && !strings.HasPrefix(*dockerHost, "tcp://") {
+		dockerDaemon = &gardendocker.DockerPIDFile{Path: *dockerPidFile}
+	}
+
+	depot := &gardendocker.ContainerDepot{
+		Dir:          *depotDir,
+		DoshPath:     doshPath,
+		IodaemonPath: iodaemonPath,
+	}
+
+	creator := &gardendocker.DaemonContainerCreator{
+		DefaultRootfs: *defaultRootFS,
+		InitdPath:     initdPath,
+		InitBinDir:    *initBinDir,
+		Depot:         depot,
+
+		EnforceDiskLimits: *enforceDiskLimits,
+		DefaultCPUShares:  *defaultCPUShares,
+		CPUs:              containerCPUs,
+		MaxScratchTmpfs:   *maxScratchTmpfs,
+
+		PortPool: port_pool.New(uint32(*portPoolStart), uint32(*portPoolSize)),
+
+		DockerRunner:  dockerRunner,
+		CommandRunner: runner,
+
+		Until:          dockerUntil,
+		CreateDeadline: *dockerRetryDeadline,
+
+		Connections: &gardendocker.ConntrackTable{Path: "/proc/net/nf_conntrack"},
+		Resources:   resources,
+
+		OutputQuota:     *processOutputQuota,
+		InitdTimeout:    30 * time.Second,
+		StopGracePeriod: *stopGracePeriod,
+	}
+
+	iptablesMetrics := gardendocker.NewIPTablesMetrics(registry)
+
+	var chain gardendocker.Chain
+	if *skipNetworkSetup {
+		chain = gardendocker.NoopChain{}
+	} else {
+		chain = &gardendocker.TimedChain{
+			Chain:    &gardendocker.IPTablesChain{Chain: &iptables.Chain{Name: "DOCKER", Bridge: *dockerBridge}},
+			Duration: iptablesMetrics,
+		}
+	}
+
+	if *networkPlugin != "" && *cniConfigDir != "" {
+		logger.Fatal("invalid-network-config", fmt.Errorf("-networkPlugin conflicts with -cniConfigDir"))
+	}
+
+	creator.DockerNetwork = *dockerNetwork
+	creator.ExternalIP = *externalIP
+	if *externalIP == "" && *externalInterface != "" {
+		ip, err := interfaceIP(*externalInterface)
+		if err != nil {
+			logger.Fatal("failed-to-find-external-ip", err)
+		}
+
+		creator.ExternalIP = ip
+	}
+
+	var rules gardendocker.RuleSweepers
+	if !*skipNetworkSetup {
+		creator.ContainerInterface = "eth0"
+		rules = append(rules, &gardendocker.TaggedRules{})
+	}
+
+	if *cniConfigDir != "" && (*dockerNetwork != "" || *subnetPool != "") {
+		logger.Fatal("invalid-network-config", fmt.Errorf("-cniConfigDir conflicts with -dockerNetwork and -subnetPool"))
+	}
+
+	if *subnetPool != "" && *dockerNetwork == "" {
+		logger.Fatal("invalid-network-config", fmt.Errorf("-subnetPool needs -dockerNetwork, since docker only assigns chosen IPs on user-defined networks"))
+	}
+
+	if *subnetPoolIPv6 != "" && *dockerNetwork == "" {
+		logger.Fatal("invalid-network-config", fmt.Errorf("-subnetPoolIPv6 needs -dockerNetwork, since docker only assigns chosen IPs on user-defined networks"))
+	}
+
+	if *enableIPv6 && !*skipNetworkSetup {
+		chain6 := &gardendocker.IP6TablesChain{Name: "garden-docker-dnat", Bridge: *dockerBridge}
+		if err := chain6.Init(); err != nil {
+			logger.Fatal("failed-to-set-up-ip6tables", err)
+		}
 
-			Chain:    &iptables.Chain{"DOCKER", "docker0"},
-			PortPool: port_pool.New(uint32(*portPoolStart), uint32(*portPoolSize)),
+		creator.Chain6 = &gardendocker.TimedChain{Chain: chain6, Duration: iptablesMetrics}
+		creator.ExternalIPv6 = *externalIPv6
+		rules = append(rules, &gardendocker.TaggedRules{IPv6: true})
+	}
+
+	if len(rules) > 0 {
+		creator.Rules = rules
+	}
 
-			DockerRunner:  &dockercli.Runner{runner},
+	if *cniConfigDir != "" {
+		network, err := gardendocker.LoadCNINetwork(*cniConfigDir)
+		if err != nil {
+			logger.Fatal("invalid-cni-config", err)
+		}
+
+		creator.DockerNetwork = "none"
+		if creator.ContainerInterface != "" {
+			creator.ContainerInterface = *cniInterface
+		}
+
+		creator.Networker = &gardendocker.CNINetworker{
+			Chain:         chain,
+			Network:       network,
+			PluginDirs:    splitList(*cniPluginDirs),
+			IfName:        *cniInterface,
+			CommandRunner: runner,
+		}
+	} else if *networkPlugin != "" {
+		creator.Networker = &gardendocker.PluginNetworker{
+			Chain:         chain,
+			Path:          *networkPlugin,
 			CommandRunner: runner,
+		}
+	} else {
+		creator.Networker = &gardendocker.ChainNetworker{Chain: chain}
+	}
+
+	if *mtu != 0 && creator.ContainerInterface != "" {
+		links := &gardendocker.MTU{MTU: *mtu, IfName: creator.ContainerInterface, CommandRunner: runner}
+
+		// CNI plugins set up their own bridges
+		if *cniConfigDir == "" {
+			if err := links.SetBridge(*dockerBridge); err != nil {
+				logger.Fatal("failed-to-set-bridge-mtu", err)
+			}
+		}
+
+		creator.Links = links
+	}
+
+	creator.DNS = gardendocker.DNSConfig{
+		Servers:     dnsServers,
+		HostEntries: splitList(*additionalHostEntries),
+	}
+
+	if err := creator.DNS.Validate(); err != nil {
+		logger.Fatal("invalid-dns-config", err)
+	}
+
+	creator.SeccompProfile = *seccompProfile
+	creator.SeccompProfileDir = *seccompProfileDir
+	if *seccompPermissive {
+		if *seccompProfile != "" {
+			logger.Fatal("invalid-seccomp-config", fmt.Errorf("-seccompPermissive conflicts with -seccompProfile"))
+		}
+
+		logger.Info("seccomp-disabled")
+		creator.SeccompProfile = gardendocker.SeccompUnconfined
+	}
+
+	if *allowedDevices != "" {
+		allowed, err := gardendocker.ParseDeviceRules(*allowedDevices)
+		if err != nil {
+			logger.Fatal("invalid-allowed-devices", err)
+		}
+
+		// the unified hierarchy has no devices files; docker's defaults,
+		// which are much the same as ours, are applied with bpf instead
+		if _, err := os.Stat("/sys/fs/cgroup/devices"); err != nil {
+			logger.Info("devices-cgroup-unavailable", lager.Data{"error": err.Error()})
+		} else {
+			creator.Devices = &gardendocker.DevicesCgroup{DockerRunner: dockerRunner, Allowed: allowed}
+		}
+	}
+
+	apparmor := &gardendocker.AppArmor{CommandRunner: linux_command_runner.New()}
+	if *apparmorProfile != "" && apparmor.Enabled() {
+		if *apparmorProfile == gardendocker.DefaultAppArmorProfile {
+			if err := apparmor.LoadDefault(); err != nil {
+				logger.Fatal("failed-to-load-apparmor-profile", err)
+			}
+		} else if loaded, err := apparmor.Loaded(*apparmorProfile); err != nil {
+			logger.Fatal("failed-to-list-apparmor-profiles", err)
+		} else if !loaded {
+			logger.Fatal("invalid-apparmor-profile", fmt.Errorf("apparmor profile %s is not loaded", *apparmorProfile))
+		}
+
+		creator.AppArmorProfile = *apparmorProfile
+	}
+
+	if *userNamespaceRemap != "" {
+		if creator.UserNamespace, err = gardendocker.LoadUserNamespace(*userNamespaceRemap, "/etc/subuid", "/etc/subgid"); err != nil {
+			logger.Fatal("invalid-user-namespace-remap", err)
+		}
+	}
+
+	if *initdArchDir != "" {
+		if creator.InitdArchPaths, err = gardendocker.LoadInitdArchPaths(*initdArchDir); err != nil {
+			logger.Fatal("invalid-initd-arch-dir", err)
+		}
+	}
+
+	var firewalls gardendocker.Firewalls
+	if *denyNetworks != "" && !*skipNetworkSetup {
+		firewall := &gardendocker.IPTablesFirewall{}
+		firewall6 := &gardendocker.IPTablesFirewall{IPv6: true}
+		for _, cidr := range strings.Split(*denyNetworks, ",") {
+			_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				logger.Fatal("invalid-deny-networks", err)
+			}
+
+			if network.IP.To4() != nil {
+				firewall.DenyNetworks = append(firewall.DenyNetworks, network)
+			} else if *enableIPv6 {
+				firewall6.DenyNetworks = append(firewall6.DenyNetworks, network)
+			} else {
+				logger.Fatal("invalid-deny-networks", fmt.Errorf("IPv6 network %s needs -ipv6", network))
+			}
+		}
+
+		if len(firewall.DenyNetworks) > 0 {
+			if err := firewall.Init(); err != nil {
+				logger.Fatal("failed-to-set-up-firewall", err)
+			}
+
+			firewalls = append(firewalls, firewall)
+		}
+
+		if len(firewall6.DenyNetworks) > 0 {
+			if err := firewall6.Init(); err != nil {
+				logger.Fatal("failed-to-set-up-firewall", err)
+			}
+
+			creator.Firewall6 = &gardendocker.TimedFirewall{Firewall: firewall6, Duration: iptablesMetrics}
+		}
+	}
+
+	if *denyInterContainerTraffic && !*skipNetworkSetup {
+		if *containerSubnet == "" {
+			*containerSubnet = *subnetPool
+		}
+
+		_, subnet, err := net.ParseCIDR(*containerSubnet)
+		if err != nil {
+			logger.Fatal("invalid-container-subnet", fmt.Errorf("-denyInterContainerTraffic needs -containerSubnet or -subnetPool: %s", err))
+		}
+
+		// initialised after the egress firewall, so that its jump from
+		// FORWARD comes first
+		firewall := &gardendocker.InterContainerFirewall{Bridge: *dockerBridge, Subnet: subnet}
+		if err := firewall.Init(); err != nil {
+			logger.Fatal("failed-to-set-up-firewall", err)
+		}
+
+		firewalls = append(firewalls, firewall)
+	}
+
+	if len(firewalls) > 0 {
+		creator.Firewall = &gardendocker.TimedFirewall{Firewall: firewalls, Duration: iptablesMetrics}
+	}
+
+	if *tenantRootFSConfig != "" {
+		if creator.TenantRootfs, err = gardendocker.LoadTenantRootfs(*tenantRootFSConfig); err != nil {
+			logger.Fatal("invalid-tenant-rootfs-config", err)
+		}
+	}
+
+	if *rootFSRewriteConfig != "" {
+		if creator.RootfsRewrites, err = gardendocker.LoadRootfsRewrites(*rootFSRewriteConfig); err != nil {
+			logger.Fatal("invalid-rootfs-rewrite-config", err)
+		}
+	}
+
+	if *registryCredentials != "" {
+		if creator.RegistryCredentials, err = gardendocker.LoadRegistryCredentials(*registryCredentials); err != nil {
+			logger.Fatal("invalid-registry-credentials", err)
+		}
+	}
+
+	creator.RegistryMirror = *dockerRegistryMirror
+	creator.InsecureRegistries = insecureDockerRegistries
+	if err := creator.CheckInsecureRegistries(); err != nil {
+		logger.Fatal("invalid-insecure-registries", err)
+	}
+
+	if err := creator.PullDefaultRootfs(); err != nil {
+		logger.Fatal("invalid-default-rootfs", err)
+	}
+
+	if *scrubOnDestroy {
+		creator.Scrubber = gardendocker.ZeroScrubber{}
+	}
+
+	repo := gardendocker.NewRepo()
+
+	if *subnetPool != "" {
+		pool, err := gardendocker.NewIPPool(*subnetPool)
+		if err != nil {
+			logger.Fatal("invalid-subnet-pool", err)
+		}
+
+		pool.InUse = func(ip string) bool {
+			_, err := repo.FindByIP(ip)
+			return err == nil
+		}
+
+		creator.IPPool = pool
+	}
+
+	if *subnetPoolIPv6 != "" {
+		pool, err := gardendocker.NewIPPool(*subnetPoolIPv6)
+		if err != nil {
+			logger.Fatal("invalid-subnet-pool", err)
+		}
+
+		pool.InUse = func(ip string) bool {
+			_, err := repo.FindByIP(ip)
+			return err == nil
+		}
+
+		creator.IPv6Pool = pool
+	}
+
+	events := gardendocker.NewEventBus()
+	creator.Events = events
+
+	backend := &gardendocker.Backend{
+		Repo:      repo,
+		Creator:   creator,
+		Destroyer: creator,
+		Adopter:   creator,
+		Stopper:   creator,
+		Leftovers: creator,
+		Restorer:  creator,
+		Resources: resources,
+
+		ReapInterval: 10 * time.Second,
+
+		Reconciler: &gardendocker.Reconciler{
+			Repo:        repo,
+			Docker:      creator,
+			Daemon:      dockerDaemon,
+			Recoverer:   creator,
+			Destroyer:   creator,
+			Corrections: gardendocker.NewReconcilerMetrics(registry),
+			Events:      events,
+			Logger:      logger,
 		},
+		ReconcileInterval: *reconcileInterval,
+
+		Metrics: gardendocker.NewBackendMetrics(registry),
+		Events:  events,
+
+		MaxContainers:   *maxContainers,
+		BulkConcurrency: *bulkConcurrency,
+
+		SelfTest:         *selfTest,
+		SelfTestInterval: 10 * time.Second,
+
+		PreloadImages: splitList(*preloadImages),
+		Puller:        creator,
+
+		Logger: logger,
+	}
+
+	registry.NewGaugeFunc("containers", "Number of containers garden-docker holds.", func() float64 {
+		return float64(len(repo.All()))
+	})
+
+	registry.NewGaugeFunc("max_containers", "Maximum number of containers garden-docker will hold (0 for no limit).", func() float64 {
+		return float64(*maxContainers)
+	})
+
+	if *depotGCInterval > 0 {
+		backend.DepotGC = &gardendocker.DepotGC{
+			Depot:  depot,
+			Repo:   repo,
+			Docker: creator,
+			DryRun: *depotGCDryRun,
+			Logger: logger,
+		}
+		backend.DepotGCInterval = *depotGCInterval
+	}
+
+	backend.Rules = creator.Rules
+
+	if *dropsondeDestination != "" {
+		emitter, err := metron.Dial(*dropsondeDestination, *dropsondeOrigin)
+		if err != nil {
+			logger.Fatal("invalid-dropsonde-destination", err)
+		}
+
+		backend.Emitter = emitter
+		go emitter.EmitEvery(30*time.Second, map[string]func() float64{
+			"NumContainers": func() float64 { return float64(len(repo.All())) },
+		})
+	}
+
+	if *gcThreshold > 0 {
+		creator.ImageGC = &gardendocker.ImageGC{
+			Repo:      repo,
+			Docker:    dockerRunner,
+			Threshold: *gcThreshold,
+			DiskUsage: func() (float64, error) { return gardendocker.FilesystemUsage(*dockerDataRoot) },
+			Grace:     *dockerRetryDeadline,
+			Logger:    logger,
+		}
+
+		go creator.ImageGC.CollectEvery(time.Minute)
+	}
+
+	if *adminAddr != "" {
+		admin := &gardendocker.AdminHandler{
+			Backend:     backend,
+			Concurrency: *bulkDestroyConcurrency,
+			Logs:        creator,
+			Logger:      logger.Session("admin"),
+		}
+
+		go func() {
+			if err := http.ListenAndServe(*adminAddr, admin); err != nil {
+				logger.Error("admin-server-failed", err)
+			}
+		}()
 	}
 
-	server := server.New(*listenNetwork, *listenAddr, *containerGraceTime, backend, logger)
+	socketActivated := len(activated) > 0
+
+	// the garden server would briefly leave its socket open to everyone, so
+	// garden-docker listens on it itself
+	if !socketActivated && *listenNetwork == "unix" {
+		socket := gardendocker.UnixSocket{Path: *listenAddr}
+
+		mode, err := strconv.ParseUint(*listenSocketMode, 8, 32)
+		if err == nil && mode > 0777 {
+			err = fmt.Errorf("mode %s has more than permission bits", *listenSocketMode)
+		}
+
+		if err != nil {
+			logger.Fatal("invalid-listen-socket-mode", err)
+		}
+		socket.Mode = os.FileMode(mode)
+
+		if socket.UID, err = gardendocker.LookupUID(*listenSocketOwner); err != nil {
+			logger.Fatal("invalid-listen-socket-owner", err)
+		}
+
+		if socket.GID, err = gardendocker.LookupGID(*listenSocketGroup); err != nil {
+			logger.Fatal("invalid-listen-socket-group", err)
+		}
+
+		listener, err := socket.Listen()
+		if err != nil {
+			logger.Fatal("failed-to-listen", err)
+		}
+
+		activated = append(activated, listener)
+	}
+
+	listenTLS := gardendocker.ListenTLSFiles{Cert: *listenCertFile, Key: *listenKeyFile, CACert: *listenCACert}
+
+	var listenTLSConfig *tls.Config
+	if listenTLS.Enabled() {
+		if listenTLSConfig, err = listenTLS.Config(); err != nil {
+			logger.Fatal("invalid-listen-tls", err)
+		}
+	}
+
+	// the audit log watches the connections garden-docker proxies to the
+	// server, so auditing means listening too
+	var auditLog *gardendocker.AuditLog
+	if *auditLogPath != "" {
+		if auditLog, err = gardendocker.OpenAuditLog(*auditLogPath); err != nil {
+			logger.Fatal("failed-to-open-audit-log", err)
+		}
+	}
+
+	if len(activated) == 0 && (listenTLS.Enabled() || auditLog != nil) {
+		listener, err := net.Listen(*listenNetwork, *listenAddr)
+		if err != nil {
+			logger.Fatal("failed-to-listen", err)
+		}
+
+		activated = append(activated, listener)
+	}
+
+	if listenTLS.Enabled() {
+		for i, listener := range activated {
+			activated[i] = tls.NewListener(listener, listenTLSConfig)
+		}
+	}
+
+	// when socket-activated, serving TLS, auditing or on a unix socket, the
+	// server listens privately and garden-docker's own sockets are proxied to
+	// it
+	serverNetwork, serverAddr := *listenNetwork, *listenAddr
+	if len(activated) > 0 {
+		serverNetwork, serverAddr = "unix", filepath.Join(*depotDir, "garden-server.sock")
+	}
+
+	server := server.New(serverNetwork, serverAddr, *containerGraceTime, backend, logger)
 	if err := server.Start(); err != nil {
 		logger.Fatal("failed-to-start-server", err)
 	}
 
+	for _, listener := range activated {
+		proxy := &gardendocker.ActivationProxy{
+			Listener: listener,
+			Network:  serverNetwork,
+			Addr:     serverAddr,
+			Logger:   logger.Session("activation"),
+			Audit:    auditLog,
+		}
+
+		go proxy.Serve()
+	}
+
 	logger.Info("started", lager.Data{
-		"network": *listenNetwork,
-		"addr":    *listenAddr,
+		"network":         *listenNetwork,
+		"addr":            *listenAddr,
+		"socketActivated": socketActivated,
+		"tls":             listenTLS.Enabled(),
+		"audit":           auditLog != nil,
 	})
 
 	signals := make(chan os.Signal, 1)
 
 	go func() {
-		<-signals
+		sig := <-signals
+		if sig == syscall.SIGTERM || sig == syscall.SIGUSR1 {
+			backend.Drain(*drainTimeout)
+		}
+
 		server.Stop()
+
+		if sig == syscall.SIGTERM && *cleanupOnExit != "" {
+			logger.Info("cleaning-up", lager.Data{"mode": *cleanupOnExit})
+			backend.Cleanup(*cleanupOnExit == "destroy", *bulkDestroyConcurrency)
+		}
+
 		os.Exit(0)
 	}()
 
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
 
 	select {}
 }
+
+// dockerClient is what garden-docker needs from docker, which either the
+// Engine API client or the docker cli runner provides.
+type dockerClient interface {
+	gardendocker.DockerRunner
+	gardendocker.DockerImages
+}
+
+type stringFlags []string
+
+func (s *stringFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// interfaceIP returns the first IPv4 address of the named interface.
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("interface %s has no IPv4 address", name)
+}
@@ -6,30 +6,44 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/cloudfoundry-incubator/garden-linux/container_daemon"
-	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
 	"github.com/cloudfoundry-incubator/garden-linux/containerizer/system"
-	"github.com/pivotal-golang/lager"
+	"github.com/julz/garden-docker/daemon"
 )
 
 func main() {
-	logger := lager.NewLogger("initd")
 	socketPath := flag.String("socketPath", "/run/initd.sock", "path to listen for spawn requests on")
 	//unmountPath := flag.String("unmountAfterListening", "/run", "directory to unmount after succesfully listening on -socketPath")
 	flag.String("unmountAfterListening", "/run", "directory to unmount after succesfully listening on -socketPath")
+	daemonUID := flag.Int("daemonUID", -1, "host uid of garden-docker, the only process allowed to connect to -socketPath from outside the container (anyone may connect if negative)")
 	flag.Parse()
 
-	reaper := system.StartReaper(logger)
+	// as pid 1, initd reaps every orphan in the container as well as the
+	// processes it spawns
+	reaper := daemon.StartReaper()
 	defer reaper.Stop()
 
-	listener := &unix_socket.Listener{SocketPath: *socketPath}
+	listener := &daemon.Listener{SocketPath: *socketPath}
 
-	daemon := container_daemon.ContainerDaemon{
+	if *daemonUID >= 0 {
+		uid, err := daemon.MapUID("/proc/self/uid_map", *daemonUID)
+		if err != nil {
+			fmt.Printf("map uid %d: %s", *daemonUID, err)
+			os.Exit(1)
+		}
+
+		listener.Peer = &daemon.PeerCredentials{UID: uid, OutsidePIDNamespace: true}
+	}
+
+	containerDaemon := daemon.ContainerDaemon{
 		Listener: listener,
 		Users:    &system.LibContainerUser{},
 		Runner:   reaper,
+		Env:      os.Environ(),
 	}
 
+	// remove the socket left behind if the container was restarted
+	os.Remove(*socketPath)
+
 	// open up the listener socket
 	if err := listener.Init(); err != nil {
 		fmt.Printf("listen on %s: %s", *socketPath, err)
@@ -43,7 +57,7 @@ func main() {
 	// }
 
 	// let daemon take over and start listening for incoming start process requests
-	if err := daemon.Run(); err != nil {
+	if err := containerDaemon.Run(); err != nil {
 		fmt.Println(err)
 		os.Exit(3)
 	}
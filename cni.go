@@ -0,0 +1,250 @@
+package gardendocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// CNINetwork is a network configuration for CNI plugins, read from a .conf
+// file holding a single plugin's configuration or a .conflist file holding
+// a chain of them.
+type CNINetwork struct {
+	Name       string
+	CNIVersion string
+
+	// Plugins are the configurations of the plugins in the chain, in the
+	// order they are added.
+	Plugins []map[string]interface{}
+}
+
+// LoadCNINetwork reads the first network configuration, in lexical order, in
+// dir, as kubelet does.
+func LoadCNINetwork(dir string) (*CNINetwork, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load cni config: %s", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".conf", ".conflist", ".json":
+			names = append(names, entry.Name())
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("load cni config: no network configuration in %s", dir)
+	}
+
+	sort.Strings(names)
+	path := filepath.Join(dir, names[0])
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load cni config: %s", err)
+	}
+
+	var conf struct {
+		Name       string                   `json:"name"`
+		CNIVersion string                   `json:"cniVersion"`
+		Plugins    []map[string]interface{} `json:"plugins"`
+	}
+
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("load cni config %s: %s", path, err)
+	}
+
+	network := &CNINetwork{Name: conf.Name, CNIVersion: conf.CNIVersion, Plugins: conf.Plugins}
+	if filepath.Ext(path) != ".conflist" {
+		var plugin map[string]interface{}
+		json.Unmarshal(data, &plugin)
+		network.Plugins = []map[string]interface{}{plugin}
+	}
+
+	if network.Name == "" || len(network.Plugins) == 0 {
+		return nil, fmt.Errorf("load cni config %s: want a name and at least one plugin", path)
+	}
+
+	for _, plugin := range network.Plugins {
+		if _, ok := plugin["type"].(string); !ok {
+			return nil, fmt.Errorf("load cni config %s: plugin has no type", path)
+		}
+	}
+
+	return network, nil
+}
+
+// CNINetworker connects containers to a CNI network, running its plugins
+// with ADD once a container is running and DEL before it is removed, and
+// reports the first address the plugins give the container as its IP. The
+// containers should be started without a docker network, since the plugins
+// create their interface. Ports are still forwarded through Chain.
+type CNINetworker struct {
+	Chain
+
+	Network *CNINetwork
+
+	// PluginDirs are searched, in order, for the plugins' executables.
+	PluginDirs []string
+
+	// IfName is the name of the interface the plugins create in the
+	// container.
+	IfName string
+
+	CommandRunner command_runner.CommandRunner
+}
+
+func (n *CNINetworker) Up(container NetworkContainer) (string, error) {
+	netns := fmt.Sprintf("/proc/%d/ns/net", container.Pid)
+
+	var result json.RawMessage
+	for i, plugin := range n.Network.Plugins {
+		out, err := n.run("ADD", plugin, container.DockerID, netns, result)
+		if err != nil {
+			// the plugins which succeeded may have left state behind
+			for j := i - 1; j >= 0; j-- {
+				n.run("DEL", n.Network.Plugins[j], container.DockerID, netns, nil)
+			}
+
+			return "", err
+		}
+
+		result = out
+	}
+
+	return cniResultIP(result)
+}
+
+// Down runs the plugins with DEL, in reverse order. The container's network
+// namespace may already be gone, so the plugins are not told it, and must
+// clean up by the container's id.
+func (n *CNINetworker) Down(container NetworkContainer) error {
+	var errs []string
+	for i := len(n.Network.Plugins) - 1; i >= 0; i-- {
+		if _, err := n.run("DEL", n.Network.Plugins[i], container.DockerID, "", nil); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (n *CNINetworker) run(command string, plugin map[string]interface{}, containerID, netns string, prevResult json.RawMessage) ([]byte, error) {
+	pluginType := plugin["type"].(string)
+
+	path, err := n.find(pluginType)
+	if err != nil {
+		return nil, fmt.Errorf("cni %s: %s", command, err)
+	}
+
+	conf := make(map[string]interface{}, len(plugin)+3)
+	for k, v := range plugin {
+		conf[k] = v
+	}
+
+	conf["name"] = n.Network.Name
+	conf["cniVersion"] = n.Network.CNIVersion
+	if prevResult != nil {
+		conf["prevResult"] = prevResult
+	}
+
+	input, err := json.Marshal(conf)
+	if err != nil {
+		return nil, fmt.Errorf("cni %s: %s", command, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"CNI_COMMAND="+command,
+		"CNI_CONTAINERID="+containerID,
+		"CNI_NETNS="+netns,
+		"CNI_IFNAME="+n.IfName,
+		"CNI_PATH="+strings.Join(n.PluginDirs, string(os.PathListSeparator)),
+	)
+
+	if err := n.CommandRunner.Run(cmd); err != nil {
+		// plugins report errors as JSON on stdout
+		var cniErr struct {
+			Msg     string `json:"msg"`
+			Details string `json:"details"`
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if json.Unmarshal(stdout.Bytes(), &cniErr) == nil && cniErr.Msg != "" {
+			msg = strings.TrimSpace(cniErr.Msg + " " + cniErr.Details)
+		}
+
+		return nil, fmt.Errorf("cni %s %s: %s: %s", command, pluginType, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (n *CNINetworker) find(pluginType string) (string, error) {
+	for _, dir := range n.PluginDirs {
+		path := filepath.Join(dir, pluginType)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("plugin %s not found in %s", pluginType, strings.Join(n.PluginDirs, ", "))
+}
+
+// cniResultIP returns the first IP address in a CNI result, in either the
+// current format or the 0.2.0 one, or "" if it has none.
+func cniResultIP(result []byte) (string, error) {
+	if len(bytes.TrimSpace(result)) == 0 {
+		return "", nil
+	}
+
+	var parsed struct {
+		IPs []struct {
+			Address string `json:"address"`
+		} `json:"ips"`
+		IP4 *struct {
+			IP string `json:"ip"`
+		} `json:"ip4"`
+	}
+
+	if err := json.Unmarshal(result, &parsed); err != nil {
+		return "", fmt.Errorf("cni: invalid result: %s", err)
+	}
+
+	address := ""
+	if len(parsed.IPs) > 0 {
+		address = parsed.IPs[0].Address
+	} else if parsed.IP4 != nil {
+		address = parsed.IP4.IP
+	}
+
+	if address == "" {
+		return "", nil
+	}
+
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		return "", fmt.Errorf("cni: invalid result: %s", err)
+	}
+
+	return ip.String(), nil
+}
@@ -0,0 +1,224 @@
+package gardendocker_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CNI", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cni")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0755)).To(Succeed())
+	}
+
+	Describe("LoadCNINetwork", func() {
+		It("loads a single plugin's configuration", func() {
+			writeFile("10-bridge.conf", `{"cniVersion":"0.4.0","name":"mynet","type":"bridge","bridge":"cni0"}`)
+
+			network, err := LoadCNINetwork(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network.Name).To(Equal("mynet"))
+			Expect(network.CNIVersion).To(Equal("0.4.0"))
+			Expect(network.Plugins).To(HaveLen(1))
+			Expect(network.Plugins[0]).To(HaveKeyWithValue("bridge", "cni0"))
+		})
+
+		It("loads a chain of plugins", func() {
+			writeFile("10-mynet.conflist", `{"cniVersion":"0.4.0","name":"mynet","plugins":[{"type":"bridge"},{"type":"portmap"}]}`)
+
+			network, err := LoadCNINetwork(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network.Plugins).To(HaveLen(2))
+			Expect(network.Plugins[1]).To(HaveKeyWithValue("type", "portmap"))
+		})
+
+		It("loads the first configuration in lexical order, ignoring other files", func() {
+			writeFile("20-other.conf", `{"name":"other","type":"bridge"}`)
+			writeFile("10-mynet.conf", `{"name":"mynet","type":"bridge"}`)
+			writeFile("00-README", `not a configuration`)
+
+			network, err := LoadCNINetwork(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network.Name).To(Equal("mynet"))
+		})
+
+		It("fails when there is no configuration", func() {
+			_, err := LoadCNINetwork(dir)
+			Expect(err).To(MatchError(ContainSubstring("no network configuration")))
+		})
+
+		It("fails when a plugin has no type", func() {
+			writeFile("10-mynet.conf", `{"name":"mynet"}`)
+
+			_, err := LoadCNINetwork(dir)
+			Expect(err).To(MatchError(ContainSubstring("plugin has no type")))
+		})
+	})
+
+	Describe("CNINetworker", func() {
+		var commandRunner *fake_command_runner.FakeCommandRunner
+		var networker *CNINetworker
+		var container NetworkContainer
+
+		type invocation struct {
+			plugin string
+			env    map[string]string
+			conf   map[string]interface{}
+		}
+		var invocations []invocation
+		var results map[string]string
+		var failures map[string]error
+
+		BeforeEach(func() {
+			writeFile("bridge", "")
+			writeFile("portmap", "")
+
+			invocations = nil
+			results = map[string]string{}
+			failures = map[string]error{}
+
+			commandRunner = fake_command_runner.New()
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				inv := invocation{plugin: filepath.Base(cmd.Path), env: map[string]string{}}
+				for _, e := range cmd.Env {
+					if kv := strings.SplitN(e, "=", 2); strings.HasPrefix(kv[0], "CNI_") {
+						inv.env[kv[0]] = kv[1]
+					}
+				}
+
+				Expect(json.NewDecoder(cmd.Stdin).Decode(&inv.conf)).To(Succeed())
+				invocations = append(invocations, inv)
+
+				if inv.env["CNI_COMMAND"] == "ADD" {
+					if err := failures[inv.plugin]; err != nil {
+						cmd.Stdout.Write([]byte(`{"code":11,"msg":"no addresses left"}`))
+						return err
+					}
+
+					cmd.Stdout.Write([]byte(results[inv.plugin]))
+				}
+
+				return nil
+			})
+
+			network := &CNINetwork{
+				Name:       "mynet",
+				CNIVersion: "0.4.0",
+				Plugins: []map[string]interface{}{
+					{"type": "bridge", "bridge": "cni0"},
+					{"type": "portmap"},
+				},
+			}
+
+			networker = &CNINetworker{
+				Chain:         new(fakes.FakeChain),
+				Network:       network,
+				PluginDirs:    []string{"/no/such/dir", dir},
+				IfName:        "eth0",
+				CommandRunner: commandRunner,
+			}
+
+			container = NetworkContainer{Handle: "some-handle", DockerID: "some-docker-id", Pid: 1234}
+
+			results["bridge"] = `{"cniVersion":"0.4.0","ips":[{"version":"4","address":"10.22.0.5/16"}]}`
+			results["portmap"] = results["bridge"]
+		})
+
+		Describe("Up", func() {
+			It("adds the container to each plugin in turn, returning the IP they gave it", func() {
+				ip, err := networker.Up(container)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ip).To(Equal("10.22.0.5"))
+
+				Expect(invocations).To(HaveLen(2))
+				Expect(invocations[0].plugin).To(Equal("bridge"))
+				Expect(invocations[0].env).To(Equal(map[string]string{
+					"CNI_COMMAND":     "ADD",
+					"CNI_CONTAINERID": "some-docker-id",
+					"CNI_NETNS":       "/proc/1234/ns/net",
+					"CNI_IFNAME":      "eth0",
+					"CNI_PATH":        "/no/such/dir:" + dir,
+				}))
+				Expect(invocations[0].conf).To(Equal(map[string]interface{}{
+					"name":       "mynet",
+					"cniVersion": "0.4.0",
+					"type":       "bridge",
+					"bridge":     "cni0",
+				}))
+
+				Expect(invocations[1].plugin).To(Equal("portmap"))
+				Expect(invocations[1].conf).To(HaveKey("prevResult"))
+			})
+
+			It("understands results in the 0.2.0 format", func() {
+				results["portmap"] = `{"ip4":{"ip":"10.22.0.6/16"}}`
+
+				Expect(networker.Up(container)).To(Equal("10.22.0.6"))
+			})
+
+			Context("when a plugin fails", func() {
+				BeforeEach(func() {
+					failures["portmap"] = errors.New("exit status 1")
+				})
+
+				It("returns its error and deletes the container from the plugins which succeeded", func() {
+					_, err := networker.Up(container)
+					Expect(err).To(MatchError("cni ADD portmap: exit status 1: no addresses left"))
+
+					Expect(invocations).To(HaveLen(3))
+					Expect(invocations[2].plugin).To(Equal("bridge"))
+					Expect(invocations[2].env["CNI_COMMAND"]).To(Equal("DEL"))
+				})
+			})
+
+			Context("when a plugin cannot be found", func() {
+				BeforeEach(func() {
+					networker.Network.Plugins[0]["type"] = "macvlan"
+				})
+
+				It("returns an error", func() {
+					_, err := networker.Up(container)
+					Expect(err).To(MatchError(ContainSubstring("plugin macvlan not found")))
+				})
+			})
+		})
+
+		Describe("Down", func() {
+			It("deletes the container from each plugin in reverse order", func() {
+				Expect(networker.Down(NetworkContainer{Handle: "some-handle", DockerID: "some-docker-id"})).To(Succeed())
+
+				Expect(invocations).To(HaveLen(2))
+				Expect(invocations[0].plugin).To(Equal("portmap"))
+				Expect(invocations[1].plugin).To(Equal("bridge"))
+				for _, inv := range invocations {
+					Expect(inv.env["CNI_COMMAND"]).To(Equal("DEL"))
+					Expect(inv.env["CNI_CONTAINERID"]).To(Equal("some-docker-id"))
+					Expect(inv.env["CNI_NETNS"]).To(BeEmpty())
+				}
+			})
+		})
+	})
+})
@@ -1,6 +1,11 @@
 package gardendocker
 
-import "github.com/cloudfoundry-incubator/garden"
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
 
 type Container struct {
 	*InfoHandler
@@ -8,8 +13,121 @@ type Container struct {
 	*RunHandler
 	*StreamHandler
 	*LimitsHandler
+	*ActivityHandler
+}
+
+// Info adds the port mappings made by NetIn, and the external IP they are
+// forwarded from, to the InfoHandler's info.
+func (c *Container) Info() (garden.ContainerInfo, error) {
+	info, err := c.InfoHandler.Info()
+	if err != nil || c.NetHandler == nil {
+		return info, err
+	}
+
+	if ip := c.externalIP(); ip != nil {
+		info.ExternalIP = ip.String()
+	}
+
+	info.MappedPorts = c.PortMappings()
+	return info, nil
 }
 
+// Metrics reports the container's disk usage and, if the LimitsHandler has
+// Stats, its memory and cpu usage.
 func (c *Container) Metrics() (garden.Metrics, error) {
-	return garden.Metrics{}, nil
+	if c.LimitsHandler == nil {
+		return garden.Metrics{}, nil
+	}
+
+	var metrics garden.Metrics
+
+	disk, err := c.DiskStat()
+	if err != nil {
+		return garden.Metrics{}, err
+	}
+
+	metrics.DiskStat = disk
+
+	if c.Stats == nil {
+		return metrics, nil
+	}
+
+	if metrics.MemoryStat, err = c.Stats.Memory(); err != nil {
+		return garden.Metrics{}, fmt.Errorf("memory stats: %s", err)
+	}
+
+	if metrics.CPUStat, err = c.Stats.CPU(); err != nil {
+		return garden.Metrics{}, fmt.Errorf("cpu stats: %s", err)
+	}
+
+	return metrics, nil
+}
+
+// OOMEvent is the event recorded in a container's info once any of its
+// processes have been killed for running out of memory, as garden-linux
+// records it.
+const OOMEvent = "out of memory"
+
+// CheckOOM reports whether any of the container's processes have been
+// killed for running out of memory since it was last checked, recording the
+// OOMEvent in its info if so. A container without Stats is never found to
+// have run out of memory.
+func (c *Container) CheckOOM() (bool, error) {
+	if c.LimitsHandler == nil || c.Stats == nil {
+		return false, nil
+	}
+
+	kills, err := c.Stats.OOMKills()
+	if err != nil {
+		return false, err
+	}
+
+	c.oomMu.Lock()
+	defer c.oomMu.Unlock()
+
+	if kills <= c.oomKills {
+		return false, nil
+	}
+
+	c.oomKills = kills
+	c.AddEvent(OOMEvent)
+	return true, nil
+}
+
+// UpdateContainerIP records a new IP for the container, for example after its
+// docker container was restarted and given a different address.
+func (c *Container) UpdateContainerIP(ip string) {
+	c.InfoHandler.setContainerIP(ip)
+
+	if c.NetHandler != nil {
+		c.NetHandler.setContainerIP(ip)
+	}
+
+	if c.ActivityHandler != nil {
+		c.ActivityHandler.setContainerIP(ip)
+	}
+}
+
+// SetGraceTime changes how long the container may be idle before it is
+// reaped, zero meaning never, and saves it in the GraceTimeProperty.
+func (c *Container) SetGraceTime(graceTime time.Duration) error {
+	if err := c.SetProperty(GraceTimeProperty, graceTime.String()); err != nil {
+		return err
+	}
+
+	c.ActivityHandler.SetGraceTime(graceTime)
+	return nil
+}
+
+// syncGraceTime picks up a grace time a client has set in the
+// GraceTimeProperty. Values which are not durations are ignored.
+func (c *Container) syncGraceTime() {
+	value, err := c.GetProperty(GraceTimeProperty)
+	if err != nil {
+		return
+	}
+
+	if graceTime, err := time.ParseDuration(value); err == nil && graceTime >= 0 {
+		c.ActivityHandler.SetGraceTime(graceTime)
+	}
 }
@@ -1,17 +1,24 @@
 package gardendocker
 
 import (
+	"encoding/json"
 	"fmt"
-	"net/url"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/cloudfoundry/gunk/command_runner"
-	"github.com/docker/docker/pkg/iptables"
 	"github.com/julz/garden-docker/dockercli"
 )
 
@@ -19,46 +26,388 @@ type DaemonContainerCreator struct {
 	DefaultRootfs string
 	Depot         Depot
 
+	// TenantRootfs, if set, picks the default rootfs for containers of
+	// particular tenants, ahead of DefaultRootfs.
+	TenantRootfs *TenantRootfs
+
+	// RootfsRewrites are applied to every rootfs, including the defaults,
+	// before it is used.
+	RootfsRewrites RootfsRewrites
+
+	// RegistryCredentials, if set, are used to pull images from private
+	// registries, unless a container gives credentials in its ImageRef.
+	RegistryCredentials RegistryCredentials
+
+	// RegistryMirror, if set, is a pull-through cache of docker hub which
+	// images are pulled from in preference to docker hub itself.
+	RegistryMirror string
+
+	// InsecureRegistries are registries spoken to over plain HTTP. dockerd
+	// has to be configured to allow it; see CheckInsecureRegistries.
+	InsecureRegistries []string
+
 	DoshPath  string
 	InitdPath string
 
-	Chain    *iptables.Chain
-	PortPool *port_pool.PortPool
+	// InitdArchPaths, if set, holds initd binaries built for other
+	// architectures, by GOARCH. The one matching a container's image is
+	// used in place of InitdPath.
+	InitdArchPaths map[string]string
+
+	// InitBinDir, if set, is an operator-approved directory of alternative
+	// init binaries, one of which a container may ask for with the
+	// InitProperty in place of initd.
+	InitBinDir string
+
+	// EnforceDiskLimits enforces containers' disk limits with XFS project
+	// quotas (see XFSQuota) rather than only accounting for them.
+	EnforceDiskLimits bool
+
+	// DefaultCPUShares, if set, is the cpu weight containers start with
+	// until LimitCPU changes it.
+	DefaultCPUShares uint64
+
+	// Until, if set, returns a DockerRunner which stops retrying at the
+	// deadline (see dockercli.Runner's Until). Create uses it to give all of
+	// its docker commands together CreateDeadline to succeed.
+	Until          func(deadline time.Time) DockerRunner
+	CreateDeadline time.Duration
+
+	// CPUs, if set, is the cpuset containers are confined to, keeping them
+	// off the CPUs reserved for the host (see UnreservedCPUs). A container
+	// asking for its own CPUSetProperty must stay within it.
+	CPUs string
+
+	// MaxScratchTmpfs is the largest tmpfs scratch space a container may ask
+	// for with the ScratchTmpfsProperty. Zero disables the option.
+	MaxScratchTmpfs uint64
+
+	// Networker, if set, connects containers to the network and forwards
+	// the ports NetIn hands out from PortPool to them.
+	Networker Networker
+	PortPool  *port_pool.PortPool
+
+	// DockerNetwork, if set, is the docker network containers are started
+	// on, such as "none" when a CNINetworker connects them instead.
+	DockerNetwork string
+
+	// IPPool, if set, is where containers' IPs on DockerNetwork come from,
+	// rather than leaving docker to choose them.
+	IPPool *IPPool
+
+	// ExternalIP, if set, is the host address NetIn forwards ports from.
+	ExternalIP string
+
+	// Rules, if set, removes the forwarding rules tagged with a container's
+	// handle when it is destroyed.
+	Rules RuleSweeper
+
+	// Firewall, if set, restricts containers' egress to what their NetOut
+	// rules allow.
+	Firewall Firewall
+
+	// IPv6Pool, if set, is where containers' IPv6 addresses on
+	// DockerNetwork come from. Ports are forwarded to the addresses
+	// through Chain6 from ExternalIPv6, and Firewall6 restricts their
+	// egress, where those are set.
+	IPv6Pool     *IPPool
+	Chain6       Chain
+	ExternalIPv6 string
+	Firewall6    Firewall
+
+	// DNS is what containers' resolv.conf and /etc/hosts are generated
+	// from, unless their properties override it.
+	DNS DNSConfig
+
+	// ContainerInterface, if set, is the network interface containers are
+	// reached through, whose veth pair bandwidth limits are enforced on.
+	// Without it bandwidth limits are only recorded.
+	ContainerInterface string
+
+	// Links, if set, configures containers' network interfaces (setting
+	// their MTU, say) each time they are connected to the network.
+	Links LinkConfigurer
+
+	// Devices, if set, restricts the device nodes unprivileged containers
+	// may use, rather than leaving them docker's defaults. Privileged
+	// containers may use every device.
+	Devices DeviceWhitelist
 
 	DockerRunner  DockerRunner
 	CommandRunner command_runner.CommandRunner
+
+	Connections ConnectionTracker
+	Resources   *ResourcePool
+
+	// OutputQuota, if non-zero, turns on spooling of process output to the
+	// container's depot directory, and caps the bytes spooled per container.
+	OutputQuota int64
+
+	// InitdTimeout is how long to wait for initd to start listening when
+	// recovering a container.
+	InitdTimeout time.Duration
+
+	// StopGracePeriod is how long a container's processes are given to exit
+	// after SIGTERM when it is stopped, before they are killed. Zero leaves
+	// it to initd's default.
+	StopGracePeriod time.Duration
+
+	// ImageGC, if set, is told about the images containers are created from,
+	// so that it does not collect them while containers are being created
+	// from them.
+	ImageGC *ImageGC
+
+	// Scrubber, if set, overwrites the container's writable layer and depot
+	// directory before they are removed on Destroy.
+	Scrubber Scrubber
+
+	// Events, if set, is published an event for each process which exits.
+	Events *EventBus
+
+	// UserNamespace, if set, is the user namespace dockerd (run with
+	// --userns-remap) puts containers in. Unprivileged containers are left
+	// in it, so that root in them is not root on the host; privileged ones
+	// are taken out of it.
+	UserNamespace *UserNamespace
+
+	// SeccompProfile is the seccomp profile file unprivileged containers are
+	// run with, or SeccompUnconfined for none. Empty means docker's default
+	// profile. SeccompProfileDir, if set, holds alternative profiles
+	// containers may ask for by name with the SeccompProfileProperty.
+	SeccompProfile    string
+	SeccompProfileDir string
+
+	// AppArmorProfile is the name of the (already loaded) AppArmor profile
+	// unprivileged containers, and so every process initd spawns in them,
+	// are confined by. Empty means docker's default profile.
+	AppArmorProfile string
+
+	// creating are the docker containers whose Create has not returned yet,
+	// and so which are not in the repo.
+	creatingMu sync.Mutex
+	creating   map[string]bool
 }
 
+// OwnerLabel is set on every docker container garden-docker creates, so that
+// garden-owned containers can be told apart from any others.
+const OwnerLabel = "garden-docker.owner"
+
+// Labels set on docker containers so that operators (and scripts) can tell
+// which garden container a docker container belongs to.
+const (
+	HandleLabel        = "garden-docker.handle"
+	VersionLabel       = "garden-docker.version"
+	OwnerPropertyLabel = "garden-docker.owner-property"
+)
+
+// InitProperty is the container property naming an alternative init binary
+// in the creator's InitBinDir to run as the container's pid 1. It is started
+// with the same flags as initd and must serve processes on its socket in the
+// same way, and should only serve garden-docker, as -daemonUID tells it.
+const InitProperty = "garden-docker.init"
+
+// ScratchTmpfsProperty is the container property asking for the container's
+// scratch space, ScratchPath, to be a tmpfs of the given size in bytes. This
+// makes IO-heavy, short-lived containers much faster, but the space comes out
+// of the host's memory.
+const ScratchTmpfsProperty = "garden-docker.scratch-tmpfs"
+
+const ScratchPath = "/tmp"
+
+// ReadOnlyRootfsProperty is the container property which, when "true", makes
+// the container's rootfs read-only, so that it cannot drift from its image.
+// ScratchPath is then a tmpfs of ReadOnlyScratchTmpfsSize, unless the
+// container asked for another size with the ScratchTmpfsProperty, and /run is
+// the writable directory initd listens in, as it always is.
+const ReadOnlyRootfsProperty = "garden-docker.read-only-rootfs"
+
+const ReadOnlyScratchTmpfsSize = 64 * 1024 * 1024
+
+// CPUSetProperty is the container property pinning the container to a set of
+// cpus, in the cpuset list format docker takes (e.g. "0-3" or "1,3").
+const CPUSetProperty = "garden-docker.cpuset"
+
+// OwnerProperty is the container property whose value, if set, is copied to
+// the OwnerPropertyLabel.
+const OwnerProperty = "owner"
+
 //go:generate counterfeiter . DockerRunner
 type DockerRunner interface {
 	Run(dockercli.RunCmd) (string, error)
-	Inspect(dockercli.InspectCmd) (string, error)
+	Inspect(dockercli.InspectCmd) (dockercli.ContainerJSON, error)
+	ImageInspect(dockercli.ImageInspectCmd) (dockercli.ImageJSON, error)
+	RegistryConfig(dockercli.RegistryConfigCmd) (dockercli.RegistryConfig, error)
+	Rm(dockercli.RmCmd) (string, error)
+	Ps(dockercli.PsCmd) ([]dockercli.PsEntry, error)
+	Pull(dockercli.PullCmd) (string, error)
+	Tag(dockercli.TagCmd) (string, error)
+	Start(dockercli.StartCmd) (string, error)
+	Stop(dockercli.StopCmd) (string, error)
+	Update(dockercli.UpdateCmd) (string, error)
+	Login(dockercli.LoginCmd) (string, error)
+	Cp(dockercli.CpCmd) (string, error)
+	CpIn(cmd dockercli.CpCmd, tar io.Reader) error
+	CpOut(cmd dockercli.CpCmd) (io.ReadCloser, error)
+	Exec(dockercli.ExecCmd) (string, error)
+	Logs(cmd dockercli.LogsCmd, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) error
 }
 
-func (c *DaemonContainerCreator) Create(spec garden.ContainerSpec) (*Container, error) {
+// Create creates a container from the spec. If it fails part way, whatever
+// it had set up by then is undone in reverse order, so that a retry with the
+// same handle does not run into the remains of this attempt.
+func (c *DaemonContainerCreator) Create(spec garden.ContainerSpec) (container *Container, err error) {
 	dir, err := c.Depot.Create()
 	if err != nil {
 		return nil, fmt.Errorf("create depot dir: %s", err)
 	}
 
+	var undo []func()
+	defer func() {
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+
+	undo = append(undo, func() { c.Depot.Destroy(dir) })
+
+	// the docker commands of a create share one deadline, rather than each
+	// retrying up to its own
+	docker := c.DockerRunner
+	if c.Until != nil && c.CreateDeadline > 0 {
+		docker = c.Until(time.Now().Add(c.CreateDeadline))
+	}
+
+	if spec.Handle == "" {
+		spec.Handle = guid()
+	}
+
+	var image ImageRef
+	if image, spec.Properties = imageRef(spec.Properties); image.URI != "" {
+		if len(spec.RootFSPath) != 0 {
+			return nil, fmt.Errorf("create: give either a rootfs path or an image, not both")
+		}
+
+		spec.RootFSPath = image.URI
+	}
+
 	if len(spec.RootFSPath) == 0 {
-		spec.RootFSPath = c.DefaultRootfs
+		spec.RootFSPath = c.defaultRootfs(spec.Properties)
 	}
 
-	rootfs, err := url.Parse(spec.RootFSPath)
+	rootfs, err := parseRootfs(c.RootfsRewrites.Rewrite(spec.RootFSPath))
 	if err != nil {
-		return nil, fmt.Errorf("create: not a valid rootfs path: %s", err)
+		return nil, fmt.Errorf("create: %s", err)
 	}
 
-	var dockerID string
-	if dockerID, err = c.DockerRunner.Run(dockercli.RunCmd{
-		Image:       rootfs.Path[1:],
+	diskScope, err := parseDiskLimitScope(spec.Properties[DiskLimitScopeProperty])
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	initPath, err := c.initPath(spec.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	tmpfs, err := c.scratchTmpfs(spec.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	readOnly, err := readOnlyRootfs(spec.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	if readOnly && len(tmpfs) == 0 {
+		tmpfs = []dockercli.Tmpfs{{ContainerPath: ScratchPath, SizeInBytes: ReadOnlyScratchTmpfsSize}}
+	}
+
+	seccompProfile, err := c.seccompProfile(spec.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	cpuset := spec.Properties[CPUSetProperty]
+	if !validCPUSet(cpuset) {
+		return nil, fmt.Errorf("create: invalid cpuset %q", cpuset)
+	}
+
+	if cpuset == "" {
+		cpuset = c.CPUs
+	} else if !cpusetWithin(cpuset, c.CPUs) {
+		return nil, fmt.Errorf("create: cpuset %q includes CPUs reserved for the host", cpuset)
+	}
+
+	if _, err := parseOwner(spec.Properties[StreamInOwnerProperty]); err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	dns, err := c.dnsConfig(spec.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	if image.Username == "" {
+		if cred, ok := c.RegistryCredentials.For(rootfs.Registry); ok {
+			image.Username, image.Password = cred.Username, cred.Password
+		}
+	}
+
+	if image.Username != "" {
+		if err := c.pullWithCredentials(docker, filepath.Join(dir, "docker-config"), rootfs, image); err != nil {
+			return nil, fmt.Errorf("create: %w", err)
+		}
+	}
+
+	imageInfo, err := c.imageInfo(docker, rootfs.Image)
+	if err != nil {
+		return nil, fmt.Errorf("create: %w", err)
+	}
+
+	defer c.ImageGC.Using(imageInfo.ID)()
+
+	if digest := rootfs.resolvedDigest(imageInfo); digest != "" {
+		spec.Properties = withProperty(spec.Properties, RootfsDigestProperty, digest)
+	}
+
+	if spec.GraceTime != 0 {
+		spec.Properties = withProperty(spec.Properties, GraceTimeProperty, spec.GraceTime.String())
+	}
+
+	if initPath == "" {
+		if initPath, err = c.initdFor(imageInfo); err != nil {
+			return nil, fmt.Errorf("create: %s", err)
+		}
+	}
+
+	privileged := spec.Privileged || rootfs.Privileged
+
+	usernsMode, err := c.usernsMode(dir, privileged)
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	runCmd := dockercli.RunCmd{
+		Image:       rootfs.Image,
 		Detach:      true,
+		Privileged:  privileged,
+		ReadOnly:    readOnly,
+		UsernsMode:  usernsMode,
+		Network:     c.DockerNetwork,
+		Name:        dockerName(spec.Handle),
+		Labels:      labels(spec),
+		Tmpfs:       tmpfs,
+		CPUShares:   c.DefaultCPUShares,
+		CPUSetCPUs:  cpuset,
+		Env:         spec.Env,
 		Program:     "/garden-bin/initd",
-		ProgramArgs: []string{"-socketPath", "/run/initd.sock", "-unmountAfterListening", "/run"},
+		ProgramArgs: []string{"-socketPath", "/run/initd.sock", "-unmountAfterListening", "/run", "-daemonUID", strconv.Itoa(os.Getuid())},
 		Volumes: []dockercli.Volume{
 			{
-				HostPath:      c.InitdPath,
+				HostPath:      initPath,
 				ContainerPath: "/garden-bin/initd",
 			},
 			{
@@ -66,51 +415,893 @@ func (c *DaemonContainerCreator) Create(spec garden.ContainerSpec) (*Container,
 				ContainerPath: "/run",
 			},
 		},
-	}); err != nil {
-		return nil, fmt.Errorf("create: %s", err)
 	}
 
-	var ip string
-	if ip, err = c.DockerRunner.Inspect(dockercli.InspectCmd{
-		ContainerID: dockerID,
-		Field:       "NetworkSettings.IPAddress",
-	}); err != nil {
+	dnsVolumes, err := writeDNSFiles(dir, dns)
+	if err != nil {
+		return nil, fmt.Errorf("create: write dns files: %s", err)
+	}
+
+	runCmd.Volumes = append(runCmd.Volumes, dnsVolumes...)
+
+	if !privileged {
+		runCmd.CapDrop = []string{"ALL"}
+		runCmd.CapAdd = UnprivilegedCapabilities
+		runCmd.SecurityOpt = []string{"no-new-privileges"}
+		runCmd.SeccompProfile = seccompProfile
+
+		if c.AppArmorProfile != "" {
+			runCmd.SecurityOpt = append(runCmd.SecurityOpt, "apparmor="+c.AppArmorProfile)
+		}
+	}
+
+	if c.IPPool != nil {
+		if runCmd.IP, err = c.IPPool.Acquire(); err != nil {
+			return nil, fmt.Errorf("create: %s", err)
+		}
+
+		undo = append(undo, func() { c.IPPool.Release(runCmd.IP) })
+	}
+
+	if c.IPv6Pool != nil {
+		if runCmd.IPv6, err = c.IPv6Pool.Acquire(); err != nil {
+			return nil, fmt.Errorf("create: %s", err)
+		}
+
+		undo = append(undo, func() { c.IPv6Pool.Release(runCmd.IPv6) })
+	}
+
+	var dockerID string
+	if dockerID, err = docker.Run(runCmd); err != nil {
+		return nil, fmt.Errorf("create: %w", err)
+	}
+
+	c.startCreating(dockerID)
+	defer c.doneCreating(dockerID)
+
+	undo = append(undo, func() {
+		c.DockerRunner.Rm(dockercli.RmCmd{ContainerID: dockerID, Force: true})
+	})
+
+	if c.Devices != nil && !privileged {
+		if err := c.Devices.Apply(dockerID); err != nil {
+			return nil, fmt.Errorf("create: %s", err)
+		}
+	}
+
+	info, err := docker.Inspect(dockercli.InspectCmd{ContainerID: dockerID})
+	if err != nil {
 		return nil, fmt.Errorf("create: inspect %s: %s", dockerID, err)
 	}
 
+	// network plugins tolerate being taken down when they were not (fully)
+	// brought up, as with CNI's DEL
+	if c.Networker != nil {
+		undo = append(undo, func() {
+			c.Networker.Down(NetworkContainer{Handle: spec.Handle, DockerID: dockerID})
+		})
+	}
+
+	ip, err := c.networkUp(spec.Handle, info, c.dockerIP(info, runCmd.IP))
+	if err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	if c.Firewall != nil {
+		if err := c.Firewall.Setup(dockerID, ip); err != nil {
+			return nil, fmt.Errorf("create: firewall: %s", err)
+		}
+
+		undo = append(undo, func() { c.Firewall.Teardown(dockerID, ip) })
+	}
+
+	ipv6 := info.GlobalIPv6Address(c.DockerNetwork)
+	if ipv6 == "" {
+		ipv6 = runCmd.IPv6
+	}
+
+	if c.Firewall6 != nil && ipv6 != "" {
+		if err := c.Firewall6.Setup(dockerID, ipv6); err != nil {
+			return nil, fmt.Errorf("create: firewall: %s", err)
+		}
+
+		undo = append(undo, func() { c.Firewall6.Teardown(dockerID, ipv6) })
+	}
+
+	if len(dns.HostEntries) > 0 {
+		if err := writeHosts(filepath.Join(dir, "etc", "hosts"), dns, info.Config.Hostname, []string{ip, ipv6}); err != nil {
+			return nil, fmt.Errorf("create: write hosts: %s", err)
+		}
+	}
+
+	container = c.newContainer(spec, dir, dockerID, ip, ipv6, diskScope, info.Config.Labels)
+	container.ImageID = info.Image
+	if err := container.SaveProperties(); err != nil {
+		return nil, fmt.Errorf("create: save properties: %s", err)
+	}
+
+	if err := container.SaveMetadata(); err != nil {
+		return nil, fmt.Errorf("create: %s", err)
+	}
+
+	return container, nil
+}
+
+// newContainer builds the garden container for a docker container whose initd
+// is listening in the depot directory dir, with the given IPv4 and (possibly
+// empty) IPv6 addresses. Its docker labels are imported as read-only
+// properties.
+func (c *DaemonContainerCreator) newContainer(spec garden.ContainerSpec, dir, dockerID, ip, ipv6 string, diskScope DiskLimitScope, labels map[string]string) *Container {
+	processTracker := process_tracker.New(dir, c.CommandRunner)
+
+	props := NewPropsHandler(spec.Properties)
+	props.StatePath = filepath.Join(dir, "props.json")
+	props.ImportLabels(labels)
+
+	// validated by Create; an adopted or restored container with an invalid
+	// owner keeps the tar's owners
+	owner, _ := parseOwner(spec.Properties[StreamInOwnerProperty])
+
+	var spool *OutputSpool
+	if c.OutputQuota > 0 {
+		spool = &OutputSpool{
+			Path:     filepath.Join(dir, "output.log"),
+			MaxBytes: c.OutputQuota,
+		}
+	}
+
+	limits := &LimitsHandler{
+		Pool:      c.Resources,
+		Cgroup:    &DockerCgroup{DockerRunner: c.DockerRunner, DockerID: dockerID},
+		Stats:     &CgroupStats{DockerRunner: c.DockerRunner, DockerID: dockerID},
+		DiskScope: diskScope,
+		DiskUsage: &DockerDiskUsage{DockerRunner: c.DockerRunner, DockerID: dockerID},
+	}
+
+	if c.ContainerInterface != "" {
+		limits.Bandwidth = &TCShaper{
+			DockerRunner:  c.DockerRunner,
+			CommandRunner: c.CommandRunner,
+			DockerID:      dockerID,
+			IfName:        c.ContainerInterface,
+		}
+	}
+
+	if c.EnforceDiskLimits {
+		limits.DiskQuota = &XFSQuota{
+			DockerRunner:  c.DockerRunner,
+			CommandRunner: c.CommandRunner,
+			DockerID:      dockerID,
+			DepotDir:      dir,
+		}
+	}
+
 	return &Container{
-		LimitsHandler: &LimitsHandler{},
-		StreamHandler: &StreamHandler{},
+		LimitsHandler: limits,
+		StreamHandler: &StreamHandler{
+			Streamer: &DockerStreamer{
+				DockerRunner: c.DockerRunner,
+				DockerID:     dockerID,
+				Owner:        owner,
+			},
+			HomeDir:       "/root",
+			GzipStreamOut: spec.Properties[StreamOutCompressionProperty] == "gzip",
+		},
 		InfoHandler: &InfoHandler{
 			Spec:          spec,
 			ContainerPath: dir,
 			ContainerIP:   ip,
+			ContainerIPv6: ipv6,
 			DockerID:      dockerID,
-			PropsHandler:  &PropsHandler{},
+			MetadataPath:  filepath.Join(dir, MetadataFile),
+			PropsHandler:  props,
 		},
 		NetHandler: &NetHandler{
 			ContainerIP: ip,
-			Chain:       c.Chain,
+			Chain:       c.Networker,
+			RuleTag:     spec.Handle,
+			Rules:       c.Rules,
+			ExternalIP:  c.ExternalIP,
 			PortPool:    c.PortPool,
+			Firewall:    c.Firewall,
+			FirewallID:  dockerID,
+			StatePath:   filepath.Join(dir, "net.json"),
+
+			ContainerIPv6: ipv6,
+			Chain6:        c.Chain6,
+			ExternalIPv6:  c.ExternalIPv6,
+			Firewall6:     c.Firewall6,
+		},
+		ActivityHandler: &ActivityHandler{
+			GraceTime:      spec.GraceTime,
+			ContainerIP:    ip,
+			ProcessTracker: processTracker,
+			Connections:    c.Connections,
 		},
 		RunHandler: &RunHandler{
-			ProcessTracker: process_tracker.New(dir, c.CommandRunner),
+			ProcessTracker: processTracker,
+			InitdSock:      filepath.Join(dir, "run", "initd.sock"),
+			StatePath:      filepath.Join(dir, "processes.json"),
+			Spool:          spool,
+
+			StopGracePeriod: c.StopGracePeriod,
 			ContainerCmd: &doshcmd{
 				Path:      filepath.Join(dir, "bin", "dosh"),
 				InitdSock: filepath.Join(dir, "run", "initd.sock"),
+				EnvDir:    filepath.Join(dir, "processes"),
 			},
+			Exited: c.processExited(spec.Handle),
 		},
-	}, nil
+	}
+}
+
+// processExited returns the RunHandler's Exited callback for the container
+// with the given handle, which publishes an event to Events, if set.
+func (c *DaemonContainerCreator) processExited(handle string) func(uint32, int) {
+	if c.Events == nil {
+		return nil
+	}
+
+	return func(processID uint32, exitStatus int) {
+		c.Events.Publish(Event{
+			Kind:   EventProcessExited,
+			Handle: handle,
+			Data:   map[string]interface{}{"process_id": processID, "exit_status": exitStatus},
+		})
+	}
+}
+
+// DockerDiskUsage reads the disk usage of a docker container from docker
+// inspect: SizeRw is the size of its writable layer, SizeRootFs the size of
+// all its layers.
+type DockerDiskUsage struct {
+	DockerRunner DockerRunner
+	DockerID     string
+}
+
+func (d *DockerDiskUsage) Usage() (uint64, uint64, error) {
+	info, err := d.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: d.DockerID, Size: true})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return info.SizeRw, info.SizeRootFs, nil
+}
+
+// UnprivilegedCapabilities are the only capabilities unprivileged containers
+// are given: docker's defaults, less MKNOD and AUDIT_WRITE. Privileged
+// containers get every capability and device, as docker --privileged does.
+// Either way, docker masks the sensitive parts of /proc in all but
+// privileged containers.
+var UnprivilegedCapabilities = []string{
+	"CHOWN",
+	"DAC_OVERRIDE",
+	"FOWNER",
+	"FSETID",
+	"KILL",
+	"NET_BIND_SERVICE",
+	"NET_RAW",
+	"SETFCAP",
+	"SETGID",
+	"SETPCAP",
+	"SETUID",
+	"SYS_CHROOT",
+}
+
+// usernsMode returns the user namespace mode for a container with the given
+// depot directory. With a UserNamespace, a privileged container shares the
+// host's user namespace, and an unprivileged one stays in the remapped one,
+// so its run directory is handed to its root user for initd's socket.
+func (c *DaemonContainerCreator) usernsMode(dir string, privileged bool) (string, error) {
+	if c.UserNamespace == nil {
+		return "", nil
+	}
+
+	if privileged {
+		return "host", nil
+	}
+
+	if err := os.Chown(filepath.Join(dir, "run"), c.UserNamespace.RootUID, c.UserNamespace.RootGID); err != nil {
+		return "", fmt.Errorf("user namespace: %s", err)
+	}
+
+	return "", nil
+}
+
+// PullDefaultRootfs checks that the default rootfs is a valid rootfs URI and
+// pulls its image, so that a bad default is caught at startup rather than on
+// the first Create.
+func (c *DaemonContainerCreator) PullDefaultRootfs() error {
+	if err := c.PullImage(c.DefaultRootfs); err != nil {
+		return fmt.Errorf("default rootfs: %s", err)
+	}
+
+	return nil
+}
+
+// PullImage pulls the image of a rootfs URI, with the operator's credentials
+// for its registry if there are any.
+func (c *DaemonContainerCreator) PullImage(rootfsPath string) error {
+	rootfs, err := parseRootfs(c.RootfsRewrites.Rewrite(rootfsPath))
+	if err != nil {
+		return err
+	}
+
+	cred, ok := c.RegistryCredentials.For(rootfs.Registry)
+	if !ok {
+		return c.pull(c.DockerRunner, dockercli.PullCmd{Image: rootfs.Image})
+	}
+
+	configDir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		return err
+	}
+
+	return c.pullWithCredentials(c.DockerRunner, configDir, rootfs, ImageRef{Username: cred.Username, Password: cred.Password})
+}
+
+// initPath returns the host path of the init binary a container asks for
+// from InitBinDir, or "" if it wants initd.
+func (c *DaemonContainerCreator) initPath(props garden.Properties) (string, error) {
+	name, ok := props[InitProperty]
+	if !ok {
+		return "", nil
+	}
+
+	if c.InitBinDir == "" {
+		return "", fmt.Errorf("alternative init binaries are not enabled")
+	}
+
+	if name == "" || name == "." || name == ".." || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid init binary name %q", name)
+	}
+
+	path := filepath.Join(c.InitBinDir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("init binary %q: %s", name, err)
+	}
+
+	if !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("init binary %q is not an executable file", name)
+	}
+
+	return path, nil
+}
+
+// scratchTmpfs returns the tmpfs mount for the container's scratch space, if
+// it asked for one no bigger than MaxScratchTmpfs.
+func (c *DaemonContainerCreator) scratchTmpfs(props garden.Properties) ([]dockercli.Tmpfs, error) {
+	size, ok := props[ScratchTmpfsProperty]
+	if !ok {
+		return nil, nil
+	}
+
+	if c.MaxScratchTmpfs == 0 {
+		return nil, fmt.Errorf("tmpfs scratch space is not enabled")
+	}
+
+	sizeInBytes, err := strconv.ParseUint(size, 10, 64)
+	if err != nil || sizeInBytes == 0 {
+		return nil, fmt.Errorf("invalid tmpfs scratch size %q", size)
+	}
+
+	if sizeInBytes > c.MaxScratchTmpfs {
+		return nil, fmt.Errorf("tmpfs scratch size %d exceeds the maximum of %d", sizeInBytes, c.MaxScratchTmpfs)
+	}
+
+	return []dockercli.Tmpfs{{ContainerPath: ScratchPath, SizeInBytes: sizeInBytes}}, nil
+}
+
+// readOnlyRootfs returns whether the container asked for a read-only rootfs
+// with the ReadOnlyRootfsProperty.
+func readOnlyRootfs(props garden.Properties) (bool, error) {
+	switch props[ReadOnlyRootfsProperty] {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid read-only rootfs %q: want true or false", props[ReadOnlyRootfsProperty])
+	}
+}
+
+// validCPUSet reports whether a cpuset is empty or a list of cpus and cpu
+// ranges, such as "0-3,6".
+func validCPUSet(cpuset string) bool {
+	if cpuset == "" {
+		return true
+	}
+
+	for _, part := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		for _, b := range bounds {
+			if _, err := strconv.ParseUint(b, 10, 16); err != nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// cpusetWithin reports whether every CPU of a valid cpuset is also in
+// within, which is everything if it is empty.
+func cpusetWithin(cpuset, within string) bool {
+	if within == "" {
+		return true
+	}
+
+	allowed := cpusetCPUs(within)
+	for cpu := range cpusetCPUs(cpuset) {
+		if !allowed[cpu] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cpusetCPUs returns the CPUs of a valid cpuset.
+func cpusetCPUs(cpuset string) map[uint64]bool {
+	cpus := make(map[uint64]bool)
+	for _, part := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, _ := strconv.ParseUint(bounds[0], 10, 16)
+		last := first
+		if len(bounds) == 2 {
+			last, _ = strconv.ParseUint(bounds[1], 10, 16)
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus[cpu] = true
+		}
+	}
+
+	return cpus
+}
+
+// pullWithCredentials pulls a rootfs image using the credentials of an
+// ImageRef. It logs in with a docker config directory of its own, which is
+// removed once the image is pulled, so that the credentials are neither
+// shared with other containers nor left on disk.
+func (c *DaemonContainerCreator) pullWithCredentials(docker DockerRunner, configDir string, rootfs rootfs, image ImageRef) error {
+	defer os.RemoveAll(configDir)
+
+	if _, err := docker.Login(dockercli.LoginCmd{
+		ConfigDir: configDir,
+		Registry:  rootfs.Registry,
+		Username:  image.Username,
+		Password:  image.Password,
+	}); err != nil {
+		return err
+	}
+
+	return c.pull(docker, dockercli.PullCmd{Image: rootfs.Image, ConfigDir: configDir})
+}
+
+func (c *DaemonContainerCreator) defaultRootfs(props garden.Properties) string {
+	if rootfs, ok := c.TenantRootfs.DefaultFor(props); ok {
+		return rootfs
+	}
+
+	return c.DefaultRootfs
+}
+
+func (c *DaemonContainerCreator) Destroy(container *Container) error {
+	if c.Scrubber != nil {
+		if err := c.scrub(container); err != nil {
+			return fmt.Errorf("destroy: scrub: %s", err)
+		}
+	}
+
+	if container.LimitsHandler != nil {
+		if err := container.ReleaseBandwidthLimits(); err != nil {
+			return fmt.Errorf("destroy: %s", err)
+		}
+	}
+
+	if c.Networker != nil {
+		if err := c.Networker.Down(NetworkContainer{Handle: container.Handle(), DockerID: container.DockerID}); err != nil {
+			return fmt.Errorf("destroy: %s", err)
+		}
+	}
+
+	// A docker container which has already gone still leaves the rest of
+	// the container's resources to release, so carry on and report it at
+	// the end.
+	var gone error
+	if _, err := c.DockerRunner.Rm(dockercli.RmCmd{
+		ContainerID: container.DockerID,
+		Force:       true,
+	}); isNoSuchContainer(err) {
+		gone = fmt.Errorf("destroy: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("destroy: %w", err)
+	}
+
+	if err := container.ReleasePortMappings(); err != nil {
+		return fmt.Errorf("destroy: %s", err)
+	}
+
+	if err := container.ReleaseNetOut(); err != nil {
+		return fmt.Errorf("destroy: %s", err)
+	}
+
+	if c.IPPool != nil {
+		c.IPPool.Release(container.InfoHandler.containerIP())
+	}
+
+	if c.IPv6Pool != nil {
+		c.IPv6Pool.Release(container.InfoHandler.ContainerIPv6)
+	}
+
+	if container.RunHandler != nil {
+		container.CloseSpool()
+	}
+
+	if err := c.Depot.Destroy(container.ContainerPath); err != nil {
+		return fmt.Errorf("destroy: remove depot dir: %s", err)
+	}
+
+	container.ReleaseLimits()
+	return gone
+}
+
+// Logs streams the output docker captured from a container's initd, which
+// includes anything written to the console by processes not started through
+// Run, until stop is closed or, unless following, the end of the logs.
+func (c *DaemonContainerCreator) Logs(container *Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error {
+	return c.DockerRunner.Logs(dockercli.LogsCmd{
+		ContainerID: container.DockerID,
+		Follow:      follow,
+		Tail:        tail,
+	}, w, w, stop)
+}
+
+// Stop stops a container's docker container, giving its processes the
+// usual docker stop grace period to exit after SIGTERM.
+func (c *DaemonContainerCreator) Stop(container *Container) error {
+	if _, err := c.DockerRunner.Stop(dockercli.StopCmd{ContainerID: container.DockerID}); err != nil {
+		return fmt.Errorf("stop: %s", err)
+	}
+
+	return nil
+}
+
+// Existing returns the IDs of all docker containers, stopped or running.
+// They are not filtered by the OwnerLabel, since adopted containers do not
+// have it.
+func (c *DaemonContainerCreator) Existing() (map[string]bool, error) {
+	entries, err := c.DockerRunner.Ps(dockercli.PsCmd{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %s", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, entry := range entries {
+		existing[entry.ID] = true
+	}
+
+	return existing, nil
+}
+
+// Running returns the IDs of all running docker containers. They are not
+// filtered by the OwnerLabel, since adopted containers do not have it.
+func (c *DaemonContainerCreator) Running() (map[string]bool, error) {
+	entries, err := c.DockerRunner.Ps(dockercli.PsCmd{})
+	if err != nil {
+		return nil, fmt.Errorf("list running containers: %s", err)
+	}
+
+	running := make(map[string]bool)
+	for _, entry := range entries {
+		running[entry.ID] = true
+	}
+
+	return running, nil
+}
+
+// Recover brings a container back after dockerd has restarted: it starts the
+// docker container again if it is no longer running, picks up its (possibly
+// new) IP, waits for initd to listen again and restores its port mappings.
+func (c *DaemonContainerCreator) Recover(container *Container) error {
+	info, err := c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: container.DockerID})
+	if err != nil {
+		return fmt.Errorf("recover: inspect %s: %s", container.DockerID, err)
+	}
+
+	ip := c.dockerIP(info, container.InfoHandler.containerIP())
+	if !info.State.Running {
+		if _, err := c.DockerRunner.Start(dockercli.StartCmd{ContainerID: container.DockerID}); err != nil {
+			return fmt.Errorf("recover: %s", err)
+		}
+
+		if info, err = c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: container.DockerID}); err != nil {
+			return fmt.Errorf("recover: inspect %s: %s", container.DockerID, err)
+		}
+
+		// docker wrote its default device rules to the restarted container's
+		// new devices cgroup
+		if c.Devices != nil && !info.HostConfig.Privileged && !container.Adopted() {
+			if err := c.Devices.Apply(container.DockerID); err != nil {
+				return fmt.Errorf("recover: %s", err)
+			}
+		}
+
+		// the restarted container has a new network namespace
+		if ip, err = c.networkUp(container.Handle(), info, c.dockerIP(info, container.InfoHandler.containerIP())); err != nil {
+			return fmt.Errorf("recover: %s", err)
+		}
+
+		if container.LimitsHandler != nil {
+			if err := container.ReapplyBandwidthLimits(); err != nil {
+				return fmt.Errorf("recover: %s", err)
+			}
+		}
+	}
+
+	if container.NetHandler != nil {
+		if err := container.MoveNetOut(ip); err != nil {
+			return fmt.Errorf("recover: %s", err)
+		}
+	}
+
+	container.UpdateContainerIP(ip)
+
+	if container.Adopted() {
+		// initd was started with docker exec, so it did not survive the
+		// restart
+		if err := c.injectInitd(info, container.ContainerPath); err != nil {
+			return fmt.Errorf("recover: %s", err)
+		}
+	} else if err := waitForSocket(filepath.Join(container.ContainerPath, "run", "initd.sock"), c.InitdTimeout); err != nil {
+		return fmt.Errorf("recover: %s", err)
+	}
+
+	if container.NetHandler != nil {
+		if _, err := container.RestorePortMappings(); err != nil {
+			return fmt.Errorf("recover: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// dockerIP returns the IP docker gave the container on DockerNetwork or, if
+// inspecting it does not say, the IP it was asked to have.
+func (c *DaemonContainerCreator) dockerIP(info dockercli.ContainerJSON, requested string) string {
+	if ip := info.IPAddress(c.DockerNetwork); ip != "" {
+		return ip
+	}
+
+	return requested
+}
+
+// networkUp connects a running docker container, which docker gave the IP
+// dockerIP, to the network, returning the IP address it is reached at.
+func (c *DaemonContainerCreator) networkUp(handle string, info dockercli.ContainerJSON, dockerIP string) (string, error) {
+	ip := dockerIP
+	if c.Networker != nil {
+		upIP, err := c.Networker.Up(NetworkContainer{
+			Handle:   handle,
+			DockerID: info.ID,
+			Pid:      info.State.Pid,
+			IP:       dockerIP,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if upIP != "" {
+			ip = upIP
+		}
+	}
+
+	if c.Links != nil {
+		if err := c.Links.Configure(info.State.Pid); err != nil {
+			return "", err
+		}
+	}
+
+	return ip, nil
+}
+
+func waitForSocket(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			return conn.Close()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("initd did not start listening on %s: %s", path, err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Owned returns the IDs of all garden-owned docker containers, whether or not
+// they are running.
+func (c *DaemonContainerCreator) Owned() ([]string, error) {
+	entries, err := c.DockerRunner.Ps(dockercli.PsCmd{
+		All:     true,
+		Filters: []string{"label=" + OwnerLabel},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %s", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+
+	return ids, nil
+}
+
+// Creating returns the IDs of the docker containers whose Create has not
+// returned yet.
+func (c *DaemonContainerCreator) Creating() map[string]bool {
+	c.creatingMu.Lock()
+	defer c.creatingMu.Unlock()
+
+	creating := make(map[string]bool, len(c.creating))
+	for id := range c.creating {
+		creating[id] = true
+	}
+
+	return creating
+}
+
+func (c *DaemonContainerCreator) startCreating(dockerID string) {
+	c.creatingMu.Lock()
+	defer c.creatingMu.Unlock()
+
+	if c.creating == nil {
+		c.creating = make(map[string]bool)
+	}
+	c.creating[dockerID] = true
+}
+
+func (c *DaemonContainerCreator) doneCreating(dockerID string) {
+	c.creatingMu.Lock()
+	defer c.creatingMu.Unlock()
+
+	delete(c.creating, dockerID)
+}
+
+// Remove force-removes a docker container which has no garden container.
+func (c *DaemonContainerCreator) Remove(dockerID string) error {
+	if _, err := c.DockerRunner.Rm(dockercli.RmCmd{
+		ContainerID: dockerID,
+		Force:       true,
+	}); err != nil {
+		return fmt.Errorf("remove %s: %s", dockerID, err)
+	}
+
+	return nil
+}
+
+func (c *DaemonContainerCreator) scrub(container *Container) error {
+	// The container's processes are stopped first, so that none of them
+	// writes to its layer or depot directory after it has been scrubbed. It
+	// is about to be removed, so they are not given long to exit.
+	if _, err := c.DockerRunner.Stop(dockercli.StopCmd{
+		ContainerID: container.DockerID,
+		Timeout:     time.Second,
+	}); err != nil && !isNoSuchContainer(err) {
+		return fmt.Errorf("stop %s: %s", container.DockerID, err)
+	}
+
+	// A docker container which has already gone took its writable layer
+	// with it, leaving only the depot directory to scrub.
+	info, err := c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: container.DockerID})
+	if err != nil && !isNoSuchContainer(err) {
+		return fmt.Errorf("inspect %s: %s", container.DockerID, err)
+	}
+
+	if upperDir := info.GraphDriver.Data["UpperDir"]; upperDir != "" {
+		if err := c.Scrubber.Scrub(upperDir); err != nil {
+			return err
+		}
+	}
+
+	return c.Scrubber.Scrub(container.ContainerPath)
+}
+
+// dockerName derives the name of a container's docker container from its
+// handle, replacing any characters docker does not allow in names.
+func dockerName(handle string) string {
+	return "garden-" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, handle)
+}
+
+func labels(spec garden.ContainerSpec) map[string]string {
+	labels := map[string]string{
+		OwnerLabel:   "garden-docker",
+		HandleLabel:  spec.Handle,
+		VersionLabel: Version,
+	}
+
+	if owner, ok := spec.Properties[OwnerProperty]; ok {
+		labels[OwnerPropertyLabel] = owner
+	}
+
+	for k, v := range propertyLabels(spec.Properties) {
+		labels[k] = v
+	}
+
+	return labels
+}
+
+// withProperty returns a copy of props with the property set, leaving the
+// client's properties alone.
+func withProperty(props garden.Properties, name, value string) garden.Properties {
+	with := garden.Properties{name: value}
+	for k, v := range props {
+		if k != name {
+			with[k] = v
+		}
+	}
+
+	return with
 }
 
 type doshcmd struct {
 	Path      string
 	InitdSock string
+
+	// EnvDir is where the process's environment is written for dosh to
+	// read, rather than being passed in its arguments, where anyone on the
+	// host could see it with ps.
+	EnvDir string
 }
 
-func (d doshcmd) Cmd(path string, args ...string) *exec.Cmd {
-	doshArgs := []string{"-socketPath", d.InitdSock, "-user", "root"}
-	run := []string{path}
-	run = append(run, args...)
-	return exec.Command(d.Path, append(doshArgs, run...)...)
+func (d doshcmd) Cmd(processID uint32, spec garden.ProcessSpec) (*exec.Cmd, error) {
+	doshArgs := []string{"-socketPath", d.InitdSock, "-user", "root", "-processID", fmt.Sprint(processID)}
+	if spec.TTY != nil {
+		doshArgs = append(doshArgs, "-tty")
+	}
+
+	if spec.Dir != "" {
+		doshArgs = append(doshArgs, "-dir", spec.Dir)
+	}
+
+	if len(spec.Env) > 0 {
+		envFile, err := d.writeEnv(processID, spec.Env)
+		if err != nil {
+			return nil, err
+		}
+
+		doshArgs = append(doshArgs, "-envFile", envFile)
+	}
+
+	run := []string{spec.Path}
+	run = append(run, spec.Args...)
+	return exec.Command(d.Path, append(doshArgs, run...)...), nil
+}
+
+// writeEnv writes the process's environment to a file only root can read,
+// which dosh removes once it has read it.
+func (d doshcmd) writeEnv(processID uint32, env []string) (string, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return "", fmt.Errorf("write environment: %s", err)
+	}
+
+	path := filepath.Join(d.EnvDir, fmt.Sprintf("%d.env", processID))
+	if err := writeStateFile(path, data); err != nil {
+		return "", fmt.Errorf("write environment: %s", err)
+	}
+
+	return path, nil
 }
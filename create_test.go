@@ -2,26 +2,82 @@ package gardendocker_test
 
 import (
 	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
+	"github.com/docker/docker/pkg/iptables"
 	. "github.com/julz/garden-docker"
 	"github.com/julz/garden-docker/dockercli"
 	"github.com/julz/garden-docker/fakes"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Create", func() {
 	var creator *DaemonContainerCreator
 	var depot *fakes.FakeDepot
 	var dockerRunner *fakes.FakeDockerRunner
+	var tenantRootfs *TenantRootfs
+	var rewrites RootfsRewrites
+	var registryCredentials RegistryCredentials
+	var initBinDir string
+	var maxScratchTmpfs uint64
+	var firewall Firewall
+	var networker Networker
+	var dockerNetwork string
+	var ipPool, ipv6Pool *IPPool
+	var firewall6 Firewall
+	var dns DNSConfig
+	var links LinkConfigurer
+	var devices DeviceWhitelist
+	var userNamespace *UserNamespace
+	var seccompProfile, seccompProfileDir string
+	var appArmorProfile string
+	var cpus string
+	var until func(time.Time) DockerRunner
+	var depotDir string
 
 	BeforeEach(func() {
+		tenantRootfs = nil
+		rewrites = nil
+		registryCredentials = nil
+		initBinDir = ""
+		maxScratchTmpfs = 0
+		firewall = nil
+		networker = nil
+		dockerNetwork = ""
+		ipPool = nil
+		ipv6Pool = nil
+		firewall6 = nil
+		dns = DNSConfig{}
+		links = nil
+		devices = nil
+		userNamespace = nil
+		seccompProfile = ""
+		seccompProfileDir = ""
+		appArmorProfile = ""
+		cpus = ""
+		until = nil
 		dockerRunner = new(fakes.FakeDockerRunner)
 		depot = new(fakes.FakeDepot)
 
-		depot.CreateReturns("the-depot-dir", nil)
+		var err error
+		depotDir, err = ioutil.TempDir("", "depot")
+		Expect(err).NotTo(HaveOccurred())
+		depot.CreateReturns(depotDir, nil)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(depotDir)
 	})
 
 	JustBeforeEach(func() {
@@ -31,6 +87,32 @@ var _ = Describe("Create", func() {
 			DoshPath:      "dosh-path",
 			DockerRunner:  dockerRunner,
 			DefaultRootfs: "docker:///thedefaultimage",
+			TenantRootfs:  tenantRootfs,
+
+			RootfsRewrites:      rewrites,
+			RegistryCredentials: registryCredentials,
+			InitBinDir:          initBinDir,
+
+			MaxScratchTmpfs: maxScratchTmpfs,
+			Firewall:        firewall,
+			Networker:       networker,
+			DockerNetwork:   dockerNetwork,
+			IPPool:          ipPool,
+			IPv6Pool:        ipv6Pool,
+			Firewall6:       firewall6,
+			DNS:             dns,
+			Links:           links,
+			Devices:         devices,
+			UserNamespace:   userNamespace,
+
+			SeccompProfile:    seccompProfile,
+			SeccompProfileDir: seccompProfileDir,
+			AppArmorProfile:   appArmorProfile,
+
+			CPUs: cpus,
+
+			Until:          until,
+			CreateDeadline: time.Minute,
 		}
 	})
 
@@ -38,14 +120,26 @@ var _ = Describe("Create", func() {
 		var createdContainer *Container
 		var createError error
 		var rootfsPath string
+		var env []string
+		var properties garden.Properties
+		var handle string
+		var graceTime time.Duration
 
 		BeforeEach(func() {
+			handle = "some-handle"
 			rootfsPath = "docker:///somebuntu"
+			env = nil
+			properties = nil
+			graceTime = 0
 		})
 
 		JustBeforeEach(func() {
 			createdContainer, createError = creator.Create(garden.ContainerSpec{
+				Handle:     handle,
 				RootFSPath: rootfsPath,
+				Env:        env,
+				Properties: properties,
+				GraceTime:  graceTime,
 			})
 		})
 
@@ -53,6 +147,52 @@ var _ = Describe("Create", func() {
 			Expect(depot.CreateCallCount()).To(Equal(1))
 		})
 
+		Context("once the docker container has been run", func() {
+			var creating map[string]bool
+
+			BeforeEach(func() {
+				dockerRunner.RunReturns("some-docker-id", nil)
+				dockerRunner.InspectStub = func(dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+					creating = creator.Creating()
+					return dockercli.ContainerJSON{}, nil
+				}
+			})
+
+			It("reports it as being created until Create returns", func() {
+				Expect(creating).To(Equal(map[string]bool{"some-docker-id": true}))
+				Expect(creator.Creating()).To(BeEmpty())
+			})
+		})
+
+		Context("when docker commands can be given a deadline", func() {
+			var deadlineRunner *fakes.FakeDockerRunner
+			var deadline time.Time
+
+			BeforeEach(func() {
+				deadlineRunner = new(fakes.FakeDockerRunner)
+				deadlineRunner.RunReturns("some-docker-id", nil)
+				until = func(d time.Time) DockerRunner {
+					deadline = d
+					return deadlineRunner
+				}
+			})
+
+			It("runs the create's docker commands under one deadline", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(deadline).To(BeTemporally("~", time.Now().Add(time.Minute), 5*time.Second))
+
+				Expect(deadlineRunner.ImageInspectCallCount()).To(Equal(1))
+				Expect(deadlineRunner.RunCallCount()).To(Equal(1))
+				Expect(deadlineRunner.InspectCallCount()).To(Equal(1))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+
+			It("does not keep the deadline for the container's later commands", func() {
+				Expect(createdContainer.LimitCPU(garden.CPULimits{LimitInShares: 512})).To(Succeed())
+				Expect(dockerRunner.UpdateCallCount()).To(Equal(1))
+			})
+		})
+
 		Context("when creating the depot dir fails", func() {
 			BeforeEach(func() {
 				depot.CreateReturns("", errors.New("no depot for you"))
@@ -75,112 +215,1918 @@ var _ = Describe("Create", func() {
 			})
 		})
 
-		Context("and the docker run command fails", func() {
+		Context("when the rootfspath has an unsupported scheme", func() {
 			BeforeEach(func() {
-				dockerRunner.RunReturns("", errors.New("docker docker docker"))
+				rootfsPath = "raw:///some/dir"
 			})
 
-			It("returns a descriptive error", func() {
-				Expect(createError).To(MatchError("create: docker docker docker"))
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError(`create: unsupported rootfs scheme "raw"`))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
 			})
 		})
 
-		Context("andthe docker inspect command fails", func() {
+		Context("when the rootfspath has an invalid tag", func() {
 			BeforeEach(func() {
-				dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (string, error) {
-					return "", errors.New("something")
-				}
+				rootfsPath = "docker:///somebuntu#-bad"
 			})
 
-			It("returns an error", func() {
-				Expect(createError).To(HaveOccurred())
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError(`create: rootfs path "docker:///somebuntu#-bad" has an invalid tag "-bad"`))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
 			})
 		})
 
-		Context("and the command succeeds", func() {
-			JustBeforeEach(func() {
-				Expect(createError).ToNot(HaveOccurred())
+		Context("when the rootfspath has an invalid digest", func() {
+			BeforeEach(func() {
+				rootfsPath = "docker:///somebuntu@sha256:nothex"
 			})
 
-			It("spawns initd inside a docker container", func() {
-				Expect(dockerRunner.RunArgsForCall(0).Program).To(Equal("/garden-bin/initd"))
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError(`create: rootfs path "docker:///somebuntu@sha256:nothex" has an invalid digest "sha256:nothex"`))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the rootfspath gives a tag twice", func() {
+			BeforeEach(func() {
+				rootfsPath = "docker:///somebuntu:15.04#16.04"
 			})
 
-			It("asks for the image contained in the rootfspath", func() {
-				Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("somebuntu"))
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError(`create: rootfs path "docker:///somebuntu:15.04#16.04" gives a tag both in the image and as a fragment`))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
 			})
+		})
 
-			It("tells docker to detach (to avoid blocking forever)", func() {
-				Expect(dockerRunner.RunArgsForCall(0).Detach).To(Equal(true))
+		Context("when the image cannot be pulled", func() {
+			BeforeEach(func() {
+				dockerRunner.ImageInspectReturns(dockercli.ImageJSON{}, errors.New("no such image"))
+				dockerRunner.PullReturns("", errors.New("manifest unknown"))
 			})
 
-			Context("when the rootfspath is empty", func() {
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError("create: manifest unknown"))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when both a rootfspath and an image are given", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{ImageURIProperty: "docker:///someimage"}
+			})
+
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError("create: give either a rootfs path or an image, not both"))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+
+			It("removes the depot directory", func() {
+				Expect(depot.DestroyCallCount()).To(Equal(1))
+				Expect(depot.DestroyArgsForCall(0)).To(Equal(depotDir))
+			})
+		})
+
+		Context("when the disk limit scope is not known", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{DiskLimitScopeProperty: "some-of-it"}
+			})
+
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError(`create: unknown disk limit scope "some-of-it"`))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the container asks for an alternative init binary", func() {
+			BeforeEach(func() {
+				var err error
+				initBinDir, err = ioutil.TempDir("", "init-bin")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(ioutil.WriteFile(filepath.Join(initBinDir, "tini-ish"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(initBinDir, "not-executable"), []byte("#!/bin/sh"), 0644)).To(Succeed())
+
+				properties = garden.Properties{InitProperty: "tini-ish"}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(initBinDir)
+			})
+
+			It("mounts it in place of initd", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(ContainElement(dockercli.Volume{
+					HostPath:      filepath.Join(initBinDir, "tini-ish"),
+					ContainerPath: "/garden-bin/initd",
+				}))
+			})
+
+			Context("and alternative init binaries are not enabled", func() {
 				BeforeEach(func() {
-					rootfsPath = ""
+					initBinDir = ""
 				})
 
-				It("uses the default rootfspath", func() {
-					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("thedefaultimage"))
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: alternative init binaries are not enabled"))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
 				})
 			})
 
-			It("mounts the initd executable into the container", func() {
-				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(
-					ContainElement(dockercli.Volume{
-						HostPath:      "bin-path",
-						ContainerPath: "/garden-bin",
-					}),
-				)
+			Context("and it is outside the init binary directory", func() {
+				BeforeEach(func() {
+					properties[InitProperty] = "../tini-ish"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid init binary name "../tini-ish"`))
+				})
 			})
 
-			It("mounts the ./run directory into the container", func() {
-				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(
-					ContainElement(dockercli.Volume{
-						HostPath:      "the-depot-dir/run",
-						ContainerPath: "/run",
-					}),
-				)
+			Context("and it is not executable", func() {
+				BeforeEach(func() {
+					properties[InitProperty] = "not-executable"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: init binary "not-executable" is not an executable file`))
+				})
 			})
 
-			It("tells initd to listen on /run/initd.sock and unmount /run afterwards", func() {
-				Expect(dockerRunner.RunArgsForCall(0).ProgramArgs).To(
-					Equal([]string{
-						"-socketPath", "/run/initd.sock",
-						"-unmountDir", "/run",
-					}),
-				)
+			Context("and it does not exist", func() {
+				BeforeEach(func() {
+					properties[InitProperty] = "missing"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(HaveOccurred())
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		It("leaves the container with docker's default seccomp profile", func() {
+			Expect(dockerRunner.RunArgsForCall(0).SeccompProfile).To(BeEmpty())
+		})
+
+		Context("with a seccomp profile", func() {
+			BeforeEach(func() {
+				seccompProfile = "/etc/garden-docker/seccomp.json"
 			})
 
-			Describe("the created container", func() {
+			It("runs unprivileged containers with it", func() {
+				Expect(dockerRunner.RunArgsForCall(0).SeccompProfile).To(Equal("/etc/garden-docker/seccomp.json"))
+			})
+
+			Context("when the container is privileged", func() {
 				BeforeEach(func() {
-					dockerRunner.RunReturns("docker-container-id", nil)
-					dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (string, error) {
-						return cmd.Field + " of " + cmd.ContainerID, nil
-					}
+					rootfsPath = "docker+privileged:///somebuntu"
 				})
 
-				It("is configured to run commands via dosh", func() {
-					cmd := createdContainer.ContainerCmd.Cmd("foo", "bar", "baz")
+				It("leaves seccomp to --privileged", func() {
+					Expect(dockerRunner.RunArgsForCall(0).SeccompProfile).To(BeEmpty())
+				})
+			})
+		})
 
-					Expect(cmd.Path).To(Equal("dosh-path"))
-					Expect(cmd.Args).To(Equal([]string{
-						"dosh-path",
-						"-socketPath", "the-depot-dir/run/initd.sock",
-						"foo", "bar", "baz",
+		Context("when the container asks for an alternative seccomp profile", func() {
+			BeforeEach(func() {
+				var err error
+				seccompProfileDir, err = ioutil.TempDir("", "seccomp")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(seccompProfileDir, "strict.json"), []byte("{}"), 0644)).To(Succeed())
+
+				seccompProfile = "/etc/garden-docker/seccomp.json"
+				properties = garden.Properties{SeccompProfileProperty: "strict.json"}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(seccompProfileDir)
+			})
+
+			It("runs the container with it in place of the default", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).SeccompProfile).To(Equal(filepath.Join(seccompProfileDir, "strict.json")))
+			})
+
+			Context("and alternative seccomp profiles are not enabled", func() {
+				BeforeEach(func() {
+					seccompProfileDir = ""
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: alternative seccomp profiles are not enabled"))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("and it is outside the seccomp profile directory", func() {
+				BeforeEach(func() {
+					properties[SeccompProfileProperty] = "../strict.json"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid seccomp profile name "../strict.json"`))
+				})
+			})
+
+			Context("and it does not exist", func() {
+				BeforeEach(func() {
+					properties[SeccompProfileProperty] = "missing.json"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(HaveOccurred())
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the container asks for a cpuset", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{CPUSetProperty: "0-1,3"}
+			})
+
+			It("pins the docker container to it", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).CPUSetCPUs).To(Equal("0-1,3"))
+			})
+
+			Context("and it is not a valid cpuset", func() {
+				BeforeEach(func() {
+					properties[CPUSetProperty] = "all of them"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid cpuset "all of them"`))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("and some CPUs are reserved for the host", func() {
+				BeforeEach(func() {
+					cpus = "1-7"
+				})
+
+				It("aborts the container creation if the cpuset includes them", func() {
+					Expect(createError).To(MatchError(`create: cpuset "0-1,3" includes CPUs reserved for the host`))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when some CPUs are reserved for the host", func() {
+			BeforeEach(func() {
+				cpus = "2-7"
+			})
+
+			It("keeps the docker container off them", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).CPUSetCPUs).To(Equal("2-7"))
+			})
+
+			It("allows a cpuset within the rest", func() {
+				container, err := creator.Create(garden.ContainerSpec{
+					Handle:     "pinned",
+					Properties: garden.Properties{CPUSetProperty: "3,5-6"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container).NotTo(BeNil())
+				Expect(dockerRunner.RunArgsForCall(1).CPUSetCPUs).To(Equal("3,5-6"))
+			})
+		})
+
+		Context("when the container asks for an owner for streamed in files", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{StreamInOwnerProperty: "1000:1000"}
+			})
+
+			It("streams in as that owner", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(createdContainer.Streamer).To(BeAssignableToTypeOf(&DockerStreamer{}))
+				Expect(createdContainer.Streamer.(*DockerStreamer).Owner).To(Equal(&Owner{UID: 1000, GID: 1000}))
+			})
+
+			Context("and it is not a uid:gid", func() {
+				BeforeEach(func() {
+					properties[StreamInOwnerProperty] = "vcap"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid stream in owner "vcap": want uid:gid`))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when there is a firewall", func() {
+			var fakeFirewall *fakes.FakeFirewall
+
+			BeforeEach(func() {
+				fakeFirewall = new(fakes.FakeFirewall)
+				firewall = fakeFirewall
+
+				info := dockercli.ContainerJSON{}
+				info.NetworkSettings.IPAddress = "1.2.3.4"
+				dockerRunner.InspectReturns(info, nil)
+				dockerRunner.RunReturns("some-docker-id", nil)
+			})
+
+			It("sets up the container's egress rules", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				id, ip := fakeFirewall.SetupArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("1.2.3.4"))
+			})
+
+			It("passes NetOut rules to it", func() {
+				rule := garden.NetOutRule{Protocol: garden.ProtocolUDP}
+				Expect(createdContainer.NetOut(rule)).To(Succeed())
+
+				id, allowed := fakeFirewall.AllowArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(allowed).To(Equal(rule))
+			})
+
+			Context("and setting it up fails", func() {
+				BeforeEach(func() {
+					fakeFirewall.SetupReturns(errors.New("no chains left"))
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: firewall: no chains left"))
+				})
+
+				It("removes the docker container, so the handle can be used again", func() {
+					Expect(dockerRunner.RmCallCount()).To(Equal(1))
+					Expect(dockerRunner.RmArgsForCall(0)).To(Equal(dockercli.RmCmd{
+						ContainerID: "some-docker-id",
+						Force:       true,
 					}))
 				})
 
-				It("has its containerPath set", func() {
-					Expect(createdContainer.InfoHandler.ContainerPath).To(Equal("the-depot-dir"))
+				It("removes the depot directory", func() {
+					Expect(depot.DestroyCallCount()).To(Equal(1))
+					Expect(depot.DestroyArgsForCall(0)).To(Equal(depotDir))
 				})
+			})
+		})
 
-				It("has its ContainerIP set (based on the output of the docker inspect command)", func() {
-					Expect(createdContainer.InfoHandler.ContainerIP).To(Equal("NetworkSettings.IPAddress of docker-container-id"))
+		Context("when there is a networker", func() {
+			var fakeNetworker *fakes.FakeNetworker
+			var fakeFirewall *fakes.FakeFirewall
+
+			BeforeEach(func() {
+				fakeNetworker = new(fakes.FakeNetworker)
+				networker = fakeNetworker
+				fakeFirewall = new(fakes.FakeFirewall)
+				firewall = fakeFirewall
+
+				info := dockercli.ContainerJSON{ID: "some-docker-id"}
+				info.State.Pid = 1234
+				info.NetworkSettings.IPAddress = "1.2.3.4"
+				dockerRunner.InspectReturns(info, nil)
+				dockerRunner.RunReturns("some-docker-id", nil)
+			})
+
+			It("connects the container to the network", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(fakeNetworker.UpCallCount()).To(Equal(1))
+				Expect(fakeNetworker.UpArgsForCall(0)).To(Equal(NetworkContainer{
+					Handle:   "some-handle",
+					DockerID: "some-docker-id",
+					Pid:      1234,
+					IP:       "1.2.3.4",
+				}))
+			})
+
+			Context("and a link configurer", func() {
+				var fakeLinks *fakes.FakeLinkConfigurer
+
+				BeforeEach(func() {
+					fakeLinks = new(fakes.FakeLinkConfigurer)
+					links = fakeLinks
 				})
 
-				It("has its docker id set", func() {
-					Expect(createdContainer.InfoHandler.DockerID).To(Equal("docker-container-id"))
+				It("configures the container's interfaces once it is connected", func() {
+					Expect(createError).NotTo(HaveOccurred())
+					Expect(fakeLinks.ConfigureCallCount()).To(Equal(1))
+					Expect(fakeLinks.ConfigureArgsForCall(0)).To(Equal(1234))
+				})
+
+				Context("which fails", func() {
+					BeforeEach(func() {
+						fakeLinks.ConfigureReturns(errors.New("set mtu: no such device"))
+					})
+
+					It("aborts the container creation", func() {
+						Expect(createError).To(MatchError("create: set mtu: no such device"))
+					})
+
+					It("takes the container's network down again", func() {
+						Expect(fakeNetworker.DownCallCount()).To(Equal(1))
+						Expect(fakeNetworker.DownArgsForCall(0).Handle).To(Equal("some-handle"))
+					})
+				})
+			})
+
+			Context("which connects containers without a docker network", func() {
+				BeforeEach(func() {
+					dockerNetwork = "none"
+				})
+
+				It("starts the container without one", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Network).To(Equal("none"))
+				})
+			})
+
+			Context("which gives the container another IP", func() {
+				BeforeEach(func() {
+					fakeNetworker.UpReturns("10.0.0.5", nil)
 				})
+
+				It("uses it for the container and its egress rules", func() {
+					Expect(createError).NotTo(HaveOccurred())
+
+					info, err := createdContainer.Info()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.ContainerIP).To(Equal("10.0.0.5"))
+
+					_, ip := fakeFirewall.SetupArgsForCall(0)
+					Expect(ip).To(Equal("10.0.0.5"))
+				})
+			})
+
+			Context("and connecting the container fails", func() {
+				BeforeEach(func() {
+					fakeNetworker.UpReturns("", errors.New("no addresses left"))
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: no addresses left"))
+				})
+			})
+		})
+
+		Context("when there is an IP pool", func() {
+			BeforeEach(func() {
+				var err error
+				ipPool, err = NewIPPool("10.254.0.0/30")
+				Expect(err).NotTo(HaveOccurred())
+				dockerNetwork = "garden"
+			})
+
+			It("gives the container an IP from it", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).Network).To(Equal("garden"))
+				Expect(dockerRunner.RunArgsForCall(0).IP).To(Equal("10.254.0.2"))
+
+				_, err := ipPool.Acquire()
+				Expect(err).To(Equal(ErrIPPoolExhausted))
+			})
+
+			Context("and docker reports the IP on the named network", func() {
+				var fakeFirewall *fakes.FakeFirewall
+
+				BeforeEach(func() {
+					fakeFirewall = new(fakes.FakeFirewall)
+					firewall = fakeFirewall
+
+					// docker leaves the top-level address empty on
+					// user-defined networks
+					info := dockercli.ContainerJSON{ID: "some-docker-id"}
+					info.NetworkSettings.Networks = map[string]dockercli.EndpointSettings{
+						"garden": {IPAddress: "10.254.0.2"},
+					}
+					dockerRunner.InspectReturns(info, nil)
+					dockerRunner.RunReturns("some-docker-id", nil)
+				})
+
+				It("uses it for the container and its egress rules", func() {
+					Expect(createError).NotTo(HaveOccurred())
+
+					info, err := createdContainer.Info()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.ContainerIP).To(Equal("10.254.0.2"))
+
+					_, ip := fakeFirewall.SetupArgsForCall(0)
+					Expect(ip).To(Equal("10.254.0.2"))
+				})
+
+				It("returns the IP to the pool on destroy", func() {
+					Expect(creator.Destroy(createdContainer)).To(Succeed())
+					Expect(ipPool.Acquire()).To(Equal("10.254.0.2"))
+				})
+			})
+
+			Context("and inspecting the container reports no IP", func() {
+				BeforeEach(func() {
+					dockerRunner.InspectReturns(dockercli.ContainerJSON{ID: "some-docker-id"}, nil)
+				})
+
+				It("uses the IP it asked docker for", func() {
+					Expect(createError).NotTo(HaveOccurred())
+
+					info, err := createdContainer.Info()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.ContainerIP).To(Equal("10.254.0.2"))
+				})
+			})
+
+			Context("and docker fails to start the container", func() {
+				BeforeEach(func() {
+					dockerRunner.RunReturns("", errors.New("address already in use"))
+				})
+
+				It("returns the IP to the pool", func() {
+					Expect(createError).To(HaveOccurred())
+					Expect(ipPool.Acquire()).To(Equal("10.254.0.2"))
+				})
+			})
+
+			Context("and creation fails once the container is running", func() {
+				var fakeFirewall *fakes.FakeFirewall
+
+				BeforeEach(func() {
+					dockerRunner.RunReturns("some-docker-id", nil)
+					dockerRunner.InspectReturns(dockercli.ContainerJSON{ID: "some-docker-id"}, nil)
+
+					fakeFirewall = new(fakes.FakeFirewall)
+					fakeFirewall.SetupReturns(errors.New("no chains left"))
+					firewall = fakeFirewall
+				})
+
+				It("returns the IP to the pool", func() {
+					Expect(createError).To(HaveOccurred())
+					Expect(ipPool.Acquire()).To(Equal("10.254.0.2"))
+				})
+			})
+
+			Context("and the pool is exhausted", func() {
+				BeforeEach(func() {
+					_, err := ipPool.Acquire()
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("fails without starting a container", func() {
+					Expect(createError).To(MatchError("create: " + ErrIPPoolExhausted.Error()))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when there is an IPv6 pool", func() {
+			var fakeFirewall6 *fakes.FakeFirewall
+
+			BeforeEach(func() {
+				var err error
+				ipPool, err = NewIPPool("10.254.0.0/30")
+				Expect(err).NotTo(HaveOccurred())
+				ipv6Pool, err = NewIPPool("fd00::/126")
+				Expect(err).NotTo(HaveOccurred())
+				dockerNetwork = "garden"
+
+				fakeFirewall6 = new(fakes.FakeFirewall)
+				firewall6 = fakeFirewall6
+
+				info := dockercli.ContainerJSON{ID: "some-docker-id"}
+				info.NetworkSettings.Networks = map[string]dockercli.EndpointSettings{
+					"garden": {IPAddress: "10.254.0.2", GlobalIPv6Address: "fd00::2"},
+				}
+				dockerRunner.InspectReturns(info, nil)
+				dockerRunner.RunReturns("some-docker-id", nil)
+			})
+
+			Context("and inspecting the container reports no IPv6 address", func() {
+				BeforeEach(func() {
+					dockerRunner.InspectReturns(dockercli.ContainerJSON{ID: "some-docker-id"}, nil)
+				})
+
+				It("uses the address it asked docker for", func() {
+					Expect(createError).NotTo(HaveOccurred())
+
+					_, ip := fakeFirewall6.SetupArgsForCall(0)
+					Expect(ip).To(Equal("fd00::2"))
+				})
+			})
+
+			It("gives the container an IPv6 address from it too", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).IP).To(Equal("10.254.0.2"))
+				Expect(dockerRunner.RunArgsForCall(0).IPv6).To(Equal("fd00::2"))
+			})
+
+			It("reports both addresses in the container's info", func() {
+				info, err := createdContainer.Info()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ContainerIP).To(Equal("10.254.0.2"))
+				Expect(info.Properties).To(HaveKeyWithValue(ContainerIPv6Property, "fd00::2"))
+			})
+
+			It("sets up the IPv6 address's egress rules", func() {
+				Expect(fakeFirewall6.SetupCallCount()).To(Equal(1))
+				id, ip := fakeFirewall6.SetupArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("fd00::2"))
+			})
+
+			It("returns the IPv6 address to the pool on destroy", func() {
+				Expect(creator.Destroy(createdContainer)).To(Succeed())
+
+				// the pool hands out released addresses last
+				Expect(ipv6Pool.Acquire()).To(Equal("fd00::3"))
+				Expect(ipv6Pool.Acquire()).To(Equal("fd00::2"))
+			})
+
+			Context("and docker fails to start the container", func() {
+				BeforeEach(func() {
+					dockerRunner.RunReturns("", errors.New("address already in use"))
+				})
+
+				It("returns both addresses to their pools", func() {
+					Expect(createError).To(HaveOccurred())
+					Expect(ipPool.Acquire()).To(Equal("10.254.0.2"))
+					Expect(ipv6Pool.Acquire()).To(Equal("fd00::3"))
+					Expect(ipv6Pool.Acquire()).To(Equal("fd00::2"))
+				})
+			})
+		})
+
+		Context("when there are dns servers and host entries", func() {
+			BeforeEach(func() {
+				dns = DNSConfig{
+					Servers:     []string{"8.8.8.8", "8.8.4.4"},
+					HostEntries: []string{"10.0.0.1 db.internal db"},
+				}
+
+				info := dockercli.ContainerJSON{}
+				info.Config.Hostname = "some-hostname"
+				info.NetworkSettings.IPAddress = "1.2.3.4"
+				dockerRunner.InspectReturns(info, nil)
+				dockerRunner.RunReturns("some-docker-id", nil)
+			})
+
+			It("mounts a resolv.conf naming the servers", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(ContainElement(dockercli.Volume{
+					HostPath:      filepath.Join(depotDir, "etc", "resolv.conf"),
+					ContainerPath: "/etc/resolv.conf",
+				}))
+
+				Expect(ioutil.ReadFile(filepath.Join(depotDir, "etc", "resolv.conf"))).To(BeEquivalentTo(
+					"nameserver 8.8.8.8\nnameserver 8.8.4.4\n",
+				))
+			})
+
+			It("mounts an /etc/hosts with the entries and the container's own name", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(ContainElement(dockercli.Volume{
+					HostPath:      filepath.Join(depotDir, "etc", "hosts"),
+					ContainerPath: "/etc/hosts",
+				}))
+
+				Expect(ioutil.ReadFile(filepath.Join(depotDir, "etc", "hosts"))).To(BeEquivalentTo(
+					"127.0.0.1\tlocalhost\n" +
+						"::1\tlocalhost ip6-localhost ip6-loopback\n" +
+						"1.2.3.4\tsome-hostname\n" +
+						"10.0.0.1\tdb.internal db\n",
+				))
+			})
+
+			Context("and the container's properties override them", func() {
+				BeforeEach(func() {
+					properties = garden.Properties{
+						DNSServersProperty:  "1.1.1.1",
+						HostEntriesProperty: "",
+					}
+				})
+
+				It("uses the container's", func() {
+					Expect(createError).NotTo(HaveOccurred())
+					Expect(ioutil.ReadFile(filepath.Join(depotDir, "etc", "resolv.conf"))).To(BeEquivalentTo("nameserver 1.1.1.1\n"))
+					Expect(dockerRunner.RunArgsForCall(0).Volumes).NotTo(ContainElement(dockercli.Volume{
+						HostPath:      filepath.Join(depotDir, "etc", "hosts"),
+						ContainerPath: "/etc/hosts",
+					}))
+				})
+			})
+
+			Context("and the container's properties are invalid", func() {
+				BeforeEach(func() {
+					properties = garden.Properties{DNSServersProperty: "dns.google"}
+				})
+
+				It("fails without starting a container", func() {
+					Expect(createError).To(MatchError(`create: invalid dns server "dns.google": want an IP address`))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when there is a device whitelist", func() {
+			var fakeDevices *fakes.FakeDeviceWhitelist
+
+			BeforeEach(func() {
+				fakeDevices = new(fakes.FakeDeviceWhitelist)
+				devices = fakeDevices
+
+				dockerRunner.RunReturns("some-docker-id", nil)
+			})
+
+			It("applies it to the container", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(fakeDevices.ApplyCallCount()).To(Equal(1))
+				Expect(fakeDevices.ApplyArgsForCall(0)).To(Equal("some-docker-id"))
+			})
+
+			Context("and applying it fails", func() {
+				BeforeEach(func() {
+					fakeDevices.ApplyReturns(errors.New("devices cgroup: no such file"))
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: devices cgroup: no such file"))
+				})
+			})
+
+			Context("and the container is privileged", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker+privileged:///somebuntu"
+				})
+
+				It("lets it use every device", func() {
+					Expect(createError).NotTo(HaveOccurred())
+					Expect(fakeDevices.ApplyCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the container asks for tmpfs scratch space", func() {
+			BeforeEach(func() {
+				maxScratchTmpfs = 1024 * 1024
+				properties = garden.Properties{ScratchTmpfsProperty: "4096"}
+			})
+
+			It("mounts a tmpfs of that size on the scratch path", func() {
+				Expect(createError).NotTo(HaveOccurred())
+				Expect(dockerRunner.RunArgsForCall(0).Tmpfs).To(Equal([]dockercli.Tmpfs{
+					{ContainerPath: ScratchPath, SizeInBytes: 4096},
+				}))
+			})
+
+			Context("and tmpfs scratch space is not enabled", func() {
+				BeforeEach(func() {
+					maxScratchTmpfs = 0
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: tmpfs scratch space is not enabled"))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("and the size is larger than the maximum", func() {
+				BeforeEach(func() {
+					properties[ScratchTmpfsProperty] = "2097152"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError("create: tmpfs scratch size 2097152 exceeds the maximum of 1048576"))
+				})
+			})
+
+			Context("and the size is not a number", func() {
+				BeforeEach(func() {
+					properties[ScratchTmpfsProperty] = "1g"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid tmpfs scratch size "1g"`))
+				})
+			})
+		})
+
+		Context("when the container asks for a read-only rootfs", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{ReadOnlyRootfsProperty: "true"}
+			})
+
+			It("makes the rootfs read-only, with a small tmpfs on the scratch path", func() {
+				Expect(createError).NotTo(HaveOccurred())
+
+				runCmd := dockerRunner.RunArgsForCall(0)
+				Expect(runCmd.ReadOnly).To(BeTrue())
+				Expect(runCmd.Tmpfs).To(Equal([]dockercli.Tmpfs{
+					{ContainerPath: ScratchPath, SizeInBytes: ReadOnlyScratchTmpfsSize},
+				}))
+			})
+
+			It("keeps /run writable, since it is initd's directory", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(ContainElement(dockercli.Volume{
+					HostPath:      filepath.Join(depotDir, "run"),
+					ContainerPath: "/run",
+				}))
+			})
+
+			Context("and tmpfs scratch space of its own size", func() {
+				BeforeEach(func() {
+					maxScratchTmpfs = 1024 * 1024
+					properties[ScratchTmpfsProperty] = "4096"
+				})
+
+				It("uses that size instead", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Tmpfs).To(Equal([]dockercli.Tmpfs{
+						{ContainerPath: ScratchPath, SizeInBytes: 4096},
+					}))
+				})
+			})
+
+			Context("with an invalid value", func() {
+				BeforeEach(func() {
+					properties[ReadOnlyRootfsProperty] = "yes"
+				})
+
+				It("aborts the container creation", func() {
+					Expect(createError).To(MatchError(`create: invalid read-only rootfs "yes": want true or false`))
+					Expect(dockerRunner.RunCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		It("leaves the rootfs writable by default", func() {
+			Expect(dockerRunner.RunArgsForCall(0).ReadOnly).To(BeFalse())
+		})
+
+		Context("when logging in to the image's registry fails", func() {
+			BeforeEach(func() {
+				properties = garden.Properties{
+					ImageUsernameProperty: "some-user",
+					ImagePasswordProperty: "wrong-password",
+				}
+				dockerRunner.LoginReturns("", errors.New("login: unauthorized"))
+			})
+
+			It("aborts the container creation", func() {
+				Expect(createError).To(MatchError("create: login: unauthorized"))
+				Expect(dockerRunner.PullCallCount()).To(Equal(0))
+				Expect(dockerRunner.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("and the docker run command fails", func() {
+			BeforeEach(func() {
+				dockerRunner.RunReturns("", errors.New("docker docker docker"))
+			})
+
+			It("returns a descriptive error", func() {
+				Expect(createError).To(MatchError("create: docker docker docker"))
+			})
+		})
+
+		Context("andthe docker inspect command fails", func() {
+			BeforeEach(func() {
+				dockerRunner.InspectReturns(dockercli.ContainerJSON{}, errors.New("something"))
+			})
+
+			It("returns an error", func() {
+				Expect(createError).To(HaveOccurred())
+			})
+		})
+
+		Context("and the command succeeds", func() {
+			JustBeforeEach(func() {
+				Expect(createError).ToNot(HaveOccurred())
+			})
+
+			It("spawns initd inside a docker container", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Program).To(Equal("/garden-bin/initd"))
+			})
+
+			It("asks for the image contained in the rootfspath", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("somebuntu"))
+			})
+
+			It("labels the docker container as owned by garden-docker", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Labels).To(HaveKey(OwnerLabel))
+			})
+
+			It("labels the docker container with the handle and garden-docker version", func() {
+				labels := dockerRunner.RunArgsForCall(0).Labels
+				Expect(labels).To(HaveKeyWithValue(HandleLabel, "some-handle"))
+				Expect(labels).To(HaveKeyWithValue(VersionLabel, Version))
+				Expect(labels).NotTo(HaveKey(OwnerPropertyLabel))
+			})
+
+			It("names the docker container after the handle", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Name).To(Equal("garden-some-handle"))
+			})
+
+			Context("when the handle has characters docker does not allow in names", func() {
+				BeforeEach(func() {
+					handle = "some handle/with:odd chars"
+				})
+
+				It("replaces them in the name", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Name).To(Equal("garden-some_handle_with_odd_chars"))
+				})
+
+				It("keeps the handle as it is in the label", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Labels).To(HaveKeyWithValue(HandleLabel, "some handle/with:odd chars"))
+				})
+			})
+
+			Context("when no handle is given", func() {
+				BeforeEach(func() {
+					handle = ""
+				})
+
+				It("generates one", func() {
+					Expect(createdContainer.Handle()).NotTo(BeEmpty())
+					Expect(dockerRunner.RunArgsForCall(0).Name).To(Equal("garden-" + createdContainer.Handle()))
+				})
+			})
+
+			Context("when the container asks for gzipped StreamOut", func() {
+				BeforeEach(func() {
+					properties = garden.Properties{StreamOutCompressionProperty: "gzip"}
+				})
+
+				It("compresses streamed out tars", func() {
+					Expect(createdContainer.StreamHandler.GzipStreamOut).To(BeTrue())
+				})
+			})
+
+			Context("when the container has an owner property", func() {
+				BeforeEach(func() {
+					properties = garden.Properties{OwnerProperty: "some-owner"}
+				})
+
+				It("copies it to a label", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Labels).To(HaveKeyWithValue(OwnerPropertyLabel, "some-owner"))
+				})
+			})
+
+			Context("when the container has properties", func() {
+				BeforeEach(func() {
+					properties = garden.Properties{
+						"app.name":          "some-app",
+						"Not A Label":       "x",
+						"docker.label.team": "y",
+					}
+				})
+
+				It("writes those with valid label keys as labels", func() {
+					labels := dockerRunner.RunArgsForCall(0).Labels
+					Expect(labels).To(HaveKeyWithValue(PropertyLabelPrefix+"app.name", "some-app"))
+					Expect(labels).NotTo(HaveKey(PropertyLabelPrefix + "Not A Label"))
+					Expect(labels).NotTo(HaveKey(PropertyLabelPrefix + "docker.label.team"))
+				})
+			})
+
+			Context("when the docker container has labels", func() {
+				BeforeEach(func() {
+					info := dockercli.ContainerJSON{}
+					info.Config.Labels = map[string]string{
+						"maintainer": "someone",
+						OwnerLabel:   "garden-docker",
+					}
+					dockerRunner.InspectReturns(info, nil)
+				})
+
+				It("imports them as read-only properties", func() {
+					props, err := createdContainer.GetProperties()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(props).To(HaveKeyWithValue(LabelPropertyPrefix+"maintainer", "someone"))
+					Expect(props).NotTo(HaveKey(LabelPropertyPrefix + OwnerLabel))
+
+					Expect(createdContainer.SetProperty(LabelPropertyPrefix+"maintainer", "other")).NotTo(Succeed())
+				})
+			})
+
+			Context("when the container spec has an environment", func() {
+				BeforeEach(func() {
+					env = []string{"A=1"}
+				})
+
+				It("passes it to docker, which applies it over the image's environment", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Env).To(Equal([]string{"A=1"}))
+				})
+			})
+
+			Context("when the rootfspath names a registry", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker://registry.example.com:5000/somebuntu"
+				})
+
+				It("asks for the image from that registry", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("registry.example.com:5000/somebuntu"))
+				})
+			})
+
+			Context("when the rootfspath gives a tag as its fragment", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker://registry.example.com:5000/somebuntu#16.04"
+				})
+
+				It("asks for that tag of the image", func() {
+					Expect(dockerRunner.ImageInspectArgsForCall(0).Image).To(Equal("registry.example.com:5000/somebuntu:16.04"))
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("registry.example.com:5000/somebuntu:16.04"))
+				})
+			})
+
+			Context("when the image has not been pulled yet", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker:///somebuntu#16.04"
+					dockerRunner.ImageInspectStub = func(dockercli.ImageInspectCmd) (dockercli.ImageJSON, error) {
+						if dockerRunner.PullCallCount() == 0 {
+							return dockercli.ImageJSON{}, errors.New("no such image")
+						}
+
+						return dockercli.ImageJSON{}, nil
+					}
+				})
+
+				It("pulls exactly the requested tag", func() {
+					Expect(dockerRunner.PullArgsForCall(0)).To(Equal(dockercli.PullCmd{Image: "somebuntu:16.04"}))
+				})
+			})
+
+			Context("when the image was pulled from a registry", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker://registry.example.com:5000/somebuntu:16.04"
+					dockerRunner.ImageInspectReturns(dockercli.ImageJSON{RepoDigests: []string{
+						"mirror.example.com/somebuntu@sha256:ffff",
+						"registry.example.com:5000/somebuntu@sha256:abababababababababababababababababababababababababababababababab",
+					}}, nil)
+				})
+
+				It("records the digest the tag resolved to as a property", func() {
+					props, err := createdContainer.GetProperties()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(props).To(HaveKeyWithValue(RootfsDigestProperty, "sha256:abababababababababababababababababababababababababababababababab"))
+				})
+			})
+
+			Context("when the rootfspath pins a digest", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker:///somebuntu@sha256:abababababababababababababababababababababababababababababababab"
+				})
+
+				It("asks for the image by digest", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("somebuntu@sha256:abababababababababababababababababababababababababababababababab"))
+				})
+
+				It("records the digest as a property", func() {
+					props, err := createdContainer.GetProperties()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(props).To(HaveKeyWithValue(RootfsDigestProperty, "sha256:abababababababababababababababababababababababababababababababab"))
+				})
+			})
+
+			Context("when the container has a grace time", func() {
+				BeforeEach(func() {
+					graceTime = 5 * time.Minute
+				})
+
+				It("records it as a property, so that it survives a restart", func() {
+					Expect(createdContainer.GetProperty(GraceTimeProperty)).To(Equal("5m0s"))
+					Expect(createdContainer.GraceTime).To(Equal(5 * time.Minute))
+				})
+			})
+
+			Context("when the image was never pulled from a registry", func() {
+				It("records no digest", func() {
+					props, err := createdContainer.GetProperties()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(props).NotTo(HaveKey(RootfsDigestProperty))
+				})
+			})
+
+			Context("when a rewrite matches the rootfspath", func() {
+				BeforeEach(func() {
+					rewrites = RootfsRewrites{{From: "docker:///some", To: "docker://mirror.internal/mirrored-"}}
+				})
+
+				It("asks for the rewritten image", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("mirror.internal/mirrored-buntu"))
+				})
+			})
+
+			Context("when an image is given in the properties instead of a rootfspath", func() {
+				BeforeEach(func() {
+					rootfsPath = ""
+					properties = garden.Properties{ImageURIProperty: "docker://registry.example.com/someimage"}
+				})
+
+				It("asks for that image", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("registry.example.com/someimage"))
+				})
+
+				It("does not log in to the registry", func() {
+					Expect(dockerRunner.LoginCallCount()).To(Equal(0))
+				})
+
+				Context("and the operator has configured credentials for the registry", func() {
+					BeforeEach(func() {
+						registryCredentials = RegistryCredentials{
+							"registry.example.com": {Username: "operator", Password: "operator-password"},
+						}
+					})
+
+					It("logs in with them and pulls the image", func() {
+						Expect(dockerRunner.LoginArgsForCall(0)).To(Equal(dockercli.LoginCmd{
+							ConfigDir: filepath.Join(depotDir, "docker-config"),
+							Registry:  "registry.example.com",
+							Username:  "operator",
+							Password:  "operator-password",
+						}))
+						Expect(dockerRunner.PullArgsForCall(0).Image).To(Equal("registry.example.com/someimage"))
+					})
+
+					Context("and the container gives credentials of its own", func() {
+						BeforeEach(func() {
+							properties[ImageUsernameProperty] = "some-user"
+							properties[ImagePasswordProperty] = "some-password"
+						})
+
+						It("logs in with the container's credentials instead", func() {
+							Expect(dockerRunner.LoginCallCount()).To(Equal(1))
+							Expect(dockerRunner.LoginArgsForCall(0).Username).To(Equal("some-user"))
+						})
+					})
+				})
+
+				Context("with credentials", func() {
+					BeforeEach(func() {
+						properties[ImageUsernameProperty] = "some-user"
+						properties[ImagePasswordProperty] = "some-password"
+					})
+
+					It("logs in to the image's registry with a config directory of the container's own", func() {
+						Expect(dockerRunner.LoginCallCount()).To(Equal(1))
+						Expect(dockerRunner.LoginArgsForCall(0)).To(Equal(dockercli.LoginCmd{
+							ConfigDir: filepath.Join(depotDir, "docker-config"),
+							Registry:  "registry.example.com",
+							Username:  "some-user",
+							Password:  "some-password",
+						}))
+					})
+
+					It("pulls the image with the same config directory", func() {
+						Expect(dockerRunner.PullArgsForCall(0)).To(Equal(dockercli.PullCmd{
+							Image:     "registry.example.com/someimage",
+							ConfigDir: filepath.Join(depotDir, "docker-config"),
+						}))
+					})
+
+					It("does not keep the credentials in the container's properties", func() {
+						props, err := createdContainer.GetProperties()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(props).To(Equal(garden.Properties{ImageURIProperty: "docker://registry.example.com/someimage"}))
+						Expect(createdContainer.Spec.Properties).To(Equal(props))
+					})
+				})
+			})
+
+			It("does not make the container privileged", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Privileged).To(BeFalse())
+			})
+
+			It("gives the container only the unprivileged capabilities, and no new privileges", func() {
+				runCmd := dockerRunner.RunArgsForCall(0)
+				Expect(runCmd.CapDrop).To(Equal([]string{"ALL"}))
+				Expect(runCmd.CapAdd).To(Equal(UnprivilegedCapabilities))
+				Expect(runCmd.CapAdd).NotTo(ContainElement("SYS_ADMIN"))
+				Expect(runCmd.SecurityOpt).To(ContainElement("no-new-privileges"))
+			})
+
+			It("leaves the container in docker's default apparmor profile", func() {
+				Expect(dockerRunner.RunArgsForCall(0).SecurityOpt).To(Equal([]string{"no-new-privileges"}))
+			})
+
+			Context("with an apparmor profile", func() {
+				BeforeEach(func() {
+					appArmorProfile = "garden-docker-default"
+				})
+
+				It("confines an unprivileged container, and so the processes initd spawns, with it", func() {
+					Expect(dockerRunner.RunArgsForCall(0).SecurityOpt).To(ContainElement("apparmor=garden-docker-default"))
+				})
+
+				Context("when the container is privileged", func() {
+					BeforeEach(func() {
+						rootfsPath = "docker+privileged:///somebuntu"
+					})
+
+					It("leaves it unconfined, as docker --privileged does", func() {
+						Expect(dockerRunner.RunArgsForCall(0).SecurityOpt).To(BeEmpty())
+					})
+				})
+			})
+
+			Context("when the rootfspath uses the docker+privileged scheme", func() {
+				BeforeEach(func() {
+					rootfsPath = "docker+privileged:///somebuntu"
+				})
+
+				It("asks for the image contained in the rootfspath", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("somebuntu"))
+				})
+
+				It("makes the container privileged", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Privileged).To(BeTrue())
+				})
+
+				It("leaves its capabilities and security options to --privileged", func() {
+					runCmd := dockerRunner.RunArgsForCall(0)
+					Expect(runCmd.CapDrop).To(BeEmpty())
+					Expect(runCmd.CapAdd).To(BeEmpty())
+					Expect(runCmd.SecurityOpt).To(BeEmpty())
+				})
+			})
+
+			It("leaves the container in dockerd's user namespace mode", func() {
+				Expect(dockerRunner.RunArgsForCall(0).UsernsMode).To(BeEmpty())
+			})
+
+			Context("with a user namespace", func() {
+				BeforeEach(func() {
+					userNamespace = &UserNamespace{RootUID: 100000, RootGID: 200000}
+					Expect(os.Mkdir(filepath.Join(depotDir, "run"), 0700)).To(Succeed())
+				})
+
+				It("keeps an unprivileged container in it, handing its run directory to its root user", func() {
+					Expect(createError).NotTo(HaveOccurred())
+					Expect(dockerRunner.RunArgsForCall(0).UsernsMode).To(BeEmpty())
+
+					info, err := os.Stat(filepath.Join(depotDir, "run"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Sys().(*syscall.Stat_t).Uid).To(BeEquivalentTo(100000))
+					Expect(info.Sys().(*syscall.Stat_t).Gid).To(BeEquivalentTo(200000))
+				})
+
+				Context("when the container is privileged", func() {
+					BeforeEach(func() {
+						rootfsPath = "docker+privileged:///somebuntu"
+					})
+
+					It("shares the host's user namespace", func() {
+						Expect(dockerRunner.RunArgsForCall(0).UsernsMode).To(Equal("host"))
+					})
+				})
+			})
+
+			It("tells docker to detach (to avoid blocking forever)", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Detach).To(Equal(true))
+			})
+
+			Context("when the rootfspath is empty", func() {
+				BeforeEach(func() {
+					rootfsPath = ""
+				})
+
+				It("uses the default rootfspath", func() {
+					Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("thedefaultimage"))
+				})
+
+				Context("and the container's tenant has a default rootfs", func() {
+					BeforeEach(func() {
+						properties = garden.Properties{"space": "some-space"}
+						tenantRootfs = &TenantRootfs{
+							Property: "space",
+							Rootfses: map[string]string{"some-space": "docker:///tenantimage"},
+						}
+					})
+
+					It("uses the tenant's default rootfs", func() {
+						Expect(dockerRunner.RunArgsForCall(0).Image).To(Equal("tenantimage"))
+					})
+				})
+			})
+
+			It("mounts the initd executable into the container", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(
+					ContainElement(dockercli.Volume{
+						HostPath:      "bin-path",
+						ContainerPath: "/garden-bin",
+					}),
+				)
+			})
+
+			It("mounts the ./run directory into the container", func() {
+				Expect(dockerRunner.RunArgsForCall(0).Volumes).To(
+					ContainElement(dockercli.Volume{
+						HostPath:      filepath.Join(depotDir, "run"),
+						ContainerPath: "/run",
+					}),
+				)
+			})
+
+			It("tells initd to listen on /run/initd.sock and unmount /run afterwards", func() {
+				Expect(dockerRunner.RunArgsForCall(0).ProgramArgs).To(
+					Equal([]string{
+						"-socketPath", "/run/initd.sock",
+						"-unmountDir", "/run",
+					}),
+				)
+			})
+
+			Describe("the created container", func() {
+				BeforeEach(func() {
+					dockerRunner.RunReturns("docker-container-id", nil)
+					dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+						var info dockercli.ContainerJSON
+						info.NetworkSettings.IPAddress = "ip of " + cmd.ContainerID
+						return info, nil
+					}
+				})
+
+				It("reports disk usage in the total scope", func() {
+					Expect(createdContainer.DiskScope).To(Equal(DiskLimitScopeTotal))
+				})
+
+				Context("when the container asks for the exclusive disk limit scope", func() {
+					BeforeEach(func() {
+						properties = garden.Properties{DiskLimitScopeProperty: "exclusive"}
+					})
+
+					It("reports disk usage in the exclusive scope", func() {
+						Expect(createdContainer.DiskScope).To(Equal(DiskLimitScopeExclusive))
+					})
+				})
+
+				It("reads its disk usage from docker inspect", func() {
+					dockerRunner.InspectStub = func(cmd dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+						var info dockercli.ContainerJSON
+						if cmd.ContainerID == "docker-container-id" && cmd.Size {
+							info.SizeRw, info.SizeRootFs = 10, 110
+						}
+						return info, nil
+					}
+
+					metrics, err := createdContainer.Metrics()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(metrics.DiskStat.BytesUsed).To(Equal(uint64(110)))
+				})
+
+				It("is configured to run commands via dosh", func() {
+					cmd, err := createdContainer.ContainerCmd.Cmd(3, garden.ProcessSpec{Path: "foo", Args: []string{"bar", "baz"}})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(cmd.Path).To(Equal("dosh-path"))
+					Expect(cmd.Args).To(Equal([]string{
+						"dosh-path",
+						"-socketPath", filepath.Join(depotDir, "run", "initd.sock"),
+						"foo", "bar", "baz",
+					}))
+				})
+
+				It("passes the process's environment to dosh in a file only root can read, rather than in its arguments", func() {
+					Expect(os.MkdirAll(filepath.Join(depotDir, "processes"), 0700)).To(Succeed())
+
+					cmd, err := createdContainer.ContainerCmd.Cmd(3, garden.ProcessSpec{
+						Path: "foo",
+						Env:  []string{"A=1", "B=2"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					envFile := filepath.Join(depotDir, "processes", "3.env")
+					Expect(cmd.Args[len(cmd.Args)-3:]).To(Equal([]string{"-envFile", envFile, "foo"}))
+					Expect(cmd.Args).NotTo(ContainElement("A=1"))
+
+					Expect(ioutil.ReadFile(envFile)).To(MatchJSON(`["A=1","B=2"]`))
+					info, err := os.Stat(envFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+				})
+
+				It("passes the process's working directory to dosh", func() {
+					cmd, err := createdContainer.ContainerCmd.Cmd(3, garden.ProcessSpec{Path: "foo", Dir: "/some/dir"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(strings.Join(cmd.Args, " ")).To(ContainSubstring("-dir /some/dir foo"))
+				})
+
+				It("names the process in initd by its id, so that it can be signalled", func() {
+					cmd, err := createdContainer.ContainerCmd.Cmd(3, garden.ProcessSpec{Path: "foo"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(strings.Join(cmd.Args, " ")).To(ContainSubstring("-processID 3"))
+
+					Expect(createdContainer.RunHandler.InitdSock).To(Equal(filepath.Join(depotDir, "run", "initd.sock")))
+				})
+
+				It("does not compress streamed out tars", func() {
+					Expect(createdContainer.StreamHandler.GzipStreamOut).To(BeFalse())
+				})
+
+				It("has its containerPath set", func() {
+					Expect(createdContainer.InfoHandler.ContainerPath).To(Equal(depotDir))
+				})
+
+				It("saves its properties in the depot directory", func() {
+					Expect(filepath.Join(depotDir, "props.json")).To(BeAnExistingFile())
+				})
+
+				It("has its ContainerIP set (based on the output of the docker inspect command)", func() {
+					Expect(createdContainer.InfoHandler.ContainerIP).To(Equal("ip of docker-container-id"))
+				})
+
+				It("has its docker id set", func() {
+					Expect(createdContainer.InfoHandler.DockerID).To(Equal("docker-container-id"))
+				})
+			})
+		})
+	})
+
+	Describe("Stop", func() {
+		It("stops the docker container", func() {
+			container := &Container{InfoHandler: &InfoHandler{DockerID: "some-docker-id"}}
+
+			Expect(creator.Stop(container)).To(Succeed())
+			Expect(dockerRunner.StopArgsForCall(0)).To(Equal(dockercli.StopCmd{ContainerID: "some-docker-id"}))
+		})
+	})
+
+	Describe("Running", func() {
+		BeforeEach(func() {
+			dockerRunner.PsReturns([]dockercli.PsEntry{{ID: "abc"}, {ID: "def"}}, nil)
+		})
+
+		It("lists all running containers, including adopted ones without the owner label", func() {
+			running, err := creator.Running()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(running).To(Equal(map[string]bool{"abc": true, "def": true}))
+
+			Expect(dockerRunner.PsArgsForCall(0)).To(Equal(dockercli.PsCmd{}))
+		})
+	})
+
+	Describe("PullDefaultRootfs", func() {
+		It("pulls the default rootfs image", func() {
+			Expect(creator.PullDefaultRootfs()).To(Succeed())
+			Expect(dockerRunner.PullArgsForCall(0)).To(Equal(dockercli.PullCmd{Image: "thedefaultimage"}))
+		})
+
+		Context("when the default rootfs is not a docker image", func() {
+			It("returns an error without pulling anything", func() {
+				creator.DefaultRootfs = "/some/dir"
+
+				Expect(creator.PullDefaultRootfs()).To(MatchError(`default rootfs: unsupported rootfs scheme ""`))
+				Expect(dockerRunner.PullCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the default rootfs does not name an image", func() {
+			It("returns an error without pulling anything", func() {
+				creator.DefaultRootfs = "docker:///"
+
+				Expect(creator.PullDefaultRootfs()).To(MatchError(`default rootfs: rootfs path "docker:///" does not name an image`))
+				Expect(dockerRunner.PullCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the pull fails", func() {
+			It("returns an error", func() {
+				dockerRunner.PullReturns("", errors.New("not found"))
+				Expect(creator.PullDefaultRootfs()).To(MatchError("default rootfs: not found"))
+			})
+		})
+
+		Context("when the operator has configured credentials for docker hub", func() {
+			BeforeEach(func() {
+				registryCredentials = RegistryCredentials{
+					DockerHubRegistry: {Username: "operator", Password: "operator-password"},
+				}
+			})
+
+			It("logs in and pulls with a temporary config directory, which it removes", func() {
+				Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+				login := dockerRunner.LoginArgsForCall(0)
+				Expect(login.Registry).To(BeEmpty())
+				Expect(login.Username).To(Equal("operator"))
+				Expect(login.Password).To(Equal("operator-password"))
+
+				pull := dockerRunner.PullArgsForCall(0)
+				Expect(pull).To(Equal(dockercli.PullCmd{Image: "thedefaultimage", ConfigDir: login.ConfigDir}))
+				Expect(login.ConfigDir).NotTo(BeAnExistingFile())
+			})
+
+			Context("when logging in fails", func() {
+				It("returns an error without pulling anything", func() {
+					dockerRunner.LoginReturns("", errors.New("login: unauthorized"))
+
+					Expect(creator.PullDefaultRootfs()).To(MatchError("default rootfs: login: unauthorized"))
+					Expect(dockerRunner.PullCallCount()).To(Equal(0))
+				})
+			})
+		})
+	})
+
+	Describe("Recover", func() {
+		var container *Container
+		var depotDir string
+		var initdListener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			depotDir, err = ioutil.TempDir("", "depot")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(depotDir, "run"), 0700)).To(Succeed())
+
+			initdListener, err = net.Listen("unix", filepath.Join(depotDir, "run", "initd.sock"))
+			Expect(err).NotTo(HaveOccurred())
+
+			container = &Container{
+				InfoHandler: &InfoHandler{
+					DockerID:      "some-docker-id",
+					ContainerIP:   "old-ip",
+					ContainerPath: depotDir,
+					PropsHandler:  NewPropsHandler(nil),
+				},
+				NetHandler:      &NetHandler{ContainerIP: "old-ip", Chain: new(fakes.FakeChain)},
+				ActivityHandler: &ActivityHandler{ContainerIP: "old-ip"},
+			}
+
+			dockerRunner.InspectStub = func(dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+				var info dockercli.ContainerJSON
+				info.State.Running = dockerRunner.StartCallCount() > 0
+				info.NetworkSettings.IPAddress = "new-ip"
+				return info, nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			creator.InitdTimeout = 100 * time.Millisecond
+		})
+
+		AfterEach(func() {
+			initdListener.Close()
+			os.RemoveAll(depotDir)
+		})
+
+		It("starts the docker container again", func() {
+			Expect(creator.Recover(container)).To(Succeed())
+			Expect(dockerRunner.StartArgsForCall(0)).To(Equal(dockercli.StartCmd{ContainerID: "some-docker-id"}))
+		})
+
+		It("updates the container's IP everywhere", func() {
+			Expect(creator.Recover(container)).To(Succeed())
+
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ContainerIP).To(Equal("new-ip"))
+			Expect(container.NetHandler.ContainerIP).To(Equal("new-ip"))
+			Expect(container.ActivityHandler.ContainerIP).To(Equal("new-ip"))
+		})
+
+		Context("when the container's egress is restricted", func() {
+			var fakeFirewall *fakes.FakeFirewall
+			var rule garden.NetOutRule
+
+			BeforeEach(func() {
+				fakeFirewall = new(fakes.FakeFirewall)
+				container.NetHandler.Firewall = fakeFirewall
+				container.NetHandler.FirewallID = "some-docker-id"
+
+				rule = garden.NetOutRule{Protocol: garden.ProtocolTCP}
+				container.RecoverNetOut([]garden.NetOutRule{rule})
+			})
+
+			It("moves its firewall rules to its new IP", func() {
+				Expect(creator.Recover(container)).To(Succeed())
+
+				Expect(fakeFirewall.TeardownCallCount()).To(Equal(1))
+				id, ip := fakeFirewall.TeardownArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("old-ip"))
+
+				Expect(fakeFirewall.SetupCallCount()).To(Equal(1))
+				id, ip = fakeFirewall.SetupArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("new-ip"))
+
+				Expect(fakeFirewall.AllowCallCount()).To(Equal(1))
+				id, allowed := fakeFirewall.AllowArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(allowed).To(Equal(rule))
+			})
+
+			Context("when the IP has not changed", func() {
+				BeforeEach(func() {
+					container.NetHandler.ContainerIP = "new-ip"
+				})
+
+				It("leaves its firewall rules alone", func() {
+					Expect(creator.Recover(container)).To(Succeed())
+					Expect(fakeFirewall.TeardownCallCount()).To(Equal(0))
+					Expect(fakeFirewall.SetupCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when setting up the rules for the new IP fails", func() {
+				It("returns an error", func() {
+					fakeFirewall.SetupReturns(errors.New("no chains left"))
+					Expect(creator.Recover(container)).To(MatchError("recover: no chains left"))
+				})
+			})
+		})
+
+		Context("when devices are restricted", func() {
+			var fakeDevices *fakes.FakeDeviceWhitelist
+
+			BeforeEach(func() {
+				fakeDevices = new(fakes.FakeDeviceWhitelist)
+				devices = fakeDevices
+			})
+
+			It("restricts them again in the restarted container", func() {
+				Expect(creator.Recover(container)).To(Succeed())
+				Expect(fakeDevices.ApplyCallCount()).To(Equal(1))
+				Expect(fakeDevices.ApplyArgsForCall(0)).To(Equal("some-docker-id"))
+			})
+
+			Context("when the container is privileged", func() {
+				BeforeEach(func() {
+					dockerRunner.InspectStub = func(dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+						var info dockercli.ContainerJSON
+						info.State.Running = dockerRunner.StartCallCount() > 0
+						info.HostConfig.Privileged = true
+						return info, nil
+					}
+				})
+
+				It("leaves its devices alone", func() {
+					Expect(creator.Recover(container)).To(Succeed())
+					Expect(fakeDevices.ApplyCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when restricting them fails", func() {
+				It("returns an error", func() {
+					fakeDevices.ApplyReturns(errors.New("no devices cgroup"))
+					Expect(creator.Recover(container)).To(MatchError("recover: no devices cgroup"))
+				})
+			})
+		})
+
+		Context("when the docker container is still running", func() {
+			BeforeEach(func() {
+				dockerRunner.InspectStub = nil
+				var info dockercli.ContainerJSON
+				info.State.Running = true
+				dockerRunner.InspectReturns(info, nil)
+			})
+
+			It("does not start it", func() {
+				Expect(creator.Recover(container)).To(Succeed())
+				Expect(dockerRunner.StartCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when initd does not start listening", func() {
+			BeforeEach(func() {
+				initdListener.Close()
+			})
+
+			It("returns an error", func() {
+				Expect(creator.Recover(container)).To(MatchError(ContainSubstring("initd did not start listening")))
+			})
+		})
+
+		Context("when starting the docker container fails", func() {
+			It("returns an error", func() {
+				dockerRunner.StartReturns("", errors.New("boom"))
+				Expect(creator.Recover(container)).To(MatchError("recover: boom"))
+			})
+		})
+	})
+
+	Describe("Owned", func() {
+		BeforeEach(func() {
+			dockerRunner.PsReturns([]dockercli.PsEntry{{ID: "abc"}, {ID: "def"}}, nil)
+		})
+
+		It("lists all containers with the owner label, including stopped ones", func() {
+			owned, err := creator.Owned()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owned).To(ConsistOf("abc", "def"))
+
+			Expect(dockerRunner.PsArgsForCall(0)).To(Equal(dockercli.PsCmd{
+				All:     true,
+				Filters: []string{"label=" + OwnerLabel},
+			}))
+		})
+	})
+
+	Describe("Remove", func() {
+		It("forcibly removes the docker container", func() {
+			Expect(creator.Remove("abc")).To(Succeed())
+			Expect(dockerRunner.RmArgsForCall(0)).To(Equal(dockercli.RmCmd{
+				ContainerID: "abc",
+				Force:       true,
+			}))
+		})
+	})
+
+	Describe("Logs", func() {
+		It("streams the docker container's logs", func() {
+			container := &Container{InfoHandler: &InfoHandler{DockerID: "some-docker-id"}}
+			w := gbytes.NewBuffer()
+			stop := make(chan struct{})
+
+			Expect(creator.Logs(container, true, "10", w, stop)).To(Succeed())
+
+			cmd, stdout, stderr, logsStop := dockerRunner.LogsArgsForCall(0)
+			Expect(cmd).To(Equal(dockercli.LogsCmd{ContainerID: "some-docker-id", Follow: true, Tail: "10"}))
+			Expect(stdout).To(Equal(w))
+			Expect(stderr).To(Equal(w))
+			Expect(logsStop).To(Equal((<-chan struct{})(stop)))
+		})
+	})
+
+	Describe("Destroy", func() {
+		var container *Container
+		var chain *fakes.FakeChain
+
+		BeforeEach(func() {
+			chain = new(fakes.FakeChain)
+			container = &Container{
+				InfoHandler: &InfoHandler{
+					DockerID:      "some-docker-id",
+					ContainerPath: "the-depot-dir",
+				},
+				NetHandler: &NetHandler{
+					Chain:    chain,
+					PortPool: port_pool.New(100, 10),
+				},
+				LimitsHandler: &LimitsHandler{},
+			}
+		})
+
+		It("forcibly removes the docker container", func() {
+			Expect(creator.Destroy(container)).To(Succeed())
+			Expect(dockerRunner.RmCallCount()).To(Equal(1))
+			Expect(dockerRunner.RmArgsForCall(0)).To(Equal(dockercli.RmCmd{
+				ContainerID: "some-docker-id",
+				Force:       true,
+			}))
+		})
+
+		It("removes the container's port mappings", func() {
+			_, _, err := container.NetIn(0, 8080)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(creator.Destroy(container)).To(Succeed())
+			Expect(chain.ForwardCallCount()).To(Equal(2))
+			_, action, _, _, _, _, _ := chain.ForwardArgsForCall(1)
+			Expect(action).To(Equal(iptables.Delete))
+		})
+
+		It("disconnects the container from the network before removing it", func() {
+			fakeNetworker := new(fakes.FakeNetworker)
+			creator.Networker = fakeNetworker
+			fakeNetworker.DownStub = func(NetworkContainer) error {
+				Expect(dockerRunner.RmCallCount()).To(Equal(0))
+				return nil
+			}
+
+			Expect(creator.Destroy(container)).To(Succeed())
+			Expect(fakeNetworker.DownCallCount()).To(Equal(1))
+			Expect(fakeNetworker.DownArgsForCall(0)).To(Equal(NetworkContainer{DockerID: "some-docker-id"}))
+		})
+
+		It("removes the container's egress rules", func() {
+			firewall := new(fakes.FakeFirewall)
+			container.Firewall = firewall
+			container.FirewallID = "some-docker-id"
+			container.NetHandler.ContainerIP = "1.2.3.4"
+
+			Expect(creator.Destroy(container)).To(Succeed())
+			Expect(firewall.TeardownCallCount()).To(Equal(1))
+			id, ip := firewall.TeardownArgsForCall(0)
+			Expect(id).To(Equal("some-docker-id"))
+			Expect(ip).To(Equal("1.2.3.4"))
+		})
+
+		Context("when removing the port mappings fails", func() {
+			It("returns an error and keeps the depot directory", func() {
+				container.NetIn(0, 8080)
+				chain.ForwardReturns(errors.New("boom"))
+
+				Expect(creator.Destroy(container)).To(MatchError("destroy: release port mapping 100 to 8080: boom"))
+				Expect(depot.DestroyCallCount()).To(Equal(0))
+			})
+		})
+
+		It("removes the depot directory", func() {
+			Expect(creator.Destroy(container)).To(Succeed())
+			Expect(depot.DestroyCallCount()).To(Equal(1))
+			Expect(depot.DestroyArgsForCall(0)).To(Equal("the-depot-dir"))
+		})
+
+		Context("when a scrubber is configured", func() {
+			var scrubber *fakes.FakeScrubber
+
+			BeforeEach(func() {
+				scrubber = new(fakes.FakeScrubber)
+				var info dockercli.ContainerJSON
+				info.GraphDriver.Data = map[string]string{"UpperDir": "/var/lib/docker/overlay/some-layer/upper"}
+				dockerRunner.InspectReturns(info, nil)
+			})
+
+			JustBeforeEach(func() {
+				creator.Scrubber = scrubber
+			})
+
+			It("scrubs the writable layer and the depot directory before removing them", func() {
+				Expect(creator.Destroy(container)).To(Succeed())
+
+				Expect(dockerRunner.InspectArgsForCall(0)).To(Equal(dockercli.InspectCmd{
+					ContainerID: "some-docker-id",
+				}))
+
+				Expect(scrubber.ScrubCallCount()).To(Equal(2))
+				Expect(scrubber.ScrubArgsForCall(0)).To(Equal("/var/lib/docker/overlay/some-layer/upper"))
+				Expect(scrubber.ScrubArgsForCall(1)).To(Equal("the-depot-dir"))
+			})
+
+			It("stops the container before scrubbing it", func() {
+				scrubber.ScrubStub = func(string) error {
+					Expect(dockerRunner.StopCallCount()).To(Equal(1))
+					return nil
+				}
+
+				Expect(creator.Destroy(container)).To(Succeed())
+				Expect(dockerRunner.StopArgsForCall(0)).To(Equal(dockercli.StopCmd{
+					ContainerID: "some-docker-id",
+					Timeout:     time.Second,
+				}))
+			})
+
+			Context("when stopping the container fails", func() {
+				BeforeEach(func() {
+					dockerRunner.StopReturns("", errors.New("docker docker docker"))
+				})
+
+				It("neither scrubs nor removes it", func() {
+					Expect(creator.Destroy(container)).To(MatchError("destroy: scrub: stop some-docker-id: docker docker docker"))
+					Expect(scrubber.ScrubCallCount()).To(Equal(0))
+					Expect(dockerRunner.RmCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when scrubbing fails", func() {
+				BeforeEach(func() {
+					scrubber.ScrubReturns(errors.New("disk on fire"))
+				})
+
+				It("does not remove the container", func() {
+					Expect(creator.Destroy(container)).To(MatchError("destroy: scrub: disk on fire"))
+					Expect(dockerRunner.RmCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when removing the docker container fails", func() {
+			BeforeEach(func() {
+				dockerRunner.RmReturns("", errors.New("docker docker docker"))
+			})
+
+			It("returns an error and keeps the depot directory", func() {
+				Expect(creator.Destroy(container)).To(MatchError("destroy: docker docker docker"))
+				Expect(depot.DestroyCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when docker no longer has the container", func() {
+			var noSuchContainer error
+
+			BeforeEach(func() {
+				noSuchContainer = &dockercli.Error{
+					Command: "rm",
+					Reason:  "no_such_container",
+					Message: "exit status 1: Error: No such container: some-docker-id",
+				}
+				dockerRunner.RmReturns("", noSuchContainer)
+			})
+
+			It("still releases the container's resources and then returns the error", func() {
+				_, _, err := container.NetIn(0, 8080)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(creator.Destroy(container)).To(MatchError("destroy: " + noSuchContainer.Error()))
+				Expect(chain.ForwardCallCount()).To(Equal(2))
+				Expect(depot.DestroyCallCount()).To(Equal(1))
+			})
+
+			It("scrubs the depot directory, there being no writable layer left", func() {
+				scrubber := new(fakes.FakeScrubber)
+				creator.Scrubber = scrubber
+				dockerRunner.InspectReturns(dockercli.ContainerJSON{}, noSuchContainer)
+
+				creator.Destroy(container)
+				Expect(scrubber.ScrubCallCount()).To(Equal(1))
+				Expect(scrubber.ScrubArgsForCall(0)).To(Equal("the-depot-dir"))
 			})
 		})
 	})
@@ -0,0 +1,121 @@
+package daemon_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Attach", func() {
+	var (
+		tmpDir    string
+		listener  *daemon.Listener
+		connector *unix_socket.Connector
+		waited    chan *os.ProcessState
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "attach")
+		Expect(err).NotTo(HaveOccurred())
+
+		waited = make(chan *os.ProcessState, 4)
+		socketPath := filepath.Join(tmpDir, "initd.sock")
+		listener = startDaemon(socketPath, waited)
+		connector = &unix_socket.Connector{SocketPath: socketPath}
+	})
+
+	AfterEach(func() {
+		listener.Stop()
+		os.RemoveAll(tmpDir)
+	})
+
+	spawn := func(id uint32, script string, stdin *strings.Reader) {
+		// the client which spawns the process has to read its output, or the
+		// process blocks once the pipe is full
+		pio := &garden.ProcessIO{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+		if stdin != nil {
+			pio.Stdin = stdin
+		}
+
+		_, err := daemon.NewProcess(connector, id, &garden.ProcessSpec{Path: "sh", Args: []string{"-c", script}}, pio)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("replays the process's output and then streams it", func() {
+		spawn(1, "echo before; echo err >&2; read line; echo $line", strings.NewReader("after\n"))
+
+		stdout, stderr := gbytes.NewBuffer(), gbytes.NewBuffer()
+		process, err := daemon.Attach(connector, 1, &garden.ProcessIO{Stdout: stdout, Stderr: stderr})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(process.Wait()).To(Equal(0))
+		Eventually(stdout).Should(gbytes.Say("before\nafter\n"))
+		Eventually(stderr).Should(gbytes.Say("err\n"))
+	})
+
+	Context("when the process has already exited", func() {
+		It("still receives its output and exit status", func() {
+			spawn(1, "echo done; exit 3", nil)
+			Eventually(waited).Should(Receive())
+
+			stdout := gbytes.NewBuffer()
+			process, err := daemon.Attach(connector, 1, &garden.ProcessIO{Stdout: stdout})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(process.Wait()).To(Equal(3))
+			Eventually(stdout).Should(gbytes.Say("done\n"))
+		})
+
+		Context("and more processes than the daemon retains have exited since", func() {
+			It("returns an error", func() {
+				for id := uint32(1); id <= 3; id++ {
+					spawn(id, "true", nil)
+					Eventually(waited).Should(Receive())
+				}
+
+				_, err := daemon.Attach(connector, 1, nil)
+				Expect(err).To(MatchError(ContainSubstring("daemon: no process with id 1")))
+			})
+		})
+	})
+
+	Context("when the process produced more output than is kept", func() {
+		It("replays only the most recent output", func() {
+			spawn(1, "head -c 70000 /dev/zero | tr '\\0' a; echo end", nil)
+			Eventually(waited).Should(Receive())
+
+			stdout := gbytes.NewBuffer()
+			process, err := daemon.Attach(connector, 1, &garden.ProcessIO{Stdout: stdout})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(process.Wait()).To(Equal(0))
+
+			Eventually(func() int { return len(stdout.Contents()) }).Should(Equal(daemon.OutputBufferSize))
+			Expect(string(stdout.Contents())).To(HaveSuffix("aend\n"))
+		})
+	})
+
+	Context("when no process has the id", func() {
+		It("returns an error", func() {
+			_, err := daemon.Attach(connector, 9, nil)
+			Expect(err).To(MatchError(ContainSubstring("daemon: no process with id 9")))
+		})
+	})
+
+	Context("when the id is already in use", func() {
+		It("refuses to spawn another process with it", func() {
+			spawn(1, "true", nil)
+
+			_, err := daemon.NewProcess(connector, 1, &garden.ProcessSpec{Path: "true"}, nil)
+			Expect(err).To(MatchError(ContainSubstring("daemon: process id 1 is in use")))
+		})
+	})
+})
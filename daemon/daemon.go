@@ -0,0 +1,442 @@
+// Package daemon implements the process-spawning side of initd, the pid 1 of
+// every garden-docker container. It speaks the same unix socket protocol as
+// garden-linux's container_daemon, but applies the parts of the ProcessSpec
+// container_daemon ignores.
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon"
+	"github.com/cloudfoundry-incubator/garden-linux/containerizer/system"
+	"github.com/kr/pty"
+)
+
+// OutputBufferSize is how many bytes of each of a process's stdout and stderr
+// are kept, so that a client which attaches late sees its recent output.
+const OutputBufferSize = 64 * 1024
+
+// DefaultRetainExited is how many exited processes are kept for clients to
+// attach to, unless the daemon's RetainExited says otherwise.
+const DefaultRetainExited = 16
+
+type ContainerDaemon struct {
+	Listener container_daemon.Listener
+	Users    system.User
+	Runner   container_daemon.Runner
+
+	// Env is the environment every process starts with, before the
+	// ProcessSpec's Env is applied. initd passes its own environment, which
+	// docker has already built from the image's ENV overridden by the
+	// ContainerSpec's Env.
+	Env []string
+
+	// RetainExited is how many exited processes are kept, so that a client
+	// which lost its connection can still attach to collect the output and
+	// exit status.
+	RetainExited int
+
+	mu        sync.Mutex
+	processes map[uint32]*spawned
+	exited    []uint32
+	running   map[*spawned]bool
+}
+
+// Request is a message sent to the daemon. A request with a Signal sends it
+// to the running process spawned with the same ProcessID, and a request to
+// Attach attaches to that process; a request to Stop stops every running
+// process. Any other request spawns a process from its ProcessSpec. A
+// process spawned with a ProcessID of zero cannot be signalled or attached
+// to.
+type Request struct {
+	garden.ProcessSpec
+
+	ProcessID uint32         `json:"process_id,omitempty"`
+	Signal    syscall.Signal `json:"signal,omitempty"`
+	Attach    bool           `json:"attach,omitempty"`
+
+	Stop        bool          `json:"stop,omitempty"`
+	Kill        bool          `json:"kill,omitempty"`
+	GracePeriod time.Duration `json:"grace_period,omitempty"`
+}
+
+func (cd *ContainerDaemon) Init() error {
+	if err := cd.Listener.Init(); err != nil {
+		return fmt.Errorf("daemon: initializing the listener: %s", err)
+	}
+
+	return nil
+}
+
+func (cd *ContainerDaemon) Run() error {
+	if err := cd.Listener.Listen(cd); err != nil {
+		return fmt.Errorf("daemon: listening for connections: %s", err)
+	}
+
+	return nil
+}
+
+func (cd *ContainerDaemon) Stop() error {
+	if err := cd.Listener.Stop(); err != nil {
+		return fmt.Errorf("daemon: stopping the listener: %s", err)
+	}
+
+	return nil
+}
+
+func (cd *ContainerDaemon) Handle(decoder *json.Decoder) ([]*os.File, error) {
+	var request Request
+	if err := decoder.Decode(&request); err != nil {
+		return nil, fmt.Errorf("daemon: decode failed: %s", err)
+	}
+
+	if request.Signal != 0 {
+		return nil, cd.signal(request.ProcessID, request.Signal)
+	}
+
+	if request.Attach {
+		return cd.attach(request.ProcessID)
+	}
+
+	if request.Stop {
+		cd.stop(request.Kill, request.GracePeriod)
+		return nil, nil
+	}
+
+	if _, ok := cd.lookup(request.ProcessID); ok {
+		return nil, fmt.Errorf("daemon: process id %d is in use", request.ProcessID)
+	}
+
+	spec := request.ProcessSpec
+
+	var uid, gid uint32
+	if user, err := cd.Users.Lookup(spec.User); err == nil && user != nil {
+		fmt.Sscanf(user.Uid, "%d", &uid)
+		fmt.Sscanf(user.Gid, "%d", &gid)
+	} else if err == nil {
+		return nil, fmt.Errorf("daemon: failed to lookup user %s", spec.User)
+	} else {
+		return nil, fmt.Errorf("daemon: lookup user %s: %s", spec.User, err)
+	}
+
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Env = MergeEnv(cd.Env, spec.Env)
+
+	// without a Dir the process starts in initd's own working directory,
+	// which docker sets to the image's WORKDIR
+	cmd.Dir = spec.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid: uid,
+			Gid: gid,
+		},
+	}
+
+	if spec.TTY != nil {
+		return cd.startWithTTY(request.ProcessID, cmd, spec.TTY)
+	}
+
+	return cd.start(request.ProcessID, cmd)
+}
+
+// start runs the process with pipes for its stdin, stdout and stderr. The
+// client writes to the stdin pipe directly, but the daemon reads stdout and
+// stderr itself, keeping the most recent output for clients which attach
+// later, and sends the client its own copy.
+func (cd *ContainerDaemon) start(id uint32, cmd *exec.Cmd) ([]*os.File, error) {
+	// the process's stdin, stdout and stderr, then the client's stdout,
+	// stderr and exit status
+	var pipes [6]struct {
+		r *os.File
+		w *os.File
+	}
+
+	// closePipes closes every pipe end created so far, for the error paths
+	closePipes := func() {
+		for _, p := range pipes {
+			closeAll([]*os.File{p.r, p.w})
+		}
+	}
+
+	for i := range pipes {
+		var err error
+		if pipes[i].r, pipes[i].w, err = os.Pipe(); err != nil {
+			closePipes()
+			return nil, fmt.Errorf("daemon: failed to create pipe: %s", err)
+		}
+	}
+
+	stdin, stdout, stderr := pipes[0], pipes[1], pipes[2]
+	clientStdout, clientStderr, exitStatus := pipes[3], pipes[4], pipes[5]
+
+	cmd.Stdin = stdin.r
+	cmd.Stdout = stdout.w
+	cmd.Stderr = stderr.w
+
+	// the process leads its own process group, so that stopping it stops any
+	// children it has started too
+	cmd.SysProcAttr.Setpgid = true
+
+	if err := cd.Runner.Start(cmd); err != nil {
+		closePipes()
+		return nil, fmt.Errorf("daemon: running command: %s", err)
+	}
+
+	// the process has its own copies of its ends of the pipes
+	closeAll([]*os.File{stdin.r, stdout.w, stderr.w})
+
+	s := newSpawned(cmd.Process, newOutput(OutputBufferSize), newOutput(OutputBufferSize))
+
+	s.stdout.attach(clientStdout.w)
+	s.stderr.attach(clientStderr.w)
+	s.attachExit(exitStatus.w)
+	cd.track(id, s)
+
+	copying := new(sync.WaitGroup)
+	copying.Add(2)
+	go copyOutput(s.stdout, stdout.r, copying)
+	go copyOutput(s.stderr, stderr.r, copying)
+
+	go func() {
+		cd.wait(id, s, cmd, s.stderr)
+
+		// wait for the process's output before ending its streams, as
+		// exec.Cmd does
+		copying.Wait()
+		s.stdout.close()
+		s.stderr.close()
+		s.exit()
+	}()
+
+	return []*os.File{stdin.w, clientStdout.r, clientStderr.r, exitStatus.r}, nil
+}
+
+func copyOutput(o *output, r *os.File, copying *sync.WaitGroup) {
+	defer copying.Done()
+	defer r.Close()
+
+	io.Copy(o, r)
+}
+
+// startWithTTY runs the process in a new session with a pty as its
+// controlling terminal. The pty's master is sent as both the stdin and the
+// stdout stream, so the client can resize the terminal with
+// SetWindowSize; the stderr stream only carries the daemon's own errors,
+// since the process's stderr is the terminal too. The master is the client's
+// alone, so a process with a terminal cannot be attached to.
+func (cd *ContainerDaemon) startWithTTY(id uint32, cmd *exec.Cmd, tty *garden.TTYSpec) ([]*os.File, error) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("daemon: open pty: %s", err)
+	}
+
+	if tty.WindowSize != nil {
+		if err := SetWindowSize(master, tty.WindowSize.Columns, tty.WindowSize.Rows); err != nil {
+			closeAll([]*os.File{master, slave})
+			return nil, fmt.Errorf("daemon: set window size: %s", err)
+		}
+	}
+
+	var pipes [2]struct {
+		r *os.File
+		w *os.File
+	}
+
+	closeFiles := func() {
+		closeAll([]*os.File{master, slave})
+		for _, p := range pipes {
+			closeAll([]*os.File{p.r, p.w})
+		}
+	}
+
+	// Create two pipes for the daemon's errors and the exit status.
+	for i := 0; i < 2; i++ {
+		if pipes[i].r, pipes[i].w, err = os.Pipe(); err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("daemon: failed to create pipe: %s", err)
+		}
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+
+	if err := cd.Runner.Start(cmd); err != nil {
+		closeFiles()
+		return nil, fmt.Errorf("daemon: running command: %s", err)
+	}
+
+	slave.Close()
+
+	s := newSpawned(cmd.Process, nil, nil)
+	s.attachExit(pipes[1].w)
+	cd.track(id, s)
+
+	go func() {
+		defer pipes[0].w.Close()
+
+		cd.wait(id, s, cmd, pipes[0].w)
+		s.exit()
+	}()
+
+	return []*os.File{master, master, pipes[0].r, pipes[1].r}, nil
+}
+
+// wait waits for the process to exit and records its exit status, reporting
+// any error waiting for it to errWriter. The process is kept for clients to
+// attach to until RetainExited later processes have exited.
+func (cd *ContainerDaemon) wait(id uint32, s *spawned, cmd *exec.Cmd, errWriter io.Writer) {
+	exitStatus, err := cd.Runner.Wait(cmd)
+	if err != nil {
+		exitStatus = container_daemon.UnknownExitStatus
+		fmt.Fprintf(errWriter, "daemon: wait failed: %s", err)
+	}
+
+	s.setExitStatus(exitStatus)
+	cd.retire(id, s)
+}
+
+// attach sends a client new streams for a process, replaying its recent
+// output. The client cannot write to the process's stdin, which belongs to
+// the client that spawned it.
+func (cd *ContainerDaemon) attach(id uint32) ([]*os.File, error) {
+	s, ok := cd.lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("daemon: no process with id %d", id)
+	}
+
+	if s.stdout == nil {
+		return nil, fmt.Errorf("daemon: process %d has a terminal, so cannot be attached to", id)
+	}
+
+	stdin, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("daemon: open %s: %s", os.DevNull, err)
+	}
+
+	// the client's stdout, stderr and exit status
+	var pipes [3]struct {
+		r *os.File
+		w *os.File
+	}
+
+	for i := range pipes {
+		if pipes[i].r, pipes[i].w, err = os.Pipe(); err != nil {
+			closeAll([]*os.File{stdin})
+			for _, p := range pipes {
+				closeAll([]*os.File{p.r, p.w})
+			}
+
+			return nil, fmt.Errorf("daemon: failed to create pipe: %s", err)
+		}
+	}
+
+	s.stdout.attach(pipes[0].w)
+	s.stderr.attach(pipes[1].w)
+	s.attachExit(pipes[2].w)
+
+	return []*os.File{stdin, pipes[0].r, pipes[1].r, pipes[2].r}, nil
+}
+
+// track remembers a running process so that it can be stopped and, if it has
+// an id, signalled and attached to.
+func (cd *ContainerDaemon) track(id uint32, s *spawned) {
+	if s.process == nil {
+		return
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if cd.running == nil {
+		cd.running = make(map[*spawned]bool)
+	}
+
+	cd.running[s] = true
+
+	if id == 0 {
+		return
+	}
+
+	if cd.processes == nil {
+		cd.processes = make(map[uint32]*spawned)
+	}
+
+	cd.processes[id] = s
+}
+
+// retire records that the process with the given id has exited, forgetting
+// the oldest exited processes beyond RetainExited.
+func (cd *ContainerDaemon) retire(id uint32, s *spawned) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	delete(cd.running, s)
+
+	if id == 0 {
+		return
+	}
+
+	cd.exited = append(cd.exited, id)
+
+	retain := cd.RetainExited
+	if retain == 0 {
+		retain = DefaultRetainExited
+	}
+
+	for len(cd.exited) > retain {
+		delete(cd.processes, cd.exited[0])
+		cd.exited = cd.exited[1:]
+	}
+}
+
+func (cd *ContainerDaemon) lookup(id uint32) (*spawned, bool) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	s, ok := cd.processes[id]
+	return s, ok
+}
+
+func (cd *ContainerDaemon) signal(id uint32, signal syscall.Signal) error {
+	s, ok := cd.lookup(id)
+	if !ok || s.hasExited() {
+		return fmt.Errorf("daemon: no running process with id %d", id)
+	}
+
+	if err := s.signal(signal); err != nil {
+		return fmt.Errorf("daemon: signal process %d: %s", id, err)
+	}
+
+	return nil
+}
+
+// MergeEnv returns base with each KEY=VALUE in overrides applied on top, so
+// that a variable set in overrides replaces any variable of the same name in
+// base. The order of first appearance is kept.
+func MergeEnv(base, overrides []string) []string {
+	merged := []string{}
+	index := make(map[string]int)
+
+	for _, env := range append(append([]string{}, base...), overrides...) {
+		key := strings.SplitN(env, "=", 2)[0]
+		if i, ok := index[key]; ok {
+			merged[i] = env
+			continue
+		}
+
+		index[key] = len(merged)
+		merged = append(merged, env)
+	}
+
+	return merged
+}
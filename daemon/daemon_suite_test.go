@@ -0,0 +1,50 @@
+package daemon_test
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/fake_runner"
+	"github.com/cloudfoundry-incubator/garden-linux/containerizer/system/fake_user"
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDaemon(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Daemon Suite")
+}
+
+// startDaemon runs a daemon listening on socketPath which really spawns
+// processes, as the current user, and sends the state of each process it
+// waits for to waited.
+func startDaemon(socketPath string, waited chan<- *os.ProcessState) *daemon.Listener {
+	current, err := user.Current()
+	Expect(err).NotTo(HaveOccurred())
+
+	users := new(fake_user.FakeUser)
+	users.LookupReturns(current, nil)
+
+	runner := new(fake_runner.FakeRunner)
+	runner.StartStub = func(cmd *exec.Cmd) error {
+		return cmd.Start()
+	}
+	runner.WaitStub = func(cmd *exec.Cmd) (byte, error) {
+		cmd.Wait()
+		waited <- cmd.ProcessState
+		return byte(cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()), nil
+	}
+
+	listener := &daemon.Listener{SocketPath: socketPath}
+	cd := &daemon.ContainerDaemon{Listener: listener, Users: users, Runner: runner, RetainExited: 2}
+
+	Expect(cd.Init()).To(Succeed())
+	go cd.Run()
+
+	return listener
+}
@@ -0,0 +1,255 @@
+package daemon_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/fake_listener"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/fake_runner"
+	"github.com/cloudfoundry-incubator/garden-linux/containerizer/system/fake_user"
+	"github.com/julz/garden-docker/daemon"
+	"github.com/kr/pty"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ContainerDaemon", func() {
+	var (
+		cd             *daemon.ContainerDaemon
+		runner         *fake_runner.FakeRunner
+		users          *fake_user.FakeUser
+		exitStatusChan chan byte
+
+		spec garden.ProcessSpec
+	)
+
+	BeforeEach(func() {
+		runner = new(fake_runner.FakeRunner)
+		users = new(fake_user.FakeUser)
+		exitStatusChan = make(chan byte, 1)
+
+		users.LookupReturns(&user.User{Uid: "66", Gid: "99"}, nil)
+		runner.WaitStub = func(cmd *exec.Cmd) (byte, error) {
+			return <-exitStatusChan, nil
+		}
+
+		cd = &daemon.ContainerDaemon{
+			Listener: new(fake_listener.FakeListener),
+			Users:    users,
+			Runner:   runner,
+			Env:      []string{"PATH=/image/bin", "FROM_IMAGE=1", "OVERRIDDEN=container"},
+		}
+
+		spec = garden.ProcessSpec{
+			Path: "fishfinger",
+			Args: []string{"foo", "bar"},
+			User: "a-user",
+		}
+	})
+
+	AfterEach(func() {
+		exitStatusChan <- 0
+	})
+
+	handle := func() ([]*os.File, error) {
+		b, err := json.Marshal(spec)
+		Expect(err).NotTo(HaveOccurred())
+
+		return cd.Handle(json.NewDecoder(bytes.NewReader(b)))
+	}
+
+	Describe("Handle", func() {
+		It("spawns the process as the requested user", func() {
+			_, err := handle()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.StartCallCount()).To(Equal(1))
+			cmd := runner.StartArgsForCall(0)
+			Expect(cmd.Args).To(Equal([]string{"fishfinger", "foo", "bar"}))
+			Expect(cmd.SysProcAttr.Credential.Uid).To(Equal(uint32(66)))
+			Expect(cmd.SysProcAttr.Credential.Gid).To(Equal(uint32(99)))
+		})
+
+		It("starts the process with the daemon's environment", func() {
+			_, err := handle()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.StartArgsForCall(0).Env).To(Equal([]string{
+				"PATH=/image/bin", "FROM_IMAGE=1", "OVERRIDDEN=container",
+			}))
+		})
+
+		Context("when the process spec has an environment", func() {
+			BeforeEach(func() {
+				spec.Env = []string{"OVERRIDDEN=process", "FROM_PROCESS=1"}
+			})
+
+			It("takes precedence over the daemon's environment", func() {
+				_, err := handle()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(runner.StartArgsForCall(0).Env).To(Equal([]string{
+					"PATH=/image/bin", "FROM_IMAGE=1", "OVERRIDDEN=process", "FROM_PROCESS=1",
+				}))
+			})
+		})
+
+		It("starts the process in the requested working directory", func() {
+			spec.Dir = "/some/dir"
+
+			_, err := handle()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.StartArgsForCall(0).Dir).To(Equal("/some/dir"))
+		})
+
+		Context("when the process spec has no working directory", func() {
+			It("starts the process in the daemon's working directory", func() {
+				_, err := handle()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(runner.StartArgsForCall(0).Dir).To(BeEmpty())
+			})
+		})
+
+		It("returns the exit status in the fourth stream", func() {
+			fds, err := handle()
+			Expect(err).NotTo(HaveOccurred())
+
+			exitStatusChan <- 42
+			b := make([]byte, 1)
+			fds[3].Read(b)
+			Expect(b).To(Equal([]byte{42}))
+		})
+
+		Context("when the process spec asks for a TTY", func() {
+			var rows, cols int
+			var slaveName string
+
+			BeforeEach(func() {
+				spec.TTY = &garden.TTYSpec{WindowSize: &garden.WindowSize{Columns: 120, Rows: 40}}
+
+				runner.StartStub = func(cmd *exec.Cmd) error {
+					slave := cmd.Stdin.(*os.File)
+					slaveName = slave.Name()
+					rows, cols, _ = pty.Getsize(slave)
+					return nil
+				}
+			})
+
+			It("runs the process in a new session with a terminal of the requested size", func() {
+				fds, err := handle()
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFiles(fds)
+
+				cmd := runner.StartArgsForCall(0)
+				Expect(cmd.Stdout).To(Equal(cmd.Stdin))
+				Expect(cmd.Stderr).To(Equal(cmd.Stdin))
+				Expect(cmd.SysProcAttr.Setsid).To(BeTrue())
+				Expect(cmd.SysProcAttr.Setctty).To(BeTrue())
+
+				Expect(slaveName).To(HavePrefix("/dev/pts/"))
+				Expect(cols).To(Equal(120))
+				Expect(rows).To(Equal(40))
+			})
+
+			It("sends the terminal's master as stdin and stdout, so it can be resized", func() {
+				fds, err := handle()
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFiles(fds)
+
+				Expect(fds).To(HaveLen(4))
+				Expect(fds[1]).To(Equal(fds[0]))
+
+				Expect(daemon.SetWindowSize(fds[1], 80, 24)).To(Succeed())
+				rows, cols, err := pty.Getsize(fds[1])
+				Expect(err).NotTo(HaveOccurred())
+				Expect([]int{cols, rows}).To(Equal([]int{80, 24}))
+			})
+
+			It("returns the exit status in the fourth stream", func() {
+				fds, err := handle()
+				Expect(err).NotTo(HaveOccurred())
+				defer closeFiles(fds)
+
+				exitStatusChan <- 7
+				b := make([]byte, 1)
+				fds[3].Read(b)
+				Expect(b).To(Equal([]byte{7}))
+			})
+
+			Context("when starting the process fails", func() {
+				It("closes the terminal and every pipe it created", func() {
+					runner.StartStub = nil
+					runner.StartReturns(errors.New("boom"))
+
+					before := openFDs()
+					_, err := handle()
+					Expect(err).To(MatchError("daemon: running command: boom"))
+					Expect(openFDs()).To(Equal(before))
+				})
+			})
+		})
+
+		Context("when the user does not exist", func() {
+			It("returns an error", func() {
+				users.LookupReturns(nil, nil)
+
+				_, err := handle()
+				Expect(err).To(MatchError("daemon: failed to lookup user a-user"))
+			})
+		})
+
+		Context("when starting the process fails", func() {
+			It("returns an error", func() {
+				runner.StartReturns(errors.New("boom"))
+
+				_, err := handle()
+				Expect(err).To(MatchError("daemon: running command: boom"))
+			})
+
+			It("closes every pipe it created", func() {
+				runner.StartReturns(errors.New("boom"))
+
+				before := openFDs()
+				handle()
+				Expect(openFDs()).To(Equal(before))
+			})
+		})
+	})
+
+	Describe("MergeEnv", func() {
+		It("overrides variables of the same name, keeping their position", func() {
+			Expect(daemon.MergeEnv(
+				[]string{"A=1", "B=2", "C=3"},
+				[]string{"B=two", "D=4"},
+			)).To(Equal([]string{"A=1", "B=two", "C=3", "D=4"}))
+		})
+
+		It("handles variables with no value", func() {
+			Expect(daemon.MergeEnv([]string{"A"}, []string{"A=1"})).To(Equal([]string{"A=1"}))
+		})
+
+		It("returns an empty environment when given nothing", func() {
+			Expect(daemon.MergeEnv(nil, nil)).To(BeEmpty())
+		})
+	})
+})
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+func openFDs() int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	Expect(err).NotTo(HaveOccurred())
+	return len(fds)
+}
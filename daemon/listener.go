@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+)
+
+// Listener accepts connections on a unix socket and sends each connection
+// the files returned by the ConnectionHandler, in the same way as
+// garden-linux's unix_socket.Listener. Unlike that listener it closes its
+// copies of the files once they have been sent (or failed to be), so that
+// initd does not leak four descriptors for every process it spawns. A handler
+// which succeeds without returning any files, as when it signals a process,
+// just has the connection closed.
+type Listener struct {
+	SocketPath string
+
+	// Peer, if set, is who connections are accepted from; any other peer
+	// is sent an error and disconnected before the handler sees anything.
+	Peer *PeerCredentials
+
+	mu       sync.RWMutex
+	running  bool
+	listener net.Listener
+}
+
+func (l *Listener) Init() error {
+	var err error
+	if l.listener, err = net.Listen("unix", l.SocketPath); err != nil {
+		return fmt.Errorf("daemon: error creating socket: %s", err)
+	}
+
+	return nil
+}
+
+func (l *Listener) Listen(ch unix_socket.ConnectionHandler) error {
+	if l.listener == nil {
+		return errors.New("daemon: listener is not initialized")
+	}
+
+	l.setRunning(true)
+
+	for {
+		conn, err := l.listener.Accept()
+		if !l.isRunning() {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("daemon: failure while accepting: %s", err)
+		}
+
+		go l.handle(conn.(*net.UnixConn), ch)
+	}
+}
+
+func (l *Listener) Stop() error {
+	l.setRunning(false)
+	return l.listener.Close()
+}
+
+func (l *Listener) handle(conn *net.UnixConn, ch unix_socket.ConnectionHandler) {
+	defer conn.Close()
+
+	if l.Peer != nil {
+		if err := l.Peer.Check(conn); err != nil {
+			conn.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	files, err := ch.Handle(json.NewDecoder(conn))
+	if err != nil {
+		conn.Write([]byte(err.Error()))
+		return
+	}
+
+	defer closeAll(files)
+
+	if len(files) == 0 {
+		return
+	}
+
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+
+	if _, _, err := conn.WriteMsgUnix([]byte{}, syscall.UnixRights(fds...), nil); err != nil {
+		conn.Write([]byte(err.Error()))
+	}
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+func (l *Listener) setRunning(running bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running = running
+}
+
+func (l *Listener) isRunning() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.running
+}
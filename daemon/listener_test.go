@@ -0,0 +1,179 @@
+package daemon_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket/fake_connection_handler"
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	var (
+		tmpDir    string
+		listener  *daemon.Listener
+		connector *unix_socket.Connector
+		handler   *fake_connection_handler.FakeConnectionHandler
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "listener")
+		Expect(err).NotTo(HaveOccurred())
+
+		socketPath := filepath.Join(tmpDir, "initd.sock")
+		listener = &daemon.Listener{SocketPath: socketPath}
+		connector = &unix_socket.Connector{SocketPath: socketPath}
+		handler = new(fake_connection_handler.FakeConnectionHandler)
+
+		Expect(listener.Init()).To(Succeed())
+		go listener.Listen(handler)
+	})
+
+	AfterEach(func() {
+		listener.Stop()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("sends the handler's files to the client", func() {
+		r, w, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		handler.HandleStub = func(*json.Decoder) ([]*os.File, error) {
+			return []*os.File{w}, nil
+		}
+
+		files, err := connector.Connect("hello")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+
+		files[0].Write([]byte("hi"))
+		files[0].Close()
+
+		b := make([]byte, 2)
+		_, err = r.Read(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal("hi"))
+	})
+
+	It("closes its copies of the files once they are sent", func() {
+		r, w, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		handler.HandleStub = func(*json.Decoder) ([]*os.File, error) {
+			return []*os.File{w}, nil
+		}
+
+		files, err := connector.Connect("hello")
+		Expect(err).NotTo(HaveOccurred())
+		files[0].Close()
+
+		// the write end is only closed everywhere if the listener closed
+		// its copy, in which case the reader sees EOF
+		eof := make(chan struct{})
+		go func() {
+			ioutil.ReadAll(r)
+			close(eof)
+		}()
+
+		Eventually(eof).Should(BeClosed())
+	})
+
+	It("sends the handler's error to the client", func() {
+		handler.HandleReturns(nil, errors.New("boom"))
+
+		_, err := connector.Connect("hello")
+		Expect(err).To(MatchError("boom"))
+	})
+
+	Context("with peer credentials", func() {
+		BeforeEach(func() {
+			listener.Stop()
+
+			socketPath := filepath.Join(tmpDir, "peer.sock")
+			listener = &daemon.Listener{SocketPath: socketPath, Peer: &daemon.PeerCredentials{UID: os.Getuid()}}
+			connector = &unix_socket.Connector{SocketPath: socketPath}
+
+			Expect(listener.Init()).To(Succeed())
+			go listener.Listen(handler)
+		})
+
+		It("serves a peer with the uid", func() {
+			r, w, err := os.Pipe()
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+
+			handler.HandleReturns([]*os.File{w}, nil)
+
+			files, err := connector.Connect("hello")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			files[0].Close()
+		})
+
+		Context("when the peer has another uid", func() {
+			BeforeEach(func() {
+				listener.Peer.UID = os.Getuid() + 1
+			})
+
+			It("refuses it before the handler sees anything", func() {
+				_, err := connector.Connect("hello")
+				Expect(err).To(MatchError(ContainSubstring("permission denied: peer uid")))
+				Expect(handler.HandleCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when peers must be outside the pid namespace", func() {
+			BeforeEach(func() {
+				listener.Peer.OutsidePIDNamespace = true
+			})
+
+			It("refuses a peer in it", func() {
+				_, err := connector.Connect("hello")
+				Expect(err).To(MatchError(ContainSubstring("is in the container")))
+				Expect(handler.HandleCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
+
+var _ = Describe("MapUID", func() {
+	var uidMap string
+
+	BeforeEach(func() {
+		f, err := ioutil.TempFile("", "uid_map")
+		Expect(err).NotTo(HaveOccurred())
+		f.WriteString("         0     100000      65536\n     65536     300000         10\n")
+		f.Close()
+		uidMap = f.Name()
+	})
+
+	AfterEach(func() {
+		os.Remove(uidMap)
+	})
+
+	It("maps a uid in a range to the inside of the namespace", func() {
+		Expect(daemon.MapUID(uidMap, 100000)).To(Equal(0))
+		Expect(daemon.MapUID(uidMap, 100999)).To(Equal(999))
+		Expect(daemon.MapUID(uidMap, 300001)).To(Equal(65537))
+	})
+
+	It("maps an unmapped uid to the overflow uid", func() {
+		uid, err := daemon.MapUID(uidMap, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uid).To(BeNumerically(">", 0))
+	})
+
+	It("fails without a uid map", func() {
+		_, err := daemon.MapUID("/no/such/uid_map", 0)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PeerCredentials restricts who may connect to the Listener's socket, by the
+// SO_PEERCRED credentials the kernel gives for each connection. Without it,
+// anything which can reach the socket, including every process in the
+// container, could have initd spawn processes as any user.
+type PeerCredentials struct {
+	// UID is the only user, as seen from initd's user namespace, which may
+	// connect.
+	UID int
+
+	// OutsidePIDNamespace also requires peers to be outside initd's pid
+	// namespace, as garden-docker is, so that processes in the container
+	// which run as UID (e.g. as root) are refused too. The kernel gives such
+	// peers a pid of 0.
+	OutsidePIDNamespace bool
+}
+
+// Check returns an error if the peer of conn may not use the socket.
+func (p *PeerCredentials) Check(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("daemon: peer credentials: %s", err)
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return fmt.Errorf("daemon: peer credentials: %s", err)
+	}
+
+	if credErr != nil {
+		return fmt.Errorf("daemon: peer credentials: %s", credErr)
+	}
+
+	if int(cred.Uid) != p.UID {
+		return fmt.Errorf("daemon: permission denied: peer uid %d is not %d", cred.Uid, p.UID)
+	}
+
+	if p.OutsidePIDNamespace && cred.Pid != 0 {
+		return fmt.Errorf("daemon: permission denied: peer pid %d is in the container", cred.Pid)
+	}
+
+	return nil
+}
+
+// MapUID returns the uid a user with the given uid outside initd's user
+// namespace has inside it, according to the uid map (usually
+// /proc/self/uid_map), or the kernel's overflow uid if it is not mapped, as
+// it is not when the container is in a remapped user namespace and the user
+// is host root.
+func MapUID(uidMapPath string, outsideUID int) (int, error) {
+	f, err := os.Open(uidMapPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// inside outside count
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		inside, err1 := strconv.Atoi(fields[0])
+		outside, err2 := strconv.Atoi(fields[1])
+		count, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return 0, fmt.Errorf("invalid uid map line %q", scanner.Text())
+		}
+
+		if outsideUID >= outside && outsideUID < outside+count {
+			return inside + outsideUID - outside, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return overflowUID(), nil
+}
+
+// overflowUID is the uid unmapped users appear as, usually 65534.
+func overflowUID() int {
+	contents, err := ioutil.ReadFile("/proc/sys/kernel/overflowuid")
+	if err != nil {
+		return 65534
+	}
+
+	uid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 65534
+	}
+
+	return uid
+}
@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon"
+)
+
+// Process is the client side of a process spawned by the daemon. It is
+// garden-linux's container_daemon.Process, except that once the client's
+// stdin reaches EOF it closes the process's stdin pipe (and only that), so
+// that programs which read until EOF, like cat, terminate.
+//
+// A process spawned with a TTY has a terminal, which SetWindowSize resizes.
+type Process struct {
+	exitStatus <-chan int
+	terminal   *os.File
+}
+
+var ErrNoTerminal = errors.New("daemon: process has no terminal")
+
+// NewProcess spawns a process from spec, naming it id so that it can be
+// signalled with a Signaller and attached to with Attach. An id of zero
+// leaves the process unnamed.
+func NewProcess(connector container_daemon.Connector, id uint32, spec *garden.ProcessSpec, pio *garden.ProcessIO) (*Process, error) {
+	fds, err := connector.Connect(Request{ProcessSpec: *spec, ProcessID: id})
+	if err != nil {
+		return nil, fmt.Errorf("daemon: connect to socket: %s", err)
+	}
+
+	return newProcess(fds, spec.TTY != nil, pio)
+}
+
+// Attach attaches to the process the daemon spawned with the given id, which
+// may already have exited. The process's recent output is replayed to pio
+// before anything it writes from now on, but pio's Stdin is ignored: only the
+// client which spawned the process writes to its stdin.
+func Attach(connector container_daemon.Connector, id uint32, pio *garden.ProcessIO) (*Process, error) {
+	fds, err := connector.Connect(Request{ProcessID: id, Attach: true})
+	if err != nil {
+		return nil, fmt.Errorf("daemon: connect to socket: %s", err)
+	}
+
+	if pio != nil {
+		pio = &garden.ProcessIO{Stdout: pio.Stdout, Stderr: pio.Stderr}
+	}
+
+	return newProcess(fds, false, pio)
+}
+
+func newProcess(fds []io.ReadWriteCloser, tty bool, pio *garden.ProcessIO) (*Process, error) {
+	if len(fds) != 4 {
+		closeAllFDs(fds)
+		return nil, fmt.Errorf("daemon: expected 4 file descriptors, got %d", len(fds))
+	}
+
+	if pio == nil {
+		pio = &garden.ProcessIO{}
+	}
+
+	go func() {
+		if pio.Stdin != nil {
+			io.Copy(fds[0], pio.Stdin) // Ignore error
+		}
+
+		fds[0].Close()
+	}()
+
+	if pio.Stdout != nil {
+		go io.Copy(pio.Stdout, fds[1]) // Ignore error
+	}
+
+	if pio.Stderr != nil {
+		go io.Copy(pio.Stderr, fds[2]) // Ignore error
+	}
+
+	exitStatus := make(chan int, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := fds[3].Read(b); err != nil {
+			b[0] = container_daemon.UnknownExitStatus
+
+			if pio.Stderr != nil {
+				fmt.Fprintf(pio.Stderr, "daemon: failed to read exit status: %s", err) // Ignore error
+			}
+		}
+
+		exitStatus <- int(b[0])
+	}()
+
+	process := &Process{exitStatus: exitStatus}
+	if tty {
+		// the daemon sends the terminal's master as the stdout stream
+		process.terminal, _ = fds[1].(*os.File)
+	}
+
+	return process, nil
+}
+
+// SetWindowSize resizes the process's terminal.
+func (p *Process) SetWindowSize(columns, rows int) error {
+	if p.terminal == nil {
+		return ErrNoTerminal
+	}
+
+	return SetWindowSize(p.terminal, columns, rows)
+}
+
+func (p *Process) Wait() (int, error) {
+	return <-p.exitStatus, nil
+}
+
+func closeAllFDs(fds []io.ReadWriteCloser) {
+	for _, fd := range fds {
+		fd.Close()
+	}
+}
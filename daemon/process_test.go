@@ -0,0 +1,150 @@
+package daemon_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/fake_connector"
+	"github.com/julz/garden-docker/daemon"
+	"github.com/kr/pty"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Process", func() {
+	var (
+		connector *fake_connector.FakeConnector
+
+		// the daemon's ends of the stdin, stdout, stderr and exit status pipes
+		stdin, stdout, stderr, exitStatus *os.File
+
+		// the client's ends of the stderr and exit status pipes
+		stderrR, exitStatusR *os.File
+	)
+
+	BeforeEach(func() {
+		connector = new(fake_connector.FakeConnector)
+
+		var fds [4]io.ReadWriteCloser
+		var err error
+
+		var stdinW, stdoutR *os.File
+		stdin, stdinW, err = os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		stdoutR, stdout, err = os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		stderrR, stderr, err = os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		exitStatusR, exitStatus, err = os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+
+		fds[0], fds[1], fds[2], fds[3] = stdinW, stdoutR, stderrR, exitStatusR
+		connector.ConnectReturns(fds[:], nil)
+	})
+
+	AfterEach(func() {
+		for _, f := range []*os.File{stdin, stdout, stderr, exitStatus} {
+			f.Close()
+		}
+	})
+
+	It("sends the spec and the process's id to the daemon", func() {
+		spec := &garden.ProcessSpec{Path: "cat"}
+		_, err := daemon.NewProcess(connector, 7, spec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(connector.ConnectArgsForCall(0)).To(Equal(daemon.Request{
+			ProcessSpec: garden.ProcessSpec{Path: "cat"},
+			ProcessID:   7,
+		}))
+	})
+
+	It("closes the process's stdin once the client's stdin reaches EOF", func() {
+		_, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, &garden.ProcessIO{
+			Stdin: strings.NewReader("some input"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.ReadAll(stdin)).To(Equal([]byte("some input")))
+	})
+
+	It("keeps streaming stdout and stderr after stdin is closed", func() {
+		out, errOut := gbytes.NewBuffer(), gbytes.NewBuffer()
+		_, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, &garden.ProcessIO{
+			Stdin:  strings.NewReader(""),
+			Stdout: out,
+			Stderr: errOut,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.ReadAll(stdin)).To(BeEmpty())
+
+		stdout.Write([]byte("still here"))
+		stderr.Write([]byte("and here"))
+		Eventually(out).Should(gbytes.Say("still here"))
+		Eventually(errOut).Should(gbytes.Say("and here"))
+	})
+
+	Context("when the client has no stdin", func() {
+		It("closes the process's stdin straight away", func() {
+			_, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, &garden.ProcessIO{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.ReadAll(stdin)).To(BeEmpty())
+		})
+	})
+
+	It("returns the exit status written by the daemon", func() {
+		process, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		exitStatus.Write([]byte{42})
+		Expect(process.Wait()).To(Equal(42))
+	})
+
+	Describe("SetWindowSize", func() {
+		It("fails for a process without a TTY", func() {
+			process, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(process.SetWindowSize(80, 24)).To(Equal(daemon.ErrNoTerminal))
+		})
+
+		It("resizes the terminal sent as the stdout stream of a TTY process", func() {
+			master, slave, err := pty.Open()
+			Expect(err).NotTo(HaveOccurred())
+			defer slave.Close()
+
+			// the daemon's master arrives as two separate descriptors
+			dup, err := syscall.Dup(int(master.Fd()))
+			Expect(err).NotTo(HaveOccurred())
+			stdoutMaster := os.NewFile(uintptr(dup), "master")
+			defer stdoutMaster.Close()
+
+			connector.ConnectReturns([]io.ReadWriteCloser{master, stdoutMaster, stderrR, exitStatusR}, nil)
+
+			process, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{TTY: &garden.TTYSpec{}}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(process.SetWindowSize(100, 30)).To(Succeed())
+			rows, cols, err := pty.Getsize(slave)
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]int{cols, rows}).To(Equal([]int{100, 30}))
+		})
+	})
+
+	Context("when connecting fails", func() {
+		It("returns an error", func() {
+			connector.ConnectReturns(nil, errors.New("boom"))
+
+			_, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{}, nil)
+			Expect(err).To(MatchError("daemon: connect to socket: boom"))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Reaper starts processes and waits for them as pid 1 has to. Whenever
+// SIGCHLD arrives it reaps every child which has exited, not just the
+// processes it started, so that orphans reparented to initd (for instance
+// by a process which double-forks) do not accumulate as zombies. It replaces
+// garden-linux's system.ProcessReaper, which reaps only one child per
+// SIGCHLD, though several children exiting at once are signalled only once.
+type Reaper struct {
+	sigChld chan os.Signal
+
+	mu      sync.Mutex
+	waiting map[int]chan syscall.WaitStatus
+}
+
+func StartReaper() *Reaper {
+	r := &Reaper{
+		sigChld: make(chan os.Signal, 1),
+		waiting: make(map[int]chan syscall.WaitStatus),
+	}
+
+	signal.Notify(r.sigChld, syscall.SIGCHLD)
+	go r.reapAll()
+
+	return r
+}
+
+// Stop stops reaping.
+func (r *Reaper) Stop() {
+	signal.Stop(r.sigChld)
+	close(r.sigChld)
+}
+
+func (r *Reaper) reapAll() {
+	// children may have exited before SIGCHLD was being listened for
+	r.reap()
+
+	for range r.sigChld {
+		r.reap()
+	}
+}
+
+// reap reaps every child which has exited, passing on the status of those
+// the Reaper started.
+func (r *Reaper) reap() {
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil || pid <= 0 {
+			return
+		}
+
+		r.mu.Lock()
+		if ch, ok := r.waiting[pid]; ok {
+			ch <- status
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Start starts cmd, to be waited for with Wait rather than cmd.Wait.
+func (r *Reaper) Start(cmd *exec.Cmd) error {
+	// hold the lock until the process is registered, so that it cannot be
+	// reaped before anyone is waiting for its status
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	r.waiting[cmd.Process.Pid] = make(chan syscall.WaitStatus, 1)
+	return nil
+}
+
+// Wait waits for a process started with Start to exit. A process killed by a
+// signal exits with 128 plus the signal number, as in a shell.
+func (r *Reaper) Wait(cmd *exec.Cmd) (byte, error) {
+	r.mu.Lock()
+	ch, ok := r.waiting[cmd.Process.Pid]
+	r.mu.Unlock()
+
+	if !ok {
+		return 0, fmt.Errorf("daemon: process %d was not started by the reaper", cmd.Process.Pid)
+	}
+
+	status := <-ch
+
+	r.mu.Lock()
+	delete(r.waiting, cmd.Process.Pid)
+	r.mu.Unlock()
+
+	if status.Signaled() {
+		return byte(128 + int(status.Signal())), nil
+	}
+
+	return byte(status.ExitStatus()), nil
+}
@@ -0,0 +1,121 @@
+package daemon_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const prSetChildSubreaper = 36
+
+var _ = Describe("Reaper", func() {
+	var reaper *daemon.Reaper
+
+	BeforeEach(func() {
+		// orphans are reparented to a subreaper as they would be to pid 1, so
+		// the test process can stand in for initd
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+		Expect(errno).To(BeZero())
+
+		reaper = daemon.StartReaper()
+	})
+
+	AfterEach(func() {
+		reaper.Stop()
+		syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 0, 0)
+	})
+
+	run := func(script string) (*exec.Cmd, *bytes.Buffer) {
+		stdout := new(bytes.Buffer)
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stdout = stdout
+		Expect(reaper.Start(cmd)).To(Succeed())
+
+		return cmd, stdout
+	}
+
+	It("reports the exit status of the processes it started", func() {
+		cmd, _ := run("exit 3")
+		Expect(reaper.Wait(cmd)).To(BeEquivalentTo(3))
+	})
+
+	Context("when a process is killed by a signal", func() {
+		It("reports 128 plus the signal number", func() {
+			cmd, _ := run("kill -9 $$")
+			Expect(reaper.Wait(cmd)).To(BeEquivalentTo(128 + 9))
+		})
+	})
+
+	Context("when a process has exited before it is waited for", func() {
+		It("still reports its exit status", func() {
+			cmd, _ := run("exit 4")
+			Eventually(func() bool { return exists(cmd.Process.Pid) }).Should(BeFalse())
+
+			Expect(reaper.Wait(cmd)).To(BeEquivalentTo(4))
+		})
+	})
+
+	Context("when many processes exit at once", func() {
+		It("reports every exit status", func() {
+			var cmds []*exec.Cmd
+			for i := 0; i < 20; i++ {
+				cmd, _ := run("true")
+				cmds = append(cmds, cmd)
+			}
+
+			for _, cmd := range cmds {
+				Expect(reaper.Wait(cmd)).To(BeEquivalentTo(0))
+			}
+		})
+	})
+
+	Context("when a process double-forks", func() {
+		It("reaps the orphaned grandchild once it exits", func() {
+			cmd, stdout := run("sleep 0.2 & echo $!")
+			Expect(reaper.Wait(cmd)).To(BeEquivalentTo(0))
+
+			orphan, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() bool { return exists(orphan) }).Should(BeFalse())
+		})
+
+		It("reaps many orphans exiting at once", func() {
+			cmd, stdout := run("for i in 1 2 3 4 5 6 7 8 9 10; do sleep 0.2 & echo $!; done")
+			Expect(reaper.Wait(cmd)).To(BeEquivalentTo(0))
+
+			for _, field := range strings.Fields(stdout.String()) {
+				orphan, err := strconv.Atoi(field)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(func() bool { return exists(orphan) }).Should(BeFalse())
+			}
+		})
+	})
+
+	Context("when the process was not started by the reaper", func() {
+		It("returns an error", func() {
+			cmd := exec.Command("true")
+			Expect(cmd.Start()).To(Succeed())
+			defer cmd.Wait()
+
+			_, err := reaper.Wait(cmd)
+			Expect(err).To(MatchError(ContainSubstring("not started by the reaper")))
+		})
+	})
+})
+
+// exists reports whether there is any process with the given pid, even a
+// zombie which has not been reaped.
+func exists(pid int) bool {
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
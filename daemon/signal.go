@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Signaller sends signals to a process spawned by the daemon, by sending a
+// Request naming its ProcessID over the daemon's socket. It can be used as a
+// process_tracker.Signaller.
+type Signaller struct {
+	SocketPath string
+	ProcessID  uint32
+}
+
+func (s *Signaller) Signal(signal os.Signal) error {
+	sig, ok := signal.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("daemon: unsupported signal: %s", signal)
+	}
+
+	if s.ProcessID == 0 {
+		return errors.New("daemon: process has no id to signal it by")
+	}
+
+	return send(s.SocketPath, Request{ProcessID: s.ProcessID, Signal: sig})
+}
+
+// send sends the daemon a request which it answers without sending any files.
+func send(socketPath string, request Request) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("daemon: connect to socket: %s", err)
+	}
+	defer conn.Close()
+
+	// without a trailing newline, so that the daemon reads the whole
+	// request and does not reset the connection when it closes it
+	msg, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("daemon: send request: %s", err)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("daemon: send request: %s", err)
+	}
+
+	// the daemon closes the connection once it has handled the request,
+	// having written any error it hit
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("daemon: read reply: %s", err)
+	}
+
+	if len(reply) > 0 {
+		return errors.New(string(reply))
+	}
+
+	return nil
+}
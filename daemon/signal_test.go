@@ -0,0 +1,84 @@
+package daemon_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signaller", func() {
+	var (
+		tmpDir     string
+		socketPath string
+		listener   *daemon.Listener
+		waited     chan *os.ProcessState
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "signaller")
+		Expect(err).NotTo(HaveOccurred())
+
+		// buffered, since a process exiting is not waited for by every test
+		waited = make(chan *os.ProcessState, 2)
+		socketPath = filepath.Join(tmpDir, "initd.sock")
+		listener = startDaemon(socketPath, waited)
+	})
+
+	AfterEach(func() {
+		listener.Stop()
+		os.RemoveAll(tmpDir)
+	})
+
+	spawn := func(id uint32) {
+		connector := &unix_socket.Connector{SocketPath: socketPath}
+		_, err := daemon.NewProcess(connector, id, &garden.ProcessSpec{Path: "sleep", Args: []string{"10"}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("delivers the signal to the process with the same id", func() {
+		spawn(7)
+
+		signaller := &daemon.Signaller{SocketPath: socketPath, ProcessID: 7}
+		Expect(signaller.Signal(syscall.SIGTERM)).To(Succeed())
+
+		var state *os.ProcessState
+		Eventually(waited).Should(Receive(&state))
+		Expect(state.Sys().(syscall.WaitStatus).Signal()).To(Equal(syscall.SIGTERM))
+	})
+
+	Context("when no running process has the id", func() {
+		It("returns the daemon's error", func() {
+			signaller := &daemon.Signaller{SocketPath: socketPath, ProcessID: 9}
+			Expect(signaller.Signal(syscall.SIGTERM)).To(MatchError("daemon: no running process with id 9"))
+		})
+	})
+
+	Context("when the process has exited", func() {
+		It("returns an error", func() {
+			spawn(7)
+
+			signaller := &daemon.Signaller{SocketPath: socketPath, ProcessID: 7}
+			Expect(signaller.Signal(syscall.SIGKILL)).To(Succeed())
+			Eventually(waited).Should(Receive())
+
+			Eventually(func() error {
+				return signaller.Signal(syscall.SIGTERM)
+			}).Should(MatchError("daemon: no running process with id 7"))
+		})
+	})
+
+	Context("when the process has no id", func() {
+		It("returns an error without contacting the daemon", func() {
+			signaller := &daemon.Signaller{SocketPath: "/does/not/exist"}
+			Expect(signaller.Signal(syscall.SIGTERM)).To(MatchError("daemon: process has no id to signal it by"))
+		})
+	})
+})
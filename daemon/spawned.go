@@ -0,0 +1,215 @@
+package daemon
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// spawned is a process the daemon has spawned. It keeps the process's recent
+// output and, once it has exited, its exit status, so that clients can attach
+// to it after the one which spawned it has gone.
+type spawned struct {
+	process *os.Process
+
+	// stdout and stderr are nil for a process with a terminal
+	stdout *output
+	stderr *output
+
+	// done is closed once the process has exited
+	done chan struct{}
+
+	mu          sync.Mutex
+	exited      bool
+	exitStatus  byte
+	reported    bool
+	exitClients []*os.File
+}
+
+func newSpawned(process *os.Process, stdout, stderr *output) *spawned {
+	return &spawned{
+		process: process,
+		stdout:  stdout,
+		stderr:  stderr,
+		done:    make(chan struct{}),
+	}
+}
+
+// signal sends the signal to the process's group, which it leads, so that
+// any children it has started get it too.
+func (s *spawned) signal(signal syscall.Signal) error {
+	return syscall.Kill(-s.process.Pid, signal)
+}
+
+func (s *spawned) hasExited() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.exited
+}
+
+func (s *spawned) setExitStatus(exitStatus byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exited = true
+	s.exitStatus = exitStatus
+	close(s.done)
+}
+
+// exit sends the exit status to every attached client, and to every client
+// which attaches from now on.
+func (s *spawned) exit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reported = true
+	for _, w := range s.exitClients {
+		reportExitStatus(w, s.exitStatus)
+	}
+
+	s.exitClients = nil
+}
+
+// attachExit sends the exit status to w once the process has exited.
+func (s *spawned) attachExit(w *os.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reported {
+		reportExitStatus(w, s.exitStatus)
+		return
+	}
+
+	s.exitClients = append(s.exitClients, w)
+}
+
+// reportExitStatus writes the exit status to w and closes it. A client which
+// has gone away is no longer waiting for it, so any error is ignored.
+func reportExitStatus(w *os.File, exitStatus byte) {
+	w.Write([]byte{exitStatus})
+	w.Close()
+}
+
+// output keeps the last bytes a process wrote to one of its streams in a
+// bounded buffer, and copies everything it writes on to each attached client.
+// A client which stops reading holds up the process's output once the pipe
+// to it is full, as it would if it were reading the process's pipe directly.
+type output struct {
+	size int
+
+	mu      sync.Mutex
+	buf     []byte
+	clients []*outputClient
+	closed  bool
+}
+
+// outputClient is a client attached to an output. While the buffered output
+// is replayed to it, anything new the process writes is queued in pending.
+type outputClient struct {
+	w         *os.File
+	replaying bool
+	pending   []byte
+}
+
+func newOutput(size int) *output {
+	return &output{size: size}
+}
+
+// Write buffers p and sends it to every client. A client which cannot be
+// written to has gone away, and is dropped.
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > o.size {
+		o.buf = o.buf[len(o.buf)-o.size:]
+	}
+
+	clients := o.clients[:0]
+	for _, c := range o.clients {
+		if c.replaying {
+			c.pending = append(c.pending, p...)
+		} else if _, err := c.w.Write(p); err != nil {
+			c.w.Close()
+			continue
+		}
+
+		clients = append(clients, c)
+	}
+
+	o.clients = clients
+	return len(p), nil
+}
+
+// attach replays the buffered output to w and then sends it everything the
+// process writes from now on, closing it once the stream ends. The replay
+// happens in the background, since w's reader may not be reading yet.
+func (o *output) attach(w *os.File) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	c := &outputClient{w: w, replaying: true}
+	if !o.closed {
+		o.clients = append(o.clients, c)
+	}
+
+	go o.replay(c, append([]byte{}, o.buf...))
+}
+
+func (o *output) replay(c *outputClient, data []byte) {
+	for {
+		if _, err := c.w.Write(data); err != nil {
+			o.drop(c)
+			return
+		}
+
+		o.mu.Lock()
+		if len(c.pending) == 0 {
+			c.replaying = false
+			closed := o.closed
+			o.mu.Unlock()
+
+			if closed {
+				c.w.Close()
+			}
+
+			return
+		}
+
+		data, c.pending = c.pending, nil
+		o.mu.Unlock()
+	}
+}
+
+func (o *output) drop(c *outputClient) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	clients := o.clients[:0]
+	for _, other := range o.clients {
+		if other != c {
+			clients = append(clients, other)
+		}
+	}
+
+	o.clients = clients
+	c.w.Close()
+}
+
+// close ends the stream for every client. Clients still being replayed to
+// are closed once the replay is done.
+func (o *output) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	for _, c := range o.clients {
+		if !c.replaying {
+			c.w.Close()
+		}
+	}
+
+	o.clients = nil
+}
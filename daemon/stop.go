@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"syscall"
+	"time"
+)
+
+// DefaultStopGracePeriod is how long processes are given to exit after
+// SIGTERM, before they are sent SIGKILL, when a stop request has no
+// GracePeriod.
+const DefaultStopGracePeriod = 10 * time.Second
+
+// Stop asks the daemon listening on socketPath to stop every process it is
+// running, returning once it has.
+func Stop(socketPath string, kill bool, gracePeriod time.Duration) error {
+	return send(socketPath, Request{Stop: true, Kill: kill, GracePeriod: gracePeriod})
+}
+
+// stop sends every running process's group SIGKILL if kill is set, or else
+// SIGTERM, waiting up to gracePeriod for the processes to exit before sending
+// their groups SIGKILL. The groups are sent SIGKILL even once every process
+// has exited, to stop any children left behind.
+func (cd *ContainerDaemon) stop(kill bool, gracePeriod time.Duration) {
+	cd.mu.Lock()
+	running := make([]*spawned, 0, len(cd.running))
+	for s := range cd.running {
+		running = append(running, s)
+	}
+	cd.mu.Unlock()
+
+	if !kill {
+		if gracePeriod == 0 {
+			gracePeriod = DefaultStopGracePeriod
+		}
+
+		for _, s := range running {
+			s.signal(syscall.SIGTERM)
+		}
+
+		timeout := time.After(gracePeriod)
+
+	waiting:
+		for _, s := range running {
+			select {
+			case <-s.done:
+			case <-timeout:
+				break waiting
+			}
+		}
+	}
+
+	for _, s := range running {
+		s.signal(syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,109 @@
+package daemon_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
+	"github.com/julz/garden-docker/daemon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Stop", func() {
+	var (
+		tmpDir     string
+		socketPath string
+		listener   *daemon.Listener
+		waited     chan *os.ProcessState
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "stop")
+		Expect(err).NotTo(HaveOccurred())
+
+		waited = make(chan *os.ProcessState, 2)
+		socketPath = filepath.Join(tmpDir, "initd.sock")
+		listener = startDaemon(socketPath, waited)
+	})
+
+	AfterEach(func() {
+		listener.Stop()
+		os.RemoveAll(tmpDir)
+	})
+
+	spawn := func(script string) *gbytes.Buffer {
+		stdout := gbytes.NewBuffer()
+		connector := &unix_socket.Connector{SocketPath: socketPath}
+		_, err := daemon.NewProcess(connector, 0, &garden.ProcessSpec{Path: "sh", Args: []string{"-c", script}}, &garden.ProcessIO{Stdout: stdout})
+		Expect(err).NotTo(HaveOccurred())
+
+		return stdout
+	}
+
+	signalled := func() syscall.Signal {
+		var state *os.ProcessState
+		Eventually(waited).Should(Receive(&state))
+		return state.Sys().(syscall.WaitStatus).Signal()
+	}
+
+	It("sends every process SIGTERM", func() {
+		spawn("exec sleep 10")
+
+		Expect(daemon.Stop(socketPath, false, time.Second)).To(Succeed())
+		Expect(signalled()).To(Equal(syscall.SIGTERM))
+	})
+
+	Context("when kill is set", func() {
+		It("sends every process SIGKILL", func() {
+			spawn("exec sleep 10")
+
+			Expect(daemon.Stop(socketPath, true, 0)).To(Succeed())
+			Expect(signalled()).To(Equal(syscall.SIGKILL))
+		})
+	})
+
+	Context("when a process ignores SIGTERM", func() {
+		It("sends it SIGKILL once the grace period is over", func() {
+			stdout := spawn("trap '' TERM; echo started; sleep 10")
+			Eventually(stdout).Should(gbytes.Say("started"))
+
+			started := time.Now()
+			Expect(daemon.Stop(socketPath, false, 200*time.Millisecond)).To(Succeed())
+			Expect(time.Since(started)).To(BeNumerically(">=", 200*time.Millisecond))
+			Expect(signalled()).To(Equal(syscall.SIGKILL))
+		})
+	})
+
+	It("stops the children the processes have started", func() {
+		stdout := spawn("sleep 10 & echo $!; wait")
+		Eventually(stdout).Should(gbytes.Say(`\d+\n`))
+
+		child, err := strconv.Atoi(strings.TrimSpace(string(stdout.Contents())))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(daemon.Stop(socketPath, false, time.Second)).To(Succeed())
+		Eventually(func() bool { return alive(child) }).Should(BeFalse())
+	})
+})
+
+// alive reports whether the process with the given pid is running; a zombie
+// has exited, even though it has not been reaped.
+func alive(pid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// SetWindowSize resizes the terminal t, which may be either end of a pty.
+// The process in the terminal is sent SIGWINCH.
+func SetWindowSize(t *os.File, columns, rows int) error {
+	ws := struct {
+		rows, columns, xpixel, ypixel uint16
+	}{rows: uint16(rows), columns: uint16(columns)}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
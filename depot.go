@@ -2,65 +2,168 @@ package gardendocker
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"sync"
 
 	"github.com/nu7hatch/gouuid"
-	"github.com/onsi/gomega/gexec"
 )
 
 //go:generate counterfeiter . Depot
 type Depot interface {
 	Create() (string, error)
+	Destroy(dir string) error
 }
 
 type ContainerDepot struct {
 	Dir string
+
+	// DoshPath and IodaemonPath are the dosh and iodaemon binaries copied
+	// into each container directory, which processes are run through.
+	DoshPath     string
+	IodaemonPath string
+
+	// NewName, if set, generates candidate container directory names in
+	// place of random guids.
+	NewName func() string
+
+	// created are the directories this process has created and not yet
+	// destroyed, which are never orphans.
+	mu      sync.Mutex
+	created map[string]bool
 }
 
+// maxDepotAttempts is how many candidate names Create tries before giving up.
+const maxDepotAttempts = 10
+
+// Create makes a new container directory. The directory itself is created
+// exclusively, so concurrent Creates which happen upon the same name never
+// share it: the loser simply tries another name. If anything fails after
+// that, the directory is removed again. It is recorded as created as soon as
+// it exists, so that it is not taken for an orphan while being populated.
 func (depot *ContainerDepot) Create() (string, error) {
-	containerDir := path.Join(depot.Dir, guid())
+	containerDir, err := depot.reserve()
+	if err != nil {
+		return "", err
+	}
+
+	depot.mu.Lock()
+	if depot.created == nil {
+		depot.created = make(map[string]bool)
+	}
+	depot.created[containerDir] = true
+	depot.mu.Unlock()
+
+	if err := depot.populate(containerDir); err != nil {
+		depot.Destroy(containerDir)
+		return "", err
+	}
+
+	return containerDir, nil
+}
+
+func (depot *ContainerDepot) reserve() (string, error) {
+	newName := depot.NewName
+	if newName == nil {
+		newName = guid
+	}
+
+	for i := 0; i < maxDepotAttempts; i++ {
+		containerDir := path.Join(depot.Dir, newName())
+
+		err := os.Mkdir(containerDir, 0700)
+		if err == nil {
+			return containerDir, nil
+		}
+
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("create container dir: %s", err)
+		}
+	}
+
+	return "", fmt.Errorf("create container dir: no free name after %d attempts", maxDepotAttempts)
+}
+
+func (depot *ContainerDepot) populate(containerDir string) error {
 	runDir := path.Join(containerDir, "run")
 	binDir := path.Join(containerDir, "bin")
 	processesDir := path.Join(containerDir, "processes")
-	os.MkdirAll(runDir, 0700)
-	os.MkdirAll(processesDir, 0700)
-
-	if err := os.MkdirAll(binDir, 0777); err != nil {
-		panic(err)
-	}
 
-	// FIXME(jz) remove all this hackery and just re-exec
-	iodaemonPath, err := gexec.Build("github.com/cloudfoundry-incubator/garden-linux/iodaemon")
-	if err != nil {
-		return "", fmt.Errorf("build iodaemon: %s", err)
+	for _, dir := range []string{runDir, processesDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return fmt.Errorf("create container dir: %s", err)
+		}
 	}
 
-	doshPath, err := gexec.Build("github.com/julz/garden-docker/cmd/dosh")
-	if err != nil {
-		return "", fmt.Errorf("build dosh: %s", err)
+	if err := os.Mkdir(binDir, 0777); err != nil {
+		return fmt.Errorf("create container dir: %s", err)
 	}
 
-	cp := exec.Command("cp", iodaemonPath, path.Join(binDir, "iodaemon"))
+	cp := exec.Command("cp", depot.IodaemonPath, path.Join(binDir, "iodaemon"))
 	cp.Stderr = os.Stderr
 	if err := cp.Run(); err != nil {
-		return "", fmt.Errorf("copy iodaemon: %s", err)
+		return fmt.Errorf("copy iodaemon: %s", err)
 	}
 
-	cp = exec.Command("cp", doshPath, path.Join(binDir, "dosh"))
+	cp = exec.Command("cp", depot.DoshPath, path.Join(binDir, "dosh"))
 	cp.Stderr = os.Stderr
 	if err := cp.Run(); err != nil {
-		return "", fmt.Errorf("copy dosh: %s", err)
+		return fmt.Errorf("copy dosh: %s", err)
 	}
 
 	cp = exec.Command("chmod", "u+x", path.Join(binDir, "dosh"))
 	cp.Stderr = os.Stderr
 	if err := cp.Run(); err != nil {
-		return "", fmt.Errorf("chmod dosh: %s", err)
+		return fmt.Errorf("chmod dosh: %s", err)
 	}
 
-	return containerDir, nil
+	return nil
+}
+
+func (depot *ContainerDepot) Destroy(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	depot.mu.Lock()
+	delete(depot.created, dir)
+	depot.mu.Unlock()
+
+	return nil
+}
+
+// Orphans returns the container directories in the depot which are not in
+// use, such as those left behind by containers a crashed garden-docker
+// process could not restore. Directories this process created, which may
+// belong to containers still being created, are never orphans, and neither
+// is anything which does not look like a container directory.
+func (depot *ContainerDepot) Orphans(inUse map[string]bool) ([]string, error) {
+	entries, err := ioutil.ReadDir(depot.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("list depot: %s", err)
+	}
+
+	depot.mu.Lock()
+	defer depot.mu.Unlock()
+
+	var orphans []string
+	for _, entry := range entries {
+		dir := path.Join(depot.Dir, entry.Name())
+		if !entry.IsDir() || inUse[dir] || depot.created[dir] {
+			continue
+		}
+
+		if info, err := os.Stat(path.Join(dir, "run")); err != nil || !info.IsDir() {
+			continue
+		}
+
+		orphans = append(orphans, dir)
+	}
+
+	return orphans, nil
 }
 
 func guid() string {
@@ -71,3 +174,31 @@ func guid() string {
 
 	return u.String()
 }
+
+// writeStateFile replaces the state file at path with data atomically, so
+// that a crash part way through never leaves a truncated file behind.
+func writeStateFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
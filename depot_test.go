@@ -2,6 +2,7 @@ package gardendocker_test
 
 import (
 	"io/ioutil"
+	"os"
 	"path"
 
 	. "github.com/julz/garden-docker"
@@ -17,8 +18,17 @@ var _ = Describe("Depot", func() {
 		tmp, err := ioutil.TempDir("", "")
 		Expect(err).NotTo(HaveOccurred())
 
+		bins, err := ioutil.TempDir("", "bins")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, bin := range []string{"dosh", "iodaemon"} {
+			Expect(ioutil.WriteFile(path.Join(bins, bin), []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+		}
+
 		depot = &ContainerDepot{
-			Dir: tmp,
+			Dir:          tmp,
+			DoshPath:     path.Join(bins, "dosh"),
+			IodaemonPath: path.Join(bins, "iodaemon"),
 		}
 	})
 
@@ -41,6 +51,12 @@ var _ = Describe("Depot", func() {
 			Expect(path.Join(dir, "bin", "iodaemon")).To(BeAnExistingFile())
 		})
 
+		It("copies dosh into bin/ directory", func() {
+			dir, err := depot.Create()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(path.Join(dir, "bin", "dosh"))).To(Equal([]byte("#!/bin/sh\n")))
+		})
+
 		Context("with multiple containers", func() {
 			It("creates distinct run directories for each container", func() {
 				dir1, err := depot.Create()
@@ -52,5 +68,90 @@ var _ = Describe("Depot", func() {
 				Expect(dir2).NotTo(Equal(dir1))
 			})
 		})
+
+		Context("when every candidate name is already taken", func() {
+			BeforeEach(func() {
+				Expect(os.Mkdir(path.Join(depot.Dir, "taken"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(depot.Dir, "taken", "some-file"), []byte("x"), 0600)).To(Succeed())
+
+				depot.NewName = func() string { return "taken" }
+			})
+
+			It("gives up without touching the existing directory", func() {
+				_, err := depot.Create()
+				Expect(err).To(MatchError(ContainSubstring("no free name")))
+				Expect(path.Join(depot.Dir, "taken", "some-file")).To(BeAnExistingFile())
+			})
+		})
+
+		Context("when the depot directory does not exist", func() {
+			BeforeEach(func() {
+				depot.Dir = path.Join(depot.Dir, "missing")
+			})
+
+			It("returns an error", func() {
+				_, err := depot.Create()
+				Expect(err).To(MatchError(ContainSubstring("create container dir")))
+			})
+		})
+	})
+
+	Describe("Destroy", func() {
+		It("removes the container directory", func() {
+			dir, err := ioutil.TempDir(depot.Dir, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(depot.Destroy(dir)).To(Succeed())
+			Expect(dir).NotTo(BeADirectory())
+		})
+	})
+
+	Describe("Orphans", func() {
+		var leftover string
+
+		BeforeEach(func() {
+			leftover = path.Join(depot.Dir, "leftover")
+			Expect(os.MkdirAll(path.Join(leftover, "run"), 0700)).To(Succeed())
+		})
+
+		It("returns container directories which are not in use", func() {
+			Expect(depot.Orphans(nil)).To(ConsistOf(leftover))
+		})
+
+		It("does not return directories which are in use", func() {
+			Expect(depot.Orphans(map[string]bool{leftover: true})).To(BeEmpty())
+		})
+
+		It("does not return directories this depot created, even if they are not in use yet", func() {
+			dir, err := depot.Create()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(depot.Orphans(nil)).NotTo(ContainElement(dir))
+		})
+
+		It("does not return directories which are still being populated", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				depot.Create()
+			}()
+
+			for {
+				Expect(depot.Orphans(nil)).To(ConsistOf(leftover))
+
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		})
+
+		It("does not return anything which does not look like a container directory", func() {
+			Expect(ioutil.WriteFile(path.Join(depot.Dir, "initd"), []byte("x"), 0700)).To(Succeed())
+			Expect(os.Mkdir(path.Join(depot.Dir, "something-else"), 0700)).To(Succeed())
+
+			Expect(depot.Orphans(nil)).To(ConsistOf(leftover))
+		})
 	})
 })
@@ -0,0 +1,88 @@
+package gardendocker
+
+import (
+	"fmt"
+
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . DepotUsers
+type DepotUsers interface {
+	// DepotDirs returns the depot directories of every garden-owned docker
+	// container.
+	DepotDirs() (map[string]bool, error)
+}
+
+// DepotGC removes directories from the depot which belong neither to a
+// container in the repo nor to a garden-owned docker container, such as
+// those a crashed garden-docker process leaves behind. If DryRun is set, it
+// only logs what it would remove.
+//
+// Anything in doubt is kept: if docker cannot be asked which directories
+// its containers use, nothing is removed.
+type DepotGC struct {
+	Depot  *ContainerDepot
+	Repo   Repo
+	Docker DepotUsers
+	DryRun bool
+
+	Logger lager.Logger
+}
+
+func (gc *DepotGC) Collect() {
+	log := gc.Logger.Session("depot-gc", lager.Data{"dry-run": gc.DryRun})
+
+	inUse, err := gc.Docker.DepotDirs()
+	if err != nil {
+		log.Error("list-docker-depot-dirs-failed", err)
+		return
+	}
+
+	for _, container := range gc.Repo.All() {
+		inUse[container.ContainerPath] = true
+	}
+
+	orphans, err := gc.Depot.Orphans(inUse)
+	if err != nil {
+		log.Error("list-orphans-failed", err)
+		return
+	}
+
+	for _, dir := range orphans {
+		if gc.DryRun {
+			log.Info("would-remove-orphan", lager.Data{"dir": dir})
+			continue
+		}
+
+		if err := gc.Depot.Destroy(dir); err != nil {
+			log.Error("remove-orphan-failed", err, lager.Data{"dir": dir})
+			continue
+		}
+
+		log.Info("removed-orphan", lager.Data{"dir": dir})
+	}
+}
+
+// DepotDirs returns the depot directories garden-owned docker containers
+// have mounted, whether or not they are running.
+func (c *DaemonContainerCreator) DepotDirs() (map[string]bool, error) {
+	ids, err := c.Owned()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, id := range ids {
+		info, err := c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: id})
+		if err != nil {
+			return nil, fmt.Errorf("inspect %s: %s", id, err)
+		}
+
+		if dir := depotDir(info); dir != "" {
+			dirs[dir] = true
+		}
+	}
+
+	return dirs, nil
+}
@@ -0,0 +1,104 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("DepotGC", func() {
+	var (
+		gc         *gardendocker.DepotGC
+		depot      *gardendocker.ContainerDepot
+		repo       gardendocker.Repo
+		fakeDocker *fakes.FakeDepotUsers
+
+		orphan, inRepo, inDocker string
+	)
+
+	containerDir := func(name string) string {
+		dir := path.Join(depot.Dir, name)
+		Expect(os.MkdirAll(path.Join(dir, "run"), 0700)).To(Succeed())
+		return dir
+	}
+
+	BeforeEach(func() {
+		tmp, err := ioutil.TempDir("", "depotgc")
+		Expect(err).NotTo(HaveOccurred())
+
+		depot = &gardendocker.ContainerDepot{Dir: tmp}
+		repo = gardendocker.NewRepo()
+		fakeDocker = new(fakes.FakeDepotUsers)
+
+		gc = &gardendocker.DepotGC{
+			Depot:  depot,
+			Repo:   repo,
+			Docker: fakeDocker,
+			Logger: lagertest.NewTestLogger("depot-gc"),
+		}
+
+		orphan = containerDir("orphan")
+		inRepo = containerDir("in-repo")
+		inDocker = containerDir("in-docker")
+
+		repo.Add(&gardendocker.Container{
+			InfoHandler: &gardendocker.InfoHandler{
+				Spec:          garden.ContainerSpec{Handle: "some-handle"},
+				ContainerPath: inRepo,
+			},
+		})
+
+		fakeDocker.DepotDirsReturns(map[string]bool{inDocker: true}, nil)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(depot.Dir)
+	})
+
+	It("removes directories which belong to no container", func() {
+		gc.Collect()
+
+		Expect(orphan).NotTo(BeADirectory())
+	})
+
+	It("keeps the directories of containers in the repo and of garden-owned docker containers", func() {
+		gc.Collect()
+
+		Expect(inRepo).To(BeADirectory())
+		Expect(inDocker).To(BeADirectory())
+	})
+
+	Context("when DryRun is set", func() {
+		BeforeEach(func() {
+			gc.DryRun = true
+		})
+
+		It("only logs what it would remove", func() {
+			gc.Collect()
+
+			Expect(orphan).To(BeADirectory())
+			Expect(gc.Logger.(*lagertest.TestLogger).LogMessages()).To(ContainElement(ContainSubstring("would-remove-orphan")))
+		})
+	})
+
+	Context("when docker cannot be asked which directories are in use", func() {
+		BeforeEach(func() {
+			fakeDocker.DepotDirsReturns(nil, errors.New("docker is down"))
+		})
+
+		It("removes nothing", func() {
+			gc.Collect()
+
+			Expect(orphan).To(BeADirectory())
+			Expect(inDocker).To(BeADirectory())
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package gardendocker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAllowedDevices are the device nodes unprivileged containers may use
+// unless told otherwise: the usual character devices every process expects,
+// and the pseudo-terminals TTY processes are given.
+var DefaultAllowedDevices = []string{
+	"c 1:3 rwm",   // /dev/null
+	"c 1:5 rwm",   // /dev/zero
+	"c 1:7 rwm",   // /dev/full
+	"c 1:8 rwm",   // /dev/random
+	"c 1:9 rwm",   // /dev/urandom
+	"c 5:0 rwm",   // /dev/tty
+	"c 5:1 rwm",   // /dev/console
+	"c 5:2 rwm",   // /dev/ptmx
+	"c 136:* rwm", // /dev/pts/*
+}
+
+//go:generate counterfeiter . DeviceWhitelist
+
+// DeviceWhitelist restricts the device nodes a running container may use.
+type DeviceWhitelist interface {
+	Apply(dockerID string) error
+}
+
+// DevicesCgroup is a DeviceWhitelist which denies a container every device
+// but the Allowed ones by writing to its v1 devices cgroup, found as
+// CgroupStats finds its other cgroups. The unified v2 hierarchy has no
+// devices files to write to, so it is not supported.
+type DevicesCgroup struct {
+	DockerRunner DockerRunner
+	Allowed      []string
+
+	// CgroupRoot and ProcRoot default to /sys/fs/cgroup and /proc.
+	CgroupRoot string
+	ProcRoot   string
+}
+
+func (d *DevicesCgroup) Apply(dockerID string) error {
+	stats := &CgroupStats{
+		DockerRunner: d.DockerRunner,
+		DockerID:     dockerID,
+		CgroupRoot:   d.CgroupRoot,
+		ProcRoot:     d.ProcRoot,
+	}
+
+	dir, v2, err := stats.dir("devices")
+	if err != nil {
+		return fmt.Errorf("devices cgroup: %s", err)
+	}
+
+	if dir == "" {
+		return fmt.Errorf("devices cgroup: container %s is not running", dockerID)
+	}
+
+	if v2 {
+		return fmt.Errorf("devices cgroup: container %s has no v1 devices cgroup", dockerID)
+	}
+
+	if err := writeCgroupRule(filepath.Join(dir, "devices.deny"), "a"); err != nil {
+		return fmt.Errorf("devices cgroup: %s", err)
+	}
+
+	for _, rule := range d.Allowed {
+		if err := writeCgroupRule(filepath.Join(dir, "devices.allow"), rule); err != nil {
+			return fmt.Errorf("devices cgroup: allow %s: %s", rule, err)
+		}
+	}
+
+	return nil
+}
+
+// writeCgroupRule makes one write of a rule to a devices cgroup file, which
+// the kernel applies on its own.
+func writeCgroupRule(path, rule string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(rule + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ParseDeviceRules parses a comma separated list of devices cgroup rules,
+// each a type (a, b or c), a major:minor pair, either of which may be *, and
+// access (some of r, w and m), e.g. "c 1:3 rwm,c 136:* rwm".
+func ParseDeviceRules(rules string) ([]string, error) {
+	var parsed []string
+	for _, rule := range strings.Split(rules, ",") {
+		fields := strings.Fields(rule)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 || !validDeviceRule(fields[0], fields[1], fields[2]) {
+			return nil, fmt.Errorf("invalid device rule %q: expected e.g. \"c 1:3 rwm\"", strings.TrimSpace(rule))
+		}
+
+		parsed = append(parsed, strings.Join(fields, " "))
+	}
+
+	return parsed, nil
+}
+
+func validDeviceRule(kind, numbers, access string) bool {
+	if kind != "a" && kind != "b" && kind != "c" {
+		return false
+	}
+
+	majorMinor := strings.Split(numbers, ":")
+	if len(majorMinor) != 2 || !deviceNumber(majorMinor[0]) || !deviceNumber(majorMinor[1]) {
+		return false
+	}
+
+	return access != "" && strings.Trim(access, "rwm") == ""
+}
+
+func deviceNumber(n string) bool {
+	return n == "*" || (n != "" && strings.Trim(n, "0123456789") == "")
+}
@@ -0,0 +1,121 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DevicesCgroup", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var root string
+	var devices *DevicesCgroup
+
+	write := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, path), []byte(contents), 0644)).To(Succeed())
+	}
+
+	read := func(path string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(root, path))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "cgroups")
+		Expect(err).NotTo(HaveOccurred())
+
+		info := dockercli.ContainerJSON{}
+		info.State.Running = true
+		info.State.Pid = 42
+
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.InspectReturns(info, nil)
+
+		devices = &DevicesCgroup{
+			DockerRunner: dockerRunner,
+			Allowed:      []string{"c 1:3 rwm", "c 136:* rwm"},
+			CgroupRoot:   filepath.Join(root, "cgroup"),
+			ProcRoot:     filepath.Join(root, "proc"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Context("with cgroup v1", func() {
+		BeforeEach(func() {
+			write("proc/42/cgroup", "5:devices:/docker/abc\n4:memory:/docker/abc\n")
+			write("cgroup/devices/docker/abc/devices.deny", "")
+			write("cgroup/devices/docker/abc/devices.allow", "")
+		})
+
+		It("denies every device, then allows the allowed ones one at a time", func() {
+			Expect(devices.Apply("some-docker-id")).To(Succeed())
+			Expect(dockerRunner.InspectArgsForCall(0).ContainerID).To(Equal("some-docker-id"))
+
+			Expect(read("cgroup/devices/docker/abc/devices.deny")).To(Equal("a\n"))
+			Expect(read("cgroup/devices/docker/abc/devices.allow")).To(Equal("c 1:3 rwm\nc 136:* rwm\n"))
+		})
+	})
+
+	Context("with only the unified hierarchy", func() {
+		BeforeEach(func() {
+			write("proc/42/cgroup", "0::/system.slice/docker-abc.scope\n")
+		})
+
+		It("fails, since it has no devices files", func() {
+			Expect(devices.Apply("some-docker-id")).To(MatchError(ContainSubstring("no v1 devices cgroup")))
+		})
+	})
+
+	Context("when the container is not running", func() {
+		BeforeEach(func() {
+			dockerRunner.InspectReturns(dockercli.ContainerJSON{}, nil)
+		})
+
+		It("fails", func() {
+			Expect(devices.Apply("some-docker-id")).To(MatchError(ContainSubstring("not running")))
+		})
+	})
+})
+
+var _ = Describe("ParseDeviceRules", func() {
+	It("parses a comma separated list of rules", func() {
+		Expect(ParseDeviceRules("c 1:3 rwm, c  136:* rw,b *:* m")).To(Equal([]string{
+			"c 1:3 rwm",
+			"c 136:* rw",
+			"b *:* m",
+		}))
+	})
+
+	It("parses an empty list as no rules", func() {
+		Expect(ParseDeviceRules("")).To(BeEmpty())
+	})
+
+	It("parses the default rules", func() {
+		rules := ""
+		for _, rule := range DefaultAllowedDevices {
+			rules += rule + ","
+		}
+
+		Expect(ParseDeviceRules(rules)).To(Equal(DefaultAllowedDevices))
+	})
+
+	It("rejects malformed rules", func() {
+		for _, rule := range []string{"x 1:3 rwm", "c 1 rwm", "c 1:a rwm", "c 1:3 rwx", "c 1:3", "c 1:3 "} {
+			_, err := ParseDeviceRules(rule)
+			Expect(err).To(MatchError(ContainSubstring("invalid device rule")), rule)
+		}
+	})
+})
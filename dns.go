@@ -0,0 +1,143 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// DNSServersProperty is the container property listing, comma-separated, the
+// name servers to put in the container's resolv.conf in place of the
+// creator's.
+const DNSServersProperty = "garden-docker.dns-servers"
+
+// HostEntriesProperty is the container property listing, comma-separated,
+// the entries ("ip name [alias...]") to put in the container's /etc/hosts in
+// place of the creator's.
+const HostEntriesProperty = "garden-docker.host-entries"
+
+// DNSConfig is what garden-docker writes to containers' resolv.conf and
+// /etc/hosts in place of the files docker generates. A container keeps
+// docker's resolv.conf if there are no Servers, and its /etc/hosts if there
+// are no HostEntries.
+type DNSConfig struct {
+	Servers     []string
+	HostEntries []string
+}
+
+// Validate returns an error if a server is not an IP address, or a host
+// entry is not an IP address followed by at least one name.
+func (d DNSConfig) Validate() error {
+	for _, server := range d.Servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q: want an IP address", server)
+		}
+	}
+
+	for _, entry := range d.HostEntries {
+		fields := strings.Fields(entry)
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			return fmt.Errorf("invalid host entry %q: want an IP address and names", entry)
+		}
+	}
+
+	return nil
+}
+
+// dnsConfig returns the DNSConfig for a container with the given properties,
+// which may override the creator's.
+func (c *DaemonContainerCreator) dnsConfig(props garden.Properties) (DNSConfig, error) {
+	dns := c.DNS
+	if servers, ok := props[DNSServersProperty]; ok {
+		dns.Servers = splitCommas(servers)
+	}
+
+	if entries, ok := props[HostEntriesProperty]; ok {
+		dns.HostEntries = splitCommas(entries)
+	}
+
+	return dns, dns.Validate()
+}
+
+// writeDNSFiles writes the resolv.conf and /etc/hosts a container is given
+// into its depot directory, and returns the volumes mounting them. The hosts
+// file does not yet name the container, since its IP may not be known until
+// it is running; writeHosts adds it then.
+func writeDNSFiles(dir string, dns DNSConfig) ([]dockercli.Volume, error) {
+	if len(dns.Servers) == 0 && len(dns.HostEntries) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "etc"), 0755); err != nil {
+		return nil, err
+	}
+
+	var volumes []dockercli.Volume
+	if len(dns.Servers) > 0 {
+		var resolvConf bytes.Buffer
+		for _, server := range dns.Servers {
+			fmt.Fprintf(&resolvConf, "nameserver %s\n", server)
+		}
+
+		path := filepath.Join(dir, "etc", "resolv.conf")
+		if err := ioutil.WriteFile(path, resolvConf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+
+		volumes = append(volumes, dockercli.Volume{HostPath: path, ContainerPath: "/etc/resolv.conf"})
+	}
+
+	if len(dns.HostEntries) > 0 {
+		path := filepath.Join(dir, "etc", "hosts")
+		if err := writeHosts(path, dns, "", nil); err != nil {
+			return nil, err
+		}
+
+		volumes = append(volumes, dockercli.Volume{HostPath: path, ContainerPath: "/etc/hosts"})
+	}
+
+	return volumes, nil
+}
+
+// writeHosts writes a container's /etc/hosts: the loopback names, the
+// container's hostname at each of its IPs, and the DNSConfig's entries. It
+// rewrites the file in place, rather than replacing it, so that a running
+// container's bind mount of it sees the new contents.
+func writeHosts(path string, dns DNSConfig, hostname string, ips []string) error {
+	var hosts bytes.Buffer
+	hosts.WriteString("127.0.0.1\tlocalhost\n")
+	hosts.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+
+	if hostname != "" {
+		for _, ip := range ips {
+			if ip != "" {
+				fmt.Fprintf(&hosts, "%s\t%s\n", ip, hostname)
+			}
+		}
+	}
+
+	for _, entry := range dns.HostEntries {
+		fields := strings.Fields(entry)
+		fmt.Fprintf(&hosts, "%s\t%s\n", fields[0], strings.Join(fields[1:], " "))
+	}
+
+	return ioutil.WriteFile(path, hosts.Bytes(), 0644)
+}
+
+func splitCommas(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
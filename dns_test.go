@@ -0,0 +1,26 @@
+package gardendocker_test
+
+import (
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSConfig", func() {
+	It("accepts IPv4 and IPv6 servers and host entries", func() {
+		Expect(DNSConfig{
+			Servers:     []string{"8.8.8.8", "2001:4860:4860::8888"},
+			HostEntries: []string{"10.0.0.1 db.internal db", "fd00::1 cache"},
+		}.Validate()).To(Succeed())
+	})
+
+	It("rejects servers which are not IP addresses", func() {
+		Expect(DNSConfig{Servers: []string{"dns.google"}}.Validate()).To(MatchError(`invalid dns server "dns.google": want an IP address`))
+	})
+
+	It("rejects host entries without an IP address and a name", func() {
+		Expect(DNSConfig{HostEntries: []string{"10.0.0.1"}}.Validate()).To(HaveOccurred())
+		Expect(DNSConfig{HostEntries: []string{"db.internal 10.0.0.1"}}.Validate()).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,1079 @@
+package dockercli
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// DefaultHost is where dockerd listens unless it is told otherwise.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client talks to dockerd over its Engine API instead of running the docker
+// cli, so that failures come back as dockerd's own messages, pulls report
+// their progress as they go, and no docker binary is needed. It has the same
+// methods as Runner, which it can be used in place of.
+type Client struct {
+	// Host is the address of dockerd, as unix:///path/to/socket or
+	// tcp://host:port. It defaults to DefaultHost.
+	Host string
+
+	// TLSConfig, if set, is used to connect to a tcp Host.
+	TLSConfig *tls.Config
+
+	// APIVersion, if set, pins the version of the API every request uses,
+	// as Runner's does.
+	APIVersion string
+
+	// Logger, if set, receives the progress of pulls at debug level and the
+	// message of every request that fails.
+	Logger  lager.Logger
+	Metrics *Metrics
+
+	// Retry, if set, makes the client retry requests which fail for
+	// transient reasons (see Transient), except those whose body cannot be
+	// sent again and those creating a container, which dockerd may have
+	// created before the request failed.
+	Retry *RetryPolicy
+
+	// parent is the client an Until copy shares its connections with.
+	parent *Client
+	until  time.Time
+
+	initOnce sync.Once
+	initErr  error
+	http     *http.Client
+	baseURL  string
+}
+
+// Until returns a client which shares this one's connections but gives up
+// at the deadline, such as that of the request it is used for: it makes no
+// more retries, and abandons any request still in flight, once the deadline
+// has passed.
+func (c *Client) Until(deadline time.Time) *Client {
+	return &Client{
+		Host:       c.Host,
+		TLSConfig:  c.TLSConfig,
+		APIVersion: c.APIVersion,
+		Logger:     c.Logger,
+		Metrics:    c.Metrics,
+		Retry:      c.Retry,
+
+		parent: c,
+		until:  deadline,
+	}
+}
+
+// context returns the context to send a request in, which ends at the
+// client's deadline, if it has one.
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.until.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithDeadline(context.Background(), c.until)
+}
+
+// apiError is a failed request, with the message dockerd gave for it.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func (c *Client) init() error {
+	c.initOnce.Do(func() {
+		if c.parent != nil {
+			c.initErr = c.parent.init()
+			c.http, c.baseURL = c.parent.http, c.parent.baseURL
+			return
+		}
+
+		host := c.Host
+		if host == "" {
+			host = DefaultHost
+		}
+
+		u, err := url.Parse(host)
+		if err != nil {
+			c.initErr = fmt.Errorf("invalid docker host %q: %s", host, err)
+			return
+		}
+
+		transport := &http.Transport{}
+		switch u.Scheme {
+		case "unix":
+			socket := u.Path
+			transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			}
+
+			c.baseURL = "http://docker"
+		case "tcp":
+			c.baseURL = "http://" + u.Host
+			if c.TLSConfig != nil {
+				transport.TLSClientConfig = c.TLSConfig
+				c.baseURL = "https://" + u.Host
+			}
+		default:
+			c.initErr = fmt.Errorf("invalid docker host %q: unsupported scheme", host)
+			return
+		}
+
+		c.http = &http.Client{Transport: transport}
+	})
+
+	return c.initErr
+}
+
+// send sends a single request. Any response but a success is returned as an
+// apiError, and a dockerd which cannot be reached as an error which Classify
+// recognises.
+func (c *Client) send(ctx context.Context, method, endpoint string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	u := c.baseURL
+	if c.APIVersion != "" {
+		u += "/v" + c.APIVersion
+	}
+
+	u += endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to the docker daemon at %s: %s", c.Host, err)
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+
+	var msg struct {
+		Message string `json:"message"`
+	}
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(data))
+	}
+
+	return nil, &apiError{StatusCode: resp.StatusCode, Message: msg.Message}
+}
+
+// call sends a request with a JSON body (unless in is nil), which may be
+// retried, and decodes the JSON response into out (unless it is nil).
+func (c *Client) call(name, method, endpoint string, query url.Values, in, out interface{}) error {
+	return c.callWith(c.Retry, name, method, endpoint, query, in, out)
+}
+
+// callWith is call, retrying as the policy allows. A nil policy makes a
+// single attempt.
+func (c *Client) callWith(policy *RetryPolicy, name, method, endpoint string, query url.Values, in, out interface{}) error {
+	return policy.do(c.Metrics, name, c.until, func() (string, error) {
+		return c.callOnce(name, func() error {
+			var body io.Reader
+			header := http.Header{}
+			if in != nil {
+				data, err := json.Marshal(in)
+				if err != nil {
+					return err
+				}
+
+				body = bytes.NewReader(data)
+				header.Set("Content-Type", "application/json")
+			}
+
+			ctx, cancel := c.context()
+			defer cancel()
+
+			resp, err := c.send(ctx, method, endpoint, query, body, header)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if out == nil || resp.StatusCode == http.StatusNotModified {
+				return nil
+			}
+
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("parse response: %s", err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// callOnce makes an attempt at a request, recording it in the metrics and
+// logging any failure. It returns the reason for a failure as well as the
+// failure, named.
+func (c *Client) callOnce(name string, attempt func() error) (string, error) {
+	start := time.Now()
+	err := attempt()
+
+	if c.Metrics != nil {
+		c.Metrics.Duration.Since(start, name)
+	}
+
+	if err == nil {
+		return "", nil
+	}
+
+	reason := Classify(err.Error())
+	if c.Metrics != nil {
+		c.Metrics.Failures.Inc(name, statusCode(err), reason)
+	}
+
+	if c.Logger != nil {
+		c.Logger.Session("docker-"+name).Error("failed", err)
+	}
+
+	return reason, newError(name, reason, err.Error())
+}
+
+// statusCode stands in for the exit code of a docker command in the metrics.
+func statusCode(err error) string {
+	if apiErr, ok := err.(*apiError); ok {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+
+	return "unknown"
+}
+
+type createContainer struct {
+	Image      string
+	Cmd        []string
+	Env        []string
+	Labels     map[string]string
+	HostConfig struct {
+		Binds          []string
+		Tmpfs          map[string]string `json:",omitempty"`
+		Privileged     bool
+		ReadonlyRootfs bool     `json:",omitempty"`
+		CapDrop        []string `json:",omitempty"`
+		CapAdd         []string `json:",omitempty"`
+		SecurityOpt    []string `json:",omitempty"`
+		UsernsMode     string   `json:",omitempty"`
+		NetworkMode    string   `json:",omitempty"`
+		CpuShares      int64
+		CpusetCpus     string
+	}
+	NetworkingConfig *networkingConfig `json:",omitempty"`
+}
+
+type networkingConfig struct {
+	EndpointsConfig map[string]endpointSettings
+}
+
+type endpointSettings struct {
+	IPAMConfig struct {
+		IPv4Address string `json:",omitempty"`
+		IPv6Address string `json:",omitempty"`
+	}
+}
+
+// Run creates and starts a container, pulling its image first if dockerd
+// does not have it, as docker run does. It returns the container's id.
+func (c *Client) Run(cmd RunCmd) (string, error) {
+	create := createContainer{
+		Image:  cmd.Image,
+		Cmd:    append([]string{cmd.Program}, cmd.ProgramArgs...),
+		Env:    cmd.Env,
+		Labels: cmd.Labels,
+	}
+
+	for _, v := range cmd.Volumes {
+		create.HostConfig.Binds = append(create.HostConfig.Binds, v.arg())
+	}
+
+	if len(cmd.Tmpfs) > 0 {
+		create.HostConfig.Tmpfs = make(map[string]string)
+		for _, t := range cmd.Tmpfs {
+			create.HostConfig.Tmpfs[t.ContainerPath] = ""
+			if t.SizeInBytes > 0 {
+				create.HostConfig.Tmpfs[t.ContainerPath] = fmt.Sprintf("size=%d", t.SizeInBytes)
+			}
+		}
+	}
+
+	create.HostConfig.Privileged = cmd.Privileged
+	create.HostConfig.ReadonlyRootfs = cmd.ReadOnly
+	create.HostConfig.CapDrop = cmd.CapDrop
+	create.HostConfig.CapAdd = cmd.CapAdd
+	create.HostConfig.SecurityOpt = cmd.SecurityOpt
+	if cmd.SeccompProfile != "" {
+		opt, err := seccompOpt(cmd.SeccompProfile)
+		if err != nil {
+			return "", fmt.Errorf("run: %s", err)
+		}
+
+		create.HostConfig.SecurityOpt = append(append([]string{}, cmd.SecurityOpt...), opt)
+	}
+	create.HostConfig.UsernsMode = cmd.UsernsMode
+	create.HostConfig.NetworkMode = cmd.Network
+	if cmd.IP != "" || cmd.IPv6 != "" {
+		var endpoint endpointSettings
+		endpoint.IPAMConfig.IPv4Address = cmd.IP
+		endpoint.IPAMConfig.IPv6Address = cmd.IPv6
+		create.NetworkingConfig = &networkingConfig{
+			EndpointsConfig: map[string]endpointSettings{cmd.Network: endpoint},
+		}
+	}
+	create.HostConfig.CpuShares = int64(cmd.CPUShares)
+	create.HostConfig.CpusetCpus = cmd.CPUSetCPUs
+
+	query := url.Values{}
+	if cmd.Name != "" {
+		query.Set("name", cmd.Name)
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := c.callWith(nil, "run", "POST", "/containers/create", query, create, &created)
+	if isNoSuchImage(err) {
+		if _, err := c.Pull(PullCmd{Image: cmd.Image}); err != nil {
+			return "", err
+		}
+
+		err = c.callWith(nil, "run", "POST", "/containers/create", query, create, &created)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.call("run", "POST", "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		return "", err
+	}
+
+	if !cmd.Detach {
+		if err := c.call("run", "POST", "/containers/"+created.ID+"/wait", nil, nil, nil); err != nil {
+			return "", err
+		}
+	}
+
+	return created.ID, nil
+}
+
+func isNoSuchImage(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "no such image")
+}
+
+func (c *Client) Inspect(cmd InspectCmd) (ContainerJSON, error) {
+	query := url.Values{}
+	if cmd.Size {
+		query.Set("size", "1")
+	}
+
+	var container ContainerJSON
+	err := c.call("inspect", "GET", "/containers/"+cmd.ContainerID+"/json", query, nil, &container)
+	return container, err
+}
+
+func (c *Client) ImageInspect(cmd ImageInspectCmd) (ImageJSON, error) {
+	var image ImageJSON
+	err := c.call("image-inspect", "GET", "/images/"+cmd.Image+"/json", nil, nil, &image)
+	return image, err
+}
+
+// Ps lists containers as docker ps does, with their names and labels
+// flattened in the same way.
+func (c *Client) Ps(cmd PsCmd) ([]PsEntry, error) {
+	query := url.Values{}
+	if cmd.All {
+		query.Set("all", "1")
+	}
+
+	if filters := apiFilters(cmd.Filters); filters != "" {
+		query.Set("filters", filters)
+	}
+
+	var containers []struct {
+		ID     string `json:"Id"`
+		Image  string
+		Names  []string
+		Status string
+		Labels map[string]string
+	}
+
+	if err := c.call("ps", "GET", "/containers/json", query, nil, &containers); err != nil {
+		return nil, err
+	}
+
+	var entries []PsEntry
+	for _, container := range containers {
+		var names []string
+		for _, name := range container.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+
+		var labels []string
+		for _, k := range sortedKeys(container.Labels) {
+			labels = append(labels, k+"="+container.Labels[k])
+		}
+
+		entries = append(entries, PsEntry{
+			ID:     container.ID,
+			Image:  container.Image,
+			Names:  strings.Join(names, ","),
+			Status: container.Status,
+			Labels: strings.Join(labels, ","),
+		})
+	}
+
+	return entries, nil
+}
+
+// apiFilters encodes filters given to the cli as key=value.
+func apiFilters(filters []string) string {
+	if len(filters) == 0 {
+		return ""
+	}
+
+	byKey := make(map[string][]string)
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) == 2 {
+			byKey[kv[0]] = append(byKey[kv[0]], kv[1])
+		}
+	}
+
+	data, _ := json.Marshal(byKey)
+	return string(data)
+}
+
+// Images lists images as docker images does, once for each tag.
+func (c *Client) Images(cmd ImagesCmd) ([]ImageEntry, error) {
+	query := url.Values{"digests": {"1"}}
+	if cmd.Repository != "" {
+		query.Set("filters", apiFilters([]string{"reference=" + cmd.Repository}))
+	}
+
+	var images []struct {
+		ID          string `json:"Id"`
+		RepoTags    []string
+		RepoDigests []string
+		Size        int64
+	}
+
+	if err := c.call("images", "GET", "/images/json", query, nil, &images); err != nil {
+		return nil, err
+	}
+
+	var entries []ImageEntry
+	for _, image := range images {
+		digests := make(map[string]string)
+		for _, rd := range image.RepoDigests {
+			if i := strings.Index(rd, "@"); i >= 0 {
+				digests[rd[:i]] = rd[i+1:]
+			}
+		}
+
+		var tags []string
+		for _, tag := range image.RepoTags {
+			if tag != "<none>:<none>" {
+				tags = append(tags, tag)
+			}
+		}
+
+		size := strconv.FormatInt(image.Size, 10) + "B"
+		if len(tags) == 0 {
+			entries = append(entries, ImageEntry{ID: image.ID, Repository: "<none>", Tag: "<none>", Size: size})
+			continue
+		}
+
+		for _, ref := range tags {
+			repository, tag := splitTag(ref)
+			entries = append(entries, ImageEntry{
+				ID:         image.ID,
+				Repository: repository,
+				Tag:        tag,
+				Digest:     digests[repository],
+				Size:       size,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// splitTag splits an image reference into its repository and its tag or
+// digest. A colon before the last slash separates a registry's port.
+func splitTag(ref string) (string, string) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+
+	return ref, ""
+}
+
+func (c *Client) Rm(cmd RmCmd) (string, error) {
+	query := url.Values{}
+	if cmd.Force {
+		query.Set("force", "1")
+	}
+
+	return "", c.call("rm", "DELETE", "/containers/"+cmd.ContainerID, query, nil, nil)
+}
+
+func (c *Client) Rmi(cmd RmiCmd) (string, error) {
+	return "", c.call("rmi", "DELETE", "/images/"+cmd.Image, nil, nil, nil)
+}
+
+func (c *Client) Tag(cmd TagCmd) (string, error) {
+	repository, tag := splitTag(cmd.Target)
+	query := url.Values{"repo": {repository}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+
+	return "", c.call("tag", "POST", "/images/"+cmd.Source+"/tag", query, nil, nil)
+}
+
+func (c *Client) RegistryConfig(cmd RegistryConfigCmd) (RegistryConfig, error) {
+	var info struct {
+		RegistryConfig RegistryConfig
+	}
+
+	err := c.call("info", "GET", "/info", nil, nil, &info)
+	return info.RegistryConfig, err
+}
+
+func (c *Client) Start(cmd StartCmd) (string, error) {
+	return "", c.call("start", "POST", "/containers/"+cmd.ContainerID+"/start", nil, nil, nil)
+}
+
+func (c *Client) Stop(cmd StopCmd) (string, error) {
+	query := url.Values{}
+	if cmd.Timeout > 0 {
+		query.Set("t", strconv.Itoa(int(cmd.Timeout/time.Second)))
+	}
+
+	return "", c.call("stop", "POST", "/containers/"+cmd.ContainerID+"/stop", query, nil, nil)
+}
+
+func (c *Client) Update(cmd UpdateCmd) (string, error) {
+	update := map[string]int64{}
+	if cmd.MemoryInBytes > 0 {
+		update["Memory"] = int64(cmd.MemoryInBytes)
+		update["MemorySwap"] = int64(cmd.MemoryInBytes)
+	}
+
+	if cmd.CPUShares > 0 {
+		update["CpuShares"] = int64(cmd.CPUShares)
+	}
+
+	return "", c.call("update", "POST", "/containers/"+cmd.ContainerID+"/update", nil, update, nil)
+}
+
+// seccompOpt returns the security option for a seccomp profile. The docker
+// cli reads a profile file itself, so the API takes the profile's contents.
+func seccompOpt(profile string) (string, error) {
+	if profile == "unconfined" {
+		return "seccomp=unconfined", nil
+	}
+
+	contents, err := ioutil.ReadFile(profile)
+	if err != nil {
+		return "", fmt.Errorf("read seccomp profile: %s", err)
+	}
+
+	return "seccomp=" + string(contents), nil
+}
+
+// pullProgress is one of the messages dockerd streams while pulling.
+type pullProgress struct {
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	Progress string `json:"progress"`
+	Error    string `json:"error"`
+
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+	} `json:"progressDetail"`
+}
+
+// Pull pulls an image, logging its progress as dockerd reports it. With a
+// ConfigDir, it uses the credentials a Login saved there for the image's
+// registry.
+func (c *Client) Pull(cmd PullCmd) (string, error) {
+	repository, tag := splitTag(cmd.Image)
+	if tag == "" {
+		tag = "latest"
+	}
+
+	query := url.Values{"fromImage": {repository}, "tag": {tag}}
+
+	header := http.Header{}
+	if cmd.ConfigDir != "" {
+		auth, err := savedAuth(cmd.ConfigDir, registryOf(repository))
+		if err != nil {
+			return "", fmt.Errorf("pull: %s", err)
+		}
+
+		if auth != "" {
+			header.Set("X-Registry-Auth", auth)
+		}
+	}
+
+	var log lager.Logger
+	if c.Logger != nil {
+		log = c.Logger.Session("docker-pull", lager.Data{"image": cmd.Image})
+	}
+
+	var status string
+	err := c.Retry.do(c.Metrics, "pull", c.until, func() (string, error) {
+		return c.callOnce("pull", func() error {
+			ctx, cancel := c.context()
+			defer cancel()
+
+			resp, err := c.send(ctx, "POST", "/images/create", query, nil, header)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			downloaded := map[string]int64{}
+			defer c.countPulled(downloaded)
+
+			// failures part way are reported in the stream, after the
+			// response has succeeded
+			decoder := json.NewDecoder(resp.Body)
+			for {
+				var progress pullProgress
+				if err := decoder.Decode(&progress); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return fmt.Errorf("parse progress: %s", err)
+				}
+
+				if progress.Error != "" {
+					return &apiError{StatusCode: resp.StatusCode, Message: progress.Error}
+				}
+
+				if progress.Status == "Downloading" {
+					downloaded[progress.ID] = progress.ProgressDetail.Current
+				}
+
+				status = progress.Status
+				if log != nil {
+					log.Debug("progress", lager.Data{"status": progress.Status, "layer": progress.ID, "progress": progress.Progress})
+				}
+			}
+		})
+	})
+
+	return status, err
+}
+
+// countPulled adds the bytes downloaded for each layer of a pull, as last
+// reported, to the PullBytes metric.
+func (c *Client) countPulled(downloaded map[string]int64) {
+	if c.Metrics == nil || c.Metrics.PullBytes == nil {
+		return
+	}
+
+	var total int64
+	for _, n := range downloaded {
+		total += n
+	}
+
+	c.Metrics.PullBytes.Add(float64(total))
+}
+
+// registryOf returns the registry host an image repository is on, or "" for
+// docker hub.
+func registryOf(repository string) string {
+	i := strings.Index(repository, "/")
+	if i < 0 {
+		return ""
+	}
+
+	host := repository[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return ""
+	}
+
+	return host
+}
+
+// hubAuthKey is the key docker keeps docker hub credentials under.
+const hubAuthKey = "https://index.docker.io/v1/"
+
+// configFile is the part of a docker client config.json which holds
+// credentials, by registry.
+type configFile struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// Login checks the credentials with the registry, through dockerd, and then
+// saves them in ConfigDir's config.json as docker login does, for a Pull
+// given the same ConfigDir.
+func (c *Client) Login(cmd LoginCmd) (string, error) {
+	server := cmd.Registry
+	if server == "" {
+		server = hubAuthKey
+	}
+
+	auth := map[string]string{
+		"username":      cmd.Username,
+		"password":      cmd.Password,
+		"serveraddress": server,
+	}
+
+	if err := c.call("login", "POST", "/auth", nil, auth, nil); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(cmd.ConfigDir, 0700); err != nil {
+		return "", fmt.Errorf("login: %s", err)
+	}
+
+	config := map[string]interface{}{
+		"auths": map[string]interface{}{
+			server: map[string]string{
+				"auth": base64.StdEncoding.EncodeToString([]byte(cmd.Username + ":" + cmd.Password)),
+			},
+		},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("login: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cmd.ConfigDir, "config.json"), data, 0600); err != nil {
+		return "", fmt.Errorf("login: %s", err)
+	}
+
+	return "Login Succeeded", nil
+}
+
+// savedAuth returns the X-Registry-Auth header for the credentials saved in
+// a config directory for a registry, if there are any.
+func savedAuth(configDir, registry string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var config configFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("parse %s: %s", filepath.Join(configDir, "config.json"), err)
+	}
+
+	key := registry
+	if key == "" {
+		key = hubAuthKey
+	}
+
+	saved, ok := config.Auths[key]
+	if !ok {
+		return "", nil
+	}
+
+	userpass, err := base64.StdEncoding.DecodeString(saved.Auth)
+	if err != nil {
+		return "", fmt.Errorf("parse credentials for %s: %s", key, err)
+	}
+
+	parts := strings.SplitN(string(userpass), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("parse credentials for %s: no password", key)
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"username":      parts[0],
+		"password":      parts[1],
+		"serveraddress": key,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(header), nil
+}
+
+// Cp copies a file from the host into a container. Unlike docker cp, it
+// cannot copy directories, or out of a container; CpOut can do that.
+func (c *Client) Cp(cmd CpCmd) (string, error) {
+	if isContainerPath(cmd.Src) || !isContainerPath(cmd.Dst) {
+		return "", fmt.Errorf("cp: only copying a file into a container is supported")
+	}
+
+	containerID, dst := splitContainerPath(cmd.Dst)
+
+	data, err := tarFile(cmd.Src, path.Base(dst))
+	if err != nil {
+		return "", fmt.Errorf("cp: %s", err)
+	}
+
+	return "", c.Retry.do(c.Metrics, "cp", c.until, func() (string, error) {
+		return c.callOnce("cp", func() error {
+			return c.putArchive(containerID, path.Dir(dst), cmd.Archive, bytes.NewReader(data))
+		})
+	})
+}
+
+// CpIn extracts a tar into a directory in a container, for a CpCmd with a
+// Src of "-". The tar cannot be replayed, so it is never retried.
+func (c *Client) CpIn(cmd CpCmd, tar io.Reader) error {
+	containerID, dst := splitContainerPath(cmd.Dst)
+
+	_, err := c.callOnce("cp", func() error {
+		return c.putArchive(containerID, dst, cmd.Archive, tar)
+	})
+
+	return err
+}
+
+func (c *Client) putArchive(containerID, dir string, archive bool, tar io.Reader) error {
+	query := url.Values{"path": {dir}}
+	if archive {
+		query.Set("copyUIDGID", "1")
+	}
+
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	resp, err := c.send(context.Background(), "PUT", "/containers/"+containerID+"/archive", query, tar, header)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+// CpOut returns a tar of a path in a container, for a CpCmd with a Dst of
+// "-", as dockerd produces it. Closing it early ends the request.
+func (c *Client) CpOut(cmd CpCmd) (io.ReadCloser, error) {
+	containerID, src := splitContainerPath(cmd.Src)
+
+	var resp *http.Response
+	if _, err := c.callOnce("cp", func() error {
+		var err error
+		resp, err = c.send(context.Background(), "GET", "/containers/"+containerID+"/archive", url.Values{"path": {src}}, nil, nil)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// isContainerPath reports whether a cp argument names a path in a container,
+// as <container>:<path>, by the same rule as docker cp.
+func isContainerPath(arg string) bool {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return false
+	}
+
+	return strings.Contains(arg, ":")
+}
+
+func splitContainerPath(arg string) (string, string) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 {
+		return arg, ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// tarFile makes a tar holding a single file, under the given name.
+func tarFile(src, name string) ([]byte, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", src)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+
+	header.Name = name
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	if err := w.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(w, f); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Exec runs a program in a container. Unless it is detached, it waits for
+// the program to exit and returns its stdout, failing if it exits non-zero.
+func (c *Client) Exec(cmd ExecCmd) (string, error) {
+	create := map[string]interface{}{
+		"Cmd":          append([]string{cmd.Program}, cmd.ProgramArgs...),
+		"AttachStdout": !cmd.Detach,
+		"AttachStderr": !cmd.Detach,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call("exec", "POST", "/containers/"+cmd.ContainerID+"/exec", nil, create, &created); err != nil {
+		return "", err
+	}
+
+	if cmd.Detach {
+		return "", c.call("exec", "POST", "/exec/"+created.ID+"/start", nil, map[string]bool{"Detach": true}, nil)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if _, err := c.callOnce("exec", func() error {
+		body, _ := json.Marshal(map[string]bool{"Detach": false})
+		header := http.Header{"Content-Type": {"application/json"}}
+
+		resp, err := c.send(context.Background(), "POST", "/exec/"+created.ID+"/start", nil, bytes.NewReader(body), header)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		return demux(resp.Body, &stdout, &stderr)
+	}); err != nil {
+		return "", err
+	}
+
+	var inspect struct{ ExitCode int }
+	if err := c.call("exec", "GET", "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return "", err
+	}
+
+	if inspect.ExitCode != 0 {
+		return "", fmt.Errorf("exec: exit status %d: %s", inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// Logs streams a container's logs to stdout and stderr as dockerd produces
+// them, and is never retried. Closing stop ends the request, which is the
+// only way a followed log ends while the container is running.
+func (c *Client) Logs(cmd LogsCmd, stdout, stderr io.Writer, stop <-chan struct{}) error {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if cmd.Follow {
+		query.Set("follow", "1")
+	}
+
+	if cmd.Tail != "" {
+		query.Set("tail", cmd.Tail)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := c.send(ctx, "GET", "/containers/"+cmd.ContainerID+"/logs", query, nil, nil)
+	if err != nil {
+		return newError("logs", Classify(err.Error()), err.Error())
+	}
+	defer resp.Body.Close()
+
+	if err := demux(resp.Body, stdout, stderr); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("logs: %s", err)
+	}
+
+	return nil
+}
+
+// demux copies a stream onto which dockerd multiplexes a process's stdout
+// and stderr, in frames which each start with an 8 byte header giving the
+// stream (1 or 2) and, in its last 4 bytes, the length of the frame.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
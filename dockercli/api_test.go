@@ -0,0 +1,417 @@
+package dockercli_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Docker Engine API Client", func() {
+	var server *ghttp.Server
+	var client *Client
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		client = &Client{Host: "tcp://" + server.Addr()}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	frame := func(stream byte, data string) []byte {
+		header := make([]byte, 8)
+		header[0] = stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		return append(header, data...)
+	}
+
+	Describe("Run", func() {
+		It("creates and starts the container, returning its id", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/containers/create", "name=some-container"),
+					ghttp.VerifyJSON(`{
+						"Image": "busybox",
+						"Cmd": ["/proc/self/exe", "--some-arg"],
+						"Env": ["A=B"],
+						"Labels": {"some": "label"},
+						"HostConfig": {
+							"Binds": ["/host:/container"],
+							"Tmpfs": {"/tmp": "size=1024"},
+							"Privileged": false,
+							"ReadonlyRootfs": true,
+							"CapDrop": ["ALL"],
+							"CapAdd": ["CHOWN"],
+							"SecurityOpt": ["no-new-privileges"],
+							"NetworkMode": "none",
+							"CpuShares": 512,
+							"CpusetCpus": "0-3"
+						}
+					}`),
+					ghttp.RespondWith(http.StatusCreated, `{"Id":"abc123"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/containers/abc123/start"),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			id, err := client.Run(RunCmd{
+				Name:        "some-container",
+				Image:       "busybox",
+				Env:         []string{"A=B"},
+				Labels:      map[string]string{"some": "label"},
+				Volumes:     []Volume{{HostPath: "/host", ContainerPath: "/container"}},
+				Tmpfs:       []Tmpfs{{ContainerPath: "/tmp", SizeInBytes: 1024}},
+				Program:     "/proc/self/exe",
+				ProgramArgs: []string{"--some-arg"},
+				Detach:      true,
+				ReadOnly:    true,
+				CPUShares:   512,
+				CPUSetCPUs:  "0-3",
+				CapDrop:     []string{"ALL"},
+				CapAdd:      []string{"CHOWN"},
+				SecurityOpt: []string{"no-new-privileges"},
+				Network:     "none",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("abc123"))
+		})
+
+		It("does not retry creating the container, which dockerd may have done", func() {
+			client.Retry = &RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Deadline: time.Second}
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusServiceUnavailable, `{"message":"daemon is restarting"}`),
+			)
+
+			_, err := client.Run(RunCmd{Image: "busybox"})
+			Expect(err).To(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("asks for the container's IP on its network", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/containers/create"),
+					func(w http.ResponseWriter, r *http.Request) {
+						var create struct {
+							HostConfig       struct{ NetworkMode string }
+							NetworkingConfig struct {
+								EndpointsConfig map[string]struct {
+									IPAMConfig struct{ IPv4Address, IPv6Address string }
+								}
+							}
+						}
+						Expect(json.NewDecoder(r.Body).Decode(&create)).To(Succeed())
+						Expect(create.HostConfig.NetworkMode).To(Equal("garden"))
+						Expect(create.NetworkingConfig.EndpointsConfig["garden"].IPAMConfig.IPv4Address).To(Equal("10.254.0.2"))
+						Expect(create.NetworkingConfig.EndpointsConfig["garden"].IPAMConfig.IPv6Address).To(Equal("fd00:254::2"))
+					},
+					ghttp.RespondWith(http.StatusCreated, `{"Id":"abc123"}`),
+				),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			)
+
+			_, err := client.Run(RunCmd{
+				Image:   "busybox",
+				Program: "sh",
+				Detach:  true,
+				Network: "garden",
+				IP:      "10.254.0.2",
+				IPv6:    "fd00:254::2",
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("sends the contents of a seccomp profile, since dockerd cannot read the file", func() {
+			profile, err := ioutil.TempFile("", "seccomp")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(profile.Name())
+			profile.WriteString(`{"defaultAction":"SCMP_ACT_ERRNO"}`)
+			profile.Close()
+
+			var create struct {
+				HostConfig struct{ SecurityOpt []string }
+			}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/containers/create"),
+					func(w http.ResponseWriter, r *http.Request) {
+						json.NewDecoder(r.Body).Decode(&create)
+					},
+					ghttp.RespondWith(http.StatusCreated, `{"Id":"abc123"}`),
+				),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			)
+
+			_, err = client.Run(RunCmd{
+				Image:          "busybox",
+				Program:        "sh",
+				Detach:         true,
+				SecurityOpt:    []string{"no-new-privileges"},
+				SeccompProfile: profile.Name(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(create.HostConfig.SecurityOpt).To(Equal([]string{
+				"no-new-privileges",
+				`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`,
+			}))
+		})
+
+		Context("when dockerd does not have the image", func() {
+			It("pulls it and creates the container again", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusNotFound, `{"message":"No such image: busybox:latest"}`),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/images/create", "fromImage=busybox&tag=latest"),
+						ghttp.RespondWith(http.StatusOK, `{"status":"Pulling from library/busybox"}`),
+					),
+					ghttp.RespondWith(http.StatusCreated, `{"Id":"abc123"}`),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				)
+
+				id, err := client.Run(RunCmd{Image: "busybox", Program: "sh", Detach: true})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(id).To(Equal("abc123"))
+				Expect(server.ReceivedRequests()).To(HaveLen(4))
+			})
+		})
+	})
+
+	Describe("Ps", func() {
+		It("flattens names and labels as docker ps prints them", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/containers/json", `all=1&filters={"label":["a=b"]}`),
+				ghttp.RespondWith(http.StatusOK, `[{"Id":"abc123","Image":"busybox","Names":["/some-container"],"Status":"Up 2 minutes","Labels":{"b":"2","a":"1"}}]`),
+			))
+
+			entries, err := client.Ps(PsCmd{All: true, Filters: []string{"label=a=b"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]PsEntry{{
+				ID:     "abc123",
+				Image:  "busybox",
+				Names:  "some-container",
+				Status: "Up 2 minutes",
+				Labels: "a=1,b=2",
+			}}))
+		})
+	})
+
+	Describe("Pull", func() {
+		It("fails when dockerd reports an error part way through", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, `{"status":"Pulling fs layer","id":"a1"}
+{"error":"unexpected EOF"}`))
+
+			_, err := client.Pull(PullCmd{Image: "busybox"})
+			Expect(err).To(MatchError("pull: unexpected EOF"))
+		})
+
+		It("counts the bytes downloaded for each layer", func() {
+			client.Metrics = NewMetrics(metrics.NewRegistry())
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, `{"status":"Pulling fs layer","id":"a1"}
+{"status":"Downloading","id":"a1","progressDetail":{"current":100,"total":300}}
+{"status":"Downloading","id":"b2","progressDetail":{"current":50,"total":50}}
+{"status":"Downloading","id":"a1","progressDetail":{"current":300,"total":300}}
+{"status":"Download complete","id":"a1"}`))
+
+			_, err := client.Pull(PullCmd{Image: "busybox"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Metrics.PullBytes.Value()).To(BeEquivalentTo(350))
+		})
+
+		It("pulls with the credentials saved by Login in the same config directory", func() {
+			configDir, err := ioutil.TempDir("", "docker-config")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(configDir)
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/auth"),
+					ghttp.VerifyJSON(`{"username":"user","password":"secret","serveraddress":"registry.example.com"}`),
+					ghttp.RespondWith(http.StatusOK, `{"Status":"Login Succeeded"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/images/create", "fromImage=registry.example.com/some-image&tag=1.0"),
+					func(w http.ResponseWriter, req *http.Request) {
+						auth, err := base64.URLEncoding.DecodeString(req.Header.Get("X-Registry-Auth"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(auth).To(MatchJSON(`{"username":"user","password":"secret","serveraddress":"registry.example.com"}`))
+					},
+				),
+			)
+
+			_, err = client.Login(LoginCmd{ConfigDir: configDir, Registry: "registry.example.com", Username: "user", Password: "secret"})
+			Expect(err).NotTo(HaveOccurred())
+
+			info, err := os.Stat(filepath.Join(configDir, "config.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			_, err = client.Pull(PullCmd{Image: "registry.example.com/some-image:1.0", ConfigDir: configDir})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("with a RetryPolicy", func() {
+			It("retries a pull the registry failed transiently", func() {
+				client.Retry = &RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Deadline: time.Second}
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusInternalServerError, `{"message":"received unexpected HTTP status: 503 Service Unavailable"}`),
+					ghttp.RespondWith(http.StatusOK, `{"status":"Downloaded newer image for busybox:latest"}`),
+				)
+
+				status, err := client.Pull(PullCmd{Image: "busybox"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status).To(Equal("Downloaded newer image for busybox:latest"))
+				Expect(server.ReceivedRequests()).To(HaveLen(2))
+			})
+
+			It("stops retrying at the deadline of an Until copy", func() {
+				client.Retry = &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Deadline: time.Second}
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusInternalServerError, `{"message":"received unexpected HTTP status: 503 Service Unavailable"}`),
+				)
+
+				_, err := client.Until(time.Now().Add(50 * time.Millisecond)).Pull(PullCmd{Image: "busybox"})
+				Expect(err).To(HaveOccurred())
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("Exec", func() {
+		It("returns the program's stdout", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/containers/abc123/exec"),
+					ghttp.RespondWith(http.StatusCreated, `{"Id":"exec1"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/exec/exec1/start"),
+					ghttp.RespondWith(http.StatusOK, append(frame(1, "hello\n"), frame(2, "warning\n")...)),
+				),
+				ghttp.RespondWith(http.StatusOK, `{"ExitCode":0}`),
+			)
+
+			out, err := client.Exec(ExecCmd{ContainerID: "abc123", Program: "echo", ProgramArgs: []string{"hello"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("hello"))
+		})
+
+		It("fails with the program's stderr when it exits non-zero", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusCreated, `{"Id":"exec1"}`),
+				ghttp.RespondWith(http.StatusOK, frame(2, "no such file\n")),
+				ghttp.RespondWith(http.StatusOK, `{"ExitCode":2}`),
+			)
+
+			_, err := client.Exec(ExecCmd{ContainerID: "abc123", Program: "cat"})
+			Expect(err).To(MatchError("exec: exit status 2: no such file"))
+		})
+	})
+
+	Describe("Logs", func() {
+		It("separates stdout from stderr", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/containers/abc123/logs", "stdout=1&stderr=1&tail=10"),
+				ghttp.RespondWith(http.StatusOK, append(frame(1, "out\n"), frame(2, "err\n")...)),
+			))
+
+			var stdout, stderr bytes.Buffer
+			Expect(client.Logs(LogsCmd{ContainerID: "abc123", Tail: "10"}, &stdout, &stderr, nil)).To(Succeed())
+			Expect(stdout.String()).To(Equal("out\n"))
+			Expect(stderr.String()).To(Equal("err\n"))
+		})
+	})
+
+	Describe("errors", func() {
+		It("returns dockerd's message", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, `{"message":"No such container: abc123"}`))
+
+			_, err := client.Inspect(InspectCmd{ContainerID: "abc123"})
+			Expect(err).To(MatchError("inspect: No such container: abc123"))
+			Expect(Classify(err.Error())).To(Equal("no_such_container"))
+		})
+
+		It("returns an ImageNotFoundError for an image the registry does not have", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, `{"message":"manifest for busybox:nope not found: manifest unknown"}`))
+
+			_, err := client.Pull(PullCmd{Image: "busybox:nope"})
+			Expect(err).To(BeAssignableToTypeOf(ImageNotFoundError{}))
+			Expect(err).To(MatchError("image not found: pull: manifest for busybox:nope not found: manifest unknown"))
+		})
+
+		It("leaves other things docker did not find untyped", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, `{"message":"Could not find the file /nope in container abc123: not found"}`))
+
+			_, err := client.CpOut(CpCmd{Src: "abc123:/nope", Dst: "-"})
+			Expect(err).To(BeAssignableToTypeOf(&Error{}))
+		})
+
+		It("classifies a dockerd which cannot be reached as unavailable", func() {
+			client = &Client{Host: "unix:///does/not/exist.sock"}
+
+			_, err := client.Inspect(InspectCmd{ContainerID: "abc123"})
+			Expect(err).To(BeAssignableToTypeOf(DaemonDownError{}))
+			Expect(Classify(err.Error())).To(Equal("daemon_unavailable"))
+		})
+	})
+
+	Context("with a TLSConfig", func() {
+		It("talks to dockerd over https", func() {
+			tlsServer := ghttp.NewTLSServer()
+			defer tlsServer.Close()
+
+			tlsServer.AppendHandlers(ghttp.RespondWith(http.StatusOK, `{"Id":"sha256:abc"}`))
+
+			client = &Client{
+				Host:      "tcp://" + tlsServer.Addr(),
+				TLSConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+
+			image, err := client.ImageInspect(ImageInspectCmd{Image: "busybox"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(image.ID).To(Equal("sha256:abc"))
+		})
+	})
+
+	Describe("TLSFiles", func() {
+		It("requires a certificate and its key together", func() {
+			_, err := TLSFiles{Cert: "/certs/cert.pem"}.Config()
+			Expect(err).To(MatchError("docker tls: a certificate and its key must be given together"))
+		})
+
+		It("fails when the ca cannot be read", func() {
+			_, err := TLSFiles{CACert: "/does/not/exist.pem"}.Config()
+			Expect(err).To(MatchError(ContainSubstring("docker tls: load ca")))
+		})
+	})
+
+	Context("with an APIVersion", func() {
+		It("prefixes every request with it", func() {
+			client.APIVersion = "1.41"
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1.41/images/busybox/json"),
+				ghttp.RespondWith(http.StatusOK, `{"Id":"sha256:abc","Architecture":"amd64"}`),
+			))
+
+			image, err := client.ImageInspect(ImageInspectCmd{Image: "busybox"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(image.Architecture).To(Equal("amd64"))
+		})
+	})
+})
@@ -3,15 +3,58 @@ package dockercli
 import (
 	"fmt"
 	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type RunCmd struct {
+	Name    string
 	Volumes []Volume
+	Tmpfs   []Tmpfs
+	Labels  map[string]string
+	Env     []string
 	Image   string
 
 	Program     string
 	ProgramArgs []string
 	Detach      bool
+	Privileged  bool
+
+	// ReadOnly mounts the container's rootfs read-only, so that only its
+	// volumes and tmpfs mounts may be written to.
+	ReadOnly bool
+
+	// CPUShares and CPUSetCPUs, if set, are the container's initial cpu
+	// weight and the cpus it may run on (e.g. "0-3" or "1,3").
+	CPUShares  uint64
+	CPUSetCPUs string
+
+	// CapDrop and CapAdd are the capabilities taken away from and given to
+	// the container, dropped first, and SecurityOpt its security options
+	// (e.g. "no-new-privileges").
+	CapDrop     []string
+	CapAdd      []string
+	SecurityOpt []string
+
+	// SeccompProfile, if set, is the path of the seccomp profile to run the
+	// container with, or "unconfined" for none.
+	SeccompProfile string
+
+	// UsernsMode, if set, is the container's user namespace mode: "host"
+	// opts it out of the user namespace a dockerd run with --userns-remap
+	// would otherwise put it in.
+	UsernsMode string
+
+	// Network, if set, is the docker network the container is connected
+	// to, or "none" to give it only a loopback interface.
+	Network string
+
+	// IP and IPv6, if set, are the addresses the container is given on
+	// Network, which must be a user-defined network.
+	IP   string
+	IPv6 string
 }
 
 type Volume struct {
@@ -19,6 +62,13 @@ type Volume struct {
 	ContainerPath string
 }
 
+// Tmpfs is a memory-backed filesystem mounted in a container, capped at
+// SizeInBytes (or docker's default of half the host's memory if zero).
+type Tmpfs struct {
+	ContainerPath string
+	SizeInBytes   uint64
+}
+
 func (cmd *RunCmd) Cmd() *exec.Cmd {
 	program := append([]string{cmd.Program}, cmd.ProgramArgs...)
 	volumes := []string{}
@@ -26,7 +76,76 @@ func (cmd *RunCmd) Cmd() *exec.Cmd {
 		volumes = append(volumes, "-v", v.arg())
 	}
 
-	args := append(append(volumes, cmd.Image), program...)
+	for _, t := range cmd.Tmpfs {
+		volumes = append(volumes, "--tmpfs", t.arg())
+	}
+
+	labels := []string{}
+	for _, k := range sortedKeys(cmd.Labels) {
+		labels = append(labels, "--label", k+"="+cmd.Labels[k])
+	}
+
+	env := []string{}
+	for _, e := range cmd.Env {
+		env = append(env, "-e", e)
+	}
+
+	args := append(append(append(append(volumes, labels...), env...), cmd.Image), program...)
+
+	if cmd.CPUSetCPUs != "" {
+		args = append([]string{"--cpuset-cpus", cmd.CPUSetCPUs}, args...)
+	}
+
+	if cmd.CPUShares > 0 {
+		args = append([]string{"--cpu-shares", strconv.FormatUint(cmd.CPUShares, 10)}, args...)
+	}
+
+	security := []string{}
+	for _, c := range cmd.CapDrop {
+		security = append(security, "--cap-drop", c)
+	}
+
+	for _, c := range cmd.CapAdd {
+		security = append(security, "--cap-add", c)
+	}
+
+	for _, o := range cmd.SecurityOpt {
+		security = append(security, "--security-opt", o)
+	}
+
+	if cmd.SeccompProfile != "" {
+		security = append(security, "--security-opt", "seccomp="+cmd.SeccompProfile)
+	}
+
+	args = append(security, args...)
+
+	if cmd.UsernsMode != "" {
+		args = append([]string{"--userns", cmd.UsernsMode}, args...)
+	}
+
+	if cmd.IPv6 != "" {
+		args = append([]string{"--ip6", cmd.IPv6}, args...)
+	}
+
+	if cmd.IP != "" {
+		args = append([]string{"--ip", cmd.IP}, args...)
+	}
+
+	if cmd.Network != "" {
+		args = append([]string{"--network", cmd.Network}, args...)
+	}
+
+	if cmd.ReadOnly {
+		args = append([]string{"--read-only"}, args...)
+	}
+
+	if cmd.Privileged {
+		args = append([]string{"--privileged"}, args...)
+	}
+
+	if cmd.Name != "" {
+		args = append([]string{"--name", cmd.Name}, args...)
+	}
 
 	if cmd.Detach {
 		args = append([]string{"-d"}, args...)
@@ -35,15 +154,275 @@ func (cmd *RunCmd) Cmd() *exec.Cmd {
 	return exec.Command("docker", append([]string{"run"}, args...)...)
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (t Tmpfs) arg() string {
+	if t.SizeInBytes == 0 {
+		return t.ContainerPath
+	}
+
+	return fmt.Sprintf("%s:size=%d", t.ContainerPath, t.SizeInBytes)
+}
+
 func (v Volume) arg() string {
 	return fmt.Sprintf("%s:%s", v.HostPath, v.ContainerPath)
 }
 
 type InspectCmd struct {
 	ContainerID string
-	Field       string
+
+	// Size asks docker to fill in the SizeRw and SizeRootFs of the
+	// container, which means walking its writable layer.
+	Size bool
 }
 
 func (cmd *InspectCmd) Cmd() *exec.Cmd {
-	return exec.Command("docker", "inspect", fmt.Sprintf("--format='{{.%s}}'", cmd.Field), cmd.ContainerID)
+	args := []string{"inspect"}
+	if cmd.Size {
+		args = append(args, "--size")
+	}
+
+	return exec.Command("docker", append(args, "--format", "{{json .}}", cmd.ContainerID)...)
+}
+
+type PsCmd struct {
+	All     bool
+	Filters []string
+}
+
+func (cmd *PsCmd) Cmd() *exec.Cmd {
+	args := []string{"ps", "--no-trunc", "--format", "{{json .}}"}
+	if cmd.All {
+		args = append(args, "-a")
+	}
+
+	for _, f := range cmd.Filters {
+		args = append(args, "--filter", f)
+	}
+
+	return exec.Command("docker", args...)
+}
+
+type ImageInspectCmd struct {
+	Image string
+}
+
+func (cmd *ImageInspectCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", "image", "inspect", "--format", "{{json .}}", cmd.Image)
+}
+
+type ImagesCmd struct {
+	Repository string
+}
+
+func (cmd *ImagesCmd) Cmd() *exec.Cmd {
+	args := []string{"images", "--no-trunc", "--digests", "--format", "{{json .}}"}
+	if cmd.Repository != "" {
+		args = append(args, cmd.Repository)
+	}
+
+	return exec.Command("docker", args...)
+}
+
+type RmCmd struct {
+	ContainerID string
+	Force       bool
+}
+
+func (cmd *RmCmd) Cmd() *exec.Cmd {
+	args := []string{"rm"}
+	if cmd.Force {
+		args = append(args, "-f")
+	}
+
+	return exec.Command("docker", append(args, cmd.ContainerID)...)
+}
+
+// RmiCmd removes an image reference, and the image itself once no reference
+// to it is left. It is never forced, so docker refuses to remove an image any
+// container uses.
+type RmiCmd struct {
+	Image string
+}
+
+func (cmd *RmiCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", "rmi", cmd.Image)
+}
+
+// TagCmd gives the Source image another reference, Target.
+type TagCmd struct {
+	Source string
+	Target string
+}
+
+func (cmd *TagCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", "tag", cmd.Source, cmd.Target)
+}
+
+// RegistryConfigCmd prints how dockerd is configured to talk to registries.
+type RegistryConfigCmd struct{}
+
+func (cmd *RegistryConfigCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", "info", "--format", "{{json .RegistryConfig}}")
+}
+
+type PullCmd struct {
+	Image string
+
+	// ConfigDir, if set, is the docker client config directory to pull
+	// with, for example one holding credentials from a LoginCmd.
+	ConfigDir string
+}
+
+func (cmd *PullCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", append(configArgs(cmd.ConfigDir), "pull", cmd.Image)...)
+}
+
+// LoginCmd logs in to a registry, keeping the credentials in ConfigDir
+// rather than the docker client's default config so that they are seen only
+// by commands given the same ConfigDir. The password is passed on stdin so
+// that it does not appear in the process table or in logged arguments.
+type LoginCmd struct {
+	ConfigDir string
+	Registry  string
+	Username  string
+	Password  string
+}
+
+func (cmd *LoginCmd) Cmd() *exec.Cmd {
+	args := append(configArgs(cmd.ConfigDir), "login", "--username", cmd.Username, "--password-stdin")
+	if cmd.Registry != "" {
+		args = append(args, cmd.Registry)
+	}
+
+	c := exec.Command("docker", args...)
+	c.Stdin = strings.NewReader(cmd.Password)
+	return c
+}
+
+func configArgs(dir string) []string {
+	if dir == "" {
+		return []string{}
+	}
+
+	return []string{"--config", dir}
+}
+
+// LogsCmd prints the output docker has captured from a container's main
+// process.
+type LogsCmd struct {
+	ContainerID string
+	Follow      bool
+
+	// Tail, if set, is the number of lines to show from the end of the
+	// logs, or "all".
+	Tail string
+}
+
+func (cmd *LogsCmd) Cmd() *exec.Cmd {
+	args := []string{"logs"}
+	if cmd.Follow {
+		args = append(args, "--follow")
+	}
+
+	if cmd.Tail != "" {
+		args = append(args, "--tail", cmd.Tail)
+	}
+
+	return exec.Command("docker", append(args, cmd.ContainerID)...)
+}
+
+// CpCmd copies a file between the host and a container. Either Src or Dst
+// may name a path in a container as <container>:<path>. A Src or Dst of "-"
+// means a tar on stdin or stdout. Archive keeps the uid and gid of the
+// copied files rather than giving them to root.
+type CpCmd struct {
+	Src     string
+	Dst     string
+	Archive bool
+}
+
+func (cmd *CpCmd) Cmd() *exec.Cmd {
+	args := []string{"cp"}
+	if cmd.Archive {
+		args = append(args, "-a")
+	}
+
+	return exec.Command("docker", append(args, cmd.Src, cmd.Dst)...)
+}
+
+// ExecCmd runs a program in a running container.
+type ExecCmd struct {
+	ContainerID string
+	Detach      bool
+
+	Program     string
+	ProgramArgs []string
+}
+
+func (cmd *ExecCmd) Cmd() *exec.Cmd {
+	args := []string{"exec"}
+	if cmd.Detach {
+		args = append(args, "-d")
+	}
+
+	args = append(append(args, cmd.ContainerID, cmd.Program), cmd.ProgramArgs...)
+	return exec.Command("docker", args...)
+}
+
+type StartCmd struct {
+	ContainerID string
+}
+
+func (cmd *StartCmd) Cmd() *exec.Cmd {
+	return exec.Command("docker", "start", cmd.ContainerID)
+}
+
+// StopCmd stops a container, sending its main process SIGTERM and then, if it
+// has not exited after Timeout (docker's default if zero), SIGKILL.
+type StopCmd struct {
+	ContainerID string
+	Timeout     time.Duration
+}
+
+func (cmd *StopCmd) Cmd() *exec.Cmd {
+	args := []string{"stop"}
+	if cmd.Timeout > 0 {
+		args = append(args, "--time", strconv.Itoa(int(cmd.Timeout/time.Second)))
+	}
+
+	return exec.Command("docker", append(args, cmd.ContainerID)...)
+}
+
+// UpdateCmd changes the resource limits of a running container. Zero values
+// are left as they are.
+type UpdateCmd struct {
+	ContainerID string
+
+	// MemoryInBytes also caps memory plus swap, so that the container cannot
+	// swap its way past its limit.
+	MemoryInBytes uint64
+	CPUShares     uint64
+}
+
+func (cmd *UpdateCmd) Cmd() *exec.Cmd {
+	args := []string{"update"}
+	if cmd.MemoryInBytes > 0 {
+		memory := strconv.FormatUint(cmd.MemoryInBytes, 10)
+		args = append(args, "--memory", memory, "--memory-swap", memory)
+	}
+
+	if cmd.CPUShares > 0 {
+		args = append(args, "--cpu-shares", strconv.FormatUint(cmd.CPUShares, 10))
+	}
+
+	return exec.Command("docker", append(args, cmd.ContainerID)...)
 }
@@ -1,6 +1,9 @@
 package dockercli_test
 
 import (
+	"io/ioutil"
+	"time"
+
 	. "github.com/julz/garden-docker/dockercli"
 
 	. "github.com/onsi/ginkgo"
@@ -40,6 +43,187 @@ var _ = Describe("Cmds", func() {
 			})
 		})
 
+		Context("with tmpfs mounts", func() {
+			It("adds a --tmpfs flag for each mount after the volumes", func() {
+				cmd := (&RunCmd{
+					Program: "foo",
+					Image:   "some-image",
+					Volumes: []Volume{{"host", "container"}},
+					Tmpfs:   []Tmpfs{{ContainerPath: "/tmp", SizeInBytes: 4096}, {ContainerPath: "/scratch"}},
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "-v", "host:container", "--tmpfs", "/tmp:size=4096", "--tmpfs", "/scratch", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with cpu limits", func() {
+			It("adds the --cpu-shares and --cpuset-cpus flags", func() {
+				cmd := (&RunCmd{
+					Program:    "foo",
+					Image:      "some-image",
+					CPUShares:  512,
+					CPUSetCPUs: "0-1",
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--cpu-shares", "512", "--cpuset-cpus", "0-1", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with labels", func() {
+			It("adds a --label flag for each label, in order", func() {
+				cmd := (&RunCmd{
+					Program: "foo",
+					Image:   "some-image",
+					Labels:  map[string]string{"b": "2", "a": "1"},
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--label", "a=1", "--label", "b=2", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with environment variables", func() {
+			It("adds a -e flag for each variable after the labels", func() {
+				cmd := (&RunCmd{
+					Program: "foo",
+					Image:   "some-image",
+					Labels:  map[string]string{"a": "1"},
+					Env:     []string{"X=1", "Y=2"},
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--label", "a=1", "-e", "X=1", "-e", "Y=2", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with a name", func() {
+			It("adds the --name flag", func() {
+				cmd := (&RunCmd{
+					Name:    "some-name",
+					Program: "foo",
+					Image:   "some-image",
+					Detach:  true,
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "-d", "--name", "some-name", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with the privileged flag", func() {
+			It("adds the --privileged flag", func() {
+				cmd := (&RunCmd{
+					Program:    "foo",
+					Image:      "some-image",
+					Detach:     true,
+					Privileged: true,
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "-d", "--privileged", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with capabilities and security options", func() {
+			It("adds --cap-drop, --cap-add and --security-opt flags", func() {
+				cmd := (&RunCmd{
+					Program:     "foo",
+					Image:       "some-image",
+					CapDrop:     []string{"ALL"},
+					CapAdd:      []string{"CHOWN", "KILL"},
+					SecurityOpt: []string{"no-new-privileges"},
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run",
+					"--cap-drop", "ALL",
+					"--cap-add", "CHOWN", "--cap-add", "KILL",
+					"--security-opt", "no-new-privileges",
+					"some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with a seccomp profile", func() {
+			It("passes the profile's path as a security option", func() {
+				cmd := (&RunCmd{
+					Program:        "foo",
+					Image:          "some-image",
+					SeccompProfile: "/some/profile.json",
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--security-opt", "seccomp=/some/profile.json", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with a read-only rootfs", func() {
+			It("adds the --read-only flag", func() {
+				cmd := (&RunCmd{
+					Program:  "foo",
+					Image:    "some-image",
+					ReadOnly: true,
+					Tmpfs:    []Tmpfs{{ContainerPath: "/tmp", SizeInBytes: 1024}},
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--read-only", "--tmpfs", "/tmp:size=1024", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with a user namespace mode", func() {
+			It("adds the --userns flag", func() {
+				cmd := (&RunCmd{
+					Program:    "foo",
+					Image:      "some-image",
+					Privileged: true,
+					UsernsMode: "host",
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--privileged", "--userns", "host", "some-image", "foo",
+				}))
+			})
+		})
+
+		Context("with a network", func() {
+			It("adds the --network flag", func() {
+				cmd := (&RunCmd{
+					Program: "foo",
+					Image:   "some-image",
+					Network: "none",
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--network", "none", "some-image", "foo",
+				}))
+			})
+
+			It("adds the --ip flag for an IP on it", func() {
+				cmd := (&RunCmd{
+					Program: "foo",
+					Image:   "some-image",
+					Network: "garden",
+					IP:      "10.254.0.2",
+					IPv6:    "fd00:254::2",
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "run", "--network", "garden", "--ip", "10.254.0.2", "--ip6", "fd00:254::2", "some-image", "foo",
+				}))
+			})
+		})
+
 		Context("with the detached flag", func() {
 			It("adds the -d flag", func() {
 				cmd := (&RunCmd{
@@ -55,4 +239,206 @@ var _ = Describe("Cmds", func() {
 			})
 		})
 	})
+
+	Describe("Rm", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&RmCmd{
+				ContainerID: "some-container",
+			}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "rm", "some-container",
+			}))
+		})
+
+		Context("with the force flag", func() {
+			It("adds the -f flag", func() {
+				cmd := (&RmCmd{
+					ContainerID: "some-container",
+					Force:       true,
+				}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "rm", "-f", "some-container",
+				}))
+			})
+		})
+	})
+
+	Describe("Rmi", func() {
+		It("serializes to a docker cli command, never forcing the removal", func() {
+			cmd := (&RmiCmd{Image: "busybox:latest"}).Cmd()
+			Expect(cmd.Args).To(Equal([]string{"docker", "rmi", "busybox:latest"}))
+		})
+	})
+
+	Describe("Tag", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&TagCmd{Source: "mirror/library/busybox:1", Target: "busybox:1"}).Cmd()
+			Expect(cmd.Args).To(Equal([]string{"docker", "tag", "mirror/library/busybox:1", "busybox:1"}))
+		})
+	})
+
+	Describe("Pull", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&PullCmd{Image: "some-image:tag"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "pull", "some-image:tag",
+			}))
+		})
+
+		Context("with a config directory", func() {
+			It("passes it with --config", func() {
+				cmd := (&PullCmd{Image: "some-image", ConfigDir: "/some/config"}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "--config", "/some/config", "pull", "some-image",
+				}))
+			})
+		})
+	})
+
+	Describe("Login", func() {
+		It("passes the password on stdin rather than as an argument", func() {
+			cmd := (&LoginCmd{
+				ConfigDir: "/some/config",
+				Registry:  "registry.example.com",
+				Username:  "some-user",
+				Password:  "some-password",
+			}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "--config", "/some/config", "login", "--username", "some-user", "--password-stdin", "registry.example.com",
+			}))
+			Expect(ioutil.ReadAll(cmd.Stdin)).To(Equal([]byte("some-password")))
+		})
+
+		Context("without a registry", func() {
+			It("logs in to the default registry", func() {
+				cmd := (&LoginCmd{ConfigDir: "/some/config", Username: "some-user"}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "--config", "/some/config", "login", "--username", "some-user", "--password-stdin",
+				}))
+			})
+		})
+	})
+
+	Describe("Inspect", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&InspectCmd{ContainerID: "some-container"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "inspect", "--format", "{{json .}}", "some-container",
+			}))
+		})
+
+		Context("when the size is asked for", func() {
+			It("adds the --size flag", func() {
+				cmd := (&InspectCmd{ContainerID: "some-container", Size: true}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "inspect", "--size", "--format", "{{json .}}", "some-container",
+				}))
+			})
+		})
+	})
+
+	Describe("Logs", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&LogsCmd{ContainerID: "some-container"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "logs", "some-container",
+			}))
+		})
+
+		Context("when following and tailing", func() {
+			It("adds the --follow and --tail flags", func() {
+				cmd := (&LogsCmd{ContainerID: "some-container", Follow: true, Tail: "10"}).Cmd()
+
+				Expect(cmd.Args).To(Equal([]string{
+					"docker", "logs", "--follow", "--tail", "10", "some-container",
+				}))
+			})
+		})
+	})
+
+	Describe("Cp", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&CpCmd{Src: "/host/file", Dst: "some-container:/file"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "cp", "/host/file", "some-container:/file",
+			}))
+		})
+
+		It("can keep the ownership of the copied files", func() {
+			cmd := (&CpCmd{Src: "-", Dst: "some-container:/", Archive: true}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "cp", "-a", "-", "some-container:/",
+			}))
+		})
+	})
+
+	Describe("Exec", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&ExecCmd{
+				ContainerID: "some-container",
+				Detach:      true,
+				Program:     "foo",
+				ProgramArgs: []string{"bar"},
+			}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "exec", "-d", "some-container", "foo", "bar",
+			}))
+		})
+	})
+
+	Describe("Start", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&StartCmd{ContainerID: "some-container"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "start", "some-container",
+			}))
+		})
+	})
+	Describe("Stop", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&StopCmd{ContainerID: "some-container"}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "stop", "some-container",
+			}))
+		})
+
+		It("passes the timeout in whole seconds", func() {
+			cmd := (&StopCmd{ContainerID: "some-container", Timeout: 30 * time.Second}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "stop", "--time", "30", "some-container",
+			}))
+		})
+	})
+	Describe("Update", func() {
+		It("serializes to a docker cli command", func() {
+			cmd := (&UpdateCmd{ContainerID: "some-container", MemoryInBytes: 1024}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "update", "--memory", "1024", "--memory-swap", "1024", "some-container",
+			}))
+		})
+
+		It("sets cpu shares", func() {
+			cmd := (&UpdateCmd{ContainerID: "some-container", CPUShares: 512}).Cmd()
+
+			Expect(cmd.Args).To(Equal([]string{
+				"docker", "update", "--cpu-shares", "512", "some-container",
+			}))
+		})
+	})
 })
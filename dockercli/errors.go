@@ -0,0 +1,76 @@
+package dockercli
+
+// Error is a failed docker command, or Engine API request, with the reason
+// it failed (see Classify) and what docker said about it. Failures with a
+// reason garden clients can act on are returned as one of the typed errors
+// below instead, each of which wraps an Error.
+type Error struct {
+	Command string
+	Reason  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Command + ": " + e.Message
+}
+
+// ImageNotFoundError is a failure to find an image, locally or in its
+// registry, including being denied access to it.
+type ImageNotFoundError struct{ Cause *Error }
+
+func (e ImageNotFoundError) Error() string {
+	return "image not found: " + e.Cause.Error()
+}
+
+func (e ImageNotFoundError) Unwrap() error { return e.Cause }
+
+// RegistryUnreachableError is a failure to talk to a registry at all.
+type RegistryUnreachableError struct{ Cause *Error }
+
+func (e RegistryUnreachableError) Error() string {
+	return "registry unreachable: " + e.Cause.Error()
+}
+
+func (e RegistryUnreachableError) Unwrap() error { return e.Cause }
+
+// DaemonDownError is a failure to talk to dockerd.
+type DaemonDownError struct{ Cause *Error }
+
+func (e DaemonDownError) Error() string {
+	return "docker daemon unavailable: " + e.Cause.Error()
+}
+
+func (e DaemonDownError) Unwrap() error { return e.Cause }
+
+// QuotaExceededError is dockerd running out of disk, or of a quota on it.
+type QuotaExceededError struct{ Cause *Error }
+
+func (e QuotaExceededError) Error() string {
+	return "disk quota exceeded: " + e.Cause.Error()
+}
+
+func (e QuotaExceededError) Unwrap() error { return e.Cause }
+
+// newError returns the error for a command which failed for the given
+// reason. Only commands which deal in images can fail to find one; anything
+// else docker did not find is left untyped.
+func newError(command, reason, message string) error {
+	err := &Error{Command: command, Reason: reason, Message: message}
+
+	switch reason {
+	case "image_not_found":
+		if command == "pull" || command == "run" || command == "image-inspect" {
+			return ImageNotFoundError{err}
+		}
+
+		return err
+	case "registry_unreachable":
+		return RegistryUnreachableError{err}
+	case "daemon_unavailable":
+		return DaemonDownError{err}
+	case "no_space":
+		return QuotaExceededError{err}
+	default:
+		return err
+	}
+}
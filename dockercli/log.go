@@ -0,0 +1,53 @@
+package dockercli
+
+import (
+	"bytes"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// maxChunk is the largest piece of output attached to a single log line.
+const maxChunk = 4096
+
+// chunkWriter logs everything written to it at debug level, one line (or, for
+// very long lines, one maxChunk-sized piece) per log message.
+type chunkWriter struct {
+	log    lager.Logger
+	stream string
+	buf    bytes.Buffer
+}
+
+func newChunkWriter(log lager.Logger, stream string) *chunkWriter {
+	return &chunkWriter{log: log, stream: stream}
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		line := w.buf.Bytes()
+		i := bytes.IndexByte(line, '\n')
+		switch {
+		case i >= 0 && i <= maxChunk:
+			w.emit(line[:i])
+			w.buf.Next(i + 1)
+		case len(line) > maxChunk:
+			w.emit(line[:maxChunk])
+			w.buf.Next(maxChunk)
+		default:
+			return len(p), nil
+		}
+	}
+}
+
+// Flush logs any remaining output which did not end in a newline.
+func (w *chunkWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.emit(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *chunkWriter) emit(chunk []byte) {
+	w.log.Debug(w.stream, lager.Data{"output": string(chunk)})
+}
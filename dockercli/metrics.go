@@ -0,0 +1,111 @@
+package dockercli
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/julz/garden-docker/metrics"
+)
+
+// Metrics records how long docker cli commands take and why they fail, and
+// how much image data is pulled.
+type Metrics struct {
+	Duration  *metrics.HistogramVec
+	Failures  *metrics.CounterVec
+	Retries   *metrics.CounterVec
+	PullBytes *metrics.CounterVec
+}
+
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		Duration: registry.NewHistogramVec(
+			"docker_command_duration_seconds",
+			"Time taken by docker cli commands.",
+			metrics.DefaultBuckets,
+			"command",
+		),
+		Failures: registry.NewCounterVec(
+			"docker_command_failures_total",
+			"Failed docker cli commands, by exit code and the cause reported on stderr.",
+			"command", "exit_code", "reason",
+		),
+		Retries: registry.NewCounterVec(
+			"docker_command_retries_total",
+			"Docker cli commands retried after a transient failure.",
+			"command",
+		),
+		PullBytes: registry.NewCounterVec(
+			"docker_pull_bytes_total",
+			"Bytes of image layers downloaded by pulls, as reported by dockerd (only over the Engine API).",
+		),
+	}
+}
+
+// imageNotFound matches docker failing to find an image or its repository,
+// but not other things it did not find, such as an executable in the image.
+var imageNotFound = regexp.MustCompile(`\b(image|repository) \S+ not found`)
+
+// Classify maps the stderr output of a failed docker command to a short,
+// stable reason suitable for use as a metric label.
+func Classify(stderr string) string {
+	s := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(s, "cannot connect to the docker daemon"),
+		strings.Contains(s, "is the docker daemon running"),
+		strings.Contains(s, "daemon is shutting down"),
+		strings.Contains(s, "daemon is restarting"):
+		return "daemon_unavailable"
+	case strings.Contains(s, "no such container"),
+		strings.Contains(s, "no such object"):
+		return "no_such_container"
+	case strings.Contains(s, "manifest unknown"),
+		strings.Contains(s, "pull access denied"),
+		imageNotFound.MatchString(s):
+		return "image_not_found"
+	case strings.Contains(s, "i/o timeout"),
+		strings.Contains(s, "connection refused"),
+		strings.Contains(s, "connection reset"),
+		strings.Contains(s, "tls handshake"),
+		strings.Contains(s, "no such host"),
+		strings.Contains(s, "500 internal server error"),
+		strings.Contains(s, "502 bad gateway"),
+		strings.Contains(s, "503 service unavailable"),
+		strings.Contains(s, "504 gateway timeout"):
+		return "registry_unreachable"
+	case strings.Contains(s, "resource temporarily unavailable"),
+		strings.Contains(s, "try again"),
+		strings.Contains(s, "too many requests"):
+		return "daemon_busy"
+	case strings.Contains(s, "conflict"):
+		return "conflict"
+	case strings.Contains(s, "no space left on device"),
+		strings.Contains(s, "quota exceeded"):
+		return "no_space"
+	default:
+		return "unknown"
+	}
+}
+
+// Transient reports whether a failure with the given reason (see Classify)
+// may succeed if retried.
+func Transient(reason string) bool {
+	switch reason {
+	case "daemon_unavailable", "daemon_busy", "registry_unreachable":
+		return true
+	default:
+		return false
+	}
+}
+
+func exitCode(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return strconv.Itoa(status.ExitStatus())
+		}
+	}
+
+	return "unknown"
+}
@@ -2,40 +2,398 @@ package dockercli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
 )
 
 type Runner struct {
-	Runner command_runner.CommandRunner
+	Runner  command_runner.CommandRunner
+	Metrics *Metrics
+
+	// Logger, if set, receives the output of every docker command at debug
+	// level as it is produced, and the full stderr of any command that fails.
+	Logger lager.Logger
+
+	// Retry, if set, makes the runner retry commands which fail for
+	// transient reasons (see Transient), except docker run: dockerd may have
+	// created the container before the command failed, so running it again
+	// would fail on the name being taken, or leave a container behind.
+	Retry *RetryPolicy
+
+	// APIVersion, if set, pins the docker API version every command uses,
+	// rather than letting the client negotiate one with the daemon, so that
+	// behaviour does not change when dockerd is upgraded.
+	APIVersion string
+
+	// Host, if set, is the dockerd to run every command against, as for
+	// Client, and TLS the files to talk to it with.
+	Host string
+	TLS  TLSFiles
+
+	until time.Time
+}
+
+// Until returns a copy of the runner which also stops retrying commands at
+// the deadline, such as that of the request they are run for. A command
+// already running is left to finish.
+func (r *Runner) Until(deadline time.Time) *Runner {
+	until := *r
+	until.until = deadline
+	return &until
+}
+
+// RetryPolicy configures exponential backoff between attempts to run a
+// command, and a hard deadline after which no more attempts are made.
+type RetryPolicy struct {
+	// InitialBackoff is the wait before the first retry. It doubles after
+	// every failed attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Deadline bounds the total time spent on a command, including waiting
+	// between attempts.
+	Deadline time.Duration
 }
 
 func (r *Runner) Run(cmd RunCmd) (string, error) {
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	c := cmd.Cmd()
-	c.Stdout = &stdout
-	c.Stderr = &stderr
+	return r.runWith(nil, "run", cmd.Cmd)
+}
+
+func (r *Runner) Inspect(cmd InspectCmd) (ContainerJSON, error) {
+	var container ContainerJSON
+
+	out, err := r.run("inspect", cmd.Cmd)
+	if err != nil {
+		return container, err
+	}
+
+	if err := json.Unmarshal([]byte(out), &container); err != nil {
+		return container, fmt.Errorf("inspect: parse output: %s", err)
+	}
+
+	return container, nil
+}
+
+func (r *Runner) ImageInspect(cmd ImageInspectCmd) (ImageJSON, error) {
+	var image ImageJSON
+
+	out, err := r.run("image-inspect", cmd.Cmd)
+	if err != nil {
+		return image, err
+	}
+
+	if err := json.Unmarshal([]byte(out), &image); err != nil {
+		return image, fmt.Errorf("image inspect: parse output: %s", err)
+	}
+
+	return image, nil
+}
+
+func (r *Runner) Ps(cmd PsCmd) ([]PsEntry, error) {
+	var entries []PsEntry
+	err := r.runLines("ps", cmd.Cmd, func(line []byte) error {
+		var entry PsEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+
+	return entries, err
+}
+
+func (r *Runner) Images(cmd ImagesCmd) ([]ImageEntry, error) {
+	var entries []ImageEntry
+	err := r.runLines("images", cmd.Cmd, func(line []byte) error {
+		var entry ImageEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+
+	return entries, err
+}
+
+func (r *Runner) Rm(cmd RmCmd) (string, error) {
+	return r.run("rm", cmd.Cmd)
+}
+
+func (r *Runner) Rmi(cmd RmiCmd) (string, error) {
+	return r.run("rmi", cmd.Cmd)
+}
+
+func (r *Runner) Tag(cmd TagCmd) (string, error) {
+	return r.run("tag", cmd.Cmd)
+}
+
+func (r *Runner) RegistryConfig(cmd RegistryConfigCmd) (RegistryConfig, error) {
+	var config RegistryConfig
+
+	out, err := r.run("info", cmd.Cmd)
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal([]byte(out), &config); err != nil {
+		return config, fmt.Errorf("info: parse output: %s", err)
+	}
+
+	return config, nil
+}
+
+func (r *Runner) Start(cmd StartCmd) (string, error) {
+	return r.run("start", cmd.Cmd)
+}
+
+func (r *Runner) Stop(cmd StopCmd) (string, error) {
+	return r.run("stop", cmd.Cmd)
+}
+
+func (r *Runner) Update(cmd UpdateCmd) (string, error) {
+	return r.run("update", cmd.Cmd)
+}
+
+func (r *Runner) Pull(cmd PullCmd) (string, error) {
+	return r.run("pull", cmd.Cmd)
+}
+
+func (r *Runner) Cp(cmd CpCmd) (string, error) {
+	return r.run("cp", cmd.Cmd)
+}
+
+// CpIn runs a CpCmd with tar on its stdin, for a Src of "-". The tar cannot
+// be replayed, so the command is never retried.
+func (r *Runner) CpIn(cmd CpCmd, tar io.Reader) error {
+	c := r.pin(cmd.Cmd())
+
+	stderr := new(bytes.Buffer)
+	c.Stdin = tar
+	c.Stderr = stderr
 
 	if err := r.Runner.Run(c); err != nil {
-		return "", fmt.Errorf("run: %s: %s", err, strings.TrimRight(stderr.String(), "\n"))
+		msg := strings.TrimSpace(stderr.String())
+		return newError("cp", Classify(msg), fmt.Sprintf("%s: %s", err, msg))
+	}
+
+	return nil
+}
+
+// CpOut runs a CpCmd with a Dst of "-" and returns the tar it writes to its
+// stdout as it is produced. Reading fails with the command's error if it
+// fails part way; closing the reader early makes it exit.
+func (r *Runner) CpOut(cmd CpCmd) (io.ReadCloser, error) {
+	c := r.pin(cmd.Cmd())
+
+	tar, w := io.Pipe()
+	stderr := new(bytes.Buffer)
+	c.Stdout = w
+	c.Stderr = stderr
+
+	if err := r.Runner.Start(c); err != nil {
+		return nil, fmt.Errorf("cp: %s", err)
+	}
+
+	go func() {
+		if err := r.Runner.Wait(c); err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			w.CloseWithError(newError("cp", Classify(msg), fmt.Sprintf("%s: %s", err, msg)))
+			return
+		}
+
+		w.Close()
+	}()
+
+	return tar, nil
+}
+
+func (r *Runner) Exec(cmd ExecCmd) (string, error) {
+	return r.run("exec", cmd.Cmd)
+}
+
+func (r *Runner) Login(cmd LoginCmd) (string, error) {
+	return r.run("login", cmd.Cmd)
+}
+
+// Logs streams the output of a LogsCmd to stdout and stderr as docker
+// produces it, rather than buffering it like the other commands, and is
+// never retried. Closing stop kills the command, which is the only way a
+// followed log ends while the container is running.
+func (r *Runner) Logs(cmd LogsCmd, stdout, stderr io.Writer, stop <-chan struct{}) error {
+	c := r.pin(cmd.Cmd())
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	if err := r.Runner.Start(c); err != nil {
+		return fmt.Errorf("logs: %s", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- r.Runner.Wait(c)
+	}()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			return fmt.Errorf("logs: %s", err)
+		}
+
+		return nil
+	case <-stop:
+		r.Runner.Kill(c)
+		<-exited
+		return nil
+	}
+}
+
+// runLines runs a command which prints one JSON document per line, calling
+// parse for each non-empty line.
+func (r *Runner) runLines(name string, build func() *exec.Cmd, parse func([]byte) error) error {
+	out, err := r.run(name, build)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if err := parse([]byte(line)); err != nil {
+			return fmt.Errorf("%s: parse output: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) run(name string, build func() *exec.Cmd) (string, error) {
+	return r.runWith(r.Retry, name, build)
+}
+
+// runWith runs a command, retrying it as the policy allows. A nil policy
+// makes a single attempt.
+func (r *Runner) runWith(policy *RetryPolicy, name string, build func() *exec.Cmd) (string, error) {
+	var out string
+	err := policy.do(r.Metrics, name, r.until, func() (string, error) {
+		stdout, stderr, err := r.runOnce(name, r.pin(build()))
+		if err != nil {
+			reason := Classify(stderr)
+			return reason, newError(name, reason, fmt.Sprintf("%s: %s", err, stderr))
+		}
+
+		out = stdout
+		return "", nil
+	})
+
+	return out, err
+}
+
+// do makes attempts until one succeeds, one fails for a reason (see Classify)
+// which is not Transient, or the deadline would pass before the next. The
+// deadline is the policy's Deadline from now or, if it is sooner, until,
+// unless that is zero. A nil policy makes a single attempt.
+func (p *RetryPolicy) do(metrics *Metrics, name string, until time.Time, attempt func() (reason string, err error)) error {
+	var deadline time.Time
+	var backoff time.Duration
+	if p != nil {
+		deadline = time.Now().Add(p.Deadline)
+		backoff = p.InitialBackoff
+	}
+
+	if !until.IsZero() && until.Before(deadline) {
+		deadline = until
+	}
+
+	for {
+		reason, err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		if p == nil || !Transient(reason) || time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+
+		if metrics != nil {
+			metrics.Retries.Inc(name)
+		}
+
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// pin points a command at Host, with TLS, and sets the APIVersion, if any,
+// in its environment.
+func (r *Runner) pin(c *exec.Cmd) *exec.Cmd {
+	var global []string
+	if r.Host != "" {
+		global = append(global, "--host", r.Host)
+	}
+
+	global = append(global, r.TLS.args()...)
+	if len(global) > 0 {
+		c.Args = append(append([]string{c.Args[0]}, global...), c.Args[1:]...)
+	}
+
+	if r.APIVersion == "" {
+		return c
 	}
 
-	return strings.TrimRight(stdout.String(), "\n"), nil
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	c.Env = append(env, "DOCKER_API_VERSION="+r.APIVersion)
+	return c
 }
 
-func (r *Runner) Inspect(cmd InspectCmd) (string, error) {
+func (r *Runner) runOnce(name string, c *exec.Cmd) (string, string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	c := cmd.Cmd()
 	c.Stdout = &stdout
 	c.Stderr = &stderr
 
-	if err := r.Runner.Run(c); err != nil {
-		return "", fmt.Errorf("inspect: %s: %s", err, strings.TrimRight(stderr.String(), "\n"))
+	var log lager.Logger
+	if r.Logger != nil {
+		log = r.Logger.Session("docker-"+name, lager.Data{"argv": c.Args})
+		stdoutLog, stderrLog := newChunkWriter(log, "stdout"), newChunkWriter(log, "stderr")
+		defer stdoutLog.Flush()
+		defer stderrLog.Flush()
+
+		c.Stdout = io.MultiWriter(&stdout, stdoutLog)
+		c.Stderr = io.MultiWriter(&stderr, stderrLog)
+	}
+
+	start := time.Now()
+	err := r.Runner.Run(c)
+	if err != nil && log != nil {
+		log.Error("failed", err, lager.Data{"stderr": stderr.String()})
+	}
+	if r.Metrics != nil {
+		r.Metrics.Duration.Since(start, name)
+		if err != nil {
+			r.Metrics.Failures.Inc(name, exitCode(err), Classify(stderr.String()))
+		}
 	}
 
-	return strings.TrimRight(stdout.String(), "\n"), nil
+	return strings.TrimRight(stdout.String(), "\n"), strings.TrimRight(stderr.String(), "\n"), err
 }
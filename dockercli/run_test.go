@@ -1,15 +1,23 @@
 package dockercli_test
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
 	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
 	. "github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/metrics"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
 )
 
 var _ = Describe("Docker CLI Runner", func() {
@@ -18,19 +26,18 @@ var _ = Describe("Docker CLI Runner", func() {
 
 	BeforeEach(func() {
 		innerRunner = fake_command_runner.New()
-		runner = &Runner{innerRunner}
+		runner = &Runner{Runner: innerRunner}
 	})
 
 	Describe("Inspect", func() {
-		It("runs the inspect command with the given field and container id and returns the result", func() {
+		It("runs the inspect command for the container and parses the result", func() {
 			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
-				cmd.Stdout.Write([]byte("some-field-value\n"))
+				cmd.Stdout.Write([]byte(`{"Id":"abc123","State":{"Running":true,"Pid":42},"NetworkSettings":{"IPAddress":"172.17.0.5"},"GraphDriver":{"Name":"overlay","Data":{"UpperDir":"/upper"}}}` + "\n"))
 				return nil
 			})
 
-			field, err := runner.Inspect(InspectCmd{
+			container, err := runner.Inspect(InspectCmd{
 				ContainerID: "some-container",
-				Field:       "some-field",
 			})
 
 			Expect(err).NotTo(HaveOccurred())
@@ -38,12 +45,41 @@ var _ = Describe("Docker CLI Runner", func() {
 				Path: "docker",
 				Args: []string{
 					"inspect",
-					"--format='{{.some-field}}'",
+					"--format", "{{json .}}",
 					"some-container",
 				},
 			}))
 
-			Expect(field).To(Equal("some-field-value"))
+			Expect(container.ID).To(Equal("abc123"))
+			Expect(container.State.Running).To(BeTrue())
+			Expect(container.State.Pid).To(Equal(42))
+			Expect(container.NetworkSettings.IPAddress).To(Equal("172.17.0.5"))
+			Expect(container.GraphDriver.Data["UpperDir"]).To(Equal("/upper"))
+		})
+
+		It("finds the container's address on a user-defined network", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`{"Id":"abc123","NetworkSettings":{"IPAddress":"","Networks":{"garden":{"IPAddress":"10.254.0.2"}}}}` + "\n"))
+				return nil
+			})
+
+			container, err := runner.Inspect(InspectCmd{ContainerID: "some-container"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(container.IPAddress("garden")).To(Equal("10.254.0.2"))
+			Expect(container.IPAddress("")).To(Equal("10.254.0.2"))
+			Expect(container.IPAddress("other")).To(Equal("10.254.0.2"))
+		})
+
+		Context("when the output is not valid json", func() {
+			It("returns an error", func() {
+				innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("'172.17.0.5'\n"))
+					return nil
+				})
+
+				_, err := runner.Inspect(InspectCmd{})
+				Expect(err).To(MatchError(HavePrefix("inspect: parse output:")))
+			})
 		})
 
 		Context("when the command fails", func() {
@@ -60,6 +96,100 @@ var _ = Describe("Docker CLI Runner", func() {
 		})
 	})
 
+	Describe("ImageInspect", func() {
+		It("runs the image inspect command and parses the result", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`{"Id":"sha256:abc","Architecture":"arm64","Os":"linux"}` + "\n"))
+				return nil
+			})
+
+			image, err := runner.ImageInspect(ImageInspectCmd{Image: "busybox"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"image", "inspect", "--format", "{{json .}}", "busybox"},
+			}))
+
+			Expect(image).To(Equal(ImageJSON{ID: "sha256:abc", Architecture: "arm64", Os: "linux"}))
+		})
+	})
+
+	Describe("RegistryConfig", func() {
+		It("runs docker info and parses the registry configuration", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`{"IndexConfigs":{"registry.internal:5000":{"Name":"registry.internal:5000","Secure":false}}}` + "\n"))
+				return nil
+			})
+
+			config, err := runner.RegistryConfig(RegistryConfigCmd{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"info", "--format", "{{json .RegistryConfig}}"},
+			}))
+
+			Expect(config.IndexConfigs).To(HaveKey("registry.internal:5000"))
+			Expect(config.IndexConfigs["registry.internal:5000"].Secure).To(BeFalse())
+		})
+	})
+
+	Describe("Ps", func() {
+		It("parses one container per line", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`{"ID":"abc","Image":"busybox","Names":"one","Labels":"a=b,c=d"}` + "\n"))
+				cmd.Stdout.Write([]byte(`{"ID":"def","Image":"ubuntu","Names":"two","Labels":""}` + "\n"))
+				return nil
+			})
+
+			entries, err := runner.Ps(PsCmd{All: true, Filters: []string{"label=foo"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"ps", "--no-trunc", "--format", "{{json .}}", "-a", "--filter", "label=foo"},
+			}))
+
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].ID).To(Equal("abc"))
+			Expect(entries[0].Labels).To(Equal("a=b,c=d"))
+			Expect(entries[1].Names).To(Equal("two"))
+		})
+
+		Context("when there are no containers", func() {
+			It("returns no entries", func() {
+				entries, err := runner.Ps(PsCmd{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Images", func() {
+		It("parses one image per line", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`{"ID":"sha256:abc","Repository":"busybox","Tag":"latest","Digest":"sha256:def"}` + "\n"))
+				return nil
+			})
+
+			images, err := runner.Images(ImagesCmd{Repository: "busybox"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"images", "--no-trunc", "--digests", "--format", "{{json .}}", "busybox"},
+			}))
+
+			Expect(images).To(Equal([]ImageEntry{{
+				ID:         "sha256:abc",
+				Repository: "busybox",
+				Tag:        "latest",
+				Digest:     "sha256:def",
+			}}))
+		})
+	})
+
 	Describe("Run", func() {
 		It("runs the docker run command", func() {
 			cmd := RunCmd{}
@@ -96,5 +226,376 @@ var _ = Describe("Docker CLI Runner", func() {
 				Expect(err).To(MatchError("run: exit status 2: no foo"))
 			})
 		})
+
+		Context("when the API version is pinned", func() {
+			It("tells the docker client to use it", func() {
+				runner.APIVersion = "1.24"
+
+				_, err := runner.Run(RunCmd{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(innerRunner.ExecutedCommands()[0].Env).To(ContainElement("DOCKER_API_VERSION=1.24"))
+			})
+		})
+
+		Context("when a host and tls files are given", func() {
+			It("tells the docker client to use them", func() {
+				runner.Host = "tcp://docker.internal:2376"
+				runner.TLS = TLSFiles{Cert: "/certs/cert.pem", Key: "/certs/key.pem", CACert: "/certs/ca.pem"}
+
+				_, err := runner.Rm(RmCmd{ContainerID: "some-container"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "docker",
+					Args: []string{
+						"--host", "tcp://docker.internal:2376",
+						"--tlsverify", "--tlscacert", "/certs/ca.pem", "--tlscert", "/certs/cert.pem", "--tlskey", "/certs/key.pem",
+						"rm", "some-container",
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("Rm", func() {
+		It("runs the docker rm command", func() {
+			_, err := runner.Rm(RmCmd{ContainerID: "some-container", Force: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"rm", "-f", "some-container"},
+			}))
+		})
+
+		Context("when the rm command fails", func() {
+			It("returns an error including the stderr stream", func() {
+				innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("no such container\n"))
+					return errors.New("exit status 1")
+				})
+
+				_, err := runner.Rm(RmCmd{})
+				Expect(err).To(MatchError("rm: exit status 1: no such container"))
+			})
+		})
+
+		Context("when dockerd is down", func() {
+			It("returns a DaemonDownError", func() {
+				innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Cannot connect to the Docker daemon at unix:///var/run/docker.sock\n"))
+					return errors.New("exit status 1")
+				})
+
+				_, err := runner.Rm(RmCmd{})
+				Expect(err).To(BeAssignableToTypeOf(DaemonDownError{}))
+				Expect(err).To(MatchError("docker daemon unavailable: rm: exit status 1: Cannot connect to the Docker daemon at unix:///var/run/docker.sock"))
+			})
+		})
+	})
+
+	Describe("Logs", func() {
+		It("streams the output of docker logs to the given writers", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("out"))
+				cmd.Stderr.Write([]byte("err"))
+				return nil
+			})
+
+			stdout, stderr := gbytes.NewBuffer(), gbytes.NewBuffer()
+			Expect(runner.Logs(LogsCmd{ContainerID: "some-container", Tail: "5"}, stdout, stderr, nil)).To(Succeed())
+
+			Expect(innerRunner).To(HaveStartedExecuting(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"logs", "--tail", "5", "some-container"},
+			}))
+			Expect(stdout).To(gbytes.Say("out"))
+			Expect(stderr).To(gbytes.Say("err"))
+		})
+
+		Context("when stop is closed", func() {
+			It("kills the command and returns", func() {
+				release := make(chan struct{})
+
+				innerRunner.WhenWaitingFor(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+					<-release
+					return nil
+				})
+
+				stop := make(chan struct{})
+				errs := make(chan error)
+				go func() {
+					errs <- runner.Logs(LogsCmd{ContainerID: "some-container", Follow: true}, nil, nil, stop)
+				}()
+
+				Consistently(errs).ShouldNot(Receive())
+
+				close(stop)
+
+				Eventually(innerRunner).Should(HaveKilled(fake_command_runner.CommandSpec{
+					Path: "docker",
+					Args: []string{"logs", "--follow", "some-container"},
+				}))
+				release <- struct{}{}
+				Eventually(errs).Should(Receive(BeNil()))
+			})
+		})
+
+		Context("when docker logs fails", func() {
+			It("returns an error", func() {
+				innerRunner.WhenWaitingFor(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+					return errors.New("exit status 1")
+				})
+
+				Expect(runner.Logs(LogsCmd{}, nil, nil, nil)).To(MatchError("logs: exit status 1"))
+			})
+		})
+	})
+
+	Describe("CpIn", func() {
+		It("passes the tar to docker cp on its stdin", func() {
+			var stdin []byte
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+				stdin, _ = ioutil.ReadAll(cmd.Stdin)
+				return nil
+			})
+
+			Expect(runner.CpIn(CpCmd{Src: "-", Dst: "some-container:/"}, strings.NewReader("a tar"))).To(Succeed())
+			Expect(innerRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"cp", "-", "some-container:/"},
+			}))
+			Expect(string(stdin)).To(Equal("a tar"))
+		})
+
+		Context("when docker cp fails", func() {
+			It("returns an error with its stderr", func() {
+				innerRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("no such container\n"))
+					return errors.New("exit status 1")
+				})
+
+				Expect(runner.CpIn(CpCmd{Src: "-", Dst: "some-container:/"}, strings.NewReader(""))).To(MatchError("cp: exit status 1: no such container"))
+			})
+		})
+	})
+
+	Describe("CpOut", func() {
+		It("streams the tar docker cp writes to its stdout", func() {
+			innerRunner.WhenWaitingFor(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("a tar"))
+				return nil
+			})
+
+			tar, err := runner.CpOut(CpCmd{Src: "some-container:/app", Dst: "-"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadAll(tar)).To(Equal([]byte("a tar")))
+
+			Expect(innerRunner).To(HaveStartedExecuting(fake_command_runner.CommandSpec{
+				Path: "docker",
+				Args: []string{"cp", "some-container:/app", "-"},
+			}))
+		})
+
+		Context("when docker cp fails", func() {
+			It("fails the read with its stderr", func() {
+				innerRunner.WhenWaitingFor(fake_command_runner.CommandSpec{Path: "docker"}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("no such file\n"))
+					return errors.New("exit status 1")
+				})
+
+				tar, err := runner.CpOut(CpCmd{Src: "some-container:/missing", Dst: "-"})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = ioutil.ReadAll(tar)
+				Expect(err).To(MatchError("cp: exit status 1: no such file"))
+			})
+		})
+	})
+
+	Describe("metrics", func() {
+		var registry *metrics.Registry
+
+		BeforeEach(func() {
+			registry = metrics.NewRegistry()
+			runner.Metrics = NewMetrics(registry)
+		})
+
+		It("records the duration of each command", func() {
+			runner.Run(RunCmd{})
+			runner.Rm(RmCmd{})
+			runner.Rm(RmCmd{})
+
+			Expect(runner.Metrics.Duration.Count("run")).To(BeEquivalentTo(1))
+			Expect(runner.Metrics.Duration.Count("rm")).To(BeEquivalentTo(2))
+		})
+
+		It("counts failures by command, exit code and reason", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stderr.Write([]byte("Error: No such container: foo\n"))
+				return errors.New("exit status 1")
+			})
+
+			runner.Rm(RmCmd{ContainerID: "foo"})
+
+			Expect(runner.Metrics.Failures.Value("rm", "unknown", "no_such_container")).To(BeEquivalentTo(1))
+		})
+	})
+
+	Describe("logging", func() {
+		var logger *lagertest.TestLogger
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("test")
+			runner.Logger = logger
+		})
+
+		It("logs the command's output line by line at debug level", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("line one\nline "))
+				cmd.Stdout.Write([]byte("two\npartial"))
+				return nil
+			})
+
+			runner.Run(RunCmd{Image: "some-image"})
+
+			var outputs []interface{}
+			for _, log := range logger.Logs() {
+				if log.Message == "test.docker-run.stdout" {
+					Expect(log.LogLevel).To(Equal(lager.DEBUG))
+					outputs = append(outputs, log.Data["output"])
+				}
+			}
+
+			Expect(outputs).To(Equal([]interface{}{"line one", "line two", "partial"}))
+		})
+
+		It("splits very long lines into chunks", func() {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write(bytes.Repeat([]byte("x"), 5000))
+				return nil
+			})
+
+			runner.Run(RunCmd{})
+
+			var chunks int
+			for _, log := range logger.Logs() {
+				if log.Message == "test.docker-run.stdout" {
+					Expect(len(log.Data["output"].(string))).To(BeNumerically("<=", 4096))
+					chunks++
+				}
+			}
+
+			Expect(chunks).To(Equal(2))
+		})
+
+		Context("when the command fails", func() {
+			It("logs an error including docker's stderr", func() {
+				innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Error: no such image\n"))
+					return errors.New("exit status 1")
+				})
+
+				runner.Run(RunCmd{})
+
+				Expect(logger).To(gbytes.Say(`test.docker-run.failed.*Error: no such image`))
+			})
+		})
+	})
+
+	Describe("retries", func() {
+		var attempts int
+
+		BeforeEach(func() {
+			attempts = 0
+			runner.Retry = &RetryPolicy{
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     2 * time.Millisecond,
+				Deadline:       time.Second,
+			}
+		})
+
+		failWith := func(stderr string, times int) {
+			innerRunner.WhenRunning(fake_command_runner.CommandSpec{}, func(cmd *exec.Cmd) error {
+				attempts++
+				if attempts > times {
+					cmd.Stdout.Write([]byte("container-id\n"))
+					return nil
+				}
+
+				cmd.Stderr.Write([]byte(stderr))
+				return errors.New("exit status 1")
+			})
+		}
+
+		Context("when the command fails transiently", func() {
+			BeforeEach(func() {
+				failWith("Cannot connect to the Docker daemon. Is the docker daemon running on this host?", 2)
+			})
+
+			It("retries until it succeeds", func() {
+				out, err := runner.Rm(RmCmd{ContainerID: "container-id"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(out).To(Equal("container-id"))
+				Expect(attempts).To(Equal(3))
+			})
+
+			It("does not retry docker run, which may have created the container", func() {
+				_, err := runner.Run(RunCmd{})
+				Expect(err).To(HaveOccurred())
+				Expect(attempts).To(Equal(1))
+			})
+
+			Context("and the deadline passes", func() {
+				BeforeEach(func() {
+					runner.Retry.Deadline = 0
+				})
+
+				It("gives up", func() {
+					_, err := runner.Rm(RmCmd{ContainerID: "container-id"})
+					Expect(err).To(HaveOccurred())
+					Expect(attempts).To(Equal(1))
+				})
+			})
+
+			Context("and the runner's own deadline passes first", func() {
+				It("gives up", func() {
+					_, err := runner.Until(time.Now()).Rm(RmCmd{ContainerID: "container-id"})
+					Expect(err).To(HaveOccurred())
+					Expect(attempts).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when the command fails permanently", func() {
+			BeforeEach(func() {
+				failWith("Conflict. The name \"foo\" is already in use", 1)
+			})
+
+			It("does not retry", func() {
+				_, err := runner.Rm(RmCmd{ContainerID: "container-id"})
+				Expect(err).To(HaveOccurred())
+				Expect(attempts).To(Equal(1))
+			})
+		})
+	})
+
+	Describe("Classify", func() {
+		It("recognises common docker failures", func() {
+			Expect(Classify("Cannot connect to the Docker daemon. Is the docker daemon running on this host?")).To(Equal("daemon_unavailable"))
+			Expect(Classify("Error: image library/nope not found")).To(Equal("image_not_found"))
+			Expect(Classify("Error response from daemon: repository nope/nope not found: does not exist or no pull access")).To(Equal("image_not_found"))
+			Expect(Classify("manifest for busybox:nope not found: manifest unknown")).To(Equal("image_not_found"))
+			Expect(Classify("Get https://registry-1.docker.io/v2/: dial tcp: i/o timeout")).To(Equal("registry_unreachable"))
+			Expect(Classify("received unexpected HTTP status: 503 Service Unavailable")).To(Equal("registry_unreachable"))
+			Expect(Classify("Error response from daemon: daemon is shutting down")).To(Equal("daemon_unavailable"))
+			Expect(Classify("Conflict. The name \"foo\" is already in use")).To(Equal("conflict"))
+			Expect(Classify("something else entirely")).To(Equal("unknown"))
+		})
+
+		It("does not take other things docker did not find for a missing image", func() {
+			Expect(Classify(`exec: "/garden-bin/initd": stat /garden-bin/initd: no such file or directory: executable file not found in $PATH`)).To(Equal("unknown"))
+		})
 	})
 })
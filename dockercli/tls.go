@@ -0,0 +1,74 @@
+package dockercli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSFiles are the PEM files used to talk to a dockerd which requires TLS:
+// a client certificate and its key, and the CA to verify dockerd against
+// (the host's roots if empty).
+type TLSFiles struct {
+	Cert   string
+	Key    string
+	CACert string
+}
+
+// Enabled reports whether any of the files are set.
+func (f TLSFiles) Enabled() bool {
+	return f.Cert != "" || f.Key != "" || f.CACert != ""
+}
+
+// Config loads the files into a tls.Config for a Client.
+func (f TLSFiles) Config() (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if f.Cert != "" || f.Key != "" {
+		if f.Cert == "" || f.Key == "" {
+			return nil, fmt.Errorf("docker tls: a certificate and its key must be given together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("docker tls: load certificate: %s", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if f.CACert != "" {
+		pem, err := ioutil.ReadFile(f.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("docker tls: load ca: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("docker tls: no certificates in %s", f.CACert)
+		}
+
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// args returns the docker cli flags which use the files.
+func (f TLSFiles) args() []string {
+	if !f.Enabled() {
+		return nil
+	}
+
+	args := []string{"--tlsverify"}
+	if f.CACert != "" {
+		args = append(args, "--tlscacert", f.CACert)
+	}
+
+	if f.Cert != "" {
+		args = append(args, "--tlscert", f.Cert, "--tlskey", f.Key)
+	}
+
+	return args
+}
@@ -0,0 +1,131 @@
+package dockercli
+
+// ContainerJSON is the subset of `docker inspect` output garden-docker uses.
+type ContainerJSON struct {
+	ID    string `json:"Id"`
+	Name  string
+	Image string
+
+	State struct {
+		Status    string
+		Running   bool
+		Pid       int
+		ExitCode  int
+		OOMKilled bool
+	}
+
+	Config struct {
+		Hostname string
+		Image    string
+		Env      []string
+		Labels   map[string]string
+	}
+
+	HostConfig struct {
+		Memory     int64
+		CPUShares  int64 `json:"CpuShares"`
+		CpusetCpus string
+		Privileged bool
+	}
+
+	NetworkSettings struct {
+		IPAddress         string
+		Gateway           string
+		GlobalIPv6Address string
+
+		// Networks holds the container's addresses on each network it is
+		// on. Docker only fills in the addresses above for its default
+		// bridge network.
+		Networks map[string]EndpointSettings
+	}
+
+	GraphDriver struct {
+		Name string
+		Data map[string]string
+	}
+
+	Mounts []struct {
+		Source      string
+		Destination string
+	}
+
+	// SizeRw and SizeRootFs are only set by an InspectCmd with Size.
+	SizeRw     uint64
+	SizeRootFs uint64
+}
+
+// EndpointSettings is a container's addresses on one network.
+type EndpointSettings struct {
+	IPAddress         string
+	GlobalIPv6Address string
+}
+
+// IPAddress returns the container's IPv4 address on the named network or,
+// if it has none there, its address on docker's default bridge network or
+// on its only network.
+func (c ContainerJSON) IPAddress(network string) string {
+	return c.address(network, c.NetworkSettings.IPAddress, func(e EndpointSettings) string { return e.IPAddress })
+}
+
+// GlobalIPv6Address is IPAddress for the container's IPv6 address.
+func (c ContainerJSON) GlobalIPv6Address(network string) string {
+	return c.address(network, c.NetworkSettings.GlobalIPv6Address, func(e EndpointSettings) string { return e.GlobalIPv6Address })
+}
+
+func (c ContainerJSON) address(network, bridge string, field func(EndpointSettings) string) string {
+	if endpoint, ok := c.NetworkSettings.Networks[network]; ok && field(endpoint) != "" {
+		return field(endpoint)
+	}
+
+	if bridge != "" || len(c.NetworkSettings.Networks) != 1 {
+		return bridge
+	}
+
+	for _, endpoint := range c.NetworkSettings.Networks {
+		return field(endpoint)
+	}
+
+	return ""
+}
+
+// PsEntry is one line of `docker ps --format '{{json .}}'` output.
+type PsEntry struct {
+	ID     string
+	Image  string
+	Names  string
+	Status string
+
+	// Labels are the container's labels as docker ps prints them, joined
+	// with commas. Label values may contain commas themselves, so read them
+	// from Inspect's Config.Labels instead.
+	Labels string
+}
+
+// ImageJSON is the subset of `docker image inspect` output garden-docker
+// uses.
+type ImageJSON struct {
+	ID           string `json:"Id"`
+	Architecture string
+	Os           string
+	RepoDigests  []string
+}
+
+// RegistryConfig is the subset of dockerd's registry configuration, from
+// `docker info`, garden-docker uses.
+type RegistryConfig struct {
+	// IndexConfigs holds the registries dockerd has been configured for, by
+	// host, including those it may talk to insecurely.
+	IndexConfigs map[string]struct {
+		Name   string
+		Secure bool
+	}
+}
+
+// ImageEntry is one line of `docker images --format '{{json .}}'` output.
+type ImageEntry struct {
+	ID         string
+	Repository string
+	Tag        string
+	Digest     string
+	Size       string
+}
@@ -0,0 +1,35 @@
+package gardendocker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DockerPIDFile identifies the running dockerd by its pid and the time its
+// process started, read from docker's pid file and /proc. Together these
+// change whenever dockerd restarts, even if the pid is reused.
+type DockerPIDFile struct {
+	Path string
+}
+
+func (f *DockerPIDFile) Identity() (string, error) {
+	pid, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("read docker pid file: %s", err)
+	}
+
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/stat", strings.TrimSpace(string(pid))))
+	if err != nil {
+		return "", fmt.Errorf("read dockerd process status: %s", err)
+	}
+
+	// the command name (field 2) may contain spaces, so count fields from
+	// the closing bracket which ends it; the start time is field 22
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	if len(fields) < 20 {
+		return "", fmt.Errorf("read dockerd process status: unexpected format")
+	}
+
+	return strings.TrimSpace(string(pid)) + ":" + fields[19], nil
+}
@@ -0,0 +1,41 @@
+package gardendocker_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DockerPIDFile", func() {
+	var pidFile *os.File
+
+	BeforeEach(func() {
+		var err error
+		pidFile, err = ioutil.TempFile("", "docker.pid")
+		Expect(err).NotTo(HaveOccurred())
+		defer pidFile.Close()
+
+		fmt.Fprintf(pidFile, "%d\n", os.Getpid())
+	})
+
+	AfterEach(func() {
+		os.Remove(pidFile.Name())
+	})
+
+	It("identifies the process by its pid and start time", func() {
+		identity, err := (&gardendocker.DockerPIDFile{Path: pidFile.Name()}).Identity()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity).To(MatchRegexp(fmt.Sprintf(`^%d:\d+$`, os.Getpid())))
+	})
+
+	Context("when the pid file does not exist", func() {
+		It("returns an error", func() {
+			_, err := (&gardendocker.DockerPIDFile{Path: "/does/not/exist"}).Identity()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
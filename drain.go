@@ -0,0 +1,78 @@
+package gardendocker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// ErrDraining is returned by Create once the backend has started to drain.
+var ErrDraining = errors.New("garden-docker is draining and not accepting new containers")
+
+// drainPollInterval is how often Drain checks whether processes are still
+// running.
+var drainPollInterval = 100 * time.Millisecond
+
+// Drain gets the backend ready to shut down without killing work in flight:
+// it stops accepting new containers, waits up to timeout for the processes
+// running in every container to exit, and then saves the state of every
+// container, so that the next garden-docker restores them as they were.
+// Containers are left running.
+func (b *Backend) Drain(timeout time.Duration) {
+	log := b.Logger.Session("drain", lager.Data{"timeout": timeout.String()})
+	log.Info("started")
+
+	b.drainMu.Lock()
+	b.draining = true
+	b.drainMu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for timeout > 0 {
+		running := b.runningProcesses()
+		if running == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			log.Info("timed-out", lager.Data{"running-processes": running})
+			break
+		}
+
+		time.Sleep(drainPollInterval)
+	}
+
+	for _, container := range b.Repo.All() {
+		if container.InfoHandler == nil || container.PropsHandler == nil {
+			continue
+		}
+
+		if err := container.SaveProperties(); err != nil {
+			log.Error("save-failed", err, lager.Data{"handle": container.Handle()})
+		}
+
+		if err := container.SaveMetadata(); err != nil {
+			log.Error("save-metadata-failed", err, lager.Data{"handle": container.Handle()})
+		}
+	}
+
+	log.Info("finished")
+}
+
+func (b *Backend) isDraining() bool {
+	b.drainMu.Lock()
+	defer b.drainMu.Unlock()
+
+	return b.draining
+}
+
+func (b *Backend) runningProcesses() int {
+	running := 0
+	for _, container := range b.Repo.All() {
+		if container.RunHandler != nil && container.RunHandler.ProcessTracker != nil {
+			running += len(container.RunHandler.ProcessTracker.ActiveProcesses())
+		}
+	}
+
+	return running
+}
@@ -0,0 +1,91 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/fake_process_tracker"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Drain", func() {
+	var (
+		backend        *gardendocker.Backend
+		fakeCreator    *fakes.FakeCreator
+		processTracker *fake_process_tracker.FakeProcessTracker
+		stateDir       string
+	)
+
+	BeforeEach(func() {
+		var err error
+		stateDir, err = ioutil.TempDir("", "drain")
+		Expect(err).NotTo(HaveOccurred())
+
+		processTracker = new(fake_process_tracker.FakeProcessTracker)
+
+		props := gardendocker.NewPropsHandler(garden.Properties{"some": "property"})
+		props.StatePath = filepath.Join(stateDir, "props.json")
+
+		repo := gardendocker.NewRepo()
+		repo.Add(&gardendocker.Container{
+			InfoHandler: &gardendocker.InfoHandler{
+				Spec:         garden.ContainerSpec{Handle: "some-container"},
+				PropsHandler: props,
+			},
+			RunHandler: &gardendocker.RunHandler{ProcessTracker: processTracker},
+		})
+
+		fakeCreator = new(fakes.FakeCreator)
+		backend = &gardendocker.Backend{
+			Creator: fakeCreator,
+			Repo:    repo,
+			Logger:  lagertest.NewTestLogger("backend"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(stateDir)
+	})
+
+	It("stops accepting new containers", func() {
+		backend.Drain(0)
+
+		_, err := backend.Create(garden.ContainerSpec{})
+		Expect(err).To(Equal(gardendocker.ErrDraining))
+		Expect(fakeCreator.CreateCallCount()).To(Equal(0))
+	})
+
+	It("saves the state of every container", func() {
+		backend.Drain(0)
+		Expect(filepath.Join(stateDir, "props.json")).To(BeAnExistingFile())
+	})
+
+	It("waits for running processes to exit", func() {
+		calls := 0
+		processTracker.ActiveProcessesStub = func() []garden.Process {
+			if calls++; calls < 3 {
+				return []garden.Process{nil}
+			}
+
+			return nil
+		}
+
+		backend.Drain(10 * time.Second)
+		Expect(calls).To(Equal(3))
+	})
+
+	It("gives up waiting after the timeout", func() {
+		processTracker.ActiveProcessesReturns([]garden.Process{nil})
+
+		start := time.Now()
+		backend.Drain(200 * time.Millisecond)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+})
@@ -1,6 +1,12 @@
 package gardendocker
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
 
 type DockerCommandError struct {
 	Stderr string
@@ -10,3 +16,33 @@ type DockerCommandError struct {
 func (err DockerCommandError) Error() string {
 	return fmt.Sprintf("docker: %s (%s)", err.Stderr, err.Cause)
 }
+
+// ServiceUnavailableError is returned when garden-docker cannot take on
+// more work right now, but may be able to later, such as when it already
+// holds MaxContainers containers.
+type ServiceUnavailableError struct {
+	Message string
+}
+
+func (err ServiceUnavailableError) Error() string {
+	return "service unavailable: " + err.Message
+}
+
+// gardenError translates a docker failure for the container with the given
+// handle into the garden error type clients check for, where there is one: a
+// docker container which has gone is a garden container which is not found.
+// Other failures are left as the typed errors dockercli returns.
+func gardenError(handle string, err error) error {
+	if isNoSuchContainer(err) {
+		return garden.ContainerNotFoundError{Handle: handle}
+	}
+
+	return err
+}
+
+// isNoSuchContainer reports whether err is docker saying that the container
+// does not exist.
+func isNoSuchContainer(err error) bool {
+	var dockerErr *dockercli.Error
+	return errors.As(err, &dockerErr) && dockerErr.Reason == "no_such_container"
+}
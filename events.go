@@ -0,0 +1,83 @@
+package gardendocker
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of Event.
+const (
+	EventCreated       = "created"
+	EventDestroyed     = "destroyed"
+	EventReaped        = "reaped"
+	EventStopped       = "stopped"
+	EventOOM           = "oom"
+	EventProcessExited = "process-exited"
+)
+
+// Event is something which happened to a container.
+type Event struct {
+	Kind   string                 `json:"kind"`
+	Handle string                 `json:"handle"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// eventBufferSize is how many events a subscriber may fall behind by before
+// it starts missing them.
+const eventBufferSize = 64
+
+// EventBus passes container events to whoever is subscribed to them. A nil
+// EventBus drops every event, so publishers need not check for one.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish sends an event to every subscriber, stamping it with the current
+// time if it has none. It never blocks: a subscriber which has fallen too
+// far behind misses the event.
+func (e *EventBus) Publish(event Event) {
+	if e == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for subscriber := range e.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on, and a
+// function to unsubscribe, which closes the channel.
+func (e *EventBus) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, eventBufferSize)
+
+	e.mu.Lock()
+	e.subscribers[subscriber] = struct{}{}
+	e.mu.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subscribers, subscriber)
+			e.mu.Unlock()
+
+			close(subscriber)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package gardendocker_test
+
+import (
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventBus", func() {
+	var bus *gardendocker.EventBus
+
+	BeforeEach(func() {
+		bus = gardendocker.NewEventBus()
+	})
+
+	It("sends published events to every subscriber, stamped with the time", func() {
+		first, _ := bus.Subscribe()
+		second, _ := bus.Subscribe()
+
+		bus.Publish(gardendocker.Event{Kind: gardendocker.EventCreated, Handle: "some-handle"})
+
+		for _, events := range []<-chan gardendocker.Event{first, second} {
+			var event gardendocker.Event
+			Eventually(events).Should(Receive(&event))
+			Expect(event.Handle).To(Equal("some-handle"))
+			Expect(event.Time.IsZero()).To(BeFalse())
+		}
+	})
+
+	It("stops sending to, and closes, a subscriber which unsubscribes", func() {
+		events, unsubscribe := bus.Subscribe()
+		unsubscribe()
+		unsubscribe()
+
+		bus.Publish(gardendocker.Event{Kind: gardendocker.EventCreated})
+		Expect(events).To(BeClosed())
+	})
+
+	It("drops events for a subscriber which has fallen behind rather than blocking", func() {
+		events, _ := bus.Subscribe()
+		for i := 0; i < 1000; i++ {
+			bus.Publish(gardendocker.Event{Kind: gardendocker.EventCreated})
+		}
+
+		Expect(len(events)).To(BeNumerically(">", 0))
+	})
+
+	It("drops every event when nil", func() {
+		var nilBus *gardendocker.EventBus
+		nilBus.Publish(gardendocker.Event{Kind: gardendocker.EventCreated})
+	})
+})
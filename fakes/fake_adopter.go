@@ -0,0 +1,62 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+)
+
+type FakeAdopter struct {
+	AdoptStub        func(dockerID string, handle string, props garden.Properties, claim func(dockerID, handle string) error) (*gardendocker.Container, error)
+	adoptMutex       sync.RWMutex
+	adoptArgsForCall []struct {
+		dockerID string
+		handle   string
+		props    garden.Properties
+		claim    func(dockerID, handle string) error
+	}
+	adoptReturns struct {
+		result1 *gardendocker.Container
+		result2 error
+	}
+}
+
+func (fake *FakeAdopter) Adopt(dockerID string, handle string, props garden.Properties, claim func(dockerID, handle string) error) (*gardendocker.Container, error) {
+	fake.adoptMutex.Lock()
+	fake.adoptArgsForCall = append(fake.adoptArgsForCall, struct {
+		dockerID string
+		handle   string
+		props    garden.Properties
+		claim    func(dockerID, handle string) error
+	}{dockerID, handle, props, claim})
+	fake.adoptMutex.Unlock()
+	if fake.AdoptStub != nil {
+		return fake.AdoptStub(dockerID, handle, props, claim)
+	} else {
+		return fake.adoptReturns.result1, fake.adoptReturns.result2
+	}
+}
+
+func (fake *FakeAdopter) AdoptCallCount() int {
+	fake.adoptMutex.RLock()
+	defer fake.adoptMutex.RUnlock()
+	return len(fake.adoptArgsForCall)
+}
+
+func (fake *FakeAdopter) AdoptArgsForCall(i int) (string, string, garden.Properties, func(dockerID, handle string) error) {
+	fake.adoptMutex.RLock()
+	defer fake.adoptMutex.RUnlock()
+	return fake.adoptArgsForCall[i].dockerID, fake.adoptArgsForCall[i].handle, fake.adoptArgsForCall[i].props, fake.adoptArgsForCall[i].claim
+}
+
+func (fake *FakeAdopter) AdoptReturns(result1 *gardendocker.Container, result2 error) {
+	fake.AdoptStub = nil
+	fake.adoptReturns = struct {
+		result1 *gardendocker.Container
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.Adopter = new(FakeAdopter)
@@ -0,0 +1,157 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeCgroup struct {
+	SetMemoryStub        func(limitInBytes uint64) error
+	setMemoryMutex       sync.RWMutex
+	setMemoryArgsForCall []struct {
+		limitInBytes uint64
+	}
+	setMemoryReturns struct {
+		result1 error
+	}
+	MemoryStub        func() (uint64, error)
+	memoryMutex       sync.RWMutex
+	memoryArgsForCall []struct{}
+	memoryReturns     struct {
+		result1 uint64
+		result2 error
+	}
+	SetCPUSharesStub        func(shares uint64) error
+	setCPUSharesMutex       sync.RWMutex
+	setCPUSharesArgsForCall []struct {
+		shares uint64
+	}
+	setCPUSharesReturns struct {
+		result1 error
+	}
+	CPUSharesStub        func() (uint64, error)
+	cPUSharesMutex       sync.RWMutex
+	cPUSharesArgsForCall []struct{}
+	cPUSharesReturns     struct {
+		result1 uint64
+		result2 error
+	}
+}
+
+func (fake *FakeCgroup) SetMemory(limitInBytes uint64) error {
+	fake.setMemoryMutex.Lock()
+	fake.setMemoryArgsForCall = append(fake.setMemoryArgsForCall, struct {
+		limitInBytes uint64
+	}{limitInBytes})
+	fake.setMemoryMutex.Unlock()
+	if fake.SetMemoryStub != nil {
+		return fake.SetMemoryStub(limitInBytes)
+	} else {
+		return fake.setMemoryReturns.result1
+	}
+}
+
+func (fake *FakeCgroup) SetMemoryCallCount() int {
+	fake.setMemoryMutex.RLock()
+	defer fake.setMemoryMutex.RUnlock()
+	return len(fake.setMemoryArgsForCall)
+}
+
+func (fake *FakeCgroup) SetMemoryArgsForCall(i int) uint64 {
+	fake.setMemoryMutex.RLock()
+	defer fake.setMemoryMutex.RUnlock()
+	return fake.setMemoryArgsForCall[i].limitInBytes
+}
+
+func (fake *FakeCgroup) SetMemoryReturns(result1 error) {
+	fake.SetMemoryStub = nil
+	fake.setMemoryReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCgroup) Memory() (uint64, error) {
+	fake.memoryMutex.Lock()
+	fake.memoryArgsForCall = append(fake.memoryArgsForCall, struct{}{})
+	fake.memoryMutex.Unlock()
+	if fake.MemoryStub != nil {
+		return fake.MemoryStub()
+	} else {
+		return fake.memoryReturns.result1, fake.memoryReturns.result2
+	}
+}
+
+func (fake *FakeCgroup) MemoryCallCount() int {
+	fake.memoryMutex.RLock()
+	defer fake.memoryMutex.RUnlock()
+	return len(fake.memoryArgsForCall)
+}
+
+func (fake *FakeCgroup) MemoryReturns(result1 uint64, result2 error) {
+	fake.MemoryStub = nil
+	fake.memoryReturns = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCgroup) SetCPUShares(shares uint64) error {
+	fake.setCPUSharesMutex.Lock()
+	fake.setCPUSharesArgsForCall = append(fake.setCPUSharesArgsForCall, struct {
+		shares uint64
+	}{shares})
+	fake.setCPUSharesMutex.Unlock()
+	if fake.SetCPUSharesStub != nil {
+		return fake.SetCPUSharesStub(shares)
+	} else {
+		return fake.setCPUSharesReturns.result1
+	}
+}
+
+func (fake *FakeCgroup) SetCPUSharesCallCount() int {
+	fake.setCPUSharesMutex.RLock()
+	defer fake.setCPUSharesMutex.RUnlock()
+	return len(fake.setCPUSharesArgsForCall)
+}
+
+func (fake *FakeCgroup) SetCPUSharesArgsForCall(i int) uint64 {
+	fake.setCPUSharesMutex.RLock()
+	defer fake.setCPUSharesMutex.RUnlock()
+	return fake.setCPUSharesArgsForCall[i].shares
+}
+
+func (fake *FakeCgroup) SetCPUSharesReturns(result1 error) {
+	fake.SetCPUSharesStub = nil
+	fake.setCPUSharesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCgroup) CPUShares() (uint64, error) {
+	fake.cPUSharesMutex.Lock()
+	fake.cPUSharesArgsForCall = append(fake.cPUSharesArgsForCall, struct{}{})
+	fake.cPUSharesMutex.Unlock()
+	if fake.CPUSharesStub != nil {
+		return fake.CPUSharesStub()
+	} else {
+		return fake.cPUSharesReturns.result1, fake.cPUSharesReturns.result2
+	}
+}
+
+func (fake *FakeCgroup) CPUSharesCallCount() int {
+	fake.cPUSharesMutex.RLock()
+	defer fake.cPUSharesMutex.RUnlock()
+	return len(fake.cPUSharesArgsForCall)
+}
+
+func (fake *FakeCgroup) CPUSharesReturns(result1 uint64, result2 error) {
+	fake.CPUSharesStub = nil
+	fake.cPUSharesReturns = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.Cgroup = new(FakeCgroup)
@@ -10,9 +10,10 @@ import (
 )
 
 type FakeChain struct {
-	ForwardStub        func(action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) error
+	ForwardStub        func(handle string, action iptables.Action, ip net.IP, port int, proto string, dest_addr string, dest_port int) error
 	forwardMutex       sync.RWMutex
 	forwardArgsForCall []struct {
+		handle    string
 		action    iptables.Action
 		ip        net.IP
 		port      int
@@ -23,21 +24,35 @@ type FakeChain struct {
 	forwardReturns struct {
 		result1 error
 	}
+	ForwardExistsStub        func(handle string, ip net.IP, port int, proto string, dest_addr string, dest_port int) bool
+	forwardExistsMutex       sync.RWMutex
+	forwardExistsArgsForCall []struct {
+		handle    string
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}
+	forwardExistsReturns struct {
+		result1 bool
+	}
 }
 
-func (fake *FakeChain) Forward(action iptables.Action, ip net.IP, port int, proto string, dest_addr string, dest_port int) error {
+func (fake *FakeChain) Forward(handle string, action iptables.Action, ip net.IP, port int, proto string, dest_addr string, dest_port int) error {
 	fake.forwardMutex.Lock()
 	fake.forwardArgsForCall = append(fake.forwardArgsForCall, struct {
+		handle    string
 		action    iptables.Action
 		ip        net.IP
 		port      int
 		proto     string
 		dest_addr string
 		dest_port int
-	}{action, ip, port, proto, dest_addr, dest_port})
+	}{handle, action, ip, port, proto, dest_addr, dest_port})
 	fake.forwardMutex.Unlock()
 	if fake.ForwardStub != nil {
-		return fake.ForwardStub(action, ip, port, proto, dest_addr, dest_port)
+		return fake.ForwardStub(handle, action, ip, port, proto, dest_addr, dest_port)
 	} else {
 		return fake.forwardReturns.result1
 	}
@@ -49,10 +64,10 @@ func (fake *FakeChain) ForwardCallCount() int {
 	return len(fake.forwardArgsForCall)
 }
 
-func (fake *FakeChain) ForwardArgsForCall(i int) (iptables.Action, net.IP, int, string, string, int) {
+func (fake *FakeChain) ForwardArgsForCall(i int) (string, iptables.Action, net.IP, int, string, string, int) {
 	fake.forwardMutex.RLock()
 	defer fake.forwardMutex.RUnlock()
-	return fake.forwardArgsForCall[i].action, fake.forwardArgsForCall[i].ip, fake.forwardArgsForCall[i].port, fake.forwardArgsForCall[i].proto, fake.forwardArgsForCall[i].dest_addr, fake.forwardArgsForCall[i].dest_port
+	return fake.forwardArgsForCall[i].handle, fake.forwardArgsForCall[i].action, fake.forwardArgsForCall[i].ip, fake.forwardArgsForCall[i].port, fake.forwardArgsForCall[i].proto, fake.forwardArgsForCall[i].dest_addr, fake.forwardArgsForCall[i].dest_port
 }
 
 func (fake *FakeChain) ForwardReturns(result1 error) {
@@ -62,4 +77,41 @@ func (fake *FakeChain) ForwardReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeChain) ForwardExists(handle string, ip net.IP, port int, proto string, dest_addr string, dest_port int) bool {
+	fake.forwardExistsMutex.Lock()
+	fake.forwardExistsArgsForCall = append(fake.forwardExistsArgsForCall, struct {
+		handle    string
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}{handle, ip, port, proto, dest_addr, dest_port})
+	fake.forwardExistsMutex.Unlock()
+	if fake.ForwardExistsStub != nil {
+		return fake.ForwardExistsStub(handle, ip, port, proto, dest_addr, dest_port)
+	} else {
+		return fake.forwardExistsReturns.result1
+	}
+}
+
+func (fake *FakeChain) ForwardExistsCallCount() int {
+	fake.forwardExistsMutex.RLock()
+	defer fake.forwardExistsMutex.RUnlock()
+	return len(fake.forwardExistsArgsForCall)
+}
+
+func (fake *FakeChain) ForwardExistsArgsForCall(i int) (string, net.IP, int, string, string, int) {
+	fake.forwardExistsMutex.RLock()
+	defer fake.forwardExistsMutex.RUnlock()
+	return fake.forwardExistsArgsForCall[i].handle, fake.forwardExistsArgsForCall[i].ip, fake.forwardExistsArgsForCall[i].port, fake.forwardExistsArgsForCall[i].proto, fake.forwardExistsArgsForCall[i].dest_addr, fake.forwardExistsArgsForCall[i].dest_port
+}
+
+func (fake *FakeChain) ForwardExistsReturns(result1 bool) {
+	fake.ForwardExistsStub = nil
+	fake.forwardExistsReturns = struct {
+		result1 bool
+	}{result1}
+}
+
 var _ gardendocker.Chain = new(FakeChain)
@@ -0,0 +1,55 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeConnectionTracker struct {
+	HasConnectionsStub        func(ip string) (bool, error)
+	hasConnectionsMutex       sync.RWMutex
+	hasConnectionsArgsForCall []struct {
+		ip string
+	}
+	hasConnectionsReturns struct {
+		result1 bool
+		result2 error
+	}
+}
+
+func (fake *FakeConnectionTracker) HasConnections(ip string) (bool, error) {
+	fake.hasConnectionsMutex.Lock()
+	fake.hasConnectionsArgsForCall = append(fake.hasConnectionsArgsForCall, struct {
+		ip string
+	}{ip})
+	fake.hasConnectionsMutex.Unlock()
+	if fake.HasConnectionsStub != nil {
+		return fake.HasConnectionsStub(ip)
+	} else {
+		return fake.hasConnectionsReturns.result1, fake.hasConnectionsReturns.result2
+	}
+}
+
+func (fake *FakeConnectionTracker) HasConnectionsCallCount() int {
+	fake.hasConnectionsMutex.RLock()
+	defer fake.hasConnectionsMutex.RUnlock()
+	return len(fake.hasConnectionsArgsForCall)
+}
+
+func (fake *FakeConnectionTracker) HasConnectionsArgsForCall(i int) string {
+	fake.hasConnectionsMutex.RLock()
+	defer fake.hasConnectionsMutex.RUnlock()
+	return fake.hasConnectionsArgsForCall[i].ip
+}
+
+func (fake *FakeConnectionTracker) HasConnectionsReturns(result1 bool, result2 error) {
+	fake.HasConnectionsStub = nil
+	fake.hasConnectionsReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.ConnectionTracker = new(FakeConnectionTracker)
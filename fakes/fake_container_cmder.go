@@ -5,32 +5,34 @@ import (
 	"os/exec"
 	"sync"
 
+	"github.com/cloudfoundry-incubator/garden"
 	"github.com/julz/garden-docker"
 )
 
 type FakeContainerCmder struct {
-	CmdStub        func(path string, args ...string) *exec.Cmd
+	CmdStub        func(processID uint32, spec garden.ProcessSpec) (*exec.Cmd, error)
 	cmdMutex       sync.RWMutex
 	cmdArgsForCall []struct {
-		path string
-		args []string
+		processID uint32
+		spec      garden.ProcessSpec
 	}
 	cmdReturns struct {
 		result1 *exec.Cmd
+		result2 error
 	}
 }
 
-func (fake *FakeContainerCmder) Cmd(path string, args ...string) *exec.Cmd {
+func (fake *FakeContainerCmder) Cmd(processID uint32, spec garden.ProcessSpec) (*exec.Cmd, error) {
 	fake.cmdMutex.Lock()
 	fake.cmdArgsForCall = append(fake.cmdArgsForCall, struct {
-		path string
-		args []string
-	}{path, args})
+		processID uint32
+		spec      garden.ProcessSpec
+	}{processID, spec})
 	fake.cmdMutex.Unlock()
 	if fake.CmdStub != nil {
-		return fake.CmdStub(path, args...)
+		return fake.CmdStub(processID, spec)
 	} else {
-		return fake.cmdReturns.result1
+		return fake.cmdReturns.result1, fake.cmdReturns.result2
 	}
 }
 
@@ -40,17 +42,18 @@ func (fake *FakeContainerCmder) CmdCallCount() int {
 	return len(fake.cmdArgsForCall)
 }
 
-func (fake *FakeContainerCmder) CmdArgsForCall(i int) (string, []string) {
+func (fake *FakeContainerCmder) CmdArgsForCall(i int) (uint32, garden.ProcessSpec) {
 	fake.cmdMutex.RLock()
 	defer fake.cmdMutex.RUnlock()
-	return fake.cmdArgsForCall[i].path, fake.cmdArgsForCall[i].args
+	return fake.cmdArgsForCall[i].processID, fake.cmdArgsForCall[i].spec
 }
 
-func (fake *FakeContainerCmder) CmdReturns(result1 *exec.Cmd) {
+func (fake *FakeContainerCmder) CmdReturns(result1 *exec.Cmd, result2 error) {
 	fake.CmdStub = nil
 	fake.cmdReturns = struct {
 		result1 *exec.Cmd
-	}{result1}
+		result2 error
+	}{result1, result2}
 }
 
 var _ gardendocker.ContainerCmder = new(FakeContainerCmder)
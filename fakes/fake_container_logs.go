@@ -0,0 +1,62 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"io"
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeContainerLogs struct {
+	LogsStub        func(container *gardendocker.Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error
+	logsMutex       sync.RWMutex
+	logsArgsForCall []struct {
+		container *gardendocker.Container
+		follow    bool
+		tail      string
+		w         io.Writer
+		stop      <-chan struct{}
+	}
+	logsReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeContainerLogs) Logs(container *gardendocker.Container, follow bool, tail string, w io.Writer, stop <-chan struct{}) error {
+	fake.logsMutex.Lock()
+	fake.logsArgsForCall = append(fake.logsArgsForCall, struct {
+		container *gardendocker.Container
+		follow    bool
+		tail      string
+		w         io.Writer
+		stop      <-chan struct{}
+	}{container, follow, tail, w, stop})
+	fake.logsMutex.Unlock()
+	if fake.LogsStub != nil {
+		return fake.LogsStub(container, follow, tail, w, stop)
+	} else {
+		return fake.logsReturns.result1
+	}
+}
+
+func (fake *FakeContainerLogs) LogsCallCount() int {
+	fake.logsMutex.RLock()
+	defer fake.logsMutex.RUnlock()
+	return len(fake.logsArgsForCall)
+}
+
+func (fake *FakeContainerLogs) LogsArgsForCall(i int) (*gardendocker.Container, bool, string, io.Writer, <-chan struct{}) {
+	fake.logsMutex.RLock()
+	defer fake.logsMutex.RUnlock()
+	return fake.logsArgsForCall[i].container, fake.logsArgsForCall[i].follow, fake.logsArgsForCall[i].tail, fake.logsArgsForCall[i].w, fake.logsArgsForCall[i].stop
+}
+
+func (fake *FakeContainerLogs) LogsReturns(result1 error) {
+	fake.LogsStub = nil
+	fake.logsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.ContainerLogs = new(FakeContainerLogs)
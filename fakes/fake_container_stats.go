@@ -0,0 +1,110 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+)
+
+type FakeContainerStats struct {
+	MemoryStub        func() (garden.ContainerMemoryStat, error)
+	memoryMutex       sync.RWMutex
+	memoryArgsForCall []struct{}
+	memoryReturns     struct {
+		result1 garden.ContainerMemoryStat
+		result2 error
+	}
+	CPUStub        func() (garden.ContainerCPUStat, error)
+	cPUMutex       sync.RWMutex
+	cPUArgsForCall []struct{}
+	cPUReturns     struct {
+		result1 garden.ContainerCPUStat
+		result2 error
+	}
+	OOMKillsStub        func() (uint64, error)
+	oOMKillsMutex       sync.RWMutex
+	oOMKillsArgsForCall []struct{}
+	oOMKillsReturns     struct {
+		result1 uint64
+		result2 error
+	}
+}
+
+func (fake *FakeContainerStats) Memory() (garden.ContainerMemoryStat, error) {
+	fake.memoryMutex.Lock()
+	fake.memoryArgsForCall = append(fake.memoryArgsForCall, struct{}{})
+	fake.memoryMutex.Unlock()
+	if fake.MemoryStub != nil {
+		return fake.MemoryStub()
+	} else {
+		return fake.memoryReturns.result1, fake.memoryReturns.result2
+	}
+}
+
+func (fake *FakeContainerStats) MemoryCallCount() int {
+	fake.memoryMutex.RLock()
+	defer fake.memoryMutex.RUnlock()
+	return len(fake.memoryArgsForCall)
+}
+
+func (fake *FakeContainerStats) MemoryReturns(result1 garden.ContainerMemoryStat, result2 error) {
+	fake.MemoryStub = nil
+	fake.memoryReturns = struct {
+		result1 garden.ContainerMemoryStat
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeContainerStats) CPU() (garden.ContainerCPUStat, error) {
+	fake.cPUMutex.Lock()
+	fake.cPUArgsForCall = append(fake.cPUArgsForCall, struct{}{})
+	fake.cPUMutex.Unlock()
+	if fake.CPUStub != nil {
+		return fake.CPUStub()
+	} else {
+		return fake.cPUReturns.result1, fake.cPUReturns.result2
+	}
+}
+
+func (fake *FakeContainerStats) CPUCallCount() int {
+	fake.cPUMutex.RLock()
+	defer fake.cPUMutex.RUnlock()
+	return len(fake.cPUArgsForCall)
+}
+
+func (fake *FakeContainerStats) CPUReturns(result1 garden.ContainerCPUStat, result2 error) {
+	fake.CPUStub = nil
+	fake.cPUReturns = struct {
+		result1 garden.ContainerCPUStat
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeContainerStats) OOMKills() (uint64, error) {
+	fake.oOMKillsMutex.Lock()
+	fake.oOMKillsArgsForCall = append(fake.oOMKillsArgsForCall, struct{}{})
+	fake.oOMKillsMutex.Unlock()
+	if fake.OOMKillsStub != nil {
+		return fake.OOMKillsStub()
+	} else {
+		return fake.oOMKillsReturns.result1, fake.oOMKillsReturns.result2
+	}
+}
+
+func (fake *FakeContainerStats) OOMKillsCallCount() int {
+	fake.oOMKillsMutex.RLock()
+	defer fake.oOMKillsMutex.RUnlock()
+	return len(fake.oOMKillsArgsForCall)
+}
+
+func (fake *FakeContainerStats) OOMKillsReturns(result1 uint64, result2 error) {
+	fake.OOMKillsStub = nil
+	fake.oOMKillsReturns = struct {
+		result1 uint64
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.ContainerStats = new(FakeContainerStats)
@@ -15,6 +15,14 @@ type FakeDepot struct {
 		result1 string
 		result2 error
 	}
+	DestroyStub        func(string) error
+	destroyMutex       sync.RWMutex
+	destroyArgsForCall []struct {
+		dir string
+	}
+	destroyReturns struct {
+		result1 error
+	}
 }
 
 func (fake *FakeDepot) Create() (string, error) {
@@ -42,4 +50,36 @@ func (fake *FakeDepot) CreateReturns(result1 string, result2 error) {
 	}{result1, result2}
 }
 
+func (fake *FakeDepot) Destroy(dir string) error {
+	fake.destroyMutex.Lock()
+	fake.destroyArgsForCall = append(fake.destroyArgsForCall, struct {
+		dir string
+	}{dir})
+	fake.destroyMutex.Unlock()
+	if fake.DestroyStub != nil {
+		return fake.DestroyStub(dir)
+	} else {
+		return fake.destroyReturns.result1
+	}
+}
+
+func (fake *FakeDepot) DestroyCallCount() int {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return len(fake.destroyArgsForCall)
+}
+
+func (fake *FakeDepot) DestroyArgsForCall(i int) string {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return fake.destroyArgsForCall[i].dir
+}
+
+func (fake *FakeDepot) DestroyReturns(result1 error) {
+	fake.DestroyStub = nil
+	fake.destroyReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ gardendocker.Depot = new(FakeDepot)
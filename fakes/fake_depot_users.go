@@ -0,0 +1,45 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDepotUsers struct {
+	DepotDirsStub        func() (map[string]bool, error)
+	depotDirsMutex       sync.RWMutex
+	depotDirsArgsForCall []struct{}
+	depotDirsReturns     struct {
+		result1 map[string]bool
+		result2 error
+	}
+}
+
+func (fake *FakeDepotUsers) DepotDirs() (map[string]bool, error) {
+	fake.depotDirsMutex.Lock()
+	fake.depotDirsArgsForCall = append(fake.depotDirsArgsForCall, struct{}{})
+	fake.depotDirsMutex.Unlock()
+	if fake.DepotDirsStub != nil {
+		return fake.DepotDirsStub()
+	} else {
+		return fake.depotDirsReturns.result1, fake.depotDirsReturns.result2
+	}
+}
+
+func (fake *FakeDepotUsers) DepotDirsCallCount() int {
+	fake.depotDirsMutex.RLock()
+	defer fake.depotDirsMutex.RUnlock()
+	return len(fake.depotDirsArgsForCall)
+}
+
+func (fake *FakeDepotUsers) DepotDirsReturns(result1 map[string]bool, result2 error) {
+	fake.DepotDirsStub = nil
+	fake.depotDirsReturns = struct {
+		result1 map[string]bool
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.DepotUsers = new(FakeDepotUsers)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDestroyer struct {
+	DestroyStub        func(container *gardendocker.Container) error
+	destroyMutex       sync.RWMutex
+	destroyArgsForCall []struct {
+		container *gardendocker.Container
+	}
+	destroyReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeDestroyer) Destroy(container *gardendocker.Container) error {
+	fake.destroyMutex.Lock()
+	fake.destroyArgsForCall = append(fake.destroyArgsForCall, struct {
+		container *gardendocker.Container
+	}{container})
+	fake.destroyMutex.Unlock()
+	if fake.DestroyStub != nil {
+		return fake.DestroyStub(container)
+	} else {
+		return fake.destroyReturns.result1
+	}
+}
+
+func (fake *FakeDestroyer) DestroyCallCount() int {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return len(fake.destroyArgsForCall)
+}
+
+func (fake *FakeDestroyer) DestroyArgsForCall(i int) *gardendocker.Container {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return fake.destroyArgsForCall[i].container
+}
+
+func (fake *FakeDestroyer) DestroyReturns(result1 error) {
+	fake.DestroyStub = nil
+	fake.destroyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Destroyer = new(FakeDestroyer)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDeviceWhitelist struct {
+	ApplyStub        func(dockerID string) error
+	applyMutex       sync.RWMutex
+	applyArgsForCall []struct {
+		dockerID string
+	}
+	applyReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeDeviceWhitelist) Apply(dockerID string) error {
+	fake.applyMutex.Lock()
+	fake.applyArgsForCall = append(fake.applyArgsForCall, struct {
+		dockerID string
+	}{dockerID})
+	fake.applyMutex.Unlock()
+	if fake.ApplyStub != nil {
+		return fake.ApplyStub(dockerID)
+	} else {
+		return fake.applyReturns.result1
+	}
+}
+
+func (fake *FakeDeviceWhitelist) ApplyCallCount() int {
+	fake.applyMutex.RLock()
+	defer fake.applyMutex.RUnlock()
+	return len(fake.applyArgsForCall)
+}
+
+func (fake *FakeDeviceWhitelist) ApplyArgsForCall(i int) string {
+	fake.applyMutex.RLock()
+	defer fake.applyMutex.RUnlock()
+	return fake.applyArgsForCall[i].dockerID
+}
+
+func (fake *FakeDeviceWhitelist) ApplyReturns(result1 error) {
+	fake.ApplyStub = nil
+	fake.applyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.DeviceWhitelist = new(FakeDeviceWhitelist)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDiskQuota struct {
+	LimitStub        func(bytes uint64) error
+	limitMutex       sync.RWMutex
+	limitArgsForCall []struct {
+		bytes uint64
+	}
+	limitReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeDiskQuota) Limit(bytes uint64) error {
+	fake.limitMutex.Lock()
+	fake.limitArgsForCall = append(fake.limitArgsForCall, struct {
+		bytes uint64
+	}{bytes})
+	fake.limitMutex.Unlock()
+	if fake.LimitStub != nil {
+		return fake.LimitStub(bytes)
+	} else {
+		return fake.limitReturns.result1
+	}
+}
+
+func (fake *FakeDiskQuota) LimitCallCount() int {
+	fake.limitMutex.RLock()
+	defer fake.limitMutex.RUnlock()
+	return len(fake.limitArgsForCall)
+}
+
+func (fake *FakeDiskQuota) LimitArgsForCall(i int) uint64 {
+	fake.limitMutex.RLock()
+	defer fake.limitMutex.RUnlock()
+	return fake.limitArgsForCall[i].bytes
+}
+
+func (fake *FakeDiskQuota) LimitReturns(result1 error) {
+	fake.LimitStub = nil
+	fake.limitReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.DiskQuota = new(FakeDiskQuota)
@@ -0,0 +1,47 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDiskUsage struct {
+	UsageStub        func() (uint64, uint64, error)
+	usageMutex       sync.RWMutex
+	usageArgsForCall []struct{}
+	usageReturns     struct {
+		result1 uint64
+		result2 uint64
+		result3 error
+	}
+}
+
+func (fake *FakeDiskUsage) Usage() (uint64, uint64, error) {
+	fake.usageMutex.Lock()
+	fake.usageArgsForCall = append(fake.usageArgsForCall, struct{}{})
+	fake.usageMutex.Unlock()
+	if fake.UsageStub != nil {
+		return fake.UsageStub()
+	} else {
+		return fake.usageReturns.result1, fake.usageReturns.result2, fake.usageReturns.result3
+	}
+}
+
+func (fake *FakeDiskUsage) UsageCallCount() int {
+	fake.usageMutex.RLock()
+	defer fake.usageMutex.RUnlock()
+	return len(fake.usageArgsForCall)
+}
+
+func (fake *FakeDiskUsage) UsageReturns(result1 uint64, result2 uint64, result3 error) {
+	fake.UsageStub = nil
+	fake.usageReturns = struct {
+		result1 uint64
+		result2 uint64
+		result3 error
+	}{result1, result2, result3}
+}
+
+var _ gardendocker.DiskUsage = new(FakeDiskUsage)
@@ -0,0 +1,179 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDockerContainers struct {
+	RunningStub        func() (map[string]bool, error)
+	runningMutex       sync.RWMutex
+	runningArgsForCall []struct{}
+	runningReturns     struct {
+		result1 map[string]bool
+		result2 error
+	}
+	ExistingStub        func() (map[string]bool, error)
+	existingMutex       sync.RWMutex
+	existingArgsForCall []struct{}
+	existingReturns     struct {
+		result1 map[string]bool
+		result2 error
+	}
+	OwnedStub        func() ([]string, error)
+	ownedMutex       sync.RWMutex
+	ownedArgsForCall []struct{}
+	ownedReturns     struct {
+		result1 []string
+		result2 error
+	}
+	RemoveStub        func(dockerID string) error
+	removeMutex       sync.RWMutex
+	removeArgsForCall []struct {
+		dockerID string
+	}
+	removeReturns struct {
+		result1 error
+	}
+	CreatingStub        func() map[string]bool
+	creatingMutex       sync.RWMutex
+	creatingArgsForCall []struct{}
+	creatingReturns     struct {
+		result1 map[string]bool
+	}
+}
+
+func (fake *FakeDockerContainers) Running() (map[string]bool, error) {
+	fake.runningMutex.Lock()
+	fake.runningArgsForCall = append(fake.runningArgsForCall, struct{}{})
+	fake.runningMutex.Unlock()
+	if fake.RunningStub != nil {
+		return fake.RunningStub()
+	} else {
+		return fake.runningReturns.result1, fake.runningReturns.result2
+	}
+}
+
+func (fake *FakeDockerContainers) RunningCallCount() int {
+	fake.runningMutex.RLock()
+	defer fake.runningMutex.RUnlock()
+	return len(fake.runningArgsForCall)
+}
+
+func (fake *FakeDockerContainers) RunningReturns(result1 map[string]bool, result2 error) {
+	fake.RunningStub = nil
+	fake.runningReturns = struct {
+		result1 map[string]bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerContainers) Existing() (map[string]bool, error) {
+	fake.existingMutex.Lock()
+	fake.existingArgsForCall = append(fake.existingArgsForCall, struct{}{})
+	fake.existingMutex.Unlock()
+	if fake.ExistingStub != nil {
+		return fake.ExistingStub()
+	} else {
+		return fake.existingReturns.result1, fake.existingReturns.result2
+	}
+}
+
+func (fake *FakeDockerContainers) ExistingCallCount() int {
+	fake.existingMutex.RLock()
+	defer fake.existingMutex.RUnlock()
+	return len(fake.existingArgsForCall)
+}
+
+func (fake *FakeDockerContainers) ExistingReturns(result1 map[string]bool, result2 error) {
+	fake.ExistingStub = nil
+	fake.existingReturns = struct {
+		result1 map[string]bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerContainers) Owned() ([]string, error) {
+	fake.ownedMutex.Lock()
+	fake.ownedArgsForCall = append(fake.ownedArgsForCall, struct{}{})
+	fake.ownedMutex.Unlock()
+	if fake.OwnedStub != nil {
+		return fake.OwnedStub()
+	} else {
+		return fake.ownedReturns.result1, fake.ownedReturns.result2
+	}
+}
+
+func (fake *FakeDockerContainers) OwnedCallCount() int {
+	fake.ownedMutex.RLock()
+	defer fake.ownedMutex.RUnlock()
+	return len(fake.ownedArgsForCall)
+}
+
+func (fake *FakeDockerContainers) OwnedReturns(result1 []string, result2 error) {
+	fake.OwnedStub = nil
+	fake.ownedReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerContainers) Remove(dockerID string) error {
+	fake.removeMutex.Lock()
+	fake.removeArgsForCall = append(fake.removeArgsForCall, struct {
+		dockerID string
+	}{dockerID})
+	fake.removeMutex.Unlock()
+	if fake.RemoveStub != nil {
+		return fake.RemoveStub(dockerID)
+	} else {
+		return fake.removeReturns.result1
+	}
+}
+
+func (fake *FakeDockerContainers) RemoveCallCount() int {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return len(fake.removeArgsForCall)
+}
+
+func (fake *FakeDockerContainers) RemoveArgsForCall(i int) string {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return fake.removeArgsForCall[i].dockerID
+}
+
+func (fake *FakeDockerContainers) RemoveReturns(result1 error) {
+	fake.RemoveStub = nil
+	fake.removeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDockerContainers) Creating() map[string]bool {
+	fake.creatingMutex.Lock()
+	fake.creatingArgsForCall = append(fake.creatingArgsForCall, struct{}{})
+	fake.creatingMutex.Unlock()
+	if fake.CreatingStub != nil {
+		return fake.CreatingStub()
+	} else {
+		return fake.creatingReturns.result1
+	}
+}
+
+func (fake *FakeDockerContainers) CreatingCallCount() int {
+	fake.creatingMutex.RLock()
+	defer fake.creatingMutex.RUnlock()
+	return len(fake.creatingArgsForCall)
+}
+
+func (fake *FakeDockerContainers) CreatingReturns(result1 map[string]bool) {
+	fake.CreatingStub = nil
+	fake.creatingReturns = struct {
+		result1 map[string]bool
+	}{result1}
+}
+
+var _ gardendocker.DockerContainers = new(FakeDockerContainers)
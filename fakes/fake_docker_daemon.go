@@ -0,0 +1,45 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeDockerDaemon struct {
+	IdentityStub        func() (string, error)
+	identityMutex       sync.RWMutex
+	identityArgsForCall []struct{}
+	identityReturns     struct {
+		result1 string
+		result2 error
+	}
+}
+
+func (fake *FakeDockerDaemon) Identity() (string, error) {
+	fake.identityMutex.Lock()
+	fake.identityArgsForCall = append(fake.identityArgsForCall, struct{}{})
+	fake.identityMutex.Unlock()
+	if fake.IdentityStub != nil {
+		return fake.IdentityStub()
+	} else {
+		return fake.identityReturns.result1, fake.identityReturns.result2
+	}
+}
+
+func (fake *FakeDockerDaemon) IdentityCallCount() int {
+	fake.identityMutex.RLock()
+	defer fake.identityMutex.RUnlock()
+	return len(fake.identityArgsForCall)
+}
+
+func (fake *FakeDockerDaemon) IdentityReturns(result1 string, result2 error) {
+	fake.IdentityStub = nil
+	fake.identityReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.DockerDaemon = new(FakeDockerDaemon)
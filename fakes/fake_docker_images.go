@@ -0,0 +1,98 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+type FakeDockerImages struct {
+	ImagesStub        func(dockercli.ImagesCmd) ([]dockercli.ImageEntry, error)
+	imagesMutex       sync.RWMutex
+	imagesArgsForCall []struct {
+		arg1 dockercli.ImagesCmd
+	}
+	imagesReturns struct {
+		result1 []dockercli.ImageEntry
+		result2 error
+	}
+	RmiStub        func(dockercli.RmiCmd) (string, error)
+	rmiMutex       sync.RWMutex
+	rmiArgsForCall []struct {
+		arg1 dockercli.RmiCmd
+	}
+	rmiReturns struct {
+		result1 string
+		result2 error
+	}
+}
+
+func (fake *FakeDockerImages) Images(arg1 dockercli.ImagesCmd) ([]dockercli.ImageEntry, error) {
+	fake.imagesMutex.Lock()
+	fake.imagesArgsForCall = append(fake.imagesArgsForCall, struct {
+		arg1 dockercli.ImagesCmd
+	}{arg1})
+	fake.imagesMutex.Unlock()
+	if fake.ImagesStub != nil {
+		return fake.ImagesStub(arg1)
+	} else {
+		return fake.imagesReturns.result1, fake.imagesReturns.result2
+	}
+}
+
+func (fake *FakeDockerImages) ImagesCallCount() int {
+	fake.imagesMutex.RLock()
+	defer fake.imagesMutex.RUnlock()
+	return len(fake.imagesArgsForCall)
+}
+
+func (fake *FakeDockerImages) ImagesArgsForCall(i int) dockercli.ImagesCmd {
+	fake.imagesMutex.RLock()
+	defer fake.imagesMutex.RUnlock()
+	return fake.imagesArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerImages) ImagesReturns(result1 []dockercli.ImageEntry, result2 error) {
+	fake.ImagesStub = nil
+	fake.imagesReturns = struct {
+		result1 []dockercli.ImageEntry
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerImages) Rmi(arg1 dockercli.RmiCmd) (string, error) {
+	fake.rmiMutex.Lock()
+	fake.rmiArgsForCall = append(fake.rmiArgsForCall, struct {
+		arg1 dockercli.RmiCmd
+	}{arg1})
+	fake.rmiMutex.Unlock()
+	if fake.RmiStub != nil {
+		return fake.RmiStub(arg1)
+	} else {
+		return fake.rmiReturns.result1, fake.rmiReturns.result2
+	}
+}
+
+func (fake *FakeDockerImages) RmiCallCount() int {
+	fake.rmiMutex.RLock()
+	defer fake.rmiMutex.RUnlock()
+	return len(fake.rmiArgsForCall)
+}
+
+func (fake *FakeDockerImages) RmiArgsForCall(i int) dockercli.RmiCmd {
+	fake.rmiMutex.RLock()
+	defer fake.rmiMutex.RUnlock()
+	return fake.rmiArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerImages) RmiReturns(result1 string, result2 error) {
+	fake.RmiStub = nil
+	fake.rmiReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.DockerImages = new(FakeDockerImages)
@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"io"
 	"sync"
 
 	"github.com/julz/garden-docker"
@@ -18,15 +19,152 @@ type FakeDockerRunner struct {
 		result1 string
 		result2 error
 	}
-	InspectStub        func(dockercli.InspectCmd) (string, error)
+	InspectStub        func(dockercli.InspectCmd) (dockercli.ContainerJSON, error)
 	inspectMutex       sync.RWMutex
 	inspectArgsForCall []struct {
 		arg1 dockercli.InspectCmd
 	}
 	inspectReturns struct {
+		result1 dockercli.ContainerJSON
+		result2 error
+	}
+	ImageInspectStub        func(dockercli.ImageInspectCmd) (dockercli.ImageJSON, error)
+	imageInspectMutex       sync.RWMutex
+	imageInspectArgsForCall []struct {
+		arg1 dockercli.ImageInspectCmd
+	}
+	imageInspectReturns struct {
+		result1 dockercli.ImageJSON
+		result2 error
+	}
+	RmStub        func(dockercli.RmCmd) (string, error)
+	rmMutex       sync.RWMutex
+	rmArgsForCall []struct {
+		arg1 dockercli.RmCmd
+	}
+	rmReturns struct {
+		result1 string
+		result2 error
+	}
+	PsStub        func(dockercli.PsCmd) ([]dockercli.PsEntry, error)
+	psMutex       sync.RWMutex
+	psArgsForCall []struct {
+		arg1 dockercli.PsCmd
+	}
+	psReturns struct {
+		result1 []dockercli.PsEntry
+		result2 error
+	}
+	PullStub        func(dockercli.PullCmd) (string, error)
+	pullMutex       sync.RWMutex
+	pullArgsForCall []struct {
+		arg1 dockercli.PullCmd
+	}
+	pullReturns struct {
+		result1 string
+		result2 error
+	}
+	StartStub        func(dockercli.StartCmd) (string, error)
+	startMutex       sync.RWMutex
+	startArgsForCall []struct {
+		arg1 dockercli.StartCmd
+	}
+	startReturns struct {
+		result1 string
+		result2 error
+	}
+	StopStub        func(dockercli.StopCmd) (string, error)
+	stopMutex       sync.RWMutex
+	stopArgsForCall []struct {
+		arg1 dockercli.StopCmd
+	}
+	stopReturns struct {
+		result1 string
+		result2 error
+	}
+	UpdateStub        func(dockercli.UpdateCmd) (string, error)
+	updateMutex       sync.RWMutex
+	updateArgsForCall []struct {
+		arg1 dockercli.UpdateCmd
+	}
+	updateReturns struct {
+		result1 string
+		result2 error
+	}
+	LoginStub        func(dockercli.LoginCmd) (string, error)
+	loginMutex       sync.RWMutex
+	loginArgsForCall []struct {
+		arg1 dockercli.LoginCmd
+	}
+	loginReturns struct {
+		result1 string
+		result2 error
+	}
+	CpStub        func(dockercli.CpCmd) (string, error)
+	cpMutex       sync.RWMutex
+	cpArgsForCall []struct {
+		arg1 dockercli.CpCmd
+	}
+	cpReturns struct {
+		result1 string
+		result2 error
+	}
+	CpInStub        func(cmd dockercli.CpCmd, tar io.Reader) error
+	cpInMutex       sync.RWMutex
+	cpInArgsForCall []struct {
+		cmd dockercli.CpCmd
+		tar io.Reader
+	}
+	cpInReturns struct {
+		result1 error
+	}
+	CpOutStub        func(cmd dockercli.CpCmd) (io.ReadCloser, error)
+	cpOutMutex       sync.RWMutex
+	cpOutArgsForCall []struct {
+		cmd dockercli.CpCmd
+	}
+	cpOutReturns struct {
+		result1 io.ReadCloser
+		result2 error
+	}
+	ExecStub        func(dockercli.ExecCmd) (string, error)
+	execMutex       sync.RWMutex
+	execArgsForCall []struct {
+		arg1 dockercli.ExecCmd
+	}
+	execReturns struct {
 		result1 string
 		result2 error
 	}
+	LogsStub        func(cmd dockercli.LogsCmd, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) error
+	logsMutex       sync.RWMutex
+	logsArgsForCall []struct {
+		cmd    dockercli.LogsCmd
+		stdout io.Writer
+		stderr io.Writer
+		stop   <-chan struct{}
+	}
+	logsReturns struct {
+		result1 error
+	}
+	TagStub        func(dockercli.TagCmd) (string, error)
+	tagMutex       sync.RWMutex
+	tagArgsForCall []struct {
+		arg1 dockercli.TagCmd
+	}
+	tagReturns struct {
+		result1 string
+		result2 error
+	}
+	RegistryConfigStub        func(dockercli.RegistryConfigCmd) (dockercli.RegistryConfig, error)
+	registryConfigMutex       sync.RWMutex
+	registryConfigArgsForCall []struct {
+		arg1 dockercli.RegistryConfigCmd
+	}
+	registryConfigReturns struct {
+		result1 dockercli.RegistryConfig
+		result2 error
+	}
 }
 
 func (fake *FakeDockerRunner) Run(arg1 dockercli.RunCmd) (string, error) {
@@ -62,7 +200,7 @@ func (fake *FakeDockerRunner) RunReturns(result1 string, result2 error) {
 	}{result1, result2}
 }
 
-func (fake *FakeDockerRunner) Inspect(arg1 dockercli.InspectCmd) (string, error) {
+func (fake *FakeDockerRunner) Inspect(arg1 dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
 	fake.inspectMutex.Lock()
 	fake.inspectArgsForCall = append(fake.inspectArgsForCall, struct {
 		arg1 dockercli.InspectCmd
@@ -87,12 +225,509 @@ func (fake *FakeDockerRunner) InspectArgsForCall(i int) dockercli.InspectCmd {
 	return fake.inspectArgsForCall[i].arg1
 }
 
-func (fake *FakeDockerRunner) InspectReturns(result1 string, result2 error) {
+func (fake *FakeDockerRunner) InspectReturns(result1 dockercli.ContainerJSON, result2 error) {
 	fake.InspectStub = nil
 	fake.inspectReturns = struct {
+		result1 dockercli.ContainerJSON
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) ImageInspect(arg1 dockercli.ImageInspectCmd) (dockercli.ImageJSON, error) {
+	fake.imageInspectMutex.Lock()
+	fake.imageInspectArgsForCall = append(fake.imageInspectArgsForCall, struct {
+		arg1 dockercli.ImageInspectCmd
+	}{arg1})
+	fake.imageInspectMutex.Unlock()
+	if fake.ImageInspectStub != nil {
+		return fake.ImageInspectStub(arg1)
+	} else {
+		return fake.imageInspectReturns.result1, fake.imageInspectReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) ImageInspectCallCount() int {
+	fake.imageInspectMutex.RLock()
+	defer fake.imageInspectMutex.RUnlock()
+	return len(fake.imageInspectArgsForCall)
+}
+
+func (fake *FakeDockerRunner) ImageInspectArgsForCall(i int) dockercli.ImageInspectCmd {
+	fake.imageInspectMutex.RLock()
+	defer fake.imageInspectMutex.RUnlock()
+	return fake.imageInspectArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) ImageInspectReturns(result1 dockercli.ImageJSON, result2 error) {
+	fake.ImageInspectStub = nil
+	fake.imageInspectReturns = struct {
+		result1 dockercli.ImageJSON
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Rm(arg1 dockercli.RmCmd) (string, error) {
+	fake.rmMutex.Lock()
+	fake.rmArgsForCall = append(fake.rmArgsForCall, struct {
+		arg1 dockercli.RmCmd
+	}{arg1})
+	fake.rmMutex.Unlock()
+	if fake.RmStub != nil {
+		return fake.RmStub(arg1)
+	} else {
+		return fake.rmReturns.result1, fake.rmReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) RmCallCount() int {
+	fake.rmMutex.RLock()
+	defer fake.rmMutex.RUnlock()
+	return len(fake.rmArgsForCall)
+}
+
+func (fake *FakeDockerRunner) RmArgsForCall(i int) dockercli.RmCmd {
+	fake.rmMutex.RLock()
+	defer fake.rmMutex.RUnlock()
+	return fake.rmArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) RmReturns(result1 string, result2 error) {
+	fake.RmStub = nil
+	fake.rmReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Ps(arg1 dockercli.PsCmd) ([]dockercli.PsEntry, error) {
+	fake.psMutex.Lock()
+	fake.psArgsForCall = append(fake.psArgsForCall, struct {
+		arg1 dockercli.PsCmd
+	}{arg1})
+	fake.psMutex.Unlock()
+	if fake.PsStub != nil {
+		return fake.PsStub(arg1)
+	} else {
+		return fake.psReturns.result1, fake.psReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) PsCallCount() int {
+	fake.psMutex.RLock()
+	defer fake.psMutex.RUnlock()
+	return len(fake.psArgsForCall)
+}
+
+func (fake *FakeDockerRunner) PsArgsForCall(i int) dockercli.PsCmd {
+	fake.psMutex.RLock()
+	defer fake.psMutex.RUnlock()
+	return fake.psArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) PsReturns(result1 []dockercli.PsEntry, result2 error) {
+	fake.PsStub = nil
+	fake.psReturns = struct {
+		result1 []dockercli.PsEntry
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Pull(arg1 dockercli.PullCmd) (string, error) {
+	fake.pullMutex.Lock()
+	fake.pullArgsForCall = append(fake.pullArgsForCall, struct {
+		arg1 dockercli.PullCmd
+	}{arg1})
+	fake.pullMutex.Unlock()
+	if fake.PullStub != nil {
+		return fake.PullStub(arg1)
+	} else {
+		return fake.pullReturns.result1, fake.pullReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) PullCallCount() int {
+	fake.pullMutex.RLock()
+	defer fake.pullMutex.RUnlock()
+	return len(fake.pullArgsForCall)
+}
+
+func (fake *FakeDockerRunner) PullArgsForCall(i int) dockercli.PullCmd {
+	fake.pullMutex.RLock()
+	defer fake.pullMutex.RUnlock()
+	return fake.pullArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) PullReturns(result1 string, result2 error) {
+	fake.PullStub = nil
+	fake.pullReturns = struct {
 		result1 string
 		result2 error
 	}{result1, result2}
 }
 
+func (fake *FakeDockerRunner) Start(arg1 dockercli.StartCmd) (string, error) {
+	fake.startMutex.Lock()
+	fake.startArgsForCall = append(fake.startArgsForCall, struct {
+		arg1 dockercli.StartCmd
+	}{arg1})
+	fake.startMutex.Unlock()
+	if fake.StartStub != nil {
+		return fake.StartStub(arg1)
+	} else {
+		return fake.startReturns.result1, fake.startReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) StartCallCount() int {
+	fake.startMutex.RLock()
+	defer fake.startMutex.RUnlock()
+	return len(fake.startArgsForCall)
+}
+
+func (fake *FakeDockerRunner) StartArgsForCall(i int) dockercli.StartCmd {
+	fake.startMutex.RLock()
+	defer fake.startMutex.RUnlock()
+	return fake.startArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) StartReturns(result1 string, result2 error) {
+	fake.StartStub = nil
+	fake.startReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Stop(arg1 dockercli.StopCmd) (string, error) {
+	fake.stopMutex.Lock()
+	fake.stopArgsForCall = append(fake.stopArgsForCall, struct {
+		arg1 dockercli.StopCmd
+	}{arg1})
+	fake.stopMutex.Unlock()
+	if fake.StopStub != nil {
+		return fake.StopStub(arg1)
+	} else {
+		return fake.stopReturns.result1, fake.stopReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) StopCallCount() int {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return len(fake.stopArgsForCall)
+}
+
+func (fake *FakeDockerRunner) StopArgsForCall(i int) dockercli.StopCmd {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return fake.stopArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) StopReturns(result1 string, result2 error) {
+	fake.StopStub = nil
+	fake.stopReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Update(arg1 dockercli.UpdateCmd) (string, error) {
+	fake.updateMutex.Lock()
+	fake.updateArgsForCall = append(fake.updateArgsForCall, struct {
+		arg1 dockercli.UpdateCmd
+	}{arg1})
+	fake.updateMutex.Unlock()
+	if fake.UpdateStub != nil {
+		return fake.UpdateStub(arg1)
+	} else {
+		return fake.updateReturns.result1, fake.updateReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) UpdateCallCount() int {
+	fake.updateMutex.RLock()
+	defer fake.updateMutex.RUnlock()
+	return len(fake.updateArgsForCall)
+}
+
+func (fake *FakeDockerRunner) UpdateArgsForCall(i int) dockercli.UpdateCmd {
+	fake.updateMutex.RLock()
+	defer fake.updateMutex.RUnlock()
+	return fake.updateArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) UpdateReturns(result1 string, result2 error) {
+	fake.UpdateStub = nil
+	fake.updateReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Login(arg1 dockercli.LoginCmd) (string, error) {
+	fake.loginMutex.Lock()
+	fake.loginArgsForCall = append(fake.loginArgsForCall, struct {
+		arg1 dockercli.LoginCmd
+	}{arg1})
+	fake.loginMutex.Unlock()
+	if fake.LoginStub != nil {
+		return fake.LoginStub(arg1)
+	} else {
+		return fake.loginReturns.result1, fake.loginReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) LoginCallCount() int {
+	fake.loginMutex.RLock()
+	defer fake.loginMutex.RUnlock()
+	return len(fake.loginArgsForCall)
+}
+
+func (fake *FakeDockerRunner) LoginArgsForCall(i int) dockercli.LoginCmd {
+	fake.loginMutex.RLock()
+	defer fake.loginMutex.RUnlock()
+	return fake.loginArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) LoginReturns(result1 string, result2 error) {
+	fake.LoginStub = nil
+	fake.loginReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Cp(arg1 dockercli.CpCmd) (string, error) {
+	fake.cpMutex.Lock()
+	fake.cpArgsForCall = append(fake.cpArgsForCall, struct {
+		arg1 dockercli.CpCmd
+	}{arg1})
+	fake.cpMutex.Unlock()
+	if fake.CpStub != nil {
+		return fake.CpStub(arg1)
+	} else {
+		return fake.cpReturns.result1, fake.cpReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) CpCallCount() int {
+	fake.cpMutex.RLock()
+	defer fake.cpMutex.RUnlock()
+	return len(fake.cpArgsForCall)
+}
+
+func (fake *FakeDockerRunner) CpArgsForCall(i int) dockercli.CpCmd {
+	fake.cpMutex.RLock()
+	defer fake.cpMutex.RUnlock()
+	return fake.cpArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) CpReturns(result1 string, result2 error) {
+	fake.CpStub = nil
+	fake.cpReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) CpIn(cmd dockercli.CpCmd, tar io.Reader) error {
+	fake.cpInMutex.Lock()
+	fake.cpInArgsForCall = append(fake.cpInArgsForCall, struct {
+		cmd dockercli.CpCmd
+		tar io.Reader
+	}{cmd, tar})
+	fake.cpInMutex.Unlock()
+	if fake.CpInStub != nil {
+		return fake.CpInStub(cmd, tar)
+	} else {
+		return fake.cpInReturns.result1
+	}
+}
+
+func (fake *FakeDockerRunner) CpInCallCount() int {
+	fake.cpInMutex.RLock()
+	defer fake.cpInMutex.RUnlock()
+	return len(fake.cpInArgsForCall)
+}
+
+func (fake *FakeDockerRunner) CpInArgsForCall(i int) (dockercli.CpCmd, io.Reader) {
+	fake.cpInMutex.RLock()
+	defer fake.cpInMutex.RUnlock()
+	return fake.cpInArgsForCall[i].cmd, fake.cpInArgsForCall[i].tar
+}
+
+func (fake *FakeDockerRunner) CpInReturns(result1 error) {
+	fake.CpInStub = nil
+	fake.cpInReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDockerRunner) CpOut(cmd dockercli.CpCmd) (io.ReadCloser, error) {
+	fake.cpOutMutex.Lock()
+	fake.cpOutArgsForCall = append(fake.cpOutArgsForCall, struct {
+		cmd dockercli.CpCmd
+	}{cmd})
+	fake.cpOutMutex.Unlock()
+	if fake.CpOutStub != nil {
+		return fake.CpOutStub(cmd)
+	} else {
+		return fake.cpOutReturns.result1, fake.cpOutReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) CpOutCallCount() int {
+	fake.cpOutMutex.RLock()
+	defer fake.cpOutMutex.RUnlock()
+	return len(fake.cpOutArgsForCall)
+}
+
+func (fake *FakeDockerRunner) CpOutArgsForCall(i int) dockercli.CpCmd {
+	fake.cpOutMutex.RLock()
+	defer fake.cpOutMutex.RUnlock()
+	return fake.cpOutArgsForCall[i].cmd
+}
+
+func (fake *FakeDockerRunner) CpOutReturns(result1 io.ReadCloser, result2 error) {
+	fake.CpOutStub = nil
+	fake.cpOutReturns = struct {
+		result1 io.ReadCloser
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Exec(arg1 dockercli.ExecCmd) (string, error) {
+	fake.execMutex.Lock()
+	fake.execArgsForCall = append(fake.execArgsForCall, struct {
+		arg1 dockercli.ExecCmd
+	}{arg1})
+	fake.execMutex.Unlock()
+	if fake.ExecStub != nil {
+		return fake.ExecStub(arg1)
+	} else {
+		return fake.execReturns.result1, fake.execReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) ExecCallCount() int {
+	fake.execMutex.RLock()
+	defer fake.execMutex.RUnlock()
+	return len(fake.execArgsForCall)
+}
+
+func (fake *FakeDockerRunner) ExecArgsForCall(i int) dockercli.ExecCmd {
+	fake.execMutex.RLock()
+	defer fake.execMutex.RUnlock()
+	return fake.execArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) ExecReturns(result1 string, result2 error) {
+	fake.ExecStub = nil
+	fake.execReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) Logs(cmd dockercli.LogsCmd, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) error {
+	fake.logsMutex.Lock()
+	fake.logsArgsForCall = append(fake.logsArgsForCall, struct {
+		cmd    dockercli.LogsCmd
+		stdout io.Writer
+		stderr io.Writer
+		stop   <-chan struct{}
+	}{cmd, stdout, stderr, stop})
+	fake.logsMutex.Unlock()
+	if fake.LogsStub != nil {
+		return fake.LogsStub(cmd, stdout, stderr, stop)
+	} else {
+		return fake.logsReturns.result1
+	}
+}
+
+func (fake *FakeDockerRunner) LogsCallCount() int {
+	fake.logsMutex.RLock()
+	defer fake.logsMutex.RUnlock()
+	return len(fake.logsArgsForCall)
+}
+
+func (fake *FakeDockerRunner) LogsArgsForCall(i int) (dockercli.LogsCmd, io.Writer, io.Writer, <-chan struct{}) {
+	fake.logsMutex.RLock()
+	defer fake.logsMutex.RUnlock()
+	return fake.logsArgsForCall[i].cmd, fake.logsArgsForCall[i].stdout, fake.logsArgsForCall[i].stderr, fake.logsArgsForCall[i].stop
+}
+
+func (fake *FakeDockerRunner) LogsReturns(result1 error) {
+	fake.LogsStub = nil
+	fake.logsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDockerRunner) Tag(arg1 dockercli.TagCmd) (string, error) {
+	fake.tagMutex.Lock()
+	fake.tagArgsForCall = append(fake.tagArgsForCall, struct {
+		arg1 dockercli.TagCmd
+	}{arg1})
+	fake.tagMutex.Unlock()
+	if fake.TagStub != nil {
+		return fake.TagStub(arg1)
+	} else {
+		return fake.tagReturns.result1, fake.tagReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) TagCallCount() int {
+	fake.tagMutex.RLock()
+	defer fake.tagMutex.RUnlock()
+	return len(fake.tagArgsForCall)
+}
+
+func (fake *FakeDockerRunner) TagArgsForCall(i int) dockercli.TagCmd {
+	fake.tagMutex.RLock()
+	defer fake.tagMutex.RUnlock()
+	return fake.tagArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) TagReturns(result1 string, result2 error) {
+	fake.TagStub = nil
+	fake.tagReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerRunner) RegistryConfig(arg1 dockercli.RegistryConfigCmd) (dockercli.RegistryConfig, error) {
+	fake.registryConfigMutex.Lock()
+	fake.registryConfigArgsForCall = append(fake.registryConfigArgsForCall, struct {
+		arg1 dockercli.RegistryConfigCmd
+	}{arg1})
+	fake.registryConfigMutex.Unlock()
+	if fake.RegistryConfigStub != nil {
+		return fake.RegistryConfigStub(arg1)
+	} else {
+		return fake.registryConfigReturns.result1, fake.registryConfigReturns.result2
+	}
+}
+
+func (fake *FakeDockerRunner) RegistryConfigCallCount() int {
+	fake.registryConfigMutex.RLock()
+	defer fake.registryConfigMutex.RUnlock()
+	return len(fake.registryConfigArgsForCall)
+}
+
+func (fake *FakeDockerRunner) RegistryConfigArgsForCall(i int) dockercli.RegistryConfigCmd {
+	fake.registryConfigMutex.RLock()
+	defer fake.registryConfigMutex.RUnlock()
+	return fake.registryConfigArgsForCall[i].arg1
+}
+
+func (fake *FakeDockerRunner) RegistryConfigReturns(result1 dockercli.RegistryConfig, result2 error) {
+	fake.RegistryConfigStub = nil
+	fake.registryConfigReturns = struct {
+		result1 dockercli.RegistryConfig
+		result2 error
+	}{result1, result2}
+}
+
 var _ gardendocker.DockerRunner = new(FakeDockerRunner)
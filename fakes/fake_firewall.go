@@ -0,0 +1,140 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+)
+
+type FakeFirewall struct {
+	SetupStub        func(id string, containerIP string) error
+	setupMutex       sync.RWMutex
+	setupArgsForCall []struct {
+		id          string
+		containerIP string
+	}
+	setupReturns struct {
+		result1 error
+	}
+	AllowStub        func(id string, rule garden.NetOutRule) error
+	allowMutex       sync.RWMutex
+	allowArgsForCall []struct {
+		id   string
+		rule garden.NetOutRule
+	}
+	allowReturns struct {
+		result1 error
+	}
+	TeardownStub        func(id string, containerIP string) error
+	teardownMutex       sync.RWMutex
+	teardownArgsForCall []struct {
+		id          string
+		containerIP string
+	}
+	teardownReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeFirewall) Setup(id string, containerIP string) error {
+	fake.setupMutex.Lock()
+	fake.setupArgsForCall = append(fake.setupArgsForCall, struct {
+		id          string
+		containerIP string
+	}{id, containerIP})
+	fake.setupMutex.Unlock()
+	if fake.SetupStub != nil {
+		return fake.SetupStub(id, containerIP)
+	} else {
+		return fake.setupReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) SetupCallCount() int {
+	fake.setupMutex.RLock()
+	defer fake.setupMutex.RUnlock()
+	return len(fake.setupArgsForCall)
+}
+
+func (fake *FakeFirewall) SetupArgsForCall(i int) (string, string) {
+	fake.setupMutex.RLock()
+	defer fake.setupMutex.RUnlock()
+	return fake.setupArgsForCall[i].id, fake.setupArgsForCall[i].containerIP
+}
+
+func (fake *FakeFirewall) SetupReturns(result1 error) {
+	fake.SetupStub = nil
+	fake.setupReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Allow(id string, rule garden.NetOutRule) error {
+	fake.allowMutex.Lock()
+	fake.allowArgsForCall = append(fake.allowArgsForCall, struct {
+		id   string
+		rule garden.NetOutRule
+	}{id, rule})
+	fake.allowMutex.Unlock()
+	if fake.AllowStub != nil {
+		return fake.AllowStub(id, rule)
+	} else {
+		return fake.allowReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) AllowCallCount() int {
+	fake.allowMutex.RLock()
+	defer fake.allowMutex.RUnlock()
+	return len(fake.allowArgsForCall)
+}
+
+func (fake *FakeFirewall) AllowArgsForCall(i int) (string, garden.NetOutRule) {
+	fake.allowMutex.RLock()
+	defer fake.allowMutex.RUnlock()
+	return fake.allowArgsForCall[i].id, fake.allowArgsForCall[i].rule
+}
+
+func (fake *FakeFirewall) AllowReturns(result1 error) {
+	fake.AllowStub = nil
+	fake.allowReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Teardown(id string, containerIP string) error {
+	fake.teardownMutex.Lock()
+	fake.teardownArgsForCall = append(fake.teardownArgsForCall, struct {
+		id          string
+		containerIP string
+	}{id, containerIP})
+	fake.teardownMutex.Unlock()
+	if fake.TeardownStub != nil {
+		return fake.TeardownStub(id, containerIP)
+	} else {
+		return fake.teardownReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) TeardownCallCount() int {
+	fake.teardownMutex.RLock()
+	defer fake.teardownMutex.RUnlock()
+	return len(fake.teardownArgsForCall)
+}
+
+func (fake *FakeFirewall) TeardownArgsForCall(i int) (string, string) {
+	fake.teardownMutex.RLock()
+	defer fake.teardownMutex.RUnlock()
+	return fake.teardownArgsForCall[i].id, fake.teardownArgsForCall[i].containerIP
+}
+
+func (fake *FakeFirewall) TeardownReturns(result1 error) {
+	fake.TeardownStub = nil
+	fake.teardownReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Firewall = new(FakeFirewall)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeImagePuller struct {
+	PullImageStub        func(rootfsPath string) error
+	pullImageMutex       sync.RWMutex
+	pullImageArgsForCall []struct {
+		rootfsPath string
+	}
+	pullImageReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeImagePuller) PullImage(rootfsPath string) error {
+	fake.pullImageMutex.Lock()
+	fake.pullImageArgsForCall = append(fake.pullImageArgsForCall, struct {
+		rootfsPath string
+	}{rootfsPath})
+	fake.pullImageMutex.Unlock()
+	if fake.PullImageStub != nil {
+		return fake.PullImageStub(rootfsPath)
+	} else {
+		return fake.pullImageReturns.result1
+	}
+}
+
+func (fake *FakeImagePuller) PullImageCallCount() int {
+	fake.pullImageMutex.RLock()
+	defer fake.pullImageMutex.RUnlock()
+	return len(fake.pullImageArgsForCall)
+}
+
+func (fake *FakeImagePuller) PullImageArgsForCall(i int) string {
+	fake.pullImageMutex.RLock()
+	defer fake.pullImageMutex.RUnlock()
+	return fake.pullImageArgsForCall[i].rootfsPath
+}
+
+func (fake *FakeImagePuller) PullImageReturns(result1 error) {
+	fake.PullImageStub = nil
+	fake.pullImageReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.ImagePuller = new(FakeImagePuller)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeLinkConfigurer struct {
+	ConfigureStub        func(pid int) error
+	configureMutex       sync.RWMutex
+	configureArgsForCall []struct {
+		pid int
+	}
+	configureReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeLinkConfigurer) Configure(pid int) error {
+	fake.configureMutex.Lock()
+	fake.configureArgsForCall = append(fake.configureArgsForCall, struct {
+		pid int
+	}{pid})
+	fake.configureMutex.Unlock()
+	if fake.ConfigureStub != nil {
+		return fake.ConfigureStub(pid)
+	} else {
+		return fake.configureReturns.result1
+	}
+}
+
+func (fake *FakeLinkConfigurer) ConfigureCallCount() int {
+	fake.configureMutex.RLock()
+	defer fake.configureMutex.RUnlock()
+	return len(fake.configureArgsForCall)
+}
+
+func (fake *FakeLinkConfigurer) ConfigureArgsForCall(i int) int {
+	fake.configureMutex.RLock()
+	defer fake.configureMutex.RUnlock()
+	return fake.configureArgsForCall[i].pid
+}
+
+func (fake *FakeLinkConfigurer) ConfigureReturns(result1 error) {
+	fake.ConfigureStub = nil
+	fake.configureReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.LinkConfigurer = new(FakeLinkConfigurer)
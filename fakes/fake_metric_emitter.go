@@ -0,0 +1,97 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeMetricEmitter struct {
+	SendValueStub        func(name string, value float64, unit string) error
+	sendValueMutex       sync.RWMutex
+	sendValueArgsForCall []struct {
+		name  string
+		value float64
+		unit  string
+	}
+	sendValueReturns struct {
+		result1 error
+	}
+	IncrementCounterStub        func(name string) error
+	incrementCounterMutex       sync.RWMutex
+	incrementCounterArgsForCall []struct {
+		name string
+	}
+	incrementCounterReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeMetricEmitter) SendValue(name string, value float64, unit string) error {
+	fake.sendValueMutex.Lock()
+	fake.sendValueArgsForCall = append(fake.sendValueArgsForCall, struct {
+		name  string
+		value float64
+		unit  string
+	}{name, value, unit})
+	fake.sendValueMutex.Unlock()
+	if fake.SendValueStub != nil {
+		return fake.SendValueStub(name, value, unit)
+	} else {
+		return fake.sendValueReturns.result1
+	}
+}
+
+func (fake *FakeMetricEmitter) SendValueCallCount() int {
+	fake.sendValueMutex.RLock()
+	defer fake.sendValueMutex.RUnlock()
+	return len(fake.sendValueArgsForCall)
+}
+
+func (fake *FakeMetricEmitter) SendValueArgsForCall(i int) (string, float64, string) {
+	fake.sendValueMutex.RLock()
+	defer fake.sendValueMutex.RUnlock()
+	return fake.sendValueArgsForCall[i].name, fake.sendValueArgsForCall[i].value, fake.sendValueArgsForCall[i].unit
+}
+
+func (fake *FakeMetricEmitter) SendValueReturns(result1 error) {
+	fake.SendValueStub = nil
+	fake.sendValueReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeMetricEmitter) IncrementCounter(name string) error {
+	fake.incrementCounterMutex.Lock()
+	fake.incrementCounterArgsForCall = append(fake.incrementCounterArgsForCall, struct {
+		name string
+	}{name})
+	fake.incrementCounterMutex.Unlock()
+	if fake.IncrementCounterStub != nil {
+		return fake.IncrementCounterStub(name)
+	} else {
+		return fake.incrementCounterReturns.result1
+	}
+}
+
+func (fake *FakeMetricEmitter) IncrementCounterCallCount() int {
+	fake.incrementCounterMutex.RLock()
+	defer fake.incrementCounterMutex.RUnlock()
+	return len(fake.incrementCounterArgsForCall)
+}
+
+func (fake *FakeMetricEmitter) IncrementCounterArgsForCall(i int) string {
+	fake.incrementCounterMutex.RLock()
+	defer fake.incrementCounterMutex.RUnlock()
+	return fake.incrementCounterArgsForCall[i].name
+}
+
+func (fake *FakeMetricEmitter) IncrementCounterReturns(result1 error) {
+	fake.IncrementCounterStub = nil
+	fake.incrementCounterReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.MetricEmitter = new(FakeMetricEmitter)
@@ -0,0 +1,199 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/docker/docker/pkg/iptables"
+	"github.com/julz/garden-docker"
+)
+
+type FakeNetworker struct {
+	ForwardStub        func(handle string, action iptables.Action, ip net.IP, port int, proto string, dest_addr string, dest_port int) error
+	forwardMutex       sync.RWMutex
+	forwardArgsForCall []struct {
+		handle    string
+		action    iptables.Action
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}
+	forwardReturns struct {
+		result1 error
+	}
+	ForwardExistsStub        func(handle string, ip net.IP, port int, proto string, dest_addr string, dest_port int) bool
+	forwardExistsMutex       sync.RWMutex
+	forwardExistsArgsForCall []struct {
+		handle    string
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}
+	forwardExistsReturns struct {
+		result1 bool
+	}
+	UpStub        func(container gardendocker.NetworkContainer) (string, error)
+	upMutex       sync.RWMutex
+	upArgsForCall []struct {
+		container gardendocker.NetworkContainer
+	}
+	upReturns struct {
+		result1 string
+		result2 error
+	}
+	DownStub        func(container gardendocker.NetworkContainer) error
+	downMutex       sync.RWMutex
+	downArgsForCall []struct {
+		container gardendocker.NetworkContainer
+	}
+	downReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeNetworker) Forward(handle string, action iptables.Action, ip net.IP, port int, proto string, dest_addr string, dest_port int) error {
+	fake.forwardMutex.Lock()
+	fake.forwardArgsForCall = append(fake.forwardArgsForCall, struct {
+		handle    string
+		action    iptables.Action
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}{handle, action, ip, port, proto, dest_addr, dest_port})
+	fake.forwardMutex.Unlock()
+	if fake.ForwardStub != nil {
+		return fake.ForwardStub(handle, action, ip, port, proto, dest_addr, dest_port)
+	} else {
+		return fake.forwardReturns.result1
+	}
+}
+
+func (fake *FakeNetworker) ForwardCallCount() int {
+	fake.forwardMutex.RLock()
+	defer fake.forwardMutex.RUnlock()
+	return len(fake.forwardArgsForCall)
+}
+
+func (fake *FakeNetworker) ForwardArgsForCall(i int) (string, iptables.Action, net.IP, int, string, string, int) {
+	fake.forwardMutex.RLock()
+	defer fake.forwardMutex.RUnlock()
+	return fake.forwardArgsForCall[i].handle, fake.forwardArgsForCall[i].action, fake.forwardArgsForCall[i].ip, fake.forwardArgsForCall[i].port, fake.forwardArgsForCall[i].proto, fake.forwardArgsForCall[i].dest_addr, fake.forwardArgsForCall[i].dest_port
+}
+
+func (fake *FakeNetworker) ForwardReturns(result1 error) {
+	fake.ForwardStub = nil
+	fake.forwardReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNetworker) ForwardExists(handle string, ip net.IP, port int, proto string, dest_addr string, dest_port int) bool {
+	fake.forwardExistsMutex.Lock()
+	fake.forwardExistsArgsForCall = append(fake.forwardExistsArgsForCall, struct {
+		handle    string
+		ip        net.IP
+		port      int
+		proto     string
+		dest_addr string
+		dest_port int
+	}{handle, ip, port, proto, dest_addr, dest_port})
+	fake.forwardExistsMutex.Unlock()
+	if fake.ForwardExistsStub != nil {
+		return fake.ForwardExistsStub(handle, ip, port, proto, dest_addr, dest_port)
+	} else {
+		return fake.forwardExistsReturns.result1
+	}
+}
+
+func (fake *FakeNetworker) ForwardExistsCallCount() int {
+	fake.forwardExistsMutex.RLock()
+	defer fake.forwardExistsMutex.RUnlock()
+	return len(fake.forwardExistsArgsForCall)
+}
+
+func (fake *FakeNetworker) ForwardExistsArgsForCall(i int) (string, net.IP, int, string, string, int) {
+	fake.forwardExistsMutex.RLock()
+	defer fake.forwardExistsMutex.RUnlock()
+	return fake.forwardExistsArgsForCall[i].handle, fake.forwardExistsArgsForCall[i].ip, fake.forwardExistsArgsForCall[i].port, fake.forwardExistsArgsForCall[i].proto, fake.forwardExistsArgsForCall[i].dest_addr, fake.forwardExistsArgsForCall[i].dest_port
+}
+
+func (fake *FakeNetworker) ForwardExistsReturns(result1 bool) {
+	fake.ForwardExistsStub = nil
+	fake.forwardExistsReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeNetworker) Up(container gardendocker.NetworkContainer) (string, error) {
+	fake.upMutex.Lock()
+	fake.upArgsForCall = append(fake.upArgsForCall, struct {
+		container gardendocker.NetworkContainer
+	}{container})
+	fake.upMutex.Unlock()
+	if fake.UpStub != nil {
+		return fake.UpStub(container)
+	} else {
+		return fake.upReturns.result1, fake.upReturns.result2
+	}
+}
+
+func (fake *FakeNetworker) UpCallCount() int {
+	fake.upMutex.RLock()
+	defer fake.upMutex.RUnlock()
+	return len(fake.upArgsForCall)
+}
+
+func (fake *FakeNetworker) UpArgsForCall(i int) gardendocker.NetworkContainer {
+	fake.upMutex.RLock()
+	defer fake.upMutex.RUnlock()
+	return fake.upArgsForCall[i].container
+}
+
+func (fake *FakeNetworker) UpReturns(result1 string, result2 error) {
+	fake.UpStub = nil
+	fake.upReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeNetworker) Down(container gardendocker.NetworkContainer) error {
+	fake.downMutex.Lock()
+	fake.downArgsForCall = append(fake.downArgsForCall, struct {
+		container gardendocker.NetworkContainer
+	}{container})
+	fake.downMutex.Unlock()
+	if fake.DownStub != nil {
+		return fake.DownStub(container)
+	} else {
+		return fake.downReturns.result1
+	}
+}
+
+func (fake *FakeNetworker) DownCallCount() int {
+	fake.downMutex.RLock()
+	defer fake.downMutex.RUnlock()
+	return len(fake.downArgsForCall)
+}
+
+func (fake *FakeNetworker) DownArgsForCall(i int) gardendocker.NetworkContainer {
+	fake.downMutex.RLock()
+	defer fake.downMutex.RUnlock()
+	return fake.downArgsForCall[i].container
+}
+
+func (fake *FakeNetworker) DownReturns(result1 error) {
+	fake.DownStub = nil
+	fake.downReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Networker = new(FakeNetworker)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeRecoverer struct {
+	RecoverStub        func(container *gardendocker.Container) error
+	recoverMutex       sync.RWMutex
+	recoverArgsForCall []struct {
+		container *gardendocker.Container
+	}
+	recoverReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeRecoverer) Recover(container *gardendocker.Container) error {
+	fake.recoverMutex.Lock()
+	fake.recoverArgsForCall = append(fake.recoverArgsForCall, struct {
+		container *gardendocker.Container
+	}{container})
+	fake.recoverMutex.Unlock()
+	if fake.RecoverStub != nil {
+		return fake.RecoverStub(container)
+	} else {
+		return fake.recoverReturns.result1
+	}
+}
+
+func (fake *FakeRecoverer) RecoverCallCount() int {
+	fake.recoverMutex.RLock()
+	defer fake.recoverMutex.RUnlock()
+	return len(fake.recoverArgsForCall)
+}
+
+func (fake *FakeRecoverer) RecoverArgsForCall(i int) *gardendocker.Container {
+	fake.recoverMutex.RLock()
+	defer fake.recoverMutex.RUnlock()
+	return fake.recoverArgsForCall[i].container
+}
+
+func (fake *FakeRecoverer) RecoverReturns(result1 error) {
+	fake.RecoverStub = nil
+	fake.recoverReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Recoverer = new(FakeRecoverer)
@@ -0,0 +1,56 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeRestorer struct {
+	RestoreStub        func(logger lager.Logger) ([]*gardendocker.Container, error)
+	restoreMutex       sync.RWMutex
+	restoreArgsForCall []struct {
+		logger lager.Logger
+	}
+	restoreReturns struct {
+		result1 []*gardendocker.Container
+		result2 error
+	}
+}
+
+func (fake *FakeRestorer) Restore(logger lager.Logger) ([]*gardendocker.Container, error) {
+	fake.restoreMutex.Lock()
+	fake.restoreArgsForCall = append(fake.restoreArgsForCall, struct {
+		logger lager.Logger
+	}{logger})
+	fake.restoreMutex.Unlock()
+	if fake.RestoreStub != nil {
+		return fake.RestoreStub(logger)
+	} else {
+		return fake.restoreReturns.result1, fake.restoreReturns.result2
+	}
+}
+
+func (fake *FakeRestorer) RestoreCallCount() int {
+	fake.restoreMutex.RLock()
+	defer fake.restoreMutex.RUnlock()
+	return len(fake.restoreArgsForCall)
+}
+
+func (fake *FakeRestorer) RestoreArgsForCall(i int) lager.Logger {
+	fake.restoreMutex.RLock()
+	defer fake.restoreMutex.RUnlock()
+	return fake.restoreArgsForCall[i].logger
+}
+
+func (fake *FakeRestorer) RestoreReturns(result1 []*gardendocker.Container, result2 error) {
+	fake.RestoreStub = nil
+	fake.restoreReturns = struct {
+		result1 []*gardendocker.Container
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.Restorer = new(FakeRestorer)
@@ -0,0 +1,95 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeRuleSweeper struct {
+	RemoveStub        func(handle string) error
+	removeMutex       sync.RWMutex
+	removeArgsForCall []struct {
+		handle string
+	}
+	removeReturns struct {
+		result1 error
+	}
+	SweepStub        func(live map[string]bool) (int, error)
+	sweepMutex       sync.RWMutex
+	sweepArgsForCall []struct {
+		live map[string]bool
+	}
+	sweepReturns struct {
+		result1 int
+		result2 error
+	}
+}
+
+func (fake *FakeRuleSweeper) Remove(handle string) error {
+	fake.removeMutex.Lock()
+	fake.removeArgsForCall = append(fake.removeArgsForCall, struct {
+		handle string
+	}{handle})
+	fake.removeMutex.Unlock()
+	if fake.RemoveStub != nil {
+		return fake.RemoveStub(handle)
+	} else {
+		return fake.removeReturns.result1
+	}
+}
+
+func (fake *FakeRuleSweeper) RemoveCallCount() int {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return len(fake.removeArgsForCall)
+}
+
+func (fake *FakeRuleSweeper) RemoveArgsForCall(i int) string {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return fake.removeArgsForCall[i].handle
+}
+
+func (fake *FakeRuleSweeper) RemoveReturns(result1 error) {
+	fake.RemoveStub = nil
+	fake.removeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuleSweeper) Sweep(live map[string]bool) (int, error) {
+	fake.sweepMutex.Lock()
+	fake.sweepArgsForCall = append(fake.sweepArgsForCall, struct {
+		live map[string]bool
+	}{live})
+	fake.sweepMutex.Unlock()
+	if fake.SweepStub != nil {
+		return fake.SweepStub(live)
+	} else {
+		return fake.sweepReturns.result1, fake.sweepReturns.result2
+	}
+}
+
+func (fake *FakeRuleSweeper) SweepCallCount() int {
+	fake.sweepMutex.RLock()
+	defer fake.sweepMutex.RUnlock()
+	return len(fake.sweepArgsForCall)
+}
+
+func (fake *FakeRuleSweeper) SweepArgsForCall(i int) map[string]bool {
+	fake.sweepMutex.RLock()
+	defer fake.sweepMutex.RUnlock()
+	return fake.sweepArgsForCall[i].live
+}
+
+func (fake *FakeRuleSweeper) SweepReturns(result1 int, result2 error) {
+	fake.SweepStub = nil
+	fake.sweepReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.RuleSweeper = new(FakeRuleSweeper)
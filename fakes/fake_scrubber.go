@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeScrubber struct {
+	ScrubStub        func(dir string) error
+	scrubMutex       sync.RWMutex
+	scrubArgsForCall []struct {
+		dir string
+	}
+	scrubReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeScrubber) Scrub(dir string) error {
+	fake.scrubMutex.Lock()
+	fake.scrubArgsForCall = append(fake.scrubArgsForCall, struct {
+		dir string
+	}{dir})
+	fake.scrubMutex.Unlock()
+	if fake.ScrubStub != nil {
+		return fake.ScrubStub(dir)
+	} else {
+		return fake.scrubReturns.result1
+	}
+}
+
+func (fake *FakeScrubber) ScrubCallCount() int {
+	fake.scrubMutex.RLock()
+	defer fake.scrubMutex.RUnlock()
+	return len(fake.scrubArgsForCall)
+}
+
+func (fake *FakeScrubber) ScrubArgsForCall(i int) string {
+	fake.scrubMutex.RLock()
+	defer fake.scrubMutex.RUnlock()
+	return fake.scrubArgsForCall[i].dir
+}
+
+func (fake *FakeScrubber) ScrubReturns(result1 error) {
+	fake.ScrubStub = nil
+	fake.scrubReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Scrubber = new(FakeScrubber)
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeStopper struct {
+	StopStub        func(container *gardendocker.Container) error
+	stopMutex       sync.RWMutex
+	stopArgsForCall []struct {
+		container *gardendocker.Container
+	}
+	stopReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeStopper) Stop(container *gardendocker.Container) error {
+	fake.stopMutex.Lock()
+	fake.stopArgsForCall = append(fake.stopArgsForCall, struct {
+		container *gardendocker.Container
+	}{container})
+	fake.stopMutex.Unlock()
+	if fake.StopStub != nil {
+		return fake.StopStub(container)
+	} else {
+		return fake.stopReturns.result1
+	}
+}
+
+func (fake *FakeStopper) StopCallCount() int {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return len(fake.stopArgsForCall)
+}
+
+func (fake *FakeStopper) StopArgsForCall(i int) *gardendocker.Container {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return fake.stopArgsForCall[i].container
+}
+
+func (fake *FakeStopper) StopReturns(result1 error) {
+	fake.StopStub = nil
+	fake.stopReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gardendocker.Stopper = new(FakeStopper)
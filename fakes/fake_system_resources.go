@@ -0,0 +1,45 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeSystemResources struct {
+	TotalStub        func() (gardendocker.Resources, error)
+	totalMutex       sync.RWMutex
+	totalArgsForCall []struct{}
+	totalReturns     struct {
+		result1 gardendocker.Resources
+		result2 error
+	}
+}
+
+func (fake *FakeSystemResources) Total() (gardendocker.Resources, error) {
+	fake.totalMutex.Lock()
+	fake.totalArgsForCall = append(fake.totalArgsForCall, struct{}{})
+	fake.totalMutex.Unlock()
+	if fake.TotalStub != nil {
+		return fake.TotalStub()
+	} else {
+		return fake.totalReturns.result1, fake.totalReturns.result2
+	}
+}
+
+func (fake *FakeSystemResources) TotalCallCount() int {
+	fake.totalMutex.RLock()
+	defer fake.totalMutex.RUnlock()
+	return len(fake.totalArgsForCall)
+}
+
+func (fake *FakeSystemResources) TotalReturns(result1 gardendocker.Resources, result2 error) {
+	fake.TotalStub = nil
+	fake.totalReturns = struct {
+		result1 gardendocker.Resources
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.SystemResources = new(FakeSystemResources)
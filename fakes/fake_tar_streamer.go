@@ -0,0 +1,100 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"io"
+	"sync"
+
+	"github.com/julz/garden-docker"
+)
+
+type FakeTarStreamer struct {
+	StreamInStub        func(dir string, tarStream io.Reader) error
+	streamInMutex       sync.RWMutex
+	streamInArgsForCall []struct {
+		dir       string
+		tarStream io.Reader
+	}
+	streamInReturns struct {
+		result1 error
+	}
+	StreamOutStub        func(dir string, entry string) (io.ReadCloser, error)
+	streamOutMutex       sync.RWMutex
+	streamOutArgsForCall []struct {
+		dir   string
+		entry string
+	}
+	streamOutReturns struct {
+		result1 io.ReadCloser
+		result2 error
+	}
+}
+
+func (fake *FakeTarStreamer) StreamIn(dir string, tarStream io.Reader) error {
+	fake.streamInMutex.Lock()
+	fake.streamInArgsForCall = append(fake.streamInArgsForCall, struct {
+		dir       string
+		tarStream io.Reader
+	}{dir, tarStream})
+	fake.streamInMutex.Unlock()
+	if fake.StreamInStub != nil {
+		return fake.StreamInStub(dir, tarStream)
+	} else {
+		return fake.streamInReturns.result1
+	}
+}
+
+func (fake *FakeTarStreamer) StreamInCallCount() int {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	return len(fake.streamInArgsForCall)
+}
+
+func (fake *FakeTarStreamer) StreamInArgsForCall(i int) (string, io.Reader) {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	return fake.streamInArgsForCall[i].dir, fake.streamInArgsForCall[i].tarStream
+}
+
+func (fake *FakeTarStreamer) StreamInReturns(result1 error) {
+	fake.StreamInStub = nil
+	fake.streamInReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeTarStreamer) StreamOut(dir string, entry string) (io.ReadCloser, error) {
+	fake.streamOutMutex.Lock()
+	fake.streamOutArgsForCall = append(fake.streamOutArgsForCall, struct {
+		dir   string
+		entry string
+	}{dir, entry})
+	fake.streamOutMutex.Unlock()
+	if fake.StreamOutStub != nil {
+		return fake.StreamOutStub(dir, entry)
+	} else {
+		return fake.streamOutReturns.result1, fake.streamOutReturns.result2
+	}
+}
+
+func (fake *FakeTarStreamer) StreamOutCallCount() int {
+	fake.streamOutMutex.RLock()
+	defer fake.streamOutMutex.RUnlock()
+	return len(fake.streamOutArgsForCall)
+}
+
+func (fake *FakeTarStreamer) StreamOutArgsForCall(i int) (string, string) {
+	fake.streamOutMutex.RLock()
+	defer fake.streamOutMutex.RUnlock()
+	return fake.streamOutArgsForCall[i].dir, fake.streamOutArgsForCall[i].entry
+}
+
+func (fake *FakeTarStreamer) StreamOutReturns(result1 io.ReadCloser, result2 error) {
+	fake.StreamOutStub = nil
+	fake.streamOutReturns = struct {
+		result1 io.ReadCloser
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.TarStreamer = new(FakeTarStreamer)
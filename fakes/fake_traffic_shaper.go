@@ -0,0 +1,86 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+)
+
+type FakeTrafficShaper struct {
+	ShapeStub        func(limits garden.BandwidthLimits) error
+	shapeMutex       sync.RWMutex
+	shapeArgsForCall []struct {
+		limits garden.BandwidthLimits
+	}
+	shapeReturns struct {
+		result1 error
+	}
+	LimitsStub        func() (garden.BandwidthLimits, error)
+	limitsMutex       sync.RWMutex
+	limitsArgsForCall []struct{}
+	limitsReturns     struct {
+		result1 garden.BandwidthLimits
+		result2 error
+	}
+}
+
+func (fake *FakeTrafficShaper) Shape(limits garden.BandwidthLimits) error {
+	fake.shapeMutex.Lock()
+	fake.shapeArgsForCall = append(fake.shapeArgsForCall, struct {
+		limits garden.BandwidthLimits
+	}{limits})
+	fake.shapeMutex.Unlock()
+	if fake.ShapeStub != nil {
+		return fake.ShapeStub(limits)
+	} else {
+		return fake.shapeReturns.result1
+	}
+}
+
+func (fake *FakeTrafficShaper) ShapeCallCount() int {
+	fake.shapeMutex.RLock()
+	defer fake.shapeMutex.RUnlock()
+	return len(fake.shapeArgsForCall)
+}
+
+func (fake *FakeTrafficShaper) ShapeArgsForCall(i int) garden.BandwidthLimits {
+	fake.shapeMutex.RLock()
+	defer fake.shapeMutex.RUnlock()
+	return fake.shapeArgsForCall[i].limits
+}
+
+func (fake *FakeTrafficShaper) ShapeReturns(result1 error) {
+	fake.ShapeStub = nil
+	fake.shapeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeTrafficShaper) Limits() (garden.BandwidthLimits, error) {
+	fake.limitsMutex.Lock()
+	fake.limitsArgsForCall = append(fake.limitsArgsForCall, struct{}{})
+	fake.limitsMutex.Unlock()
+	if fake.LimitsStub != nil {
+		return fake.LimitsStub()
+	} else {
+		return fake.limitsReturns.result1, fake.limitsReturns.result2
+	}
+}
+
+func (fake *FakeTrafficShaper) LimitsCallCount() int {
+	fake.limitsMutex.RLock()
+	defer fake.limitsMutex.RUnlock()
+	return len(fake.limitsArgsForCall)
+}
+
+func (fake *FakeTrafficShaper) LimitsReturns(result1 garden.BandwidthLimits, result2 error) {
+	fake.LimitsStub = nil
+	fake.limitsReturns = struct {
+		result1 garden.BandwidthLimits
+		result2 error
+	}{result1, result2}
+}
+
+var _ gardendocker.TrafficShaper = new(FakeTrafficShaper)
@@ -0,0 +1,53 @@
+package gardendocker
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// OpenFDs returns the number of file descriptors this process has open.
+func OpenFDs() (int, error) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+
+	return len(fds), nil
+}
+
+// FDAlarm logs an error whenever the number of open file descriptors goes
+// over Threshold, so that descriptor leaks are noticed before the process
+// runs out.
+type FDAlarm struct {
+	Threshold int
+	Count     func() (int, error)
+
+	Logger lager.Logger
+}
+
+// Check counts the open descriptors and raises the alarm if there are too
+// many. It returns the count.
+func (a *FDAlarm) Check() int {
+	count, err := a.Count()
+	if err != nil {
+		a.Logger.Error("count-fds-failed", err)
+		return 0
+	}
+
+	if a.Threshold > 0 && count > a.Threshold {
+		a.Logger.Error("too-many-open-fds", nil, lager.Data{
+			"open":      count,
+			"threshold": a.Threshold,
+		})
+	}
+
+	return count
+}
+
+func (a *FDAlarm) CheckEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		a.Check()
+	}
+}
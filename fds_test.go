@@ -0,0 +1,71 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("File descriptors", func() {
+	Describe("OpenFDs", func() {
+		It("counts the process's open file descriptors", func() {
+			before, err := gardendocker.OpenFDs()
+			Expect(err).NotTo(HaveOccurred())
+
+			f, err := os.Open("/dev/null")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			Expect(gardendocker.OpenFDs()).To(Equal(before + 1))
+		})
+	})
+
+	Describe("FDAlarm", func() {
+		var logger *lagertest.TestLogger
+		var alarm *gardendocker.FDAlarm
+		var count int
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("fds")
+			alarm = &gardendocker.FDAlarm{
+				Threshold: 10,
+				Count:     func() (int, error) { return count, nil },
+				Logger:    logger,
+			}
+		})
+
+		It("returns the count", func() {
+			count = 5
+			Expect(alarm.Check()).To(Equal(5))
+		})
+
+		It("stays quiet under the threshold", func() {
+			count = 10
+			alarm.Check()
+			Expect(logger.LogMessages()).To(BeEmpty())
+		})
+
+		It("logs an error over the threshold", func() {
+			count = 11
+			alarm.Check()
+
+			Expect(logger.Logs()).To(HaveLen(1))
+			Expect(logger.Logs()[0].Message).To(Equal("fds.too-many-open-fds"))
+			Expect(logger.Logs()[0].LogLevel).To(Equal(lager.ERROR))
+		})
+
+		Context("when counting fails", func() {
+			It("logs the error", func() {
+				alarm.Count = func() (int, error) { return 0, errors.New("boom") }
+				alarm.Check()
+
+				Expect(logger.LogMessages()).To(ConsistOf("fds.count-fds-failed"))
+			})
+		})
+	})
+})
@@ -0,0 +1,328 @@
+package gardendocker
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/docker/docker/pkg/iptables"
+)
+
+//go:generate counterfeiter . Firewall
+type Firewall interface {
+	// Setup denies the container with the given id and IP egress to the
+	// firewall's denied networks.
+	Setup(id, containerIP string) error
+
+	// Allow lets traffic matching a NetOutRule out of the container,
+	// whether or not it is to a denied network.
+	Allow(id string, rule garden.NetOutRule) error
+
+	// Teardown removes all of the container's rules.
+	Teardown(id, containerIP string) error
+}
+
+// Firewalls is a Firewall which passes each call on to all of its
+// Firewalls in turn, stopping at the first to fail, except that Teardown
+// tears them all down.
+type Firewalls []Firewall
+
+func (fs Firewalls) Setup(id, containerIP string) error {
+	for _, f := range fs {
+		if err := f.Setup(id, containerIP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs Firewalls) Allow(id string, rule garden.NetOutRule) error {
+	for _, f := range fs {
+		if err := f.Allow(id, rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs Firewalls) Teardown(id, containerIP string) error {
+	var firstErr error
+	for _, f := range fs {
+		if err := f.Teardown(id, containerIP); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// EgressChain is the filter table chain, jumped to from FORWARD, holding a
+// jump to each container's own chain of egress rules.
+const EgressChain = "garden-docker-egress"
+
+// IPTablesFirewall is a Firewall which gives each container a chain in the
+// filter table, rejecting traffic to the DenyNetworks unless it is first
+// accepted by a NetOut rule.
+type IPTablesFirewall struct {
+	DenyNetworks []*net.IPNet
+
+	// IPv6 programs ip6tables rather than iptables, for containers' IPv6
+	// addresses. The parts of NetOut rules which are about IPv4 networks
+	// are left out, and vice versa.
+	IPv6 bool
+}
+
+// Init creates the EgressChain and the jump to it from FORWARD, unless they
+// already exist.
+func (f *IPTablesFirewall) Init() error {
+	if _, err := f.raw("-n", "-L", EgressChain); err != nil {
+		if _, err := f.raw("-N", EgressChain); err != nil {
+			return fmt.Errorf("create %s chain: %s", EgressChain, err)
+		}
+	}
+
+	if _, err := f.raw("-C", "FORWARD", "-j", EgressChain); err != nil {
+		if _, err := f.raw("-I", "FORWARD", "1", "-j", EgressChain); err != nil {
+			return fmt.Errorf("jump to %s chain: %s", EgressChain, err)
+		}
+	}
+
+	return nil
+}
+
+func (f *IPTablesFirewall) Setup(id, containerIP string) error {
+	if err := f.SetupRules(id, containerIP).Apply(); err != nil {
+		return fmt.Errorf("set up %s chain: %s", containerChain(id), err)
+	}
+
+	return nil
+}
+
+// SetupRules returns the RuleSet Setup applies: the container's chain, its
+// denials and the jump to it.
+func (f *IPTablesFirewall) SetupRules(id, containerIP string) *RuleSet {
+	chain := containerChain(id)
+
+	rules := &RuleSet{IPv6: f.IPv6}
+	rules.Add("filter", "-N", chain)
+	for _, network := range f.DenyNetworks {
+		rules.Add("filter", "-A", chain, "-d", network.String(), "-j", "REJECT")
+	}
+
+	rules.Add("filter", "-I", EgressChain, "1", "-s", containerIP, "-j", chain)
+	return rules
+}
+
+func (f *IPTablesFirewall) Allow(id string, rule garden.NetOutRule) error {
+	rules, err := f.AllowRules(id, rule)
+	if err != nil {
+		return err
+	}
+
+	if err := rules.Apply(); err != nil {
+		return fmt.Errorf("allow: %s", err)
+	}
+
+	return nil
+}
+
+// AllowRules returns the RuleSet Allow applies.
+func (f *IPTablesFirewall) AllowRules(id string, rule garden.NetOutRule) (*RuleSet, error) {
+	args, err := netOutRuleArgs(rule, f.IPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	// each rule is inserted at the top, ahead of the denies, so insert them
+	// last to first to keep them in order
+	chain := containerChain(id)
+	rules := &RuleSet{IPv6: f.IPv6}
+	for i := len(args) - 1; i >= 0; i-- {
+		rules.Add("filter", append([]string{"-I", chain, "1"}, args[i]...)...)
+	}
+
+	return rules, nil
+}
+
+// Teardown removes the jump to the container's chain and the chain itself
+// in one go or, if that fails (because the jump has already gone, say),
+// whatever of them it can.
+func (f *IPTablesFirewall) Teardown(id, containerIP string) error {
+	chain := containerChain(id)
+	return teardownRules(f.raw, &RuleSet{IPv6: f.IPv6}, chain, [][]string{
+		{"-D", EgressChain, "-s", containerIP, "-j", chain},
+		{"-F", chain},
+		{"-X", chain},
+	})
+}
+
+// teardownRules applies the filter table commands removing a container's
+// chain as one RuleSet, falling back to running them one at a time, carrying
+// on past failures, if the set cannot be applied.
+func teardownRules(raw func(...string) ([]byte, error), rules *RuleSet, chain string, commands [][]string) error {
+	for _, args := range commands {
+		rules.Add("filter", args...)
+	}
+
+	if rules.Apply() == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, args := range commands {
+		if _, err := raw(args...); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("remove %s chain: %s", chain, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (f *IPTablesFirewall) raw(args ...string) ([]byte, error) {
+	if f.IPv6 {
+		return ip6tables(args...)
+	}
+
+	return iptables.Raw(args...)
+}
+
+// containerChain names a container's chain, keeping within iptables' 28
+// character limit.
+func containerChain(id string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return "gd-out-" + id
+}
+
+// NetOutRuleArgs translates a NetOutRule into the iptables rule
+// specifications (without chain) which accept the traffic it allows: one
+// for each combination of network and port range, each preceded by a LOG
+// rule if the rule asks for logging. IPv6 networks are left out.
+func NetOutRuleArgs(rule garden.NetOutRule) ([][]string, error) {
+	return netOutRuleArgs(rule, false)
+}
+
+// NetOutRuleArgs6 is NetOutRuleArgs for ip6tables, leaving out IPv4
+// networks. A rule only for IPv4 networks translates to no rules at all.
+func NetOutRuleArgs6(rule garden.NetOutRule) ([][]string, error) {
+	return netOutRuleArgs(rule, true)
+}
+
+func netOutRuleArgs(rule garden.NetOutRule, ipv6 bool) ([][]string, error) {
+	var proto string
+	switch rule.Protocol {
+	case garden.ProtocolAll:
+		proto = "all"
+	case garden.ProtocolTCP:
+		proto = "tcp"
+	case garden.ProtocolUDP:
+		proto = "udp"
+	case garden.ProtocolICMP:
+		proto = "icmp"
+		if ipv6 {
+			proto = "icmpv6"
+		}
+	default:
+		return nil, fmt.Errorf("netout: unknown protocol %d", rule.Protocol)
+	}
+
+	if len(rule.Ports) > 0 && proto != "tcp" && proto != "udp" {
+		return nil, fmt.Errorf("netout: ports are only valid for tcp and udp")
+	}
+
+	networks := [][]string{nil}
+	if len(rule.Networks) > 0 {
+		networks = nil
+		for _, r := range rule.Networks {
+			match, isIPv6, err := ipRangeArgs(r)
+			if err != nil {
+				return nil, err
+			}
+
+			if isIPv6 == ipv6 {
+				networks = append(networks, match)
+			}
+		}
+	}
+
+	ports := [][]string{nil}
+	if len(rule.Ports) > 0 {
+		ports = nil
+		for _, r := range rule.Ports {
+			if r.End != 0 && r.End < r.Start {
+				return nil, fmt.Errorf("netout: invalid port range %d-%d", r.Start, r.End)
+			}
+
+			ports = append(ports, []string{"--dport", portRange(r)})
+		}
+	}
+
+	var icmp []string
+	if rule.ICMPs != nil && (proto == "icmp" || proto == "icmpv6") {
+		icmpType := strconv.Itoa(int(rule.ICMPs.Type))
+		if rule.ICMPs.Code != nil {
+			icmpType += "/" + strconv.Itoa(int(*rule.ICMPs.Code))
+		}
+
+		icmp = []string{"--" + proto + "-type", icmpType}
+	}
+
+	logged := rule.Log && (proto == "tcp" || proto == "all")
+
+	var rules [][]string
+	for _, network := range networks {
+		for _, port := range ports {
+			match := append([]string{"-p", proto}, network...)
+			match = append(append(match, port...), icmp...)
+
+			if logged {
+				rules = append(rules, append(append([]string{}, match...), "-j", "LOG", "--log-prefix", "garden-docker-netout "))
+			}
+
+			rules = append(rules, append(append([]string{}, match...), "-j", "ACCEPT"))
+		}
+	}
+
+	return rules, nil
+}
+
+// ipRangeArgs returns the match for a range of destinations, and whether
+// they are IPv6 addresses.
+func ipRangeArgs(r garden.IPRange) ([]string, bool, error) {
+	start, end := r.Start, r.End
+	if start == nil {
+		start = end
+	}
+
+	if end == nil {
+		end = start
+	}
+
+	if start == nil {
+		return nil, false, fmt.Errorf("netout: empty network range")
+	}
+
+	isIPv6 := start.To4() == nil
+	if isIPv6 != (end.To4() == nil) {
+		return nil, false, fmt.Errorf("netout: network range %s-%s mixes IPv4 and IPv6", start, end)
+	}
+
+	if start.Equal(end) {
+		return []string{"-d", start.String()}, isIPv6, nil
+	}
+
+	return []string{"-m", "iprange", "--dst-range", start.String() + "-" + end.String()}, isIPv6, nil
+}
+
+func portRange(r garden.PortRange) string {
+	if r.End == 0 || r.End == r.Start {
+		return strconv.Itoa(int(r.Start))
+	}
+
+	return fmt.Sprintf("%d:%d", r.Start, r.End)
+}
@@ -0,0 +1,149 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NetOutRuleArgs", func() {
+	It("accepts everything for an empty rule", func() {
+		Expect(NetOutRuleArgs(garden.NetOutRule{})).To(Equal([][]string{
+			{"-p", "all", "-j", "ACCEPT"},
+		}))
+	})
+
+	It("makes a rule for each combination of network and port range", func() {
+		rules, err := NetOutRuleArgs(garden.NetOutRule{
+			Protocol: garden.ProtocolTCP,
+			Networks: []garden.IPRange{
+				garden.IPRangeFromIP(net.ParseIP("1.2.3.4")),
+				{Start: net.ParseIP("10.0.0.1"), End: net.ParseIP("10.0.0.9")},
+			},
+			Ports: []garden.PortRange{
+				garden.PortRangeFromPort(80),
+				{Start: 8000, End: 8080},
+			},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([][]string{
+			{"-p", "tcp", "-d", "1.2.3.4", "--dport", "80", "-j", "ACCEPT"},
+			{"-p", "tcp", "-d", "1.2.3.4", "--dport", "8000:8080", "-j", "ACCEPT"},
+			{"-p", "tcp", "-m", "iprange", "--dst-range", "10.0.0.1-10.0.0.9", "--dport", "80", "-j", "ACCEPT"},
+			{"-p", "tcp", "-m", "iprange", "--dst-range", "10.0.0.1-10.0.0.9", "--dport", "8000:8080", "-j", "ACCEPT"},
+		}))
+	})
+
+	It("matches icmp types and codes", func() {
+		code := garden.ICMPCode(1)
+		Expect(NetOutRuleArgs(garden.NetOutRule{
+			Protocol: garden.ProtocolICMP,
+			ICMPs:    &garden.ICMPControl{Type: 3, Code: &code},
+		})).To(Equal([][]string{
+			{"-p", "icmp", "--icmp-type", "3/1", "-j", "ACCEPT"},
+		}))
+	})
+
+	It("logs tcp traffic before accepting it when asked to", func() {
+		Expect(NetOutRuleArgs(garden.NetOutRule{Protocol: garden.ProtocolTCP, Log: true})).To(Equal([][]string{
+			{"-p", "tcp", "-j", "LOG", "--log-prefix", "garden-docker-netout "},
+			{"-p", "tcp", "-j", "ACCEPT"},
+		}))
+	})
+
+	It("rejects ports for protocols without them", func() {
+		_, err := NetOutRuleArgs(garden.NetOutRule{
+			Protocol: garden.ProtocolICMP,
+			Ports:    []garden.PortRange{garden.PortRangeFromPort(80)},
+		})
+		Expect(err).To(MatchError("netout: ports are only valid for tcp and udp"))
+	})
+
+	It("rejects backwards port ranges", func() {
+		_, err := NetOutRuleArgs(garden.NetOutRule{
+			Protocol: garden.ProtocolUDP,
+			Ports:    []garden.PortRange{{Start: 90, End: 80}},
+		})
+		Expect(err).To(MatchError("netout: invalid port range 90-80"))
+	})
+
+	Describe("for IPv6", func() {
+		networks := []garden.IPRange{
+			garden.IPRangeFromIP(net.ParseIP("1.2.3.4")),
+			{Start: net.ParseIP("fd00::1"), End: net.ParseIP("fd00::9")},
+		}
+
+		It("leaves out the networks of the other family", func() {
+			Expect(NetOutRuleArgs(garden.NetOutRule{Networks: networks})).To(Equal([][]string{
+				{"-p", "all", "-d", "1.2.3.4", "-j", "ACCEPT"},
+			}))
+
+			Expect(NetOutRuleArgs6(garden.NetOutRule{Networks: networks})).To(Equal([][]string{
+				{"-p", "all", "-m", "iprange", "--dst-range", "fd00::1-fd00::9", "-j", "ACCEPT"},
+			}))
+		})
+
+		It("makes no rules for a rule only for IPv4 networks", func() {
+			Expect(NetOutRuleArgs6(garden.NetOutRule{Networks: networks[:1]})).To(BeEmpty())
+		})
+
+		It("matches icmpv6 types and codes", func() {
+			code := garden.ICMPCode(0)
+			Expect(NetOutRuleArgs6(garden.NetOutRule{
+				Protocol: garden.ProtocolICMP,
+				ICMPs:    &garden.ICMPControl{Type: 128, Code: &code},
+			})).To(Equal([][]string{
+				{"-p", "icmpv6", "--icmpv6-type", "128/0", "-j", "ACCEPT"},
+			}))
+		})
+
+		It("rejects ranges which mix IPv4 and IPv6", func() {
+			_, err := NetOutRuleArgs6(garden.NetOutRule{
+				Networks: []garden.IPRange{{Start: net.ParseIP("1.2.3.4"), End: net.ParseIP("fd00::1")}},
+			})
+			Expect(err).To(MatchError(ContainSubstring("mixes IPv4 and IPv6")))
+		})
+	})
+})
+
+var _ = Describe("Firewalls", func() {
+	var a, b *fakes.FakeFirewall
+	var firewalls Firewalls
+
+	BeforeEach(func() {
+		a = new(fakes.FakeFirewall)
+		b = new(fakes.FakeFirewall)
+		firewalls = Firewalls{a, b}
+	})
+
+	It("sets up and allows in each firewall", func() {
+		Expect(firewalls.Setup("some-id", "10.0.0.2")).To(Succeed())
+		Expect(firewalls.Allow("some-id", garden.NetOutRule{})).To(Succeed())
+
+		Expect(a.SetupCallCount()).To(Equal(1))
+		Expect(b.SetupCallCount()).To(Equal(1))
+		Expect(a.AllowCallCount()).To(Equal(1))
+		Expect(b.AllowCallCount()).To(Equal(1))
+	})
+
+	It("stops at the first firewall to fail to set up", func() {
+		a.SetupReturns(errors.New("boom"))
+
+		Expect(firewalls.Setup("some-id", "10.0.0.2")).To(MatchError("boom"))
+		Expect(b.SetupCallCount()).To(Equal(0))
+	})
+
+	It("tears down every firewall, even if one fails", func() {
+		a.TeardownReturns(errors.New("boom"))
+
+		Expect(firewalls.Teardown("some-id", "10.0.0.2")).To(MatchError("boom"))
+		Expect(b.TeardownCallCount()).To(Equal(1))
+	})
+})
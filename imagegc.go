@@ -0,0 +1,246 @@
+package gardendocker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . DockerImages
+type DockerImages interface {
+	Images(dockercli.ImagesCmd) ([]dockercli.ImageEntry, error)
+	Rmi(dockercli.RmiCmd) (string, error)
+}
+
+// ImageGC removes docker images no container in the repo uses once the disk
+// docker keeps its images on is fuller than Threshold, so that long-running
+// hosts do not fill up with stale layers. The least recently used images go
+// first, until usage is back under the threshold; images garden-docker has
+// not seen used since it started are the oldest of all.
+//
+// Images are never removed forcibly, so docker itself refuses to remove an
+// image used by a container garden-docker does not know about.
+type ImageGC struct {
+	Repo   Repo
+	Docker DockerImages
+
+	// Threshold is the percentage of the disk in use above which images are
+	// collected.
+	Threshold float64
+
+	// DiskUsage returns the percentage of the disk docker keeps its images
+	// on which is in use, for example with FilesystemUsage.
+	DiskUsage func() (float64, error)
+
+	// Grace is how long after it was last used an image is still treated as
+	// in use, covering a container which has been created from it but is not
+	// in the repo yet.
+	Grace time.Duration
+
+	Logger lager.Logger
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+	using    map[string]int
+}
+
+// FilesystemUsage returns the percentage of the filesystem holding path which is
+// in use.
+func FilesystemUsage(path string) (float64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, fmt.Errorf("statfs %s: %s", path, err)
+	}
+
+	if fs.Blocks == 0 {
+		return 0, nil
+	}
+
+	return 100 * float64(fs.Blocks-fs.Bfree) / float64(fs.Blocks), nil
+}
+
+// Used records that an image is in use, for example by a container which is
+// being created and so is not in the repo yet. It is safe to call on a nil
+// ImageGC.
+func (gc *ImageGC) Used(imageID string) {
+	if gc == nil || imageID == "" {
+		return
+	}
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.lastUsed == nil {
+		gc.lastUsed = make(map[string]time.Time)
+	}
+
+	gc.lastUsed[imageID] = time.Now()
+}
+
+// Using records that an image is in use until the returned func is called,
+// for example while a container is being created from it. It is safe to
+// call on a nil ImageGC.
+func (gc *ImageGC) Using(imageID string) func() {
+	if gc == nil || imageID == "" {
+		return func() {}
+	}
+
+	gc.Used(imageID)
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.using == nil {
+		gc.using = make(map[string]int)
+	}
+
+	gc.using[imageID]++
+
+	return func() {
+		gc.Used(imageID)
+
+		gc.mu.Lock()
+		defer gc.mu.Unlock()
+
+		if gc.using[imageID]--; gc.using[imageID] <= 0 {
+			delete(gc.using, imageID)
+		}
+	}
+}
+
+// inUse reports whether an image is being used by a container which is not
+// in the repo yet, or was used within Grace.
+func (gc *ImageGC) inUse(imageID string, now time.Time) bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.using[imageID] > 0 {
+		return true
+	}
+
+	lastUsed, ok := gc.lastUsed[imageID]
+	return ok && now.Sub(lastUsed) < gc.Grace
+}
+
+func (gc *ImageGC) CollectEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		gc.Collect()
+	}
+}
+
+// Collect removes unused images, least recently used first, while the disk
+// is over the threshold.
+func (gc *ImageGC) Collect() {
+	log := gc.Logger.Session("image-gc")
+
+	usage, err := gc.DiskUsage()
+	if err != nil {
+		log.Error("disk-usage-failed", err)
+		return
+	}
+
+	if usage <= gc.Threshold {
+		return
+	}
+
+	inUse := make(map[string]bool)
+	for _, container := range gc.Repo.All() {
+		if container.InfoHandler != nil && container.ImageID != "" {
+			inUse[container.ImageID] = true
+			gc.Used(container.ImageID)
+		}
+	}
+
+	entries, err := gc.Docker.Images(dockercli.ImagesCmd{})
+	if err != nil {
+		log.Error("list-images-failed", err)
+		return
+	}
+
+	// an image is listed once for each of its references; untagged images
+	// have none worth removing, and are removed by id
+	now := time.Now()
+	refs := make(map[string][]string)
+	for _, entry := range entries {
+		if inUse[entry.ID] || gc.inUse(entry.ID, now) {
+			continue
+		}
+
+		if _, ok := refs[entry.ID]; !ok {
+			refs[entry.ID] = nil
+		}
+
+		if tagged(entry) {
+			refs[entry.ID] = append(refs[entry.ID], entry.Repository+":"+entry.Tag)
+		}
+	}
+
+	for _, id := range gc.leastRecentlyUsed(refs) {
+		if err := gc.remove(id, refs[id]); err != nil {
+			log.Error("remove-image-failed", err, lager.Data{"image": id})
+			continue
+		}
+
+		log.Info("removed-image", lager.Data{"image": id, "usage": usage})
+
+		if usage, err = gc.DiskUsage(); err != nil {
+			log.Error("disk-usage-failed", err)
+			return
+		}
+
+		if usage <= gc.Threshold {
+			return
+		}
+	}
+}
+
+// leastRecentlyUsed orders the images, least recently used first.
+func (gc *ImageGC) leastRecentlyUsed(refs map[string][]string) []string {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	ids := make([]string, 0, len(refs))
+	for id := range refs {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := gc.lastUsed[ids[i]], gc.lastUsed[ids[j]]
+		if ti.Equal(tj) {
+			return ids[i] < ids[j]
+		}
+
+		return ti.Before(tj)
+	})
+
+	return ids
+}
+
+// remove removes each of an image's tags, or the image itself if it has
+// none; docker removes the image along with its last tag.
+func (gc *ImageGC) remove(id string, refs []string) error {
+	if len(refs) == 0 {
+		refs = []string{id}
+	}
+
+	for _, ref := range refs {
+		if _, err := gc.Docker.Rmi(dockercli.RmiCmd{Image: ref}); err != nil {
+			return err
+		}
+	}
+
+	gc.mu.Lock()
+	delete(gc.lastUsed, id)
+	gc.mu.Unlock()
+
+	return nil
+}
+
+func tagged(entry dockercli.ImageEntry) bool {
+	return entry.Repository != "" && entry.Repository != "<none>" && entry.Tag != "" && entry.Tag != "<none>"
+}
@@ -0,0 +1,154 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("ImageGC", func() {
+	var (
+		gc     *gardendocker.ImageGC
+		docker *fakes.FakeDockerImages
+		repo   gardendocker.Repo
+		usage  []float64
+	)
+
+	BeforeEach(func() {
+		docker = new(fakes.FakeDockerImages)
+		docker.ImagesReturns([]dockercli.ImageEntry{
+			{ID: "sha256:old", Repository: "old", Tag: "latest"},
+			{ID: "sha256:old", Repository: "old", Tag: "v1"},
+			{ID: "sha256:untagged", Repository: "<none>", Tag: "<none>"},
+			{ID: "sha256:live", Repository: "live", Tag: "latest"},
+		}, nil)
+
+		repo = gardendocker.NewRepo()
+		repo.Add(&gardendocker.Container{InfoHandler: &gardendocker.InfoHandler{
+			Spec:    garden.ContainerSpec{Handle: "some-container"},
+			ImageID: "sha256:live",
+		}})
+
+		usage = []float64{95, 85}
+
+		gc = &gardendocker.ImageGC{
+			Repo:      repo,
+			Docker:    docker,
+			Threshold: 90,
+			DiskUsage: func() (float64, error) {
+				u := usage[0]
+				if len(usage) > 1 {
+					usage = usage[1:]
+				}
+
+				return u, nil
+			},
+			Logger: lagertest.NewTestLogger("gc"),
+		}
+	})
+
+	removed := func() []string {
+		var images []string
+		for i := 0; i < docker.RmiCallCount(); i++ {
+			images = append(images, docker.RmiArgsForCall(i).Image)
+		}
+
+		return images
+	}
+
+	Context("when the disk is under the threshold", func() {
+		It("removes nothing", func() {
+			usage = []float64{90}
+			gc.Collect()
+
+			Expect(docker.ImagesCallCount()).To(Equal(0))
+			Expect(docker.RmiCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the disk is over the threshold", func() {
+		It("removes unused images until it is back under it, by tag", func() {
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"old:latest", "old:v1"}))
+		})
+
+		It("removes untagged images by id", func() {
+			usage = []float64{95, 95, 85}
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"old:latest", "old:v1", "sha256:untagged"}))
+		})
+
+		It("never removes images containers in the repo use", func() {
+			usage = []float64{95}
+			gc.Collect()
+			Expect(removed()).NotTo(ContainElement("live:latest"))
+		})
+
+		It("removes the least recently used images first", func() {
+			gc.Used("sha256:old")
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"sha256:untagged"}))
+		})
+
+		It("never removes images containers are being created from", func() {
+			usage = []float64{95}
+			defer gc.Using("sha256:old")()
+
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"sha256:untagged"}))
+		})
+
+		It("removes images once containers are no longer being created from them", func() {
+			usage = []float64{95, 95, 85}
+			gc.Using("sha256:old")()
+
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"sha256:untagged", "old:latest", "old:v1"}))
+		})
+
+		It("never removes images used within the grace period", func() {
+			gc.Grace = time.Hour
+			gc.Used("sha256:old")
+
+			usage = []float64{95}
+			gc.Collect()
+			Expect(removed()).To(Equal([]string{"sha256:untagged"}))
+		})
+
+		Context("when an image cannot be removed", func() {
+			It("moves on to the next", func() {
+				docker.RmiStub = func(cmd dockercli.RmiCmd) (string, error) {
+					if cmd.Image == "old:latest" {
+						return "", errors.New("image is being used by a stopped container")
+					}
+
+					return "", nil
+				}
+
+				gc.Collect()
+				Expect(removed()).To(Equal([]string{"old:latest", "sha256:untagged"}))
+			})
+		})
+	})
+
+	Describe("Used", func() {
+		It("is safe to call on a nil ImageGC", func() {
+			var gc *gardendocker.ImageGC
+			Expect(func() { gc.Used("sha256:some-image") }).NotTo(Panic())
+		})
+	})
+
+	Describe("Using", func() {
+		It("is safe to call on a nil ImageGC", func() {
+			var gc *gardendocker.ImageGC
+			Expect(func() { gc.Using("sha256:some-image")() }).NotTo(Panic())
+		})
+	})
+})
@@ -1,6 +1,14 @@
 package gardendocker
 
-import "github.com/cloudfoundry-incubator/garden"
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+// ContainerIPv6Property is the property through which Info reports a
+// container's IPv6 address.
+const ContainerIPv6Property = "garden-docker.container-ipv6"
 
 type InfoHandler struct {
 	Spec garden.ContainerSpec
@@ -10,7 +18,24 @@ type InfoHandler struct {
 	ContainerPath string
 	DockerID      string
 
+	// ContainerIPv6, if set, is the container's IPv6 address. ContainerInfo
+	// has nowhere for it, so it is reported as the ContainerIPv6Property.
+	ContainerIPv6 string
+
+	// ImageID is the id of the docker image the container was created from.
+	ImageID string
+
+	// MetadataPath, if set, is where the container's ContainerMetadata is
+	// saved. metadataMu is held from taking the snapshot to writing it, so
+	// that an older snapshot never replaces a newer one.
+	MetadataPath string
+	metadataMu   sync.Mutex
+
 	*PropsHandler
+
+	stateMu sync.RWMutex
+	stopped bool
+	events  []string
 }
 
 func (i *InfoHandler) Handle() string {
@@ -18,14 +43,84 @@ func (i *InfoHandler) Handle() string {
 }
 
 func (i *InfoHandler) Info() (garden.ContainerInfo, error) {
+	i.stateMu.RLock()
+	defer i.stateMu.RUnlock()
+
+	state := "active"
+	if i.stopped {
+		state = "stopped"
+	}
+
+	properties := i.PropsHandler.properties()
+	if i.ContainerIPv6 != "" {
+		properties[ContainerIPv6Property] = i.ContainerIPv6
+	}
+
 	return garden.ContainerInfo{
-		State:         "active",
-		Events:        []string{},
+		State:         state,
+		Events:        append([]string{}, i.events...),
 		HostIP:        i.HostIP,
 		ContainerIP:   i.ContainerIP,
 		ContainerPath: i.ContainerPath,
 		ProcessIDs:    []uint32{},
-		Properties:    i.PropsHandler.properties(),
+		Properties:    properties,
 		MappedPorts:   []garden.PortMapping{},
 	}, nil
 }
+
+func (i *InfoHandler) containerIP() string {
+	i.stateMu.RLock()
+	defer i.stateMu.RUnlock()
+
+	return i.ContainerIP
+}
+
+func (i *InfoHandler) setContainerIP(ip string) {
+	i.stateMu.Lock()
+	defer i.stateMu.Unlock()
+
+	i.ContainerIP = ip
+}
+
+// MarkStopped records that the container's docker container is no longer
+// running, along with an event describing why.
+func (i *InfoHandler) MarkStopped(event string) {
+	i.stateMu.Lock()
+	defer i.stateMu.Unlock()
+
+	i.stopped = true
+	i.events = append(i.events, event)
+}
+
+func (i *InfoHandler) Stopped() bool {
+	i.stateMu.RLock()
+	defer i.stateMu.RUnlock()
+
+	return i.stopped
+}
+
+// AddEvent records an event, such as running out of memory, which leaves
+// the container's state as it is. An event already recorded is not
+// recorded again.
+func (i *InfoHandler) AddEvent(event string) {
+	i.stateMu.Lock()
+	defer i.stateMu.Unlock()
+
+	for _, e := range i.events {
+		if e == event {
+			return
+		}
+	}
+
+	i.events = append(i.events, event)
+}
+
+// MarkActive records that the container's docker container is running again,
+// along with an event describing why.
+func (i *InfoHandler) MarkActive(event string) {
+	i.stateMu.Lock()
+	defer i.stateMu.Unlock()
+
+	i.stopped = false
+	i.events = append(i.events, event)
+}
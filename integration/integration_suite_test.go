@@ -2,6 +2,8 @@ package integration_test
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -15,6 +17,9 @@ import (
 )
 
 var gardenBin string
+var initdBin string
+var doshBin string
+var iodaemonBin string
 
 var gardenRunner *runner.Runner
 var gardenProcess ifrit.Process
@@ -23,7 +28,7 @@ var client garden.Client
 
 func startGarden(argv ...string) garden.Client {
 	gardenAddr := fmt.Sprintf("/tmp/garden_%d.sock", GinkgoParallelNode())
-	gardenRunner = runner.New("unix", gardenAddr, gardenBin, argv...)
+	gardenRunner = runner.New("unix", gardenAddr, gardenBin, append([]string{"-initdBin", initdBin, "-doshBin", doshBin, "-iodaemonBin", iodaemonBin}, argv...)...)
 	gardenProcess = ifrit.Invoke(gardenRunner)
 
 	return gardenRunner.NewClient()
@@ -47,11 +52,23 @@ func ensureGardenRunning() {
 
 func TestLifecycle(t *testing.T) {
 	SynchronizedBeforeSuite(func() []byte {
-		gardenPath, err := gexec.Build("github.com/julz/garden-docker/garden-docker")
+		gardenPath, err := gexec.Build("github.com/julz/garden-docker/cmd/garden-docker")
 		Expect(err).ToNot(HaveOccurred())
-		return []byte(gardenPath)
-	}, func(gardenPath []byte) {
-		gardenBin = string(gardenPath)
+
+		doshPath, err := gexec.Build("github.com/julz/garden-docker/cmd/dosh")
+		Expect(err).ToNot(HaveOccurred())
+
+		iodaemonPath, err := gexec.Build("github.com/cloudfoundry-incubator/garden-linux/iodaemon")
+		Expect(err).ToNot(HaveOccurred())
+
+		os.Setenv("CGO_ENABLED", "0")
+		initdPath, err := gexec.Build("github.com/julz/garden-docker/cmd/initd", "-a", "-installsuffix", "static")
+		Expect(err).ToNot(HaveOccurred())
+
+		return []byte(strings.Join([]string{gardenPath, initdPath, doshPath, iodaemonPath}, "\n"))
+	}, func(paths []byte) {
+		bins := strings.Split(string(paths), "\n")
+		gardenBin, initdBin, doshBin, iodaemonBin = bins[0], bins[1], bins[2], bins[3]
 	})
 
 	AfterEach(func() {
@@ -0,0 +1,153 @@
+package gardendocker
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/docker/docker/pkg/iptables"
+)
+
+// InterContainerChain is the filter table chain, jumped to from FORWARD for
+// traffic between two containers on the bridge, holding a jump to each
+// container's own chain of the destinations it may reach and, last, a
+// rejection of everything else.
+const InterContainerChain = "garden-docker-lateral"
+
+// InterContainerFirewall is a Firewall which rejects traffic between
+// containers on Bridge, other than replies, unless the sender has a NetOut
+// rule for it. Only the parts of NetOut rules for networks within Subnet, the
+// containers' subnet, count, so that letting a container out to the
+// internet (0.0.0.0/0, say) does not also let it reach every other
+// container.
+type InterContainerFirewall struct {
+	Bridge string
+	Subnet *net.IPNet
+}
+
+// Init creates the InterContainerChain, with its acceptance of replies and
+// final rejection, and the jump to it from FORWARD, unless they already
+// exist. It should be called after any other Firewall's Init, so that the
+// jump comes first.
+func (f *InterContainerFirewall) Init() error {
+	if _, err := iptables.Raw("-n", "-L", InterContainerChain); err != nil {
+		if _, err := iptables.Raw("-N", InterContainerChain); err != nil {
+			return fmt.Errorf("create %s chain: %s", InterContainerChain, err)
+		}
+	}
+
+	for _, rule := range [][]string{
+		{"-I", InterContainerChain, "1", "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		{"-A", InterContainerChain, "-j", "REJECT"},
+		{"-I", "FORWARD", "1", "-i", f.Bridge, "-o", f.Bridge, "-j", InterContainerChain},
+	} {
+		if !f.exists(rule) {
+			if _, err := iptables.Raw(rule...); err != nil {
+				return fmt.Errorf("set up %s chain: %s", InterContainerChain, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// exists reports whether an -I or -A rule is already present.
+func (f *InterContainerFirewall) exists(rule []string) bool {
+	spec := rule[2:]
+	if rule[0] == "-I" {
+		spec = rule[3:]
+	}
+
+	_, err := iptables.Raw(append([]string{"-C", rule[1]}, spec...)...)
+	return err == nil
+}
+
+// Setup creates the container's chain, which allows nothing until NetOut
+// adds to it, and jumps to it for traffic from the container, after the
+// acceptance of replies.
+func (f *InterContainerFirewall) Setup(id, containerIP string) error {
+	chain := interContainerChain(id)
+
+	rules := &RuleSet{}
+	rules.Add("filter", "-N", chain)
+	rules.Add("filter", "-I", InterContainerChain, "2", "-s", containerIP, "-j", chain)
+
+	if err := rules.Apply(); err != nil {
+		return fmt.Errorf("set up %s chain: %s", chain, err)
+	}
+
+	return nil
+}
+
+// Allow lets the container reach the other containers the rule is for.
+func (f *InterContainerFirewall) Allow(id string, rule garden.NetOutRule) error {
+	rule, ok := f.LateralRule(rule)
+	if !ok {
+		return nil
+	}
+
+	rules, err := NetOutRuleArgs(rule)
+	if err != nil {
+		return err
+	}
+
+	chain := interContainerChain(id)
+	set := &RuleSet{}
+	for _, args := range rules {
+		set.Add("filter", append([]string{"-A", chain}, args...)...)
+	}
+
+	if err := set.Apply(); err != nil {
+		return fmt.Errorf("allow: %s", err)
+	}
+
+	return nil
+}
+
+func (f *InterContainerFirewall) Teardown(id, containerIP string) error {
+	chain := interContainerChain(id)
+	return teardownRules(iptables.Raw, &RuleSet{}, chain, [][]string{
+		{"-D", InterContainerChain, "-s", containerIP, "-j", chain},
+		{"-F", chain},
+		{"-X", chain},
+	})
+}
+
+// LateralRule returns the part of a NetOut rule for networks within the
+// Subnet, and whether there is any. A rule for no particular networks, which
+// means all of them, has none.
+func (f *InterContainerFirewall) LateralRule(rule garden.NetOutRule) (garden.NetOutRule, bool) {
+	var networks []garden.IPRange
+	for _, r := range rule.Networks {
+		if f.within(r) {
+			networks = append(networks, r)
+		}
+	}
+
+	rule.Networks = networks
+	return rule, len(networks) > 0
+}
+
+// within reports whether the whole of a range is in the Subnet.
+func (f *InterContainerFirewall) within(r garden.IPRange) bool {
+	start, end := r.Start, r.End
+	if start == nil {
+		start = end
+	}
+
+	if end == nil {
+		end = start
+	}
+
+	return start != nil && f.Subnet.Contains(start) && f.Subnet.Contains(end)
+}
+
+// interContainerChain names a container's chain of the other containers it
+// may reach, keeping within iptables' 28 character limit.
+func interContainerChain(id string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return "gd-lat-" + id
+}
@@ -0,0 +1,55 @@
+package gardendocker_test
+
+import (
+	"net"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InterContainerFirewall", func() {
+	var firewall *InterContainerFirewall
+
+	BeforeEach(func() {
+		_, subnet, err := net.ParseCIDR("10.254.0.0/16")
+		Expect(err).NotTo(HaveOccurred())
+
+		firewall = &InterContainerFirewall{Bridge: "gd0", Subnet: subnet}
+	})
+
+	Describe("LateralRule", func() {
+		It("keeps the networks within the containers' subnet, with the rule's ports", func() {
+			rule, ok := firewall.LateralRule(garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Networks: []garden.IPRange{
+					garden.IPRangeFromIP(net.ParseIP("10.254.0.5")),
+					garden.IPRangeFromIP(net.ParseIP("8.8.8.8")),
+					{Start: net.ParseIP("10.254.1.0"), End: net.ParseIP("10.255.0.0")},
+				},
+				Ports: []garden.PortRange{garden.PortRangeFromPort(8080)},
+			})
+
+			Expect(ok).To(BeTrue())
+			Expect(rule).To(Equal(garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Networks: []garden.IPRange{garden.IPRangeFromIP(net.ParseIP("10.254.0.5"))},
+				Ports:    []garden.PortRange{garden.PortRangeFromPort(8080)},
+			}))
+		})
+
+		It("has nothing for a rule for every network", func() {
+			_, ok := firewall.LateralRule(garden.NetOutRule{Protocol: garden.ProtocolAll})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("has nothing for a rule only for networks outside the subnet", func() {
+			_, ok := firewall.LateralRule(garden.NetOutRule{
+				Networks: []garden.IPRange{{Start: net.ParseIP("0.0.0.0"), End: net.ParseIP("255.255.255.255")}},
+			})
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package gardendocker
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/iptables"
+)
+
+// IP6TablesChain is a Chain which forwards ports to containers' IPv6
+// addresses through its own chain in ip6tables' nat table, since docker's
+// iptables package only programs IPv4.
+type IP6TablesChain struct {
+	Name   string
+	Bridge string
+}
+
+// Init creates the chain and the jumps to it for traffic to the host's own
+// addresses, unless they already exist.
+func (c *IP6TablesChain) Init() error {
+	if _, err := ip6tables("-t", "nat", "-n", "-L", c.Name); err != nil {
+		if _, err := ip6tables("-t", "nat", "-N", c.Name); err != nil {
+			return fmt.Errorf("create %s chain: %s", c.Name, err)
+		}
+	}
+
+	for _, jump := range [][]string{
+		{"PREROUTING", "-m", "addrtype", "--dst-type", "LOCAL", "-j", c.Name},
+		{"OUTPUT", "!", "-d", "::1/128", "-m", "addrtype", "--dst-type", "LOCAL", "-j", c.Name},
+	} {
+		if _, err := ip6tables(append([]string{"-t", "nat", "-C"}, jump...)...); err == nil {
+			continue
+		}
+
+		if _, err := ip6tables(append([]string{"-t", "nat", "-A"}, jump...)...); err != nil {
+			return fmt.Errorf("jump to %s chain: %s", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *IP6TablesChain) Forward(handle string, action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) error {
+	fAction := action
+	if fAction == iptables.Add {
+		fAction = "-I"
+	}
+
+	rules := &RuleSet{IPv6: true}
+	rules.Add("nat", append([]string{string(action), c.Name}, c.dnat(handle, ip, port, proto, dest_addr, dest_port)...)...)
+
+	accept := []string{string(fAction), "FORWARD", "!", "-i", c.Bridge, "-o", c.Bridge, "-p", proto, "-d", dest_addr, "--dport", strconv.Itoa(dest_port)}
+	rules.Add("filter", append(append(accept, ruleComment(handle)...), "-j", "ACCEPT")...)
+
+	return rules.Apply()
+}
+
+// ForwardExists reports whether the DNAT rule which Forward would add is
+// present in the chain.
+func (c *IP6TablesChain) ForwardExists(handle string, ip net.IP, port int, proto, dest_addr string, dest_port int) bool {
+	_, err := ip6tables(append([]string{"-t", "nat", "-C", c.Name}, c.dnat(handle, ip, port, proto, dest_addr, dest_port)...)...)
+	return err == nil
+}
+
+func (c *IP6TablesChain) dnat(handle string, ip net.IP, port int, proto, dest_addr string, dest_port int) []string {
+	daddr := ip.String()
+	if ip == nil || ip.IsUnspecified() {
+		daddr = "::/0"
+	}
+
+	dnat := append([]string{"-p", proto, "-d", daddr, "--dport", strconv.Itoa(port)}, ruleComment(handle)...)
+	return append(dnat, "-j", "DNAT", "--to-destination", net.JoinHostPort(dest_addr, strconv.Itoa(dest_port)))
+}
+
+// ip6tables runs ip6tables, waiting for the xtables lock, as iptables.Raw
+// does for iptables.
+func ip6tables(args ...string) ([]byte, error) {
+	args = append([]string{"--wait"}, args...)
+
+	output, err := exec.Command("ip6tables", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ip6tables failed: ip6tables %s: %s (%s)", strings.Join(args, " "), output, err)
+	}
+
+	return output, nil
+}
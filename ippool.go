@@ -0,0 +1,156 @@
+package gardendocker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"sync"
+)
+
+var ErrIPPoolExhausted = errors.New("no free IPs in the subnet pool")
+
+// IPPool hands out container IPs from an IPv4 subnet or IPv6 prefix,
+// leaving out its network address, its first address, which is the
+// bridge's gateway, and, for IPv4, its broadcast address. It goes round the
+// subnet rather than handing out the lowest free address, so that an
+// address is not reused soon after it is released, while connections to
+// the old container may still be tracked.
+type IPPool struct {
+	subnet *net.IPNet
+	first  *big.Int
+	size   uint32
+
+	// InUse, if set, reports whether a container garden-docker knows about
+	// already has the IP, such as one restored after a restart, which the
+	// pool did not hand out itself.
+	InUse func(ip string) bool
+
+	mu   sync.Mutex
+	next uint32
+	held map[uint32]bool
+}
+
+// NewIPPool makes a pool of the usable addresses in the subnet, given in
+// CIDR notation. Only the first 2^32-1 addresses of larger IPv6 prefixes
+// are used.
+func NewIPPool(cidr string) (*IPPool, error) {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("subnet pool: %s", err)
+	}
+
+	ones, bits := subnet.Mask.Size()
+	reserved := int64(2)
+	if bits == 32 {
+		reserved = 3
+	}
+
+	addresses := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	usable := addresses.Sub(addresses, big.NewInt(reserved))
+	if usable.Sign() <= 0 {
+		return nil, fmt.Errorf("subnet pool: %s is too small", cidr)
+	}
+
+	size := uint32(math.MaxUint32)
+	if usable.IsUint64() && usable.Uint64() < math.MaxUint32 {
+		size = uint32(usable.Uint64())
+	}
+
+	network := new(big.Int).SetBytes(subnet.IP)
+	return &IPPool{
+		subnet: subnet,
+		first:  network.Add(network, big.NewInt(2)),
+		size:   size,
+		held:   make(map[uint32]bool),
+	}, nil
+}
+
+// Subnet returns the subnet the pool hands out addresses from.
+func (p *IPPool) Subnet() *net.IPNet {
+	return p.subnet
+}
+
+// Acquire hands out the next free address.
+func (p *IPPool) Acquire() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := uint32(0); i < p.size; i++ {
+		offset := uint32((uint64(p.next) + uint64(i)) % uint64(p.size))
+		if p.held[offset] {
+			continue
+		}
+
+		ip := p.ip(offset)
+		if p.InUse != nil && p.InUse(ip) {
+			continue
+		}
+
+		p.held[offset] = true
+		p.next = uint32((uint64(offset) + 1) % uint64(p.size))
+		return ip, nil
+	}
+
+	return "", ErrIPPoolExhausted
+}
+
+// Reserve marks an address a container already has as taken, so that it is
+// not handed out again until it is released, such as that of a container
+// restored after a restart or adopted from docker. Addresses outside the
+// pool are ignored.
+func (p *IPPool) Reserve(ip string) {
+	offset, ok := p.offset(ip)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.held[offset] = true
+}
+
+// Release returns an address to the pool. Addresses the pool did not hand
+// out are ignored.
+func (p *IPPool) Release(ip string) {
+	offset, ok := p.offset(ip)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.held, offset)
+}
+
+// offset returns where in the pool an address is, and whether it is in the
+// pool at all.
+func (p *IPPool) offset(ip string) (uint32, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || !p.subnet.Contains(parsed) {
+		return 0, false
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		parsed = v4
+	}
+
+	offset := new(big.Int).Sub(new(big.Int).SetBytes(parsed), p.first)
+	if offset.Sign() < 0 || !offset.IsUint64() || offset.Uint64() >= uint64(p.size) {
+		return 0, false
+	}
+
+	return uint32(offset.Uint64()), true
+}
+
+func (p *IPPool) ip(offset uint32) string {
+	n := new(big.Int).Add(p.first, big.NewInt(int64(offset)))
+
+	ip := make(net.IP, len(p.subnet.IP))
+	b := n.Bytes()
+	copy(ip[len(ip)-len(b):], b)
+	return ip.String()
+}
@@ -0,0 +1,99 @@
+package gardendocker_test
+
+import (
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPPool", func() {
+	var pool *IPPool
+
+	BeforeEach(func() {
+		var err error
+		pool, err = NewIPPool("10.254.0.0/29")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	acquireAll := func() []string {
+		var ips []string
+		for {
+			ip, err := pool.Acquire()
+			if err != nil {
+				Expect(err).To(Equal(ErrIPPoolExhausted))
+				return ips
+			}
+
+			ips = append(ips, ip)
+		}
+	}
+
+	It("hands out the subnet's addresses, except the network, gateway and broadcast addresses", func() {
+		Expect(acquireAll()).To(Equal([]string{"10.254.0.2", "10.254.0.3", "10.254.0.4", "10.254.0.5", "10.254.0.6"}))
+	})
+
+	It("does not hand out a released address again until it has gone round the subnet", func() {
+		first, err := pool.Acquire()
+		Expect(err).NotTo(HaveOccurred())
+		pool.Release(first)
+
+		Expect(pool.Acquire()).To(Equal("10.254.0.3"))
+		Expect(acquireAll()).To(Equal([]string{"10.254.0.4", "10.254.0.5", "10.254.0.6", "10.254.0.2"}))
+	})
+
+	It("skips addresses which containers already have", func() {
+		pool.InUse = func(ip string) bool { return ip == "10.254.0.2" }
+
+		Expect(pool.Acquire()).To(Equal("10.254.0.3"))
+	})
+
+	It("does not hand out reserved addresses until they are released", func() {
+		pool.Reserve("10.254.0.2")
+		pool.Reserve("192.168.0.1")
+
+		Expect(acquireAll()).To(Equal([]string{"10.254.0.3", "10.254.0.4", "10.254.0.5", "10.254.0.6"}))
+
+		pool.Release("10.254.0.2")
+		Expect(pool.Acquire()).To(Equal("10.254.0.2"))
+	})
+
+	It("ignores addresses it did not hand out being released", func() {
+		pool.Release("192.168.0.1")
+		pool.Release("not-an-ip")
+
+		Expect(acquireAll()).To(HaveLen(5))
+	})
+
+	It("hands out IPv6 addresses from a prefix, except the network and gateway addresses", func() {
+		pool, err := NewIPPool("fd00:254::/126")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(pool.Acquire()).To(Equal("fd00:254::2"))
+		Expect(pool.Acquire()).To(Equal("fd00:254::3"))
+
+		_, err = pool.Acquire()
+		Expect(err).To(Equal(ErrIPPoolExhausted))
+
+		pool.Release("fd00:254::2")
+		Expect(pool.Acquire()).To(Equal("fd00:254::2"))
+	})
+
+	It("copes with IPv6 prefixes larger than it can use", func() {
+		pool, err := NewIPPool("fd00:254::/64")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(pool.Acquire()).To(Equal("fd00:254::2"))
+	})
+
+	It("rejects subnets which are too small", func() {
+		_, err := NewIPPool("10.254.0.0/31")
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewIPPool("fd00::/127")
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewIPPool("not-a-cidr")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,37 +1,419 @@
 package gardendocker
 
-import "github.com/cloudfoundry-incubator/garden"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// DiskLimitScope says what a container's disk limit and disk usage count.
+// The vendored garden DiskLimits has no scope, so it is chosen per container
+// with the DiskLimitScopeProperty.
+type DiskLimitScope string
+
+const (
+	// DiskLimitScopeTotal counts the container's image as well as the data
+	// it writes. As in garden, it is the default.
+	DiskLimitScopeTotal DiskLimitScope = "total"
+
+	// DiskLimitScopeExclusive counts only the data the container writes.
+	DiskLimitScopeExclusive DiskLimitScope = "exclusive"
+)
+
+const DiskLimitScopeProperty = "garden-docker.disk-limit-scope"
+
+func parseDiskLimitScope(scope string) (DiskLimitScope, error) {
+	switch DiskLimitScope(scope) {
+	case "", DiskLimitScopeTotal:
+		return DiskLimitScopeTotal, nil
+	case DiskLimitScopeExclusive:
+		return DiskLimitScopeExclusive, nil
+	default:
+		return "", fmt.Errorf("unknown disk limit scope %q", scope)
+	}
+}
+
+//go:generate counterfeiter . DiskUsage
+type DiskUsage interface {
+	// Usage returns the bytes the container has written, and those plus
+	// the bytes of its image.
+	Usage() (exclusive uint64, total uint64, err error)
+}
+
+//go:generate counterfeiter . Cgroup
+type Cgroup interface {
+	// SetMemory limits the container's memory to limitInBytes.
+	SetMemory(limitInBytes uint64) error
+
+	// Memory returns the memory limit in force, or zero if there is none.
+	Memory() (uint64, error)
+
+	// SetCPUShares sets the container's cpu weight relative to others.
+	SetCPUShares(shares uint64) error
+
+	// CPUShares returns the cpu weight in force, or zero for the default.
+	CPUShares() (uint64, error)
+}
 
 type LimitsHandler struct {
+	Pool *ResourcePool
+
+	// Cgroup, if set, is where limits are enforced and read back from.
+	// Without it they are only accounted for in the Pool.
+	Cgroup Cgroup
+
+	// Stats, if set, reports the container's memory and cpu usage.
+	Stats ContainerStats
+
+	DiskScope DiskLimitScope
+	DiskUsage DiskUsage
+
+	// DiskQuota, if set, enforces disk limits. Limits in the total scope
+	// are enforced by taking the size of the image off the quota.
+	DiskQuota DiskQuota
+
+	// Bandwidth, if set, enforces bandwidth limits and reads them back.
+	// Without it they are only recorded.
+	Bandwidth TrafficShaper
+
+	mu        sync.RWMutex
+	memory    garden.MemoryLimits
+	cpu       garden.CPULimits
+	disk      garden.DiskLimits
+	bandwidth garden.BandwidthLimits
+
+	oomMu    sync.Mutex
+	oomKills uint64
 }
 
 func (c *LimitsHandler) LimitBandwidth(limits garden.BandwidthLimits) error {
+	if limits.RateInBytesPerSecond != 0 && limits.BurstRateInBytesPerSecond == 0 {
+		return fmt.Errorf("limit bandwidth: a rate needs a burst")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Bandwidth != nil {
+		if err := c.Bandwidth.Shape(limits); err != nil {
+			return fmt.Errorf("limit bandwidth: %s", err)
+		}
+	}
+
+	c.bandwidth = limits
 	return nil
 }
 
+// CurrentBandwidthLimits returns the bandwidth limit in force, if the
+// container has a Bandwidth shaper, or else the last limit set.
 func (c *LimitsHandler) CurrentBandwidthLimits() (garden.BandwidthLimits, error) {
-	return garden.BandwidthLimits{}, nil
+	if c.Bandwidth != nil {
+		limits, err := c.Bandwidth.Limits()
+		if err != nil {
+			return garden.BandwidthLimits{}, fmt.Errorf("current bandwidth limits: %s", err)
+		}
+
+		return limits, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.bandwidth, nil
+}
+
+// RecoverBandwidthLimits records the bandwidth limit a restored container
+// was saved with, for ReapplyBandwidthLimits to enforce again should its
+// network namespace have been recreated.
+func (c *LimitsHandler) RecoverBandwidthLimits(limits garden.BandwidthLimits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bandwidth = limits
+}
+
+// ReapplyBandwidthLimits enforces the last bandwidth limit set again, for a
+// container whose docker container was restarted and so has a new veth.
+func (c *LimitsHandler) ReapplyBandwidthLimits() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Bandwidth == nil || c.bandwidth.RateInBytesPerSecond == 0 {
+		return nil
+	}
+
+	if err := c.Bandwidth.Shape(c.bandwidth); err != nil {
+		return fmt.Errorf("reapply bandwidth limits: %s", err)
+	}
+
+	return nil
+}
+
+// ReleaseBandwidthLimits removes the container's bandwidth limit, if it
+// has one.
+func (c *LimitsHandler) ReleaseBandwidthLimits() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Bandwidth == nil || c.bandwidth.RateInBytesPerSecond == 0 {
+		return nil
+	}
+
+	if err := c.Bandwidth.Shape(garden.BandwidthLimits{}); err != nil {
+		return fmt.Errorf("release bandwidth limits: %s", err)
+	}
+
+	c.bandwidth = garden.BandwidthLimits{}
+	return nil
 }
 
 func (c *LimitsHandler) LimitCPU(limits garden.CPULimits) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.commit(c.memory, limits, c.disk); err != nil {
+		return err
+	}
+
+	if c.Cgroup != nil {
+		if err := c.Cgroup.SetCPUShares(limits.LimitInShares); err != nil {
+			c.commit(c.memory, c.cpu, c.disk)
+			return fmt.Errorf("limit cpu: %s", err)
+		}
+	}
+
+	c.cpu = limits
 	return nil
 }
 
+// CurrentCPULimits returns the cpu shares in force in the container's
+// Cgroup, if it has one, or else the last limit set.
 func (c *LimitsHandler) CurrentCPULimits() (garden.CPULimits, error) {
-	return garden.CPULimits{}, nil
+	if c.Cgroup != nil {
+		shares, err := c.Cgroup.CPUShares()
+		if err != nil {
+			return garden.CPULimits{}, fmt.Errorf("current cpu limits: %s", err)
+		}
+
+		return garden.CPULimits{LimitInShares: shares}, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cpu, nil
 }
 
 func (c *LimitsHandler) LimitDisk(limits garden.DiskLimits) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.commit(c.memory, c.cpu, limits); err != nil {
+		return err
+	}
+
+	if c.DiskQuota != nil {
+		if err := c.enforceDisk(limits.ByteHard); err != nil {
+			c.commit(c.memory, c.cpu, c.disk)
+			return fmt.Errorf("limit disk: %s", err)
+		}
+	}
+
+	c.disk = limits
 	return nil
 }
+
+func (c *LimitsHandler) enforceDisk(byteHard uint64) error {
+	if byteHard == 0 || c.DiskScope == DiskLimitScopeExclusive || c.DiskUsage == nil {
+		return c.DiskQuota.Limit(byteHard)
+	}
+
+	exclusive, total, err := c.DiskUsage.Usage()
+	if err != nil {
+		return fmt.Errorf("disk usage: %s", err)
+	}
+
+	image := total - exclusive
+	if byteHard <= image {
+		return fmt.Errorf("limit of %d bytes leaves no room beyond the %d byte image", byteHard, image)
+	}
+
+	return c.DiskQuota.Limit(byteHard - image)
+}
+
 func (c *LimitsHandler) CurrentDiskLimits() (garden.DiskLimits, error) {
-	return garden.DiskLimits{}, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.disk, nil
 }
 
 func (c *LimitsHandler) LimitMemory(limits garden.MemoryLimits) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.commit(limits, c.cpu, c.disk); err != nil {
+		return err
+	}
+
+	if c.Cgroup != nil {
+		if err := c.Cgroup.SetMemory(limits.LimitInBytes); err != nil {
+			c.commit(c.memory, c.cpu, c.disk)
+			return fmt.Errorf("limit memory: %s", err)
+		}
+	}
+
+	c.memory = limits
 	return nil
 }
 
+// CurrentMemoryLimits returns the memory limit in force in the container's
+// Cgroup, if it has one, or else the last limit set.
 func (c *LimitsHandler) CurrentMemoryLimits() (garden.MemoryLimits, error) {
-	return garden.MemoryLimits{}, nil
+	if c.Cgroup != nil {
+		memory, err := c.Cgroup.Memory()
+		if err != nil {
+			return garden.MemoryLimits{}, fmt.Errorf("current memory limits: %s", err)
+		}
+
+		return garden.MemoryLimits{LimitInBytes: memory}, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.memory, nil
+}
+
+// DiskStat reports the container's disk usage in its DiskScope, so that it
+// can be compared with its disk limit.
+func (c *LimitsHandler) DiskStat() (garden.ContainerDiskStat, error) {
+	if c.DiskUsage == nil {
+		return garden.ContainerDiskStat{}, nil
+	}
+
+	exclusive, total, err := c.DiskUsage.Usage()
+	if err != nil {
+		return garden.ContainerDiskStat{}, fmt.Errorf("disk usage: %s", err)
+	}
+
+	if c.DiskScope == DiskLimitScopeExclusive {
+		return garden.ContainerDiskStat{BytesUsed: exclusive}, nil
+	}
+
+	return garden.ContainerDiskStat{BytesUsed: total}, nil
+}
+
+// RecoverLimits reads back the memory and cpu limits in force in the
+// container's Cgroup and commits them to the pool again, along with any disk
+// limit given by RecoverDiskLimits, for a container restored after
+// garden-docker restarts.
+func (c *LimitsHandler) RecoverLimits() error {
+	if c.Cgroup == nil {
+		return nil
+	}
+
+	memory, err := c.Cgroup.Memory()
+	if err != nil {
+		return fmt.Errorf("recover limits: %s", err)
+	}
+
+	shares, err := c.Cgroup.CPUShares()
+	if err != nil {
+		return fmt.Errorf("recover limits: %s", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := garden.MemoryLimits{LimitInBytes: memory}
+	cpu := garden.CPULimits{LimitInShares: shares}
+	if err := c.commit(m, cpu, c.disk); err != nil {
+		return fmt.Errorf("recover limits: %s", err)
+	}
+
+	c.memory, c.cpu = m, cpu
+	return nil
+}
+
+// RecoverDiskLimits records the disk limit a restored container was saved
+// with, which its quota still enforces, for RecoverLimits to commit.
+func (c *LimitsHandler) RecoverDiskLimits(limits garden.DiskLimits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.disk = limits
+}
+
+// limits returns the last limits set, or recovered, for the container.
+func (c *LimitsHandler) limits() MetadataLimits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return MetadataLimits{Memory: c.memory, CPU: c.cpu, Disk: c.disk, Bandwidth: c.bandwidth}
+}
+
+// ReleaseLimits returns the resources committed to the container's limits to
+// the pool.
+func (c *LimitsHandler) ReleaseLimits() {
+	if c.Pool != nil {
+		c.Pool.Release(c)
+	}
+}
+
+func (c *LimitsHandler) commit(memory garden.MemoryLimits, cpu garden.CPULimits, disk garden.DiskLimits) error {
+	if c.Pool == nil {
+		return nil
+	}
+
+	return c.Pool.Commit(c, Resources{
+		MemoryInBytes: memory.LimitInBytes,
+		DiskInBytes:   disk.ByteHard,
+	})
+}
+
+// DockerCgroup enforces a container's limits with docker update and reads
+// them back from docker inspect. Docker cannot lift a limit from a running
+// container, so a limit of zero leaves the current one in place.
+type DockerCgroup struct {
+	DockerRunner DockerRunner
+	DockerID     string
+}
+
+func (d *DockerCgroup) SetMemory(limitInBytes uint64) error {
+	if limitInBytes == 0 {
+		return nil
+	}
+
+	_, err := d.DockerRunner.Update(dockercli.UpdateCmd{ContainerID: d.DockerID, MemoryInBytes: limitInBytes})
+	return err
+}
+
+func (d *DockerCgroup) Memory() (uint64, error) {
+	info, err := d.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: d.DockerID})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(info.HostConfig.Memory), nil
+}
+
+func (d *DockerCgroup) SetCPUShares(shares uint64) error {
+	if shares == 0 {
+		return nil
+	}
+
+	_, err := d.DockerRunner.Update(dockercli.UpdateCmd{ContainerID: d.DockerID, CPUShares: shares})
+	return err
+}
+
+func (d *DockerCgroup) CPUShares() (uint64, error) {
+	info, err := d.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: d.DockerID})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(info.HostConfig.CPUShares), nil
 }
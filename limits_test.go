@@ -0,0 +1,285 @@
+package gardendocker_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	var pool *ResourcePool
+	var container, other *LimitsHandler
+
+	BeforeEach(func() {
+		fakeSystem := new(fakes.FakeSystemResources)
+		fakeSystem.TotalReturns(Resources{
+			MemoryInBytes: 1000,
+			DiskInBytes:   1000,
+		}, nil)
+
+		pool = &ResourcePool{
+			System:   fakeSystem,
+			Reserved: Resources{MemoryInBytes: 200, DiskInBytes: 200},
+		}
+
+		container = &LimitsHandler{Pool: pool}
+		other = &LimitsHandler{Pool: pool}
+	})
+
+	It("reports the limits which were set", func() {
+		Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 100})).To(Succeed())
+		Expect(container.LimitCPU(garden.CPULimits{LimitInShares: 512})).To(Succeed())
+		Expect(container.LimitDisk(garden.DiskLimits{ByteHard: 300})).To(Succeed())
+
+		Expect(container.CurrentMemoryLimits()).To(Equal(garden.MemoryLimits{LimitInBytes: 100}))
+		Expect(container.CurrentCPULimits()).To(Equal(garden.CPULimits{LimitInShares: 512}))
+		Expect(container.CurrentDiskLimits()).To(Equal(garden.DiskLimits{ByteHard: 300}))
+	})
+
+	Context("when the limits of all containers would exceed the unreserved resources", func() {
+		BeforeEach(func() {
+			Expect(other.LimitMemory(garden.MemoryLimits{LimitInBytes: 500})).To(Succeed())
+		})
+
+		It("rejects the limit and keeps the old one", func() {
+			Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 301})).To(MatchError(ErrInsufficientResources))
+			Expect(container.CurrentMemoryLimits()).To(Equal(garden.MemoryLimits{}))
+		})
+
+		It("allows limits up to the unreserved resources", func() {
+			Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 300})).To(Succeed())
+		})
+
+		It("does not count cpu shares, which are only relative weights", func() {
+			Expect(other.LimitCPU(garden.CPULimits{LimitInShares: 64 * 1024})).To(Succeed())
+			Expect(container.LimitCPU(garden.CPULimits{LimitInShares: 64 * 1024})).To(Succeed())
+		})
+
+		It("allows a container to lower its own limit", func() {
+			Expect(other.LimitMemory(garden.MemoryLimits{LimitInBytes: 400})).To(Succeed())
+		})
+
+		Context("and the other container's limits are released", func() {
+			It("allows the limit", func() {
+				other.ReleaseLimits()
+				Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 800})).To(Succeed())
+			})
+		})
+	})
+
+	Context("with a cgroup", func() {
+		var cgroup *fakes.FakeCgroup
+
+		BeforeEach(func() {
+			cgroup = new(fakes.FakeCgroup)
+			container.Cgroup = cgroup
+		})
+
+		It("enforces memory limits in it", func() {
+			Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 100})).To(Succeed())
+			Expect(cgroup.SetMemoryArgsForCall(0)).To(Equal(uint64(100)))
+		})
+
+		It("reads the memory limit in force back from it", func() {
+			cgroup.MemoryReturns(42, nil)
+			Expect(container.CurrentMemoryLimits()).To(Equal(garden.MemoryLimits{LimitInBytes: 42}))
+		})
+
+		It("enforces cpu limits in it", func() {
+			Expect(container.LimitCPU(garden.CPULimits{LimitInShares: 512})).To(Succeed())
+			Expect(cgroup.SetCPUSharesArgsForCall(0)).To(Equal(uint64(512)))
+		})
+
+		It("reads the cpu shares in force back from it", func() {
+			cgroup.CPUSharesReturns(256, nil)
+			Expect(container.CurrentCPULimits()).To(Equal(garden.CPULimits{LimitInShares: 256}))
+		})
+
+		Context("when enforcing the limit fails", func() {
+			It("returns an error and gives the resources back to the pool", func() {
+				cgroup.SetMemoryReturns(errors.New("boom"))
+				Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 800})).To(MatchError("limit memory: boom"))
+
+				Expect(other.LimitMemory(garden.MemoryLimits{LimitInBytes: 800})).To(Succeed())
+			})
+		})
+	})
+
+	Context("with a disk quota", func() {
+		var quota *fakes.FakeDiskQuota
+		var usage *fakes.FakeDiskUsage
+
+		BeforeEach(func() {
+			quota = new(fakes.FakeDiskQuota)
+			usage = new(fakes.FakeDiskUsage)
+			usage.UsageReturns(10, 110, nil)
+
+			container.DiskQuota = quota
+			container.DiskUsage = usage
+		})
+
+		It("takes the image off the quota in the total scope", func() {
+			container.DiskScope = DiskLimitScopeTotal
+			Expect(container.LimitDisk(garden.DiskLimits{ByteHard: 300})).To(Succeed())
+			Expect(quota.LimitArgsForCall(0)).To(Equal(uint64(200)))
+			Expect(container.CurrentDiskLimits()).To(Equal(garden.DiskLimits{ByteHard: 300}))
+		})
+
+		It("uses the whole limit in the exclusive scope", func() {
+			container.DiskScope = DiskLimitScopeExclusive
+			Expect(container.LimitDisk(garden.DiskLimits{ByteHard: 300})).To(Succeed())
+			Expect(quota.LimitArgsForCall(0)).To(Equal(uint64(300)))
+		})
+
+		It("rejects a total limit no bigger than the image", func() {
+			container.DiskScope = DiskLimitScopeTotal
+			Expect(container.LimitDisk(garden.DiskLimits{ByteHard: 100})).To(MatchError("limit disk: limit of 100 bytes leaves no room beyond the 100 byte image"))
+			Expect(quota.LimitCallCount()).To(Equal(0))
+			Expect(container.CurrentDiskLimits()).To(Equal(garden.DiskLimits{}))
+		})
+	})
+
+	Context("with a traffic shaper", func() {
+		var shaper *fakes.FakeTrafficShaper
+		limits := garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 100}
+
+		BeforeEach(func() {
+			shaper = new(fakes.FakeTrafficShaper)
+			container.Bandwidth = shaper
+		})
+
+		It("shapes the container's traffic and reads the limit back from the shaper", func() {
+			Expect(container.LimitBandwidth(limits)).To(Succeed())
+			Expect(shaper.ShapeArgsForCall(0)).To(Equal(limits))
+
+			shaper.LimitsReturns(garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 99}, nil)
+			Expect(container.CurrentBandwidthLimits()).To(Equal(garden.BandwidthLimits{RateInBytesPerSecond: 1000, BurstRateInBytesPerSecond: 99}))
+		})
+
+		It("rejects a rate without a burst", func() {
+			Expect(container.LimitBandwidth(garden.BandwidthLimits{RateInBytesPerSecond: 1000})).To(MatchError("limit bandwidth: a rate needs a burst"))
+			Expect(shaper.ShapeCallCount()).To(Equal(0))
+		})
+
+		It("lifts the limit on release, only if there is one", func() {
+			Expect(container.ReleaseBandwidthLimits()).To(Succeed())
+			Expect(shaper.ShapeCallCount()).To(Equal(0))
+
+			Expect(container.LimitBandwidth(limits)).To(Succeed())
+			Expect(container.ReleaseBandwidthLimits()).To(Succeed())
+			Expect(shaper.ShapeArgsForCall(1)).To(Equal(garden.BandwidthLimits{}))
+		})
+
+		It("reapplies a recovered limit", func() {
+			container.RecoverBandwidthLimits(limits)
+			Expect(container.ReapplyBandwidthLimits()).To(Succeed())
+			Expect(shaper.ShapeArgsForCall(0)).To(Equal(limits))
+		})
+
+		Context("when shaping fails", func() {
+			It("keeps the previous limit", func() {
+				shaper.ShapeReturns(errors.New("tc: no such device"))
+				Expect(container.LimitBandwidth(limits)).To(MatchError("limit bandwidth: tc: no such device"))
+
+				container.Bandwidth = nil
+				Expect(container.CurrentBandwidthLimits()).To(Equal(garden.BandwidthLimits{}))
+			})
+		})
+	})
+
+	Describe("DockerCgroup", func() {
+		var dockerRunner *fakes.FakeDockerRunner
+		var cgroup *DockerCgroup
+
+		BeforeEach(func() {
+			dockerRunner = new(fakes.FakeDockerRunner)
+			cgroup = &DockerCgroup{DockerRunner: dockerRunner, DockerID: "some-docker-id"}
+		})
+
+		It("sets the memory limit with docker update", func() {
+			Expect(cgroup.SetMemory(1024)).To(Succeed())
+			Expect(dockerRunner.UpdateArgsForCall(0)).To(Equal(dockercli.UpdateCmd{ContainerID: "some-docker-id", MemoryInBytes: 1024}))
+		})
+
+		It("leaves the limit alone when asked for no limit", func() {
+			Expect(cgroup.SetMemory(0)).To(Succeed())
+			Expect(dockerRunner.UpdateCallCount()).To(Equal(0))
+		})
+
+		It("sets cpu shares with docker update", func() {
+			Expect(cgroup.SetCPUShares(512)).To(Succeed())
+			Expect(dockerRunner.UpdateArgsForCall(0)).To(Equal(dockercli.UpdateCmd{ContainerID: "some-docker-id", CPUShares: 512}))
+		})
+
+		It("reads the cpu shares from docker inspect", func() {
+			info := dockercli.ContainerJSON{}
+			info.HostConfig.CPUShares = 256
+			dockerRunner.InspectReturns(info, nil)
+
+			Expect(cgroup.CPUShares()).To(Equal(uint64(256)))
+		})
+
+		It("reads the memory limit from docker inspect", func() {
+			info := dockercli.ContainerJSON{}
+			info.HostConfig.Memory = 2048
+			dockerRunner.InspectReturns(info, nil)
+
+			Expect(cgroup.Memory()).To(Equal(uint64(2048)))
+		})
+	})
+
+	Describe("DiskStat", func() {
+		var usage *fakes.FakeDiskUsage
+
+		BeforeEach(func() {
+			usage = new(fakes.FakeDiskUsage)
+			usage.UsageReturns(100, 1100, nil)
+			container.DiskUsage = usage
+		})
+
+		Context("when the disk limit scope is total", func() {
+			It("counts the image as well as the container's own data", func() {
+				container.DiskScope = DiskLimitScopeTotal
+				Expect(container.DiskStat()).To(Equal(garden.ContainerDiskStat{BytesUsed: 1100}))
+			})
+		})
+
+		Context("when the disk limit scope is exclusive", func() {
+			It("counts only the container's own data", func() {
+				container.DiskScope = DiskLimitScopeExclusive
+				Expect(container.DiskStat()).To(Equal(garden.ContainerDiskStat{BytesUsed: 100}))
+			})
+		})
+
+		Context("when the usage cannot be read", func() {
+			It("returns an error", func() {
+				usage.UsageReturns(0, 0, errors.New("boom"))
+
+				_, err := container.DiskStat()
+				Expect(err).To(MatchError("disk usage: boom"))
+			})
+		})
+	})
+})
+
+var _ = Describe("UnreservedCPUs", func() {
+	It("leaves out the first reserved CPUs", func() {
+		Expect(UnreservedCPUs(8, 2)).To(Equal("2-7"))
+		Expect(UnreservedCPUs(2, 1)).To(Equal("1"))
+	})
+
+	It("leaves containers unconfined when none are reserved", func() {
+		Expect(UnreservedCPUs(8, 0)).To(Equal(""))
+	})
+
+	It("refuses to reserve every CPU", func() {
+		_, err := UnreservedCPUs(4, 4)
+		Expect(err).To(MatchError("cannot reserve 4 of 4 CPUs"))
+	})
+})
@@ -0,0 +1,53 @@
+package gardendocker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// ListenTLSFiles are the PEM files the garden server's listener uses to only
+// accept mutually-authenticated TLS connections: its certificate and key, and
+// the CA every client's certificate must be signed by.
+type ListenTLSFiles struct {
+	Cert   string
+	Key    string
+	CACert string
+}
+
+// Enabled reports whether any of the files are set.
+func (f ListenTLSFiles) Enabled() bool {
+	return f.Cert != "" || f.Key != "" || f.CACert != ""
+}
+
+// Config loads the files into a tls.Config for the listener. All three must
+// be set: a listener which did not check client certificates would let
+// anyone who can reach it drive the backend.
+func (f ListenTLSFiles) Config() (*tls.Config, error) {
+	if f.Cert == "" || f.Key == "" || f.CACert == "" {
+		return nil, fmt.Errorf("listen tls: a certificate, its key and a client ca must be given together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return nil, fmt.Errorf("listen tls: load certificate: %s", err)
+	}
+
+	pem, err := ioutil.ReadFile(f.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("listen tls: load ca: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("listen tls: no certificates in %s", f.CACert)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,170 @@
+package gardendocker_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListenTLSFiles", func() {
+	var dir string
+	var caCert *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	var files ListenTLSFiles
+
+	// issue writes a certificate for name signed by the ca (or self-signed
+	// if the ca is nil or it is the ca) and its key to dir.
+	issue := func(name string, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		}
+
+		parent, signer := template, key
+		if caCert != nil && !isCA {
+			parent, signer = caCert, caKey
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+		Expect(err).NotTo(HaveOccurred())
+
+		cert, err := x509.ParseCertificate(der)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		Expect(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+
+		return cert, key, certPath, keyPath
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "listen-tls")
+		Expect(err).NotTo(HaveOccurred())
+
+		var caPath string
+		caCert, caKey, caPath, _ = issue("ca", true)
+
+		_, _, certPath, keyPath := issue("server", false)
+		files = ListenTLSFiles{Cert: certPath, Key: keyPath, CACert: caPath}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("is enabled when any file is set", func() {
+		Expect(ListenTLSFiles{}.Enabled()).To(BeFalse())
+		Expect(ListenTLSFiles{CACert: "ca.crt"}.Enabled()).To(BeTrue())
+	})
+
+	It("requires all three files", func() {
+		files.CACert = ""
+		_, err := files.Config()
+		Expect(err).To(MatchError(ContainSubstring("must be given together")))
+	})
+
+	It("fails when the ca has no certificates", func() {
+		Expect(ioutil.WriteFile(files.CACert, []byte("nonsense"), 0600)).To(Succeed())
+		_, err := files.Config()
+		Expect(err).To(MatchError(ContainSubstring("no certificates")))
+	})
+
+	Describe("a listener using the config", func() {
+		var listener net.Listener
+		var roots *x509.CertPool
+
+		BeforeEach(func() {
+			config, err := files.Config()
+			Expect(err).NotTo(HaveOccurred())
+
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			listener = tls.NewListener(listener, config)
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+
+					go func() {
+						defer conn.Close()
+						conn.Write([]byte("hello"))
+					}()
+				}
+			}()
+
+			roots = x509.NewCertPool()
+			roots.AddCert(caCert)
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		read := func(config *tls.Config) (string, error) {
+			conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+
+			data, err := ioutil.ReadAll(conn)
+			return string(data), err
+		}
+
+		It("accepts clients with a certificate signed by the ca", func() {
+			_, _, certPath, keyPath := issue("client", false)
+			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(read(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})).To(Equal("hello"))
+		})
+
+		It("rejects clients without a certificate", func() {
+			_, err := read(&tls.Config{RootCAs: roots})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects clients with a certificate signed by another ca", func() {
+			caCert = nil
+			_, _, certPath, keyPath := issue("stranger", false)
+			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = read(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
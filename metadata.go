@@ -0,0 +1,172 @@
+package gardendocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+// MetadataFile is the file in a container's depot directory which holds its
+// ContainerMetadata.
+const MetadataFile = "metadata.json"
+
+// ContainerMetadata is everything about a container that garden-docker needs
+// to bring it back after a crash and that docker does not keep for it. It is
+// saved in the container's depot directory when the container is created
+// and whenever it changes.
+type ContainerMetadata struct {
+	Handle       string               `json:"handle"`
+	DockerID     string               `json:"docker_id"`
+	RootFSPath   string               `json:"rootfs"`
+	Env          []string             `json:"env,omitempty"`
+	Properties   garden.Properties    `json:"properties,omitempty"`
+	PortMappings []garden.PortMapping `json:"port_mappings,omitempty"`
+	NetOut       []garden.NetOutRule  `json:"net_out,omitempty"`
+	Limits       MetadataLimits       `json:"limits"`
+}
+
+type MetadataLimits struct {
+	Memory    garden.MemoryLimits    `json:"memory"`
+	CPU       garden.CPULimits       `json:"cpu"`
+	Disk      garden.DiskLimits      `json:"disk"`
+	Bandwidth garden.BandwidthLimits `json:"bandwidth"`
+}
+
+// ReadMetadata reads the metadata saved in the depot directory dir, or
+// returns nil if there is none, as for containers created before
+// garden-docker saved it.
+func ReadMetadata(dir string) (*ContainerMetadata, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, MetadataFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read metadata: %s", err)
+	}
+
+	var metadata ContainerMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("read metadata: %s", err)
+	}
+
+	return &metadata, nil
+}
+
+// SaveMetadata replaces the container's saved metadata with its current
+// state, if it has a MetadataPath.
+func (c *Container) SaveMetadata() error {
+	if c.InfoHandler == nil || c.MetadataPath == "" {
+		return nil
+	}
+
+	c.metadataMu.Lock()
+	defer c.metadataMu.Unlock()
+
+	metadata := ContainerMetadata{
+		Handle:     c.Handle(),
+		DockerID:   c.DockerID,
+		RootFSPath: c.Spec.RootFSPath,
+		Env:        c.Spec.Env,
+	}
+
+	if c.PropsHandler != nil {
+		metadata.Properties = c.ownProperties()
+	}
+
+	if c.NetHandler != nil {
+		metadata.PortMappings = c.PortMappings()
+		metadata.NetOut = c.NetOutRules()
+	}
+
+	if c.LimitsHandler != nil {
+		metadata.Limits = c.LimitsHandler.limits()
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("save metadata: %s", err)
+	}
+
+	if err := writeStateFile(c.MetadataPath, data); err != nil {
+		return fmt.Errorf("save metadata: %s", err)
+	}
+
+	return nil
+}
+
+// The operations below change what is saved in the container's metadata, so
+// save it again once they succeed.
+
+func (c *Container) SetProperty(name, value string) error {
+	if err := c.PropsHandler.SetProperty(name, value); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) RemoveProperty(name string) error {
+	if err := c.PropsHandler.RemoveProperty(name); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
+	hostPort, containerPort, err := c.NetHandler.NetIn(hostPort, containerPort)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := c.SaveMetadata(); err != nil {
+		return 0, 0, fmt.Errorf("netin: %s", err)
+	}
+
+	return hostPort, containerPort, nil
+}
+
+func (c *Container) NetOut(netOutRule garden.NetOutRule) error {
+	if err := c.NetHandler.NetOut(netOutRule); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) LimitMemory(limits garden.MemoryLimits) error {
+	if err := c.LimitsHandler.LimitMemory(limits); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) LimitCPU(limits garden.CPULimits) error {
+	if err := c.LimitsHandler.LimitCPU(limits); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) LimitBandwidth(limits garden.BandwidthLimits) error {
+	if err := c.LimitsHandler.LimitBandwidth(limits); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
+
+func (c *Container) LimitDisk(limits garden.DiskLimits) error {
+	if err := c.LimitsHandler.LimitDisk(limits); err != nil {
+		return err
+	}
+
+	return c.SaveMetadata()
+}
@@ -0,0 +1,116 @@
+package gardendocker_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Container metadata", func() {
+	var dir string
+	var container *Container
+
+	metadata := func() *ContainerMetadata {
+		metadata, err := ReadMetadata(dir)
+		Expect(err).NotTo(HaveOccurred())
+		return metadata
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "metadata")
+		Expect(err).NotTo(HaveOccurred())
+
+		container = &Container{
+			InfoHandler: &InfoHandler{
+				Spec: garden.ContainerSpec{
+					Handle:     "some-handle",
+					RootFSPath: "docker:///busybox",
+					Env:        []string{"A=B"},
+				},
+				DockerID:     "some-docker-id",
+				MetadataPath: filepath.Join(dir, MetadataFile),
+				PropsHandler: NewPropsHandler(garden.Properties{"app": "web"}),
+			},
+			NetHandler: &NetHandler{
+				Chain:    new(fakes.FakeChain),
+				PortPool: port_pool.New(100, 10),
+			},
+			LimitsHandler: &LimitsHandler{},
+		}
+		container.ImportLabels(map[string]string{"some-label": "x"})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("saves what is needed to restore the container, without its imported labels", func() {
+		Expect(container.SaveMetadata()).To(Succeed())
+
+		Expect(metadata()).To(Equal(&ContainerMetadata{
+			Handle:     "some-handle",
+			DockerID:   "some-docker-id",
+			RootFSPath: "docker:///busybox",
+			Env:        []string{"A=B"},
+			Properties: garden.Properties{"app": "web"},
+		}))
+	})
+
+	It("is saved again when the container changes", func() {
+		Expect(container.SetProperty("instance", "0")).To(Succeed())
+		Expect(metadata().Properties).To(HaveKeyWithValue("instance", "0"))
+
+		Expect(container.RemoveProperty("app")).To(Succeed())
+		Expect(metadata().Properties).NotTo(HaveKey("app"))
+
+		_, _, err := container.NetIn(0, 8080)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata().PortMappings).To(Equal([]garden.PortMapping{{HostPort: 100, ContainerPort: 8080}}))
+
+		Expect(container.NetOut(garden.NetOutRule{Protocol: garden.ProtocolTCP})).To(Succeed())
+		Expect(metadata().NetOut).To(Equal([]garden.NetOutRule{{Protocol: garden.ProtocolTCP}}))
+
+		Expect(container.LimitMemory(garden.MemoryLimits{LimitInBytes: 1024})).To(Succeed())
+		Expect(container.LimitCPU(garden.CPULimits{LimitInShares: 512})).To(Succeed())
+		Expect(container.LimitDisk(garden.DiskLimits{ByteHard: 4096})).To(Succeed())
+		Expect(metadata().Limits).To(Equal(MetadataLimits{
+			Memory: garden.MemoryLimits{LimitInBytes: 1024},
+			CPU:    garden.CPULimits{LimitInShares: 512},
+			Disk:   garden.DiskLimits{ByteHard: 4096},
+		}))
+	})
+
+	It("ends up with the latest state when the container changes concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				Expect(container.SetProperty(fmt.Sprintf("p%d", i), "x")).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+
+		Expect(metadata().Properties).To(HaveLen(21))
+	})
+
+	It("is not saved when there is nowhere to save it", func() {
+		container.MetadataPath = ""
+
+		Expect(container.SaveMetadata()).To(Succeed())
+		Expect(metadata()).To(BeNil())
+	})
+})
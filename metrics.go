@@ -0,0 +1,127 @@
+package gardendocker
+
+import (
+	"net"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/docker/docker/pkg/iptables"
+	"github.com/julz/garden-docker/metrics"
+)
+
+// BackendMetrics records how long creating and destroying containers takes,
+// by whether it succeeded.
+type BackendMetrics struct {
+	CreateDuration  *metrics.HistogramVec
+	DestroyDuration *metrics.HistogramVec
+}
+
+func NewBackendMetrics(registry *metrics.Registry) *BackendMetrics {
+	return &BackendMetrics{
+		CreateDuration: registry.NewHistogramVec(
+			"container_create_duration_seconds",
+			"Time taken to create a container, including pulling its image.",
+			metrics.DefaultBuckets,
+			"result",
+		),
+		DestroyDuration: registry.NewHistogramVec(
+			"container_destroy_duration_seconds",
+			"Time taken to destroy a container.",
+			metrics.DefaultBuckets,
+			"result",
+		),
+	}
+}
+
+//go:generate counterfeiter . MetricEmitter
+
+// MetricEmitter sends metrics somewhere other than the prometheus registry,
+// such as to a metron agent.
+type MetricEmitter interface {
+	SendValue(name string, value float64, unit string) error
+	IncrementCounter(name string) error
+}
+
+// observe records how long a create or destroy which started at start took,
+// and whether it succeeded, in the backend's Metrics and to its Emitter,
+// whichever are set. The Emitter is sent e.g. ContainerCreations or
+// ContainerCreationFailures, and ContainerCreationDuration.
+func (b *Backend) observe(operation string, start time.Time, err error) {
+	if b.Metrics != nil {
+		h := b.Metrics.CreateDuration
+		if operation == "destroy" {
+			h = b.Metrics.DestroyDuration
+		}
+
+		if err != nil {
+			h.Since(start, "failure")
+		} else {
+			h.Since(start, "success")
+		}
+	}
+
+	if b.Emitter != nil {
+		noun := "ContainerCreation"
+		if operation == "destroy" {
+			noun = "ContainerDestruction"
+		}
+
+		if err != nil {
+			b.Emitter.IncrementCounter(noun + "Failures")
+		} else {
+			b.Emitter.IncrementCounter(noun + "s")
+		}
+
+		b.Emitter.SendValue(noun+"Duration", float64(time.Since(start))/float64(time.Millisecond), "ms")
+	}
+}
+
+// NewIPTablesMetrics returns the histogram TimedFirewall and TimedChain
+// record how long programming iptables takes in, by operation.
+func NewIPTablesMetrics(registry *metrics.Registry) *metrics.HistogramVec {
+	return registry.NewHistogramVec(
+		"iptables_duration_seconds",
+		"Time taken to program iptables, by operation.",
+		metrics.DefaultBuckets,
+		"operation",
+	)
+}
+
+// TimedFirewall is a Firewall which records how long each call to the
+// Firewall it wraps takes.
+type TimedFirewall struct {
+	Firewall
+	Duration *metrics.HistogramVec
+}
+
+func (f *TimedFirewall) Setup(id, containerIP string) error {
+	defer f.Duration.Since(time.Now(), "firewall_setup")
+	return f.Firewall.Setup(id, containerIP)
+}
+
+func (f *TimedFirewall) Allow(id string, rule garden.NetOutRule) error {
+	defer f.Duration.Since(time.Now(), "firewall_allow")
+	return f.Firewall.Allow(id, rule)
+}
+
+func (f *TimedFirewall) Teardown(id, containerIP string) error {
+	defer f.Duration.Since(time.Now(), "firewall_teardown")
+	return f.Firewall.Teardown(id, containerIP)
+}
+
+// TimedChain is a Chain which records how long adding and deleting port
+// forwards in the Chain it wraps takes.
+type TimedChain struct {
+	Chain
+	Duration *metrics.HistogramVec
+}
+
+func (c *TimedChain) Forward(handle string, action iptables.Action, ip net.IP, port int, proto, destAddr string, destPort int) error {
+	operation := "forward_add"
+	if action == iptables.Delete {
+		operation = "forward_delete"
+	}
+
+	defer c.Duration.Since(time.Now(), operation)
+	return c.Chain.Forward(handle, action, ip, port, proto, destAddr, destPort)
+}
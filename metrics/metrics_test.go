@@ -0,0 +1,76 @@
+package metrics_test
+
+import (
+	"bytes"
+
+	. "github.com/julz/garden-docker/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *Registry
+
+	BeforeEach(func() {
+		registry = NewRegistry()
+	})
+
+	exposition := func() string {
+		var buf bytes.Buffer
+		registry.Expose(&buf)
+		return buf.String()
+	}
+
+	Describe("counters", func() {
+		It("are written with their labels", func() {
+			counter := registry.NewCounterVec("things_total", "Number of things.", "kind")
+			counter.Inc("a")
+			counter.Inc("a")
+			counter.Add(3, "b")
+
+			Expect(counter.Value("a")).To(BeEquivalentTo(2))
+			Expect(exposition()).To(Equal(
+				"# HELP things_total Number of things.\n" +
+					"# TYPE things_total counter\n" +
+					"things_total{kind=\"a\"} 2\n" +
+					"things_total{kind=\"b\"} 3\n",
+			))
+		})
+
+		It("panics when given the wrong number of label values", func() {
+			counter := registry.NewCounterVec("things_total", "Number of things.", "kind")
+			Expect(func() { counter.Inc() }).To(Panic())
+		})
+	})
+
+	Describe("gauge funcs", func() {
+		It("are evaluated when written", func() {
+			value := 1.0
+			registry.NewGaugeFunc("level", "The level.", func() float64 { return value })
+			value = 5
+
+			Expect(exposition()).To(ContainSubstring("level 5\n"))
+		})
+	})
+
+	Describe("histograms", func() {
+		It("are written as cumulative buckets with a sum and count", func() {
+			hist := registry.NewHistogramVec("duration_seconds", "How long.", []float64{1, 5}, "op")
+			hist.Observe(0.5, "x")
+			hist.Observe(3, "x")
+			hist.Observe(10, "x")
+
+			Expect(hist.Count("x")).To(BeEquivalentTo(3))
+			Expect(exposition()).To(Equal(
+				"# HELP duration_seconds How long.\n" +
+					"# TYPE duration_seconds histogram\n" +
+					"duration_seconds_bucket{op=\"x\",le=\"1\"} 1\n" +
+					"duration_seconds_bucket{op=\"x\",le=\"5\"} 2\n" +
+					"duration_seconds_bucket{op=\"x\",le=\"+Inf\"} 3\n" +
+					"duration_seconds_sum{op=\"x\"} 13.5\n" +
+					"duration_seconds_count{op=\"x\"} 3\n",
+			))
+		})
+	})
+})
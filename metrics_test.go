@@ -0,0 +1,53 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/docker/docker/pkg/iptables"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	"github.com/julz/garden-docker/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timing iptables", func() {
+	var duration *metrics.HistogramVec
+
+	BeforeEach(func() {
+		duration = gardendocker.NewIPTablesMetrics(metrics.NewRegistry())
+	})
+
+	Describe("TimedFirewall", func() {
+		It("records each call by operation, passing through its result", func() {
+			fake := new(fakes.FakeFirewall)
+			fake.AllowReturns(errors.New("boom"))
+			firewall := &gardendocker.TimedFirewall{Firewall: fake, Duration: duration}
+
+			Expect(firewall.Setup("id", "10.0.0.2")).To(Succeed())
+			Expect(firewall.Allow("id", garden.NetOutRule{})).To(MatchError("boom"))
+			Expect(firewall.Teardown("id", "10.0.0.2")).To(Succeed())
+
+			Expect(fake.SetupCallCount()).To(Equal(1))
+			Expect(duration.Count("firewall_setup")).To(BeEquivalentTo(1))
+			Expect(duration.Count("firewall_allow")).To(BeEquivalentTo(1))
+			Expect(duration.Count("firewall_teardown")).To(BeEquivalentTo(1))
+		})
+	})
+
+	Describe("TimedChain", func() {
+		It("records adding and deleting forwards separately", func() {
+			fake := new(fakes.FakeChain)
+			chain := &gardendocker.TimedChain{Chain: fake, Duration: duration}
+
+			Expect(chain.Forward("some-handle", iptables.Add, net.ParseIP("1.2.3.4"), 80, "tcp", "10.0.0.2", 8080)).To(Succeed())
+			Expect(chain.Forward("some-handle", iptables.Delete, net.ParseIP("1.2.3.4"), 80, "tcp", "10.0.0.2", 8080)).To(Succeed())
+
+			Expect(fake.ForwardCallCount()).To(Equal(2))
+			Expect(duration.Count("forward_add")).To(BeEquivalentTo(1))
+			Expect(duration.Count("forward_delete")).To(BeEquivalentTo(1))
+		})
+	})
+})
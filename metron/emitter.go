@@ -0,0 +1,66 @@
+// Package metron emits dropsonde value metrics and counter events to a
+// metron agent, for Cloud Foundry's loggregator.
+package metron
+
+import (
+	"net"
+	"runtime"
+	"time"
+)
+
+// Emitter sends metrics, as dropsonde envelopes from Origin, to the metron
+// agent it was dialled to. Sends are fire and forget UDP datagrams, as with
+// dropsonde itself.
+type Emitter struct {
+	Origin string
+
+	conn net.Conn
+}
+
+// Dial returns an Emitter sending to the metron agent at addr, typically
+// localhost:3457.
+func Dial(addr, origin string) (*Emitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Emitter{Origin: origin, conn: conn}, nil
+}
+
+func (e *Emitter) SendValue(name string, value float64, unit string) error {
+	_, err := e.conn.Write(valueMetricEnvelope(e.Origin, time.Now().UnixNano(), name, value, unit))
+	return err
+}
+
+func (e *Emitter) IncrementCounter(name string) error {
+	_, err := e.conn.Write(counterEventEnvelope(e.Origin, time.Now().UnixNano(), name, 1))
+	return err
+}
+
+// EmitEvery sends the value of each of the gauges, along with the runtime
+// stats dropsonde sends for every go process, every interval. It never
+// returns.
+func (e *Emitter) EmitEvery(interval time.Duration, gauges map[string]func() float64) {
+	for range time.Tick(interval) {
+		e.emitRuntimeStats()
+
+		for name, gauge := range gauges {
+			e.SendValue(name, gauge(), "count")
+		}
+	}
+}
+
+func (e *Emitter) emitRuntimeStats() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	e.SendValue("numCPUS", float64(runtime.NumCPU()), "count")
+	e.SendValue("numGoRoutines", float64(runtime.NumGoroutine()), "count")
+	e.SendValue("memoryStats.numBytesAllocatedHeap", float64(stats.HeapAlloc), "count")
+	e.SendValue("memoryStats.numBytesAllocatedStack", float64(stats.StackInuse), "count")
+	e.SendValue("memoryStats.numBytesAllocated", float64(stats.Alloc), "count")
+	e.SendValue("memoryStats.numMallocs", float64(stats.Mallocs), "count")
+	e.SendValue("memoryStats.numFrees", float64(stats.Frees), "count")
+	e.SendValue("memoryStats.lastGCPauseTimeNS", float64(stats.PauseNs[(stats.NumGC+255)%256]), "count")
+}
@@ -0,0 +1,94 @@
+package metron_test
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"time"
+
+	. "github.com/julz/garden-docker/metron"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fields decodes a protobuf message into its fields' raw values: a uint64
+// for varints, a float64 for fixed64s and a []byte for anything
+// length-delimited.
+func fields(b []byte) map[int]interface{} {
+	decoded := map[int]interface{}{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			decoded[int(key>>3)] = v
+			b = b[n:]
+		case 1:
+			decoded[int(key>>3)] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			decoded[int(key>>3)] = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			Fail("unexpected wire type")
+		}
+	}
+
+	return decoded
+}
+
+var _ = Describe("Emitter", func() {
+	var metron *net.UDPConn
+	var emitter *Emitter
+
+	BeforeEach(func() {
+		var err error
+		metron, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		Expect(err).NotTo(HaveOccurred())
+
+		emitter, err = Dial(metron.LocalAddr().String(), "garden-docker")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		metron.Close()
+	})
+
+	receive := func() map[int]interface{} {
+		buf := make([]byte, 1024)
+		metron.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := metron.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+		return fields(buf[:n])
+	}
+
+	It("sends values as ValueMetric envelopes", func() {
+		Expect(emitter.SendValue("ContainerCreationDuration", 12.5, "ms")).To(Succeed())
+
+		envelope := receive()
+		Expect(envelope[1]).To(BeEquivalentTo("garden-docker"))
+		Expect(envelope[2]).To(BeEquivalentTo(6))
+		Expect(envelope[6]).To(BeNumerically("~", time.Now().UnixNano(), float64(time.Second)))
+
+		metric := fields(envelope[11].([]byte))
+		Expect(metric[1]).To(BeEquivalentTo("ContainerCreationDuration"))
+		Expect(metric[2]).To(Equal(12.5))
+		Expect(metric[3]).To(BeEquivalentTo("ms"))
+	})
+
+	It("sends counter increments as CounterEvent envelopes", func() {
+		Expect(emitter.IncrementCounter("ContainerCreations")).To(Succeed())
+
+		envelope := receive()
+		Expect(envelope[1]).To(BeEquivalentTo("garden-docker"))
+		Expect(envelope[2]).To(BeEquivalentTo(7))
+
+		event := fields(envelope[12].([]byte))
+		Expect(event[1]).To(BeEquivalentTo("ContainerCreations"))
+		Expect(event[2]).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,87 @@
+package metron
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The parts of dropsonde's events.proto which the Emitter sends. Envelopes
+// are encoded by hand, as protobuf, so as not to need the dropsonde and
+// gogoprotobuf libraries for two message types.
+const (
+	envelopeOrigin       = 1
+	envelopeEventType    = 2
+	envelopeTimestamp    = 6
+	envelopeValueMetric  = 11
+	envelopeCounterEvent = 12
+
+	eventTypeValueMetric  = 6
+	eventTypeCounterEvent = 7
+
+	valueMetricName  = 1
+	valueMetricValue = 2
+	valueMetricUnit  = 3
+
+	counterEventName  = 1
+	counterEventDelta = 2
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type message []byte
+
+func (m message) key(field, wireType int) message {
+	return m.varint(uint64(field<<3 | wireType))
+}
+
+func (m message) varint(v uint64) message {
+	var buf [binary.MaxVarintLen64]byte
+	return append(m, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (m message) uint(field int, v uint64) message {
+	return m.key(field, wireVarint).varint(v)
+}
+
+func (m message) double(field int, v float64) message {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(m.key(field, wireFixed64), buf[:]...)
+}
+
+func (m message) bytes(field int, b []byte) message {
+	return append(m.key(field, wireBytes).varint(uint64(len(b))), b...)
+}
+
+func (m message) string(field int, s string) message {
+	return m.bytes(field, []byte(s))
+}
+
+func valueMetricEnvelope(origin string, timestamp int64, name string, value float64, unit string) []byte {
+	metric := message(nil).
+		string(valueMetricName, name).
+		double(valueMetricValue, value).
+		string(valueMetricUnit, unit)
+
+	return message(nil).
+		string(envelopeOrigin, origin).
+		uint(envelopeEventType, eventTypeValueMetric).
+		uint(envelopeTimestamp, uint64(timestamp)).
+		bytes(envelopeValueMetric, metric)
+}
+
+func counterEventEnvelope(origin string, timestamp int64, name string, delta uint64) []byte {
+	event := message(nil).
+		string(counterEventName, name).
+		uint(counterEventDelta, delta)
+
+	return message(nil).
+		string(envelopeOrigin, origin).
+		uint(envelopeEventType, eventTypeCounterEvent).
+		uint(envelopeTimestamp, uint64(timestamp)).
+		bytes(envelopeCounterEvent, event)
+}
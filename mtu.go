@@ -0,0 +1,65 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+//go:generate counterfeiter . LinkConfigurer
+type LinkConfigurer interface {
+	// Configure configures the network interfaces of the container whose
+	// init process has the given pid, once it is connected to the network.
+	Configure(pid int) error
+}
+
+// MTU is a LinkConfigurer which sets the MTU of a container's IfName
+// interface, and of the host end of its veth pair, for hosts whose own
+// network has a smaller MTU than docker's default of 1500, as overlay
+// networks (VXLAN, GRE) do.
+type MTU struct {
+	MTU    int
+	IfName string
+
+	CommandRunner command_runner.CommandRunner
+
+	// ProcPath is where proc is mounted, /proc if empty.
+	ProcPath string
+}
+
+func (m *MTU) Configure(pid int) error {
+	veth, err := hostVeth(m.ProcPath, pid, m.IfName)
+	if err != nil {
+		return fmt.Errorf("set mtu: %s", err)
+	}
+
+	mtu := strconv.Itoa(m.MTU)
+	if err := m.run("ip", "link", "set", "dev", veth, "mtu", mtu); err != nil {
+		return err
+	}
+
+	return m.run("nsenter", "--net=/proc/"+strconv.Itoa(pid)+"/ns/net", "ip", "link", "set", "dev", m.IfName, "mtu", mtu)
+}
+
+// SetBridge sets the MTU of the bridge containers' veth pairs are attached
+// to, so that it does not hold on to a larger one set before.
+func (m *MTU) SetBridge(bridge string) error {
+	return m.run("ip", "link", "set", "dev", bridge, "mtu", strconv.Itoa(m.MTU))
+}
+
+func (m *MTU) run(name string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := m.CommandRunner.Run(cmd); err != nil {
+		return fmt.Errorf("set mtu: %s %s: %s: %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU", func() {
+	var commandRunner *fake_command_runner.FakeCommandRunner
+	var mtu *MTU
+	var procPath string
+	var veth string
+
+	BeforeEach(func() {
+		var err error
+		procPath, err = ioutil.TempDir("", "proc")
+		Expect(err).NotTo(HaveOccurred())
+
+		// the loopback interface stands in for the host end of the veth
+		interfaces, err := net.Interfaces()
+		Expect(err).NotTo(HaveOccurred())
+		veth = interfaces[0].Name
+
+		netDir := filepath.Join(procPath, "1234", "root", "sys", "class", "net", "eth0")
+		Expect(os.MkdirAll(netDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(netDir, "iflink"), []byte(strconv.Itoa(interfaces[0].Index)+"\n"), 0644)).To(Succeed())
+
+		commandRunner = fake_command_runner.New()
+		mtu = &MTU{MTU: 1450, IfName: "eth0", CommandRunner: commandRunner, ProcPath: procPath}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(procPath)
+	})
+
+	It("sets the MTU of the host end of the veth and of the container's interface", func() {
+		Expect(mtu.Configure(1234)).To(Succeed())
+
+		commands := commandRunner.ExecutedCommands()
+		Expect(commands).To(HaveLen(2))
+		Expect(commands[0].Args).To(Equal([]string{"ip", "link", "set", "dev", veth, "mtu", "1450"}))
+		Expect(commands[1].Args).To(Equal([]string{"nsenter", "--net=/proc/1234/ns/net", "ip", "link", "set", "dev", "eth0", "mtu", "1450"}))
+	})
+
+	It("fails if the container has no such interface", func() {
+		mtu.IfName = "eth1"
+		Expect(mtu.Configure(1234)).To(MatchError(ContainSubstring("find eth1's veth")))
+		Expect(commandRunner.ExecutedCommands()).To(BeEmpty())
+	})
+
+	It("sets the MTU of the bridge", func() {
+		Expect(mtu.SetBridge("gd0")).To(Succeed())
+		Expect(commandRunner.ExecutedCommands()[0].Args).To(Equal([]string{"ip", "link", "set", "dev", "gd0", "mtu", "1450"}))
+	})
+})
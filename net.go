@@ -1,8 +1,13 @@
 package gardendocker
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"strconv"
+	"sync"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
@@ -12,37 +17,446 @@ import (
 
 //go:generate counterfeiter . Chain
 type Chain interface {
-	Forward(action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) error
+	// Forward adds or deletes the rules forwarding a host port to the
+	// container with the given handle, tagging them with the handle.
+	Forward(handle string, action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) error
+	ForwardExists(handle string, ip net.IP, port int, proto, dest_addr string, dest_port int) bool
+}
+
+// IPTablesChain is a Chain backed by a docker iptables chain in the nat
+// table. It adds the same rules as docker's Chain.Forward, but tagged with
+// the container's handle so that TaggedRules can find them, and all in one
+// RuleSet.
+type IPTablesChain struct {
+	*iptables.Chain
+}
+
+func (c *IPTablesChain) Forward(handle string, action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) error {
+	return c.ForwardRules(handle, action, ip, port, proto, dest_addr, dest_port).Apply()
+}
+
+// ForwardExists reports whether the DNAT rule which Forward would add is
+// present in the chain.
+func (c *IPTablesChain) ForwardExists(handle string, ip net.IP, port int, proto, dest_addr string, dest_port int) bool {
+	_, err := iptables.Raw(append([]string{"-t", "nat", "-C", c.Name}, c.dnat(handle, ip, port, proto, dest_addr, dest_port)...)...)
+	return err == nil
+}
+
+// ForwardRules returns the RuleSet Forward applies: the DNAT from the host
+// port, the acceptance of the forwarded traffic in FORWARD, and the
+// MASQUERADE which lets the container reach itself through the host port.
+func (c *IPTablesChain) ForwardRules(handle string, action iptables.Action, ip net.IP, port int, proto, dest_addr string, dest_port int) *RuleSet {
+	fAction := string(action)
+	if action == iptables.Add {
+		fAction = "-I"
+	}
+
+	tag := ruleComment(handle)
+
+	rules := &RuleSet{}
+	rules.Add("nat", append([]string{string(action), c.Name}, c.dnat(handle, ip, port, proto, dest_addr, dest_port)...)...)
+
+	accept := []string{fAction, "FORWARD", "!", "-i", c.Bridge, "-o", c.Bridge, "-p", proto, "-d", dest_addr, "--dport", strconv.Itoa(dest_port)}
+	rules.Add("filter", append(append(accept, tag...), "-j", "ACCEPT")...)
+
+	masquerade := []string{fAction, "POSTROUTING", "-p", proto, "-s", dest_addr, "-d", dest_addr, "--dport", strconv.Itoa(dest_port)}
+	rules.Add("nat", append(append(masquerade, tag...), "-j", "MASQUERADE")...)
+
+	return rules
+}
+
+func (c *IPTablesChain) dnat(handle string, ip net.IP, port int, proto, dest_addr string, dest_port int) []string {
+	daddr := ip.String()
+	if ip.IsUnspecified() {
+		// iptables takes "0.0.0.0" to mean "0.0.0.0/32"
+		daddr = "0/0"
+	}
+
+	dnat := append([]string{"-p", proto, "-d", daddr, "--dport", strconv.Itoa(port)}, ruleComment(handle)...)
+	return append(dnat, "-j", "DNAT", "--to-destination", net.JoinHostPort(dest_addr, strconv.Itoa(dest_port)))
+}
+
+// NoopChain is a Chain which leaves iptables alone, for deployments where an
+// external network manager (an SDN agent or CNI daemon, say) forwards ports
+// to containers. NetIn still hands out host ports and records the mappings,
+// but forwarding them is up to the network manager.
+type NoopChain struct{}
+
+func (NoopChain) Forward(string, iptables.Action, net.IP, int, string, string, int) error {
+	return nil
+}
+
+func (NoopChain) ForwardExists(string, net.IP, int, string, string, int) bool {
+	return true
 }
 
 type NetHandler struct {
 	ContainerIP string
 	Chain       Chain
 
+	// RuleTag, usually the container's handle, tags the rules the Chain and
+	// Chain6 add for the container. If Rules is set, the container's port
+	// mappings are released by removing every rule tagged with it, rather
+	// than the rules each mapping should have.
+	RuleTag string
+	Rules   RuleSweeper
+
+	// ExternalIP, if set, is the host address ports are forwarded from, in
+	// place of the one found by looking at the host's interfaces.
+	ExternalIP string
+
 	PortPool *port_pool.PortPool
+
+	// Firewall, if set, is given the container's NetOut rules, keyed by
+	// FirewallID.
+	Firewall   Firewall
+	FirewallID string
+
+	// ContainerIPv6, if set, is the container's IPv6 address. Ports are
+	// forwarded to it from ExternalIPv6 (or any of the host's addresses)
+	// through Chain6, and NetOut rules are also given to Firewall6, where
+	// those are set.
+	ContainerIPv6 string
+	Chain6        Chain
+	ExternalIPv6  string
+	Firewall6     Firewall
+
+	// StatePath, if set, is where the container's port mappings are saved so
+	// that they can be recovered if garden-docker restarts.
+	StatePath string
+
+	mu       sync.Mutex
+	mappings []garden.PortMapping
+	netOut   []garden.NetOutRule
 }
 
 func (c *NetHandler) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
-	externalIP, _ := localip.LocalIP()
+	externalIP := c.externalIP()
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	acquired := false
 	if hostPort == 0 {
 		var err error
 		if hostPort, err = c.PortPool.Acquire(); err != nil {
 			return 0, 0, fmt.Errorf("netin: acquire port from pool: %s", err)
 		}
+
+		acquired = true
 	}
 
 	if containerPort == 0 {
 		containerPort = hostPort
 	}
 
-	if err := c.Chain.Forward(iptables.Add, net.ParseIP(externalIP), int(hostPort), "tcp", c.ContainerIP, int(containerPort)); err != nil {
+	if err := c.Chain.Forward(c.RuleTag, iptables.Add, externalIP, int(hostPort), "tcp", c.ContainerIP, int(containerPort)); err != nil {
+		if acquired {
+			c.PortPool.Release(hostPort)
+		}
+
 		return 0, 0, fmt.Errorf("netin %d to %d: %s", hostPort, containerPort, err)
 	}
 
-	return 0, 0, nil
+	if c.forwardsIPv6() {
+		if err := c.Chain6.Forward(c.RuleTag, iptables.Add, c.externalIPv6(), int(hostPort), "tcp", c.ContainerIPv6, int(containerPort)); err != nil {
+			c.Chain.Forward(c.RuleTag, iptables.Delete, externalIP, int(hostPort), "tcp", c.ContainerIP, int(containerPort))
+			if acquired {
+				c.PortPool.Release(hostPort)
+			}
+
+			return 0, 0, fmt.Errorf("netin %d to %d over IPv6: %s", hostPort, containerPort, err)
+		}
+	}
+
+	c.mappings = append(c.mappings, garden.PortMapping{HostPort: hostPort, ContainerPort: containerPort})
+	if err := c.save(); err != nil {
+		return 0, 0, fmt.Errorf("netin: save port mappings: %s", err)
+	}
+
+	return hostPort, containerPort, nil
+}
+
+// PortMappings returns the port mappings made by NetIn.
+func (c *NetHandler) PortMappings() []garden.PortMapping {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]garden.PortMapping{}, c.mappings...)
+}
+
+func (c *NetHandler) externalIP() net.IP {
+	if c.ExternalIP != "" {
+		return net.ParseIP(c.ExternalIP)
+	}
+
+	ip, _ := localip.LocalIP()
+	return net.ParseIP(ip)
+}
+
+func (c *NetHandler) externalIPv6() net.IP {
+	if c.ExternalIPv6 != "" {
+		return net.ParseIP(c.ExternalIPv6)
+	}
+
+	return net.IPv6unspecified
+}
+
+// forwardsIPv6 reports whether ports are forwarded to the container's IPv6
+// address as well as its IPv4 one.
+func (c *NetHandler) forwardsIPv6() bool {
+	return c.Chain6 != nil && c.ContainerIPv6 != ""
+}
+
+func (c *NetHandler) setContainerIP(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ContainerIP = ip
 }
 
+// NetOut allows the container egress matching the rule. Without a Firewall
+// all egress is already allowed, so there is nothing to do.
 func (c *NetHandler) NetOut(netOutRule garden.NetOutRule) error {
+	if c.Firewall != nil {
+		if err := c.Firewall.Allow(c.FirewallID, netOutRule); err != nil {
+			return err
+		}
+	}
+
+	if c.Firewall6 != nil && c.ContainerIPv6 != "" {
+		if err := c.Firewall6.Allow(c.FirewallID, netOutRule); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.netOut = append(c.netOut, netOutRule)
 	return nil
 }
+
+// NetOutRules returns the rules given to NetOut.
+func (c *NetHandler) NetOutRules() []garden.NetOutRule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]garden.NetOutRule{}, c.netOut...)
+}
+
+// RecoverNetOut records the NetOut rules a restored container was saved
+// with, which its Firewall rules still enforce, for MoveNetOut to give the
+// Firewall again should the container's IP change.
+func (c *NetHandler) RecoverNetOut(rules []garden.NetOutRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.netOut = rules
+}
+
+// MoveNetOut moves the container's egress rules to the IP a restart of its
+// docker container gave it, tearing down the Firewall's rules for the old IP
+// and setting them up, with the rules given to NetOut, for the new one.
+// Left alone, the Firewall would keep matching the old IP, and so neither
+// restrict the container nor be able to tear its rules down.
+func (c *NetHandler) MoveNetOut(ip string) error {
+	c.mu.Lock()
+	oldIP, rules := c.ContainerIP, append([]garden.NetOutRule{}, c.netOut...)
+	c.mu.Unlock()
+
+	if c.Firewall == nil || ip == oldIP {
+		return nil
+	}
+
+	if err := c.Firewall.Teardown(c.FirewallID, oldIP); err != nil {
+		return err
+	}
+
+	if err := c.Firewall.Setup(c.FirewallID, ip); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := c.Firewall.Allow(c.FirewallID, rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseNetOut removes the container's egress rules from the Firewall and
+// Firewall6.
+func (c *NetHandler) ReleaseNetOut() error {
+	c.mu.Lock()
+	ip, ipv6 := c.ContainerIP, c.ContainerIPv6
+	c.mu.Unlock()
+
+	if c.Firewall != nil {
+		if err := c.Firewall.Teardown(c.FirewallID, ip); err != nil {
+			return err
+		}
+	}
+
+	if c.Firewall6 != nil && ipv6 != "" {
+		return c.Firewall6.Teardown(c.FirewallID, ipv6)
+	}
+
+	return nil
+}
+
+// RestorePortMappings re-adds the forwarding rules of any port mapping made by
+// NetIn which is no longer present in the chain (for example because the
+// rules were flushed when dockerd restarted). It returns the number of rules
+// which had to be restored.
+func (c *NetHandler) RestorePortMappings() (int, error) {
+	ip := c.externalIP()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	restored := 0
+	for _, m := range c.mappings {
+		if c.Chain.ForwardExists(c.RuleTag, ip, int(m.HostPort), "tcp", c.ContainerIP, int(m.ContainerPort)) {
+			continue
+		}
+
+		if err := c.Chain.Forward(c.RuleTag, iptables.Add, ip, int(m.HostPort), "tcp", c.ContainerIP, int(m.ContainerPort)); err != nil {
+			return restored, fmt.Errorf("restore port mapping %d to %d: %s", m.HostPort, m.ContainerPort, err)
+		}
+
+		restored++
+	}
+
+	if !c.forwardsIPv6() {
+		return restored, nil
+	}
+
+	ipv6 := c.externalIPv6()
+	for _, m := range c.mappings {
+		if c.Chain6.ForwardExists(c.RuleTag, ipv6, int(m.HostPort), "tcp", c.ContainerIPv6, int(m.ContainerPort)) {
+			continue
+		}
+
+		if err := c.Chain6.Forward(c.RuleTag, iptables.Add, ipv6, int(m.HostPort), "tcp", c.ContainerIPv6, int(m.ContainerPort)); err != nil {
+			return restored, fmt.Errorf("restore port mapping %d to %d over IPv6: %s", m.HostPort, m.ContainerPort, err)
+		}
+
+		restored++
+	}
+
+	return restored, nil
+}
+
+// RecoverPortMappings loads the port mappings saved by a previous
+// garden-docker process and reserves them, as ReservePortMappings does.
+func (c *NetHandler) RecoverPortMappings() error {
+	if c.StatePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("recover port mappings: %s", err)
+	}
+
+	var mappings []garden.PortMapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return fmt.Errorf("recover port mappings: %s", err)
+	}
+
+	c.ReservePortMappings(mappings)
+	return nil
+}
+
+// ReservePortMappings records port mappings a restored container already
+// has and takes their host ports out of the pool, so that they are not
+// handed out again while the container still holds them.
+func (c *NetHandler) ReservePortMappings(mappings []garden.PortMapping) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range mappings {
+		// ports outside the pool, or already removed from it, are not ours
+		// to reserve
+		c.PortPool.Remove(m.HostPort)
+	}
+
+	c.mappings = mappings
+}
+
+// ReleasePortMappings removes the forwarding rules for the container's port
+// mappings and returns their host ports to the pool.
+func (c *NetHandler) ReleasePortMappings() error {
+	if c.Rules != nil {
+		return c.releaseTaggedRules()
+	}
+
+	ip := c.externalIP()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range c.mappings {
+		if err := c.Chain.Forward(c.RuleTag, iptables.Delete, ip, int(m.HostPort), "tcp", c.ContainerIP, int(m.ContainerPort)); err != nil {
+			return fmt.Errorf("release port mapping %d to %d: %s", m.HostPort, m.ContainerPort, err)
+		}
+
+		if c.forwardsIPv6() {
+			if err := c.Chain6.Forward(c.RuleTag, iptables.Delete, c.externalIPv6(), int(m.HostPort), "tcp", c.ContainerIPv6, int(m.ContainerPort)); err != nil {
+				return fmt.Errorf("release port mapping %d to %d over IPv6: %s", m.HostPort, m.ContainerPort, err)
+			}
+		}
+
+		c.PortPool.Release(m.HostPort)
+	}
+
+	c.mappings = nil
+	return nil
+}
+
+// releaseTaggedRules is ReleasePortMappings for containers whose rules are
+// tagged, which also catches rules left behind by port mappings which were
+// never recorded or whose external IP has since changed. Untagged rules,
+// added before rules were tagged, are deleted mapping by mapping.
+func (c *NetHandler) releaseTaggedRules() error {
+	ip := c.externalIP()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Rules.Remove(c.RuleTag); err != nil {
+		return fmt.Errorf("release port mappings: %s", err)
+	}
+
+	for _, m := range c.mappings {
+		if c.Chain.ForwardExists("", ip, int(m.HostPort), "tcp", c.ContainerIP, int(m.ContainerPort)) {
+			if err := c.Chain.Forward("", iptables.Delete, ip, int(m.HostPort), "tcp", c.ContainerIP, int(m.ContainerPort)); err != nil {
+				return fmt.Errorf("release port mapping %d to %d: %s", m.HostPort, m.ContainerPort, err)
+			}
+		}
+
+		c.PortPool.Release(m.HostPort)
+	}
+
+	c.mappings = nil
+	return nil
+}
+
+func (c *NetHandler) save() error {
+	if c.StatePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.mappings)
+	if err != nil {
+		return err
+	}
+
+	return writeStateFile(c.StatePath, data)
+}
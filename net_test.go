@@ -1,7 +1,15 @@
 package gardendocker_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
+	"github.com/docker/docker/pkg/iptables"
 	. "github.com/julz/garden-docker"
 	"github.com/julz/garden-docker/fakes"
 
@@ -27,14 +35,46 @@ var _ = Describe("Net", func() {
 			Expect(fakeChain.ForwardCallCount()).Should(Equal(1))
 		})
 
+		It("tags the forwarding rules with the container's handle", func() {
+			container.RuleTag = "some-handle"
+			container.NetIn(123, 456)
+
+			handle, _, _, _, _, _, _ := fakeChain.ForwardArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+		})
+
+		It("returns the mapped ports", func() {
+			hostPort, containerPort, err := container.NetIn(123, 456)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostPort).To(Equal(uint32(123)))
+			Expect(containerPort).To(Equal(uint32(456)))
+		})
+
+		Context("with an external IP", func() {
+			It("forwards ports from it", func() {
+				container.ExternalIP = "10.0.0.1"
+				container.NetIn(123, 456)
+
+				_, _, ip, _, _, _, _ := fakeChain.ForwardArgsForCall(0)
+				Expect(ip.String()).To(Equal("10.0.0.1"))
+			})
+		})
+
 		Context("when the host port is 0", func() {
+			It("returns the port it acquired from the pool", func() {
+				hostPort, containerPort, err := container.NetIn(0, 456)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hostPort).To(Equal(uint32(10)))
+				Expect(containerPort).To(Equal(uint32(456)))
+			})
+
 			It("selects a unique host port", func() {
 				container.NetIn(0, 456)
 				container.NetIn(0, 456)
 				Expect(fakeChain.ForwardCallCount()).Should(Equal(2))
 
-				_, _, hostPort1, _, _, _ := fakeChain.ForwardArgsForCall(0)
-				_, _, hostPort2, _, _, _ := fakeChain.ForwardArgsForCall(1)
+				_, _, _, hostPort1, _, _, _ := fakeChain.ForwardArgsForCall(0)
+				_, _, _, hostPort2, _, _, _ := fakeChain.ForwardArgsForCall(1)
 				Expect(hostPort1).NotTo(Equal(hostPort2))
 			})
 
@@ -43,7 +83,7 @@ var _ = Describe("Net", func() {
 					container.NetIn(0, 0)
 					Expect(fakeChain.ForwardCallCount()).Should(Equal(1))
 
-					_, _, hostPort, _, _, containerPort := fakeChain.ForwardArgsForCall(0)
+					_, _, _, hostPort, _, _, containerPort := fakeChain.ForwardArgsForCall(0)
 					Expect(hostPort).To(Equal(containerPort))
 				})
 			})
@@ -53,7 +93,7 @@ var _ = Describe("Net", func() {
 			It("is used", func() {
 				container.NetIn(123, 456)
 				Expect(fakeChain.ForwardCallCount()).Should(Equal(1))
-				_, _, hostPort1, _, _, _ := fakeChain.ForwardArgsForCall(0)
+				_, _, _, hostPort1, _, _, _ := fakeChain.ForwardArgsForCall(0)
 				Expect(hostPort1).To(Equal(123))
 			})
 		})
@@ -69,5 +109,366 @@ var _ = Describe("Net", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		Context("when forwarding an auto-allocated port fails", func() {
+			It("returns the port to the pool", func() {
+				fakeChain.ForwardReturns(errors.New("iptables says no"))
+				for i := 0; i < 3; i++ {
+					_, _, err := container.NetIn(0, 456)
+					Expect(err).To(MatchError(ContainSubstring("iptables says no")))
+				}
+
+				fakeChain.ForwardReturns(nil)
+				_, _, err := container.NetIn(0, 456)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		It("records the mappings", func() {
+			container.NetIn(123, 456)
+			container.NetIn(0, 789)
+
+			Expect(container.PortMappings()).To(Equal([]garden.PortMapping{
+				{HostPort: 123, ContainerPort: 456},
+				{HostPort: 10, ContainerPort: 789},
+			}))
+		})
+
+		It("reports the mappings in the container's info", func() {
+			container.NetIn(123, 456)
+
+			info, err := (&Container{
+				InfoHandler: &InfoHandler{PropsHandler: NewPropsHandler(nil)},
+				NetHandler:  container,
+			}).Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.MappedPorts).To(Equal([]garden.PortMapping{{HostPort: 123, ContainerPort: 456}}))
+		})
+
+		It("reports the external IP and container IP in the container's info", func() {
+			container.ExternalIP = "10.0.0.1"
+			container.NetIn(123, 456)
+
+			info, err := (&Container{
+				InfoHandler: &InfoHandler{ContainerIP: "172.17.0.2", PropsHandler: NewPropsHandler(nil)},
+				NetHandler:  container,
+			}).Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ExternalIP).To(Equal("10.0.0.1"))
+			Expect(info.ContainerIP).To(Equal("172.17.0.2"))
+		})
+	})
+
+	Context("with a state path", func() {
+		var stateDir string
+
+		BeforeEach(func() {
+			var err error
+			stateDir, err = ioutil.TempDir("", "net")
+			Expect(err).NotTo(HaveOccurred())
+
+			container.StatePath = filepath.Join(stateDir, "net.json")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(stateDir)
+		})
+
+		It("saves the port mappings so a new handler can recover them", func() {
+			_, _, err := container.NetIn(0, 456)
+			Expect(err).NotTo(HaveOccurred())
+
+			pool := port_pool.New(10, 3)
+			recovered := &NetHandler{
+				Chain:     fakeChain,
+				PortPool:  pool,
+				StatePath: container.StatePath,
+			}
+			Expect(recovered.RecoverPortMappings()).To(Succeed())
+
+			By("not handing out the recovered host port again")
+			port, err := pool.Acquire()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(port).To(Equal(uint32(11)))
+
+			By("restoring the recovered mappings")
+			fakeChain.ForwardExistsReturns(false)
+			restored, err := recovered.RestorePortMappings()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(1))
+		})
+
+		Context("when nothing has been saved", func() {
+			It("recovers nothing", func() {
+				Expect(container.RecoverPortMappings()).To(Succeed())
+
+				restored, err := container.RestorePortMappings()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(restored).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("ReleasePortMappings", func() {
+		It("deletes the forwarding rules and returns the host ports to the pool", func() {
+			for i := 0; i < 3; i++ {
+				_, _, err := container.NetIn(0, 456)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(container.ReleasePortMappings()).To(Succeed())
+
+			Expect(fakeChain.ForwardCallCount()).To(Equal(6))
+			_, action, _, _, _, _, _ := fakeChain.ForwardArgsForCall(5)
+			Expect(action).To(Equal(iptables.Delete))
+
+			_, _, err := container.NetIn(0, 456)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("with Rules", func() {
+			var rules *fakes.FakeRuleSweeper
+
+			BeforeEach(func() {
+				rules = new(fakes.FakeRuleSweeper)
+				container.RuleTag = "some-handle"
+				container.Rules = rules
+			})
+
+			It("removes every rule tagged with the handle instead, and returns the host ports to the pool", func() {
+				for i := 0; i < 3; i++ {
+					_, _, err := container.NetIn(0, 456)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				Expect(container.ReleasePortMappings()).To(Succeed())
+
+				Expect(fakeChain.ForwardCallCount()).To(Equal(3))
+				Expect(rules.RemoveCallCount()).To(Equal(1))
+				Expect(rules.RemoveArgsForCall(0)).To(Equal("some-handle"))
+				Expect(container.PortMappings()).To(BeEmpty())
+
+				_, _, err := container.NetIn(0, 456)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("deletes untagged rules mapping by mapping", func() {
+				container.NetIn(123, 456)
+				fakeChain.ForwardExistsStub = func(handle string, _ net.IP, _ int, _, _ string, _ int) bool {
+					return handle == ""
+				}
+
+				Expect(container.ReleasePortMappings()).To(Succeed())
+
+				Expect(fakeChain.ForwardCallCount()).To(Equal(2))
+				handle, action, _, hostPort, _, _, _ := fakeChain.ForwardArgsForCall(1)
+				Expect(handle).To(BeEmpty())
+				Expect(action).To(Equal(iptables.Delete))
+				Expect(hostPort).To(Equal(123))
+			})
+
+			It("keeps the mappings if the rules cannot be removed", func() {
+				container.NetIn(123, 456)
+				rules.RemoveReturns(errors.New("iptables says no"))
+
+				Expect(container.ReleasePortMappings()).To(MatchError(ContainSubstring("iptables says no")))
+				Expect(container.PortMappings()).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("RestorePortMappings", func() {
+		BeforeEach(func() {
+			container.NetIn(123, 456)
+			container.NetIn(789, 1011)
+		})
+
+		It("re-adds mappings whose rules are missing", func() {
+			fakeChain.ForwardExistsStub = func(_ string, _ net.IP, port int, _, _ string, _ int) bool {
+				return port == 123
+			}
+
+			restored, err := container.RestorePortMappings()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(1))
+
+			Expect(fakeChain.ForwardCallCount()).To(Equal(3))
+			_, _, _, hostPort, _, _, containerPort := fakeChain.ForwardArgsForCall(2)
+			Expect(hostPort).To(Equal(789))
+			Expect(containerPort).To(Equal(1011))
+		})
+
+		It("does nothing when all the rules exist", func() {
+			fakeChain.ForwardExistsReturns(true)
+
+			restored, err := container.RestorePortMappings()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(0))
+			Expect(fakeChain.ForwardCallCount()).To(Equal(2))
+		})
+
+		Context("when re-adding a rule fails", func() {
+			It("returns an error", func() {
+				fakeChain.ForwardReturns(errors.New("boom"))
+
+				_, err := container.RestorePortMappings()
+				Expect(err).To(MatchError(ContainSubstring("boom")))
+			})
+		})
+	})
+
+	Describe("MoveNetOut", func() {
+		var egress, lateral *fakes.FakeFirewall
+		var rule garden.NetOutRule
+
+		BeforeEach(func() {
+			egress = new(fakes.FakeFirewall)
+			lateral = new(fakes.FakeFirewall)
+			container.ContainerIP = "10.254.0.2"
+			container.Firewall = Firewalls{egress, lateral}
+			container.FirewallID = "some-docker-id"
+
+			rule = garden.NetOutRule{Protocol: garden.ProtocolTCP}
+			Expect(container.NetOut(rule)).To(Succeed())
+		})
+
+		It("re-keys the jumps to the egress and inter-container chains to the new IP", func() {
+			Expect(container.MoveNetOut("10.254.0.3")).To(Succeed())
+
+			for _, firewall := range []*fakes.FakeFirewall{egress, lateral} {
+				Expect(firewall.TeardownCallCount()).To(Equal(1))
+				id, ip := firewall.TeardownArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("10.254.0.2"))
+
+				Expect(firewall.SetupCallCount()).To(Equal(1))
+				id, ip = firewall.SetupArgsForCall(0)
+				Expect(id).To(Equal("some-docker-id"))
+				Expect(ip).To(Equal("10.254.0.3"))
+
+				Expect(firewall.AllowCallCount()).To(Equal(2))
+				_, allowed := firewall.AllowArgsForCall(1)
+				Expect(allowed).To(Equal(rule))
+			}
+		})
+
+		It("does nothing when the IP is unchanged", func() {
+			Expect(container.MoveNetOut("10.254.0.2")).To(Succeed())
+			Expect(egress.TeardownCallCount()).To(Equal(0))
+			Expect(lateral.TeardownCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("with an IPv6 address and chain", func() {
+		var fakeChain6 *fakes.FakeChain
+		var fakeFirewall, fakeFirewall6 *fakes.FakeFirewall
+
+		BeforeEach(func() {
+			fakeChain6 = new(fakes.FakeChain)
+			fakeFirewall = new(fakes.FakeFirewall)
+			fakeFirewall6 = new(fakes.FakeFirewall)
+
+			container.ContainerIP = "10.254.0.2"
+			container.ContainerIPv6 = "fd00::2"
+			container.Chain6 = fakeChain6
+			container.Firewall = fakeFirewall
+			container.Firewall6 = fakeFirewall6
+			container.FirewallID = "some-docker-id"
+		})
+
+		It("forwards ports to the IPv6 address from any host address", func() {
+			_, _, err := container.NetIn(123, 456)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeChain6.ForwardCallCount()).To(Equal(1))
+			_, action, ip, hostPort, _, containerIP, containerPort := fakeChain6.ForwardArgsForCall(0)
+			Expect(action).To(Equal(iptables.Add))
+			Expect(ip.IsUnspecified()).To(BeTrue())
+			Expect(hostPort).To(Equal(123))
+			Expect(containerIP).To(Equal("fd00::2"))
+			Expect(containerPort).To(Equal(456))
+		})
+
+		It("forwards ports from the external IPv6 address, if set", func() {
+			container.ExternalIPv6 = "2001:db8::1"
+			container.NetIn(123, 456)
+
+			_, _, ip, _, _, _, _ := fakeChain6.ForwardArgsForCall(0)
+			Expect(ip.String()).To(Equal("2001:db8::1"))
+		})
+
+		Context("when forwarding over IPv6 fails", func() {
+			BeforeEach(func() {
+				fakeChain6.ForwardReturns(errors.New("boom"))
+			})
+
+			It("removes the IPv4 forward and returns the port to the pool", func() {
+				_, _, err := container.NetIn(0, 456)
+				Expect(err).To(MatchError(ContainSubstring("boom")))
+
+				Expect(fakeChain.ForwardCallCount()).To(Equal(2))
+				_, action, _, _, _, _, _ := fakeChain.ForwardArgsForCall(1)
+				Expect(action).To(Equal(iptables.Delete))
+				Expect(container.PortMappings()).To(BeEmpty())
+
+				// the pool only has 3 ports
+				fakeChain6.ForwardReturns(nil)
+				for i := 0; i < 3; i++ {
+					_, _, err := container.NetIn(0, 456)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+		})
+
+		It("restores and releases the IPv6 forwards too", func() {
+			container.NetIn(123, 456)
+
+			restored, err := container.RestorePortMappings()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(2))
+			Expect(fakeChain6.ForwardCallCount()).To(Equal(2))
+
+			Expect(container.ReleasePortMappings()).To(Succeed())
+			Expect(fakeChain6.ForwardCallCount()).To(Equal(3))
+			_, action, _, _, _, _, _ := fakeChain6.ForwardArgsForCall(2)
+			Expect(action).To(Equal(iptables.Delete))
+		})
+
+		It("gives NetOut rules to both firewalls and tears both down", func() {
+			rule := garden.NetOutRule{Protocol: garden.ProtocolTCP}
+			Expect(container.NetOut(rule)).To(Succeed())
+			Expect(fakeFirewall.AllowCallCount()).To(Equal(1))
+			Expect(fakeFirewall6.AllowCallCount()).To(Equal(1))
+
+			Expect(container.ReleaseNetOut()).To(Succeed())
+			_, ip := fakeFirewall.TeardownArgsForCall(0)
+			Expect(ip).To(Equal("10.254.0.2"))
+			_, ip = fakeFirewall6.TeardownArgsForCall(0)
+			Expect(ip).To(Equal("fd00::2"))
+		})
+	})
+
+	Context("with a NoopChain", func() {
+		BeforeEach(func() {
+			container.Chain = NoopChain{}
+		})
+
+		It("still hands out host ports and records the mappings", func() {
+			hostPort, containerPort, err := container.NetIn(0, 8080)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostPort).To(Equal(uint32(10)))
+			Expect(containerPort).To(Equal(uint32(8080)))
+
+			Expect(container.RestorePortMappings()).To(Equal(0))
+		})
+
+		It("returns the host ports to the pool on release", func() {
+			container.NetIn(0, 8080)
+			Expect(container.ReleasePortMappings()).To(Succeed())
+
+			hostPort, _, err := container.NetIn(0, 8080)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostPort).To(Equal(uint32(11)))
+		})
 	})
 })
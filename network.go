@@ -0,0 +1,113 @@
+package gardendocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+//go:generate counterfeiter . Networker
+type Networker interface {
+	// Chain forwards the host ports handed out by NetIn to containers.
+	Chain
+
+	// Up connects a container to the network once its docker container is
+	// running, returning the IP address it should be reached at, or "" to
+	// keep the one docker gave it.
+	Up(container NetworkContainer) (string, error)
+
+	// Down disconnects a container before its docker container is removed.
+	Down(container NetworkContainer) error
+}
+
+// NetworkContainer is what a Networker is told about a container it is
+// connecting or disconnecting.
+type NetworkContainer struct {
+	Handle   string `json:"handle"`
+	DockerID string `json:"docker_id"`
+
+	// Pid is the host pid of the container's init process, whose network
+	// namespace is /proc/<pid>/ns/net, and IP the address docker gave it, if
+	// any. Neither is given when disconnecting.
+	Pid int    `json:"pid,omitempty"`
+	IP  string `json:"ip,omitempty"`
+}
+
+// ChainNetworker leaves connecting containers to docker's bridge network,
+// and only forwards ports through its Chain.
+type ChainNetworker struct {
+	Chain
+}
+
+func (ChainNetworker) Up(NetworkContainer) (string, error) {
+	return "", nil
+}
+
+func (ChainNetworker) Down(NetworkContainer) error {
+	return nil
+}
+
+// PluginNetworker hands connecting and disconnecting containers to an
+// external network plugin, in the style of CNI, so that operators can
+// integrate an SDN without changing garden-docker. The plugin is run as
+//
+//	<Path> up|down
+//
+// with the NetworkContainer as JSON on stdin. When bringing a container up,
+// it may print a JSON object with an "ip" field to say where the container
+// is reached. Ports are still forwarded through Chain.
+type PluginNetworker struct {
+	Chain
+
+	Path          string
+	CommandRunner command_runner.CommandRunner
+}
+
+func (p *PluginNetworker) Up(container NetworkContainer) (string, error) {
+	out, err := p.run("up", container)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bytes.TrimSpace(out)) == 0 {
+		return "", nil
+	}
+
+	var result struct {
+		IP string `json:"ip"`
+	}
+
+	if err := json.Unmarshal(out, &result); err != nil {
+		return "", fmt.Errorf("network plugin up: invalid output: %s", err)
+	}
+
+	return result.IP, nil
+}
+
+func (p *PluginNetworker) Down(container NetworkContainer) error {
+	_, err := p.run("down", container)
+	return err
+}
+
+func (p *PluginNetworker) run(command string, container NetworkContainer) ([]byte, error) {
+	input, err := json.Marshal(container)
+	if err != nil {
+		return nil, fmt.Errorf("network plugin %s: %s", command, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(p.Path, command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := p.CommandRunner.Run(cmd); err != nil {
+		return nil, fmt.Errorf("network plugin %s: %s: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PluginNetworker", func() {
+	var commandRunner *fake_command_runner.FakeCommandRunner
+	var networker *PluginNetworker
+	var container NetworkContainer
+
+	BeforeEach(func() {
+		commandRunner = fake_command_runner.New()
+		networker = &PluginNetworker{
+			Chain:         new(fakes.FakeChain),
+			Path:          "/path/to/plugin",
+			CommandRunner: commandRunner,
+		}
+
+		container = NetworkContainer{
+			Handle:   "some-handle",
+			DockerID: "some-docker-id",
+			Pid:      1234,
+			IP:       "1.2.3.4",
+		}
+	})
+
+	Describe("Up", func() {
+		It("runs the plugin with the container as JSON on stdin", func() {
+			var stdin []byte
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/plugin"}, func(cmd *exec.Cmd) error {
+				var err error
+				stdin, err = ioutil.ReadAll(cmd.Stdin)
+				return err
+			})
+
+			ip, err := networker.Up(container)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ip).To(BeEmpty())
+
+			Expect(commandRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "/path/to/plugin",
+				Args: []string{"up"},
+			}))
+			Expect(stdin).To(MatchJSON(`{"handle":"some-handle","docker_id":"some-docker-id","pid":1234,"ip":"1.2.3.4"}`))
+		})
+
+		It("returns the IP the plugin prints", func() {
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/plugin"}, func(cmd *exec.Cmd) error {
+				_, err := cmd.Stdout.Write([]byte(`{"ip":"10.0.0.5"}`))
+				return err
+			})
+
+			Expect(networker.Up(container)).To(Equal("10.0.0.5"))
+		})
+
+		Context("when the plugin prints something other than JSON", func() {
+			It("returns an error", func() {
+				commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/plugin"}, func(cmd *exec.Cmd) error {
+					_, err := cmd.Stdout.Write([]byte("connected!"))
+					return err
+				})
+
+				_, err := networker.Up(container)
+				Expect(err).To(MatchError(ContainSubstring("network plugin up: invalid output")))
+			})
+		})
+
+		Context("when the plugin fails", func() {
+			It("returns an error with what it wrote to stderr", func() {
+				commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/plugin"}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("no addresses left\n"))
+					return errors.New("exit status 1")
+				})
+
+				_, err := networker.Up(container)
+				Expect(err).To(MatchError("network plugin up: exit status 1: no addresses left"))
+			})
+		})
+	})
+
+	Describe("Down", func() {
+		It("runs the plugin with the container as JSON on stdin", func() {
+			var stdin []byte
+			commandRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/plugin"}, func(cmd *exec.Cmd) error {
+				var err error
+				stdin, err = ioutil.ReadAll(cmd.Stdin)
+				return err
+			})
+
+			Expect(networker.Down(NetworkContainer{Handle: "some-handle", DockerID: "some-docker-id"})).To(Succeed())
+
+			Expect(commandRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "/path/to/plugin",
+				Args: []string{"down"},
+			}))
+			Expect(stdin).To(MatchJSON(`{"handle":"some-handle","docker_id":"some-docker-id"}`))
+		})
+	})
+})
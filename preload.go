@@ -0,0 +1,45 @@
+package gardendocker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . ImagePuller
+type ImagePuller interface {
+	// PullImage pulls the image of a rootfs URI.
+	PullImage(rootfsPath string) error
+}
+
+// preloadImages pulls every one of the PreloadImages at once, so that the
+// first containers created from them do not wait for the pull. A failure is
+// logged and leaves the image to be pulled by the first Create which needs
+// it.
+func (b *Backend) preloadImages() {
+	log := b.Logger.Session("preload-images", lager.Data{"images": b.PreloadImages})
+	log.Info("started")
+
+	var wg sync.WaitGroup
+	for _, image := range b.PreloadImages {
+		wg.Add(1)
+
+		go func(image string) {
+			defer wg.Done()
+
+			started := time.Now()
+			log.Info("pulling", lager.Data{"image": image})
+
+			if err := b.Puller.PullImage(image); err != nil {
+				log.Error("pull-failed", err, lager.Data{"image": image})
+				return
+			}
+
+			log.Info("pulled", lager.Data{"image": image, "took": time.Since(started).String()})
+		}(image)
+	}
+
+	wg.Wait()
+	log.Info("finished")
+}
@@ -0,0 +1,96 @@
+package gardendocker_test
+
+import (
+	"errors"
+
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Preloading images", func() {
+	var backend *gardendocker.Backend
+	var puller *fakes.FakeImagePuller
+	var logger *lagertest.TestLogger
+
+	BeforeEach(func() {
+		puller = new(fakes.FakeImagePuller)
+		logger = lagertest.NewTestLogger("backend")
+
+		backend = &gardendocker.Backend{
+			Repo:          gardendocker.NewRepo(),
+			PreloadImages: []string{"docker:///busybox", "docker:///ubuntu"},
+			Puller:        puller,
+			Logger:        logger,
+		}
+	})
+
+	AfterEach(func() {
+		backend.Stop()
+	})
+
+	pulled := func() []string {
+		var images []string
+		for i := 0; i < puller.PullImageCallCount(); i++ {
+			images = append(images, puller.PullImageArgsForCall(i))
+		}
+
+		return images
+	}
+
+	It("pulls every image in the background when the backend starts", func() {
+		block := make(chan struct{})
+		defer close(block)
+		puller.PullImageStub = func(string) error {
+			<-block
+			return nil
+		}
+
+		Expect(backend.Start()).To(Succeed())
+		Eventually(pulled).Should(ConsistOf("docker:///busybox", "docker:///ubuntu"))
+	})
+
+	It("logs when it has finished", func() {
+		Expect(backend.Start()).To(Succeed())
+		Eventually(logger.LogMessages).Should(ContainElement("backend.preload-images.finished"))
+	})
+
+	Context("when an image cannot be pulled", func() {
+		It("logs the failure and pulls the rest", func() {
+			puller.PullImageStub = func(image string) error {
+				if image == "docker:///busybox" {
+					return errors.New("manifest unknown")
+				}
+
+				return nil
+			}
+
+			Expect(backend.Start()).To(Succeed())
+			Eventually(logger.LogMessages).Should(ContainElement("backend.preload-images.finished"))
+
+			Expect(pulled()).To(ConsistOf("docker:///busybox", "docker:///ubuntu"))
+
+			var failures []lager.LogFormat
+			for _, log := range logger.Logs() {
+				if log.Message == "backend.preload-images.pull-failed" {
+					failures = append(failures, log)
+				}
+			}
+
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0].LogLevel).To(Equal(lager.ERROR))
+			Expect(failures[0].Data).To(HaveKeyWithValue("image", "docker:///busybox"))
+		})
+	})
+
+	Context("when there are no images to preload", func() {
+		It("pulls nothing", func() {
+			backend.PreloadImages = nil
+			Expect(backend.Start()).To(Succeed())
+			Consistently(puller.PullImageCallCount).Should(Equal(0))
+		})
+	})
+})
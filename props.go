@@ -1,56 +1,317 @@
 package gardendocker
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden"
 )
 
+// GraceTimeExemptProperty is a reserved property which, when set to "true",
+// stops a container from ever being reaped for being idle.
+const GraceTimeExemptProperty = "garden.grace-time-exempt"
+
+// GraceTimeProperty holds the grace time of a container created with one, as
+// a duration such as "5m", so that it survives a restart of garden-docker.
+// Clients may set it to change when the container is reaped, "0s" meaning
+// never.
+const GraceTimeProperty = "garden-docker.grace-time"
+
+// PropertyLabelPrefix prefixes the docker labels a container's properties
+// are written to when it is created, so that docker-native tooling can see
+// them. Docker labels cannot change once a container exists, so properties
+// set later are not reflected.
+const PropertyLabelPrefix = "garden-docker.property."
+
+// LabelPropertyPrefix prefixes the read-only properties imported from a
+// container's docker labels (including those it inherits from its image).
+const LabelPropertyPrefix = "docker.label."
+
 type PropsHandler struct {
-	mu    sync.RWMutex
-	props map[string]string
+	// StatePath, if set, is where the container's properties are saved
+	// whenever they change, so that they can be recovered if garden-docker
+	// restarts.
+	StatePath string
+
+	mu      sync.RWMutex
+	props   map[string]string
+	labels  map[string]string
+	changed func()
+}
+
+func NewPropsHandler(props garden.Properties) *PropsHandler {
+	p := &PropsHandler{props: make(map[string]string)}
+	for k, v := range props {
+		p.props[k] = v
+	}
+
+	return p
 }
 
 func (c *PropsHandler) GetProperties() (garden.Properties, error) {
 	return c.properties(), nil
 }
 
+// ImportLabels exposes a docker container's labels as read-only properties
+// named with the LabelPropertyPrefix. garden-docker's own labels are skipped,
+// since they only mirror the container's handle and properties.
+func (c *PropsHandler) ImportLabels(labels map[string]string) {
+	defer c.notify()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.labels = make(map[string]string)
+	for k, v := range labels {
+		if !strings.HasPrefix(k, "garden-docker.") {
+			c.labels[LabelPropertyPrefix+k] = v
+		}
+	}
+}
+
 func (c *PropsHandler) properties() garden.Properties {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	return c.props
+	props := make(garden.Properties, len(c.props)+len(c.labels))
+	for k, v := range c.props {
+		props[k] = v
+	}
+
+	for k, v := range c.labels {
+		props[k] = v
+	}
+
+	return props
+}
+
+// ownProperties returns the container's properties without those imported
+// from its labels.
+func (c *PropsHandler) ownProperties() garden.Properties {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	props := make(garden.Properties, len(c.props))
+	for k, v := range c.props {
+		props[k] = v
+	}
+
+	return props
 }
 
 func (c *PropsHandler) GetProperty(name string) (string, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	if v, ok := c.labels[name]; ok {
+		return v, nil
+	}
+
 	return c.props[name], nil
 }
 
 func (c *PropsHandler) SetProperty(name string, value string) error {
+	if err := readOnly(name); err != nil {
+		return err
+	}
+
+	defer c.notify()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	old, existed := c.props[name]
 	c.props[name] = value
+
+	if err := c.save(); err != nil {
+		c.restore(name, old, existed)
+		return fmt.Errorf("set property %s: %s", name, err)
+	}
+
 	return nil
 }
 
 func (c *PropsHandler) RemoveProperty(name string) error {
+	if err := readOnly(name); err != nil {
+		return err
+	}
+
+	defer c.notify()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	old, existed := c.props[name]
 	delete(c.props, name)
+
+	if err := c.save(); err != nil {
+		c.restore(name, old, existed)
+		return fmt.Errorf("remove property %s: %s", name, err)
+	}
+
 	return nil
 }
 
+// SaveProperties saves the container's properties to its StatePath.
+func (c *PropsHandler) SaveProperties() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.save()
+}
+
+// RecoverProperties replaces the container's properties with those saved by
+// a previous garden-docker process, if there are any. Imported labels are
+// not saved, and are left as they are.
+func (c *PropsHandler) RecoverProperties() error {
+	if c.StatePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("recover properties: %s", err)
+	}
+
+	props := make(map[string]string)
+	if err := json.Unmarshal(data, &props); err != nil {
+		return fmt.Errorf("recover properties: %s", err)
+	}
+
+	defer c.notify()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.props = props
+	return nil
+}
+
+// onChange sets a function to be called, without the handler's lock held,
+// after the properties may have changed. It is how the repo keeps its
+// property index up to date.
+func (c *PropsHandler) onChange(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.changed = fn
+}
+
+func (c *PropsHandler) notify() {
+	c.mu.RLock()
+	changed := c.changed
+	c.mu.RUnlock()
+
+	if changed != nil {
+		changed()
+	}
+}
+
+func (c *PropsHandler) save() error {
+	if c.StatePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.props)
+	if err != nil {
+		return err
+	}
+
+	return writeStateFile(c.StatePath, data)
+}
+
+func (c *PropsHandler) restore(name, value string, existed bool) {
+	if existed {
+		c.props[name] = value
+	} else {
+		delete(c.props, name)
+	}
+}
+
 func (c *PropsHandler) HasProperties(props garden.Properties) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	for k, v := range props {
-		if prop, ok := c.props[k]; !ok || prop != v {
+		prop, ok := c.labels[k]
+		if !ok {
+			prop, ok = c.props[k]
+		}
+
+		if !ok || prop != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *PropsHandler) GraceTimeExempt() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.props[GraceTimeExemptProperty] == "true"
+}
+
+// Adopted reports whether the container was adopted from docker rather than
+// created by garden-docker.
+func (c *PropsHandler) Adopted() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.props[AdoptedProperty] == "true"
+}
+
+func readOnly(name string) error {
+	if strings.HasPrefix(name, LabelPropertyPrefix) {
+		return fmt.Errorf("property %s is read-only: it is imported from a docker label", name)
+	}
+
+	if name == ContainerIPv6Property {
+		return fmt.Errorf("property %s is read-only: it is the container's IPv6 address", name)
+	}
+
+	return nil
+}
+
+// propertyLabels returns the labels for those properties whose names are
+// valid docker label keys: lowercase letters, digits, dots and dashes,
+// starting and ending with a letter or digit, with no repeated dots or
+// dashes. Imported label properties are not written back.
+func propertyLabels(props garden.Properties) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range props {
+		if strings.HasPrefix(k, LabelPropertyPrefix) || !validLabelKey(k) {
+			continue
+		}
+
+		labels[PropertyLabelPrefix+k] = v
+	}
+
+	return labels
+}
+
+func validLabelKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '.' || r == '-':
+			if i == 0 || i == len(key)-1 || strings.ContainsRune(".-", rune(key[i-1])) {
+				return false
+			}
+		default:
 			return false
 		}
 	}
@@ -0,0 +1,108 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Props", func() {
+	var props *PropsHandler
+
+	BeforeEach(func() {
+		props = NewPropsHandler(garden.Properties{"foo": "bar"})
+	})
+
+	It("starts with the given properties", func() {
+		Expect(props.GetProperty("foo")).To(Equal("bar"))
+	})
+
+	It("can set and remove properties", func() {
+		Expect(props.SetProperty("baz", "qux")).To(Succeed())
+		Expect(props.GetProperty("baz")).To(Equal("qux"))
+
+		Expect(props.RemoveProperty("baz")).To(Succeed())
+		Expect(props.HasProperties(garden.Properties{"baz": "qux"})).To(BeFalse())
+	})
+
+	Describe("persistence", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "props")
+			Expect(err).NotTo(HaveOccurred())
+
+			props.StatePath = filepath.Join(dir, "props.json")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("saves changes so that they can be recovered", func() {
+			Expect(props.SetProperty("baz", "qux")).To(Succeed())
+			Expect(props.RemoveProperty("foo")).To(Succeed())
+
+			recovered := NewPropsHandler(nil)
+			recovered.StatePath = props.StatePath
+			Expect(recovered.RecoverProperties()).To(Succeed())
+			Expect(recovered.GetProperties()).To(Equal(garden.Properties{"baz": "qux"}))
+		})
+
+		It("recovers nothing if nothing was saved", func() {
+			Expect(props.RecoverProperties()).To(Succeed())
+			Expect(props.GetProperties()).To(Equal(garden.Properties{"foo": "bar"}))
+		})
+
+		Context("when the properties cannot be saved", func() {
+			BeforeEach(func() {
+				props.StatePath = filepath.Join(dir, "missing", "props.json")
+			})
+
+			It("fails and leaves the properties as they were", func() {
+				Expect(props.SetProperty("foo", "changed")).NotTo(Succeed())
+				Expect(props.RemoveProperty("foo")).NotTo(Succeed())
+				Expect(props.GetProperty("foo")).To(Equal("bar"))
+			})
+		})
+	})
+
+	Describe("imported docker labels", func() {
+		BeforeEach(func() {
+			props.ImportLabels(map[string]string{"maintainer": "someone", HandleLabel: "some-handle"})
+		})
+
+		It("exposes them as properties", func() {
+			Expect(props.GetProperty(LabelPropertyPrefix + "maintainer")).To(Equal("someone"))
+			Expect(props.GetProperties()).To(Equal(garden.Properties{
+				"foo":                              "bar",
+				LabelPropertyPrefix + "maintainer": "someone",
+			}))
+			Expect(props.HasProperties(garden.Properties{"foo": "bar", LabelPropertyPrefix + "maintainer": "someone"})).To(BeTrue())
+		})
+
+		It("does not let them be set or removed", func() {
+			Expect(props.SetProperty(LabelPropertyPrefix+"maintainer", "other")).NotTo(Succeed())
+			Expect(props.RemoveProperty(LabelPropertyPrefix + "maintainer")).NotTo(Succeed())
+			Expect(props.GetProperty(LabelPropertyPrefix + "maintainer")).To(Equal("someone"))
+		})
+	})
+
+	Describe("GraceTimeExempt", func() {
+		It("is false by default", func() {
+			Expect(props.GraceTimeExempt()).To(BeFalse())
+		})
+
+		It("is true when the grace-time-exempt property is true", func() {
+			props.SetProperty(GraceTimeExemptProperty, "true")
+			Expect(props.GraceTimeExempt()).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+//go:generate counterfeiter . DiskQuota
+type DiskQuota interface {
+	// Limit caps the data the container itself writes at bytes, or lifts
+	// the cap if bytes is zero.
+	Limit(bytes uint64) error
+}
+
+// XFSQuota enforces a container's disk limit with an XFS project quota on its
+// writable layer, and on its depot directory if that is on the same
+// filesystem. The filesystem must be mounted with the pquota option.
+type XFSQuota struct {
+	DockerRunner  DockerRunner
+	CommandRunner command_runner.CommandRunner
+
+	DockerID string
+	DepotDir string
+}
+
+func (q *XFSQuota) Limit(bytes uint64) error {
+	info, err := q.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: q.DockerID})
+	if err != nil {
+		return err
+	}
+
+	upperDir := info.GraphDriver.Data["UpperDir"]
+	if upperDir == "" {
+		return fmt.Errorf("the %s graph driver has no writable layer directory to apply a quota to", info.GraphDriver.Name)
+	}
+
+	mount, err := mountPoint(upperDir)
+	if err != nil {
+		return err
+	}
+
+	project := strconv.FormatUint(uint64(quotaProject(q.DockerID)), 10)
+
+	dirs := []string{upperDir}
+	if q.DepotDir != "" && sameFilesystem(q.DepotDir, upperDir) {
+		dirs = append(dirs, q.DepotDir)
+	}
+
+	for _, dir := range dirs {
+		if err := q.xfsQuota(mount, "project -s -p "+dir+" "+project); err != nil {
+			return err
+		}
+	}
+
+	return q.xfsQuota(mount, "limit -p bhard="+strconv.FormatUint(bytes, 10)+" "+project)
+}
+
+func (q *XFSQuota) xfsQuota(mount, command string) error {
+	var out bytes.Buffer
+	cmd := exec.Command("xfs_quota", "-x", "-c", command, mount)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := q.CommandRunner.Run(cmd); err != nil {
+		return fmt.Errorf("xfs_quota %s: %s: %s", command, err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+// quotaProject derives a container's XFS project id from its docker id.
+func quotaProject(dockerID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(dockerID))
+
+	// project 0 is the default project, which cannot be limited
+	if id := h.Sum32(); id != 0 {
+		return id
+	}
+
+	return 1
+}
+
+// mountPoint finds the mount point of the filesystem holding path, by
+// walking up until the device changes.
+func mountPoint(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+
+		var pst syscall.Stat_t
+		if err := syscall.Stat(parent, &pst); err != nil {
+			return "", err
+		}
+
+		if pst.Dev != st.Dev {
+			return path, nil
+		}
+
+		path = parent
+	}
+}
+
+func sameFilesystem(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return false
+	}
+
+	return sa.Dev == sb.Dev
+}
@@ -0,0 +1,72 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("XFSQuota", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var commandRunner *fake_command_runner.FakeCommandRunner
+	var quota *XFSQuota
+	var upperDir string
+
+	BeforeEach(func() {
+		var err error
+		upperDir, err = ioutil.TempDir("", "upper")
+		Expect(err).NotTo(HaveOccurred())
+
+		info := dockercli.ContainerJSON{}
+		info.GraphDriver.Name = "overlay2"
+		info.GraphDriver.Data = map[string]string{"UpperDir": upperDir}
+
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.InspectReturns(info, nil)
+
+		commandRunner = fake_command_runner.New()
+		quota = &XFSQuota{
+			DockerRunner:  dockerRunner,
+			CommandRunner: commandRunner,
+			DockerID:      "some-docker-id",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(upperDir)
+	})
+
+	It("puts the writable layer in a project and limits the project", func() {
+		Expect(quota.Limit(1024)).To(Succeed())
+
+		commands := commandRunner.ExecutedCommands()
+		Expect(commands).To(HaveLen(2))
+		Expect(commands[0].Args[:3]).To(Equal([]string{"xfs_quota", "-x", "-c"}))
+		Expect(commands[0].Args[3]).To(MatchRegexp(`^project -s -p ` + upperDir + ` \d+$`))
+		Expect(commands[1].Args[3]).To(MatchRegexp(`^limit -p bhard=1024 \d+$`))
+	})
+
+	It("uses the same project for the container every time", func() {
+		Expect(quota.Limit(1024)).To(Succeed())
+		Expect(quota.Limit(2048)).To(Succeed())
+
+		commands := commandRunner.ExecutedCommands()
+		Expect(commands[0].Args[3]).To(Equal(commands[2].Args[3]))
+	})
+
+	Context("when the graph driver has no writable layer directory", func() {
+		It("returns an error", func() {
+			dockerRunner.InspectReturns(dockercli.ContainerJSON{}, nil)
+			Expect(quota.Limit(1024)).NotTo(Succeed())
+			Expect(commandRunner).NotTo(HaveExecutedSerially(fake_command_runner.CommandSpec{Path: "xfs_quota"}))
+		})
+	})
+})
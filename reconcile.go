@@ -0,0 +1,237 @@
+package gardendocker
+
+import (
+	"github.com/julz/garden-docker/metrics"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . DockerDaemon
+type DockerDaemon interface {
+	// Identity returns a value which changes whenever dockerd restarts.
+	Identity() (string, error)
+}
+
+//go:generate counterfeiter . Recoverer
+type Recoverer interface {
+	Recover(container *Container) error
+}
+
+//go:generate counterfeiter . DockerContainers
+type DockerContainers interface {
+	Running() (map[string]bool, error)
+	Existing() (map[string]bool, error)
+	Owned() ([]string, error)
+	Remove(dockerID string) error
+
+	// Creating returns the IDs of docker containers which are still being
+	// created, and so are not in the repo yet.
+	Creating() map[string]bool
+}
+
+// Reconciler compares the containers in the repo with the garden-owned
+// containers docker knows about, and repairs any drift between the two:
+//
+//   - containers whose docker container has been removed from under us are
+//     destroyed, releasing their resources, if Destroyer is set;
+//   - containers whose docker container is no longer running are marked as
+//     stopped;
+//   - port mappings whose iptables rules have gone missing are restored;
+//   - garden-owned docker containers which are not in the repo are removed.
+//
+// If Daemon is set, the reconciler also notices when dockerd has restarted
+// and, before anything else, asks the Recoverer to bring back every
+// container in the repo.
+//
+// Docker containers which are still being created, and so are not in the
+// repo yet, are left alone. A docker container is only removed once it has
+// been unknown for two consecutive passes, so that one whose Create has
+// only just returned is not removed before it reaches the repo.
+type Reconciler struct {
+	Repo   Repo
+	Docker DockerContainers
+
+	Daemon    DockerDaemon
+	Recoverer Recoverer
+
+	// Destroyer, if set, destroys containers whose docker container has
+	// gone, before they are removed from the repo.
+	Destroyer Destroyer
+
+	// Corrections, if set, counts the corrections made, by kind.
+	Corrections *metrics.CounterVec
+
+	// Events, if set, is published an event for each container found to
+	// have stopped or to have run out of memory.
+	Events *EventBus
+
+	Logger lager.Logger
+
+	unknown        map[string]bool
+	daemonIdentity string
+}
+
+func NewReconcilerMetrics(registry *metrics.Registry) *metrics.CounterVec {
+	return registry.NewCounterVec(
+		"reconcile_corrections_total",
+		"Corrections made when reconciling the repo with docker, by kind.",
+		"kind",
+	)
+}
+
+func (r *Reconciler) Reconcile() {
+	log := r.Logger.Session("reconcile")
+
+	if r.Daemon != nil {
+		r.recoverAfterRestart(log)
+	}
+
+	running, err := r.Docker.Running()
+	if err != nil {
+		log.Error("list-running-failed", err)
+		return
+	}
+
+	var existing map[string]bool
+	if r.Destroyer != nil {
+		if existing, err = r.Docker.Existing(); err != nil {
+			log.Error("list-existing-failed", err)
+			return
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, container := range r.Repo.All() {
+		known[container.DockerID] = true
+
+		if existing != nil && !existing[container.DockerID] {
+			r.prune(log, container)
+			continue
+		}
+
+		if !container.Stopped() {
+			r.checkOOM(log, container)
+		}
+
+		if !running[container.DockerID] {
+			if !container.Stopped() {
+				log.Info("marking-stopped", lager.Data{"handle": container.Handle(), "docker-id": container.DockerID})
+				container.MarkStopped("container stopped unexpectedly")
+				r.Events.Publish(Event{Kind: EventStopped, Handle: container.Handle()})
+				r.corrected("container_stopped", 1)
+			}
+
+			continue
+		}
+
+		if container.NetHandler == nil {
+			continue
+		}
+
+		restored, err := container.RestorePortMappings()
+		if err != nil {
+			log.Error("restore-port-mappings-failed", err, lager.Data{"handle": container.Handle()})
+		}
+
+		if restored > 0 {
+			log.Info("restored-port-mappings", lager.Data{"handle": container.Handle(), "count": restored})
+			r.corrected("port_mapping_restored", restored)
+		}
+	}
+
+	owned, err := r.Docker.Owned()
+	if err != nil {
+		log.Error("list-owned-failed", err)
+		return
+	}
+
+	creating := r.Docker.Creating()
+
+	unknown := make(map[string]bool)
+	for _, id := range owned {
+		if known[id] || creating[id] {
+			continue
+		}
+
+		if !r.unknown[id] {
+			unknown[id] = true
+			continue
+		}
+
+		log.Info("removing-unknown-container", lager.Data{"docker-id": id})
+		if err := r.Docker.Remove(id); err != nil {
+			log.Error("remove-unknown-container-failed", err, lager.Data{"docker-id": id})
+			unknown[id] = true
+			continue
+		}
+
+		r.corrected("unknown_container_removed", 1)
+	}
+
+	r.unknown = unknown
+}
+
+// prune destroys a container whose docker container has gone, and removes
+// it from the repo, unless destroying it fails.
+func (r *Reconciler) prune(log lager.Logger, container *Container) {
+	log.Info("pruning-vanished-container", lager.Data{"handle": container.Handle(), "docker-id": container.DockerID})
+
+	if err := r.Destroyer.Destroy(container); err != nil && !isNoSuchContainer(err) {
+		log.Error("prune-vanished-container-failed", err, lager.Data{"handle": container.Handle()})
+		return
+	}
+
+	r.Repo.Delete(container)
+	r.Events.Publish(Event{Kind: EventDestroyed, Handle: container.Handle()})
+	r.corrected("vanished_container_pruned", 1)
+}
+
+// checkOOM looks for processes in the container which have been killed for
+// running out of memory since it was last looked at. It is checked before
+// the container is marked stopped, so that an out of memory kill which
+// stopped it is still found.
+func (r *Reconciler) checkOOM(log lager.Logger, container *Container) {
+	oom, err := container.CheckOOM()
+	if err != nil {
+		log.Error("check-oom-failed", err, lager.Data{"handle": container.Handle()})
+		return
+	}
+
+	if oom {
+		log.Info("out-of-memory", lager.Data{"handle": container.Handle()})
+		r.Events.Publish(Event{Kind: EventOOM, Handle: container.Handle()})
+	}
+}
+
+func (r *Reconciler) recoverAfterRestart(log lager.Logger) {
+	identity, err := r.Daemon.Identity()
+	if err != nil {
+		log.Error("identify-docker-daemon-failed", err)
+		return
+	}
+
+	restarted := r.daemonIdentity != "" && identity != r.daemonIdentity
+	r.daemonIdentity = identity
+	if !restarted {
+		return
+	}
+
+	log.Info("docker-daemon-restarted")
+	for _, container := range r.Repo.All() {
+		if err := r.Recoverer.Recover(container); err != nil {
+			log.Error("recover-failed", err, lager.Data{"handle": container.Handle()})
+			continue
+		}
+
+		if container.Stopped() {
+			container.MarkActive("container recovered after docker restart")
+		}
+
+		r.corrected("container_recovered", 1)
+	}
+}
+
+func (r *Reconciler) corrected(kind string, n int) {
+	if r.Corrections != nil {
+		r.Corrections.Add(float64(n), kind)
+	}
+}
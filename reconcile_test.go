@@ -0,0 +1,320 @@
+package gardendocker_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	"github.com/julz/garden-docker/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Reconciler", func() {
+	var (
+		reconciler  *gardendocker.Reconciler
+		repo        gardendocker.Repo
+		fakeDocker  *fakes.FakeDockerContainers
+		fakeChain   *fakes.FakeChain
+		corrections *metrics.CounterVec
+		container   *gardendocker.Container
+	)
+
+	BeforeEach(func() {
+		repo = gardendocker.NewRepo()
+		fakeDocker = new(fakes.FakeDockerContainers)
+		fakeChain = new(fakes.FakeChain)
+		fakeChain.ForwardExistsReturns(true)
+		corrections = gardendocker.NewReconcilerMetrics(metrics.NewRegistry())
+
+		reconciler = &gardendocker.Reconciler{
+			Repo:        repo,
+			Docker:      fakeDocker,
+			Corrections: corrections,
+			Logger:      lagertest.NewTestLogger("reconcile"),
+		}
+
+		container = &gardendocker.Container{
+			InfoHandler: &gardendocker.InfoHandler{
+				Spec:         garden.ContainerSpec{Handle: "some-handle"},
+				DockerID:     "some-docker-id",
+				PropsHandler: gardendocker.NewPropsHandler(nil),
+			},
+			NetHandler: &gardendocker.NetHandler{Chain: fakeChain},
+		}
+		repo.Add(container)
+
+		fakeDocker.RunningReturns(map[string]bool{"some-docker-id": true}, nil)
+		fakeDocker.OwnedReturns([]string{"some-docker-id"}, nil)
+	})
+
+	Context("when the docker container is no longer running", func() {
+		BeforeEach(func() {
+			fakeDocker.RunningReturns(map[string]bool{}, nil)
+		})
+
+		It("marks the container as stopped", func() {
+			reconciler.Reconcile()
+
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.State).To(Equal("stopped"))
+			Expect(info.Events).To(ConsistOf("container stopped unexpectedly"))
+			Expect(corrections.Value("container_stopped")).To(Equal(1.0))
+		})
+
+		It("only counts the correction once", func() {
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+
+			Expect(corrections.Value("container_stopped")).To(Equal(1.0))
+		})
+	})
+
+	Context("when a process in the container has been killed for running out of memory", func() {
+		var stats *fakes.FakeContainerStats
+
+		BeforeEach(func() {
+			stats = new(fakes.FakeContainerStats)
+			stats.OOMKillsReturns(1, nil)
+			container.LimitsHandler = &gardendocker.LimitsHandler{Stats: stats}
+			reconciler.Events = gardendocker.NewEventBus()
+		})
+
+		It("records the out of memory event and publishes it once", func() {
+			events, _ := reconciler.Events.Subscribe()
+
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Events).To(ConsistOf("out of memory"))
+
+			var event gardendocker.Event
+			Expect(events).To(Receive(&event))
+			Expect(event.Kind).To(Equal(gardendocker.EventOOM))
+			Expect(event.Handle).To(Equal("some-handle"))
+			Expect(events).NotTo(Receive())
+		})
+
+		It("publishes again if more processes are killed", func() {
+			events, _ := reconciler.Events.Subscribe()
+
+			reconciler.Reconcile()
+			stats.OOMKillsReturns(2, nil)
+			reconciler.Reconcile()
+
+			Expect(events).To(HaveLen(2))
+		})
+
+		It("still finds the kill when it also stopped the container", func() {
+			fakeDocker.RunningReturns(map[string]bool{}, nil)
+			reconciler.Reconcile()
+
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.State).To(Equal("stopped"))
+			Expect(info.Events).To(ConsistOf("out of memory", "container stopped unexpectedly"))
+		})
+	})
+
+	Context("when a port mapping's rule has gone missing", func() {
+		BeforeEach(func() {
+			container.NetIn(123, 456)
+			fakeChain.ForwardExistsReturns(false)
+		})
+
+		It("restores it", func() {
+			reconciler.Reconcile()
+
+			Expect(fakeChain.ForwardCallCount()).To(Equal(2))
+			Expect(corrections.Value("port_mapping_restored")).To(Equal(1.0))
+		})
+	})
+
+	Context("when docker has a garden-owned container which is not in the repo", func() {
+		BeforeEach(func() {
+			fakeDocker.OwnedReturns([]string{"some-docker-id", "unknown-id"}, nil)
+		})
+
+		It("leaves it alone on the first pass, in case it is still being created", func() {
+			reconciler.Reconcile()
+			Expect(fakeDocker.RemoveCallCount()).To(Equal(0))
+		})
+
+		It("removes it if it is still unknown on the next pass", func() {
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+
+			Expect(fakeDocker.RemoveCallCount()).To(Equal(1))
+			Expect(fakeDocker.RemoveArgsForCall(0)).To(Equal("unknown-id"))
+			Expect(corrections.Value("unknown_container_removed")).To(Equal(1.0))
+		})
+
+		It("does not remove it if it has since been added to the repo", func() {
+			reconciler.Reconcile()
+			repo.Add(&gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:     garden.ContainerSpec{Handle: "new-handle"},
+					DockerID: "unknown-id",
+				},
+			})
+			reconciler.Reconcile()
+
+			Expect(fakeDocker.RemoveCallCount()).To(Equal(0))
+		})
+
+		It("does not remove it while it is still being created, however long that takes", func() {
+			fakeDocker.CreatingReturns(map[string]bool{"unknown-id": true})
+
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+			Expect(fakeDocker.RemoveCallCount()).To(Equal(0))
+
+			fakeDocker.CreatingReturns(nil)
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+			Expect(fakeDocker.RemoveCallCount()).To(Equal(1))
+		})
+
+		Context("when removing it fails", func() {
+			It("tries again on the next pass", func() {
+				fakeDocker.RemoveReturns(errors.New("boom"))
+
+				reconciler.Reconcile()
+				reconciler.Reconcile()
+				reconciler.Reconcile()
+
+				Expect(fakeDocker.RemoveCallCount()).To(Equal(2))
+				Expect(corrections.Value("unknown_container_removed")).To(Equal(0.0))
+			})
+		})
+	})
+
+	Context("when a container's docker container has been removed from under us", func() {
+		var fakeDestroyer *fakes.FakeDestroyer
+
+		BeforeEach(func() {
+			fakeDestroyer = new(fakes.FakeDestroyer)
+			reconciler.Destroyer = fakeDestroyer
+			reconciler.Events = gardendocker.NewEventBus()
+
+			fakeDocker.RunningReturns(map[string]bool{}, nil)
+			fakeDocker.ExistingReturns(map[string]bool{"other-docker-id": true}, nil)
+		})
+
+		It("destroys it, releasing its resources, and removes it from the repo", func() {
+			events, _ := reconciler.Events.Subscribe()
+			reconciler.Reconcile()
+
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			Expect(fakeDestroyer.DestroyArgsForCall(0)).To(Equal(container))
+			Expect(repo.All()).To(BeEmpty())
+			Expect(corrections.Value("vanished_container_pruned")).To(Equal(1.0))
+
+			var event gardendocker.Event
+			Expect(events).To(Receive(&event))
+			Expect(event.Kind).To(Equal(gardendocker.EventDestroyed))
+		})
+
+		It("does not destroy containers whose docker container is only stopped", func() {
+			fakeDocker.ExistingReturns(map[string]bool{"some-docker-id": true}, nil)
+			reconciler.Reconcile()
+
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+			Expect(repo.All()).To(HaveLen(1))
+		})
+
+		Context("when destroying it fails", func() {
+			It("keeps it in the repo, to try again on the next pass", func() {
+				fakeDestroyer.DestroyReturns(errors.New("boom"))
+				reconciler.Reconcile()
+
+				Expect(repo.All()).To(HaveLen(1))
+				Expect(corrections.Value("vanished_container_pruned")).To(Equal(0.0))
+			})
+		})
+
+		Context("when docker cannot list its containers", func() {
+			It("destroys nothing", func() {
+				fakeDocker.ExistingReturns(nil, errors.New("docker down"))
+				reconciler.Reconcile()
+
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+				Expect(repo.All()).To(HaveLen(1))
+			})
+		})
+	})
+
+	Context("when docker cannot be listed", func() {
+		It("makes no corrections", func() {
+			fakeDocker.RunningReturns(nil, errors.New("boom"))
+			reconciler.Reconcile()
+
+			info, _ := container.Info()
+			Expect(info.State).To(Equal("active"))
+			Expect(fakeDocker.OwnedCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a docker daemon is configured", func() {
+		var fakeDaemon *fakes.FakeDockerDaemon
+		var fakeRecoverer *fakes.FakeRecoverer
+
+		BeforeEach(func() {
+			fakeDaemon = new(fakes.FakeDockerDaemon)
+			fakeRecoverer = new(fakes.FakeRecoverer)
+			fakeDaemon.IdentityReturns("123:456", nil)
+
+			reconciler.Daemon = fakeDaemon
+			reconciler.Recoverer = fakeRecoverer
+		})
+
+		It("does not recover anything while the daemon stays the same", func() {
+			reconciler.Reconcile()
+			reconciler.Reconcile()
+
+			Expect(fakeRecoverer.RecoverCallCount()).To(Equal(0))
+		})
+
+		Context("when the daemon restarts", func() {
+			BeforeEach(func() {
+				reconciler.Reconcile()
+				fakeDaemon.IdentityReturns("789:1011", nil)
+			})
+
+			It("recovers every container", func() {
+				reconciler.Reconcile()
+
+				Expect(fakeRecoverer.RecoverCallCount()).To(Equal(1))
+				Expect(fakeRecoverer.RecoverArgsForCall(0)).To(Equal(container))
+				Expect(corrections.Value("container_recovered")).To(Equal(1.0))
+			})
+
+			It("marks containers which had been marked as stopped as active again", func() {
+				container.MarkStopped("container stopped unexpectedly")
+				reconciler.Reconcile()
+
+				info, _ := container.Info()
+				Expect(info.State).To(Equal("active"))
+				Expect(info.Events).To(ContainElement("container recovered after docker restart"))
+			})
+
+			Context("when recovering a container fails", func() {
+				It("leaves it to be marked as stopped", func() {
+					fakeRecoverer.RecoverReturns(errors.New("boom"))
+					fakeDocker.RunningReturns(map[string]bool{}, nil)
+
+					reconciler.Reconcile()
+
+					info, _ := container.Info()
+					Expect(info.State).To(Equal("stopped"))
+				})
+			})
+		})
+	})
+})
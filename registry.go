@@ -0,0 +1,90 @@
+package gardendocker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// pull pulls an image. Images from docker hub are pulled through the
+// RegistryMirror, if there is one, and tagged with the name they were asked
+// for, so that docker run finds them; if the mirror cannot supply an image it
+// is pulled from docker hub. Images pinned to a digest cannot be tagged with
+// their own name, so they always come from docker hub.
+func (c *DaemonContainerCreator) pull(docker DockerRunner, cmd dockercli.PullCmd) error {
+	if mirrored, ok := c.mirrored(cmd.Image); ok {
+		if _, err := docker.Pull(dockercli.PullCmd{Image: mirrored, ConfigDir: cmd.ConfigDir}); err == nil {
+			_, err := docker.Tag(dockercli.TagCmd{Source: mirrored, Target: cmd.Image})
+			return err
+		}
+	}
+
+	_, err := docker.Pull(cmd)
+	return err
+}
+
+// mirrored returns the name of a docker hub image on the RegistryMirror.
+// Official images live under library/ on a mirror.
+func (c *DaemonContainerCreator) mirrored(image string) (string, bool) {
+	if c.RegistryMirror == "" {
+		return "", false
+	}
+
+	repository, _, digest := splitImage(image)
+	if digest != "" || !onDockerHub(repository) {
+		return "", false
+	}
+
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+
+	mirror := c.RegistryMirror
+	if i := strings.Index(mirror, "://"); i >= 0 {
+		mirror = mirror[i+3:]
+	}
+
+	return strings.TrimSuffix(mirror, "/") + "/" + image, true
+}
+
+// onDockerHub reports whether a repository is on docker hub, which is to say
+// it does not start with a registry host: a component containing a dot or a
+// port, or localhost.
+func onDockerHub(repository string) bool {
+	i := strings.Index(repository, "/")
+	if i < 0 {
+		return true
+	}
+
+	host := repository[:i]
+	return !strings.ContainsAny(host, ".:") && host != "localhost"
+}
+
+// CheckInsecureRegistries checks that dockerd is configured to talk to each
+// of the InsecureRegistries over plain HTTP. The docker cli cannot be told so
+// for a single pull, so they have to be given to dockerd itself, for example
+// in the insecure-registries of its daemon.json.
+func (c *DaemonContainerCreator) CheckInsecureRegistries() error {
+	if len(c.InsecureRegistries) == 0 {
+		return nil
+	}
+
+	config, err := c.DockerRunner.RegistryConfig(dockercli.RegistryConfigCmd{})
+	if err != nil {
+		return fmt.Errorf("insecure registries: %s", err)
+	}
+
+	var missing []string
+	for _, registry := range c.InsecureRegistries {
+		if index, ok := config.IndexConfigs[registry]; !ok || index.Secure {
+			missing = append(missing, registry)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("insecure registries: dockerd is not configured to trust %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
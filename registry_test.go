@@ -0,0 +1,119 @@
+package gardendocker_test
+
+import (
+	"errors"
+
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registries", func() {
+	var creator *DaemonContainerCreator
+	var dockerRunner *fakes.FakeDockerRunner
+
+	BeforeEach(func() {
+		dockerRunner = new(fakes.FakeDockerRunner)
+		creator = &DaemonContainerCreator{
+			DockerRunner:   dockerRunner,
+			RegistryMirror: "http://mirror.internal:5000/",
+		}
+	})
+
+	pulled := func() []string {
+		var images []string
+		for i := 0; i < dockerRunner.PullCallCount(); i++ {
+			images = append(images, dockerRunner.PullArgsForCall(i).Image)
+		}
+
+		return images
+	}
+
+	Describe("pulling through a mirror", func() {
+		It("pulls official docker hub images from the mirror's library and tags them with their own name", func() {
+			creator.DefaultRootfs = "docker:///busybox#1.36"
+			Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+			Expect(pulled()).To(Equal([]string{"mirror.internal:5000/library/busybox:1.36"}))
+			Expect(dockerRunner.TagArgsForCall(0)).To(Equal(dockercli.TagCmd{
+				Source: "mirror.internal:5000/library/busybox:1.36",
+				Target: "busybox:1.36",
+			}))
+		})
+
+		It("pulls other docker hub images from the mirror under their own name", func() {
+			creator.DefaultRootfs = "docker:///someone/someimage"
+			Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+			Expect(pulled()).To(Equal([]string{"mirror.internal:5000/someone/someimage"}))
+		})
+
+		Context("when the mirror cannot supply the image", func() {
+			It("pulls it from docker hub", func() {
+				dockerRunner.PullStub = func(cmd dockercli.PullCmd) (string, error) {
+					if cmd.Image == "mirror.internal:5000/library/busybox" {
+						return "", errors.New("not found")
+					}
+
+					return "", nil
+				}
+
+				creator.DefaultRootfs = "docker:///busybox"
+				Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+				Expect(pulled()).To(Equal([]string{"mirror.internal:5000/library/busybox", "busybox"}))
+				Expect(dockerRunner.TagCallCount()).To(Equal(0))
+			})
+		})
+
+		It("pulls images from other registries directly", func() {
+			creator.DefaultRootfs = "docker://registry.example.com/someimage"
+			Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+			Expect(pulled()).To(Equal([]string{"registry.example.com/someimage"}))
+		})
+
+		It("pulls images pinned to a digest directly", func() {
+			creator.DefaultRootfs = "docker:///busybox@sha256:ab0123456789abcdef0123456789abcdef"
+			Expect(creator.PullDefaultRootfs()).To(Succeed())
+
+			Expect(pulled()).To(Equal([]string{"busybox@sha256:ab0123456789abcdef0123456789abcdef"}))
+		})
+	})
+
+	Describe("CheckInsecureRegistries", func() {
+		BeforeEach(func() {
+			creator.InsecureRegistries = []string{"registry.internal:5000", "other.internal"}
+
+			config := dockercli.RegistryConfig{IndexConfigs: map[string]struct {
+				Name   string
+				Secure bool
+			}{
+				"registry.internal:5000": {Name: "registry.internal:5000", Secure: false},
+				"other.internal":         {Name: "other.internal", Secure: false},
+			}}
+			dockerRunner.RegistryConfigReturns(config, nil)
+		})
+
+		It("succeeds when dockerd trusts every insecure registry", func() {
+			Expect(creator.CheckInsecureRegistries()).To(Succeed())
+		})
+
+		Context("when dockerd does not trust one of them", func() {
+			It("returns an error naming it", func() {
+				creator.InsecureRegistries = append(creator.InsecureRegistries, "unknown.internal")
+				Expect(creator.CheckInsecureRegistries()).To(MatchError("insecure registries: dockerd is not configured to trust unknown.internal"))
+			})
+		})
+
+		Context("when there are no insecure registries", func() {
+			It("does not ask dockerd", func() {
+				creator.InsecureRegistries = nil
+				Expect(creator.CheckInsecureRegistries()).To(Succeed())
+				Expect(dockerRunner.RegistryConfigCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
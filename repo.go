@@ -1,27 +1,36 @@
 package gardendocker
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden"
 )
 
+// repo holds the containers garden-docker knows about. It keeps an index of
+// their properties, so that finding containers by property does not mean
+// looking at every container.
 type repo struct {
 	store map[string]*Container
 	mutex *sync.RWMutex
+
+	// index maps a property name and value to the containers which have it;
+	// indexed remembers the properties each container was indexed under, so
+	// that they can be unindexed when they change.
+	index   map[string]map[string]map[*Container]bool
+	indexed map[*Container]garden.Properties
 }
 
 func NewRepo() *repo {
 	return &repo{
-		store: map[string]*Container{},
-		mutex: &sync.RWMutex{},
+		store:   map[string]*Container{},
+		mutex:   &sync.RWMutex{},
+		index:   map[string]map[string]map[*Container]bool{},
+		indexed: map[*Container]garden.Properties{},
 	}
 }
 
 func (cr *repo) All() []*Container {
-	cr.mutex.RLock()
-	defer cr.mutex.RUnlock()
-
 	return cr.Query(func(c *Container) bool {
 		return true
 	})
@@ -29,9 +38,18 @@ func (cr *repo) All() []*Container {
 
 func (cr *repo) Add(container *Container) {
 	cr.mutex.Lock()
-	defer cr.mutex.Unlock()
-
+	if old, ok := cr.store[container.Handle()]; ok {
+		cr.unindex(old)
+	}
 	cr.store[container.Handle()] = container
+	cr.mutex.Unlock()
+
+	if container.InfoHandler == nil || container.PropsHandler == nil {
+		return
+	}
+
+	container.PropsHandler.onChange(func() { cr.reindex(container) })
+	cr.reindex(container)
 }
 
 func (cr *repo) FindByHandle(handle string) (*Container, error) {
@@ -46,11 +64,61 @@ func (cr *repo) FindByHandle(handle string) (*Container, error) {
 	return container, nil
 }
 
+// FindByIP returns the container with the given IPv4 or IPv6 address, if
+// there is one.
+func (cr *repo) FindByIP(ip string) (*Container, error) {
+	matches := cr.Query(func(c *Container) bool {
+		return c.InfoHandler != nil && (c.InfoHandler.containerIP() == ip || c.InfoHandler.ContainerIPv6 == ip)
+	})
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no container has IP %s", ip)
+	}
+
+	return matches[0], nil
+}
+
+// FindByProperties returns the containers which have all of the given
+// properties, using the property index. An empty filter matches every
+// container.
+func (cr *repo) FindByProperties(props garden.Properties) []*Container {
+	if len(props) == 0 {
+		return cr.All()
+	}
+
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	// start from the smallest set of candidates and check the rest of the
+	// filter against the index
+	var candidates map[*Container]bool
+	for k, v := range props {
+		matches := cr.index[k][v]
+		if candidates == nil || len(matches) < len(candidates) {
+			candidates = matches
+		}
+	}
+
+	var found []*Container
+	for c := range candidates {
+		if cr.indexedUnder(c, props) {
+			found = append(found, c)
+		}
+	}
+
+	return found
+}
+
 func (cr *repo) Delete(container *Container) {
+	if container.InfoHandler != nil && container.PropsHandler != nil {
+		container.PropsHandler.onChange(nil)
+	}
+
 	cr.mutex.Lock()
 	defer cr.mutex.Unlock()
 
 	delete(cr.store, container.Handle())
+	cr.unindex(container)
 }
 
 func (cr *repo) Query(filter func(*Container) bool) []*Container {
@@ -66,3 +134,58 @@ func (cr *repo) Query(filter func(*Container) bool) []*Container {
 
 	return matches
 }
+
+func (cr *repo) reindex(container *Container) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if cr.store[container.Handle()] != container {
+		return
+	}
+
+	// the properties are read under the lock, so that two changes reindexing
+	// at once cannot leave the older properties indexed
+	props := container.properties()
+
+	cr.unindex(container)
+	for k, v := range props {
+		if cr.index[k] == nil {
+			cr.index[k] = map[string]map[*Container]bool{}
+		}
+
+		if cr.index[k][v] == nil {
+			cr.index[k][v] = map[*Container]bool{}
+		}
+
+		cr.index[k][v][container] = true
+	}
+
+	cr.indexed[container] = props
+}
+
+func (cr *repo) unindex(container *Container) {
+	for k, v := range cr.indexed[container] {
+		delete(cr.index[k][v], container)
+
+		if len(cr.index[k][v]) == 0 {
+			delete(cr.index[k], v)
+		}
+
+		if len(cr.index[k]) == 0 {
+			delete(cr.index, k)
+		}
+	}
+
+	delete(cr.indexed, container)
+}
+
+func (cr *repo) indexedUnder(container *Container, props garden.Properties) bool {
+	indexed := cr.indexed[container]
+	for k, v := range props {
+		if prop, ok := indexed[k]; !ok || prop != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,85 @@
+package gardendocker_test
+
+import (
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repo", func() {
+	var repo Repo
+	var a, b *Container
+
+	newContainer := func(handle string, props garden.Properties) *Container {
+		return &Container{InfoHandler: &InfoHandler{
+			Spec:         garden.ContainerSpec{Handle: handle},
+			PropsHandler: NewPropsHandler(props),
+		}}
+	}
+
+	BeforeEach(func() {
+		repo = NewRepo()
+
+		a = newContainer("a", garden.Properties{"app": "web", "instance": "0"})
+		b = newContainer("b", garden.Properties{"app": "web", "instance": "1"})
+
+		repo.Add(a)
+		repo.Add(b)
+	})
+
+	Describe("FindByIP", func() {
+		It("returns the container with the IP", func() {
+			a.InfoHandler.ContainerIP = "10.254.0.2"
+			b.InfoHandler.ContainerIP = "10.254.0.3"
+
+			Expect(repo.FindByIP("10.254.0.3")).To(Equal(b))
+		})
+
+		It("returns the container with the IPv6 address", func() {
+			a.InfoHandler.ContainerIPv6 = "fd00::2"
+
+			Expect(repo.FindByIP("fd00::2")).To(Equal(a))
+		})
+
+		It("returns an error when no container has it", func() {
+			_, err := repo.FindByIP("10.254.0.4")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("FindByProperties", func() {
+		It("returns the containers with all of the given properties", func() {
+			Expect(repo.FindByProperties(garden.Properties{"app": "web"})).To(ConsistOf(a, b))
+			Expect(repo.FindByProperties(garden.Properties{"app": "web", "instance": "1"})).To(ConsistOf(b))
+			Expect(repo.FindByProperties(garden.Properties{"app": "worker"})).To(BeEmpty())
+		})
+
+		It("returns every container for an empty filter", func() {
+			Expect(repo.FindByProperties(nil)).To(ConsistOf(a, b))
+		})
+
+		It("follows properties as they are set and removed", func() {
+			Expect(a.SetProperty("instance", "2")).To(Succeed())
+			Expect(repo.FindByProperties(garden.Properties{"instance": "0"})).To(BeEmpty())
+			Expect(repo.FindByProperties(garden.Properties{"instance": "2"})).To(ConsistOf(a))
+
+			Expect(b.RemoveProperty("app")).To(Succeed())
+			Expect(repo.FindByProperties(garden.Properties{"app": "web"})).To(ConsistOf(a))
+		})
+
+		It("includes imported docker labels", func() {
+			a.ImportLabels(map[string]string{"team": "blue"})
+			Expect(repo.FindByProperties(garden.Properties{LabelPropertyPrefix + "team": "blue"})).To(ConsistOf(a))
+		})
+
+		It("forgets deleted containers", func() {
+			repo.Delete(a)
+			Expect(repo.FindByProperties(garden.Properties{"app": "web"})).To(ConsistOf(b))
+
+			a.SetProperty("app", "web")
+			Expect(repo.FindByProperties(garden.Properties{"app": "web"})).To(ConsistOf(b))
+		})
+	})
+})
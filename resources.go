@@ -0,0 +1,177 @@
+package gardendocker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Resources are the host resources which container limits are committed
+// against. CPU shares are not among them: they are weights relative to the
+// other containers rather than a share of the host, so any number of them
+// fits. CPUs are reserved for the host with a cpuset instead; see
+// UnreservedCPUs.
+type Resources struct {
+	MemoryInBytes uint64
+	DiskInBytes   uint64
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{
+		MemoryInBytes: r.MemoryInBytes + o.MemoryInBytes,
+		DiskInBytes:   r.DiskInBytes + o.DiskInBytes,
+	}
+}
+
+func (r Resources) sub(o Resources) Resources {
+	return Resources{
+		MemoryInBytes: subFloor(r.MemoryInBytes, o.MemoryInBytes),
+		DiskInBytes:   subFloor(r.DiskInBytes, o.DiskInBytes),
+	}
+}
+
+func (r Resources) exceeds(o Resources) bool {
+	return r.MemoryInBytes > o.MemoryInBytes || r.DiskInBytes > o.DiskInBytes
+}
+
+func subFloor(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+
+	return a - b
+}
+
+var ErrInsufficientResources = errors.New("insufficient resources: limit would exceed the host's unreserved capacity")
+
+//go:generate counterfeiter . SystemResources
+type SystemResources interface {
+	Total() (Resources, error)
+}
+
+// ResourcePool keeps track of the resources committed to container limits so
+// that, in aggregate, they never exceed what the host has left once the
+// Reserved resources (for the host OS, dockerd etc.) are taken out.
+type ResourcePool struct {
+	System   SystemResources
+	Reserved Resources
+
+	mu        sync.Mutex
+	committed map[interface{}]Resources
+}
+
+// Available returns the host's total resources less the reserved resources.
+func (p *ResourcePool) Available() (Resources, error) {
+	total, err := p.System.Total()
+	if err != nil {
+		return Resources{}, err
+	}
+
+	return total.sub(p.Reserved), nil
+}
+
+// Commit records the resources committed by owner, replacing any it had
+// previously committed. It fails if this would take the total committed
+// resources over the available resources.
+func (p *ResourcePool) Commit(owner interface{}, r Resources) error {
+	available, err := p.Available()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.committed == nil {
+		p.committed = make(map[interface{}]Resources)
+	}
+
+	total := r
+	for o, c := range p.committed {
+		if o != owner {
+			total = total.add(c)
+		}
+	}
+
+	if total.exceeds(available) {
+		return ErrInsufficientResources
+	}
+
+	p.committed[owner] = r
+	return nil
+}
+
+func (p *ResourcePool) Release(owner interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.committed, owner)
+}
+
+// HostResources reads the resources of the host: its memory and the size of
+// the filesystem holding the depot.
+type HostResources struct {
+	DepotDir string
+}
+
+func (h *HostResources) Total() (Resources, error) {
+	memory, err := totalMemory()
+	if err != nil {
+		return Resources{}, fmt.Errorf("read total memory: %s", err)
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(h.DepotDir, &fs); err != nil {
+		return Resources{}, fmt.Errorf("statfs %s: %s", h.DepotDir, err)
+	}
+
+	return Resources{
+		MemoryInBytes: memory,
+		DiskInBytes:   fs.Blocks * uint64(fs.Bsize),
+	}, nil
+}
+
+// UnreservedCPUs returns the cpuset of the host's CPUs less the first
+// reserved of them, which are left to the host OS and dockerd, or "" if none
+// are reserved.
+func UnreservedCPUs(numCPU, reserved int) (string, error) {
+	switch {
+	case reserved == 0:
+		return "", nil
+	case reserved >= numCPU:
+		return "", fmt.Errorf("cannot reserve %d of %d CPUs", reserved, numCPU)
+	case reserved == numCPU-1:
+		return strconv.Itoa(reserved), nil
+	default:
+		return fmt.Sprintf("%d-%d", reserved, numCPU-1), nil
+	}
+}
+
+func totalMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "MemTotal:") {
+			continue
+		}
+
+		var kb uint64
+		if _, err := fmt.Sscanf(scanner.Text(), "MemTotal: %d kB", &kb); err != nil {
+			return 0, err
+		}
+
+		return kb * 1024, nil
+	}
+
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
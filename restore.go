@@ -0,0 +1,192 @@
+package gardendocker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . Restorer
+type Restorer interface {
+	// Restore rebuilds the containers left behind by a previous
+	// garden-docker process.
+	Restore(logger lager.Logger) ([]*Container, error)
+}
+
+// Restore adds the containers left behind by a previous garden-docker process
+// to the repo, so that they can be looked up, run in and destroyed again. It
+// must run before the reconciler, which would otherwise remove their docker
+// containers as unknown. It returns an error if nothing could be restored,
+// not even which containers there were.
+func (b *Backend) Restore() error {
+	if b.Restorer == nil {
+		return nil
+	}
+
+	log := b.Logger.Session("restore")
+
+	containers, err := b.Restorer.Restore(log)
+	if err != nil {
+		log.Error("failed", err)
+		return err
+	}
+
+	for _, container := range containers {
+		container.Touch()
+		b.Repo.Add(container)
+	}
+
+	log.Info("restored", lager.Data{"count": len(containers)})
+	return nil
+}
+
+// Restore rebuilds a container for each garden-owned docker container, from
+// the metadata saved in its depot directory (or, for containers created
+// before it was saved, from its labels and saved properties and port
+// mappings) and the limits docker has for it, and then recovers it as after
+// a dockerd restart, so that initd is reachable again. Containers which
+// cannot be restored are logged and left for the reconciler to remove.
+//
+// Adopted containers are not labelled as garden-owned, so they are not
+// restored; they can be adopted again.
+func (c *DaemonContainerCreator) Restore(logger lager.Logger) ([]*Container, error) {
+	ids, err := c.Owned()
+	if err != nil {
+		return nil, fmt.Errorf("restore: %s", err)
+	}
+
+	var containers []*Container
+	for _, id := range ids {
+		container, err := c.restore(id)
+		if err != nil {
+			logger.Error("restore-container-failed", err, lager.Data{"docker-id": id})
+			continue
+		}
+
+		// containers created before metadata was saved have it from now on
+		if err := container.SaveMetadata(); err != nil {
+			logger.Error("save-metadata-failed", err, lager.Data{"handle": container.Handle()})
+		}
+
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+func (c *DaemonContainerCreator) restore(dockerID string) (*Container, error) {
+	info, err := c.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: dockerID})
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %s", dockerID, err)
+	}
+
+	handle := info.Config.Labels[HandleLabel]
+	if handle == "" {
+		return nil, fmt.Errorf("docker container %s has no %s label", dockerID, HandleLabel)
+	}
+
+	dir := depotDir(info)
+	if dir == "" {
+		return nil, fmt.Errorf("docker container %s has no depot directory mounted", dockerID)
+	}
+
+	metadata, err := ReadMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata != nil && metadata.DockerID != info.ID {
+		return nil, fmt.Errorf("depot directory %s belongs to docker container %s, not %s", dir, metadata.DockerID, info.ID)
+	}
+
+	// properties written to labels at creation are the fallback for a
+	// container whose saved properties are missing
+	properties := garden.Properties{}
+	for k, v := range info.Config.Labels {
+		if strings.HasPrefix(k, PropertyLabelPrefix) {
+			properties[strings.TrimPrefix(k, PropertyLabelPrefix)] = v
+		}
+	}
+
+	spec := garden.ContainerSpec{
+		Handle:     handle,
+		RootFSPath: DockerScheme + ":///" + info.Config.Image,
+		Env:        info.Config.Env,
+		Properties: properties,
+	}
+
+	if metadata != nil {
+		spec.RootFSPath = metadata.RootFSPath
+		spec.Env = metadata.Env
+		spec.Properties = metadata.Properties
+	}
+
+	container := c.newContainer(spec, dir, info.ID, info.IPAddress(c.DockerNetwork), info.GlobalIPv6Address(c.DockerNetwork), DiskLimitScopeTotal, info.Config.Labels)
+	container.ImageID = info.Image
+	if metadata == nil {
+		if err := container.RecoverProperties(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := container.RecoverProcessIDs(); err != nil {
+		return nil, err
+	}
+
+	scope, err := parseDiskLimitScope(container.properties()[DiskLimitScopeProperty])
+	if err != nil {
+		return nil, err
+	}
+	container.DiskScope = scope
+
+	if metadata != nil {
+		container.ReservePortMappings(metadata.PortMappings)
+		container.RecoverNetOut(metadata.NetOut)
+		container.RecoverDiskLimits(metadata.Limits.Disk)
+		container.RecoverBandwidthLimits(metadata.Limits.Bandwidth)
+	} else if err := container.RecoverPortMappings(); err != nil {
+		return nil, err
+	}
+
+	if err := container.RecoverLimits(); err != nil {
+		container.ReleasePortMappings()
+		return nil, err
+	}
+
+	if err := c.Recover(container); err != nil {
+		container.ReleaseLimits()
+		container.ReleasePortMappings()
+		return nil, err
+	}
+
+	c.reserveIPs(container)
+	return container, nil
+}
+
+// reserveIPs takes a container's addresses, which the pools did not hand out
+// in this process, out of them.
+func (c *DaemonContainerCreator) reserveIPs(container *Container) {
+	if c.IPPool != nil {
+		c.IPPool.Reserve(container.InfoHandler.containerIP())
+	}
+
+	if c.IPv6Pool != nil {
+		c.IPv6Pool.Reserve(container.InfoHandler.ContainerIPv6)
+	}
+}
+
+// depotDir finds a container's depot directory from the host side of its
+// /run mount.
+func depotDir(info dockercli.ContainerJSON) string {
+	for _, m := range info.Mounts {
+		if m.Destination == "/run" {
+			return filepath.Dir(m.Source)
+		}
+	}
+
+	return ""
+}
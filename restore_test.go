@@ -0,0 +1,292 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restoring containers after a restart", func() {
+	Describe("Backend.Start", func() {
+		It("adds the restored containers to the repo", func() {
+			restorer := new(fakes.FakeRestorer)
+			container := &Container{
+				InfoHandler: &InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: "restored"},
+					PropsHandler: NewPropsHandler(nil),
+				},
+				ActivityHandler: &ActivityHandler{},
+			}
+			restorer.RestoreReturns([]*Container{container}, nil)
+
+			backend := &Backend{
+				Repo:     NewRepo(),
+				Restorer: restorer,
+				Logger:   lagertest.NewTestLogger("backend"),
+			}
+
+			Expect(backend.Start()).To(Succeed())
+			defer backend.Stop()
+
+			Expect(backend.Repo.FindByHandle("restored")).To(Equal(container))
+		})
+
+		It("sweeps away the rules of containers which were not restored", func() {
+			restorer := new(fakes.FakeRestorer)
+			restorer.RestoreReturns([]*Container{{
+				InfoHandler: &InfoHandler{
+					Spec:         garden.ContainerSpec{Handle: "restored"},
+					PropsHandler: NewPropsHandler(nil),
+				},
+				ActivityHandler: &ActivityHandler{},
+			}}, nil)
+
+			rules := new(fakes.FakeRuleSweeper)
+			backend := &Backend{
+				Repo:     NewRepo(),
+				Restorer: restorer,
+				Rules:    rules,
+				Logger:   lagertest.NewTestLogger("backend"),
+			}
+
+			Expect(backend.Start()).To(Succeed())
+			defer backend.Stop()
+
+			Expect(rules.SweepCallCount()).To(Equal(1))
+			Expect(rules.SweepArgsForCall(0)).To(Equal(map[string]bool{"restored": true}))
+		})
+
+		Context("when restoring fails", func() {
+			It("leaves the rules alone, as it cannot tell which are still in use", func() {
+				restorer := new(fakes.FakeRestorer)
+				restorer.RestoreReturns(nil, errors.New("docker ps failed"))
+
+				rules := new(fakes.FakeRuleSweeper)
+				backend := &Backend{
+					Repo:     NewRepo(),
+					Restorer: restorer,
+					Rules:    rules,
+					Logger:   lagertest.NewTestLogger("backend"),
+				}
+
+				Expect(backend.Start()).To(Succeed())
+				defer backend.Stop()
+
+				Expect(rules.SweepCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("DaemonContainerCreator.Restore", func() {
+		var creator *DaemonContainerCreator
+		var dockerRunner *fakes.FakeDockerRunner
+		var info dockercli.ContainerJSON
+		var depotDir string
+		var initdListener net.Listener
+		var logger *lagertest.TestLogger
+
+		BeforeEach(func() {
+			var err error
+			depotDir, err = ioutil.TempDir("", "depot")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(depotDir, "run"), 0700)).To(Succeed())
+
+			initdListener, err = net.Listen("unix", filepath.Join(depotDir, "run", "initd.sock"))
+			Expect(err).NotTo(HaveOccurred())
+
+			info = dockercli.ContainerJSON{ID: "some-docker-id"}
+			info.State.Running = true
+			info.NetworkSettings.IPAddress = "1.2.3.4"
+			info.Config.Image = "busybox"
+			info.Config.Labels = map[string]string{
+				OwnerLabel:                       "garden-docker",
+				HandleLabel:                      "some-handle",
+				PropertyLabelPrefix + "app":      "web",
+				PropertyLabelPrefix + "instance": "0",
+			}
+			info.HostConfig.Memory = 1024
+			info.Mounts = append(info.Mounts, struct {
+				Source      string
+				Destination string
+			}{filepath.Join(depotDir, "run"), "/run"})
+
+			dockerRunner = new(fakes.FakeDockerRunner)
+			dockerRunner.PsReturns([]dockercli.PsEntry{{ID: "some-docker-id"}}, nil)
+			dockerRunner.InspectStub = func(dockercli.InspectCmd) (dockercli.ContainerJSON, error) {
+				return info, nil
+			}
+
+			logger = lagertest.NewTestLogger("restore")
+			creator = &DaemonContainerCreator{
+				DockerRunner: dockerRunner,
+				PortPool:     port_pool.New(100, 10),
+				Networker:    &ChainNetworker{Chain: new(fakes.FakeChain)},
+				InitdTimeout: 100 * time.Millisecond,
+			}
+		})
+
+		AfterEach(func() {
+			initdListener.Close()
+			os.RemoveAll(depotDir)
+		})
+
+		It("rebuilds the container from its labels", func() {
+			containers, err := creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers).To(HaveLen(1))
+
+			container := containers[0]
+			Expect(container.Handle()).To(Equal("some-handle"))
+			Expect(container.DockerID).To(Equal("some-docker-id"))
+			Expect(container.ContainerPath).To(Equal(depotDir))
+			Expect(container.GetProperty("app")).To(Equal("web"))
+
+			limits, err := container.CurrentMemoryLimits()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(limits.LimitInBytes).To(Equal(uint64(1024)))
+		})
+
+		It("prefers the properties saved in the depot directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(depotDir, "props.json"), []byte(`{"app":"worker"}`), 0600)).To(Succeed())
+
+			containers, err := creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers[0].GetProperties()).To(HaveKeyWithValue("app", "worker"))
+			Expect(containers[0].GetProperties()).NotTo(HaveKey("instance"))
+		})
+
+		It("recovers the saved port mappings and takes their ports out of the pool", func() {
+			Expect(ioutil.WriteFile(filepath.Join(depotDir, "net.json"), []byte(`[{"HostPort":100,"ContainerPort":8080}]`), 0600)).To(Succeed())
+
+			containers, err := creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(containers[0].PortMappings()).To(Equal([]garden.PortMapping{{HostPort: 100, ContainerPort: 8080}}))
+
+			port, err := creator.PortPool.Acquire()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(port).NotTo(Equal(uint32(100)))
+		})
+
+		It("takes the container's IP out of the subnet pool", func() {
+			var err error
+			creator.IPPool, err = NewIPPool("1.2.3.0/29")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < 4; i++ {
+				Expect(creator.IPPool.Acquire()).NotTo(Equal("1.2.3.4"))
+			}
+		})
+
+		It("takes the container's IPv6 address out of the IPv6 pool", func() {
+			info.NetworkSettings.GlobalIPv6Address = "fd00:254::2"
+
+			var err error
+			creator.IPv6Pool, err = NewIPPool("fd00:254::/125")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < 5; i++ {
+				Expect(creator.IPv6Pool.Acquire()).NotTo(Equal("fd00:254::2"))
+			}
+		})
+
+		Context("when the depot directory has metadata", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(depotDir, MetadataFile), []byte(`{
+					"handle": "some-handle",
+					"docker_id": "some-docker-id",
+					"rootfs": "docker:///busybox#1.0",
+					"properties": {"app": "api"},
+					"port_mappings": [{"HostPort": 100, "ContainerPort": 8080}],
+					"limits": {"disk": {"byte_hard": 5000}}
+				}`), 0600)).To(Succeed())
+			})
+
+			It("rebuilds the container from it", func() {
+				containers, err := creator.Restore(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containers).To(HaveLen(1))
+
+				container := containers[0]
+				Expect(container.Spec.RootFSPath).To(Equal("docker:///busybox#1.0"))
+				Expect(container.GetProperties()).To(HaveKeyWithValue("app", "api"))
+				Expect(container.GetProperties()).NotTo(HaveKey("instance"))
+				Expect(container.PortMappings()).To(Equal([]garden.PortMapping{{HostPort: 100, ContainerPort: 8080}}))
+
+				disk, err := container.CurrentDiskLimits()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(disk.ByteHard).To(Equal(uint64(5000)))
+
+				port, err := creator.PortPool.Acquire()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(port).NotTo(Equal(uint32(100)))
+			})
+
+			Context("which belongs to another docker container", func() {
+				BeforeEach(func() {
+					info.ID = "another-docker-id"
+				})
+
+				It("skips it and logs the failure", func() {
+					containers, err := creator.Restore(logger)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(containers).To(BeEmpty())
+					Expect(logger.LogMessages()).To(ConsistOf("restore.restore-container-failed"))
+				})
+			})
+		})
+
+		It("saves metadata for containers restored without it", func() {
+			_, err := creator.Restore(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			metadata, err := ReadMetadata(depotDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.Handle).To(Equal("some-handle"))
+			Expect(metadata.DockerID).To(Equal("some-docker-id"))
+			Expect(metadata.Properties).To(HaveKeyWithValue("app", "web"))
+		})
+
+		Context("when a container has no depot directory", func() {
+			BeforeEach(func() {
+				info.Mounts = nil
+			})
+
+			It("skips it and logs the failure", func() {
+				containers, err := creator.Restore(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containers).To(BeEmpty())
+				Expect(logger.LogMessages()).To(ConsistOf("restore.restore-container-failed"))
+			})
+		})
+
+		Context("when the containers cannot be listed", func() {
+			BeforeEach(func() {
+				dockerRunner.PsReturns(nil, errors.New("boom"))
+			})
+
+			It("returns an error", func() {
+				_, err := creator.Restore(logger)
+				Expect(err).To(MatchError("restore: list containers: boom"))
+			})
+		})
+	})
+})
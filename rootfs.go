@@ -0,0 +1,316 @@
+package gardendocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// Rootfs URI schemes. A docker+privileged URI names an image in the same way
+// as a docker URI, but also asks for the container to be privileged, for
+// clients which can only set the rootfs.
+const (
+	DockerScheme           = "docker"
+	DockerPrivilegedScheme = "docker+privileged"
+)
+
+// RootfsDigestProperty is the container property recording the digest of
+// the image the container was created from, so that clients can see exactly
+// which image a tag resolved to.
+const RootfsDigestProperty = "garden-docker.rootfs-digest"
+
+var (
+	tagPattern    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^[a-z0-9]+([.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+)
+
+// rootfs is the image named by a rootfs URI. A tag can be given docker-style
+// (docker:///repo:tag) or as the URI's fragment (docker:///repo#tag), and a
+// digest as docker:///repo@sha256:...; Image is the reference docker is given,
+// with the tag or digest.
+type rootfs struct {
+	Image      string
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+	Privileged bool
+}
+
+func parseRootfs(path string) (rootfs, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return rootfs{}, fmt.Errorf("not a valid rootfs path: %s", err)
+	}
+
+	var r rootfs
+	switch u.Scheme {
+	case DockerScheme:
+	case DockerPrivilegedScheme:
+		r.Privileged = true
+	default:
+		return rootfs{}, fmt.Errorf("unsupported rootfs scheme %q", u.Scheme)
+	}
+
+	if r.Image = strings.TrimPrefix(u.Path, "/"); r.Image == "" {
+		return rootfs{}, fmt.Errorf("rootfs path %q does not name an image", path)
+	}
+
+	if u.Host != "" {
+		r.Registry = u.Host
+		r.Image = u.Host + "/" + r.Image
+	}
+
+	r.Repository, r.Tag, r.Digest = splitImage(r.Image)
+	if u.Fragment != "" {
+		if r.Tag != "" || r.Digest != "" {
+			return rootfs{}, fmt.Errorf("rootfs path %q gives a tag both in the image and as a fragment", path)
+		}
+
+		r.Tag = u.Fragment
+		r.Image += ":" + u.Fragment
+	}
+
+	if r.Tag != "" && !tagPattern.MatchString(r.Tag) {
+		return rootfs{}, fmt.Errorf("rootfs path %q has an invalid tag %q", path, r.Tag)
+	}
+
+	if r.Digest != "" && !digestPattern.MatchString(r.Digest) {
+		return rootfs{}, fmt.Errorf("rootfs path %q has an invalid digest %q", path, r.Digest)
+	}
+
+	return r, nil
+}
+
+// splitImage splits an image reference into its repository, tag and digest.
+// A colon before the last slash separates a registry's port, not a tag.
+func splitImage(image string) (repository, tag, digest string) {
+	repository = image
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, digest = repository[:i], repository[i+1:]
+	}
+
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+
+	return repository, tag, digest
+}
+
+// resolvedDigest returns the digest of the image the rootfs resolved to: the
+// one it was pinned to, or else the one docker recorded when pulling it from
+// the rootfs's repository. Images which were never pulled from a registry
+// have none.
+func (r rootfs) resolvedDigest(info dockercli.ImageJSON) string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	for _, repoDigest := range info.RepoDigests {
+		if i := strings.Index(repoDigest, "@"); i >= 0 && repoDigest[:i] == r.Repository {
+			return repoDigest[i+1:]
+		}
+	}
+
+	return ""
+}
+
+// ImageRef is how newer garden clients name a container's image: a URI,
+// given instead of the RootFSPath, and credentials to pull it with. The
+// vendored garden API predates it, so it is passed in the Image*Property
+// container properties.
+type ImageRef struct {
+	URI      string
+	Username string
+	Password string
+}
+
+const (
+	ImageURIProperty      = "garden-docker.image.uri"
+	ImageUsernameProperty = "garden-docker.image.username"
+	ImagePasswordProperty = "garden-docker.image.password"
+)
+
+// imageRef reads the ImageRef from a container's properties, returning the
+// properties without the credentials so that they are never reported back by
+// Info or GetProperties.
+func imageRef(props garden.Properties) (ImageRef, garden.Properties) {
+	ref := ImageRef{
+		URI:      props[ImageURIProperty],
+		Username: props[ImageUsernameProperty],
+		Password: props[ImagePasswordProperty],
+	}
+
+	if ref.Username == "" && ref.Password == "" {
+		return ref, props
+	}
+
+	rest := garden.Properties{}
+	for k, v := range props {
+		if k != ImageUsernameProperty && k != ImagePasswordProperty {
+			rest[k] = v
+		}
+	}
+
+	return ref, rest
+}
+
+// RegistryCredential is a username and password to log in to a registry
+// with.
+type RegistryCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DockerHubRegistry is the key under which RegistryCredentials holds the
+// credentials for images named without a registry.
+const DockerHubRegistry = "docker.io"
+
+// RegistryCredentials holds the credentials operators configure for private
+// registries, by registry host, for example:
+//
+//	{"registry.internal:5000": {"username": "garden", "password": "secret"}}
+//
+// They are used to pull every image from that registry, unless a container
+// brings credentials of its own in its ImageRef.
+type RegistryCredentials map[string]RegistryCredential
+
+func LoadRegistryCredentials(path string) (RegistryCredentials, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load registry credentials: %s", err)
+	}
+
+	var creds RegistryCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("load registry credentials: %s", err)
+	}
+
+	for registry, cred := range creds {
+		if cred.Username == "" {
+			return nil, fmt.Errorf("load registry credentials: registry %q has no username", registry)
+		}
+	}
+
+	return creds, nil
+}
+
+// For returns the credentials for a registry, where "" is docker hub. It is
+// safe to call on nil RegistryCredentials.
+func (creds RegistryCredentials) For(registry string) (RegistryCredential, bool) {
+	if registry == "" {
+		registry = DockerHubRegistry
+	}
+
+	cred, ok := creds[registry]
+	return cred, ok
+}
+
+// RootfsRewrite replaces the prefix From of a rootfs URI with To.
+type RootfsRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RootfsRewrites is a table of rewrites applied to every rootfs URI on the
+// way in, so that operators can transparently redirect images, for example
+// to an internal mirror:
+//
+//	[{"from": "docker:///cloudfoundry/", "to": "docker://registry.internal/cf/"}]
+//
+// When several rewrites match, the one with the longest From wins.
+type RootfsRewrites []RootfsRewrite
+
+func LoadRootfsRewrites(path string) (RootfsRewrites, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load rootfs rewrites: %s", err)
+	}
+
+	var rewrites RootfsRewrites
+	if err := json.Unmarshal(data, &rewrites); err != nil {
+		return nil, fmt.Errorf("load rootfs rewrites: %s", err)
+	}
+
+	for _, r := range rewrites {
+		if r.From == "" {
+			return nil, fmt.Errorf("load rootfs rewrites: rewrite to %q has no from", r.To)
+		}
+	}
+
+	return rewrites, nil
+}
+
+func (rewrites RootfsRewrites) Rewrite(uri string) string {
+	var match *RootfsRewrite
+	for i, r := range rewrites {
+		if strings.HasPrefix(uri, r.From) && (match == nil || len(r.From) > len(match.From)) {
+			match = &rewrites[i]
+		}
+	}
+
+	if match == nil {
+		return uri
+	}
+
+	return match.To + strings.TrimPrefix(uri, match.From)
+}
+
+// TenantRootfs maps tenants, identified by the value of a container property
+// such as an org or space guid, to the rootfs their containers get when they
+// do not ask for one.
+type TenantRootfs struct {
+	Property string            `json:"property"`
+	Rootfses map[string]string `json:"rootfses"`
+}
+
+// LoadTenantRootfs reads a TenantRootfs from a JSON file of the form
+//
+//	{"property": "space_guid", "rootfses": {"some-guid": "docker:///some/image"}}
+//
+// and checks that each rootfs is valid.
+func LoadTenantRootfs(path string) (*TenantRootfs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load tenant rootfses: %s", err)
+	}
+
+	var t TenantRootfs
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("load tenant rootfses: %s", err)
+	}
+
+	if t.Property == "" {
+		return nil, fmt.Errorf("load tenant rootfses: no property given")
+	}
+
+	for tenant, path := range t.Rootfses {
+		if _, err := parseRootfs(path); err != nil {
+			return nil, fmt.Errorf("load tenant rootfses: tenant %s: %s", tenant, err)
+		}
+	}
+
+	return &t, nil
+}
+
+// DefaultFor returns the default rootfs for the tenant named in props, if
+// there is one. It is safe to call on a nil TenantRootfs.
+func (t *TenantRootfs) DefaultFor(props garden.Properties) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+
+	tenant, ok := props[t.Property]
+	if !ok {
+		return "", false
+	}
+
+	rootfs, ok := t.Rootfses[tenant]
+	return rootfs, ok
+}
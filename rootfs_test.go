@@ -0,0 +1,183 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TenantRootfs", func() {
+	Describe("LoadTenantRootfs", func() {
+		var path string
+
+		writeConfig := func(config string) {
+			f, err := ioutil.TempFile("", "tenant-rootfs")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			_, err = f.WriteString(config)
+			Expect(err).NotTo(HaveOccurred())
+			path = f.Name()
+		}
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads the mapping from a JSON file", func() {
+			writeConfig(`{"property": "space", "rootfses": {"a": "docker:///image-a"}}`)
+
+			t, err := gardendocker.LoadTenantRootfs(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t).To(Equal(&gardendocker.TenantRootfs{
+				Property: "space",
+				Rootfses: map[string]string{"a": "docker:///image-a"},
+			}))
+		})
+
+		Context("when a rootfs is invalid", func() {
+			It("returns an error", func() {
+				writeConfig(`{"property": "space", "rootfses": {"a": "/some/dir"}}`)
+
+				_, err := gardendocker.LoadTenantRootfs(path)
+				Expect(err).To(MatchError(`load tenant rootfses: tenant a: unsupported rootfs scheme ""`))
+			})
+		})
+
+		Context("when no property is given", func() {
+			It("returns an error", func() {
+				writeConfig(`{"rootfses": {}}`)
+
+				_, err := gardendocker.LoadTenantRootfs(path)
+				Expect(err).To(MatchError("load tenant rootfses: no property given"))
+			})
+		})
+
+		Context("when the file does not exist", func() {
+			It("returns an error", func() {
+				_, err := gardendocker.LoadTenantRootfs("/does/not/exist")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("DefaultFor", func() {
+		t := &gardendocker.TenantRootfs{
+			Property: "space",
+			Rootfses: map[string]string{"a": "docker:///image-a"},
+		}
+
+		It("returns the rootfs of the tenant named in the properties", func() {
+			rootfs, ok := t.DefaultFor(garden.Properties{"space": "a"})
+			Expect(ok).To(BeTrue())
+			Expect(rootfs).To(Equal("docker:///image-a"))
+		})
+
+		It("returns nothing for unknown tenants", func() {
+			_, ok := t.DefaultFor(garden.Properties{"space": "b"})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns nothing when the property is not set", func() {
+			_, ok := t.DefaultFor(garden.Properties{})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns nothing when there is no mapping", func() {
+			var none *gardendocker.TenantRootfs
+			_, ok := none.DefaultFor(garden.Properties{"space": "a"})
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("RootfsRewrites", func() {
+	rewrites := gardendocker.RootfsRewrites{
+		{From: "docker:///cloudfoundry/", To: "docker://registry.internal/cf/"},
+		{From: "docker:///cloudfoundry/special", To: "docker://special.internal/special"},
+	}
+
+	It("replaces a matching prefix", func() {
+		Expect(rewrites.Rewrite("docker:///cloudfoundry/cflinuxfs2")).To(Equal("docker://registry.internal/cf/cflinuxfs2"))
+	})
+
+	It("prefers the longest matching prefix", func() {
+		Expect(rewrites.Rewrite("docker:///cloudfoundry/special:v1")).To(Equal("docker://special.internal/special:v1"))
+	})
+
+	It("leaves other URIs alone", func() {
+		Expect(rewrites.Rewrite("docker:///busybox")).To(Equal("docker:///busybox"))
+	})
+
+	Describe("LoadRootfsRewrites", func() {
+		var path string
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "rewrites")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			f.WriteString(`[{"from": "docker:///a/", "to": "docker://mirror/a/"}, {"to": "docker:///b"}]`)
+			path = f.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("rejects rewrites with no from", func() {
+			_, err := gardendocker.LoadRootfsRewrites(path)
+			Expect(err).To(MatchError(`load rootfs rewrites: rewrite to "docker:///b" has no from`))
+		})
+	})
+})
+
+var _ = Describe("RegistryCredentials", func() {
+	creds := gardendocker.RegistryCredentials{
+		"registry.example.com":         {Username: "a"},
+		gardendocker.DockerHubRegistry: {Username: "b"},
+	}
+
+	It("returns the credentials for a registry", func() {
+		cred, ok := creds.For("registry.example.com")
+		Expect(ok).To(BeTrue())
+		Expect(cred).To(Equal(gardendocker.RegistryCredential{Username: "a"}))
+	})
+
+	It("returns the docker hub credentials for images named without a registry", func() {
+		cred, ok := creds.For("")
+		Expect(ok).To(BeTrue())
+		Expect(cred).To(Equal(gardendocker.RegistryCredential{Username: "b"}))
+	})
+
+	It("returns nothing for other registries", func() {
+		_, ok := creds.For("elsewhere.example.com")
+		Expect(ok).To(BeFalse())
+	})
+
+	Describe("LoadRegistryCredentials", func() {
+		var path string
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "credentials")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			f.WriteString(`{"registry.example.com": {"username": "a", "password": "p"}, "elsewhere.example.com": {"password": "p"}}`)
+			path = f.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("rejects credentials with no username", func() {
+			_, err := gardendocker.LoadRegistryCredentials(path)
+			Expect(err).To(MatchError(`load registry credentials: registry "elsewhere.example.com" has no username`))
+		})
+	})
+})
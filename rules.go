@@ -0,0 +1,162 @@
+package gardendocker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/pkg/iptables"
+)
+
+// RuleCommentPrefix starts the comment tagging each rule a Chain adds for a
+// container, the rest of which is the container's handle.
+const RuleCommentPrefix = "garden-docker:"
+
+//go:generate counterfeiter . RuleSweeper
+type RuleSweeper interface {
+	// Remove deletes every rule tagged with the handle.
+	Remove(handle string) error
+
+	// Sweep deletes every rule tagged with a handle which is not live, and
+	// returns how many it deleted.
+	Sweep(live map[string]bool) (int, error)
+}
+
+// RuleSweepers is a RuleSweeper which passes each call on to all of its
+// RuleSweepers, carrying on past any which fail.
+type RuleSweepers []RuleSweeper
+
+func (rs RuleSweepers) Remove(handle string) error {
+	var firstErr error
+	for _, r := range rs {
+		if err := r.Remove(handle); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (rs RuleSweepers) Sweep(live map[string]bool) (int, error) {
+	var swept int
+	var firstErr error
+	for _, r := range rs {
+		n, err := r.Sweep(live)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		swept += n
+	}
+
+	return swept, firstErr
+}
+
+// TaggedRules is a RuleSweeper over the tagged rules in the nat and filter
+// tables of iptables, or of ip6tables if IPv6 is set. Rules are found by
+// listing the tables, so a rule is removed even if whatever it was added for
+// (the external IP, say) has since changed.
+type TaggedRules struct {
+	IPv6 bool
+}
+
+func (t *TaggedRules) Remove(handle string) error {
+	_, err := t.remove(func(tag string) bool { return tag == handle })
+	return err
+}
+
+func (t *TaggedRules) Sweep(live map[string]bool) (int, error) {
+	return t.remove(func(tag string) bool { return !live[tag] })
+}
+
+// remove deletes the matching rules of both tables in one RuleSet.
+func (t *TaggedRules) remove(match func(handle string) bool) (int, error) {
+	rules := &RuleSet{IPv6: t.IPv6}
+	for _, table := range []string{"nat", "filter"} {
+		out, err := t.raw("-t", table, "-S")
+		if err != nil {
+			return 0, fmt.Errorf("list %s rules: %s", table, err)
+		}
+
+		for _, line := range strings.Split(string(out), "\n") {
+			if handle, spec, ok := ParseTaggedRule(line); ok && match(handle) {
+				rules.Add(table, append([]string{"-D"}, spec...)...)
+			}
+		}
+	}
+
+	if err := rules.Apply(); err != nil {
+		return 0, fmt.Errorf("remove tagged rules: %s", err)
+	}
+
+	return rules.Len(), nil
+}
+
+func (t *TaggedRules) raw(args ...string) ([]byte, error) {
+	if t.IPv6 {
+		return ip6tables(args...)
+	}
+
+	return iptables.Raw(args...)
+}
+
+// ParseTaggedRule parses a line of `iptables -S` output and, if it appends a
+// rule tagged by a Chain, returns the handle it is tagged with and the rule
+// specification, chain first, for deleting it with -D.
+func ParseTaggedRule(line string) (string, []string, bool) {
+	args := splitRule(line)
+	if len(args) < 2 || args[0] != "-A" {
+		return "", nil, false
+	}
+
+	for i := 1; i < len(args)-1; i++ {
+		if args[i] == "--comment" && strings.HasPrefix(args[i+1], RuleCommentPrefix) {
+			return strings.TrimPrefix(args[i+1], RuleCommentPrefix), args[1:], true
+		}
+	}
+
+	return "", nil, false
+}
+
+// splitRule splits a line of `iptables -S` output into arguments. iptables
+// quotes arguments containing spaces, such as comments, with double quotes,
+// escaping any quotes or backslashes within them.
+func splitRule(line string) []string {
+	var args []string
+	var arg []byte
+	inArg, quoted := false, false
+
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quoted && ch == '\\' && i+1 < len(line):
+			i++
+			arg = append(arg, line[i])
+		case ch == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (ch == ' ' || ch == '\t'):
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		default:
+			arg = append(arg, ch)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
+
+// ruleComment returns the match tagging a rule with a container's handle,
+// or nothing if there is no handle.
+func ruleComment(handle string) []string {
+	if handle == "" {
+		return nil
+	}
+
+	return []string{"-m", "comment", "--comment", RuleCommentPrefix + handle}
+}
@@ -0,0 +1,82 @@
+package gardendocker_test
+
+import (
+	"errors"
+
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rules", func() {
+	Describe("ParseTaggedRule", func() {
+		It("returns the handle and the rule specification of a tagged rule", func() {
+			handle, spec, ok := ParseTaggedRule("-A DOCKER -d 10.0.0.1/32 -p tcp -m tcp --dport 123 -m comment --comment garden-docker:some-handle -j DNAT --to-destination 172.17.0.2:456")
+			Expect(ok).To(BeTrue())
+			Expect(handle).To(Equal("some-handle"))
+			Expect(spec).To(Equal([]string{
+				"DOCKER", "-d", "10.0.0.1/32", "-p", "tcp", "-m", "tcp", "--dport", "123",
+				"-m", "comment", "--comment", "garden-docker:some-handle",
+				"-j", "DNAT", "--to-destination", "172.17.0.2:456",
+			}))
+		})
+
+		It("unquotes comments", func() {
+			handle, spec, ok := ParseTaggedRule(`-A FORWARD -d 172.17.0.2/32 -m comment --comment "garden-docker:a \"quoted\" handle" -j ACCEPT`)
+			Expect(ok).To(BeTrue())
+			Expect(handle).To(Equal(`a "quoted" handle`))
+			Expect(spec).To(ContainElement(`garden-docker:a "quoted" handle`))
+		})
+
+		It("ignores rules without a tag", func() {
+			_, _, ok := ParseTaggedRule("-A DOCKER -m comment --comment something-else -j RETURN")
+			Expect(ok).To(BeFalse())
+
+			_, _, ok = ParseTaggedRule("-A FORWARD -o docker0 -j DOCKER")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("ignores chain policies and definitions", func() {
+			_, _, ok := ParseTaggedRule("-P FORWARD DROP")
+			Expect(ok).To(BeFalse())
+
+			_, _, ok = ParseTaggedRule("-N garden-docker-egress")
+			Expect(ok).To(BeFalse())
+
+			_, _, ok = ParseTaggedRule("")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("RuleSweepers", func() {
+		var first, second *fakes.FakeRuleSweeper
+		var rules RuleSweepers
+
+		BeforeEach(func() {
+			first = new(fakes.FakeRuleSweeper)
+			second = new(fakes.FakeRuleSweeper)
+			rules = RuleSweepers{first, second}
+		})
+
+		It("removes a handle's rules from all of them, even if one fails", func() {
+			first.RemoveReturns(errors.New("iptables says no"))
+
+			Expect(rules.Remove("some-handle")).To(MatchError("iptables says no"))
+			Expect(second.RemoveCallCount()).To(Equal(1))
+			Expect(second.RemoveArgsForCall(0)).To(Equal("some-handle"))
+		})
+
+		It("sweeps all of them, adding up the rules they removed", func() {
+			first.SweepReturns(2, nil)
+			second.SweepReturns(3, nil)
+
+			live := map[string]bool{"some-handle": true}
+			swept, err := rules.Sweep(live)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(swept).To(Equal(5))
+			Expect(first.SweepArgsForCall(0)).To(Equal(live))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package gardendocker
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// RuleSet is a batch of iptables commands, such as {"-A", "FORWARD", "-j",
+// "ACCEPT"}, which Apply hands to iptables-restore (or ip6tables-restore if
+// IPv6 is set) in one go. The xtables lock is taken once for the whole
+// batch rather than once per command, and each table's commands take effect
+// all together or not at all.
+type RuleSet struct {
+	IPv6 bool
+
+	tables []string
+	rules  map[string][][]string
+}
+
+// Add adds a command against the table.
+func (r *RuleSet) Add(table string, args ...string) {
+	if r.rules == nil {
+		r.rules = make(map[string][][]string)
+	}
+
+	if _, ok := r.rules[table]; !ok {
+		r.tables = append(r.tables, table)
+	}
+
+	r.rules[table] = append(r.rules[table], args)
+}
+
+// Len returns the number of commands in the set.
+func (r *RuleSet) Len() int {
+	n := 0
+	for _, rules := range r.rules {
+		n += len(rules)
+	}
+
+	return n
+}
+
+// String returns the set in iptables-restore's format: the commands for
+// each table, in the order the tables were first added to, each table
+// ending with COMMIT.
+func (r *RuleSet) String() string {
+	var buf bytes.Buffer
+	for _, table := range r.tables {
+		fmt.Fprintf(&buf, "*%s\n", table)
+		for _, args := range r.rules[table] {
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = quoteRuleArg(arg)
+			}
+
+			buf.WriteString(strings.Join(quoted, " "))
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString("COMMIT\n")
+	}
+
+	return buf.String()
+}
+
+// Apply runs the commands, leaving the rest of each table as it is. An
+// empty set does nothing.
+func (r *RuleSet) Apply() error {
+	if r.Len() == 0 {
+		return nil
+	}
+
+	restore := "iptables-restore"
+	if r.IPv6 {
+		restore = "ip6tables-restore"
+	}
+
+	cmd := exec.Command(restore, "--noflush", "--wait")
+	cmd.Stdin = strings.NewReader(r.String())
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s (%s)", restore, strings.TrimSpace(string(output)), err)
+	}
+
+	return nil
+}
+
+// quoteRuleArg quotes an argument for iptables-restore if it has spaces or
+// quotes in it, as iptables -S does.
+func quoteRuleArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"\\") {
+		return arg
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,166 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/docker/docker/pkg/iptables"
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RuleSet", func() {
+	It("groups the commands by table, in the order the tables were added", func() {
+		rules := &RuleSet{}
+		rules.Add("nat", "-A", "DOCKER", "-j", "RETURN")
+		rules.Add("filter", "-N", "gd-out-abc")
+		rules.Add("nat", "-A", "POSTROUTING", "-j", "MASQUERADE")
+
+		Expect(rules.Len()).To(Equal(3))
+		Expect(rules.String()).To(Equal(strings.Join([]string{
+			"*nat",
+			"-A DOCKER -j RETURN",
+			"-A POSTROUTING -j MASQUERADE",
+			"COMMIT",
+			"*filter",
+			"-N gd-out-abc",
+			"COMMIT",
+			"",
+		}, "\n")))
+	})
+
+	It("quotes arguments with spaces or quotes in them", func() {
+		rules := &RuleSet{}
+		rules.Add("filter", "-A", "FORWARD", "-m", "comment", "--comment", `garden-docker:a "quoted" handle`, "-j", "ACCEPT")
+
+		Expect(rules.String()).To(ContainSubstring(`--comment "garden-docker:a \"quoted\" handle" -j ACCEPT`))
+	})
+
+	It("does nothing when applied empty", func() {
+		Expect((&RuleSet{}).Apply()).To(Succeed())
+	})
+
+	Describe("IPTablesChain.ForwardRules", func() {
+		It("tags the DNAT, FORWARD and MASQUERADE rules with the handle", func() {
+			chain := &IPTablesChain{Chain: &iptables.Chain{Name: "DOCKER", Bridge: "docker0"}}
+			rules := chain.ForwardRules("some-handle", iptables.Add, net.ParseIP("10.0.0.1"), 123, "tcp", "172.17.0.2", 456)
+
+			Expect(rules.String()).To(Equal(strings.Join([]string{
+				"*nat",
+				"-A DOCKER -p tcp -d 10.0.0.1 --dport 123 -m comment --comment garden-docker:some-handle -j DNAT --to-destination 172.17.0.2:456",
+				"-I POSTROUTING -p tcp -s 172.17.0.2 -d 172.17.0.2 --dport 456 -m comment --comment garden-docker:some-handle -j MASQUERADE",
+				"COMMIT",
+				"*filter",
+				"-I FORWARD ! -i docker0 -o docker0 -p tcp -d 172.17.0.2 --dport 456 -m comment --comment garden-docker:some-handle -j ACCEPT",
+				"COMMIT",
+				"",
+			}, "\n")))
+		})
+	})
+
+	Describe("IPTablesFirewall", func() {
+		var firewall *IPTablesFirewall
+
+		BeforeEach(func() {
+			_, denied, _ := net.ParseCIDR("10.0.0.0/8")
+			firewall = &IPTablesFirewall{DenyNetworks: []*net.IPNet{denied}}
+		})
+
+		It("sets up a container's chain, its denials and the jump to it in one set", func() {
+			Expect(firewall.SetupRules("abc", "172.17.0.2").String()).To(Equal(strings.Join([]string{
+				"*filter",
+				"-N gd-out-abc",
+				"-A gd-out-abc -d 10.0.0.0/8 -j REJECT",
+				"-I garden-docker-egress 1 -s 172.17.0.2 -j gd-out-abc",
+				"COMMIT",
+				"",
+			}, "\n")))
+		})
+
+		It("inserts a NetOut rule's rules last to first, so they end up in order", func() {
+			rules, err := firewall.AllowRules("abc", garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Ports:    []garden.PortRange{garden.PortRangeFromPort(80), garden.PortRangeFromPort(443)},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(rules.String()).To(Equal(strings.Join([]string{
+				"*filter",
+				"-I gd-out-abc 1 -p tcp --dport 443 -j ACCEPT",
+				"-I gd-out-abc 1 -p tcp --dport 80 -j ACCEPT",
+				"COMMIT",
+				"",
+			}, "\n")))
+		})
+	})
+})
+
+// The benchmarks forward ports through stand-in iptables and
+// iptables-restore binaries which, like the real ones, hold the xtables lock
+// while they run, with several goroutines at once as under load. Run them
+// with `go test -run NONE -bench Forward`.
+func BenchmarkForwardOneRuleAtATime(b *testing.B) {
+	benchmarkForward(b, func(rules *RuleSet) error {
+		table := ""
+		for _, line := range strings.Split(rules.String(), "\n") {
+			switch {
+			case strings.HasPrefix(line, "*"):
+				table = line[1:]
+			case line == "COMMIT" || line == "":
+			default:
+				if _, err := iptables.Raw(append([]string{"-t", table}, strings.Fields(line)...)...); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func BenchmarkForwardRuleSet(b *testing.B) {
+	benchmarkForward(b, (*RuleSet).Apply)
+}
+
+func benchmarkForward(b *testing.B, apply func(*RuleSet) error) {
+	if _, err := exec.LookPath("flock"); err != nil {
+		b.Skip("needs flock")
+	}
+
+	bin, err := ioutil.TempDir("", "xtables")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+
+	script := "#!/bin/sh\nexec flock " + filepath.Join(bin, "xtables.lock") + " cat >/dev/null\n"
+	for _, name := range []string{"iptables", "iptables-restore"} {
+		if err := ioutil.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	chain := &IPTablesChain{Chain: &iptables.Chain{Name: "DOCKER", Bridge: "docker0"}}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rules := chain.ForwardRules("some-handle", iptables.Add, net.ParseIP("10.0.0.1"), 123, "tcp", "172.17.0.2", 456)
+			if err := apply(rules); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -1,31 +1,301 @@
 package gardendocker
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
+	"github.com/julz/garden-docker/daemon"
 )
 
 type RunHandler struct {
 	ContainerCmd   ContainerCmder
 	ProcessTracker process_tracker.ProcessTracker
+
+	// InitdSock is the socket of the container's initd, which processes are
+	// signalled and reattached to through.
+	InitdSock string
+
+	// StatePath, if set, is where the last process id is saved, so that ids
+	// are not reused if garden-docker restarts.
+	StatePath string
+
+	// Spool, if set, is sent a copy of the stdout and stderr of every
+	// process.
+	Spool *OutputSpool
+
+	// StopGracePeriod is how long Stop gives processes to exit after
+	// SIGTERM, before they are killed.
+	StopGracePeriod time.Duration
+
+	// Exited, if set, is called with the id and exit status of each process
+	// Run runs once it exits.
+	Exited func(processID uint32, exitStatus int)
+
+	stdinMu sync.Mutex
+	stdin   map[uint32]bool
+
+	idMu          sync.Mutex
+	lastProcessID uint32
 }
 
 //go:generate counterfeiter . ContainerCmder
 type ContainerCmder interface {
-	Cmd(path string, args ...string) *exec.Cmd
+	// Cmd returns a command which runs the process in the container, naming
+	// it processID in the container's initd.
+	Cmd(processID uint32, spec garden.ProcessSpec) (*exec.Cmd, error)
 }
 
+// Run runs a process in the container. Processes get sequential ids, which
+// name them both in the ProcessTracker and in initd, so that signals are sent
+// to the process itself through initd.
 func (c *RunHandler) Run(spec garden.ProcessSpec, io garden.ProcessIO) (garden.Process, error) {
-	cmd := c.ContainerCmd.Cmd(spec.Path, spec.Args...)
-	return c.ProcessTracker.Run(0, cmd, io, spec.TTY, nil)
+	processID, err := c.nextProcessID()
+	if err != nil {
+		return nil, fmt.Errorf("run: %s", err)
+	}
+
+	cmd, err := c.ContainerCmd.Cmd(processID, spec)
+	if err != nil {
+		return nil, fmt.Errorf("run: %s", err)
+	}
+
+	if c.Spool != nil {
+		io.Stdout = tee(io.Stdout, c.Spool)
+		io.Stderr = tee(io.Stderr, c.Spool)
+	}
+
+	signaller := &daemon.Signaller{SocketPath: c.InitdSock, ProcessID: processID}
+
+	process, err := c.ProcessTracker.Run(processID, cmd, io, spec.TTY, signaller)
+	if err != nil {
+		return nil, err
+	}
+
+	c.stdinMu.Lock()
+	c.setStdinWriter(processID, io.Stdin != nil)
+	c.stdinMu.Unlock()
+
+	go func() {
+		status, err := process.Wait()
+
+		c.stdinMu.Lock()
+		c.setStdinWriter(processID, false)
+		c.stdinMu.Unlock()
+
+		if err == nil && c.Exited != nil {
+			c.Exited(processID, status)
+		}
+	}()
+
+	return process, nil
 }
 
+// CloseSpool closes the container's output spool, if it has one.
+func (c *RunHandler) CloseSpool() error {
+	if c.Spool == nil {
+		return nil
+	}
+
+	return c.Spool.Close()
+}
+
+// tee sends a copy of everything written to w to the spool. Spooling is
+// best-effort: a spool which cannot be written to, say because the disk is
+// full, never cuts a client off from its process's output.
+func tee(w, spool io.Writer) io.Writer {
+	spool = bestEffortWriter{spool}
+	if w == nil {
+		return spool
+	}
+
+	return io.MultiWriter(w, spool)
+}
+
+// bestEffortWriter swallows the errors of the writer it wraps.
+type bestEffortWriter struct {
+	w io.Writer
+}
+
+func (b bestEffortWriter) Write(p []byte) (int, error) {
+	b.w.Write(p)
+	return len(p), nil
+}
+
+// Attach adds another client to a running process. Every attached client
+// receives the process's stdout and stderr, but only one client writes to its
+// stdin: the one which ran the process or, failing that, the first to attach
+// with a stdin. Input from several clients is never interleaved, and an
+// observer closing its stdin does not close the process's.
+//
+// A process the ProcessTracker no longer knows, because it has exited or
+// garden-docker has restarted since it was run, is reattached to through
+// initd instead. initd cannot pass such a process stdin, so attaching to it
+// with a stdin fails.
 func (c *RunHandler) Attach(processID uint32, io garden.ProcessIO) (garden.Process, error) {
-	return c.ProcessTracker.Attach(processID, io)
+	c.stdinMu.Lock()
+	defer c.stdinMu.Unlock()
+
+	withStdin := io.Stdin != nil
+	claimed := false
+	if io.Stdin != nil {
+		if c.stdin[processID] {
+			io.Stdin = nil
+		} else {
+			c.setStdinWriter(processID, true)
+			claimed = true
+		}
+	}
+
+	process, err := c.ProcessTracker.Attach(processID, io)
+	if _, unknown := err.(process_tracker.UnknownProcessError); unknown && c.InitdSock != "" {
+		if withStdin {
+			process, err = nil, fmt.Errorf("attach: process %d can only be reattached through initd, which cannot pass it stdin", processID)
+		} else {
+			process, err = c.reattach(processID, io)
+		}
+	}
+
+	if err != nil && claimed {
+		c.setStdinWriter(processID, false)
+	}
+
+	return process, err
 }
 
+// reattach attaches to a process through the container's initd, which keeps
+// a process's recent output and its exit status even once the client which
+// ran it has gone, or garden-docker has restarted, and for a while after it
+// has exited. A process reattached this way has no stdin.
+func (c *RunHandler) reattach(processID uint32, pio garden.ProcessIO) (garden.Process, error) {
+	connector := &unix_socket.Connector{SocketPath: c.InitdSock}
+
+	process, err := daemon.Attach(connector, processID, &pio)
+	if err != nil {
+		return nil, fmt.Errorf("attach: %s", err)
+	}
+
+	return &reattachedProcess{
+		id:        processID,
+		process:   process,
+		signaller: &daemon.Signaller{SocketPath: c.InitdSock, ProcessID: processID},
+	}, nil
+}
+
+// nextProcessID hands out the next process id, saving it to the StatePath.
+func (c *RunHandler) nextProcessID() (uint32, error) {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+
+	id := c.lastProcessID + 1
+	if c.StatePath != "" {
+		data, err := json.Marshal(id)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := writeStateFile(c.StatePath, data); err != nil {
+			return 0, fmt.Errorf("save process id: %s", err)
+		}
+	}
+
+	c.lastProcessID = id
+	return id, nil
+}
+
+// RecoverProcessIDs loads the last process id saved by a previous
+// garden-docker process, so that new processes do not take the ids of
+// processes initd still has.
+func (c *RunHandler) RecoverProcessIDs() error {
+	if c.StatePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("recover process ids: %s", err)
+	}
+
+	var id uint32
+	if err := json.Unmarshal(data, &id); err != nil {
+		return fmt.Errorf("recover process ids: %s", err)
+	}
+
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+
+	c.lastProcessID = id
+	return nil
+}
+
+// setStdinWriter records whether a process has a client writing to its
+// stdin. Processes without one are forgotten, so that the record does not
+// grow with every process run.
+func (c *RunHandler) setStdinWriter(processID uint32, hasWriter bool) {
+	if !hasWriter {
+		delete(c.stdin, processID)
+		return
+	}
+
+	if c.stdin == nil {
+		c.stdin = make(map[uint32]bool)
+	}
+
+	c.stdin[processID] = hasWriter
+}
+
+// reattachedProcess is a process attached to through initd rather than the
+// ProcessTracker.
+type reattachedProcess struct {
+	id        uint32
+	process   *daemon.Process
+	signaller *daemon.Signaller
+}
+
+func (p *reattachedProcess) ID() uint32 {
+	return p.id
+}
+
+func (p *reattachedProcess) Wait() (int, error) {
+	return p.process.Wait()
+}
+
+// SetTTY fails, since initd cannot reattach to a process with a terminal.
+func (p *reattachedProcess) SetTTY(garden.TTYSpec) error {
+	return fmt.Errorf("process %d has no terminal", p.id)
+}
+
+func (p *reattachedProcess) Signal(signal garden.Signal) error {
+	switch signal {
+	case garden.SignalKill:
+		return p.signaller.Signal(syscall.SIGKILL)
+	case garden.SignalTerminate:
+		return p.signaller.Signal(syscall.SIGTERM)
+	default:
+		return fmt.Errorf("unknown signal: %d", signal)
+	}
+}
+
+// Stop stops every process in the container, along with any children they
+// have started, through initd: processes are sent SIGKILL if kill is set, or
+// else SIGTERM followed, after the StopGracePeriod, by SIGKILL.
 func (c *RunHandler) Stop(kill bool) error {
-	panic("not implemented: stop")
+	if err := daemon.Stop(c.InitdSock, kill, c.StopGracePeriod); err != nil {
+		return fmt.Errorf("stop: %s", err)
+	}
+
+	return nil
 }
@@ -1,11 +1,23 @@
 package gardendocker_test
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/container_daemon/unix_socket/fake_connection_handler"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/fake_process_tracker"
+	gfakes "github.com/cloudfoundry-incubator/garden/fakes"
 	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/daemon"
 	"github.com/julz/garden-docker/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -16,21 +28,34 @@ var _ = Describe("RunHandler", func() {
 	var fakeContainerCmder *fakes.FakeContainerCmder
 	var fakeProcessTracker *fake_process_tracker.FakeProcessTracker
 	var container *gardendocker.RunHandler
+	var exit chan struct{}
 
 	BeforeEach(func() {
 		fakeContainerCmder = new(fakes.FakeContainerCmder)
 		fakeProcessTracker = new(fake_process_tracker.FakeProcessTracker)
 
+		exit = make(chan struct{})
+		running := new(gfakes.FakeProcess)
+		running.WaitStub = func() (int, error) {
+			<-exit
+			return 0, nil
+		}
+		fakeProcessTracker.RunReturns(running, nil)
+
 		container = &gardendocker.RunHandler{
 			ContainerCmd:   fakeContainerCmder,
 			ProcessTracker: fakeProcessTracker,
 		}
 	})
 
+	AfterEach(func() {
+		close(exit)
+	})
+
 	Describe("Run", func() {
 		It("spawns the requested program using iodaemon", func() {
-			fakeContainerCmder.CmdStub = func(path string, args ...string) *exec.Cmd {
-				return exec.Command("dosh", append([]string{path}, args...)...)
+			fakeContainerCmder.CmdStub = func(processID uint32, spec garden.ProcessSpec) (*exec.Cmd, error) {
+				return exec.Command("dosh", append([]string{spec.Path}, spec.Args...)...), nil
 			}
 
 			requestedIO := garden.ProcessIO{Stdout: gbytes.NewBuffer()}
@@ -53,7 +78,87 @@ var _ = Describe("RunHandler", func() {
 			Expect(tty).To(Equal(requestedTTY))
 		})
 
-		PIt("requests sequential process ids", func() {})
+		Context("when the command cannot be made", func() {
+			It("returns an error without running anything", func() {
+				fakeContainerCmder.CmdReturns(nil, errors.New("write environment: disk full"))
+
+				_, err := container.Run(garden.ProcessSpec{Path: "some-path"}, garden.ProcessIO{})
+				Expect(err).To(MatchError("run: write environment: disk full"))
+				Expect(fakeProcessTracker.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		It("reports the exit status of the process once it exits", func() {
+			fakeContainerCmder.CmdReturns(exec.Command("dosh"), nil)
+
+			process := new(gfakes.FakeProcess)
+			process.WaitReturns(3, nil)
+			fakeProcessTracker.RunReturns(process, nil)
+
+			exited := make(chan [2]int, 1)
+			container.Exited = func(processID uint32, exitStatus int) {
+				exited <- [2]int{int(processID), exitStatus}
+			}
+
+			_, err := container.Run(garden.ProcessSpec{Path: "some-path"}, garden.ProcessIO{})
+			Expect(err).NotTo(HaveOccurred())
+
+			processID, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Eventually(exited).Should(Receive(Equal([2]int{int(processID), 3})))
+		})
+
+		Context("when the container spools its output", func() {
+			It("sends a copy of stdout and stderr to the spool", func() {
+				dir, err := ioutil.TempDir("", "spool")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(dir)
+
+				container.Spool = &gardendocker.OutputSpool{Path: filepath.Join(dir, "output.log"), MaxBytes: 1024}
+				defer container.CloseSpool()
+
+				stdout := gbytes.NewBuffer()
+				container.Run(garden.ProcessSpec{}, garden.ProcessIO{Stdout: stdout})
+
+				_, _, io, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				io.Stdout.Write([]byte("out "))
+				io.Stderr.Write([]byte("err"))
+
+				Expect(stdout).To(gbytes.Say("out "))
+				Expect(ioutil.ReadFile(filepath.Join(dir, "output.log"))).To(Equal([]byte("out err")))
+			})
+
+			Context("when the spool cannot be written to", func() {
+				It("still sends the output to the client", func() {
+					container.Spool = &gardendocker.OutputSpool{Path: "/does/not/exist/output.log", MaxBytes: 1024}
+
+					stdout := gbytes.NewBuffer()
+					container.Run(garden.ProcessSpec{}, garden.ProcessIO{Stdout: stdout})
+
+					_, _, io, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Expect(io.Stdout.Write([]byte("out"))).To(Equal(3))
+					Expect(io.Stderr.Write([]byte("err"))).To(Equal(3))
+
+					Expect(stdout).To(gbytes.Say("out"))
+				})
+			})
+		})
+
+		It("requests sequential process ids", func() {
+			container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+			container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+
+			first, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			second, _, _, _, _ := fakeProcessTracker.RunArgsForCall(1)
+			Expect(first).To(Equal(uint32(1)))
+			Expect(second).To(Equal(uint32(2)))
+		})
+
+		It("names the process in initd by the same id", func() {
+			container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+
+			processID, _ := fakeContainerCmder.CmdArgsForCall(0)
+			Expect(processID).To(Equal(uint32(1)))
+		})
 	})
 
 	Describe("Attach", func() {
@@ -67,8 +172,267 @@ var _ = Describe("RunHandler", func() {
 			Expect(id).To(Equal(uint32(33)))
 			Expect(io).To(Equal(requestedIO))
 		})
+
+		Context("when several clients attach to the same process", func() {
+			It("sends stdout and stderr to every client", func() {
+				first := garden.ProcessIO{Stdout: gbytes.NewBuffer(), Stderr: gbytes.NewBuffer()}
+				second := garden.ProcessIO{Stdout: gbytes.NewBuffer(), Stderr: gbytes.NewBuffer()}
+
+				container.Attach(0, first)
+				container.Attach(0, second)
+
+				_, io := fakeProcessTracker.AttachArgsForCall(0)
+				Expect(io).To(Equal(first))
+				_, io = fakeProcessTracker.AttachArgsForCall(1)
+				Expect(io).To(Equal(second))
+			})
+
+			Context("and the client which ran the process has a stdin", func() {
+				It("does not pass the attached clients' stdin to the process", func() {
+					container.Run(garden.ProcessSpec{}, garden.ProcessIO{Stdin: strings.NewReader("runner")})
+					container.Attach(1, garden.ProcessIO{Stdin: strings.NewReader("observer")})
+
+					_, io := fakeProcessTracker.AttachArgsForCall(0)
+					Expect(io.Stdin).To(BeNil())
+				})
+
+				It("forgets the process's stdin once it has exited", func() {
+					fakeProcessTracker.RunReturns(new(gfakes.FakeProcess), nil)
+					container.Run(garden.ProcessSpec{}, garden.ProcessIO{Stdin: strings.NewReader("runner")})
+
+					stdin := strings.NewReader("writer")
+					Eventually(func() io.Reader {
+						container.Attach(1, garden.ProcessIO{Stdin: stdin})
+
+						_, pio := fakeProcessTracker.AttachArgsForCall(fakeProcessTracker.AttachCallCount() - 1)
+						return pio.Stdin
+					}).Should(Equal(stdin))
+				})
+			})
+
+			Context("and the client which ran the process has no stdin", func() {
+				BeforeEach(func() {
+					container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+				})
+
+				It("passes only the first attached client's stdin to the process", func() {
+					stdin := strings.NewReader("writer")
+					container.Attach(0, garden.ProcessIO{Stdin: stdin})
+					container.Attach(0, garden.ProcessIO{Stdin: strings.NewReader("observer")})
+
+					_, io := fakeProcessTracker.AttachArgsForCall(0)
+					Expect(io.Stdin).To(Equal(stdin))
+					_, io = fakeProcessTracker.AttachArgsForCall(1)
+					Expect(io.Stdin).To(BeNil())
+				})
+
+				Context("when attaching fails", func() {
+					It("lets a later client write to stdin", func() {
+						fakeProcessTracker.AttachReturns(nil, errors.New("boom"))
+						container.Attach(0, garden.ProcessIO{Stdin: strings.NewReader("failed")})
+
+						fakeProcessTracker.AttachReturns(nil, nil)
+						stdin := strings.NewReader("writer")
+						container.Attach(0, garden.ProcessIO{Stdin: stdin})
+
+						_, io := fakeProcessTracker.AttachArgsForCall(1)
+						Expect(io.Stdin).To(Equal(stdin))
+					})
+				})
+			})
+		})
+
+		Context("when the process tracker does not know the process", func() {
+			var (
+				tmpDir   string
+				listener *daemon.Listener
+				handler  *fake_connection_handler.FakeConnectionHandler
+			)
+
+			BeforeEach(func() {
+				var err error
+				tmpDir, err = ioutil.TempDir("", "initd")
+				Expect(err).NotTo(HaveOccurred())
+
+				container.InitdSock = filepath.Join(tmpDir, "initd.sock")
+				listener = &daemon.Listener{SocketPath: container.InitdSock}
+				Expect(listener.Init()).To(Succeed())
+
+				handler = new(fake_connection_handler.FakeConnectionHandler)
+				go listener.Listen(handler)
+
+				fakeProcessTracker.AttachReturns(nil, process_tracker.UnknownProcessError{ProcessID: 5})
+			})
+
+			AfterEach(func() {
+				listener.Stop()
+				os.RemoveAll(tmpDir)
+			})
+
+			It("reattaches to it through initd", func() {
+				var request daemon.Request
+				handler.HandleStub = func(decoder *json.Decoder) ([]*os.File, error) {
+					Expect(decoder.Decode(&request)).To(Succeed())
+
+					var files []*os.File
+					for _, content := range []string{"", "replayed", "", "\x03"} {
+						r, w, err := os.Pipe()
+						Expect(err).NotTo(HaveOccurred())
+						w.Write([]byte(content))
+						w.Close()
+						files = append(files, r)
+					}
+
+					return files, nil
+				}
+
+				stdout := gbytes.NewBuffer()
+				process, err := container.Attach(5, garden.ProcessIO{Stdout: stdout})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(request).To(Equal(daemon.Request{ProcessID: 5, Attach: true}))
+				Expect(process.ID()).To(Equal(uint32(5)))
+				Expect(process.Wait()).To(Equal(3))
+				Eventually(stdout).Should(gbytes.Say("replayed"))
+			})
+
+			Context("when the client has a stdin", func() {
+				It("fails, since initd cannot pass it to the process", func() {
+					_, err := container.Attach(5, garden.ProcessIO{Stdin: strings.NewReader("input")})
+					Expect(err).To(MatchError("attach: process 5 can only be reattached through initd, which cannot pass it stdin"))
+					Expect(handler.HandleCallCount()).To(Equal(0))
+				})
+
+				It("lets a later client write to stdin", func() {
+					container.Attach(5, garden.ProcessIO{Stdin: strings.NewReader("input")})
+
+					fakeProcessTracker.AttachReturns(nil, nil)
+					stdin := strings.NewReader("writer")
+					container.Attach(5, garden.ProcessIO{Stdin: stdin})
+
+					_, io := fakeProcessTracker.AttachArgsForCall(1)
+					Expect(io.Stdin).To(Equal(stdin))
+				})
+			})
+
+			Context("and neither does initd", func() {
+				It("returns initd's error", func() {
+					handler.HandleStub = func(decoder *json.Decoder) ([]*os.File, error) {
+						var request daemon.Request
+						Expect(decoder.Decode(&request)).To(Succeed())
+						return nil, errors.New("daemon: no process with id 5")
+					}
+
+					_, err := container.Attach(5, garden.ProcessIO{})
+					Expect(err).To(MatchError(ContainSubstring("daemon: no process with id 5")))
+				})
+			})
+		})
 	})
 
-	PIt("adds a signaller to the spawned process", func() {
+	Describe("Stop", func() {
+		var (
+			tmpDir   string
+			listener *daemon.Listener
+			handler  *fake_connection_handler.FakeConnectionHandler
+			request  daemon.Request
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "initd")
+			Expect(err).NotTo(HaveOccurred())
+
+			container.InitdSock = filepath.Join(tmpDir, "initd.sock")
+			container.StopGracePeriod = 5 * time.Second
+			listener = &daemon.Listener{SocketPath: container.InitdSock}
+			Expect(listener.Init()).To(Succeed())
+
+			handler = new(fake_connection_handler.FakeConnectionHandler)
+			handler.HandleStub = func(decoder *json.Decoder) ([]*os.File, error) {
+				Expect(decoder.Decode(&request)).To(Succeed())
+				return nil, nil
+			}
+
+			go listener.Listen(handler)
+		})
+
+		AfterEach(func() {
+			listener.Stop()
+			os.RemoveAll(tmpDir)
+		})
+
+		It("asks initd to stop every process, with the grace period", func() {
+			Expect(container.Stop(false)).To(Succeed())
+			Expect(request).To(Equal(daemon.Request{Stop: true, GracePeriod: 5 * time.Second}))
+		})
+
+		Context("when kill is set", func() {
+			It("asks initd to kill every process", func() {
+				Expect(container.Stop(true)).To(Succeed())
+				Expect(request.Kill).To(BeTrue())
+			})
+		})
+
+		Context("when initd fails", func() {
+			It("returns its error", func() {
+				handler.HandleStub = func(decoder *json.Decoder) ([]*os.File, error) {
+					Expect(decoder.Decode(&request)).To(Succeed())
+					return nil, errors.New("boom")
+				}
+
+				Expect(container.Stop(false)).To(MatchError("stop: boom"))
+			})
+		})
+	})
+
+	Context("when the container has a state path", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "run")
+			Expect(err).NotTo(HaveOccurred())
+
+			container.StatePath = filepath.Join(tmpDir, "processes.json")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		It("carries on from the last process id after a restart", func() {
+			container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+			container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+
+			restored := &gardendocker.RunHandler{
+				ContainerCmd:   fakeContainerCmder,
+				ProcessTracker: fakeProcessTracker,
+				StatePath:      container.StatePath,
+			}
+			Expect(restored.RecoverProcessIDs()).To(Succeed())
+
+			restored.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+			processID, _, _, _, _ := fakeProcessTracker.RunArgsForCall(2)
+			Expect(processID).To(Equal(uint32(3)))
+		})
+
+		Context("when the process id cannot be saved", func() {
+			It("does not run the process", func() {
+				container.StatePath = filepath.Join(tmpDir, "does-not-exist", "processes.json")
+
+				_, err := container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+				Expect(err).To(MatchError(HavePrefix("run: save process id:")))
+				Expect(fakeProcessTracker.RunCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	It("adds a signaller to the spawned process, which signals it through initd", func() {
+		container.InitdSock = "the-initd-sock"
+		container.Run(garden.ProcessSpec{}, garden.ProcessIO{})
+
+		_, _, _, _, signaller := fakeProcessTracker.RunArgsForCall(0)
+		Expect(signaller).To(Equal(&daemon.Signaller{SocketPath: "the-initd-sock", ProcessID: 1}))
 	})
 })
@@ -0,0 +1,57 @@
+package gardendocker
+
+import (
+	"os"
+	"path/filepath"
+)
+
+//go:generate counterfeiter . Scrubber
+type Scrubber interface {
+	Scrub(dir string) error
+}
+
+// ZeroScrubber overwrites every regular file under a directory with zeros,
+// so that a container's data does not remain on disk once it is destroyed.
+type ZeroScrubber struct{}
+
+func (ZeroScrubber) Scrub(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		return zeroFile(path, info.Size())
+	})
+}
+
+func zeroFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zeros := make([]byte, 64*1024)
+	for remaining := size; remaining > 0; {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return err
+		}
+
+		remaining -= n
+	}
+
+	return f.Sync()
+}
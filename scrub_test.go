@@ -0,0 +1,52 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ZeroScrubber", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scrub")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(dir, "nested"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("top secret"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "nested", "secret"), []byte("also secret"), 0600)).To(Succeed())
+		Expect(os.Symlink("/etc/passwd", filepath.Join(dir, "link"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("overwrites every file with zeros, keeping its size", func() {
+		Expect(ZeroScrubber{}.Scrub(dir)).To(Succeed())
+
+		Expect(ioutil.ReadFile(filepath.Join(dir, "secret"))).To(Equal(make([]byte, 10)))
+		Expect(ioutil.ReadFile(filepath.Join(dir, "nested", "secret"))).To(Equal(make([]byte, 11)))
+	})
+
+	It("does not follow symlinks", func() {
+		Expect(ZeroScrubber{}.Scrub(dir)).To(Succeed())
+
+		info, err := os.Lstat(filepath.Join(dir, "link"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+	})
+
+	Context("when the directory does not exist", func() {
+		It("succeeds", func() {
+			Expect(ZeroScrubber{}.Scrub(filepath.Join(dir, "missing"))).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package gardendocker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+// SeccompProfileProperty is the container property naming an alternative
+// seccomp profile in the creator's SeccompProfileDir to run the container
+// with in place of the default.
+const SeccompProfileProperty = "garden-docker.seccomp-profile"
+
+// SeccompUnconfined is the seccomp profile which turns seccomp off.
+const SeccompUnconfined = "unconfined"
+
+// seccompProfile returns the seccomp profile to run an unprivileged container
+// with the given properties under: the profile its SeccompProfileProperty
+// names, or else the creator's SeccompProfile. Empty means docker's default
+// profile. Privileged containers are run without seccomp by docker.
+func (c *DaemonContainerCreator) seccompProfile(props garden.Properties) (string, error) {
+	name, ok := props[SeccompProfileProperty]
+	if !ok {
+		return c.SeccompProfile, nil
+	}
+
+	if c.SeccompProfileDir == "" {
+		return "", fmt.Errorf("alternative seccomp profiles are not enabled")
+	}
+
+	if name == "" || name == "." || name == ".." || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid seccomp profile name %q", name)
+	}
+
+	path := filepath.Join(c.SeccompProfileDir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("seccomp profile %q: %s", name, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("seccomp profile %q is not a file", name)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,80 @@
+package gardendocker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+// ErrSelfTestPending is returned by Ping until the self-test has passed.
+var ErrSelfTestPending = errors.New("self-test has not passed yet")
+
+// SmokeTest runs a tiny container through its whole lifecycle: it creates
+// it, runs `true` in it, maps a port to it and destroys it. It catches a
+// broken docker, iptables or depot setup before real workloads arrive.
+func (b *Backend) SmokeTest() error {
+	container, err := b.Create(garden.ContainerSpec{
+		Handle:     "garden-docker-self-test-" + guid(),
+		Properties: garden.Properties{GraceTimeExemptProperty: "true"},
+	})
+	if err != nil {
+		return fmt.Errorf("self-test: create: %s", err)
+	}
+
+	testErr := smokeTest(container)
+
+	if err := b.Destroy(container.Handle()); err != nil && testErr == nil {
+		testErr = fmt.Errorf("self-test: destroy: %s", err)
+	}
+
+	return testErr
+}
+
+func smokeTest(container garden.Container) error {
+	process, err := container.Run(garden.ProcessSpec{Path: "true"}, garden.ProcessIO{})
+	if err != nil {
+		return fmt.Errorf("self-test: run: %s", err)
+	}
+
+	status, err := process.Wait()
+	if err != nil {
+		return fmt.Errorf("self-test: run: %s", err)
+	}
+
+	if status != 0 {
+		return fmt.Errorf("self-test: run: true exited with status %d", status)
+	}
+
+	if _, _, err := container.NetIn(0, 8080); err != nil {
+		return fmt.Errorf("self-test: net in: %s", err)
+	}
+
+	return nil
+}
+
+// selfTestUntilPassed runs the smoke test every SelfTestInterval until it
+// passes, recording each result for Ping.
+func (b *Backend) selfTestUntilPassed() {
+	for {
+		err := b.SmokeTest()
+
+		b.selfTestMu.Lock()
+		b.selfTestErr = err
+		b.selfTestMu.Unlock()
+
+		if err == nil {
+			b.Logger.Info("self-test-passed")
+			return
+		}
+
+		b.Logger.Error("self-test-failed", err)
+
+		select {
+		case <-time.After(b.SelfTestInterval):
+		case <-b.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package gardendocker_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/fake_process_tracker"
+	gfakes "github.com/cloudfoundry-incubator/garden/fakes"
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Self-test", func() {
+	var backend *gardendocker.Backend
+	var fakeCreator *fakes.FakeCreator
+	var fakeDestroyer *fakes.FakeDestroyer
+	var processTracker *fake_process_tracker.FakeProcessTracker
+	var process *gfakes.FakeProcess
+	var chain *fakes.FakeChain
+
+	BeforeEach(func() {
+		fakeCreator = new(fakes.FakeCreator)
+		fakeDestroyer = new(fakes.FakeDestroyer)
+		processTracker = new(fake_process_tracker.FakeProcessTracker)
+		process = new(gfakes.FakeProcess)
+		chain = new(fakes.FakeChain)
+
+		processTracker.RunReturns(process, nil)
+
+		fakeCreator.CreateStub = func(spec garden.ContainerSpec) (*gardendocker.Container, error) {
+			return &gardendocker.Container{
+				InfoHandler: &gardendocker.InfoHandler{
+					Spec:         spec,
+					PropsHandler: gardendocker.NewPropsHandler(spec.Properties),
+				},
+				ActivityHandler: &gardendocker.ActivityHandler{},
+				RunHandler: &gardendocker.RunHandler{
+					ContainerCmd:   new(fakes.FakeContainerCmder),
+					ProcessTracker: processTracker,
+				},
+				NetHandler: &gardendocker.NetHandler{
+					ContainerIP: "1.2.3.4",
+					Chain:       chain,
+					PortPool:    port_pool.New(1000, 10),
+				},
+			}, nil
+		}
+
+		backend = &gardendocker.Backend{
+			Creator:          fakeCreator,
+			Destroyer:        fakeDestroyer,
+			Repo:             gardendocker.NewRepo(),
+			SelfTestInterval: 10 * time.Millisecond,
+			Logger:           lagertest.NewTestLogger("backend"),
+		}
+	})
+
+	AfterEach(func() {
+		backend.Stop()
+	})
+
+	Describe("SmokeTest", func() {
+		It("creates a container, runs true in it, maps a port and destroys it", func() {
+			Expect(backend.SmokeTest()).To(Succeed())
+
+			Expect(fakeCreator.CreateCallCount()).To(Equal(1))
+			Expect(fakeCreator.CreateArgsForCall(0).Properties).To(HaveKeyWithValue(gardendocker.GraceTimeExemptProperty, "true"))
+
+			Expect(processTracker.RunCallCount()).To(Equal(1))
+			Expect(process.WaitCallCount()).To(Equal(1))
+			Expect(chain.ForwardCallCount()).To(Equal(1))
+
+			Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			Expect(backend.Repo.All()).To(BeEmpty())
+		})
+
+		Context("when the process fails", func() {
+			It("destroys the container and returns an error", func() {
+				process.WaitReturns(1, nil)
+
+				Expect(backend.SmokeTest()).To(MatchError("self-test: run: true exited with status 1"))
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when mapping a port fails", func() {
+			It("destroys the container and returns an error", func() {
+				chain.ForwardReturns(errors.New("iptables is broken"))
+
+				Expect(backend.SmokeTest()).To(MatchError(ContainSubstring("self-test: net in:")))
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when creating the container fails", func() {
+			It("returns an error", func() {
+				fakeCreator.CreateReturns(nil, errors.New("no docker"))
+
+				Expect(backend.SmokeTest()).To(MatchError("self-test: create: no docker"))
+				Expect(fakeDestroyer.DestroyCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Ping", func() {
+		It("succeeds when there is no self-test", func() {
+			Expect(backend.Start()).To(Succeed())
+			Expect(backend.Ping()).To(Succeed())
+		})
+
+		Context("when the self-test is enabled", func() {
+			BeforeEach(func() {
+				backend.SelfTest = true
+			})
+
+			It("fails until the self-test passes", func() {
+				chain.ForwardReturns(errors.New("iptables is broken"))
+				Expect(backend.Start()).To(Succeed())
+
+				Consistently(backend.Ping).ShouldNot(Succeed())
+				Expect(fakeCreator.CreateCallCount()).To(BeNumerically(">", 1))
+
+				chain.ForwardReturns(nil)
+				Eventually(backend.Ping).Should(Succeed())
+			})
+		})
+	})
+})
@@ -0,0 +1,94 @@
+package gardendocker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// UnixSocket is a unix socket the garden API is served on, whose file mode
+// and ownership restrict who may connect to it.
+type UnixSocket struct {
+	Path string
+	Mode os.FileMode
+
+	// UID and GID own the socket; -1 leaves the owner or group as it is
+	// created, garden-docker's own.
+	UID int
+	GID int
+}
+
+// Listen removes any socket left at the path by a previous run, then listens
+// on a new one with the socket's mode and ownership. Until they are set, the
+// socket has the default mode, which a umask of 022 or stricter leaves
+// writable, and so connectable, only by garden-docker's own user.
+func (s UnixSocket) Listen() (net.Listener, error) {
+	if info, err := os.Lstat(s.Path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen: %s exists and is not a socket", s.Path)
+		}
+
+		if err := os.Remove(s.Path); err != nil {
+			return nil, fmt.Errorf("listen: remove stale socket: %s", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %s", err)
+	}
+
+	if s.UID != -1 || s.GID != -1 {
+		if err := os.Chown(s.Path, s.UID, s.GID); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("listen: %s", err)
+		}
+	}
+
+	if err := os.Chmod(s.Path, s.Mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen: %s", err)
+	}
+
+	return listener, nil
+}
+
+// LookupUID returns the id of the named user, which may be given as a
+// number, or -1 for an empty name.
+func LookupUID(name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(u.Uid)
+}
+
+// LookupGID returns the id of the named group, which may be given as a
+// number, or -1 for an empty name.
+func LookupGID(name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(g.Gid)
+}
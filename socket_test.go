@@ -0,0 +1,108 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/julz/garden-docker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UnixSocket", func() {
+	var dir string
+	var socket UnixSocket
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "socket")
+		Expect(err).NotTo(HaveOccurred())
+
+		socket = UnixSocket{Path: filepath.Join(dir, "garden.sock"), Mode: 0660, UID: -1, GID: -1}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("listens on the socket with its mode", func() {
+		listener, err := socket.Listen()
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		info, err := os.Stat(socket.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode() & os.ModeSocket).NotTo(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0660)))
+
+		conn, err := net.Dial("unix", socket.Path)
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+	})
+
+	It("gives the socket to its owner and group", func() {
+		socket.UID, socket.GID = os.Getuid(), os.Getgid()
+
+		listener, err := socket.Listen()
+		Expect(err).NotTo(HaveOccurred())
+		listener.Close()
+	})
+
+	Context("when a previous run left its socket behind", func() {
+		BeforeEach(func() {
+			stale, err := net.Listen("unix", socket.Path)
+			Expect(err).NotTo(HaveOccurred())
+
+			// leave the file behind, as a crash would
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			stale.Close()
+		})
+
+		It("replaces it", func() {
+			listener, err := socket.Listen()
+			Expect(err).NotTo(HaveOccurred())
+			listener.Close()
+		})
+	})
+
+	Context("when something other than a socket is at the path", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(socket.Path, []byte("important"), 0600)).To(Succeed())
+		})
+
+		It("leaves it alone and fails", func() {
+			_, err := socket.Listen()
+			Expect(err).To(MatchError(ContainSubstring("is not a socket")))
+
+			Expect(ioutil.ReadFile(socket.Path)).To(Equal([]byte("important")))
+		})
+	})
+})
+
+var _ = Describe("LookupUID and LookupGID", func() {
+	It("are -1 for an empty name", func() {
+		Expect(LookupUID("")).To(Equal(-1))
+		Expect(LookupGID("")).To(Equal(-1))
+	})
+
+	It("take numeric ids as they are", func() {
+		Expect(LookupUID("1234")).To(Equal(1234))
+		Expect(LookupGID("5678")).To(Equal(5678))
+	})
+
+	It("look up names", func() {
+		Expect(LookupUID("root")).To(Equal(0))
+		Expect(LookupGID("root")).To(Equal(0))
+	})
+
+	It("fail for unknown names", func() {
+		_, err := LookupUID("no-such-user-here")
+		Expect(err).To(HaveOccurred())
+
+		_, err = LookupGID("no-such-group-here")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,115 @@
+package gardendocker
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// OutputSpool keeps a copy of the output of a container's processes on disk,
+// within a quota. Output is written to Path until it holds half of MaxBytes,
+// at which point it is rotated to Path.1 (replacing any earlier rotation) and
+// a fresh file is started with a marker noting that earlier output was
+// dropped. The spool therefore never holds more than MaxBytes, plus the
+// marker.
+type OutputSpool struct {
+	Path     string
+	MaxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// TruncationMarker starts every spool file after the first, to show that
+// earlier output was dropped to stay within the quota.
+const TruncationMarker = "[garden-docker: earlier output dropped, log quota reached]\n"
+
+func (s *OutputSpool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(p)
+	limit := s.MaxBytes / 2
+	if limit < 1 {
+		limit = 1
+	}
+
+	for len(p) > 0 {
+		if s.file == nil {
+			if err := s.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		room := limit - s.size
+		if room <= 0 {
+			if err := s.rotate(); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		chunk := p
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+
+		written, err := s.file.Write(chunk)
+		s.size += int64(written)
+		if err != nil {
+			return 0, err
+		}
+
+		p = p[written:]
+	}
+
+	return n, nil
+}
+
+func (s *OutputSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *OutputSpool) open() error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("spool: %s", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("spool: %s", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *OutputSpool) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	if err := os.Rename(s.Path, s.Path+".1"); err != nil {
+		return fmt.Errorf("spool: rotate: %s", err)
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	_, err := s.file.WriteString(TruncationMarker)
+	return err
+}
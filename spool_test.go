@@ -0,0 +1,85 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OutputSpool", func() {
+	var dir string
+	var spool *gardendocker.OutputSpool
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "spool")
+		Expect(err).NotTo(HaveOccurred())
+
+		spool = &gardendocker.OutputSpool{
+			Path:     filepath.Join(dir, "output.log"),
+			MaxBytes: 20,
+		}
+	})
+
+	AfterEach(func() {
+		spool.Close()
+		os.RemoveAll(dir)
+	})
+
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	It("writes output to the file", func() {
+		n, err := spool.Write([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(5))
+
+		Expect(read("output.log")).To(Equal("hello"))
+	})
+
+	Context("when the output goes over half the quota", func() {
+		BeforeEach(func() {
+			_, err := spool.Write([]byte("0123456789abcde"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rotates the file, starting the new one with a truncation marker", func() {
+			Expect(read("output.log.1")).To(Equal("0123456789"))
+			Expect(read("output.log")).To(Equal(gardendocker.TruncationMarker + "abcde"))
+		})
+
+		It("drops the oldest output when rotating again", func() {
+			_, err := spool.Write([]byte("fghijklmno"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(read("output.log.1")).To(Equal(gardendocker.TruncationMarker + "abcdefghij"))
+			Expect(read("output.log")).To(Equal(gardendocker.TruncationMarker + "klmno"))
+		})
+	})
+
+	It("never keeps more than the quota (plus markers) on disk", func() {
+		for i := 0; i < 100; i++ {
+			spool.Write([]byte(strings.Repeat("x", 7)))
+		}
+
+		size := len(read("output.log")) + len(read("output.log.1"))
+		Expect(size).To(BeNumerically("<=", 20+2*len(gardendocker.TruncationMarker)))
+	})
+
+	Context("when the spool file already has output in it", func() {
+		It("counts it towards the quota", func() {
+			Expect(ioutil.WriteFile(spool.Path, []byte("0123456789"), 0600)).To(Succeed())
+
+			spool.Write([]byte("a"))
+			Expect(read("output.log.1")).To(Equal("0123456789"))
+		})
+	})
+})
@@ -0,0 +1,270 @@
+package gardendocker
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/julz/garden-docker/dockercli"
+)
+
+//go:generate counterfeiter . ContainerStats
+type ContainerStats interface {
+	Memory() (garden.ContainerMemoryStat, error)
+	CPU() (garden.ContainerCPUStat, error)
+
+	// OOMKills returns how many processes in the container have been killed
+	// for running out of memory.
+	OOMKills() (uint64, error)
+}
+
+// userHZ is the unit of the cgroup v1 cpuacct.stat times.
+const userHZ = 100
+
+// CgroupStats reads a docker container's memory and cpu usage from its
+// cgroups, found through the /proc/<pid>/cgroup of its init process. Both
+// cgroup v1 and the unified v2 hierarchy are supported. A container which is
+// not running uses no memory or cpu, so its stats are all zero.
+type CgroupStats struct {
+	DockerRunner DockerRunner
+	DockerID     string
+
+	// CgroupRoot and ProcRoot default to /sys/fs/cgroup and /proc.
+	CgroupRoot string
+	ProcRoot   string
+}
+
+func (s *CgroupStats) Memory() (garden.ContainerMemoryStat, error) {
+	var stat garden.ContainerMemoryStat
+
+	dir, v2, err := s.dir("memory")
+	if err != nil || dir == "" {
+		return stat, err
+	}
+
+	values, err := readKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return stat, err
+	}
+
+	fields := map[string]*uint64{
+		"pgfault":       &stat.Pgfault,
+		"pgmajfault":    &stat.Pgmajfault,
+		"inactive_anon": &stat.InactiveAnon,
+		"active_anon":   &stat.ActiveAnon,
+		"inactive_file": &stat.InactiveFile,
+		"active_file":   &stat.ActiveFile,
+		"unevictable":   &stat.Unevictable,
+	}
+
+	if v2 {
+		// v2 has no hierarchical totals, since a container's cgroup has no
+		// children, and names some counters differently
+		fields["anon"] = &stat.Rss
+		fields["file"] = &stat.Cache
+		fields["file_mapped"] = &stat.MappedFile
+	} else {
+		for k, v := range map[string]*uint64{
+			"cache":                     &stat.Cache,
+			"rss":                       &stat.Rss,
+			"mapped_file":               &stat.MappedFile,
+			"pgpgin":                    &stat.Pgpgin,
+			"pgpgout":                   &stat.Pgpgout,
+			"swap":                      &stat.Swap,
+			"hierarchical_memory_limit": &stat.HierarchicalMemoryLimit,
+			"hierarchical_memsw_limit":  &stat.HierarchicalMemswLimit,
+			"total_cache":               &stat.TotalCache,
+			"total_rss":                 &stat.TotalRss,
+			"total_mapped_file":         &stat.TotalMappedFile,
+			"total_pgpgin":              &stat.TotalPgpgin,
+			"total_pgpgout":             &stat.TotalPgpgout,
+			"total_swap":                &stat.TotalSwap,
+			"total_pgfault":             &stat.TotalPgfault,
+			"total_pgmajfault":          &stat.TotalPgmajfault,
+			"total_inactive_anon":       &stat.TotalInactiveAnon,
+			"total_active_anon":         &stat.TotalActiveAnon,
+			"total_inactive_file":       &stat.TotalInactiveFile,
+			"total_active_file":         &stat.TotalActiveFile,
+			"total_unevictable":         &stat.TotalUnevictable,
+		} {
+			fields[k] = v
+		}
+	}
+
+	for k, field := range fields {
+		*field = values[k]
+	}
+
+	if v2 {
+		stat.TotalCache, stat.TotalRss, stat.TotalMappedFile = stat.Cache, stat.Rss, stat.MappedFile
+		stat.TotalPgfault, stat.TotalPgmajfault = stat.Pgfault, stat.Pgmajfault
+		stat.TotalInactiveAnon, stat.TotalActiveAnon = stat.InactiveAnon, stat.ActiveAnon
+		stat.TotalInactiveFile, stat.TotalActiveFile = stat.InactiveFile, stat.ActiveFile
+		stat.TotalUnevictable = stat.Unevictable
+	}
+
+	return stat, nil
+}
+
+func (s *CgroupStats) CPU() (garden.ContainerCPUStat, error) {
+	dir, v2, err := s.dir("cpuacct")
+	if err != nil || dir == "" {
+		return garden.ContainerCPUStat{}, err
+	}
+
+	if v2 {
+		values, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+		if err != nil {
+			return garden.ContainerCPUStat{}, err
+		}
+
+		return garden.ContainerCPUStat{
+			Usage:  values["usage_usec"] * 1000,
+			User:   values["user_usec"] * 1000,
+			System: values["system_usec"] * 1000,
+		}, nil
+	}
+
+	usage, err := ioutil.ReadFile(filepath.Join(dir, "cpuacct.usage"))
+	if err != nil {
+		return garden.ContainerCPUStat{}, err
+	}
+
+	total, err := strconv.ParseUint(strings.TrimSpace(string(usage)), 10, 64)
+	if err != nil {
+		return garden.ContainerCPUStat{}, fmt.Errorf("parse cpuacct.usage: %s", err)
+	}
+
+	values, err := readKeyValues(filepath.Join(dir, "cpuacct.stat"))
+	if err != nil {
+		return garden.ContainerCPUStat{}, err
+	}
+
+	return garden.ContainerCPUStat{
+		Usage:  total,
+		User:   values["user"] * (1e9 / userHZ),
+		System: values["system"] * (1e9 / userHZ),
+	}, nil
+}
+
+// OOMKills reads the oom_kill count from the memory cgroup's
+// memory.oom_control, or its v2 memory.events. Once the container has
+// stopped its cgroup is gone, so all that is known is whether docker saw its
+// init process killed for running out of memory, which counts as one kill.
+func (s *CgroupStats) OOMKills() (uint64, error) {
+	dir, v2, err := s.dir("memory")
+	if err != nil {
+		return 0, err
+	}
+
+	if dir == "" {
+		info, err := s.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: s.DockerID})
+		if err != nil || !info.State.OOMKilled {
+			return 0, err
+		}
+
+		return 1, nil
+	}
+
+	file := "memory.oom_control"
+	if v2 {
+		file = "memory.events"
+	}
+
+	values, err := readKeyValues(filepath.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+
+	return values["oom_kill"], nil
+}
+
+// dir returns the container's cgroup directory for a v1 controller, or its
+// v2 cgroup directory if it is in the unified hierarchy, or "" if the
+// container is not running.
+func (s *CgroupStats) dir(controller string) (string, bool, error) {
+	cgroupRoot, procRoot := s.CgroupRoot, s.ProcRoot
+	if cgroupRoot == "" {
+		cgroupRoot = "/sys/fs/cgroup"
+	}
+
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+
+	info, err := s.DockerRunner.Inspect(dockercli.InspectCmd{ContainerID: s.DockerID})
+	if err != nil {
+		return "", false, err
+	}
+
+	if !info.State.Running || info.State.Pid == 0 {
+		return "", false, nil
+	}
+
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(info.State.Pid), "cgroup"))
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	unified := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-id:controller,controller:path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			continue
+		}
+
+		for _, c := range strings.Split(parts[1], ",") {
+			if c == controller {
+				return filepath.Join(cgroupRoot, controller, parts[2]), false, nil
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", false, err
+	}
+
+	if unified != "" {
+		return filepath.Join(cgroupRoot, unified), true, nil
+	}
+
+	return "", false, fmt.Errorf("no %s cgroup for container %s", controller, s.DockerID)
+}
+
+// readKeyValues parses a cgroup file of "key value" lines.
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+
+	return values, scanner.Err()
+}
@@ -0,0 +1,178 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+	. "github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CgroupStats", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var root string
+	var stats *CgroupStats
+
+	write := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, path), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "cgroups")
+		Expect(err).NotTo(HaveOccurred())
+
+		info := dockercli.ContainerJSON{}
+		info.State.Running = true
+		info.State.Pid = 42
+
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.InspectReturns(info, nil)
+
+		stats = &CgroupStats{
+			DockerRunner: dockerRunner,
+			DockerID:     "some-docker-id",
+			CgroupRoot:   filepath.Join(root, "cgroup"),
+			ProcRoot:     filepath.Join(root, "proc"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Context("with cgroup v1", func() {
+		BeforeEach(func() {
+			write("proc/42/cgroup", "4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n")
+			write("cgroup/memory/docker/abc/memory.stat", "cache 10\nrss 20\nhierarchical_memory_limit 100\ntotal_rss 21\n")
+			write("cgroup/cpuacct/docker/abc/cpuacct.usage", "5000000000\n")
+			write("cgroup/cpuacct/docker/abc/cpuacct.stat", "user 300\nsystem 100\n")
+		})
+
+		It("reads memory.stat", func() {
+			memory, err := stats.Memory()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(memory.Cache).To(Equal(uint64(10)))
+			Expect(memory.Rss).To(Equal(uint64(20)))
+			Expect(memory.HierarchicalMemoryLimit).To(Equal(uint64(100)))
+			Expect(memory.TotalRss).To(Equal(uint64(21)))
+		})
+
+		It("reads the cpu usage in nanoseconds", func() {
+			cpu, err := stats.CPU()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cpu).To(Equal(garden.ContainerCPUStat{
+				Usage:  5000000000,
+				User:   3000000000,
+				System: 1000000000,
+			}))
+		})
+
+		It("reads the oom kill count from memory.oom_control", func() {
+			write("cgroup/memory/docker/abc/memory.oom_control", "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n")
+			Expect(stats.OOMKills()).To(BeEquivalentTo(2))
+		})
+
+		It("finds the container's cgroups from the pid docker reports", func() {
+			_, err := stats.Memory()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerRunner.InspectArgsForCall(0).ContainerID).To(Equal("some-docker-id"))
+		})
+	})
+
+	Context("with the unified cgroup v2 hierarchy", func() {
+		BeforeEach(func() {
+			write("proc/42/cgroup", "0::/system.slice/docker-abc.scope\n")
+			write("cgroup/system.slice/docker-abc.scope/memory.stat", "anon 20\nfile 10\nfile_mapped 5\n")
+			write("cgroup/system.slice/docker-abc.scope/cpu.stat", "usage_usec 4000\nuser_usec 3000\nsystem_usec 1000\n")
+		})
+
+		It("maps memory.stat onto the v1 names", func() {
+			memory, err := stats.Memory()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(memory.Rss).To(Equal(uint64(20)))
+			Expect(memory.TotalRss).To(Equal(uint64(20)))
+			Expect(memory.Cache).To(Equal(uint64(10)))
+			Expect(memory.MappedFile).To(Equal(uint64(5)))
+		})
+
+		It("reads the cpu usage in nanoseconds", func() {
+			cpu, err := stats.CPU()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cpu).To(Equal(garden.ContainerCPUStat{
+				Usage:  4000000,
+				User:   3000000,
+				System: 1000000,
+			}))
+		})
+
+		It("reads the oom kill count from memory.events", func() {
+			write("cgroup/system.slice/docker-abc.scope/memory.events", "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n")
+			Expect(stats.OOMKills()).To(BeEquivalentTo(1))
+		})
+	})
+
+	Context("when the container is not running", func() {
+		BeforeEach(func() {
+			dockerRunner.InspectReturns(dockercli.ContainerJSON{}, nil)
+		})
+
+		It("reports no usage", func() {
+			memory, err := stats.Memory()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(memory).To(Equal(garden.ContainerMemoryStat{}))
+
+			cpu, err := stats.CPU()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cpu).To(Equal(garden.ContainerCPUStat{}))
+		})
+
+		It("counts one oom kill if docker says its init process was killed for running out of memory", func() {
+			Expect(stats.OOMKills()).To(BeEquivalentTo(0))
+
+			info := dockercli.ContainerJSON{}
+			info.State.OOMKilled = true
+			dockerRunner.InspectReturns(info, nil)
+			Expect(stats.OOMKills()).To(BeEquivalentTo(1))
+		})
+	})
+
+	Context("when the cgroup files cannot be read", func() {
+		BeforeEach(func() {
+			write("proc/42/cgroup", "4:memory:/docker/abc\n")
+		})
+
+		It("returns an error", func() {
+			_, err := stats.Memory()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("Container Metrics", func() {
+	It("combines the disk, memory and cpu stats", func() {
+		stats := new(fakes.FakeContainerStats)
+		stats.MemoryReturns(garden.ContainerMemoryStat{Rss: 20}, nil)
+		stats.CPUReturns(garden.ContainerCPUStat{Usage: 30}, nil)
+
+		diskUsage := new(fakes.FakeDiskUsage)
+		diskUsage.UsageReturns(10, 110, nil)
+
+		container := &Container{LimitsHandler: &LimitsHandler{Stats: stats, DiskUsage: diskUsage}}
+
+		metrics, err := container.Metrics()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metrics).To(Equal(garden.Metrics{
+			MemoryStat: garden.ContainerMemoryStat{Rss: 20},
+			CPUStat:    garden.ContainerCPUStat{Usage: 30},
+			DiskStat:   garden.ContainerDiskStat{BytesUsed: 110},
+		}))
+	})
+})
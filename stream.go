@@ -1,16 +1,329 @@
 package gardendocker
 
-import "io"
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
 
+	"github.com/julz/garden-docker/dockercli"
+)
+
+// StreamOutCompressionProperty asks for a container's StreamOut tar streams
+// to be compressed. The only supported value is "gzip".
+const StreamOutCompressionProperty = "garden-docker.stream-out-compression"
+
+var ErrStreamingNotSupported = errors.New("streaming files in and out of this container is not supported")
+
+//go:generate counterfeiter . TarStreamer
+type TarStreamer interface {
+	// StreamIn extracts a tar into dir, an absolute path inside the
+	// container, creating it if necessary.
+	StreamIn(dir string, tarStream io.Reader) error
+
+	// StreamOut tars up entry, a file or directory in dir (an absolute path
+	// inside the container), or the contents of dir itself if entry is ".".
+	StreamOut(dir, entry string) (io.ReadCloser, error)
+}
+
+// StreamHandler implements garden-linux's path semantics and the compression
+// of streamed tars, leaving the copying of plain tars in and out of the
+// container to the Streamer.
+//
+// Relative paths are resolved against HomeDir, the home directory of the
+// user streams are made as. A StreamOut path ending in a slash streams the
+// contents of the directory; any other path streams the file or directory
+// itself, so that it is the single top-level entry of the tar.
+//
+// Gzipped tars passed to StreamIn are detected and decompressed; StreamOut
+// compresses its tars if GzipStreamOut is set.
 type StreamHandler struct {
+	Streamer      TarStreamer
+	HomeDir       string
+	GzipStreamOut bool
 }
 
 func (c *StreamHandler) StreamIn(dstPath string, tarStream io.Reader) error {
-	panic("not implemented: streamin")
-	return nil
+	if c.Streamer == nil {
+		return ErrStreamingNotSupported
+	}
+
+	dir := c.resolve(dstPath)
+
+	buffered := bufio.NewReader(tarStream)
+	if magic, err := buffered.Peek(2); err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return c.Streamer.StreamIn(dir, buffered)
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return c.Streamer.StreamIn(dir, gz)
 }
 
 func (c *StreamHandler) StreamOut(srcPath string) (io.ReadCloser, error) {
-	panic("not implemented: streamout")
-	return nil, nil
+	if c.Streamer == nil {
+		return nil, ErrStreamingNotSupported
+	}
+
+	dir, entry := c.resolve(srcPath), "."
+	if !strings.HasSuffix(srcPath, "/") {
+		clean := path.Clean(srcPath)
+		dir, entry = c.resolve(path.Dir(clean)), path.Base(clean)
+	}
+
+	tar, err := c.Streamer.StreamOut(dir, entry)
+	if err != nil || !c.GzipStreamOut {
+		return tar, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(w)
+		_, err := io.Copy(gz, tar)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+
+		tar.Close()
+		w.CloseWithError(err)
+	}()
+
+	return r, nil
+}
+
+func (c *StreamHandler) resolve(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+
+	home := c.HomeDir
+	if home == "" {
+		home = "/"
+	}
+
+	return path.Join(home, p)
+}
+
+// StreamInOwnerProperty gives every file streamed into a container to the
+// given "uid:gid", in place of the owners recorded in the tar, for images
+// whose processes do not run as root.
+const StreamInOwnerProperty = "garden-docker.stream-in-owner"
+
+// Owner is a numeric uid and gid in the container.
+type Owner struct {
+	UID int
+	GID int
+}
+
+func parseOwner(s string) (*Owner, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var owner Owner
+	var rest string
+	if n, _ := fmt.Sscanf(s, "%d:%d%s", &owner.UID, &owner.GID, &rest); n != 2 || owner.UID < 0 || owner.GID < 0 {
+		return nil, fmt.Errorf("invalid stream in owner %q: want uid:gid", s)
+	}
+
+	return &owner, nil
+}
+
+var errCpExited = errors.New("docker cp exited")
+
+// DockerStreamer copies tars in and out of a docker container with docker
+// cp. The tar is rewritten on the way in so that its entries are rooted at
+// the destination directory, which lets docker create the directory if it
+// is missing, and, if Owner is set, so that they belong to Owner.
+//
+// On the way out, docker resolves any symlinks in the path within the
+// container's rootfs, so a link to, say, /etc only ever reaches the
+// container's /etc; a symlink named by the path itself is streamed as a
+// link rather than followed. The tar docker produces is checked as it is
+// streamed so that no entry can be extracted outside of its destination.
+type DockerStreamer struct {
+	DockerRunner DockerRunner
+	DockerID     string
+	Owner        *Owner
+}
+
+func (d *DockerStreamer) StreamIn(dir string, tarStream io.Reader) error {
+	r, w := io.Pipe()
+
+	rewritten := make(chan error, 1)
+	go func() {
+		err := rerootTar(tarStream, w, dir, d.Owner)
+		w.CloseWithError(err)
+		rewritten <- err
+	}()
+
+	err := d.DockerRunner.CpIn(dockercli.CpCmd{Src: "-", Dst: d.DockerID + ":/", Archive: true}, r)
+	r.CloseWithError(errCpExited)
+
+	// a bad tar is the more useful error, unless the rewrite only failed
+	// because docker cp had already given up
+	if rerootErr := <-rewritten; rerootErr != nil && rerootErr != errCpExited {
+		return fmt.Errorf("stream in: %s", rerootErr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("stream in: %s", err)
+	}
+
+	return nil
+}
+
+func (d *DockerStreamer) StreamOut(dir, entry string) (io.ReadCloser, error) {
+	src, err := streamOutPath(dir, entry)
+	if err != nil {
+		return nil, fmt.Errorf("stream out: %s", err)
+	}
+
+	out, err := d.DockerRunner.CpOut(dockercli.CpCmd{Src: d.DockerID + ":" + src, Dst: "-"})
+	if err != nil {
+		return nil, fmt.Errorf("stream out: %s", err)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(checkTar(out, w))
+	}()
+
+	return &checkedTar{PipeReader: r, src: out}, nil
+}
+
+// streamOutPath returns the path docker cp should copy to tar entry in dir,
+// or dir's contents if entry is ".". dir must be absolute and clean, and
+// entry a single path component, so that nothing can climb out of dir.
+func streamOutPath(dir, entry string) (string, error) {
+	if !path.IsAbs(dir) || path.Clean(dir) != dir {
+		return "", fmt.Errorf("invalid directory %q", dir)
+	}
+
+	if entry == "." {
+		return strings.TrimSuffix(dir, "/") + "/.", nil
+	}
+
+	if entry == "" || entry == ".." || strings.Contains(entry, "/") {
+		return "", fmt.Errorf("invalid entry %q", entry)
+	}
+
+	return path.Join(dir, entry), nil
+}
+
+// checkTar copies the tar in to out, failing if any entry, or the target of
+// any hard link, is absolute or climbs out of the directory it is extracted
+// into.
+func checkTar(in io.Reader, out io.Writer) error {
+	tr := tar.NewReader(in)
+	tw := tar.NewWriter(out)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if escapes(hdr.Name) || (hdr.Typeflag == tar.TypeLink && escapes(hdr.Linkname)) {
+			return fmt.Errorf("stream out: tar entry %q escapes its destination", hdr.Name)
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func escapes(name string) bool {
+	clean := path.Clean(name)
+	return path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+// checkedTar closes docker cp's output along with the checked tar, so that
+// docker cp exits if the reader stops early.
+type checkedTar struct {
+	*io.PipeReader
+	src io.ReadCloser
+}
+
+func (c *checkedTar) Close() error {
+	c.PipeReader.Close()
+	return c.src.Close()
+}
+
+// rerootTar copies the tar in to out with each entry moved under dir and, if
+// owner is set, given to owner. Entries which would land outside dir are
+// refused.
+func rerootTar(in io.Reader, out io.Writer, dir string, owner *Owner) error {
+	tr := tar.NewReader(in)
+	tw := tar.NewWriter(out)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if hdr.Name, err = reroot(dir, hdr.Name); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeLink {
+			if hdr.Linkname, err = reroot(dir, hdr.Linkname); err != nil {
+				return err
+			}
+		}
+
+		if owner != nil {
+			hdr.Uid, hdr.Gid = owner.UID, owner.GID
+			hdr.Uname, hdr.Gname = "", ""
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// reroot returns name, a path in a tar, relative to the container's root
+// once it is moved under dir.
+func reroot(dir, name string) (string, error) {
+	rerooted := path.Join(dir, name)
+	if rerooted != dir && !strings.HasPrefix(rerooted, strings.TrimSuffix(dir, "/")+"/") {
+		return "", fmt.Errorf("tar entry %q is outside the destination directory", name)
+	}
+
+	if rerooted == "/" {
+		return ".", nil
+	}
+
+	return strings.TrimPrefix(rerooted, "/"), nil
 }
@@ -0,0 +1,394 @@
+package gardendocker_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/julz/garden-docker"
+	"github.com/julz/garden-docker/dockercli"
+	"github.com/julz/garden-docker/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StreamHandler", func() {
+	var streamer *fakes.FakeTarStreamer
+	var handler *gardendocker.StreamHandler
+	var streamedIn []byte
+
+	gzipped := func(data string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(data))
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	BeforeEach(func() {
+		streamer = new(fakes.FakeTarStreamer)
+		streamer.StreamInStub = func(_ string, r io.Reader) error {
+			var err error
+			streamedIn, err = ioutil.ReadAll(r)
+			return err
+		}
+		streamer.StreamOutReturns(ioutil.NopCloser(bytes.NewBufferString("some tar")), nil)
+
+		handler = &gardendocker.StreamHandler{Streamer: streamer}
+	})
+
+	Describe("StreamIn", func() {
+		It("passes plain tars through unchanged", func() {
+			Expect(handler.StreamIn("/some/path", bytes.NewBufferString("some tar"))).To(Succeed())
+
+			dst, _ := streamer.StreamInArgsForCall(0)
+			Expect(dst).To(Equal("/some/path"))
+			Expect(string(streamedIn)).To(Equal("some tar"))
+		})
+
+		It("decompresses gzipped tars", func() {
+			Expect(handler.StreamIn("/some/path", bytes.NewReader(gzipped("some tar")))).To(Succeed())
+			Expect(string(streamedIn)).To(Equal("some tar"))
+		})
+
+		It("passes empty streams through", func() {
+			Expect(handler.StreamIn("/some/path", bytes.NewBuffer(nil))).To(Succeed())
+			Expect(streamedIn).To(BeEmpty())
+		})
+
+		Context("when the streamer fails", func() {
+			It("returns the error", func() {
+				streamer.StreamInStub = nil
+				streamer.StreamInReturns(errors.New("boom"))
+
+				Expect(handler.StreamIn("/some/path", bytes.NewBufferString("some tar"))).To(MatchError("boom"))
+			})
+		})
+	})
+
+	Describe("StreamOut", func() {
+		It("returns the plain tar by default", func() {
+			out, err := handler.StreamOut("/some/path")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadAll(out)).To(Equal([]byte("some tar")))
+			dir, entry := streamer.StreamOutArgsForCall(0)
+			Expect(dir).To(Equal("/some"))
+			Expect(entry).To(Equal("path"))
+		})
+
+		Context("when gzip is requested", func() {
+			BeforeEach(func() {
+				handler.GzipStreamOut = true
+			})
+
+			It("compresses the tar", func() {
+				out, err := handler.StreamOut("/some/path")
+				Expect(err).NotTo(HaveOccurred())
+
+				gz, err := gzip.NewReader(out)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.ReadAll(gz)).To(Equal([]byte("some tar")))
+			})
+		})
+
+		Context("when the streamer fails", func() {
+			It("returns the error", func() {
+				streamer.StreamOutReturns(nil, errors.New("boom"))
+
+				_, err := handler.StreamOut("/some/path")
+				Expect(err).To(MatchError("boom"))
+			})
+		})
+	})
+
+	// These cases match the behaviour of garden-linux, which tars entry in
+	// dir (resolved against the user's home directory) for StreamOut, and
+	// extracts into the resolved path for StreamIn.
+	Describe("path semantics", func() {
+		BeforeEach(func() {
+			handler.HomeDir = "/home/vcap"
+		})
+
+		streamOutCases := []struct {
+			srcPath, dir, entry string
+		}{
+			{"/var/vcap/file.txt", "/var/vcap", "file.txt"},
+			{"/var/vcap/some-dir", "/var/vcap", "some-dir"},
+			{"/var/vcap/some-dir/", "/var/vcap/some-dir", "."},
+			{"/", "/", "."},
+			{"/var/vcap/some-dir/../other", "/var/vcap", "other"},
+			{"app", "/home/vcap", "app"},
+			{"app/", "/home/vcap/app", "."},
+			{"app/droplet.tgz", "/home/vcap/app", "droplet.tgz"},
+			{".", "/home/vcap", "."},
+			{"", "/home/vcap", "."},
+		}
+
+		for _, c := range streamOutCases {
+			c := c
+
+			It("streams out "+c.srcPath+" as "+c.entry+" in "+c.dir, func() {
+				_, err := handler.StreamOut(c.srcPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				dir, entry := streamer.StreamOutArgsForCall(0)
+				Expect(dir).To(Equal(c.dir))
+				Expect(entry).To(Equal(c.entry))
+			})
+		}
+
+		streamInCases := []struct {
+			dstPath, dir string
+		}{
+			{"/var/vcap/some-dir", "/var/vcap/some-dir"},
+			{"/var/vcap/some-dir/", "/var/vcap/some-dir"},
+			{"app", "/home/vcap/app"},
+			{".", "/home/vcap"},
+			{"", "/home/vcap"},
+		}
+
+		for _, c := range streamInCases {
+			c := c
+
+			It("streams in to "+c.dstPath+" by extracting into "+c.dir, func() {
+				Expect(handler.StreamIn(c.dstPath, bytes.NewBufferString("some tar"))).To(Succeed())
+
+				dir, _ := streamer.StreamInArgsForCall(0)
+				Expect(dir).To(Equal(c.dir))
+			})
+		}
+
+		Context("when no home directory is set", func() {
+			It("resolves relative paths against /", func() {
+				handler.HomeDir = ""
+				handler.StreamOut("app/")
+
+				dir, _ := streamer.StreamOutArgsForCall(0)
+				Expect(dir).To(Equal("/app"))
+			})
+		})
+	})
+
+	Context("when there is no streamer", func() {
+		BeforeEach(func() {
+			handler.Streamer = nil
+		})
+
+		It("returns an error rather than panicking", func() {
+			Expect(handler.StreamIn("/some/path", bytes.NewBufferString("some tar"))).To(Equal(gardendocker.ErrStreamingNotSupported))
+
+			_, err := handler.StreamOut("/some/path")
+			Expect(err).To(Equal(gardendocker.ErrStreamingNotSupported))
+		})
+	})
+})
+
+var _ = Describe("DockerStreamer", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var streamer *gardendocker.DockerStreamer
+	var copied []*tar.Header
+
+	tarOf := func(headers ...*tar.Header) io.Reader {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			Expect(tw.WriteHeader(hdr)).To(Succeed())
+			tw.Write(make([]byte, hdr.Size))
+		}
+		Expect(tw.Close()).To(Succeed())
+		return &buf
+	}
+
+	BeforeEach(func() {
+		copied = nil
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.CpInStub = func(_ dockercli.CpCmd, r io.Reader) error {
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					ioutil.ReadAll(r)
+					return nil
+				}
+				copied = append(copied, hdr)
+			}
+		}
+
+		streamer = &gardendocker.DockerStreamer{DockerRunner: dockerRunner, DockerID: "some-docker-id"}
+	})
+
+	It("copies the tar to the container's root with docker cp, keeping owners", func() {
+		Expect(streamer.StreamIn("/app", tarOf(&tar.Header{Name: "file", Size: 3, Mode: 0644}))).To(Succeed())
+
+		cmd, _ := dockerRunner.CpInArgsForCall(0)
+		Expect(cmd).To(Equal(dockercli.CpCmd{Src: "-", Dst: "some-docker-id:/", Archive: true}))
+	})
+
+	It("roots the tar's entries at the destination directory", func() {
+		Expect(streamer.StreamIn("/app/dir", tarOf(
+			&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "./sub/file", Size: 3, Mode: 0644, Uid: 7},
+			&tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "sub/file"},
+		))).To(Succeed())
+
+		Expect(copied).To(HaveLen(3))
+		Expect(copied[0].Name).To(Equal("app/dir"))
+		Expect(copied[1].Name).To(Equal("app/dir/sub/file"))
+		Expect(copied[1].Uid).To(Equal(7))
+		Expect(copied[2].Linkname).To(Equal("app/dir/sub/file"))
+	})
+
+	It("gives the entries to the Owner, if there is one", func() {
+		streamer.Owner = &gardendocker.Owner{UID: 1000, GID: 1001}
+
+		Expect(streamer.StreamIn("/", tarOf(&tar.Header{Name: "file", Size: 3, Mode: 0644, Uid: 0, Uname: "root"}))).To(Succeed())
+
+		Expect(copied[0].Name).To(Equal("file"))
+		Expect(copied[0].Uid).To(Equal(1000))
+		Expect(copied[0].Gid).To(Equal(1001))
+		Expect(copied[0].Uname).To(BeEmpty())
+	})
+
+	It("refuses entries which would land outside the destination", func() {
+		err := streamer.StreamIn("/app", tarOf(&tar.Header{Name: "../etc/passwd", Size: 3, Mode: 0644}))
+		Expect(err).To(MatchError(`stream in: tar entry "../etc/passwd" is outside the destination directory`))
+	})
+
+	Context("when docker cp fails", func() {
+		BeforeEach(func() {
+			dockerRunner.CpInReturns(errors.New("boom"))
+		})
+
+		It("returns an error", func() {
+			err := streamer.StreamIn("/app", tarOf(&tar.Header{Name: "file", Size: 3, Mode: 0644}))
+			Expect(err).To(MatchError("stream in: boom"))
+		})
+	})
+})
+
+var _ = Describe("DockerStreamer StreamOut", func() {
+	var dockerRunner *fakes.FakeDockerRunner
+	var streamer *gardendocker.DockerStreamer
+	var handler *gardendocker.StreamHandler
+
+	tarOf := func(headers ...*tar.Header) io.ReadCloser {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			Expect(tw.WriteHeader(hdr)).To(Succeed())
+			tw.Write(make([]byte, hdr.Size))
+		}
+		Expect(tw.Close()).To(Succeed())
+		return ioutil.NopCloser(&buf)
+	}
+
+	names := func(r io.Reader) []string {
+		var names []string
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return names
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, hdr.Name)
+		}
+	}
+
+	BeforeEach(func() {
+		dockerRunner = new(fakes.FakeDockerRunner)
+		dockerRunner.CpOutReturns(tarOf(&tar.Header{Name: "file", Size: 3, Mode: 0644}), nil)
+
+		streamer = &gardendocker.DockerStreamer{DockerRunner: dockerRunner, DockerID: "some-docker-id"}
+		handler = &gardendocker.StreamHandler{Streamer: streamer, HomeDir: "/home/vcap"}
+	})
+
+	It("copies the entry out of the container with docker cp", func() {
+		out, err := streamer.StreamOut("/app", "file")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(out)).To(Equal([]string{"file"}))
+
+		Expect(dockerRunner.CpOutArgsForCall(0)).To(Equal(dockercli.CpCmd{Src: "some-docker-id:/app/file", Dst: "-"}))
+	})
+
+	It("copies the contents of the directory for an entry of .", func() {
+		_, err := streamer.StreamOut("/app", ".")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dockerRunner.CpOutArgsForCall(0).Src).To(Equal("some-docker-id:/app/."))
+
+		_, err = streamer.StreamOut("/", ".")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dockerRunner.CpOutArgsForCall(1).Src).To(Equal("some-docker-id:/."))
+	})
+
+	Describe("path traversal", func() {
+		It("keeps relative paths which climb above the home directory inside the container", func() {
+			_, err := handler.StreamOut("../../../etc/passwd")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerRunner.CpOutArgsForCall(0).Src).To(Equal("some-docker-id:/etc/passwd"))
+		})
+
+		It("keeps absolute paths which climb above the root inside the container", func() {
+			_, err := handler.StreamOut("/../../etc/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerRunner.CpOutArgsForCall(0).Src).To(Equal("some-docker-id:/etc/."))
+		})
+
+		It("refuses entries which are not a single path component", func() {
+			for _, entry := range []string{"..", "../etc", "a/b", ""} {
+				_, err := streamer.StreamOut("/app", entry)
+				Expect(err).To(HaveOccurred(), entry)
+			}
+
+			Expect(dockerRunner.CpOutCallCount()).To(Equal(0))
+		})
+
+		It("refuses directories which are relative or unclean", func() {
+			for _, dir := range []string{"app", "/app/../..", "/app/"} {
+				_, err := streamer.StreamOut(dir, "file")
+				Expect(err).To(HaveOccurred(), dir)
+			}
+
+			Expect(dockerRunner.CpOutCallCount()).To(Equal(0))
+		})
+
+		It("fails the stream if an entry would be extracted outside its destination", func() {
+			dockerRunner.CpOutReturns(tarOf(
+				&tar.Header{Name: "ok", Size: 1, Mode: 0644},
+				&tar.Header{Name: "../../etc/passwd", Size: 1, Mode: 0644},
+			), nil)
+
+			out, err := streamer.StreamOut("/app", ".")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = ioutil.ReadAll(out)
+			Expect(err).To(MatchError(`stream out: tar entry "../../etc/passwd" escapes its destination`))
+		})
+
+		It("fails the stream on absolute entries and hard links out of the destination", func() {
+			dockerRunner.CpOutReturns(tarOf(&tar.Header{Name: "/etc/shadow", Size: 1, Mode: 0644}), nil)
+			out, _ := streamer.StreamOut("/app", ".")
+			_, err := ioutil.ReadAll(out)
+			Expect(err).To(HaveOccurred())
+
+			dockerRunner.CpOutReturns(tarOf(&tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "../../etc/shadow"}), nil)
+			out, _ = streamer.StreamOut("/app", ".")
+			_, err = ioutil.ReadAll(out)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when docker cp cannot be started", func() {
+		BeforeEach(func() {
+			dockerRunner.CpOutReturns(nil, errors.New("boom"))
+		})
+
+		It("returns an error", func() {
+			_, err := streamer.StreamOut("/app", "file")
+			Expect(err).To(MatchError("stream out: boom"))
+		})
+	})
+})
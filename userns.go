@@ -0,0 +1,65 @@
+package gardendocker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UserNamespace is the user namespace dockerd puts containers in when it is
+// run with --userns-remap: root in a container is RootUID and RootGID on the
+// host, the first of the remap user's subordinate ids.
+type UserNamespace struct {
+	RootUID int
+	RootGID int
+}
+
+// LoadUserNamespace finds the user namespace dockerd makes for the given
+// remap user (as passed to --userns-remap, e.g. dockremap) from the
+// subordinate id files, usually /etc/subuid and /etc/subgid.
+func LoadUserNamespace(user, subuidPath, subgidPath string) (*UserNamespace, error) {
+	uid, err := firstSubordinateID(subuidPath, user)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := firstSubordinateID(subgidPath, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserNamespace{RootUID: uid, RootGID: gid}, nil
+}
+
+// firstSubordinateID returns the start of the user's first range in a file
+// of "user:start:count" lines.
+func firstSubordinateID(path, user string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("user namespace: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(parts) != 3 || parts[0] != user {
+			continue
+		}
+
+		start, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, fmt.Errorf("user namespace: invalid range for %s in %s: %s", user, path, err)
+		}
+
+		return start, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("user namespace: %s", err)
+	}
+
+	return 0, fmt.Errorf("user namespace: no range for %s in %s", user, path)
+}
@@ -0,0 +1,39 @@
+package gardendocker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/julz/garden-docker"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadUserNamespace", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "userns")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(dir, "subuid"), []byte("someone:100000:65536\ndockremap:165536:65536\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "subgid"), []byte("dockremap:231072:65536\ndockremap:400000:65536\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("maps root to the start of the remap user's first subordinate ranges", func() {
+		userns, err := gardendocker.LoadUserNamespace("dockremap", filepath.Join(dir, "subuid"), filepath.Join(dir, "subgid"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userns).To(Equal(&gardendocker.UserNamespace{RootUID: 165536, RootGID: 231072}))
+	})
+
+	It("fails when the user has no range", func() {
+		_, err := gardendocker.LoadUserNamespace("nobody", filepath.Join(dir, "subuid"), filepath.Join(dir, "subgid"))
+		Expect(err).To(MatchError(ContainSubstring("no range for nobody")))
+	})
+})
@@ -0,0 +1,5 @@
+package gardendocker
+
+// Version is the version of garden-docker, set at build time with
+// -ldflags "-X github.com/julz/garden-docker.Version=...".
+var Version = "dev"